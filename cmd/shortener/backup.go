@@ -0,0 +1,191 @@
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"flag"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/logger"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/storage/v2"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/storage/v2/factory"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/storage/v2/transfer"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+)
+
+// backup writes all URL entries of the server storage (or the one given by -storage) as JSON lines and returns the
+// process exit code, the output is gzipped when its name ends with .gz:
+//
+//	shortener backup -o dump.jsonl.gz
+//
+// A file is written next to its final path first and renamed once complete, so that a failed backup does not replace
+// an earlier one.
+func backup(args []string) int {
+	flags := flag.NewFlagSet(os.Args[0]+" backup", flag.ExitOnError)
+	output := flags.String("o", "-", "Output file, - for standard output")
+	uri := flags.String("storage", "", "Storage URI, the server storage is backed up when empty")
+	err := flags.Parse(args)
+	if err != nil {
+		return 2
+	}
+	lg, err := newCommandLogger()
+	if err != nil {
+		return 1
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	ctxStorage, cancel := context.WithCancel(context.Background())
+	wg := &sync.WaitGroup{}
+	defer wg.Wait()
+	defer cancel()
+	st, _, err := initCommandStorage(ctxStorage, wg, *uri, lg)
+	if err != nil {
+		lg.Error("Initializing storage", logger.Error(err))
+		return 1
+	}
+	scanner, ok := st.(storage.EntryScanner)
+	if !ok {
+		lg.Error("Initializing storage: listing entries is not supported")
+		return 1
+	}
+	var count int
+	err = writeOutput(*output, func(w io.Writer) error {
+		count, err = transfer.Backup(ctx, scanner, w)
+		return err
+	})
+	if err != nil {
+		lg.Error("Backing up URLs", logger.Error(err))
+		return 1
+	}
+	lg.Info("Backing up URLs", logger.Int("count", count), logger.String("output", *output))
+	return 0
+}
+
+// restore loads URL entries written by backup into the server storage (or the one given by -storage) and returns the
+// process exit code, gzipped input is detected by its header:
+//
+//	shortener restore -i dump.jsonl.gz
+//
+// Entries whose sURL or URL is already taken are skipped, so that an interrupted restore can be run again.
+func restore(args []string) int {
+	flags := flag.NewFlagSet(os.Args[0]+" restore", flag.ExitOnError)
+	input := flags.String("i", "-", "Input file, - for standard input")
+	uri := flags.String("storage", "", "Storage URI, entries are restored into the server storage when empty")
+	progressEvery := flags.Int("progress", 1000, "Report progress every given number of entries")
+	err := flags.Parse(args)
+	if err != nil {
+		return 2
+	}
+	lg, err := newCommandLogger()
+	if err != nil {
+		return 1
+	}
+	var r io.Reader = os.Stdin
+	if *input != "-" {
+		file, err := os.Open(*input)
+		if err != nil {
+			lg.Error("Opening backup", logger.Error(err))
+			return 1
+		}
+		defer file.Close()
+		r = file
+	}
+	r, err = decompress(r)
+	if err != nil {
+		lg.Error("Opening backup", logger.Error(err))
+		return 1
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	ctxStorage, cancel := context.WithCancel(context.Background())
+	wg := &sync.WaitGroup{}
+	defer wg.Wait()
+	defer cancel()
+	st, backend, err := initCommandStorage(ctxStorage, wg, *uri, lg)
+	if err != nil {
+		lg.Error("Initializing storage", logger.Error(err))
+		return 1
+	}
+	stats, err := transfer.Restore(ctx, r, st, transfer.Options{
+		// deletion is not supported by infile DB handling
+		KeepDeleted:   backend != factory.BackendFile,
+		ProgressEvery: *progressEvery,
+		Progress: func(stats transfer.Stats) {
+			lg.Info("Restoring URLs", logger.Int("scanned", stats.Scanned), logger.Int("copied", stats.Copied),
+				logger.Int("skipped", stats.Skipped), logger.Int("dropped", stats.Dropped))
+		},
+	})
+	if err != nil {
+		lg.Error("Restoring URLs", logger.Error(err), logger.Int("scanned", stats.Scanned))
+		return 1
+	}
+	return 0
+}
+
+// writeOutput calls write with the output named name, gzipping it when the name ends with .gz. A file is written to a
+// temporary file in the same directory and renamed to name once write succeeds.
+func writeOutput(name string, write func(w io.Writer) error) (err error) {
+	if name == "-" {
+		return writeCompressed(os.Stdout, false, write)
+	}
+	file, err := os.CreateTemp(filepath.Dir(name), "."+filepath.Base(name)+".*")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			file.Close()
+			os.Remove(file.Name())
+		}
+	}()
+	err = writeCompressed(file, strings.HasSuffix(name, ".gz"), write)
+	if err != nil {
+		return err
+	}
+	err = file.Sync()
+	if err != nil {
+		return err
+	}
+	err = file.Close()
+	if err != nil {
+		return err
+	}
+	return os.Rename(file.Name(), name)
+}
+
+// writeCompressed calls write with a buffered w, gzipped when compress is set, and flushes it.
+func writeCompressed(w io.Writer, compress bool, write func(w io.Writer) error) error {
+	buffered := bufio.NewWriter(w)
+	if !compress {
+		err := write(buffered)
+		if err != nil {
+			return err
+		}
+		return buffered.Flush()
+	}
+	gz := gzip.NewWriter(buffered)
+	err := write(gz)
+	if err != nil {
+		return err
+	}
+	err = gz.Close()
+	if err != nil {
+		return err
+	}
+	return buffered.Flush()
+}
+
+// decompress returns a reader of r decompressing it when it starts with a gzip header.
+func decompress(r io.Reader) (io.Reader, error) {
+	buffered := bufio.NewReader(r)
+	header, err := buffered.Peek(2)
+	if err == nil && header[0] == 0x1f && header[1] == 0x8b {
+		return gzip.NewReader(buffered)
+	}
+	return buffered, nil
+}
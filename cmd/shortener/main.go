@@ -3,20 +3,41 @@ package main
 import (
 	"context"
 	"github.com/danilovkiri/dk_go_url_shortener/internal/api/rest"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/clickstream"
 	"github.com/danilovkiri/dk_go_url_shortener/internal/config"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/logger"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/reload"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/shutdown"
 	"github.com/danilovkiri/dk_go_url_shortener/internal/storage/v2"
-	"github.com/danilovkiri/dk_go_url_shortener/internal/storage/v2/infile"
-	"github.com/danilovkiri/dk_go_url_shortener/internal/storage/v2/inpsql"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/storage/v2/factory"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/tracing"
 	"log"
 	"net/http"
 	"os"
 	"os/signal"
 	"sync"
 	"syscall"
-	"time"
 )
 
 func main() {
+	// commands other than serving are given as the first argument
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "migrate":
+			os.Exit(migrate(os.Args[2:]))
+		case "backup":
+			os.Exit(backup(os.Args[2:]))
+		case "restore":
+			os.Exit(restore(os.Args[2:]))
+		case "role":
+			os.Exit(role(os.Args[2:]))
+		}
+	}
+	os.Exit(run())
+}
+
+// run starts the server and blocks until it is shut down, it returns the process exit code.
+func run() int {
 	// make a top-level file logger for logging critical errors
 	flog, err := os.OpenFile(`server.log`, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
 	if err != nil {
@@ -31,48 +52,126 @@ func main() {
 	// set number of wg members to 1 (this will be the persistStorage goroutine)
 	wg.Add(1)
 	// get configuration
-	cfg, err := config.NewDefaultConfiguration()
+	cfg, err := config.Load(os.Args[1:])
 	if err != nil {
 		mainlog.Fatal(err)
 	}
-	cfg.ParseFlags()
-	// initialize (or retrieve if present) storage, switch between "infile" and "inpsql" modules
-	var errInit error
-	var storageInit storage.URLStorage
-	switch cfg.StorageConfig.DatabaseDSN {
-	case "":
-		storageInit, errInit = infile.InitStorage(ctx, wg, cfg.StorageConfig)
-	default:
-		storageInit, errInit = inpsql.InitStorage(ctx, wg, cfg.StorageConfig)
+	// make a central structured logger shared by storage and handlers
+	logLevel, err := logger.ParseLevel(cfg.LogConfig.Level)
+	if err != nil {
+		mainlog.Fatal(err)
 	}
-
+	lg, err := logger.New(os.Stderr, logLevel, cfg.LogConfig.Format)
 	if err != nil {
-		mainlog.Fatal(errInit)
+		mainlog.Fatal(err)
+	}
+	// reload parameters which can be changed while running on SIGHUP
+	watcher := reload.NewWatcher(cfg, func() (*config.Config, error) {
+		return config.Load(os.Args[1:])
+	}, lg)
+	watcher.Add("logger", func(cfg *config.Config) error {
+		level, err := logger.ParseLevel(cfg.LogConfig.Level)
+		if err != nil {
+			return err
+		}
+		lg.SetLevel(level)
+		return nil
+	}, "LOG_LEVEL")
+	// export spans of handlers, service and storage when an OTLP endpoint is configured
+	tracer := tracing.NewTracer(cfg.TracingConfig, lg)
+	tracing.SetTracer(tracer)
+	// publish an event per redirect when a click events broker is configured
+	clicks, err := clickstream.NewPublisher(cfg.ClickEventsConfig, lg)
+	if err != nil {
+		mainlog.Fatal(err)
+	}
+	// initialize (or retrieve if present) storage, the backend is selected by the storage URI scheme
+	storageInit, errInit := factory.InitStorage(ctx, wg, cfg.StorageConfig, lg)
+	// do not open the listener unless the storage (including its schema) is fully initialized
+	if errInit != nil {
+		mainlog.Fatal("Storage initialization failed: ", errInit)
+	}
+	if resizable, ok := storageInit.(storage.DeleteWorkersSetter); ok {
+		watcher.Add("delete workers", func(cfg *config.Config) error {
+			resizable.SetDeleteWorkers(cfg.StorageConfig.DeleteWorkers)
+			return nil
+		}, "DELETE_WORKERS")
 	}
 	// initialize server
-	server, err := rest.InitServer(ctx, cfg, storageInit)
+	server, err := rest.InitServer(ctx, cfg, storageInit, clicks, watcher, lg)
 	if err != nil {
 		mainlog.Fatal(err)
 	}
+	go watcher.Run(ctx)
+	// serve HTTPS directly when enabled, optionally redirecting plain HTTP to it
+	var redirectServer *http.Server
+	if cfg.ServerConfig.EnableHTTPS {
+		redirectServer, err = rest.InitTLS(server, cfg.ServerConfig)
+		if err != nil {
+			mainlog.Fatal(err)
+		}
+	}
 	// set a listener for os.Signal
 	done := make(chan os.Signal, 1)
 	signal.Notify(done, os.Interrupt, syscall.SIGINT, syscall.SIGTERM)
+	// start up the server
+	serveErr := make(chan error, 2)
 	go func() {
-		<-done
-		mainlog.Print("Server shutdown attempted")
-		ctxTO, cancelTO := context.WithTimeout(ctx, 5*time.Second)
-		defer cancelTO()
-		if err := server.Shutdown(ctxTO); err != nil {
-			mainlog.Fatal("Server shutdown failed:", err)
+		mainlog.Print("Server start attempted")
+		if cfg.ServerConfig.EnableHTTPS {
+			serveErr <- server.ListenAndServeTLS(cfg.ServerConfig.TLSCertFile, cfg.ServerConfig.TLSKeyFile)
+			return
 		}
-		cancel()
+		serveErr <- server.ListenAndServe()
 	}()
-	// start up the server
-	mainlog.Print("Server start attempted")
-	if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-		mainlog.Fatal(err)
+	if redirectServer != nil {
+		go func() {
+			serveErr <- redirectServer.ListenAndServe()
+		}()
+	}
+	// stop accepting connections and drain in-flight requests first so that every accepted deletion is enqueued,
+	// then cancel ctx to let storage drain the deletion queue and close the DB, waiting for its goroutine to finish
+	orchestrator := shutdown.NewOrchestrator(lg)
+	orchestrator.Add("HTTP server", func(ctxTO context.Context) error {
+		err := server.Shutdown(ctxTO)
+		if err != nil {
+			// drop connections still active at the deadline
+			server.Close()
+		}
+		return err
+	})
+	if redirectServer != nil {
+		orchestrator.Add("HTTP redirect server", func(ctxTO context.Context) error {
+			err := redirectServer.Shutdown(ctxTO)
+			if err != nil {
+				redirectServer.Close()
+			}
+			return err
+		})
+	}
+	orchestrator.Add("click events", clicks.Shutdown)
+	orchestrator.Add("storage", func(ctxTO context.Context) error {
+		cancel()
+		return shutdown.WaitGroup(wg)(ctxTO)
+	})
+	orchestrator.Add("tracing", tracer.Shutdown)
+	exitCode := 0
+	select {
+	case sig := <-done:
+		// restore default signal handling so that a repeated signal terminates immediately
+		signal.Stop(done)
+		lg.Info("Shutdown signal received", logger.String("signal", sig.String()))
+	case err := <-serveErr:
+		lg.Error("Serving HTTP", logger.Error(err))
+		exitCode = 1
+	}
+	mainlog.Print("Server shutdown attempted")
+	ctxTO, cancelTO := context.WithTimeout(context.Background(), cfg.ServerConfig.ShutdownTimeout)
+	defer cancelTO()
+	if err := orchestrator.Shutdown(ctxTO); err != nil {
+		mainlog.Print("Server shutdown failed: ", err)
+		return 1
 	}
-	// wait for goroutine in InitStorage to finish before exiting
-	wg.Wait()
 	mainlog.Print("Server shutdown succeeded")
+	return exitCode
 }
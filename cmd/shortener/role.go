@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/logger"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/service/authenticator"
+	"os"
+	"sync"
+	"time"
+)
+
+// roleTimeout bounds setting a role in the storage.
+const roleTimeout = 10 * time.Second
+
+// role grants a role to a registered account of the server storage (or the one given by -storage) and returns the
+// process exit code, roles are never granted by registration:
+//
+//	shortener role -login alice -role admin
+//
+// An empty -role revokes the current role, admin endpoints reject access tokens issued before right away.
+func role(args []string) int {
+	flags := flag.NewFlagSet(os.Args[0]+" role", flag.ExitOnError)
+	login := flags.String("login", "", "Login of the account")
+	name := flags.String("role", authenticator.RoleAdmin, "Role to grant, empty revokes the current one")
+	uri := flags.String("storage", "", "Storage URI, the server storage is used when empty")
+	err := flags.Parse(args)
+	if err != nil {
+		return 2
+	}
+	if *login == "" {
+		fmt.Fprintln(os.Stderr, "-login is required")
+		flags.Usage()
+		return 2
+	}
+	if *name != "" && *name != authenticator.RoleAdmin {
+		fmt.Fprintf(os.Stderr, "-role must be either %s or empty, got %q\n", authenticator.RoleAdmin, *name)
+		return 2
+	}
+	lg, err := newCommandLogger()
+	if err != nil {
+		return 1
+	}
+	ctxStorage, cancel := context.WithCancel(context.Background())
+	wg := &sync.WaitGroup{}
+	defer wg.Wait()
+	defer cancel()
+	st, _, err := initCommandStorage(ctxStorage, wg, *uri, lg)
+	if err != nil {
+		lg.Error("Initializing storage", logger.Error(err))
+		return 1
+	}
+	ctx, cancelTO := context.WithTimeout(context.Background(), roleTimeout)
+	defer cancelTO()
+	err = st.SetUserRole(ctx, *login, *name)
+	if err != nil {
+		lg.Error("Setting role", logger.Error(err), logger.String("login", *login))
+		return 1
+	}
+	lg.Info("Setting role", logger.String("login", *login), logger.String("role", *name))
+	return 0
+}
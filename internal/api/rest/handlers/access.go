@@ -0,0 +1,31 @@
+package handlers
+
+import (
+	"github.com/danilovkiri/dk_go_url_shortener/internal/api/rest/middleware"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/logger"
+	"github.com/go-chi/chi"
+	"net/http"
+)
+
+// RequireURLAccess returns a middleware handler serving requests about the short URL of the urlID route parameter
+// only to its creator and members of the organization it belongs to, other users are answered with 403 and unknown
+// short URLs with 404.
+func (h *URLHandler) RequireURLAccess(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// bound DB operations by the timeout budget of the route
+		ctx, cancel := requestContext(r)
+		defer cancel()
+		userID, err := getUserID(r)
+		if err != nil {
+			h.logger(r).Error("RequireURLAccess", logger.Error(err))
+			middleware.Error(w, r, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		err = h.processor.AuthorizeURL(ctx, chi.URLParam(r, "urlID"), userID)
+		if err != nil {
+			writeError(w, r, h.logger(r), "RequireURLAccess", err)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,118 @@
+package handlers
+
+import (
+	"context"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/api/rest/middleware"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/api/rest/modeldto"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/logger"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/service/modelurl"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// eraseTimeout limits the time spent on erasing all data of one user.
+const eraseTimeout = 30 * time.Second
+
+// HandleExportUserData responds with everything stored about the current user as a downloadable JSON file using
+// modeldto.ResponseUserData schema.
+func (h *URLHandler) HandleExportUserData() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// set context timeout for timing DB operations of the whole export
+		ctx, cancel := context.WithTimeout(r.Context(), exportTimeout)
+		defer cancel()
+		userID, err := getUserID(r)
+		if err != nil {
+			h.logger(r).Error("HandleExportUserData", logger.Error(err))
+			middleware.Error(w, r, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		data, err := h.processor.ExportUserData(ctx, userID)
+		if err != nil {
+			writeError(w, r, h.logger(r), "HandleExportUserData", err)
+			return
+		}
+		u, err := url.Parse(h.serverConfig.BaseURL)
+		if err != nil {
+			h.logger(r).Error("HandleExportUserData", logger.Error(err))
+			middleware.Error(w, r, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		response := modeldto.ResponseUserData{
+			UserID:  data.UserID,
+			Logins:  make([]string, 0, len(data.Logins)),
+			URLs:    make([]modeldto.ResponseUserURL, 0, len(data.URLs)),
+			APIKeys: make([]modeldto.ResponseAPIKey, 0, len(data.APIKeys)),
+			Domains: make([]modeldto.ResponseDomain, 0, len(data.Domains)),
+			Orgs:    make([]modeldto.ResponseOrg, 0, len(data.Orgs)),
+			// UTM defaults are omitted for users without them
+			UTMDefaults: data.UTMDefaults,
+		}
+		response.Logins = append(response.Logins, data.Logins...)
+		for _, userURL := range data.URLs {
+			response.URLs = append(response.URLs, toResponseUserURL(*u, userURL))
+		}
+		for _, apiKey := range data.APIKeys {
+			response.APIKeys = append(response.APIKeys, toResponseAPIKey(apiKey))
+		}
+		for _, domain := range data.Domains {
+			response.Domains = append(response.Domains, toResponseDomain(domain))
+		}
+		for _, org := range data.Orgs {
+			response.Orgs = append(response.Orgs, toResponseOrg(org))
+		}
+		// set and send response body
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Disposition", `attachment; filename="user-data.json"`)
+		err = encodeJSON(w, response)
+		if err != nil {
+			h.logger(r).Warn("HandleExportUserData", logger.Error(err))
+		}
+	}
+}
+
+// HandleEraseUser permanently removes all data of the current user, links queued for deletion included.
+func (h *URLHandler) HandleEraseUser() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// set context timeout for timing DB operations of the whole erasure
+		ctx, cancel := context.WithTimeout(r.Context(), eraseTimeout)
+		defer cancel()
+		userID, err := getUserID(r)
+		if err != nil {
+			h.logger(r).Error("HandleEraseUser", logger.Error(err))
+			middleware.Error(w, r, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		err = h.processor.EraseUser(ctx, userID)
+		if err != nil {
+			writeError(w, r, h.logger(r), "HandleEraseUser", err)
+			return
+		}
+		h.logger(r).Info("user erased", logger.String("userID", userID))
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// toResponseUserURL converts a link of a user along with its redirect statistics to modeldto.ResponseUserURL schema.
+func toResponseUserURL(baseURL url.URL, userURL modelurl.UserURL) modeldto.ResponseUserURL {
+	response := modeldto.ResponseUserURL{
+		ResponseFullURL: modeldto.ResponseFullURL{
+			URL:        userURL.URL,
+			SURL:       shortURL(baseURL, userURL.SURL, userURL.Domain),
+			Title:      userURL.Title,
+			FaviconURL: userURL.FaviconURL,
+			Disabled:   userURL.Disabled,
+		},
+		TotalClicks:          userURL.Stats.TotalClicks,
+		ClicksPerDay:         make([]modeldto.ResponseDayClicks, 0, len(userURL.Stats.ClicksPerDay)),
+		ClicksPerDestination: make([]modeldto.ResponseDestinationClicks, 0, len(userURL.Stats.ClicksPerDestination)),
+		UniqueVisitors:       userURL.Stats.UniqueVisitors,
+	}
+	for _, daily := range userURL.Stats.ClicksPerDay {
+		response.ClicksPerDay = append(response.ClicksPerDay, modeldto.ResponseDayClicks{Date: daily.Date, Clicks: daily.Clicks, UniqueVisitors: daily.Visitors})
+	}
+	for _, served := range userURL.Stats.ClicksPerDestination {
+		response.ClicksPerDestination = append(response.ClicksPerDestination, modeldto.ResponseDestinationClicks{URL: served.URL, Clicks: served.Clicks})
+	}
+	return response
+}
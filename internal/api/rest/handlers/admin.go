@@ -0,0 +1,241 @@
+package handlers
+
+import (
+	"fmt"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/api/rest/middleware"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/api/rest/modeldto"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/logger"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/service/modelurl"
+	"github.com/go-chi/chi"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// HandleSearchURLs responds with URLs of all users whose original or short URL contains the q query parameter using
+// modeldto.ResponseAdminURL schema, URLs are sorted and paged the same way as HandleGetURLsByUserID does.
+func (h *URLHandler) HandleSearchURLs() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// bound DB operations by the timeout budget of the route
+		ctx, cancel := requestContext(r)
+		defer cancel()
+		opts, err := parseListOptions(r)
+		if err != nil {
+			h.logger(r).Warn("HandleSearchURLs", logger.Error(err))
+			middleware.Error(w, r, err.Error(), http.StatusBadRequest)
+			return
+		}
+		URLs, err := h.processor.SearchURLs(ctx, r.URL.Query().Get("q"), opts)
+		if err != nil {
+			writeError(w, r, h.logger(r), "HandleSearchURLs", err)
+			return
+		}
+		u, err := url.Parse(h.serverConfig.BaseURL)
+		if err != nil {
+			h.logger(r).Error("HandleSearchURLs", logger.Error(err))
+			middleware.Error(w, r, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		responseURLs := make([]modeldto.ResponseAdminURL, 0, len(URLs))
+		for _, fullURL := range URLs {
+			responseURLs = append(responseURLs, modeldto.ResponseAdminURL{
+				URL:      fullURL.URL,
+				SURL:     shortURL(*u, fullURL.SURL, fullURL.Domain),
+				UserID:   fullURL.UserID,
+				Title:    fullURL.Title,
+				Disabled: fullURL.Disabled,
+			})
+		}
+		// set and send response body
+		w.Header().Set("Content-Type", "application/json")
+		err = encodeJSON(w, responseURLs)
+		if err != nil {
+			h.logger(r).Warn("HandleSearchURLs", logger.Error(err))
+		}
+	}
+}
+
+// HandleDisableURLBatch disables short URL IDs of any user from a JSON array so that they are no longer redirected to
+// and responds with the IDs which were not disabled before.
+func (h *URLHandler) HandleDisableURLBatch() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// bound DB operations by the timeout budget of the route
+		ctx, cancel := requestContext(r)
+		defer cancel()
+		// check for POST body content type compliance
+		if r.Header.Get("Content-Type") != "application/json" {
+			middleware.Error(w, r, "Invalid Content-Type", http.StatusBadRequest)
+			return
+		}
+		// deserialize JSON into slice directly from POST body
+		disableURLs := make([]string, 0)
+		err := decodeJSON(r.Body, &disableURLs)
+		if err != nil {
+			h.logger(r).Warn("HandleDisableURLBatch", logger.Error(err))
+			middleware.Error(w, r, err.Error(), http.StatusBadRequest)
+			return
+		}
+		userID, err := getUserID(r)
+		if err != nil {
+			h.logger(r).Error("HandleDisableURLBatch", logger.Error(err))
+			middleware.Error(w, r, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		disabled, err := h.processor.DisableURLs(ctx, userID, disableURLs)
+		if err != nil {
+			writeError(w, r, h.logger(r), "HandleDisableURLBatch", err)
+			return
+		}
+		h.logger(r).Info("URLs disabled", logger.Any("sURLs", disabled))
+		if disabled == nil {
+			disabled = make([]string, 0)
+		}
+		// set and send response body
+		w.Header().Set("Content-Type", "application/json")
+		err = encodeJSON(w, disabled)
+		if err != nil {
+			h.logger(r).Warn("HandleDisableURLBatch", logger.Error(err))
+		}
+	}
+}
+
+// HandleListUsers responds with registered users using modeldto.ResponseUser schema; users are sorted by login in the
+// order set via the order query parameter (asc by default) and paged via limit and offset query parameters.
+func (h *URLHandler) HandleListUsers() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// bound DB operations by the timeout budget of the route
+		ctx, cancel := requestContext(r)
+		defer cancel()
+		opts, err := parseListOptions(r)
+		if err != nil {
+			h.logger(r).Warn("HandleListUsers", logger.Error(err))
+			middleware.Error(w, r, err.Error(), http.StatusBadRequest)
+			return
+		}
+		// logins are listed alphabetically unless asked otherwise
+		opts.Desc = r.URL.Query().Get("order") == "desc"
+		users, err := h.processor.ListUsers(ctx, opts)
+		if err != nil {
+			writeError(w, r, h.logger(r), "HandleListUsers", err)
+			return
+		}
+		responseUsers := make([]modeldto.ResponseUser, 0, len(users))
+		for _, user := range users {
+			responseUsers = append(responseUsers, modeldto.ResponseUser{Login: user.Login, UserID: user.UserID})
+		}
+		// set and send response body
+		w.Header().Set("Content-Type", "application/json")
+		err = encodeJSON(w, responseUsers)
+		if err != nil {
+			h.logger(r).Warn("HandleListUsers", logger.Error(err))
+		}
+	}
+}
+
+// HandleGetUserStats responds with totals of links of a user and their redirects using modeldto.ResponseUserStats
+// schema.
+func (h *URLHandler) HandleGetUserStats() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// bound DB operations by the timeout budget of the route
+		ctx, cancel := requestContext(r)
+		defer cancel()
+		userID := chi.URLParam(r, "userID")
+		stats, err := h.processor.UserStats(ctx, userID)
+		if err != nil {
+			writeError(w, r, h.logger(r), "HandleGetUserStats", err)
+			return
+		}
+		// set and send response body
+		w.Header().Set("Content-Type", "application/json")
+		err = encodeJSON(w, modeldto.ResponseUserStats{
+			UserID:   stats.UserID,
+			URLs:     stats.URLs,
+			Disabled: stats.Disabled,
+			Clicks:   stats.Clicks,
+		})
+		if err != nil {
+			h.logger(r).Warn("HandleGetUserStats", logger.Error(err))
+		}
+	}
+}
+
+// HandleListAudit responds with records of mutating operations using modeldto.ResponseAuditRecord schema, records are
+// filtered via actor, action, entity and entity_id query parameters and via since and until RFC 3339 times, sorted by
+// the time of the operation and paged the same way as HandleGetURLsByUserID does.
+func (h *URLHandler) HandleListAudit() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// bound DB operations by the timeout budget of the route
+		ctx, cancel := requestContext(r)
+		defer cancel()
+		opts, err := parseListOptions(r)
+		if err != nil {
+			h.logger(r).Warn("HandleListAudit", logger.Error(err))
+			middleware.Error(w, r, err.Error(), http.StatusBadRequest)
+			return
+		}
+		filter, err := parseAuditFilter(r)
+		if err != nil {
+			h.logger(r).Warn("HandleListAudit", logger.Error(err))
+			middleware.Error(w, r, err.Error(), http.StatusBadRequest)
+			return
+		}
+		records, err := h.processor.ListAudit(ctx, filter, opts)
+		if err != nil {
+			writeError(w, r, h.logger(r), "HandleListAudit", err)
+			return
+		}
+		responseRecords := make([]modeldto.ResponseAuditRecord, 0, len(records))
+		for _, record := range records {
+			responseRecords = append(responseRecords, modeldto.ResponseAuditRecord{
+				ID:        record.ID,
+				Actor:     record.Actor,
+				Action:    record.Action,
+				Entity:    record.Entity,
+				EntityID:  record.EntityID,
+				Before:    record.Before,
+				After:     record.After,
+				CreatedAt: record.CreatedAt,
+			})
+		}
+		// set and send response body
+		w.Header().Set("Content-Type", "application/json")
+		err = encodeJSON(w, responseRecords)
+		if err != nil {
+			h.logger(r).Warn("HandleListAudit", logger.Error(err))
+		}
+	}
+}
+
+// parseAuditFilter reads audit records filter from query parameters.
+func parseAuditFilter(r *http.Request) (modelurl.AuditFilter, error) {
+	query := r.URL.Query()
+	filter := modelurl.AuditFilter{
+		Actor:    query.Get("actor"),
+		Action:   query.Get("action"),
+		Entity:   query.Get("entity"),
+		EntityID: query.Get("entity_id"),
+	}
+	var err error
+	filter.Since, err = parseTimeParam(query, "since")
+	if err != nil {
+		return filter, err
+	}
+	filter.Until, err = parseTimeParam(query, "until")
+	if err != nil {
+		return filter, err
+	}
+	return filter, nil
+}
+
+// parseTimeParam reads an optional RFC 3339 time from the query parameter name.
+func parseTimeParam(query url.Values, name string) (*time.Time, error) {
+	raw := query.Get(name)
+	if raw == "" {
+		return nil, nil
+	}
+	t, err := time.Parse(time.RFC3339, raw)
+	if err != nil {
+		return nil, fmt.Errorf("%s must be an RFC 3339 time", name)
+	}
+	return &t, nil
+}
@@ -0,0 +1,65 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/service/modelurl"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// redirectETag returns the entity tag of redirect, it changes along with the status code and the Location header.
+func redirectETag(redirect modelurl.Redirect) string {
+	sum := sha256.Sum256([]byte(strconv.Itoa(redirect.Type) + " " + redirect.URL))
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// writeRedirectValidators sets ETag, Last-Modified (when the modification time of redirect is known) and cacheControl
+// (unless it is empty) headers of redirect and answers conditional requests matching them with 304, it reports
+// whether the response is written. Varying redirects are sent with no-store and without validators instead, since a
+// cached redirect would send the visitor to the destination of another one or skip the password or the click limit.
+func writeRedirectValidators(w http.ResponseWriter, r *http.Request, redirect modelurl.Redirect, cacheControl string) bool {
+	if redirect.Varying {
+		w.Header().Set("Cache-Control", "no-store")
+		return false
+	}
+	etag := redirectETag(redirect)
+	w.Header().Set("ETag", etag)
+	if !redirect.ModifiedAt.IsZero() {
+		w.Header().Set("Last-Modified", redirect.ModifiedAt.UTC().Format(http.TimeFormat))
+	}
+	if cacheControl != "" {
+		w.Header().Set("Cache-Control", cacheControl)
+	}
+	if !notModified(r, etag, redirect.ModifiedAt) {
+		return false
+	}
+	w.WriteHeader(http.StatusNotModified)
+	return true
+}
+
+// notModified reports whether conditional headers of r match etag or modifiedAt, If-Modified-Since is only evaluated
+// without If-None-Match as RFC 7232 requires.
+func notModified(r *http.Request, etag string, modifiedAt time.Time) bool {
+	if ifNoneMatch := r.Header.Get("If-None-Match"); ifNoneMatch != "" {
+		for _, candidate := range strings.Split(ifNoneMatch, ",") {
+			// GET and HEAD requests compare entity tags weakly
+			candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+			if candidate == "*" || candidate == etag {
+				return true
+			}
+		}
+		return false
+	}
+	if modifiedAt.IsZero() {
+		return false
+	}
+	since, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+	if err != nil {
+		return false
+	}
+	// Last-Modified is precise to seconds
+	return !modifiedAt.Truncate(time.Second).After(since)
+}
@@ -0,0 +1,19 @@
+//go:build gojson
+// +build gojson
+
+package handlers
+
+import (
+	"github.com/goccy/go-json"
+	"io"
+)
+
+// decodeJSON deserializes JSON read from r directly into v using goccy/go-json.
+func decodeJSON(r io.Reader, v interface{}) error {
+	return json.NewDecoder(r).Decode(v)
+}
+
+// encodeJSON serializes v as JSON directly into w using goccy/go-json.
+func encodeJSON(w io.Writer, v interface{}) error {
+	return json.NewEncoder(w).Encode(v)
+}
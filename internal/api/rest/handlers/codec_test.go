@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/api/rest/modeldto"
+	"io/ioutil"
+	"testing"
+)
+
+// batchPayloadSize sets the number of entries in the benchmarked batch payload.
+const batchPayloadSize = 10000
+
+// makeBatchPayload builds a JSON batch shortening request body with n entries.
+func makeBatchPayload(b *testing.B, n int) []byte {
+	batch := make([]modeldto.RequestBatchURL, 0, n)
+	for i := 0; i < n; i++ {
+		batch = append(batch, modeldto.RequestBatchURL{
+			CorrelationID: fmt.Sprintf("correlation-%d", i),
+			URL:           fmt.Sprintf("https://www.example.com/some/rather/long/path/%d?utm_source=benchmark", i),
+		})
+	}
+	payload, err := json.Marshal(batch)
+	if err != nil {
+		b.Fatal(err)
+	}
+	return payload
+}
+
+// BenchmarkDecodeBatchBuffered measures the previous decode path: read the whole body, then unmarshal it.
+func BenchmarkDecodeBatchBuffered(b *testing.B) {
+	payload := makeBatchPayload(b, batchPayloadSize)
+	b.SetBytes(int64(len(payload)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		body, err := ioutil.ReadAll(bytes.NewReader(payload))
+		if err != nil {
+			b.Fatal(err)
+		}
+		var post []modeldto.RequestBatchURL
+		err = json.Unmarshal(body, &post)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkDecodeBatchStreaming measures the current decode path: decode straight from the body reader.
+func BenchmarkDecodeBatchStreaming(b *testing.B) {
+	payload := makeBatchPayload(b, batchPayloadSize)
+	b.SetBytes(int64(len(payload)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var post []modeldto.RequestBatchURL
+		err := decodeJSON(bytes.NewReader(payload), &post)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
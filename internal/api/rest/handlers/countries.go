@@ -0,0 +1,55 @@
+package handlers
+
+import (
+	"github.com/danilovkiri/dk_go_url_shortener/internal/api/rest/middleware"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/api/rest/modeldto"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/logger"
+	"github.com/go-chi/chi"
+	"net/http"
+	"net/url"
+)
+
+// HandleGetURLCountries provides redirect counts of a shortened URL per visitor country along with the number of
+// redirects of visitors whose country was not resolved using modeldto.ResponseCountries schema. Redirects of bots are
+// only counted with include_bots=true.
+func (h *URLHandler) HandleGetURLCountries() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// bound DB operations by the timeout budget of the route
+		ctx, cancel := requestContext(r)
+		defer cancel()
+		includeBots, err := parseIncludeBots(r.URL.Query())
+		if err != nil {
+			h.logger(r).Warn("HandleGetURLCountries", logger.Error(err))
+			middleware.Error(w, r, err.Error(), http.StatusBadRequest)
+			return
+		}
+		sURL := chi.URLParam(r, "urlID")
+		stats, err := h.processor.Countries(ctx, sURL, includeBots)
+		if err != nil {
+			writeError(w, r, h.logger(r), "HandleGetURLCountries", err)
+			return
+		}
+		// create and serialize response object into JSON
+		u, err := url.Parse(h.serverConfig.BaseURL)
+		if err != nil {
+			h.logger(r).Warn("HandleGetURLCountries", logger.Error(err))
+			middleware.Error(w, r, err.Error(), http.StatusBadRequest)
+			return
+		}
+		u.Path = stats.SURL
+		response := modeldto.ResponseCountries{
+			SURL:          u.String(),
+			UnknownClicks: stats.UnknownClicks,
+			Countries:     make([]modeldto.ResponseCountryClicks, 0, len(stats.Countries)),
+		}
+		for _, country := range stats.Countries {
+			response.Countries = append(response.Countries, modeldto.ResponseCountryClicks{Country: country.Country, Clicks: country.Clicks})
+		}
+		// set and send response body
+		w.Header().Set("Content-Type", "application/json")
+		err = encodeJSON(w, response)
+		if err != nil {
+			h.logger(r).Warn("HandleGetURLCountries", logger.Error(err))
+		}
+	}
+}
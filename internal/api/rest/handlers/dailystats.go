@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"fmt"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/api/rest/middleware"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/api/rest/modeldto"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/logger"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/service/modelurl"
+	"github.com/go-chi/chi"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// date range limits of daily stats: the last defaultDailyStatsDays days are provided by default and ranges span up to
+// maxDailyStatsDays days
+const (
+	dateFormat            = "2006-01-02"
+	defaultDailyStatsDays = 30
+	maxDailyStatsDays     = 366
+)
+
+// HandleGetUserURLStats provides redirect counts of a shortened URL of the user per UTC day within the from and to
+// dates (both inclusive) using modeldto.ResponseDailyStats schema, counts of the last 30 days are provided by default.
+// Redirects of bots are only counted with include_bots=true.
+func (h *URLHandler) HandleGetUserURLStats() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// bound DB operations by the timeout budget of the route
+		ctx, cancel := requestContext(r)
+		defer cancel()
+		query := r.URL.Query()
+		from, to, err := parseDateRange(query, time.Now().UTC())
+		if err != nil {
+			h.logger(r).Warn("HandleGetUserURLStats", logger.Error(err))
+			middleware.Error(w, r, err.Error(), http.StatusBadRequest)
+			return
+		}
+		includeBots, err := parseIncludeBots(query)
+		if err != nil {
+			h.logger(r).Warn("HandleGetUserURLStats", logger.Error(err))
+			middleware.Error(w, r, err.Error(), http.StatusBadRequest)
+			return
+		}
+		sURL := chi.URLParam(r, "urlID")
+		series, err := h.processor.TimeSeries(ctx, sURL, modelurl.GranularityDay, from, to.AddDate(0, 0, 1), includeBots)
+		if err != nil {
+			writeError(w, r, h.logger(r), "HandleGetUserURLStats", err)
+			return
+		}
+		// create and serialize response object into JSON
+		u, err := url.Parse(h.serverConfig.BaseURL)
+		if err != nil {
+			h.logger(r).Warn("HandleGetUserURLStats", logger.Error(err))
+			middleware.Error(w, r, err.Error(), http.StatusBadRequest)
+			return
+		}
+		u.Path = series.SURL
+		response := modeldto.ResponseDailyStats{
+			SURL: u.String(),
+			From: from.Format(dateFormat),
+			To:   to.Format(dateFormat),
+			Days: make([]modeldto.ResponseDailyClicks, 0, len(series.Buckets)),
+		}
+		for _, bucket := range series.Buckets {
+			response.TotalClicks += bucket.Clicks
+			response.Days = append(response.Days, modeldto.ResponseDailyClicks{Date: bucket.Start.Format(dateFormat), Clicks: bucket.Clicks})
+		}
+		// set and send response body
+		w.Header().Set("Content-Type", "application/json")
+		err = encodeJSON(w, response)
+		if err != nil {
+			h.logger(r).Warn("HandleGetUserURLStats", logger.Error(err))
+		}
+	}
+}
+
+// parseDateRange returns UTC midnights of the from and to date query parameters, to defaults to the date of now and
+// from to defaultDailyStatsDays days up to to. The range must not be reversed and spans up to maxDailyStatsDays days.
+func parseDateRange(query url.Values, now time.Time) (from, to time.Time, err error) {
+	to = now.UTC().Truncate(24 * time.Hour)
+	if raw := query.Get("to"); raw != "" {
+		to, err = time.Parse(dateFormat, raw)
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("to must be a date in the YYYY-MM-DD form")
+		}
+	}
+	from = to.AddDate(0, 0, 1-defaultDailyStatsDays)
+	if raw := query.Get("from"); raw != "" {
+		from, err = time.Parse(dateFormat, raw)
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("from must be a date in the YYYY-MM-DD form")
+		}
+	}
+	if to.Before(from) {
+		return time.Time{}, time.Time{}, fmt.Errorf("from must not be after to")
+	}
+	if days := int(to.Sub(from).Hours()/24) + 1; days > maxDailyStatsDays {
+		return time.Time{}, time.Time{}, fmt.Errorf("date range may span up to %d days, got %d", maxDailyStatsDays, days)
+	}
+	return from, to, nil
+}
@@ -0,0 +1,23 @@
+package handlers
+
+import (
+	"github.com/danilovkiri/dk_go_url_shortener/internal/service/modelurl"
+	"strings"
+)
+
+// userAgentDevice returns the device of a visitor named by their User-Agent header: iOS and Android devices by their
+// platform tokens and desktops otherwise. Other mobile devices and clients without a User-Agent have no device, so that
+// they are not redirected to a desktop target.
+func userAgentDevice(userAgent string) string {
+	switch {
+	case userAgent == "":
+		return ""
+	case strings.Contains(userAgent, "iPhone") || strings.Contains(userAgent, "iPad") || strings.Contains(userAgent, "iPod"):
+		return modelurl.DeviceIOS
+	case strings.Contains(userAgent, "Android"):
+		return modelurl.DeviceAndroid
+	case strings.Contains(userAgent, "Mobi"):
+		return ""
+	}
+	return modelurl.DeviceDesktop
+}
@@ -0,0 +1,152 @@
+package handlers
+
+import (
+	"github.com/danilovkiri/dk_go_url_shortener/internal/api/rest/middleware"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/api/rest/modeldto"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/logger"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/service/modelurl"
+	"github.com/go-chi/chi"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// HandleAddDomain registers a custom domain of the current user using modeldto.RequestDomain schema and responds with
+// the TXT record verifying it using modeldto.ResponseDomain schema.
+func (h *URLHandler) HandleAddDomain() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// bound DB operations by the timeout budget of the route
+		ctx, cancel := requestContext(r)
+		defer cancel()
+		// check for POST body content type compliance
+		if r.Header.Get("Content-Type") != "application/json" {
+			middleware.Error(w, r, "Invalid Content-Type", http.StatusBadRequest)
+			return
+		}
+		var request modeldto.RequestDomain
+		err := decodeJSON(r.Body, &request)
+		if err != nil {
+			h.logger(r).Warn("HandleAddDomain", logger.Error(err))
+			middleware.Error(w, r, err.Error(), http.StatusBadRequest)
+			return
+		}
+		userID, err := getUserID(r)
+		if err != nil {
+			h.logger(r).Error("HandleAddDomain", logger.Error(err))
+			middleware.Error(w, r, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		domain, err := h.processor.AddDomain(ctx, userID, request.Name)
+		if err != nil {
+			writeError(w, r, h.logger(r), "HandleAddDomain", err)
+			return
+		}
+		h.logger(r).Info("domain added", logger.String("domain", domain.Name))
+		// set and send response body
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		err = encodeJSON(w, toResponseDomain(domain))
+		if err != nil {
+			h.logger(r).Warn("HandleAddDomain", logger.Error(err))
+		}
+	}
+}
+
+// HandleListDomains responds with custom domains of the current user using modeldto.ResponseDomain schema.
+func (h *URLHandler) HandleListDomains() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// bound DB operations by the timeout budget of the route
+		ctx, cancel := requestContext(r)
+		defer cancel()
+		userID, err := getUserID(r)
+		if err != nil {
+			h.logger(r).Error("HandleListDomains", logger.Error(err))
+			middleware.Error(w, r, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		domains, err := h.processor.ListDomains(ctx, userID)
+		if err != nil {
+			writeError(w, r, h.logger(r), "HandleListDomains", err)
+			return
+		}
+		responseDomains := make([]modeldto.ResponseDomain, 0, len(domains))
+		for _, domain := range domains {
+			responseDomains = append(responseDomains, toResponseDomain(domain))
+		}
+		// set and send response body
+		w.Header().Set("Content-Type", "application/json")
+		err = encodeJSON(w, responseDomains)
+		if err != nil {
+			h.logger(r).Warn("HandleListDomains", logger.Error(err))
+		}
+	}
+}
+
+// HandleVerifyDomain checks the TXT record of a custom domain of the current user and responds with the domain using
+// modeldto.ResponseDomain schema once it is verified, links are served on the domain afterwards.
+func (h *URLHandler) HandleVerifyDomain() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// bound DNS lookups and DB operations by the timeout budget of the route
+		ctx, cancel := requestContext(r)
+		defer cancel()
+		name := chi.URLParam(r, "domain")
+		userID, err := getUserID(r)
+		if err != nil {
+			h.logger(r).Error("HandleVerifyDomain", logger.Error(err))
+			middleware.Error(w, r, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		domain, err := h.processor.VerifyDomain(ctx, userID, name)
+		if err != nil {
+			writeError(w, r, h.logger(r), "HandleVerifyDomain", err)
+			return
+		}
+		h.logger(r).Info("domain verified", logger.String("domain", domain.Name))
+		// set and send response body
+		w.Header().Set("Content-Type", "application/json")
+		err = encodeJSON(w, toResponseDomain(domain))
+		if err != nil {
+			h.logger(r).Warn("HandleVerifyDomain", logger.Error(err))
+		}
+	}
+}
+
+// toResponseDomain converts a custom domain to modeldto.ResponseDomain schema.
+func toResponseDomain(domain modelurl.Domain) modeldto.ResponseDomain {
+	return modeldto.ResponseDomain{
+		Name:               domain.Name,
+		VerificationRecord: domain.VerificationRecord,
+		VerificationValue:  domain.VerificationValue,
+		CreatedAt:          domain.CreatedAt,
+		VerifiedAt:         domain.VerifiedAt,
+	}
+}
+
+// requestHost returns the host r was sent to without a port, it is empty for the host of baseURL so that requests to
+// it are never resolved to a custom domain.
+func requestHost(r *http.Request, baseURL string) string {
+	host := r.Host
+	if hostname, _, err := net.SplitHostPort(host); err == nil {
+		host = hostname
+	}
+	host = normalizeHost(host)
+	if u, err := url.Parse(baseURL); err == nil && host == normalizeHost(u.Hostname()) {
+		return ""
+	}
+	return host
+}
+
+// normalizeHost returns host in lower case without surrounding spaces and a trailing dot.
+func normalizeHost(host string) string {
+	return strings.TrimSuffix(strings.ToLower(strings.TrimSpace(host)), ".")
+}
+
+// shortURL returns the short URL of sURL on the custom domain, base is used for links without one.
+func shortURL(base url.URL, sURL, domain string) string {
+	if domain != "" {
+		base.Host = domain
+	}
+	base.Path = sURL
+	return base.String()
+}
@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/api/rest/middleware"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/logger"
+	serviceErrors "github.com/danilovkiri/dk_go_url_shortener/internal/service/errors"
+	storageErrors "github.com/danilovkiri/dk_go_url_shortener/internal/storage/v2/errors"
+	"math"
+	"net/http"
+	"strconv"
+)
+
+// errorStatus returns the status code of responses to requests failed with err: errors of storage and service caused
+// by requests map to client errors, timeouts (including queries cancelled once the timeout budget of the request is
+// spent) and a stopped service to gateway timeouts and unavailability, any other error is an internal server error.
+func errorStatus(err error) int {
+	var quotaExceededError *serviceErrors.QuotaExceededError
+	switch {
+	case errors.As(err, new(*storageErrors.ContextTimeoutExceededError)),
+		errors.Is(err, context.DeadlineExceeded):
+		return http.StatusGatewayTimeout
+	case errors.As(err, new(*storageErrors.QueueClosedError)):
+		return http.StatusServiceUnavailable
+	case errors.As(err, new(*storageErrors.NotFoundError)),
+		errors.As(err, new(*storageErrors.NotActiveError)),
+		errors.As(err, new(*storageErrors.UserNotFoundError)),
+		errors.As(err, new(*storageErrors.APIKeyNotFoundError)),
+		errors.As(err, new(*storageErrors.DomainNotFoundError)),
+		errors.As(err, new(*storageErrors.OrgNotFoundError)),
+		errors.As(err, new(*storageErrors.MemberNotFoundError)),
+		errors.As(err, new(*storageErrors.TagNotFoundError)):
+		return http.StatusNotFound
+	case errors.As(err, new(*storageErrors.DeletedError)),
+		errors.As(err, new(*storageErrors.ExpiredError)),
+		errors.As(err, new(*storageErrors.DisabledError)),
+		errors.As(err, new(*storageErrors.ExhaustedError)):
+		return http.StatusGone
+	case errors.As(err, new(*storageErrors.AlreadyExistsError)),
+		errors.As(err, new(*storageErrors.SURLAlreadyExistsError)),
+		errors.As(err, new(*storageErrors.LoginAlreadyExistsError)),
+		errors.As(err, new(*storageErrors.DomainAlreadyExistsError)):
+		return http.StatusConflict
+	case errors.As(err, &quotaExceededError):
+		// quotas replenished over time are retried later, other ones are not lifted by retrying
+		if quotaExceededError.RetryAfter > 0 {
+			return http.StatusTooManyRequests
+		}
+		return http.StatusForbidden
+	case errors.As(err, new(*serviceErrors.ServiceInvalidCredentials)),
+		errors.As(err, new(*serviceErrors.ServiceInvalidToken)),
+		errors.As(err, new(*serviceErrors.ServicePasswordRequired)):
+		return http.StatusUnauthorized
+	case errors.As(err, new(*serviceErrors.ServiceOrgForbidden)),
+		errors.As(err, new(*serviceErrors.ServiceURLForbidden)),
+		errors.As(err, new(*serviceErrors.ServiceInvalidPassword)):
+		return http.StatusForbidden
+	case errors.As(err, new(*serviceErrors.ServiceDomainNotVerified)):
+		return http.StatusUnprocessableEntity
+	case errors.As(err, new(*serviceErrors.ServiceRedirectLoop)):
+		return http.StatusLoopDetected
+	case errors.As(err, new(*serviceErrors.ServiceIncorrectInputURL)),
+		errors.As(err, new(*serviceErrors.ServiceUnsafeURL)),
+		errors.As(err, new(*serviceErrors.ServiceIncorrectInputAlias)),
+		errors.As(err, new(*serviceErrors.ServiceIncorrectInputExpiration)),
+		errors.As(err, new(*serviceErrors.ServiceIncorrectInputRedirectType)),
+		errors.As(err, new(*serviceErrors.ServiceIncorrectInputPassword)),
+		errors.As(err, new(*serviceErrors.ServiceIncorrectInputMaxClicks)),
+		errors.As(err, new(*serviceErrors.ServiceIncorrectInputDestinations)),
+		errors.As(err, new(*serviceErrors.ServiceIncorrectInputGeoTargets)),
+		errors.As(err, new(*serviceErrors.ServiceIncorrectInputDeviceTargets)),
+		errors.As(err, new(*serviceErrors.ServiceIncorrectInputDomain)),
+		errors.As(err, new(*serviceErrors.ServiceIncorrectInputCredentials)),
+		errors.As(err, new(*serviceErrors.ServiceIncorrectInputAPIKeyName)),
+		errors.As(err, new(*serviceErrors.ServiceIncorrectInputOrg)),
+		errors.As(err, new(*serviceErrors.ServiceIncorrectInputTags)),
+		errors.As(err, new(*serviceErrors.ServiceIncorrectInputUTM)),
+		errors.As(err, new(*serviceErrors.ServiceIncorrectInputQuery)),
+		errors.As(err, new(*serviceErrors.ServiceIncorrectInputTimeSeries)):
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
+
+// writeError responds to a request of handler failed with err with problem details of the status code matching err,
+// internal server errors are logged as errors and other ones as warnings.
+func writeError(w http.ResponseWriter, r *http.Request, log *logger.Logger, handler string, err error) {
+	status := errorStatus(err)
+	if status == http.StatusInternalServerError {
+		log.Error(handler, logger.Error(err))
+	} else {
+		log.Warn(handler, logger.Error(err))
+	}
+	var quotaExceededError *serviceErrors.QuotaExceededError
+	if errors.As(err, &quotaExceededError) && quotaExceededError.RetryAfter > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(quotaExceededError.RetryAfter.Seconds()))))
+	}
+	middleware.Error(w, r, err.Error(), status)
+}
@@ -0,0 +1,38 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	serviceErrors "github.com/danilovkiri/dk_go_url_shortener/internal/service/errors"
+	storageErrors "github.com/danilovkiri/dk_go_url_shortener/internal/storage/v2/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestErrorStatus(t *testing.T) {
+	tests := []struct {
+		err    error
+		status int
+	}{
+		{&storageErrors.ContextTimeoutExceededError{Err: context.DeadlineExceeded}, http.StatusGatewayTimeout},
+		{&storageErrors.ExecutionPSQLError{Err: context.DeadlineExceeded}, http.StatusGatewayTimeout},
+		{&storageErrors.QueueClosedError{}, http.StatusServiceUnavailable},
+		{&storageErrors.NotFoundError{SURL: "abc"}, http.StatusNotFound},
+		{&storageErrors.DeletedError{SURL: "abc"}, http.StatusGone},
+		{&storageErrors.AlreadyExistsError{URL: "https://example.com"}, http.StatusConflict},
+		{&serviceErrors.QuotaExceededError{RetryAfter: time.Minute}, http.StatusTooManyRequests},
+		{&serviceErrors.QuotaExceededError{}, http.StatusForbidden},
+		{&serviceErrors.ServiceIncorrectInputURL{}, http.StatusBadRequest},
+		{&serviceErrors.ServicePasswordRequired{}, http.StatusUnauthorized},
+		// wrapped errors are matched as well
+		{fmt.Errorf("redirecting: %w", &storageErrors.ExpiredError{SURL: "abc"}), http.StatusGone},
+		{&storageErrors.ExecutionPSQLError{Err: errors.New("connection refused")}, http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.status, errorStatus(tt.err), "%T", tt.err)
+	}
+}
@@ -0,0 +1,144 @@
+package handlers
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/api/rest/middleware"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/api/rest/modeldto"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/logger"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/service/modelurl"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// export formats accepted by the format query parameter
+const (
+	exportFormatCSV  = "csv"
+	exportFormatJSON = "json"
+)
+
+// exportTimeout limits the time spent on streaming one export.
+const exportTimeout = 30 * time.Second
+
+// HandleExport streams all URLs of a user as a downloadable file, the format query parameter chooses between a
+// JSON array of modeldto.ResponseFullURL (the default) and a CSV with the original_url,short_url header.
+func (h *URLHandler) HandleExport() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// set context timeout for timing DB operations of the whole export
+		ctx, cancel := context.WithTimeout(r.Context(), exportTimeout)
+		defer cancel()
+		format := r.URL.Query().Get("format")
+		if format == "" {
+			format = exportFormatJSON
+		}
+		if format != exportFormatCSV && format != exportFormatJSON {
+			middleware.Error(w, r, fmt.Sprintf("unsupported export format %q, expected csv or json", format), http.StatusBadRequest)
+			return
+		}
+		// retrieve user identifier
+		userID, err := getUserID(r)
+		if err != nil {
+			middleware.Error(w, r, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		u, err := url.Parse(h.serverConfig.BaseURL)
+		if err != nil {
+			h.logger(r).Warn("HandleExport", logger.Error(err))
+			middleware.Error(w, r, err.Error(), http.StatusBadRequest)
+			return
+		}
+		out := newExportWriter(w, format)
+		// the response is started by the first URL so that failures before it still get a proper status code
+		started := false
+		start := func() error {
+			started = true
+			w.Header().Set("Content-Type", out.contentType())
+			w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="urls.%s"`, format))
+			return out.begin()
+		}
+		err = h.processor.Export(ctx, userID, func(URL modelurl.FullURL) error {
+			if !started {
+				if err := start(); err != nil {
+					return err
+				}
+			}
+			return out.write(modeldto.ResponseFullURL{URL: URL.URL, SURL: shortURL(*u, URL.SURL, URL.Domain)})
+		})
+		if err == nil && !started {
+			err = start()
+		}
+		if err == nil {
+			err = out.end()
+		}
+		if err == nil {
+			return
+		}
+		h.logger(r).Warn("HandleExport", logger.Error(err))
+		if started {
+			// the status code is already sent, an unterminated file is the only way to report the failure
+			return
+		}
+		middleware.Error(w, r, err.Error(), errorStatus(err))
+	}
+}
+
+// exportWriter encodes exported URLs in one of export formats.
+type exportWriter struct {
+	w      io.Writer
+	csv    *csv.Writer
+	format string
+	count  int
+}
+
+// newExportWriter initializes an exportWriter writing to w in format.
+func newExportWriter(w io.Writer, format string) *exportWriter {
+	out := &exportWriter{w: w, format: format}
+	if format == exportFormatCSV {
+		out.csv = csv.NewWriter(w)
+	}
+	return out
+}
+
+// contentType returns the media type of the export format.
+func (out *exportWriter) contentType() string {
+	if out.format == exportFormatCSV {
+		return "text/csv"
+	}
+	return "application/json"
+}
+
+// begin writes what precedes the first URL.
+func (out *exportWriter) begin() error {
+	if out.format == exportFormatCSV {
+		return out.csv.Write([]string{"original_url", "short_url"})
+	}
+	_, err := io.WriteString(out.w, "[")
+	return err
+}
+
+// write writes one URL.
+func (out *exportWriter) write(URL modeldto.ResponseFullURL) error {
+	out.count++
+	if out.format == exportFormatCSV {
+		return out.csv.Write([]string{URL.URL, URL.SURL})
+	}
+	if out.count > 1 {
+		if _, err := io.WriteString(out.w, ","); err != nil {
+			return err
+		}
+	}
+	return encodeJSON(out.w, URL)
+}
+
+// end writes what follows the last URL and flushes buffered data.
+func (out *exportWriter) end() error {
+	if out.format == exportFormatCSV {
+		out.csv.Flush()
+		return out.csv.Error()
+	}
+	_, err := io.WriteString(out.w, "]")
+	return err
+}
@@ -4,19 +4,23 @@ package handlers
 import (
 	"context"
 	"encoding/hex"
-	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/danilovkiri/dk_go_url_shortener/internal/api/rest/middleware"
 	"github.com/danilovkiri/dk_go_url_shortener/internal/api/rest/modeldto"
 	"github.com/danilovkiri/dk_go_url_shortener/internal/config"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/logger"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/qrcode"
+	serviceErrors "github.com/danilovkiri/dk_go_url_shortener/internal/service/errors"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/service/modelurl"
 	"github.com/danilovkiri/dk_go_url_shortener/internal/service/shortener"
 	storageErrors "github.com/danilovkiri/dk_go_url_shortener/internal/storage/v2/errors"
 	"github.com/go-chi/chi"
 	"io/ioutil"
-	"log"
+	"net"
 	"net/http"
 	"net/url"
+	"strconv"
 	"time"
 )
 
@@ -24,108 +28,420 @@ import (
 type URLHandler struct {
 	processor    shortener.Processor
 	serverConfig *config.ServerConfig
+	log          *logger.Logger
 }
 
 // InitURLHandler initializes a URLHandler object and sets its attributes.
-func InitURLHandler(processor shortener.Processor, serverConfig *config.ServerConfig) (*URLHandler, error) {
+func InitURLHandler(processor shortener.Processor, serverConfig *config.ServerConfig, log *logger.Logger) (*URLHandler, error) {
 	if processor == nil {
-		log.Fatal(fmt.Errorf("nil Shortener Service was passed to service URL Handler initializer"))
+		return nil, fmt.Errorf("nil Shortener Service was passed to service URL Handler initializer")
 	}
-	return &URLHandler{processor: processor, serverConfig: serverConfig}, nil
+	return &URLHandler{processor: processor, serverConfig: serverConfig, log: log}, nil
 }
 
-// HandleGetURL provides client with a redirect to the original URL accessed by shortened URL.
+// logger returns a request-scoped logger carried by r context or the handler one.
+func (h *URLHandler) logger(r *http.Request) *logger.Logger {
+	return logger.FromContext(r.Context(), h.log)
+}
+
+// defaultTimeout bounds storage operations of requests to routes without a timeout budget of their own.
+const defaultTimeout = 500 * time.Millisecond
+
+// requestContext returns the context of r bounded by the timeout budget of its route set by middleware.Timeout or
+// by defaultTimeout when the route has none, the budget starts with the call.
+func requestContext(r *http.Request) (context.Context, context.CancelFunc) {
+	return middleware.Context(r, defaultTimeout)
+}
+
+// HandleGetURL provides client with a redirect to the original URL accessed by shortened URL. Password protected
+// links are redirected only when their password is presented, otherwise a form asking for it is served; the form is
+// posted back to the shortened URL and answered with 303 so that the destination is then requested with GET. Sticky
+// split links serve the visitor identified by the user cookie the same destination every time, device-targeted links
+// redirect by the device the User-Agent header names and geo-targeted ones by the country of the client IP. Links of
+// custom domains are only redirected on their domain. HEAD requests are answered the same way without counting the
+// redirect, redirects of GET and HEAD requests carry ETag, Last-Modified and the configured Cache-Control headers and
+// conditional requests matching them are answered with 304. Redirects of split, device and geo-targeted, password
+// protected and click-limited links are never cached.
 func (h *URLHandler) HandleGetURL() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		// set context timeout to 500 ms for timing DB operations
-		ctx, cancel := context.WithTimeout(r.Context(), 500*time.Millisecond)
+		// bound DB operations by the timeout budget of the route
+		ctx, cancel := requestContext(r)
 		defer cancel()
 		// retrieve sURL from query
 		sURL := chi.URLParam(r, "urlID")
-		log.Println("GET request detected for", sURL)
-		// decode sURL into the original URL
-		URL, err := h.processor.Decode(ctx, sURL)
-		if err != nil {
-			var contextTimeoutExceededError *storageErrors.ContextTimeoutExceededError
-			var deletedError *storageErrors.DeletedError
-			if errors.As(err, &contextTimeoutExceededError) {
-				log.Println("HandleGetURL:", err)
-				http.Error(w, err.Error(), http.StatusGatewayTimeout)
-				return
-			} else if errors.As(err, &deletedError) {
-				log.Println("HandleGetURL:", err)
-				http.Error(w, err.Error(), http.StatusGone)
+		h.logger(r).Info("GET request detected", logger.String("sURL", sURL))
+		// decode sURL into the original URL, visitors without the user cookie are served random split destinations
+		visitorID, _ := getUserID(r)
+		visitor := modelurl.Visitor{ID: visitorID, IP: clientIP(r), Device: userAgentDevice(r.UserAgent())}
+		var redirect modelurl.Redirect
+		domain, err := h.processor.ResolveDomain(ctx, requestHost(r, h.serverConfig.BaseURL))
+		if err == nil {
+			if r.Method == http.MethodHead {
+				redirect, err = h.processor.PeekRedirect(ctx, sURL, domain, linkPassword(r), visitor)
+			} else {
+				redirect, err = h.processor.Redirect(ctx, sURL, domain, linkPassword(r), visitor)
+			}
+		}
+		if err != nil {
+			if written, errForm := writePasswordForm(w, err, ""); written {
+				h.logger(r).Info("HandleGetURL", logger.Error(err))
+				if errForm != nil {
+					h.logger(r).Warn("HandleGetURL", logger.Error(errForm))
+				}
 				return
 			}
-			log.Println("HandleGetURL:", err)
-			http.Error(w, err.Error(), http.StatusBadRequest)
+			writeError(w, r, h.logger(r), "HandleGetURL", err)
 			return
 		}
-		log.Println("HandleGetURL: retrieved URL", URL)
+		h.logger(r).Debug("HandleGetURL: retrieved URL", logger.String("url", redirect.URL))
+		// record the redirect for click analytics asynchronously, HEAD requests check the link without visiting it
+		if r.Method != http.MethodHead {
+			h.processor.RecordClick(sURL, redirect.URL, r.Referer(), r.UserAgent(), visitor)
+		}
 		// set and send response
-		w.Header().Set("Location", URL)
-		w.WriteHeader(http.StatusTemporaryRedirect)
+		if r.Method == http.MethodPost {
+			w.Header().Set("Location", redirect.URL)
+			w.WriteHeader(http.StatusSeeOther)
+			return
+		}
+		if writeRedirectValidators(w, r, redirect, h.serverConfig.RedirectCacheControl) {
+			return
+		}
+		w.Header().Set("Location", redirect.URL)
+		w.WriteHeader(redirect.Type)
 	}
 }
 
-// HandleGetURLsByUserID provides shortening service using modeldto.ResponseFullURL schema.
+// maxURLsPageSize limits the limit query parameter of user URL listing.
+const maxURLsPageSize = 1000
+
+// HandleGetURLsByUserID provides shortening service using modeldto.ResponseFullURL schema; URLs are sorted by creation
+// time in the order set via the order query parameter (desc by default) and paged via limit and offset query
+// parameters, all URLs are returned when limit is omitted.
 func (h *URLHandler) HandleGetURLsByUserID() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		// set context timeout to 500 ms for timing DB operations
-		ctx, cancel := context.WithTimeout(r.Context(), 500*time.Millisecond)
+		// bound DB operations by the timeout budget of the route
+		ctx, cancel := requestContext(r)
 		defer cancel()
 		var responseURLs []modeldto.ResponseFullURL
 		// retrieve user identifier
 		userID, err := getUserID(r)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			middleware.Error(w, r, err.Error(), http.StatusInternalServerError)
 			return
 		}
-		// retrieve all pairs of sURL:URL for that particular user
-		URLs, err := h.processor.DecodeByUserID(ctx, userID)
+		opts, err := parseListOptions(r)
 		if err != nil {
-			var contextTimeoutExceededError *storageErrors.ContextTimeoutExceededError
-			if errors.As(err, &contextTimeoutExceededError) {
-				log.Println("HandleGetURLsByUserID:", err)
-				http.Error(w, err.Error(), http.StatusGatewayTimeout)
-				return
-			}
-			log.Println("HandleGetURLsByUserID:", err)
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			h.logger(r).Warn("HandleGetURLsByUserID", logger.Error(err))
+			middleware.Error(w, r, err.Error(), http.StatusBadRequest)
+			return
+		}
+		opts.Tag = r.URL.Query().Get("tag")
+		// retrieve the requested page of sURL:URL pairs for that particular user, optionally tagged with a tag
+		URLs, err := h.processor.DecodeByUserID(ctx, userID, opts)
+		if err != nil {
+			writeError(w, r, h.logger(r), "HandleGetURLsByUserID", err)
 			return
 		}
 		// response with HTTP code 204 if no content was found for that user
 		if len(URLs) == 0 {
-			http.Error(w, "", http.StatusNoContent)
+			w.WriteHeader(http.StatusNoContent)
 			return
 		}
 		// create and serialize response object into JSON
 		u, err := url.Parse(h.serverConfig.BaseURL)
 		if err != nil {
-			log.Println("HandleGetURLsByUserID:", err)
-			http.Error(w, err.Error(), http.StatusBadRequest)
+			h.logger(r).Warn("HandleGetURLsByUserID", logger.Error(err))
+			middleware.Error(w, r, err.Error(), http.StatusBadRequest)
 			return
 		}
 		for _, fullURL := range URLs {
-			u.Path = fullURL.SURL
-			responseURL := modeldto.ResponseFullURL{
-				URL:  fullURL.URL,
-				SURL: u.String(),
-			}
-			responseURLs = append(responseURLs, responseURL)
+			responseURLs = append(responseURLs, toResponseFullURL(*u, fullURL))
+		}
+		// set and stream response body
+		w.Header().Set("Content-Type", "application/json")
+		err = encodeJSON(w, responseURLs)
+		if err != nil {
+			h.logger(r).Warn("HandleGetURLsByUserID", logger.Error(err))
+		}
+	}
+}
+
+// HandleSearchUserURLs responds with a page of the user's URL entries matching the q query parameter ranked by
+// relevance using modeldto.ResponseFullURL schema, the order query parameter is ignored.
+func (h *URLHandler) HandleSearchUserURLs() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// bound DB operations by the timeout budget of the route
+		ctx, cancel := requestContext(r)
+		defer cancel()
+		userID, err := getUserID(r)
+		if err != nil {
+			h.logger(r).Error("HandleSearchUserURLs", logger.Error(err))
+			middleware.Error(w, r, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		opts, err := parseListOptions(r)
+		if err != nil {
+			h.logger(r).Warn("HandleSearchUserURLs", logger.Error(err))
+			middleware.Error(w, r, err.Error(), http.StatusBadRequest)
+			return
 		}
-		resBody, err := json.Marshal(responseURLs)
+		URLs, err := h.processor.SearchUserURLs(ctx, userID, r.URL.Query().Get("q"), opts)
 		if err != nil {
-			log.Println("HandleGetURLsByUserID:", err)
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			writeError(w, r, h.logger(r), "HandleSearchUserURLs", err)
 			return
 		}
+		u, err := url.Parse(h.serverConfig.BaseURL)
+		if err != nil {
+			h.logger(r).Error("HandleSearchUserURLs", logger.Error(err))
+			middleware.Error(w, r, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		responseURLs := make([]modeldto.ResponseFullURL, 0, len(URLs))
+		for _, fullURL := range URLs {
+			responseURLs = append(responseURLs, toResponseFullURL(*u, fullURL))
+		}
 		// set and send response body
 		w.Header().Set("Content-Type", "application/json")
-		_, err = w.Write(resBody)
+		err = encodeJSON(w, responseURLs)
 		if err != nil {
-			log.Println("HandleGetURLsByUserID:", err)
-			http.Error(w, err.Error(), http.StatusBadRequest)
+			h.logger(r).Warn("HandleSearchUserURLs", logger.Error(err))
+		}
+	}
+}
+
+// toResponseFullURL converts a listed URL to modeldto.ResponseFullURL schema, creation times unknown for URLs stored
+// before they were recorded are omitted.
+func toResponseFullURL(baseURL url.URL, fullURL modelurl.FullURL) modeldto.ResponseFullURL {
+	response := modeldto.ResponseFullURL{
+		URL:            fullURL.URL,
+		SURL:           shortURL(baseURL, fullURL.SURL, fullURL.Domain),
+		Title:          fullURL.Title,
+		FaviconURL:     fullURL.FaviconURL,
+		Disabled:       fullURL.Disabled,
+		Tags:           fullURL.Tags,
+		LastAccessedAt: fullURL.LastAccessedAt,
+		ArchivedAt:     fullURL.ArchivedAt,
+	}
+	if !fullURL.CreatedAt.IsZero() {
+		createdAt := fullURL.CreatedAt
+		response.CreatedAt = &createdAt
+	}
+	return response
+}
+
+// parseListOptions parses paging and sorting query parameters of user URL listing.
+func parseListOptions(r *http.Request) (modelurl.ListOptions, error) {
+	query := r.URL.Query()
+	opts := modelurl.ListOptions{Desc: true}
+	if rawLimit := query.Get("limit"); rawLimit != "" {
+		limit, err := strconv.Atoi(rawLimit)
+		if err != nil || limit < 1 || limit > maxURLsPageSize {
+			return opts, fmt.Errorf("limit must be an integer between 1 and %d", maxURLsPageSize)
+		}
+		opts.Limit = limit
+	}
+	if rawOffset := query.Get("offset"); rawOffset != "" {
+		offset, err := strconv.Atoi(rawOffset)
+		if err != nil || offset < 0 {
+			return opts, fmt.Errorf("offset must be a non-negative integer")
+		}
+		opts.Offset = offset
+	}
+	switch order := query.Get("order"); order {
+	case "", "desc":
+	case "asc":
+		opts.Desc = false
+	default:
+		return opts, fmt.Errorf("unsupported order %q, expected asc or desc", order)
+	}
+	switch sortBy := query.Get("sort"); sortBy {
+	case "", modelurl.SortCreated:
+	case modelurl.SortLastAccessed:
+		opts.SortBy = sortBy
+	default:
+		return opts, fmt.Errorf("unsupported sort %q, expected %s or %s", sortBy, modelurl.SortCreated, modelurl.SortLastAccessed)
+	}
+	if rawArchived := query.Get("archived"); rawArchived != "" {
+		includeArchived, err := strconv.ParseBool(rawArchived)
+		if err != nil {
+			return opts, fmt.Errorf("archived must be a boolean")
+		}
+		opts.IncludeArchived = includeArchived
+	}
+	return opts, nil
+}
+
+// parseIncludeBots reads the optional include_bots query parameter of stats endpoints, redirects of bots are left out
+// of redirect counts unless it is true.
+func parseIncludeBots(query url.Values) (bool, error) {
+	raw := query.Get("include_bots")
+	if raw == "" {
+		return false, nil
+	}
+	includeBots, err := strconv.ParseBool(raw)
+	if err != nil {
+		return false, fmt.Errorf("include_bots must be a boolean")
+	}
+	return includeBots, nil
+}
+
+// HandleGetURLStats provides total, per-day and per-destination redirect counts for a shortened URL using
+// modeldto.ResponseURLStats schema, redirects of bots are only counted with include_bots=true.
+func (h *URLHandler) HandleGetURLStats() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// bound DB operations by the timeout budget of the route
+		ctx, cancel := requestContext(r)
+		defer cancel()
+		includeBots, err := parseIncludeBots(r.URL.Query())
+		if err != nil {
+			h.logger(r).Warn("HandleGetURLStats", logger.Error(err))
+			middleware.Error(w, r, err.Error(), http.StatusBadRequest)
+			return
+		}
+		// retrieve sURL from query
+		sURL := chi.URLParam(r, "urlID")
+		h.logger(r).Info("GET stats request detected", logger.String("sURL", sURL))
+		stats, err := h.processor.Stats(ctx, sURL, includeBots)
+		if err != nil {
+			writeError(w, r, h.logger(r), "HandleGetURLStats", err)
+			return
+		}
+		// create and serialize response object into JSON
+		u, err := url.Parse(h.serverConfig.BaseURL)
+		if err != nil {
+			h.logger(r).Warn("HandleGetURLStats", logger.Error(err))
+			middleware.Error(w, r, err.Error(), http.StatusBadRequest)
+			return
+		}
+		u.Path = stats.SURL
+		response := modeldto.ResponseURLStats{
+			SURL:                 u.String(),
+			TotalClicks:          stats.TotalClicks,
+			ClicksPerDay:         make([]modeldto.ResponseDayClicks, 0, len(stats.ClicksPerDay)),
+			ClicksPerDestination: make([]modeldto.ResponseDestinationClicks, 0, len(stats.ClicksPerDestination)),
+			UniqueVisitors:       stats.UniqueVisitors,
+		}
+		for _, daily := range stats.ClicksPerDay {
+			response.ClicksPerDay = append(response.ClicksPerDay, modeldto.ResponseDayClicks{Date: daily.Date, Clicks: daily.Clicks, UniqueVisitors: daily.Visitors})
+		}
+		for _, served := range stats.ClicksPerDestination {
+			response.ClicksPerDestination = append(response.ClicksPerDestination, modeldto.ResponseDestinationClicks{URL: served.URL, Clicks: served.Clicks})
+		}
+		// set and stream response body
+		w.Header().Set("Content-Type", "application/json")
+		err = encodeJSON(w, response)
+		if err != nil {
+			h.logger(r).Warn("HandleGetURLStats", logger.Error(err))
+		}
+	}
+}
+
+// HandleGetServiceStats provides totals of stored URLs and their users using modeldto.ResponseServiceStats schema.
+func (h *URLHandler) HandleGetServiceStats() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// bound DB operations by the timeout budget of the route
+		ctx, cancel := requestContext(r)
+		defer cancel()
+		stats, err := h.processor.ServiceStats(ctx)
+		if err != nil {
+			writeError(w, r, h.logger(r), "HandleGetServiceStats", err)
+			return
+		}
+		// set and stream response body
+		w.Header().Set("Content-Type", "application/json")
+		err = encodeJSON(w, modeldto.ResponseServiceStats{URLs: stats.URLs, Users: stats.Users})
+		if err != nil {
+			h.logger(r).Warn("HandleGetServiceStats", logger.Error(err))
+		}
+	}
+}
+
+// QR code image size limits in pixels and defaults applied when query parameters are omitted.
+const (
+	defaultQRSize   = 256
+	minQRSize       = 64
+	maxQRSize       = 2048
+	defaultQRLevel  = "M"
+	defaultQRFormat = "png"
+)
+
+// HandleGetURLQR provides client with a PNG or SVG QR code image of the shortened URL; image size in pixels, error
+// correction level (L, M, Q or H) and image format are set via size, level and format query parameters.
+func (h *URLHandler) HandleGetURLQR() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// bound DB operations by the timeout budget of the route
+		ctx, cancel := requestContext(r)
+		defer cancel()
+		// retrieve sURL from query
+		sURL := chi.URLParam(r, "urlID")
+		h.logger(r).Info("GET QR code request detected", logger.String("sURL", sURL))
+		// parse image parameters
+		query := r.URL.Query()
+		size := defaultQRSize
+		if rawSize := query.Get("size"); rawSize != "" {
+			var err error
+			size, err = strconv.Atoi(rawSize)
+			if err != nil || size < minQRSize || size > maxQRSize {
+				h.logger(r).Warn("HandleGetURLQR: invalid size", logger.String("size", rawSize))
+				middleware.Error(w, r, fmt.Sprintf("size must be an integer between %d and %d", minQRSize, maxQRSize), http.StatusBadRequest)
+				return
+			}
+		}
+		rawLevel := query.Get("level")
+		if rawLevel == "" {
+			rawLevel = defaultQRLevel
+		}
+		level, err := qrcode.ParseLevel(rawLevel)
+		if err != nil {
+			h.logger(r).Warn("HandleGetURLQR", logger.Error(err))
+			middleware.Error(w, r, err.Error(), http.StatusBadRequest)
+			return
+		}
+		format := query.Get("format")
+		if format == "" {
+			format = defaultQRFormat
+		}
+		if format != "png" && format != "svg" {
+			h.logger(r).Warn("HandleGetURLQR: invalid format", logger.String("format", format))
+			middleware.Error(w, r, "format must be either png or svg", http.StatusBadRequest)
+			return
+		}
+		// make sure the shortened URL is still active, password protected ones are encoded without revealing them and
+		// ones which are not active yet can be printed in advance
+		var passwordRequired *serviceErrors.ServicePasswordRequired
+		var notActiveError *storageErrors.NotActiveError
+		domain, err := h.processor.ResolveDomain(ctx, requestHost(r, h.serverConfig.BaseURL))
+		if err == nil {
+			_, _, err = h.processor.Decode(ctx, sURL, domain, "")
+		}
+		if err != nil && !errors.As(err, &passwordRequired) && !errors.As(err, &notActiveError) {
+			writeError(w, r, h.logger(r), "HandleGetURLQR", err)
+			return
+		}
+		// encode the full shortened URL on the domain serving it
+		u, err := url.Parse(h.serverConfig.BaseURL)
+		if err != nil {
+			h.logger(r).Warn("HandleGetURLQR", logger.Error(err))
+			middleware.Error(w, r, err.Error(), http.StatusBadRequest)
+			return
+		}
+		code, err := qrcode.Encode(shortURL(*u, sURL, domain), level)
+		if err != nil {
+			h.logger(r).Error("HandleGetURLQR", logger.Error(err))
+			middleware.Error(w, r, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		// set and stream response body
+		if format == "svg" {
+			w.Header().Set("Content-Type", "image/svg+xml")
+			err = code.WriteSVG(w, size)
+		} else {
+			w.Header().Set("Content-Type", "image/png")
+			err = code.WritePNG(w, size)
+		}
+		if err != nil {
+			h.logger(r).Warn("HandleGetURLQR", logger.Error(err))
 		}
 	}
 }
@@ -133,63 +449,58 @@ func (h *URLHandler) HandleGetURLsByUserID() http.HandlerFunc {
 // HandlePostURL stores the original URL with its shortened version.
 func (h *URLHandler) HandlePostURL() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		// set context timeout to 500 ms for timing DB operations
-		ctx, cancel := context.WithTimeout(r.Context(), 500*time.Millisecond)
+		// bound DB operations by the timeout budget of the route
+		ctx, cancel := requestContext(r)
 		defer cancel()
 		// read POST body
 		b, err := ioutil.ReadAll(r.Body)
 		if err != nil {
-			log.Println("HandlePostURL:", err)
-			http.Error(w, err.Error(), http.StatusBadRequest)
+			h.logger(r).Warn("HandlePostURL", logger.Error(err))
+			middleware.Error(w, r, err.Error(), http.StatusBadRequest)
 			return
 		}
 		// retrieve user identifier
 		userID, err := getUserID(r)
 		if err != nil {
-			log.Println("HandlePostURL:", err)
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			h.logger(r).Error("HandlePostURL", logger.Error(err))
+			middleware.Error(w, r, err.Error(), http.StatusInternalServerError)
 			return
 		}
 		// get server base URL
 		u, err := url.Parse(h.serverConfig.BaseURL)
 		if err != nil {
-			log.Println("HandlePostURL:", err)
-			http.Error(w, err.Error(), http.StatusBadRequest)
+			h.logger(r).Warn("HandlePostURL", logger.Error(err))
+			middleware.Error(w, r, err.Error(), http.StatusBadRequest)
 		}
-		log.Println("POST request detected for", string(b))
-		// encode URL into sURL and store
-		sURL, err := h.processor.Encode(ctx, string(b), userID)
+		h.logger(r).Info("POST request detected", logger.String("url", string(b)))
+		// encode URL into sURL (optionally a custom alias passed as a query parameter) and store
+		opts := modelurl.ShortenOptions{Alias: r.URL.Query().Get("alias")}
+		sURL, err := h.processor.Encode(ctx, string(b), userID, opts)
 		if err != nil {
-			var contextTimeoutExceededError *storageErrors.ContextTimeoutExceededError
 			var alreadyExistsError *storageErrors.AlreadyExistsError
-			if errors.As(err, &contextTimeoutExceededError) {
-				log.Println("HandlePostURL:", err)
-				http.Error(w, err.Error(), http.StatusGatewayTimeout)
-				return
-			} else if errors.As(err, &alreadyExistsError) {
+			if errors.As(err, &alreadyExistsError) {
 				// response with existing sURL when URL violates unique constraint
 				u.Path = alreadyExistsError.ValidSURL
 				w.WriteHeader(http.StatusConflict)
 				_, err = w.Write([]byte(u.String()))
 				if err != nil {
-					log.Println("HandlePostURL:", err)
-					http.Error(w, err.Error(), http.StatusBadRequest)
+					h.logger(r).Warn("HandlePostURL", logger.Error(err))
+					middleware.Error(w, r, err.Error(), http.StatusBadRequest)
 					return
 				}
 				return
 			}
-			log.Println("HandlePostURL:", err)
-			http.Error(w, err.Error(), http.StatusBadRequest)
+			writeError(w, r, h.logger(r), "HandlePostURL", err)
 			return
 		}
-		log.Println("HandlePostURL: stored", string(b), "as", sURL)
+		h.logger(r).Debug("HandlePostURL: stored", logger.String("url", string(b)), logger.String("sURL", sURL))
 		// set and send response
 		w.WriteHeader(http.StatusCreated)
 		u.Path = sURL
 		_, err = w.Write([]byte(u.String()))
 		if err != nil {
-			log.Println("HandlePostURL:", err)
-			http.Error(w, err.Error(), http.StatusBadRequest)
+			h.logger(r).Warn("HandlePostURL", logger.Error(err))
+			middleware.Error(w, r, err.Error(), http.StatusBadRequest)
 		}
 	}
 }
@@ -198,115 +509,147 @@ func (h *URLHandler) HandlePostURL() http.HandlerFunc {
 // modeldto.ResponseURL schemas.
 func (h *URLHandler) JSONHandlePostURL() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		// set context timeout to 500 ms for timing DB operations
-		ctx, cancel := context.WithTimeout(r.Context(), 500*time.Millisecond)
-		defer cancel()
 		// check for POST body content type compliance
 		if r.Header.Get("Content-Type") != "application/json" {
-			http.Error(w, "Invalid Content-Type", http.StatusBadRequest)
+			middleware.Error(w, r, "Invalid Content-Type", http.StatusBadRequest)
 		}
-		// read POST body
-		b, err := ioutil.ReadAll(r.Body)
-		if err != nil {
-			log.Println("JSONHandlePostURL:", err)
-			http.Error(w, err.Error(), http.StatusBadRequest)
-			return
-		}
-		// deserialize JSON into struct
+		// deserialize JSON into struct directly from POST body
 		var post modeldto.RequestURL
-		err = json.Unmarshal(b, &post)
+		err := decodeJSON(r.Body, &post)
 		if err != nil {
-			log.Println("JSONHandlePostURL:", err)
-			http.Error(w, err.Error(), http.StatusBadRequest)
+			h.logger(r).Warn("JSONHandlePostURL", logger.Error(err))
+			middleware.Error(w, r, err.Error(), http.StatusBadRequest)
 			return
 		}
 		// retrieve user identifier
 		userID, err := getUserID(r)
 		if err != nil {
-			log.Println("JSONHandlePostURL:", err)
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			h.logger(r).Error("JSONHandlePostURL", logger.Error(err))
+			middleware.Error(w, r, err.Error(), http.StatusInternalServerError)
 			return
 		}
 		// get server base URL
 		u, err := url.Parse(h.serverConfig.BaseURL)
 		if err != nil {
-			log.Println("JSONHandlePostURL:", err)
-			http.Error(w, err.Error(), http.StatusBadRequest)
+			h.logger(r).Warn("JSONHandlePostURL", logger.Error(err))
+			middleware.Error(w, r, err.Error(), http.StatusBadRequest)
+			return
+		}
+		h.logger(r).Info("JSON POST request detected", logger.String("url", post.URL))
+		opts := shortenOptions(&post)
+		// hash the password before the timeout budget starts since hashing is deliberately slow
+		opts.PasswordHash, err = h.processor.HashPassword(opts.Password)
+		if err != nil {
+			writeError(w, r, h.logger(r), "JSONHandlePostURL", err)
 			return
 		}
-		log.Println("JSON POST request detected for", post.URL)
+		// bound DB operations by the timeout budget of the route
+		ctx, cancel := requestContext(r)
+		defer cancel()
 		// encode URL into sURL and store them
-		sURL, err := h.processor.Encode(ctx, post.URL, userID)
+		sURL, err := h.processor.Encode(ctx, post.URL, userID, opts)
 		if err != nil {
-			var contextTimeoutExceededError *storageErrors.ContextTimeoutExceededError
 			var alreadyExistsError *storageErrors.AlreadyExistsError
-			if errors.As(err, &contextTimeoutExceededError) {
-				log.Println("JSONHandlePostURL:", err)
-				http.Error(w, err.Error(), http.StatusGatewayTimeout)
-				return
-			} else if errors.As(err, &alreadyExistsError) {
+			if errors.As(err, &alreadyExistsError) {
 				// response with existing sURL when URL violates unique constraint
 				u.Path = alreadyExistsError.ValidSURL
 				// serialize struct into JSON
 				resData := modeldto.ResponseURL{
 					SURL: u.String(),
 				}
-				resBody, err := json.Marshal(resData)
-				if err != nil {
-					log.Println("JSONHandlePostURL:", err)
-					http.Error(w, err.Error(), http.StatusBadRequest)
-					return
-				}
-				// set and send response body
+				// set and stream response body
 				w.Header().Set("Content-Type", "application/json")
 				w.WriteHeader(http.StatusConflict)
-				_, err = w.Write(resBody)
+				err = encodeJSON(w, resData)
 				if err != nil {
-					log.Println("JSONHandlePostURL:", err)
-					http.Error(w, err.Error(), http.StatusBadRequest)
+					h.logger(r).Warn("JSONHandlePostURL", logger.Error(err))
 				}
 				return
 			}
-			log.Println("JSONHandlePostURL:", err)
-			http.Error(w, err.Error(), http.StatusBadRequest)
+			writeError(w, r, h.logger(r), "JSONHandlePostURL", err)
 			return
 		}
-		log.Println("JSONHandlePostURL: stored", post.URL, "as", sURL)
-		// serialize struct into JSON
-		u.Path = sURL
+		h.logger(r).Debug("JSONHandlePostURL: stored", logger.String("url", post.URL), logger.String("sURL", sURL))
+		// serialize struct into JSON, links of custom domains are shown on their domain
 		resData := modeldto.ResponseURL{
-			SURL: u.String(),
-		}
-		resBody, err := json.Marshal(resData)
-		if err != nil {
-			log.Println("JSONHandlePostURL:", err)
-			http.Error(w, err.Error(), http.StatusBadRequest)
-			return
+			SURL: shortURL(*u, sURL, opts.Domain),
 		}
-		// set and send response body
+		// set and stream response body
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusCreated)
-		_, err = w.Write(resBody)
+		err = encodeJSON(w, resData)
 		if err != nil {
-			log.Println("JSONHandlePostURL:", err)
-			http.Error(w, err.Error(), http.StatusBadRequest)
+			h.logger(r).Warn("JSONHandlePostURL", logger.Error(err))
 		}
 	}
 }
 
+// shortenOptions returns options of shortening requested by post (optionally a custom alias, an expiration or an
+// activation window, a redirect type, a password, a click limit, split destinations, geo and device targets, a custom
+// domain, tags, UTM parameters), the first destination becomes the URL of post when the URL itself is omitted.
+func shortenOptions(post *modeldto.RequestURL) modelurl.ShortenOptions {
+	opts := modelurl.ShortenOptions{
+		Alias:         post.Alias,
+		ExpiresAt:     post.ExpiresAt,
+		ActiveUntil:   post.ActiveUntil,
+		ActiveFrom:    post.ActiveFrom,
+		TTL:           time.Duration(post.TTL) * time.Second,
+		RedirectType:  post.RedirectType,
+		Password:      post.Password,
+		MaxClicks:     post.MaxClicks,
+		Sticky:        post.Sticky,
+		GeoTargets:    post.GeoTargets,
+		DeviceTargets: post.DeviceTargets,
+		Domain:        normalizeHost(post.Domain),
+		Org:           post.Org,
+		Tags:          post.Tags,
+		UTM:           post.UTM,
+	}
+	for _, destination := range post.Destinations {
+		opts.Destinations = append(opts.Destinations, modelurl.Destination{URL: destination.URL, Weight: destination.Weight})
+	}
+	if post.URL == "" && len(opts.Destinations) > 0 {
+		post.URL = opts.Destinations[0].URL
+	}
+	return opts
+}
+
 // HandlePingDB handles PSQL DB pinging to check connection status.
 func (h *URLHandler) HandlePingDB() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		err := h.processor.PingDB()
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			middleware.Error(w, r, err.Error(), http.StatusInternalServerError)
 		}
 		w.WriteHeader(http.StatusOK)
 	}
 }
 
-// getUserID retrieves user identifier as a value of cookie with key middleware.UserCookieKey.
+// getUserID retrieves user identifier resolved from an access token or as a value of cookie with key
+// middleware.UserCookieKey.
 func getUserID(r *http.Request) (string, error) {
+	// prefer identity resolved from an access token over the cookie one
+	if userID, ok := middleware.UserIDFromContext(r.Context()); ok {
+		return userID, nil
+	}
+	return getCookieUserID(r)
+}
+
+// clientIP returns the client IP set by a reverse proxy in the X-Real-IP header or the one of the connection. The
+// header is trusted since a spoofed one only selects another public destination of a link.
+func clientIP(r *http.Request) net.IP {
+	if ip := net.ParseIP(r.Header.Get("X-Real-IP")); ip != nil {
+		return ip
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return net.ParseIP(r.RemoteAddr)
+	}
+	return net.ParseIP(host)
+}
+
+// getCookieUserID retrieves a user identifier from the user cookie.
+func getCookieUserID(r *http.Request) (string, error) {
 	userCookie, err := r.Cookie(middleware.UserCookieKey)
 	if err != nil {
 		return "", err
@@ -323,38 +666,120 @@ func getUserID(r *http.Request) (string, error) {
 //HandleDeleteURLBatch sets a tag for deletion for a batch of URL entries in DB.
 func (h *URLHandler) HandleDeleteURLBatch() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		// set a basic context due to no timeout and explicit cancelling
-		ctx := context.Background()
+		// bound DB operations by the timeout budget of the route, deletion itself is performed asynchronously
+		ctx, cancel := requestContext(r)
+		defer cancel()
+		// check for DELETE body content type compliance
+		if r.Header.Get("Content-Type") != "application/json" {
+			middleware.Error(w, r, "Invalid Content-Type", http.StatusBadRequest)
+			return
+		}
+		// deserialize JSON into slice directly from DELETE body
+		deleteURLs := make([]string, 0)
+		err := decodeJSON(r.Body, &deleteURLs)
+		if err != nil {
+			h.logger(r).Warn("HandleDeleteURLBatch", logger.Error(err))
+			middleware.Error(w, r, err.Error(), http.StatusBadRequest)
+			return
+		}
+		// retrieve user identifier
+		userID, err := getUserID(r)
+		if err != nil {
+			h.logger(r).Error("HandleDeleteURLBatch", logger.Error(err))
+			middleware.Error(w, r, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		h.logger(r).Info("DELETE request detected", logger.Any("sURLs", deleteURLs))
+		// queue asynchronous deletion, errors of the deletion itself are for logging only
+		err = h.processor.Delete(ctx, deleteURLs, userID)
+		if err != nil {
+			writeError(w, r, h.logger(r), "HandleDeleteURLBatch", err)
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+	}
+}
+
+// HandleRestoreURLBatch removes the deletion tag from a batch of URL entries owned by the user and responds with the
+// IDs which were actually restored.
+func (h *URLHandler) HandleRestoreURLBatch() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// bound DB operations by the timeout budget of the route
+		ctx, cancel := requestContext(r)
+		defer cancel()
 		// check for POST body content type compliance
 		if r.Header.Get("Content-Type") != "application/json" {
-			http.Error(w, "Invalid Content-Type", http.StatusBadRequest)
+			middleware.Error(w, r, "Invalid Content-Type", http.StatusBadRequest)
+			return
 		}
-		// read DELETE body
-		b, err := ioutil.ReadAll(r.Body)
+		// deserialize JSON into slice directly from POST body
+		restoreURLs := make([]string, 0)
+		err := decodeJSON(r.Body, &restoreURLs)
 		if err != nil {
-			log.Println("HandleDeleteURLBatch:", err)
-			http.Error(w, err.Error(), http.StatusBadRequest)
+			h.logger(r).Warn("HandleRestoreURLBatch", logger.Error(err))
+			middleware.Error(w, r, err.Error(), http.StatusBadRequest)
 			return
 		}
-		// deserialize JSON into slice
-		deleteURLs := make([]string, 0)
-		err = json.Unmarshal(b, &deleteURLs)
+		// retrieve user identifier
+		userID, err := getUserID(r)
 		if err != nil {
-			log.Println("HandleDeleteURLBatch:", err)
-			http.Error(w, err.Error(), http.StatusBadRequest)
+			h.logger(r).Error("HandleRestoreURLBatch", logger.Error(err))
+			middleware.Error(w, r, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		h.logger(r).Info("Restore request detected", logger.Any("sURLs", restoreURLs))
+		restored, err := h.processor.Restore(ctx, restoreURLs, userID)
+		if err != nil {
+			writeError(w, r, h.logger(r), "HandleRestoreURLBatch", err)
+			return
+		}
+		if restored == nil {
+			restored = make([]string, 0)
+		}
+		// set and stream response body
+		w.Header().Set("Content-Type", "application/json")
+		err = encodeJSON(w, restored)
+		if err != nil {
+			h.logger(r).Warn("HandleRestoreURLBatch", logger.Error(err))
+		}
+	}
+}
+
+// HandleEditURL changes the destination of a URL entry owned by the user using modeldto.RequestEditURL schema, entries
+// of other users are not found.
+func (h *URLHandler) HandleEditURL() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// bound DB operations by the timeout budget of the route
+		ctx, cancel := requestContext(r)
+		defer cancel()
+		// check for PUT body content type compliance
+		if r.Header.Get("Content-Type") != "application/json" {
+			middleware.Error(w, r, "Invalid Content-Type", http.StatusBadRequest)
+			return
+		}
+		// deserialize JSON into struct directly from PUT body
+		var put modeldto.RequestEditURL
+		err := decodeJSON(r.Body, &put)
+		if err != nil {
+			h.logger(r).Warn("HandleEditURL", logger.Error(err))
+			middleware.Error(w, r, err.Error(), http.StatusBadRequest)
 			return
 		}
 		// retrieve user identifier
 		userID, err := getUserID(r)
 		if err != nil {
-			log.Println("HandleDeleteURLBatch:", err)
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			h.logger(r).Error("HandleEditURL", logger.Error(err))
+			middleware.Error(w, r, err.Error(), http.StatusInternalServerError)
 			return
 		}
-		log.Println("DELETE request detected for", deleteURLs)
-		// perform asynchronous deletion, any underlying errors are for logging only
-		h.processor.Delete(ctx, deleteURLs, userID)
-		w.WriteHeader(http.StatusAccepted)
+		sURL := chi.URLParam(r, "urlID")
+		h.logger(r).Info("Edit request detected", logger.String("sURL", sURL), logger.String("url", put.URL))
+		err = h.processor.Edit(ctx, sURL, put.URL, userID)
+		if err != nil {
+			writeError(w, r, h.logger(r), "HandleEditURL", err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
 	}
 }
 
@@ -362,98 +787,67 @@ func (h *URLHandler) HandleDeleteURLBatch() http.HandlerFunc {
 // modeldto.ResponseBatchURL schemas.
 func (h *URLHandler) JSONHandlePostURLBatch() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		// set context timeout to 500 ms for timing DB operations
-		ctx, cancel := context.WithTimeout(r.Context(), 500*time.Millisecond)
+		// bound DB operations by the timeout budget of the route
+		ctx, cancel := requestContext(r)
 		defer cancel()
 		// check for POST body content type compliance
 		if r.Header.Get("Content-Type") != "application/json" {
-			http.Error(w, "Invalid Content-Type", http.StatusBadRequest)
-		}
-		// read POST body
-		b, err := ioutil.ReadAll(r.Body)
-		if err != nil {
-			log.Println("JSONHandlePostURLBatch:", err)
-			http.Error(w, err.Error(), http.StatusBadRequest)
-			return
+			middleware.Error(w, r, "Invalid Content-Type", http.StatusBadRequest)
 		}
-		// deserialize JSON into struct
+		// deserialize JSON into struct directly from POST body
 		var post []modeldto.RequestBatchURL
-		err = json.Unmarshal(b, &post)
+		err := decodeJSON(r.Body, &post)
 		if err != nil {
-			log.Println("JSONHandlePostURLBatch:", err)
-			http.Error(w, err.Error(), http.StatusBadRequest)
+			h.logger(r).Warn("JSONHandlePostURLBatch", logger.Error(err))
+			middleware.Error(w, r, err.Error(), http.StatusBadRequest)
 			return
 		}
 		// retrieve user identifier
 		userID, err := getUserID(r)
 		if err != nil {
-			log.Println("JSONHandlePostURLBatch:", err)
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			h.logger(r).Error("JSONHandlePostURLBatch", logger.Error(err))
+			middleware.Error(w, r, err.Error(), http.StatusInternalServerError)
 			return
 		}
-		log.Println("JSON POST batch request detected for", post)
+		h.logger(r).Info("JSON POST batch request detected", logger.Int("count", len(post)))
 		// check request body for emptiness
 		if len(post) == 0 {
-			log.Println("JSONHandlePostURLBatch:", "empty request body received")
-			http.Error(w, "empty request body received", http.StatusBadRequest)
+			h.logger(r).Warn("JSONHandlePostURLBatch: empty request body received")
+			middleware.Error(w, r, "empty request body received", http.StatusBadRequest)
 			return
 		}
 		// prepare url schema for sURL
 		u, err := url.Parse(h.serverConfig.BaseURL)
 		if err != nil {
-			log.Println("JSONHandlePostURLBatch:", err)
-			http.Error(w, err.Error(), http.StatusBadRequest)
+			h.logger(r).Warn("JSONHandlePostURLBatch", logger.Error(err))
+			middleware.Error(w, r, err.Error(), http.StatusBadRequest)
 		}
-		// encode URLs into sURLs and store them
-		var responseBatchURLs []modeldto.ResponseBatchURL
+		// encode URLs into sURLs and store them within one storage transaction
+		URLs := make([]string, 0, len(post))
 		for _, requestBatchURL := range post {
-			sURL, err := h.processor.Encode(ctx, requestBatchURL.URL, userID)
-			if err != nil {
-				var contextTimeoutExceededError *storageErrors.ContextTimeoutExceededError
-				var alreadyExistsError *storageErrors.AlreadyExistsError
-				if errors.As(err, &contextTimeoutExceededError) {
-					// if ctx.Err() happens, abort all operations
-					log.Println("JSONHandlePostURLBatch:", err)
-					http.Error(w, err.Error(), http.StatusGatewayTimeout)
-					return
-				} else if errors.As(err, &alreadyExistsError) {
-					// response with existing sURL when URL violates unique constraint
-					sURL = alreadyExistsError.ValidSURL
-					log.Println("JSONHandlePostURLBatch: stored", requestBatchURL.URL, "as", sURL)
-					u.Path = sURL
-					responseBatchURL := modeldto.ResponseBatchURL{
-						CorrelationID: requestBatchURL.CorrelationID,
-						SURL:          u.String(),
-					}
-					responseBatchURLs = append(responseBatchURLs, responseBatchURL)
-					continue
-				}
-				log.Println("JSONHandlePostURLBatch:", err)
-				http.Error(w, err.Error(), http.StatusBadRequest)
-				return
-			}
-			log.Println("JSONHandlePostURLBatch: stored", requestBatchURL.URL, "as", sURL)
-			u.Path = sURL
+			URLs = append(URLs, requestBatchURL.URL)
+		}
+		sURLs, err := h.processor.EncodeBatch(ctx, URLs, userID)
+		if err != nil {
+			writeError(w, r, h.logger(r), "JSONHandlePostURLBatch", err)
+			return
+		}
+		responseBatchURLs := make([]modeldto.ResponseBatchURL, 0, len(post))
+		for i, requestBatchURL := range post {
+			h.logger(r).Debug("JSONHandlePostURLBatch: stored", logger.String("url", requestBatchURL.URL), logger.String("sURL", sURLs[i]))
+			u.Path = sURLs[i]
 			responseBatchURL := modeldto.ResponseBatchURL{
 				CorrelationID: requestBatchURL.CorrelationID,
 				SURL:          u.String(),
 			}
 			responseBatchURLs = append(responseBatchURLs, responseBatchURL)
 		}
-		// serialize struct into JSON
-		resBody, err := json.Marshal(responseBatchURLs)
-		if err != nil {
-			log.Println("JSONHandlePostURLBatch:", err)
-			http.Error(w, err.Error(), http.StatusBadRequest)
-			return
-		}
-		// set and send response body
+		// set and stream response body
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusCreated)
-		_, err = w.Write(resBody)
+		err = encodeJSON(w, responseBatchURLs)
 		if err != nil {
-			log.Println("JSONHandlePostURLBatch:", err)
-			http.Error(w, err.Error(), http.StatusBadRequest)
+			h.logger(r).Warn("JSONHandlePostURLBatch", logger.Error(err))
 		}
 	}
 }
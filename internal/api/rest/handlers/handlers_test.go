@@ -2,29 +2,44 @@ package handlers
 
 import (
 	"context"
+	"encoding/csv"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"github.com/danilovkiri/dk_go_url_shortener/internal/api/rest/middleware"
 	"github.com/danilovkiri/dk_go_url_shortener/internal/api/rest/modeldto"
 	"github.com/danilovkiri/dk_go_url_shortener/internal/config"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/safety"
+	authService "github.com/danilovkiri/dk_go_url_shortener/internal/service/authenticator"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/service/authenticator/v1"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/service/modelurl"
 	"github.com/danilovkiri/dk_go_url_shortener/internal/service/secretary/v1"
 	shortenerService "github.com/danilovkiri/dk_go_url_shortener/internal/service/shortener"
-	"github.com/danilovkiri/dk_go_url_shortener/internal/service/shortener/v1"
-	"github.com/danilovkiri/dk_go_url_shortener/internal/storage/v1"
-	"github.com/danilovkiri/dk_go_url_shortener/internal/storage/v1/infile"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/service/shortener/v2"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/storage/v2"
+	storageErrors "github.com/danilovkiri/dk_go_url_shortener/internal/storage/v2/errors"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/storage/v2/infile"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/storage/v2/modelstorage"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/webhook"
 	"github.com/go-chi/chi"
 	"github.com/go-resty/resty/v2"
 	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/suite"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"path/filepath"
+	"sort"
 	"strings"
 	"sync"
 	"testing"
+	"time"
 )
 
 type HandlersTestSuite struct {
 	suite.Suite
+	cfg              *config.Config
 	storage          storage.URLStorage
 	shortenerService shortenerService.Processor
 	urlHandler       *URLHandler
@@ -39,18 +54,20 @@ type HandlersTestSuite struct {
 
 func (suite *HandlersTestSuite) SetupTest() {
 	cfg, _ := config.NewDefaultConfiguration()
-	// necessary to set default parameters here since they are set in cfg.ParseFlags() which causes error
+	// necessary to set default parameters here since they are set in config.Load() which causes error
 	cfg.ServerConfig.ServerAddress = ":8080"
 	cfg.ServerConfig.BaseURL = "http://localhost:8080"
-	cfg.StorageConfig.FileStoragePath = "url_storage.json"
+	cfg.StorageConfig.FileStoragePath = filepath.Join(suite.T().TempDir(), "url_storage.json")
+	cfg.SecretConfig.JWTKey = "test-jwt-key"
 	// parsing flags causes flag redefined errors
-	//cfg.ParseFlags()
+	//cfg, _ := config.Load(os.Args[1:])
+	suite.cfg = cfg
 	suite.ctx, suite.cancel = context.WithCancel(context.Background())
 	suite.wg = &sync.WaitGroup{}
 	suite.wg.Add(1)
-	suite.storage, _ = infile.InitStorage(suite.ctx, suite.wg, cfg.StorageConfig)
-	suite.shortenerService, _ = shortener.InitShortener(suite.storage)
-	suite.urlHandler, _ = InitURLHandler(suite.shortenerService, cfg.ServerConfig)
+	suite.storage, _ = infile.InitStorage(suite.ctx, suite.wg, cfg.StorageConfig, nil)
+	suite.shortenerService, _ = shortener.InitShortener(suite.storage, cfg.ShortenerConfig)
+	suite.urlHandler, _ = InitURLHandler(suite.shortenerService, cfg.ServerConfig, nil)
 	suite.secretaryService, _ = secretary.NewSecretaryService(cfg.SecretConfig)
 	suite.cookieHandler, _ = middleware.NewCookieHandler(suite.secretaryService, cfg.SecretConfig)
 	suite.router = chi.NewRouter()
@@ -64,7 +81,7 @@ func TestHandlersTestSuite(t *testing.T) {
 
 func (suite *HandlersTestSuite) TestHandleGetURL() {
 	userID := suite.secretaryService.Encode(uuid.New().String())
-	sURL, _ := suite.shortenerService.Encode(suite.ctx, "https://www.yandex.ru", userID)
+	sURL, _ := suite.shortenerService.Encode(suite.ctx, "https://www.yandex.ru", userID, modelurl.ShortenOptions{})
 	suite.router.Get("/{urlID}", suite.urlHandler.HandleGetURL())
 
 	// set tests' parameters
@@ -229,7 +246,7 @@ func (suite *HandlersTestSuite) TestHandleGetURLsByUserID() {
 	suite.router.Use(suite.cookieHandler.CookieHandle)
 	userIDFull := suite.secretaryService.Encode(uuid.New().String())
 	userIDEmpty := suite.secretaryService.Encode(uuid.New().String())
-	_, _ = suite.shortenerService.Encode(suite.ctx, "https://www.yandex.nd", userIDFull)
+	_, _ = suite.shortenerService.Encode(suite.ctx, "https://www.yandex.nd", userIDFull, modelurl.ShortenOptions{})
 	suite.router.Get("/api/user/urls", suite.urlHandler.HandleGetURLsByUserID())
 
 	// set tests' parameters
@@ -285,6 +302,364 @@ func (suite *HandlersTestSuite) TestHandleGetURLsByUserID() {
 	suite.wg.Wait()
 }
 
+func (suite *HandlersTestSuite) TestHandleGetURLsByUserIDPaged() {
+	suite.router.Use(suite.cookieHandler.CookieHandle)
+	userID := suite.secretaryService.Encode(uuid.New().String())
+	var URLs []string
+	for i := 0; i < 3; i++ {
+		URL := "https://www.yandex.ru/" + uuid.New().String()
+		_, _ = suite.shortenerService.Encode(suite.ctx, URL, userID, modelurl.ShortenOptions{})
+		URLs = append(URLs, URL)
+	}
+	suite.router.Get("/api/user/urls", suite.urlHandler.HandleGetURLsByUserID())
+
+	// set tests' parameters
+	type want struct {
+		code int
+		URLs []string
+	}
+	tests := []struct {
+		name  string
+		query map[string]string
+		want  want
+	}{
+		{
+			name:  "Newest first by default",
+			query: map[string]string{},
+			want: want{
+				code: 200,
+				URLs: []string{URLs[2], URLs[1], URLs[0]},
+			},
+		},
+		{
+			name:  "Oldest first page",
+			query: map[string]string{"order": "asc", "limit": "2"},
+			want: want{
+				code: 200,
+				URLs: []string{URLs[0], URLs[1]},
+			},
+		},
+		{
+			name:  "Page with offset",
+			query: map[string]string{"limit": "2", "offset": "2"},
+			want: want{
+				code: 200,
+				URLs: []string{URLs[0]},
+			},
+		},
+		{
+			name:  "Offset past the last URL",
+			query: map[string]string{"offset": "3"},
+			want: want{
+				code: 204,
+			},
+		},
+		{
+			name:  "Invalid limit",
+			query: map[string]string{"limit": "0"},
+			want: want{
+				code: 400,
+			},
+		},
+		{
+			name:  "Invalid order",
+			query: map[string]string{"order": "random"},
+			want: want{
+				code: 400,
+			},
+		},
+	}
+
+	// perform each test
+	for _, tt := range tests {
+		suite.T().Run(tt.name, func(t *testing.T) {
+			client := resty.New()
+			client.SetCookie(&http.Cookie{
+				Name:  "user",
+				Value: userID,
+				Path:  "/",
+			})
+			res, err := client.R().SetQueryParams(tt.query).Get(suite.ts.URL + "/api/user/urls")
+			if err != nil {
+				t.Fatalf("Could not perform GET by userID request")
+			}
+			assert.Equal(t, tt.want.code, res.StatusCode())
+			if tt.want.code == 200 {
+				var page []modeldto.ResponseFullURL
+				err = json.Unmarshal(res.Body(), &page)
+				assert.NoError(t, err)
+				var got []string
+				for _, URL := range page {
+					got = append(got, URL.URL)
+				}
+				assert.Equal(t, tt.want.URLs, got)
+			}
+		})
+	}
+	defer suite.ts.Close()
+	suite.cancel()
+	suite.wg.Wait()
+}
+
+func (suite *HandlersTestSuite) TestHandleGetURLsByUserIDMetadata() {
+	suite.router.Use(suite.cookieHandler.CookieHandle)
+	userID := suite.secretaryService.Encode(uuid.New().String())
+	withMetadata, _ := suite.shortenerService.Encode(suite.ctx, "https://www.yandex.ru/"+uuid.New().String(), userID, modelurl.ShortenOptions{})
+	_, _ = suite.shortenerService.Encode(suite.ctx, "https://www.yandex.ru/"+uuid.New().String(), userID, modelurl.ShortenOptions{})
+	err := suite.storage.UpdateMetadata(suite.ctx, withMetadata, "Yandex", "https://www.yandex.ru/favicon.ico")
+	suite.Require().NoError(err)
+	err = suite.storage.UpdateMetadata(suite.ctx, "missing", "Missing", "")
+	var notFoundError *storageErrors.NotFoundError
+	suite.True(errors.As(err, &notFoundError))
+	suite.router.Get("/api/user/urls", suite.urlHandler.HandleGetURLsByUserID())
+
+	client := resty.New()
+	client.SetCookie(&http.Cookie{
+		Name:  "user",
+		Value: userID,
+		Path:  "/",
+	})
+	res, err := client.R().Get(suite.ts.URL + "/api/user/urls")
+	suite.Require().NoError(err)
+	suite.Equal(200, res.StatusCode())
+	var page []modeldto.ResponseFullURL
+	suite.Require().NoError(json.Unmarshal(res.Body(), &page))
+	suite.Require().Len(page, 2)
+	for _, URL := range page {
+		if URL.SURL == suite.cfg.ServerConfig.BaseURL+"/"+withMetadata {
+			suite.Equal("Yandex", URL.Title)
+			suite.Equal("https://www.yandex.ru/favicon.ico", URL.FaviconURL)
+		} else {
+			suite.Empty(URL.Title)
+			suite.Empty(URL.FaviconURL)
+		}
+	}
+	// URLs without metadata omit its fields
+	suite.Equal(1, strings.Count(string(res.Body()), `"title"`))
+	defer suite.ts.Close()
+	suite.cancel()
+	suite.wg.Wait()
+}
+
+func (suite *HandlersTestSuite) TestUserData() {
+	suite.router.Use(suite.cookieHandler.CookieHandle)
+	suite.router.Get("/api/user/export", suite.urlHandler.HandleExportUserData())
+	suite.router.Delete("/api/user", suite.urlHandler.HandleEraseUser())
+	userIDs := make(map[string]string)
+	logins := make(map[string]string)
+	for _, name := range []string{"user", "member"} {
+		userIDs[name] = suite.secretaryService.Encode(uuid.New().String())
+		logins[name] = name + "-" + uuid.New().String()[:8]
+		err := suite.storage.DumpUser(suite.ctx, modelstorage.UserEntry{Login: logins[name], PasswordHash: "-", UserID: userIDs[name]})
+		if err != nil {
+			suite.T().Fatalf(err.Error())
+		}
+	}
+	userID := userIDs["user"]
+	URL := "https://www.yandex.com/" + uuid.New().String()
+	sURL, err := suite.shortenerService.Encode(suite.ctx, URL, userID, modelurl.ShortenOptions{})
+	if err != nil {
+		suite.T().Fatalf(err.Error())
+	}
+	suite.shortenerService.RecordClick(sURL, URL, "", "", modelurl.Visitor{})
+	authenticatorService, _ := authenticator.InitAuthenticator(suite.storage, suite.cfg.SecretConfig)
+	_, _, err = authenticatorService.CreateAPIKey(suite.ctx, userID, "ci")
+	if err != nil {
+		suite.T().Fatalf(err.Error())
+	}
+	domain := "links-" + uuid.New().String()[:8] + ".example.com"
+	_, err = suite.shortenerService.AddDomain(suite.ctx, userID, domain)
+	if err != nil {
+		suite.T().Fatalf(err.Error())
+	}
+	org, err := suite.shortenerService.CreateOrg(suite.ctx, userID, "Marketing")
+	if err != nil {
+		suite.T().Fatalf(err.Error())
+	}
+	_, err = suite.shortenerService.SetMember(suite.ctx, userID, org.ID, logins["member"], modelurl.RoleMember)
+	if err != nil {
+		suite.T().Fatalf(err.Error())
+	}
+	client := resty.New()
+	client.SetCookie(&http.Cookie{
+		Name:  "user",
+		Value: userID,
+		Path:  "/",
+	})
+	export := func(t *testing.T) modeldto.ResponseUserData {
+		res, err := client.R().Get(suite.ts.URL + "/api/user/export")
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		assert.Equal(t, 200, res.StatusCode())
+		assert.Equal(t, `attachment; filename="user-data.json"`, res.Header().Get("Content-Disposition"))
+		var data modeldto.ResponseUserData
+		err = json.Unmarshal(res.Body(), &data)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		return data
+	}
+
+	suite.T().Run("Export user data", func(t *testing.T) {
+		data := export(t)
+		assert.Equal(t, userID, data.UserID)
+		assert.Equal(t, []string{logins["user"]}, data.Logins)
+		if assert.Len(t, data.URLs, 1) {
+			assert.Equal(t, URL, data.URLs[0].URL)
+			assert.Equal(t, suite.cfg.ServerConfig.BaseURL+"/"+sURL, data.URLs[0].SURL)
+			assert.Equal(t, 1, data.URLs[0].TotalClicks)
+		}
+		if assert.Len(t, data.APIKeys, 1) {
+			assert.Equal(t, "ci", data.APIKeys[0].Name)
+			assert.Empty(t, data.APIKeys[0].Key)
+		}
+		if assert.Len(t, data.Domains, 1) {
+			assert.Equal(t, domain, data.Domains[0].Name)
+		}
+		if assert.Len(t, data.Orgs, 1) {
+			assert.Equal(t, org.ID, data.Orgs[0].ID)
+		}
+	})
+	suite.T().Run("Erase the last admin of an organization", func(t *testing.T) {
+		res, err := client.R().Delete(suite.ts.URL + "/api/user")
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		assert.Equal(t, 400, res.StatusCode())
+		_, err = suite.storage.RetrieveUser(suite.ctx, logins["user"])
+		assert.NoError(t, err)
+	})
+	_, err = suite.shortenerService.SetMember(suite.ctx, userID, org.ID, logins["member"], modelurl.RoleAdmin)
+	if err != nil {
+		suite.T().Fatalf(err.Error())
+	}
+	suite.T().Run("Erase user", func(t *testing.T) {
+		res, err := client.R().Delete(suite.ts.URL + "/api/user")
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		assert.Equal(t, 204, res.StatusCode())
+		_, err = suite.storage.Retrieve(suite.ctx, sURL)
+		var notFoundError *storageErrors.NotFoundError
+		assert.ErrorAs(t, err, &notFoundError)
+		_, err = suite.storage.RetrieveUser(suite.ctx, logins["user"])
+		var userNotFoundError *storageErrors.UserNotFoundError
+		assert.ErrorAs(t, err, &userNotFoundError)
+		members, err := suite.storage.RetrieveMembers(suite.ctx, org.ID)
+		if assert.NoError(t, err) && assert.Len(t, members, 1) {
+			assert.Equal(t, userIDs["member"], members[0].UserID)
+		}
+		data := export(t)
+		assert.Empty(t, data.Logins)
+		assert.Empty(t, data.URLs)
+		assert.Empty(t, data.APIKeys)
+		assert.Empty(t, data.Domains)
+		assert.Empty(t, data.Orgs)
+		records, err := suite.shortenerService.ListAudit(suite.ctx, modelurl.AuditFilter{Entity: modelurl.AuditEntityUser, EntityID: userID}, modelurl.ListOptions{})
+		if assert.NoError(t, err) && assert.Len(t, records, 1) {
+			assert.Equal(t, modelurl.AuditDelete, records[0].Action)
+		}
+		// records of the user are kept without the states they recorded
+		for _, filter := range []modelurl.AuditFilter{{Actor: userID}, {Entity: modelurl.AuditEntityURL, EntityID: sURL}} {
+			records, err = suite.shortenerService.ListAudit(suite.ctx, filter, modelurl.ListOptions{})
+			if assert.NoError(t, err) && assert.NotEmpty(t, records) {
+				for _, record := range records {
+					assert.Nil(t, record.Before, record.Action+" "+record.Entity)
+					assert.Nil(t, record.After, record.Action+" "+record.Entity)
+				}
+			}
+		}
+	})
+	defer suite.ts.Close()
+	suite.cancel()
+	suite.wg.Wait()
+}
+
+func (suite *HandlersTestSuite) TestHandleExport() {
+	suite.router.Use(suite.cookieHandler.CookieHandle)
+	userIDFull := suite.secretaryService.Encode(uuid.New().String())
+	userIDEmpty := suite.secretaryService.Encode(uuid.New().String())
+	sURL, _ := suite.shortenerService.Encode(suite.ctx, "https://www.yandex.ru/export", userIDFull, modelurl.ShortenOptions{})
+	suite.router.Get("/api/user/urls/export", suite.urlHandler.HandleExport())
+	shortURL := suite.cfg.ServerConfig.BaseURL + "/" + sURL
+
+	// set tests' parameters
+	type want struct {
+		code        int
+		contentType string
+		body        string
+	}
+	tests := []struct {
+		name   string
+		token  string
+		format string
+		want   want
+	}{
+		{
+			name:   "JSON export",
+			token:  userIDFull,
+			format: "json",
+			want: want{
+				code:        200,
+				contentType: "application/json",
+				body:        `[{"original_url":"https://www.yandex.ru/export","short_url":"` + shortURL + `"}` + "\n]",
+			},
+		},
+		{
+			name:   "CSV export",
+			token:  userIDFull,
+			format: "csv",
+			want: want{
+				code:        200,
+				contentType: "text/csv",
+				body:        "original_url,short_url\nhttps://www.yandex.ru/export," + shortURL + "\n",
+			},
+		},
+		{
+			name:  "Empty export in default format",
+			token: userIDEmpty,
+			want: want{
+				code:        200,
+				contentType: "application/json",
+				body:        "[]",
+			},
+		},
+		{
+			name:   "Export in unsupported format",
+			token:  userIDFull,
+			format: "xml",
+			want: want{
+				code: 400,
+			},
+		},
+	}
+
+	// perform each test
+	for _, tt := range tests {
+		suite.T().Run(tt.name, func(t *testing.T) {
+			client := resty.New()
+			client.SetCookie(&http.Cookie{
+				Name:  "user",
+				Value: tt.token,
+				Path:  "/",
+			})
+			res, err := client.R().SetQueryParam("format", tt.format).Get(suite.ts.URL + "/api/user/urls/export")
+			if err != nil {
+				t.Fatalf("Could not perform export request")
+			}
+			assert.Equal(t, tt.want.code, res.StatusCode())
+			if tt.want.code == 200 {
+				assert.Equal(t, tt.want.contentType, res.Header().Get("Content-Type"))
+				assert.Equal(t, tt.want.body, string(res.Body()))
+			}
+		})
+	}
+	defer suite.ts.Close()
+	suite.cancel()
+	suite.wg.Wait()
+}
+
 func (suite *HandlersTestSuite) TestJSONHandlePostURLBatch() {
 	suite.router.Use(suite.cookieHandler.CookieHandle)
 	suite.router.Post("/api/shorten/batch", suite.urlHandler.JSONHandlePostURLBatch())
@@ -321,6 +696,22 @@ func (suite *HandlersTestSuite) TestJSONHandlePostURLBatch() {
 				code: 400,
 			},
 		},
+		{
+			name: "POST batch query with invalid URL",
+			batch: []modeldto.RequestBatchURL{
+				{
+					CorrelationID: "test1",
+					URL:           "https://www.kinopoisk.kz",
+				},
+				{
+					CorrelationID: "test2",
+					URL:           "kke738enb734b",
+				},
+			},
+			want: want{
+				code: 400,
+			},
+		},
 	}
 
 	// perform each test
@@ -351,26 +742,43 @@ func (suite *HandlersTestSuite) TestHandleDeleteURLBatch() {
 		code int
 	}
 	tests := []struct {
-		name  string
-		batch []string
-		want  want
+		name        string
+		body        string
+		contentType string
+		want        want
 	}{
 		{
-			name:  "Correct DELETE batch request",
-			batch: []string{"hdsf6sd5f", "dsf6sd5f"},
+			name:        "Correct DELETE batch request",
+			body:        `["hdsf6sd5f", "dsf6sd5f"]`,
+			contentType: "application/json",
 			want: want{
 				code: 202,
 			},
 		},
+		{
+			name:        "Incorrect DELETE batch request (invalid Content-Type)",
+			body:        `["hdsf6sd5f", "dsf6sd5f"]`,
+			contentType: "text/plain",
+			want: want{
+				code: 400,
+			},
+		},
+		{
+			name:        "Incorrect DELETE batch request (not an array of IDs)",
+			body:        `{"url": "hdsf6sd5f"}`,
+			contentType: "application/json",
+			want: want{
+				code: 400,
+			},
+		},
 	}
 
 	// perform each test
 	for _, tt := range tests {
 		suite.T().Run(tt.name, func(t *testing.T) {
-			reqBody, _ := json.Marshal(tt.batch)
-			payload := strings.NewReader(string(reqBody))
+			payload := strings.NewReader(tt.body)
 			client := resty.New()
-			res, err := client.R().SetBody(payload).Delete(suite.ts.URL + "/api/user/urls")
+			res, err := client.R().SetHeader("Content-Type", tt.contentType).SetBody(payload).Delete(suite.ts.URL + "/api/user/urls")
 			if err != nil {
 				t.Fatalf("Could not perform DELETE request")
 			}
@@ -382,3 +790,3914 @@ func (suite *HandlersTestSuite) TestHandleDeleteURLBatch() {
 	suite.cancel()
 	suite.wg.Wait()
 }
+
+func (suite *HandlersTestSuite) TestHandleRestoreURLBatch() {
+	suite.router.Use(suite.cookieHandler.CookieHandle)
+	suite.router.Post("/api/user/urls/restore", suite.urlHandler.HandleRestoreURLBatch())
+
+	// set tests' parameters
+	type want struct {
+		code int
+		body string
+	}
+	tests := []struct {
+		name        string
+		body        string
+		contentType string
+		want        want
+	}{
+		{
+			name:        "Correct restore request",
+			body:        `["hdsf6sd5f", "dsf6sd5f"]`,
+			contentType: "application/json",
+			want: want{
+				code: 200,
+				body: "[]\n",
+			},
+		},
+		{
+			name:        "Incorrect restore request (invalid Content-Type)",
+			body:        `["hdsf6sd5f", "dsf6sd5f"]`,
+			contentType: "text/plain",
+			want: want{
+				code: 400,
+			},
+		},
+		{
+			name:        "Incorrect restore request (not an array of IDs)",
+			body:        `{"url": "hdsf6sd5f"}`,
+			contentType: "application/json",
+			want: want{
+				code: 400,
+			},
+		},
+	}
+
+	// perform each test
+	for _, tt := range tests {
+		suite.T().Run(tt.name, func(t *testing.T) {
+			payload := strings.NewReader(tt.body)
+			client := resty.New()
+			res, err := client.R().SetHeader("Content-Type", tt.contentType).SetBody(payload).Post(suite.ts.URL + "/api/user/urls/restore")
+			if err != nil {
+				t.Fatalf("Could not perform restore request")
+			}
+			assert.Equal(t, tt.want.code, res.StatusCode())
+			if tt.want.code == 200 {
+				assert.Equal(t, tt.want.body, string(res.Body()))
+			}
+		})
+	}
+	defer suite.ts.Close()
+	suite.cancel()
+	suite.wg.Wait()
+}
+
+func (suite *HandlersTestSuite) TestHandleGetURLConditional() {
+	suite.router.Use(suite.cookieHandler.CookieHandle)
+	suite.router.Post("/api/shorten", suite.urlHandler.JSONHandlePostURL())
+	suite.router.Put("/api/user/urls/{urlID}", suite.urlHandler.HandleEditURL())
+	suite.router.Get("/{urlID}", suite.urlHandler.HandleGetURL())
+	suite.router.Head("/{urlID}", suite.urlHandler.HandleGetURL())
+	client := resty.New()
+	client.SetRedirectPolicy(resty.RedirectPolicyFunc(func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	}))
+	shorten := func(request modeldto.RequestURL) string {
+		reqBody, _ := json.Marshal(request)
+		res, err := client.R().SetHeader("Content-Type", "application/json").SetBody(reqBody).Post(suite.ts.URL + "/api/shorten")
+		suite.Require().NoError(err)
+		suite.Require().Equal(201, res.StatusCode())
+		var response modeldto.ResponseURL
+		_ = json.Unmarshal(res.Body(), &response)
+		return strings.TrimPrefix(response.SURL, suite.cfg.ServerConfig.BaseURL+"/")
+	}
+	URL := "https://www.yandex.kg/" + uuid.New().String()
+	sURL := shorten(modeldto.RequestURL{URL: URL})
+
+	// HEAD requests are answered with the redirect along with its validators
+	res, err := client.R().Head(suite.ts.URL + "/" + sURL)
+	suite.Require().NoError(err)
+	suite.Equal(307, res.StatusCode())
+	suite.Equal(URL, res.Header().Get("Location"))
+	suite.Empty(res.Body())
+	etag := res.Header().Get("ETag")
+	lastModified := res.Header().Get("Last-Modified")
+	suite.NotEmpty(etag)
+	suite.NotEmpty(lastModified)
+	suite.Equal("private, no-cache", res.Header().Get("Cache-Control"))
+
+	// matching validators are answered with 304
+	res, err = client.R().SetHeader("If-None-Match", `"other", W/`+etag).Get(suite.ts.URL + "/" + sURL)
+	suite.Require().NoError(err)
+	suite.Equal(304, res.StatusCode())
+	suite.Equal(etag, res.Header().Get("ETag"))
+	suite.Empty(res.Header().Get("Location"))
+
+	// redirects of click-limited links are not cached, so that conditional requests do not spend clicks without being
+	// redirected, HEAD requests do not count towards the limit
+	URL = "https://www.yandex.kg/" + uuid.New().String()
+	sURL = shorten(modeldto.RequestURL{URL: URL, MaxClicks: 1})
+	for i := 0; i < 2; i++ {
+		res, err = client.R().Head(suite.ts.URL + "/" + sURL)
+		suite.Require().NoError(err)
+		suite.Equal(307, res.StatusCode())
+		suite.Equal("no-store", res.Header().Get("Cache-Control"))
+		suite.Empty(res.Header().Get("ETag"))
+		suite.Empty(res.Header().Get("Last-Modified"))
+	}
+	res, err = client.R().SetHeader("If-None-Match", "*").Get(suite.ts.URL + "/" + sURL)
+	suite.Require().NoError(err)
+	suite.Equal(307, res.StatusCode())
+	suite.Equal(URL, res.Header().Get("Location"))
+	res, err = client.R().Head(suite.ts.URL + "/" + sURL)
+	suite.Require().NoError(err)
+	suite.Equal(410, res.StatusCode())
+
+	// redirects of password protected links are not cached, so that they are not replayed to visitors without the
+	// password
+	URL = "https://www.yandex.kg/" + uuid.New().String()
+	sURL = shorten(modeldto.RequestURL{URL: URL, Password: "s3cret"})
+	res, err = client.R().SetHeader("If-None-Match", "*").SetHeader("X-Link-Password", "s3cret").Get(suite.ts.URL + "/" + sURL)
+	suite.Require().NoError(err)
+	suite.Equal(307, res.StatusCode())
+	suite.Equal(URL, res.Header().Get("Location"))
+	suite.Equal("no-store", res.Header().Get("Cache-Control"))
+	suite.Empty(res.Header().Get("ETag"))
+	suite.Empty(res.Header().Get("Last-Modified"))
+
+	// edits change both validators
+	sURL = shorten(modeldto.RequestURL{URL: "https://www.yandex.kg/" + uuid.New().String()})
+	res, err = client.R().Get(suite.ts.URL + "/" + sURL)
+	suite.Require().NoError(err)
+	suite.Require().Equal(307, res.StatusCode())
+	etag = res.Header().Get("ETag")
+	lastModified = res.Header().Get("Last-Modified")
+	res, err = client.R().SetHeader("If-Modified-Since", lastModified).Get(suite.ts.URL + "/" + sURL)
+	suite.Require().NoError(err)
+	suite.Equal(304, res.StatusCode())
+	time.Sleep(time.Second)
+	edited := "https://www.yandex.kg/" + uuid.New().String()
+	res, err = client.R().SetHeader("Content-Type", "application/json").SetBody(`{"url": "` + edited + `"}`).Put(suite.ts.URL + "/api/user/urls/" + sURL)
+	suite.Require().NoError(err)
+	suite.Require().Equal(204, res.StatusCode())
+	res, err = client.R().SetHeader("If-None-Match", etag).Get(suite.ts.URL + "/" + sURL)
+	suite.Require().NoError(err)
+	suite.Equal(307, res.StatusCode())
+	suite.Equal(edited, res.Header().Get("Location"))
+	res, err = client.R().SetHeader("If-Modified-Since", lastModified).Get(suite.ts.URL + "/" + sURL)
+	suite.Require().NoError(err)
+	suite.Equal(307, res.StatusCode())
+
+	// redirects depending on the visitor are not cached
+	base := "https://www.yandex.kg/" + uuid.New().String()
+	for _, request := range []modeldto.RequestURL{
+		{Destinations: []modeldto.RequestDestination{{URL: base + "/a", Weight: 1}, {URL: base + "/b", Weight: 1}}},
+		{URL: base + "/c", DeviceTargets: map[string]string{modelurl.DeviceIOS: base + "/d"}},
+	} {
+		sURL = shorten(request)
+		res, err = client.R().Get(suite.ts.URL + "/" + sURL)
+		suite.Require().NoError(err)
+		suite.Require().Equal(307, res.StatusCode())
+		suite.Equal("no-store", res.Header().Get("Cache-Control"))
+		suite.Empty(res.Header().Get("ETag"))
+		suite.Empty(res.Header().Get("Last-Modified"))
+		res, err = client.R().SetHeader("If-None-Match", "*").Get(suite.ts.URL + "/" + sURL)
+		suite.Require().NoError(err)
+		suite.Equal(307, res.StatusCode())
+	}
+	defer suite.ts.Close()
+	suite.cancel()
+	suite.wg.Wait()
+}
+
+func (suite *HandlersTestSuite) TestHandleEditURL() {
+	suite.router.Use(suite.cookieHandler.CookieHandle)
+	suite.router.Post("/api/shorten", suite.urlHandler.JSONHandlePostURL())
+	suite.router.Put("/api/user/urls/{urlID}", suite.urlHandler.HandleEditURL())
+	suite.router.Get("/{urlID}", suite.urlHandler.HandleGetURL())
+	client := resty.New()
+	client.SetRedirectPolicy(resty.RedirectPolicyFunc(func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	}))
+	reqBody, _ := json.Marshal(modeldto.RequestURL{URL: "https://www.yandex.kz/" + uuid.New().String()})
+	res, err := client.R().SetHeader("Content-Type", "application/json").SetBody(reqBody).Post(suite.ts.URL + "/api/shorten")
+	if err != nil {
+		suite.T().Fatalf(err.Error())
+	}
+	suite.Require().Equal(201, res.StatusCode())
+	var response modeldto.ResponseURL
+	_ = json.Unmarshal(res.Body(), &response)
+	sURL := strings.TrimPrefix(response.SURL, suite.cfg.ServerConfig.BaseURL+"/")
+	edited := "https://www.yandex.kz/" + uuid.New().String()
+
+	// set tests' parameters
+	tests := []struct {
+		name        string
+		client      *resty.Client
+		sURL        string
+		body        string
+		contentType string
+		code        int
+	}{
+		{
+			name:        "Correct edit request",
+			client:      client,
+			sURL:        sURL,
+			body:        `{"url": "` + edited + `"}`,
+			contentType: "application/json",
+			code:        204,
+		},
+		{
+			name:        "Incorrect edit request (invalid Content-Type)",
+			client:      client,
+			sURL:        sURL,
+			body:        `{"url": "` + edited + `"}`,
+			contentType: "text/plain",
+			code:        400,
+		},
+		{
+			name:        "Incorrect edit request (invalid URL)",
+			client:      client,
+			sURL:        sURL,
+			body:        `{"url": "not a URL"}`,
+			contentType: "application/json",
+			code:        400,
+		},
+		{
+			name:        "Incorrect edit request (missing sURL)",
+			client:      client,
+			sURL:        "missing",
+			body:        `{"url": "` + edited + `"}`,
+			contentType: "application/json",
+			code:        404,
+		},
+		{
+			name:        "Incorrect edit request (sURL of another user)",
+			client:      resty.New(),
+			sURL:        sURL,
+			body:        `{"url": "https://www.yandex.kz/` + uuid.New().String() + `"}`,
+			contentType: "application/json",
+			code:        404,
+		},
+	}
+
+	// perform each test
+	for _, tt := range tests {
+		suite.T().Run(tt.name, func(t *testing.T) {
+			res, err := tt.client.R().SetHeader("Content-Type", tt.contentType).SetBody(tt.body).Put(suite.ts.URL + "/api/user/urls/" + tt.sURL)
+			if err != nil {
+				t.Fatalf("Could not perform edit request")
+			}
+			assert.Equal(t, tt.code, res.StatusCode())
+		})
+	}
+
+	// the link redirects to its new destination and the edit is audited
+	res, err = client.R().Get(suite.ts.URL + "/" + sURL)
+	if err != nil {
+		suite.T().Fatalf(err.Error())
+	}
+	suite.Equal(307, res.StatusCode())
+	suite.Equal(edited, res.Header().Get("Location"))
+	records, err := suite.storage.RetrieveAudit(suite.ctx, modelurl.AuditFilter{Action: modelurl.AuditUpdate, EntityID: sURL}, modelurl.ListOptions{Limit: 10})
+	suite.Require().NoError(err)
+	suite.Require().Len(records, 1)
+	suite.JSONEq(`{"sURL": "`+sURL+`", "URL": "`+edited+`", "deleted": false, "disabled": false}`, string(records[0].After))
+	defer suite.ts.Close()
+	suite.cancel()
+	suite.wg.Wait()
+}
+
+func (suite *HandlersTestSuite) TestHandleTags() {
+	suite.router.Use(suite.cookieHandler.CookieHandle)
+	suite.router.Post("/api/shorten", suite.urlHandler.JSONHandlePostURL())
+	suite.router.Get("/api/user/urls", suite.urlHandler.HandleGetURLsByUserID())
+	suite.router.Put("/api/user/urls/{urlID}/tags", suite.urlHandler.HandleSetTags())
+	suite.router.Get("/api/user/tags", suite.urlHandler.HandleListTags())
+	suite.router.Patch("/api/user/tags/{tag}", suite.urlHandler.HandleRenameTag())
+	client := resty.New()
+	shorten := func(tags []string) string {
+		reqBody, _ := json.Marshal(modeldto.RequestURL{URL: "https://www.yandex.kz/" + uuid.New().String(), Tags: tags})
+		res, err := client.R().SetHeader("Content-Type", "application/json").SetBody(reqBody).Post(suite.ts.URL + "/api/shorten")
+		if err != nil {
+			suite.T().Fatalf(err.Error())
+		}
+		suite.Require().Equal(201, res.StatusCode())
+		var response modeldto.ResponseURL
+		_ = json.Unmarshal(res.Body(), &response)
+		return strings.TrimPrefix(response.SURL, suite.cfg.ServerConfig.BaseURL+"/")
+	}
+	listTagged := func(tag string) []modeldto.ResponseFullURL {
+		res, err := client.R().SetQueryParam("tag", tag).Get(suite.ts.URL + "/api/user/urls")
+		if err != nil {
+			suite.T().Fatalf(err.Error())
+		}
+		var URLs []modeldto.ResponseFullURL
+		_ = json.Unmarshal(res.Body(), &URLs)
+		return URLs
+	}
+	tagged := shorten([]string{" Campaign2024", "promo", "promo"})
+	untagged := shorten(nil)
+
+	// tags are normalized at creation and filter the listing
+	URLs := listTagged("campaign2024")
+	suite.Require().Len(URLs, 1)
+	suite.Equal(suite.cfg.ServerConfig.BaseURL+"/"+tagged, URLs[0].SURL)
+	suite.Equal([]string{"campaign2024", "promo"}, URLs[0].Tags)
+	suite.Len(listTagged(""), 2)
+	res, err := client.R().SetQueryParam("tag", "not a tag").Get(suite.ts.URL + "/api/user/urls")
+	suite.Require().NoError(err)
+	suite.Equal(400, res.StatusCode())
+
+	// set tests' parameters
+	tests := []struct {
+		name   string
+		client *resty.Client
+		sURL   string
+		body   string
+		code   int
+	}{
+		{
+			name:   "Correct tags request",
+			client: client,
+			sURL:   untagged,
+			body:   `["Campaign2024"]`,
+			code:   204,
+		},
+		{
+			name:   "Incorrect tags request (invalid tag)",
+			client: client,
+			sURL:   untagged,
+			body:   `["no spaces allowed"]`,
+			code:   400,
+		},
+		{
+			name:   "Incorrect tags request (missing sURL)",
+			client: client,
+			sURL:   "missing",
+			body:   `["campaign2024"]`,
+			code:   404,
+		},
+		{
+			name:   "Incorrect tags request (sURL of another user)",
+			client: resty.New(),
+			sURL:   tagged,
+			body:   `[]`,
+			code:   404,
+		},
+	}
+
+	// perform each test
+	for _, tt := range tests {
+		suite.T().Run(tt.name, func(t *testing.T) {
+			res, err := tt.client.R().SetHeader("Content-Type", "application/json").SetBody(tt.body).Put(suite.ts.URL + "/api/user/urls/" + tt.sURL + "/tags")
+			if err != nil {
+				t.Fatalf("Could not perform tags request")
+			}
+			assert.Equal(t, tt.code, res.StatusCode())
+		})
+	}
+
+	// renaming a tag to one a link already has merges them
+	res, err = client.R().SetHeader("Content-Type", "application/json").SetBody(`{"name": "campaign2024"}`).Patch(suite.ts.URL + "/api/user/tags/promo")
+	suite.Require().NoError(err)
+	suite.Equal(204, res.StatusCode())
+	res, err = client.R().SetHeader("Content-Type", "application/json").SetBody(`{"name": "summer"}`).Patch(suite.ts.URL + "/api/user/tags/promo")
+	suite.Require().NoError(err)
+	suite.Equal(404, res.StatusCode())
+	res, err = client.R().SetHeader("Content-Type", "application/json").SetBody(`{"name": "summer"}`).Patch(suite.ts.URL + "/api/user/tags/campaign2024")
+	suite.Require().NoError(err)
+	suite.Equal(204, res.StatusCode())
+	res, err = client.R().Get(suite.ts.URL + "/api/user/tags")
+	suite.Require().NoError(err)
+	suite.Equal(200, res.StatusCode())
+	suite.JSONEq(`[{"name": "summer", "count": 2}]`, string(res.Body()))
+	suite.Len(listTagged("summer"), 2)
+	defer suite.ts.Close()
+	suite.cancel()
+	suite.wg.Wait()
+}
+
+func (suite *HandlersTestSuite) TestHandleSearchUserURLs() {
+	suite.router.Use(suite.cookieHandler.CookieHandle)
+	suite.router.Post("/api/shorten", suite.urlHandler.JSONHandlePostURL())
+	suite.router.Get("/api/user/urls/search", suite.urlHandler.HandleSearchUserURLs())
+	client := resty.New()
+	shorten := func(URL string, tags []string) string {
+		reqBody, _ := json.Marshal(modeldto.RequestURL{URL: URL, Tags: tags})
+		res, err := client.R().SetHeader("Content-Type", "application/json").SetBody(reqBody).Post(suite.ts.URL + "/api/shorten")
+		if err != nil {
+			suite.T().Fatalf(err.Error())
+		}
+		suite.Require().Equal(201, res.StatusCode())
+		var response modeldto.ResponseURL
+		_ = json.Unmarshal(res.Body(), &response)
+		return response.SURL
+	}
+	guide := shorten("https://docs.example.com/"+uuid.New().String()+"/golang-guide", []string{"campaign2024"})
+	time.Sleep(time.Millisecond)
+	tips := shorten("https://blog.example.org/"+uuid.New().String(), nil)
+	shorten("https://www.yandex.kz/"+uuid.New().String(), nil)
+	err := suite.storage.UpdateMetadata(suite.ctx, strings.TrimPrefix(tips, suite.cfg.ServerConfig.BaseURL+"/"), "Golang Tips", "")
+	suite.Require().NoError(err)
+
+	// set tests' parameters
+	tests := []struct {
+		name   string
+		client *resty.Client
+		query  string
+		code   int
+		sURLs  []string
+	}{
+		{
+			name:   "Title matches rank above URL matches",
+			client: client,
+			query:  "q=golang",
+			code:   200,
+			sURLs:  []string{tips, guide},
+		},
+		{
+			name:   "Words are matched by prefix, equally relevant URLs newest first",
+			client: client,
+			query:  "q=EXAM",
+			code:   200,
+			sURLs:  []string{tips, guide},
+		},
+		{
+			name:   "Every word must match",
+			client: client,
+			query:  "q=golang+campaign",
+			code:   200,
+			sURLs:  []string{guide},
+		},
+		{
+			name:   "Paging",
+			client: client,
+			query:  "q=golang&limit=1&offset=1",
+			code:   200,
+			sURLs:  []string{guide},
+		},
+		{
+			name:   "URLs of other users are not found",
+			client: resty.New(),
+			query:  "q=golang",
+			code:   200,
+			sURLs:  []string{},
+		},
+		{
+			name:   "Incorrect search request (no words)",
+			client: client,
+			query:  "q=%2F%2F",
+			code:   400,
+		},
+	}
+
+	// perform each test
+	for _, tt := range tests {
+		suite.T().Run(tt.name, func(t *testing.T) {
+			res, err := tt.client.R().Get(suite.ts.URL + "/api/user/urls/search?" + tt.query)
+			if err != nil {
+				t.Fatalf("Could not perform search request")
+			}
+			assert.Equal(t, tt.code, res.StatusCode())
+			if tt.code != 200 {
+				return
+			}
+			var URLs []modeldto.ResponseFullURL
+			_ = json.Unmarshal(res.Body(), &URLs)
+			sURLs := make([]string, 0, len(URLs))
+			for _, URL := range URLs {
+				sURLs = append(sURLs, URL.SURL)
+			}
+			assert.Equal(t, tt.sURLs, sURLs)
+		})
+	}
+	defer suite.ts.Close()
+	suite.cancel()
+	suite.wg.Wait()
+}
+
+func (suite *HandlersTestSuite) TestHandleGetURLsByUserIDSortedByLastAccess() {
+	suite.router.Use(suite.cookieHandler.CookieHandle)
+	suite.router.Post("/api/shorten", suite.urlHandler.JSONHandlePostURL())
+	suite.router.Get("/api/user/urls", suite.urlHandler.HandleGetURLsByUserID())
+	client := resty.New()
+	shorten := func() string {
+		reqBody, _ := json.Marshal(modeldto.RequestURL{URL: "https://www.yandex.kz/" + uuid.New().String()})
+		res, err := client.R().SetHeader("Content-Type", "application/json").SetBody(reqBody).Post(suite.ts.URL + "/api/shorten")
+		if err != nil {
+			suite.T().Fatalf(err.Error())
+		}
+		suite.Require().Equal(201, res.StatusCode())
+		var response modeldto.ResponseURL
+		_ = json.Unmarshal(res.Body(), &response)
+		return response.SURL
+	}
+	accessed := shorten()
+	time.Sleep(time.Millisecond)
+	neverAccessed := shorten()
+	time.Sleep(time.Millisecond)
+	clickedAt := time.Now().UTC().Truncate(time.Millisecond)
+	suite.storage.SendClick(modelstorage.ClickEntry{SURL: strings.TrimPrefix(accessed, suite.cfg.ServerConfig.BaseURL+"/"), ClickedAt: clickedAt})
+
+	// set tests' parameters
+	tests := []struct {
+		name  string
+		query string
+		code  int
+		sURLs []string
+	}{
+		{
+			name:  "Newest first by default",
+			query: "",
+			code:  200,
+			sURLs: []string{neverAccessed, accessed},
+		},
+		{
+			name:  "Recently accessed first",
+			query: "sort=last_accessed_at",
+			code:  200,
+			sURLs: []string{accessed, neverAccessed},
+		},
+		{
+			name:  "Least recently accessed first, never accessed ones as accessed at creation",
+			query: "sort=last_accessed_at&order=asc",
+			code:  200,
+			sURLs: []string{neverAccessed, accessed},
+		},
+		{
+			name:  "Incorrect sort key",
+			query: "sort=title",
+			code:  400,
+		},
+	}
+
+	// perform each test
+	for _, tt := range tests {
+		suite.T().Run(tt.name, func(t *testing.T) {
+			res, err := client.R().Get(suite.ts.URL + "/api/user/urls?" + tt.query)
+			if err != nil {
+				t.Fatalf("Could not perform listing request")
+			}
+			assert.Equal(t, tt.code, res.StatusCode())
+			if tt.code != 200 {
+				return
+			}
+			var URLs []modeldto.ResponseFullURL
+			_ = json.Unmarshal(res.Body(), &URLs)
+			sURLs := make([]string, 0, len(URLs))
+			for _, URL := range URLs {
+				sURLs = append(sURLs, URL.SURL)
+				assert.NotNil(t, URL.CreatedAt)
+				if URL.SURL == accessed {
+					if assert.NotNil(t, URL.LastAccessedAt) {
+						assert.True(t, clickedAt.Equal(*URL.LastAccessedAt))
+					}
+				} else {
+					assert.Nil(t, URL.LastAccessedAt)
+				}
+			}
+			assert.Equal(t, tt.sURLs, sURLs)
+		})
+	}
+	defer suite.ts.Close()
+	suite.cancel()
+	suite.wg.Wait()
+}
+
+func (suite *HandlersTestSuite) TestHandleGetURLsByUserIDArchived() {
+	suite.router.Use(suite.cookieHandler.CookieHandle)
+	suite.router.Get("/api/user/urls", suite.urlHandler.HandleGetURLsByUserID())
+	userID := suite.secretaryService.Encode(uuid.New().String())
+	live := "https://www.yandex.ru/" + uuid.New().String()
+	_, err := suite.shortenerService.Encode(suite.ctx, live, userID, modelurl.ShortenOptions{})
+	suite.Require().NoError(err)
+	time.Sleep(time.Millisecond)
+	archived := "https://www.yandex.ru/" + uuid.New().String()
+	archivedSURL := uuid.New().String()
+	archivedAt := time.Now().UTC().Truncate(time.Second)
+	err = suite.storage.Dump(suite.ctx, modelstorage.URLStorageEntry{SURL: archivedSURL, URL: archived, UserID: userID, ArchivedAt: &archivedAt})
+	suite.Require().NoError(err)
+	client := resty.New()
+	client.SetCookie(&http.Cookie{Name: "user", Value: userID, Path: "/"})
+	list := func(query string) (int, []modeldto.ResponseFullURL) {
+		res, err := client.R().Get(suite.ts.URL + "/api/user/urls?" + query)
+		suite.Require().NoError(err)
+		var URLs []modeldto.ResponseFullURL
+		_ = json.Unmarshal(res.Body(), &URLs)
+		return res.StatusCode(), URLs
+	}
+
+	// archived links are left out by default
+	code, URLs := list("")
+	suite.Equal(200, code)
+	if suite.Len(URLs, 1) {
+		suite.Equal(live, URLs[0].URL)
+		suite.Nil(URLs[0].ArchivedAt)
+	}
+	// and listed on request
+	code, URLs = list("archived=true")
+	suite.Equal(200, code)
+	if suite.Len(URLs, 2) {
+		suite.Equal(archived, URLs[0].URL)
+		if suite.NotNil(URLs[0].ArchivedAt) {
+			suite.True(archivedAt.Equal(*URLs[0].ArchivedAt))
+		}
+	}
+	code, _ = list("archived=sometimes")
+	suite.Equal(400, code)
+	// a redirect unarchives the link
+	suite.storage.SendClick(modelstorage.ClickEntry{SURL: archivedSURL, ClickedAt: time.Now()})
+	_, URLs = list("")
+	suite.Len(URLs, 2)
+	defer suite.ts.Close()
+	suite.cancel()
+	suite.wg.Wait()
+}
+
+func (suite *HandlersTestSuite) TestHandlePostURLAllowedSchemes() {
+	suite.router.Use(suite.cookieHandler.CookieHandle)
+	httpsOnlyService, _ := shortener.InitShortener(suite.storage, &config.ShortenerConfig{AllowedSchemes: []string{"https"}})
+	httpsOnlyHandler, _ := InitURLHandler(httpsOnlyService, suite.cfg.ServerConfig, nil)
+	permissiveService, _ := shortener.InitShortener(suite.storage, &config.ShortenerConfig{AllowedSchemes: []string{"http", "https", "mailto"}})
+	permissiveHandler, _ := InitURLHandler(permissiveService, suite.cfg.ServerConfig, nil)
+	suite.router.Post("/https-only", httpsOnlyHandler.HandlePostURL())
+	suite.router.Post("/permissive", permissiveHandler.HandlePostURL())
+
+	// set tests' parameters
+	type want struct {
+		code int
+		body string
+	}
+	tests := []struct {
+		name string
+		path string
+		URL  string
+		want want
+	}{
+		{
+			name: "HTTPS-only config accepts https URL",
+			path: "/https-only",
+			URL:  "https://www.yandex.by",
+			want: want{
+				code: 201,
+			},
+		},
+		{
+			name: "HTTPS-only config rejects http URL",
+			path: "/https-only",
+			URL:  "http://www.yandex.uz",
+			want: want{
+				code: 400,
+				body: `URL scheme "http" is not allowed, allowed schemes: https`,
+			},
+		},
+		{
+			name: "Permissive config accepts mailto URL",
+			path: "/permissive",
+			URL:  "mailto:someone@yandex.ru",
+			want: want{
+				code: 201,
+			},
+		},
+		{
+			name: "Permissive config rejects ftp URL",
+			path: "/permissive",
+			URL:  "ftp://ftp.yandex.ru",
+			want: want{
+				code: 400,
+				body: `URL scheme "ftp" is not allowed, allowed schemes: http, https, mailto`,
+			},
+		},
+	}
+
+	// perform each test
+	for _, tt := range tests {
+		suite.T().Run(tt.name, func(t *testing.T) {
+			payload := strings.NewReader(tt.URL)
+			client := resty.New()
+			res, err := client.R().SetBody(payload).Post(suite.ts.URL + tt.path)
+			if err != nil {
+				t.Fatalf("Could not create POST request")
+			}
+			assert.Equal(t, tt.want.code, res.StatusCode())
+			if tt.want.body != "" {
+				var problem modeldto.ResponseProblem
+				assert.NoError(t, json.Unmarshal(res.Body(), &problem))
+				assert.Equal(t, middleware.ProblemContentType, res.Header().Get("Content-Type"))
+				assert.Equal(t, tt.want.body, problem.Detail)
+			}
+		})
+	}
+	defer suite.ts.Close()
+	suite.cancel()
+	suite.wg.Wait()
+}
+
+func (suite *HandlersTestSuite) TestHandlePostURLNormalization() {
+	suite.router.Use(suite.cookieHandler.CookieHandle)
+	normalizingService, _ := shortener.InitShortener(suite.storage, &config.ShortenerConfig{
+		AllowedSchemes:         []string{"http", "https", "mailto"},
+		NormalizeURLs:          true,
+		NormalizeTrailingSlash: modelurl.TrailingSlashStrip,
+		NormalizeStripParams:   []string{"fbclid", "utm_*"},
+	})
+	normalizingHandler, _ := InitURLHandler(normalizingService, suite.cfg.ServerConfig, nil)
+	suite.router.Post("/normalizing", normalizingHandler.HandlePostURL())
+	suite.router.Post("/", suite.urlHandler.HandlePostURL())
+	// URLs are stored in the form they are looked up by for uniqueness
+	stored := func(path, URL string) string {
+		res, err := resty.New().R().SetBody(strings.NewReader(URL)).Post(suite.ts.URL + path)
+		suite.Require().NoError(err)
+		suite.Require().Equal(201, res.StatusCode())
+		entry, err := suite.storage.Retrieve(suite.ctx, strings.TrimPrefix(string(res.Body()), suite.cfg.ServerConfig.BaseURL+"/"))
+		suite.Require().NoError(err)
+		return entry.URL
+	}
+	path := uuid.New().String()
+
+	// set tests' parameters
+	tests := []struct {
+		name string
+		path string
+		URL  string
+		want string
+	}{
+		{
+			name: "Host, default port, tracking parameters and trailing slash are normalized",
+			path: "/normalizing",
+			URL:  "HTTPS://WWW.Yandex.RU:443/" + path + "/?utm_source=x&b=2&fbclid=y&a=1",
+			want: "https://www.yandex.ru/" + path + "?b=2&a=1",
+		},
+		{
+			name: "Repeated trailing slashes are stripped",
+			path: "/normalizing",
+			URL:  "https://www.yandex.ru/" + path + "//?b=2&a=1&utm_medium=y",
+			want: "https://www.yandex.ru/" + path + "?b=2&a=1",
+		},
+		{
+			name: "Empty path becomes root",
+			path: "/normalizing",
+			URL:  "http://www.Yandex.ru:80",
+			want: "http://www.yandex.ru/",
+		},
+		{
+			name: "Other ports are kept",
+			path: "/normalizing",
+			URL:  "http://www.yandex.ru:8080/" + path + "/",
+			want: "http://www.yandex.ru:8080/" + path,
+		},
+		{
+			name: "URLs other than http(s) ones are kept as they are",
+			path: "/normalizing",
+			URL:  "mailto:Someone@Yandex.ru?utm_source=x",
+			want: "mailto:Someone@Yandex.ru?utm_source=x",
+		},
+		{
+			name: "URLs are kept as they are with normalization disabled",
+			path: "/",
+			URL:  "https://www.Yandex.ru/" + path + "/?utm_source=x",
+			want: "https://www.Yandex.ru/" + path + "/?utm_source=x",
+		},
+	}
+
+	// perform each test
+	for _, tt := range tests {
+		suite.T().Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, stored(tt.path, tt.URL))
+		})
+	}
+	defer suite.ts.Close()
+	suite.cancel()
+	suite.wg.Wait()
+}
+
+func (suite *HandlersTestSuite) TestHandlePostURLMinLength() {
+	suite.router.Use(suite.cookieHandler.CookieHandle)
+	minLength := len("https://ya.ru/abc")
+	lengthService, _ := shortener.InitShortener(suite.storage, &config.ShortenerConfig{AllowedSchemes: []string{"https"}, MinURLLength: minLength})
+	lengthHandler, _ := InitURLHandler(lengthService, suite.cfg.ServerConfig, nil)
+	suite.router.Post("/", lengthHandler.HandlePostURL())
+
+	// set tests' parameters
+	type want struct {
+		code int
+		body string
+	}
+	tests := []struct {
+		name string
+		URL  string
+		want want
+	}{
+		{
+			name: "URL one character shorter than threshold",
+			URL:  "https://ya.ru/ab",
+			want: want{
+				code: 400,
+				body: "URL is already short enough: 16 characters, shortening requires at least 17",
+			},
+		},
+		{
+			name: "URL exactly at threshold",
+			URL:  "https://ya.ru/abc",
+			want: want{
+				code: 201,
+			},
+		},
+		{
+			name: "URL one character longer than threshold",
+			URL:  "https://ya.ru/abcd",
+			want: want{
+				code: 201,
+			},
+		},
+	}
+
+	// perform each test
+	for _, tt := range tests {
+		suite.T().Run(tt.name, func(t *testing.T) {
+			payload := strings.NewReader(tt.URL)
+			client := resty.New()
+			res, err := client.R().SetBody(payload).Post(suite.ts.URL)
+			if err != nil {
+				t.Fatalf("Could not create POST request")
+			}
+			assert.Equal(t, tt.want.code, res.StatusCode())
+			if tt.want.body != "" {
+				var problem modeldto.ResponseProblem
+				assert.NoError(t, json.Unmarshal(res.Body(), &problem))
+				assert.Equal(t, middleware.ProblemContentType, res.Header().Get("Content-Type"))
+				assert.Equal(t, tt.want.body, problem.Detail)
+			}
+		})
+	}
+	defer suite.ts.Close()
+	suite.cancel()
+	suite.wg.Wait()
+}
+
+func (suite *HandlersTestSuite) TestHandlePostURLValidationRules() {
+	suite.router.Use(suite.cookieHandler.CookieHandle)
+	rulesService, _ := shortener.InitShortener(suite.storage, &config.ShortenerConfig{
+		AllowedSchemes:           []string{"http", "https"},
+		MaxURLLength:             64,
+		BlockPrivateDestinations: true,
+		IDNPolicy:                modelurl.IDNAllow,
+		AllowedDomains:           []string{"yandex.ru", "пример.рф", "10.1.2.3"},
+		DeniedDomains:            []string{"ads.yandex.ru"},
+	})
+	rulesHandler, _ := InitURLHandler(rulesService, suite.cfg.ServerConfig, nil)
+	suite.router.Post("/", rulesHandler.HandlePostURL())
+	idnService, _ := shortener.InitShortener(suite.storage, &config.ShortenerConfig{
+		AllowedSchemes: []string{"https"},
+		IDNPolicy:      modelurl.IDNReject,
+	})
+	idnHandler, _ := InitURLHandler(idnService, suite.cfg.ServerConfig, nil)
+	suite.router.Post("/idn", idnHandler.HandlePostURL())
+
+	// set tests' parameters
+	type want struct {
+		code int
+		body string
+	}
+	tests := []struct {
+		name string
+		path string
+		URL  string
+		want want
+	}{
+		{
+			name: "URL of an allowed domain",
+			path: "/",
+			URL:  "https://www.Yandex.ru/search",
+			want: want{
+				code: 201,
+			},
+		},
+		{
+			name: "URL over the maximal length",
+			path: "/",
+			URL:  "https://yandex.ru/" + strings.Repeat("a", 47),
+			want: want{
+				code: 400,
+				body: "URL is too long: 65 characters, up to 64 are allowed",
+			},
+		},
+		{
+			name: "URL of a denied subdomain",
+			path: "/",
+			URL:  "https://img.ads.yandex.ru/banner",
+			want: want{
+				code: 400,
+				body: `URL domain "img.ads.yandex.ru" is denied`,
+			},
+		},
+		{
+			name: "URL of a domain out of the allowlist",
+			path: "/",
+			URL:  "https://notyandex.ru/",
+			want: want{
+				code: 400,
+				body: `URL domain "notyandex.ru" is not allowed`,
+			},
+		},
+		{
+			name: "URL of an allowed internationalized domain",
+			path: "/",
+			URL:  "https://ПРИМЕР.рф/путь",
+			want: want{
+				code: 201,
+			},
+		},
+		{
+			name: "URL of a loopback address in numeric form",
+			path: "/",
+			URL:  "http://2130706433/admin",
+			want: want{
+				code: 400,
+				body: `URL host "2130706433" is a private destination, which is not allowed`,
+			},
+		},
+		{
+			name: "URL of an allowed private address",
+			path: "/",
+			URL:  "http://10.1.2.3/",
+			want: want{
+				code: 400,
+				body: `URL host "10.1.2.3" is a private destination, which is not allowed`,
+			},
+		},
+		{
+			name: "URL of localhost",
+			path: "/",
+			URL:  "http://api.localhost.:8080/",
+			want: want{
+				code: 400,
+				body: `URL host "api.localhost" is a private destination, which is not allowed`,
+			},
+		},
+		{
+			name: "URL of an internationalized domain rejected by policy",
+			path: "/idn",
+			URL:  "https://xn--e1afmkfd.xn--p1ai/",
+			want: want{
+				code: 400,
+				body: `URL host "xn--e1afmkfd.xn--p1ai" is an internationalized domain name, which is not allowed`,
+			},
+		},
+		{
+			name: "URL of an ASCII domain with IDN rejected by policy",
+			path: "/idn",
+			URL:  "https://ya.ru/",
+			want: want{
+				code: 201,
+			},
+		},
+	}
+
+	// perform each test
+	for _, tt := range tests {
+		suite.T().Run(tt.name, func(t *testing.T) {
+			res, err := resty.New().R().SetBody(strings.NewReader(tt.URL)).Post(suite.ts.URL + tt.path)
+			if err != nil {
+				t.Fatalf("Could not create POST request")
+			}
+			assert.Equal(t, tt.want.code, res.StatusCode())
+			if tt.want.body != "" {
+				var problem modeldto.ResponseProblem
+				assert.NoError(t, json.Unmarshal(res.Body(), &problem))
+				assert.Equal(t, tt.want.body, problem.Detail)
+			}
+		})
+	}
+	defer suite.ts.Close()
+	suite.cancel()
+	suite.wg.Wait()
+}
+
+func (suite *HandlersTestSuite) TestHandleURLRedirectLoop() {
+	suite.router.Use(suite.cookieHandler.CookieHandle)
+	loopService, _ := shortener.InitShortener(suite.storage, &config.ShortenerConfig{
+		AllowedSchemes:   []string{"http", "https"},
+		ShortenerDomains: []string{"bit.ly"},
+	})
+	loopService.SetBaseURL(suite.cfg.ServerConfig.BaseURL)
+	loopHandler, _ := InitURLHandler(loopService, suite.cfg.ServerConfig, nil)
+	suite.router.Post("/", loopHandler.HandlePostURL())
+	suite.router.Get("/{urlID}", loopHandler.HandleGetURL())
+	client := resty.New()
+	client.SetRedirectPolicy(resty.RedirectPolicyFunc(func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	}))
+
+	// custom domains stored before verified ones are cached
+	verifiedAt := time.Now()
+	verified := "go-" + uuid.New().String()[:8] + ".example.com"
+	pending := "go-" + uuid.New().String()[:8] + ".example.com"
+	for _, domain := range []modelstorage.DomainEntry{
+		{Name: verified, UserID: uuid.New().String(), Token: "verified", CreatedAt: verifiedAt, VerifiedAt: &verifiedAt},
+		{Name: pending, UserID: uuid.New().String(), Token: "pending", CreatedAt: verifiedAt},
+	} {
+		suite.Require().NoError(suite.storage.DumpDomain(suite.ctx, domain))
+	}
+
+	// URLs of this and other configured shorteners are not shortened
+	for _, URL := range []string{suite.cfg.ServerConfig.BaseURL + "/abcde", "http://LOCALHOST:8080/", "https://BIT.ly/x", "https://m.bit.ly./x"} {
+		res, err := client.R().SetBody(strings.NewReader(URL)).Post(suite.ts.URL)
+		suite.Require().NoError(err)
+		suite.Equal(400, res.StatusCode(), URL)
+	}
+	// other ports of the same host are other services
+	res, err := client.R().SetBody(strings.NewReader("http://localhost:9090/" + uuid.New().String())).Post(suite.ts.URL)
+	suite.Require().NoError(err)
+	suite.Equal(201, res.StatusCode())
+
+	// links stored before the check are not redirected along the chain
+	sURL := uuid.New().String()
+	err = suite.storage.Dump(suite.ctx, modelstorage.URLStorageEntry{SURL: sURL, URL: suite.cfg.ServerConfig.BaseURL + "/" + sURL, UserID: uuid.New().String()})
+	suite.Require().NoError(err)
+	res, err = client.R().Get(suite.ts.URL + "/" + sURL)
+	suite.Require().NoError(err)
+	suite.Equal(http.StatusLoopDetected, res.StatusCode())
+	suite.Empty(res.Header().Get("Location"))
+
+	// verified custom domains of any user are served by this shortener, domains pending verification are not yet
+	res, err = client.R().SetBody(strings.NewReader("https://" + strings.ToUpper(verified) + "/abcde")).Post(suite.ts.URL)
+	suite.Require().NoError(err)
+	suite.Equal(400, res.StatusCode())
+	res, err = client.R().SetBody(strings.NewReader("https://" + pending + "/abcde")).Post(suite.ts.URL)
+	suite.Require().NoError(err)
+	suite.Equal(201, res.StatusCode())
+	sURL = uuid.New().String()
+	err = suite.storage.Dump(suite.ctx, modelstorage.URLStorageEntry{SURL: sURL, URL: "https://" + verified + "/abcde", UserID: uuid.New().String()})
+	suite.Require().NoError(err)
+	res, err = client.R().Get(suite.ts.URL + "/" + sURL)
+	suite.Require().NoError(err)
+	suite.Equal(http.StatusLoopDetected, res.StatusCode())
+
+	// domains verified after verified domains were cached are known at once
+	ownerID := uuid.New().String()
+	claimed, err := loopService.AddDomain(suite.ctx, ownerID, pending)
+	suite.Require().NoError(err)
+	loopService.SetTXTLookup(func(ctx context.Context, name string) ([]string, error) {
+		return []string{claimed.VerificationValue}, nil
+	})
+	_, err = loopService.VerifyDomain(suite.ctx, ownerID, pending)
+	suite.Require().NoError(err)
+	res, err = client.R().SetBody(strings.NewReader("https://" + pending + "/abcde")).Post(suite.ts.URL)
+	suite.Require().NoError(err)
+	suite.Equal(400, res.StatusCode())
+	defer suite.ts.Close()
+	suite.cancel()
+	suite.wg.Wait()
+}
+
+func (suite *HandlersTestSuite) TestHandlePostURLQuota() {
+	suite.router.Use(suite.cookieHandler.CookieHandle)
+	linksService, _ := shortener.InitShortener(suite.storage, &config.ShortenerConfig{AllowedSchemes: []string{"https"}, MaxLinksPerUser: 2})
+	linksHandler, _ := InitURLHandler(linksService, suite.cfg.ServerConfig, nil)
+	dailyService, _ := shortener.InitShortener(suite.storage, &config.ShortenerConfig{AllowedSchemes: []string{"https"}, MaxShortensPerDay: 2})
+	dailyHandler, _ := InitURLHandler(dailyService, suite.cfg.ServerConfig, nil)
+	suite.router.Post("/links", linksHandler.HandlePostURL())
+	suite.router.Post("/links/batch", linksHandler.JSONHandlePostURLBatch())
+	suite.router.Post("/daily", dailyHandler.HandlePostURL())
+
+	// set tests' parameters, the order matters since every request of a user counts towards their quotas
+	type want struct {
+		code       int
+		retryAfter bool
+	}
+	tests := []struct {
+		name     string
+		endpoint string
+		want     want
+	}{
+		{name: "First active link", endpoint: "/links", want: want{code: 201}},
+		{name: "Second active link", endpoint: "/links", want: want{code: 201}},
+		{name: "Active links quota exceeded", endpoint: "/links", want: want{code: 403}},
+		{name: "Active links quota exceeded by batch", endpoint: "/links/batch", want: want{code: 403}},
+		{name: "First daily request", endpoint: "/daily", want: want{code: 201}},
+		{name: "Second daily request", endpoint: "/daily", want: want{code: 201}},
+		{name: "Daily quota exceeded", endpoint: "/daily", want: want{code: 429, retryAfter: true}},
+	}
+
+	// perform each test
+	client := resty.New()
+	client.SetCookie(&http.Cookie{
+		Name:  "user",
+		Value: suite.secretaryService.Encode(uuid.New().String()),
+		Path:  "/",
+	})
+	for _, tt := range tests {
+		suite.T().Run(tt.name, func(t *testing.T) {
+			URL := "https://www.yandex.by/" + uuid.New().String()
+			req := client.R().SetBody(URL)
+			if strings.HasSuffix(tt.endpoint, "/batch") {
+				req = client.R().
+					SetHeader("Content-Type", "application/json").
+					SetBody([]modeldto.RequestBatchURL{{CorrelationID: "1", URL: URL}})
+			}
+			res, err := req.Post(suite.ts.URL + tt.endpoint)
+			if err != nil {
+				t.Fatalf("Could not create POST request")
+			}
+			assert.Equal(t, tt.want.code, res.StatusCode())
+			assert.Equal(t, tt.want.retryAfter, res.Header().Get("Retry-After") != "")
+		})
+	}
+	defer suite.ts.Close()
+	suite.cancel()
+	suite.wg.Wait()
+}
+
+func (suite *HandlersTestSuite) TestHandlePostURLUnsafe() {
+	suite.router.Use(suite.cookieHandler.CookieHandle)
+	checker, err := safety.NewChecker(&config.SafetyConfig{BlockedDomains: []string{"malware.example"}}, nil)
+	suite.Require().NoError(err)
+	safeService, _ := shortener.InitShortener(suite.storage, &config.ShortenerConfig{AllowedSchemes: []string{"https"}})
+	safeService.SetSafetyChecker(checker)
+	safeHandler, _ := InitURLHandler(safeService, suite.cfg.ServerConfig, nil)
+	suite.router.Post("/", safeHandler.HandlePostURL())
+	suite.router.Post("/batch", safeHandler.JSONHandlePostURLBatch())
+	suite.router.Get("/{urlID}", safeHandler.HandleGetURL())
+
+	// set tests' parameters
+	tests := []struct {
+		name     string
+		endpoint string
+		URL      string
+		code     int
+	}{
+		{name: "Safe URL", endpoint: "/", URL: "https://www.yandex.by/" + uuid.New().String(), code: 201},
+		{name: "Blocked domain", endpoint: "/", URL: "https://malware.example/", code: 400},
+		{name: "Blocked subdomain", endpoint: "/", URL: "https://cdn.malware.example/payload", code: 400},
+		{name: "Blocked domain in batch", endpoint: "/batch", URL: "https://malware.example/", code: 400},
+	}
+
+	// perform each test
+	client := resty.New()
+	client.SetCookie(&http.Cookie{
+		Name:  "user",
+		Value: suite.secretaryService.Encode(uuid.New().String()),
+		Path:  "/",
+	})
+	for _, tt := range tests {
+		suite.T().Run(tt.name, func(t *testing.T) {
+			req := client.R().SetBody(tt.URL)
+			if tt.endpoint == "/batch" {
+				req = client.R().
+					SetHeader("Content-Type", "application/json").
+					SetBody([]modeldto.RequestBatchURL{{CorrelationID: "1", URL: tt.URL}})
+			}
+			res, err := req.Post(suite.ts.URL + tt.endpoint)
+			if err != nil {
+				t.Fatalf("Could not create POST request")
+			}
+			assert.Equal(t, tt.code, res.StatusCode())
+		})
+	}
+
+	// links disabled later are not redirected to
+	userID := uuid.New().String()
+	sURL, err := safeService.Encode(suite.ctx, "https://www.yandex.by/"+uuid.New().String(), userID, modelurl.ShortenOptions{})
+	suite.Require().NoError(err)
+	disabled, err := suite.storage.DisableBatch(suite.ctx, []string{sURL, "missing"})
+	suite.Require().NoError(err)
+	suite.Equal([]string{sURL}, disabled)
+	disabled, err = suite.storage.DisableBatch(suite.ctx, []string{sURL})
+	suite.Require().NoError(err)
+	suite.Empty(disabled)
+	client.SetRedirectPolicy(resty.RedirectPolicyFunc(func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	}))
+	res, err := client.R().Get(suite.ts.URL + "/" + sURL)
+	suite.Require().NoError(err)
+	suite.Equal(http.StatusGone, res.StatusCode())
+	URLs, err := suite.storage.RetrieveByUserID(suite.ctx, userID, modelurl.ListOptions{})
+	suite.Require().NoError(err)
+	suite.Require().Len(URLs, 1)
+	suite.True(URLs[0].Disabled)
+	defer suite.ts.Close()
+	suite.cancel()
+	suite.wg.Wait()
+}
+
+func (suite *HandlersTestSuite) TestJSONHandlePostURLAlias() {
+	suite.router.Use(suite.cookieHandler.CookieHandle)
+	suite.router.Post("/api/shorten", suite.urlHandler.JSONHandlePostURL())
+	alias := "promo-" + uuid.New().String()[:8]
+
+	// set tests' parameters, the order matters since the alias gets taken by the first test
+	type want struct {
+		code int
+	}
+	tests := []struct {
+		name string
+		URL  modeldto.RequestURL
+		want want
+	}{
+		{
+			name: "Correct POST query with alias",
+			URL: modeldto.RequestURL{
+				URL:   "https://www.yandex.am",
+				Alias: alias,
+			},
+			want: want{
+				code: 201,
+			},
+		},
+		{
+			name: "POST query with already taken alias",
+			URL: modeldto.RequestURL{
+				URL:   "https://www.yandex.ge",
+				Alias: alias,
+			},
+			want: want{
+				code: 409,
+			},
+		},
+		{
+			name: "POST query with reserved alias",
+			URL: modeldto.RequestURL{
+				URL:   "https://www.yandex.md",
+				Alias: "ping",
+			},
+			want: want{
+				code: 400,
+			},
+		},
+		{
+			name: "POST query with invalid alias",
+			URL: modeldto.RequestURL{
+				URL:   "https://www.yandex.tm",
+				Alias: "no/slashes",
+			},
+			want: want{
+				code: 400,
+			},
+		},
+	}
+
+	// perform each test
+	for _, tt := range tests {
+		suite.T().Run(tt.name, func(t *testing.T) {
+			reqBody, _ := json.Marshal(tt.URL)
+			payload := strings.NewReader(string(reqBody))
+			client := resty.New()
+			res, err := client.R().SetBody(payload).Post(suite.ts.URL + "/api/shorten")
+			if err != nil {
+				t.Fatalf("Could not perform JSON POST request")
+			}
+			assert.Equal(t, tt.want.code, res.StatusCode())
+			if tt.want.code == 201 {
+				assert.Contains(t, string(res.Body()), "/"+alias)
+			}
+		})
+	}
+	defer suite.ts.Close()
+	suite.cancel()
+	suite.wg.Wait()
+}
+
+func (suite *HandlersTestSuite) TestHandleImport() {
+	suite.router.Use(suite.cookieHandler.CookieHandle)
+	suite.router.Post("/api/import", suite.urlHandler.HandleImport())
+	suffix := uuid.New().String()[:8]
+	alias := "import-" + suffix
+	upload := "url,alias\n" +
+		"https://www.yandex.ru/import/" + suffix + "\n" +
+		"https://www.yandex.ru/import/" + suffix + "\n" +
+		"https://www.yandex.by/import/" + suffix + "," + alias + "\n" +
+		"https://www.yandex.kz/import/" + suffix + "," + alias + "\n" +
+		"not an URL\n" +
+		"https://www.yandex.uz/import/" + suffix + ",a,b\n"
+
+	// the mapping file is checked by status column of every uploaded row in order, file storage does not
+	// deduplicate original URLs so repeated ones are created again
+	client := resty.New()
+	res, err := client.R().SetHeader("Content-Type", "text/csv").SetBody(upload).Post(suite.ts.URL + "/api/import")
+	if err != nil {
+		suite.T().Fatalf("Could not perform POST request")
+	}
+	assert.Equal(suite.T(), http.StatusOK, res.StatusCode())
+	assert.Equal(suite.T(), "text/csv", res.Header().Get("Content-Type"))
+	records, err := csv.NewReader(strings.NewReader(string(res.Body()))).ReadAll()
+	if err != nil {
+		suite.T().Fatalf("Could not parse mapping file")
+	}
+	assert.Equal(suite.T(), importHeader, records[0])
+	statuses := make([]string, 0, len(records)-1)
+	for _, record := range records[1:] {
+		statuses = append(statuses, record[3])
+	}
+	assert.Equal(suite.T(), []string{"created", "created", "created", "error", "error", "error"}, statuses)
+	assert.NotEqual(suite.T(), records[1][2], records[2][2])
+	assert.Equal(suite.T(), suite.cfg.ServerConfig.BaseURL+"/"+alias, records[3][2])
+
+	// the same upload is accepted as a multipart form
+	res, err = client.R().SetFileReader("file", "urls.csv", strings.NewReader(upload)).Post(suite.ts.URL + "/api/import")
+	if err != nil {
+		suite.T().Fatalf("Could not perform POST request")
+	}
+	assert.Equal(suite.T(), http.StatusOK, res.StatusCode())
+	assert.Contains(suite.T(), string(res.Body()), `short URL ""`+alias+`"" is already taken`)
+
+	res, err = client.R().SetHeader("Content-Type", "application/json").SetBody("[]").Post(suite.ts.URL + "/api/import")
+	if err != nil {
+		suite.T().Fatalf("Could not perform POST request")
+	}
+	assert.Equal(suite.T(), http.StatusBadRequest, res.StatusCode())
+	defer suite.ts.Close()
+	suite.cancel()
+	suite.wg.Wait()
+}
+
+func (suite *HandlersTestSuite) TestJSONHandlePostURLExpiration() {
+	suite.router.Use(suite.cookieHandler.CookieHandle)
+	suite.router.Post("/api/shorten", suite.urlHandler.JSONHandlePostURL())
+	future := time.Now().Add(time.Hour)
+	past := time.Now().Add(-time.Hour)
+
+	// set tests' parameters
+	type want struct {
+		code int
+	}
+	tests := []struct {
+		name string
+		URL  modeldto.RequestURL
+		want want
+	}{
+		{
+			name: "Correct POST query with TTL",
+			URL: modeldto.RequestURL{
+				URL: "https://www.yandex.uz",
+				TTL: 3600,
+			},
+			want: want{
+				code: 201,
+			},
+		},
+		{
+			name: "Correct POST query with expiration time",
+			URL: modeldto.RequestURL{
+				URL:       "https://www.yandex.kg",
+				ExpiresAt: &future,
+			},
+			want: want{
+				code: 201,
+			},
+		},
+		{
+			name: "POST query with expiration time in the past",
+			URL: modeldto.RequestURL{
+				URL:       "https://www.yandex.tj",
+				ExpiresAt: &past,
+			},
+			want: want{
+				code: 400,
+			},
+		},
+		{
+			name: "POST query with negative TTL",
+			URL: modeldto.RequestURL{
+				URL: "https://www.yandex.az",
+				TTL: -1,
+			},
+			want: want{
+				code: 400,
+			},
+		},
+		{
+			name: "POST query with both TTL and expiration time",
+			URL: modeldto.RequestURL{
+				URL:       "https://www.yandex.lt",
+				ExpiresAt: &future,
+				TTL:       3600,
+			},
+			want: want{
+				code: 400,
+			},
+		},
+	}
+
+	// perform each test
+	for _, tt := range tests {
+		suite.T().Run(tt.name, func(t *testing.T) {
+			reqBody, _ := json.Marshal(tt.URL)
+			payload := strings.NewReader(string(reqBody))
+			client := resty.New()
+			res, err := client.R().SetBody(payload).Post(suite.ts.URL + "/api/shorten")
+			if err != nil {
+				t.Fatalf("Could not perform JSON POST request")
+			}
+			assert.Equal(t, tt.want.code, res.StatusCode())
+		})
+	}
+	defer suite.ts.Close()
+	suite.cancel()
+	suite.wg.Wait()
+}
+
+func (suite *HandlersTestSuite) TestHandleGetURLExpired() {
+	userID := suite.secretaryService.Encode(uuid.New().String())
+	sURLActive, _ := suite.shortenerService.Encode(suite.ctx, "https://www.yandex.lv", userID, modelurl.ShortenOptions{TTL: time.Hour})
+	// expired entries cannot be created via the service, so put one into the storage directly
+	sURLExpired := "expired-" + uuid.New().String()[:8]
+	expiresAt := time.Now().Add(-time.Minute)
+	_ = suite.storage.Dump(suite.ctx, modelstorage.URLStorageEntry{SURL: sURLExpired, URL: "https://www.yandex.ee", UserID: userID, ExpiresAt: &expiresAt})
+	suite.router.Get("/{urlID}", suite.urlHandler.HandleGetURL())
+
+	// set tests' parameters
+	type want struct {
+		code int
+	}
+	tests := []struct {
+		name string
+		sURL string
+		want want
+	}{
+		{
+			name: "GET query for not yet expired URL",
+			sURL: sURLActive,
+			want: want{
+				code: 307,
+			},
+		},
+		{
+			name: "GET query for expired URL",
+			sURL: sURLExpired,
+			want: want{
+				code: 410,
+			},
+		},
+	}
+
+	// perform each test
+	for _, tt := range tests {
+		suite.T().Run(tt.name, func(t *testing.T) {
+			client := resty.New()
+			client.SetRedirectPolicy(resty.RedirectPolicyFunc(func(req *http.Request, via []*http.Request) error {
+				return http.ErrUseLastResponse
+			}))
+			res, err := client.R().SetPathParams(map[string]string{"urlID": tt.sURL}).Get(suite.ts.URL + "/{urlID}")
+			if err != nil {
+				t.Fatalf(err.Error())
+			}
+			assert.Equal(t, tt.want.code, res.StatusCode())
+		})
+	}
+	defer suite.ts.Close()
+	suite.cancel()
+	suite.wg.Wait()
+}
+
+func (suite *HandlersTestSuite) TestHandleGetURLRedirectType() {
+	userID := suite.secretaryService.Encode(uuid.New().String())
+	sURLDefault, _ := suite.shortenerService.Encode(suite.ctx, "https://www.yandex.md", userID, modelurl.ShortenOptions{})
+	sURLPermanent, _ := suite.shortenerService.Encode(suite.ctx, "https://www.yandex.am", userID, modelurl.ShortenOptions{RedirectType: 301})
+	sURLFound, _ := suite.shortenerService.Encode(suite.ctx, "https://www.yandex.ge", userID, modelurl.ShortenOptions{RedirectType: 302})
+	// a service configured with another global redirect type applies it to links without an override only
+	foundService, _ := shortener.InitShortener(suite.storage, &config.ShortenerConfig{AllowedSchemes: []string{"https"}, RedirectType: 302})
+	foundHandler, _ := InitURLHandler(foundService, suite.cfg.ServerConfig, nil)
+	suite.router.Use(suite.cookieHandler.CookieHandle)
+	suite.router.Get("/{urlID}", suite.urlHandler.HandleGetURL())
+	suite.router.Get("/found/{urlID}", foundHandler.HandleGetURL())
+	suite.router.Post("/api/shorten", suite.urlHandler.JSONHandlePostURL())
+
+	// set tests' parameters
+	type want struct {
+		code int
+	}
+	tests := []struct {
+		name string
+		path string
+		want want
+	}{
+		{
+			name: "GET query for URL with default redirect type",
+			path: "/" + sURLDefault,
+			want: want{
+				code: 307,
+			},
+		},
+		{
+			name: "GET query for URL with permanent redirect",
+			path: "/" + sURLPermanent,
+			want: want{
+				code: 301,
+			},
+		},
+		{
+			name: "GET query for URL with found redirect",
+			path: "/" + sURLFound,
+			want: want{
+				code: 302,
+			},
+		},
+		{
+			name: "GET query for URL with configured default redirect type",
+			path: "/found/" + sURLDefault,
+			want: want{
+				code: 302,
+			},
+		},
+		{
+			name: "GET query for URL overriding configured default redirect type",
+			path: "/found/" + sURLPermanent,
+			want: want{
+				code: 301,
+			},
+		},
+	}
+
+	// perform each test
+	for _, tt := range tests {
+		suite.T().Run(tt.name, func(t *testing.T) {
+			client := resty.New()
+			client.SetRedirectPolicy(resty.RedirectPolicyFunc(func(req *http.Request, via []*http.Request) error {
+				return http.ErrUseLastResponse
+			}))
+			res, err := client.R().Get(suite.ts.URL + tt.path)
+			if err != nil {
+				t.Fatalf(err.Error())
+			}
+			assert.Equal(t, tt.want.code, res.StatusCode())
+		})
+	}
+	suite.T().Run("POST query with unsupported redirect type", func(t *testing.T) {
+		reqBody, _ := json.Marshal(modeldto.RequestURL{URL: "https://www.yandex.tm", RedirectType: 308})
+		res, err := resty.New().R().SetHeader("Content-Type", "application/json").SetBody(reqBody).Post(suite.ts.URL + "/api/shorten")
+		if err != nil {
+			t.Fatalf("Could not perform JSON POST request")
+		}
+		assert.Equal(t, 400, res.StatusCode())
+	})
+	defer suite.ts.Close()
+	suite.cancel()
+	suite.wg.Wait()
+}
+
+func (suite *HandlersTestSuite) TestHandleGetURLPassword() {
+	URL := "https://www.yandex.kz/" + uuid.New().String()
+	previewHandler, _ := InitPreviewHandler(suite.shortenerService, suite.cfg.ServerConfig, nil, nil)
+	suite.router.Use(suite.cookieHandler.CookieHandle)
+	suite.router.Post("/api/shorten", suite.urlHandler.JSONHandlePostURL())
+	suite.router.Get("/{urlID}", suite.urlHandler.HandleGetURL())
+	suite.router.Post("/{urlID}", suite.urlHandler.HandleGetURL())
+	suite.router.Get("/{urlID}+", previewHandler.HandleGetURLPreview())
+	suite.router.Get("/{urlID}/qr", suite.urlHandler.HandleGetURLQR())
+	client := resty.New()
+	client.SetRedirectPolicy(resty.RedirectPolicyFunc(func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	}))
+	reqBody, _ := json.Marshal(modeldto.RequestURL{URL: URL, Password: "s3cret"})
+	res, err := client.R().SetHeader("Content-Type", "application/json").SetBody(reqBody).Post(suite.ts.URL + "/api/shorten")
+	suite.Require().NoError(err)
+	suite.Require().Equal(201, res.StatusCode())
+	var resBody modeldto.ResponseURL
+	suite.Require().NoError(json.Unmarshal(res.Body(), &resBody))
+	sURL := resBody.SURL[len(suite.cfg.ServerConfig.BaseURL)+1:]
+
+	// set tests' parameters
+	type want struct {
+		code     int
+		location string
+		form     bool
+	}
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		header string
+		form   string
+		want   want
+	}{
+		{name: "GET query without password", method: http.MethodGet, path: "/" + sURL, want: want{code: 401, form: true}},
+		{name: "GET query with wrong password", method: http.MethodGet, path: "/" + sURL + "?pw=wrong", want: want{code: 403, form: true}},
+		{name: "GET query with password in query", method: http.MethodGet, path: "/" + sURL + "?pw=s3cret", want: want{code: 307, location: URL}},
+		{name: "GET query with password in header", method: http.MethodGet, path: "/" + sURL, header: "s3cret", want: want{code: 307, location: URL}},
+		{name: "POST form with wrong password", method: http.MethodPost, path: "/" + sURL, form: "wrong", want: want{code: 403, form: true}},
+		{name: "POST form with password", method: http.MethodPost, path: "/" + sURL, form: "s3cret", want: want{code: 303, location: URL}},
+		{name: "Preview without password", method: http.MethodGet, path: "/" + sURL + "+", want: want{code: 401, form: true}},
+		{name: "Preview with password", method: http.MethodGet, path: "/" + sURL + "+?pw=s3cret", want: want{code: 200}},
+		{name: "QR code without password", method: http.MethodGet, path: "/" + sURL + "/qr", want: want{code: 200}},
+	}
+
+	// perform each test
+	for _, tt := range tests {
+		suite.T().Run(tt.name, func(t *testing.T) {
+			req := client.R()
+			if tt.header != "" {
+				req.SetHeader("X-Link-Password", tt.header)
+			}
+			if tt.form != "" {
+				req.SetFormData(map[string]string{"password": tt.form})
+			}
+			res, err := req.Execute(tt.method, suite.ts.URL+tt.path)
+			if err != nil {
+				t.Fatalf(err.Error())
+			}
+			assert.Equal(t, tt.want.code, res.StatusCode())
+			assert.Equal(t, tt.want.location, res.Header().Get("Location"))
+			if tt.want.form {
+				assert.Equal(t, "no-store", res.Header().Get("Cache-Control"))
+				assert.Contains(t, res.String(), `name="password"`)
+				assert.NotContains(t, res.String(), URL)
+			}
+		})
+	}
+	suite.T().Run("POST query with too long password", func(t *testing.T) {
+		reqBody, _ := json.Marshal(modeldto.RequestURL{URL: URL + "/long", Password: strings.Repeat("a", 73)})
+		res, err := resty.New().R().SetHeader("Content-Type", "application/json").SetBody(reqBody).Post(suite.ts.URL + "/api/shorten")
+		if err != nil {
+			t.Fatalf("Could not perform JSON POST request")
+		}
+		assert.Equal(t, 400, res.StatusCode())
+	})
+	defer suite.ts.Close()
+	suite.cancel()
+	suite.wg.Wait()
+}
+
+func (suite *HandlersTestSuite) TestHandleGetURLMaxClicks() {
+	userID := suite.secretaryService.Encode(uuid.New().String())
+	URL := "https://www.yandex.uz/" + uuid.New().String()
+	sURL, err := suite.shortenerService.Encode(suite.ctx, URL, userID, modelurl.ShortenOptions{MaxClicks: 2})
+	suite.Require().NoError(err)
+	previewHandler, _ := InitPreviewHandler(suite.shortenerService, suite.cfg.ServerConfig, nil, nil)
+	suite.router.Use(suite.cookieHandler.CookieHandle)
+	suite.router.Post("/api/shorten", suite.urlHandler.JSONHandlePostURL())
+	suite.router.Get("/{urlID}", suite.urlHandler.HandleGetURL())
+	suite.router.Get("/{urlID}+", previewHandler.HandleGetURLPreview())
+	client := resty.New()
+	client.SetRedirectPolicy(resty.RedirectPolicyFunc(func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	}))
+
+	// set tests' parameters, previews are not counted
+	tests := []struct {
+		name string
+		path string
+		code int
+	}{
+		{name: "Preview before the first redirect", path: "/" + sURL + "+", code: 200},
+		{name: "First redirect", path: "/" + sURL, code: 307},
+		{name: "Last redirect", path: "/" + sURL, code: 307},
+		{name: "Redirect after the limit", path: "/" + sURL, code: 410},
+		{name: "Preview after the limit", path: "/" + sURL + "+", code: 410},
+	}
+
+	// perform tests in order since every redirect counts
+	for _, tt := range tests {
+		suite.T().Run(tt.name, func(t *testing.T) {
+			res, err := client.R().Get(suite.ts.URL + tt.path)
+			if err != nil {
+				t.Fatalf(err.Error())
+			}
+			assert.Equal(t, tt.code, res.StatusCode())
+		})
+	}
+	suite.T().Run("POST query with negative click limit", func(t *testing.T) {
+		reqBody, _ := json.Marshal(modeldto.RequestURL{URL: URL + "/negative", MaxClicks: -1})
+		res, err := resty.New().R().SetHeader("Content-Type", "application/json").SetBody(reqBody).Post(suite.ts.URL + "/api/shorten")
+		if err != nil {
+			t.Fatalf("Could not perform JSON POST request")
+		}
+		assert.Equal(t, 400, res.StatusCode())
+	})
+	defer suite.ts.Close()
+	suite.cancel()
+	suite.wg.Wait()
+}
+
+func (suite *HandlersTestSuite) TestHandleGetURLActivationWindow() {
+	userID := suite.secretaryService.Encode(uuid.New().String())
+	activeFrom, activeUntil := time.Now().Add(time.Hour), time.Now().Add(2*time.Hour)
+	sURLScheduled, err := suite.shortenerService.Encode(suite.ctx, "https://www.yandex.az/"+uuid.New().String(), userID, modelurl.ShortenOptions{ActiveFrom: &activeFrom, ActiveUntil: &activeUntil})
+	suite.Require().NoError(err)
+	startedAt := time.Now().Add(-time.Hour)
+	sURLActive, err := suite.shortenerService.Encode(suite.ctx, "https://www.yandex.az/"+uuid.New().String(), userID, modelurl.ShortenOptions{ActiveFrom: &startedAt, ActiveUntil: &activeUntil})
+	suite.Require().NoError(err)
+	// ended windows cannot be created via the service, so put one into the storage directly
+	sURLEnded := "ended-" + uuid.New().String()[:8]
+	endedAt := time.Now().Add(-time.Minute)
+	_ = suite.storage.Dump(suite.ctx, modelstorage.URLStorageEntry{SURL: sURLEnded, URL: "https://www.yandex.az/ended", UserID: userID, ActiveFrom: &startedAt, ExpiresAt: &endedAt})
+	previewHandler, _ := InitPreviewHandler(suite.shortenerService, suite.cfg.ServerConfig, nil, nil)
+	suite.router.Use(suite.cookieHandler.CookieHandle)
+	suite.router.Post("/api/shorten", suite.urlHandler.JSONHandlePostURL())
+	suite.router.Get("/{urlID}", suite.urlHandler.HandleGetURL())
+	suite.router.Get("/{urlID}+", previewHandler.HandleGetURLPreview())
+	suite.router.Get("/{urlID}/qr", suite.urlHandler.HandleGetURLQR())
+	client := resty.New()
+	client.SetRedirectPolicy(resty.RedirectPolicyFunc(func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	}))
+
+	// set tests' parameters
+	tests := []struct {
+		name string
+		path string
+		code int
+	}{
+		{name: "GET query before the window", path: "/" + sURLScheduled, code: 404},
+		{name: "Preview before the window", path: "/" + sURLScheduled + "+", code: 404},
+		{name: "QR code before the window", path: "/" + sURLScheduled + "/qr", code: 200},
+		{name: "GET query within the window", path: "/" + sURLActive, code: 307},
+		{name: "GET query after the window", path: "/" + sURLEnded, code: 410},
+	}
+
+	// perform each test
+	for _, tt := range tests {
+		suite.T().Run(tt.name, func(t *testing.T) {
+			res, err := client.R().Get(suite.ts.URL + tt.path)
+			if err != nil {
+				t.Fatalf(err.Error())
+			}
+			assert.Equal(t, tt.code, res.StatusCode())
+		})
+	}
+	invalid := []struct {
+		name string
+		body modeldto.RequestURL
+	}{
+		{name: "POST query with window starting after its end", body: modeldto.RequestURL{URL: "https://www.yandex.az/invalid", ActiveFrom: &activeUntil, ActiveUntil: &activeFrom}},
+		{name: "POST query with both window end and expiration", body: modeldto.RequestURL{URL: "https://www.yandex.az/invalid", ActiveUntil: &activeUntil, ExpiresAt: &activeUntil}},
+	}
+	for _, tt := range invalid {
+		suite.T().Run(tt.name, func(t *testing.T) {
+			reqBody, _ := json.Marshal(tt.body)
+			res, err := resty.New().R().SetHeader("Content-Type", "application/json").SetBody(reqBody).Post(suite.ts.URL + "/api/shorten")
+			if err != nil {
+				t.Fatalf("Could not perform JSON POST request")
+			}
+			assert.Equal(t, 400, res.StatusCode())
+		})
+	}
+	defer suite.ts.Close()
+	suite.cancel()
+	suite.wg.Wait()
+}
+
+func (suite *HandlersTestSuite) TestHandleGetServiceStats() {
+	userID := suite.secretaryService.Encode(uuid.New().String())
+	_, _ = suite.shortenerService.Encode(suite.ctx, "https://www.yandex.ru/"+uuid.New().String(), userID, modelurl.ShortenOptions{})
+	_, subnet, _ := net.ParseCIDR("10.0.0.0/8")
+	suite.router.With(middleware.TrustedSubnet(subnet)).Get("/api/internal/stats", suite.urlHandler.HandleGetServiceStats())
+
+	client := resty.New()
+	res, err := client.R().SetHeader("X-Real-IP", "10.1.2.3").Get(suite.ts.URL + "/api/internal/stats")
+	if err != nil {
+		suite.T().Fatalf("Could not perform GET request")
+	}
+	assert.Equal(suite.T(), http.StatusOK, res.StatusCode())
+	var stats modeldto.ResponseServiceStats
+	assert.NoError(suite.T(), json.Unmarshal(res.Body(), &stats))
+	// the file storage is shared by all tests, so only check that the link above is counted
+	assert.GreaterOrEqual(suite.T(), stats.URLs, 1)
+	assert.GreaterOrEqual(suite.T(), stats.Users, 1)
+
+	res, err = client.R().SetHeader("X-Real-IP", "192.168.1.1").Get(suite.ts.URL + "/api/internal/stats")
+	if err != nil {
+		suite.T().Fatalf("Could not perform GET request")
+	}
+	assert.Equal(suite.T(), http.StatusForbidden, res.StatusCode())
+	defer suite.ts.Close()
+	suite.cancel()
+	suite.wg.Wait()
+}
+
+func (suite *HandlersTestSuite) TestHandleGetDeliveries() {
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer target.Close()
+	webhookConfig := *suite.cfg.WebhookConfig
+	webhookConfig.URLs = []string{target.URL}
+	dispatcher := webhook.NewDispatcher(suite.ctx, &webhookConfig, nil)
+	dispatcher.Publish(modelurl.Event{Type: modelurl.EventURLCreated, SURL: "abc", URL: "https://www.yandex.ru/", OccurredAt: time.Now().UTC()})
+	assert.Eventually(suite.T(), func() bool {
+		deliveries := dispatcher.Deliveries()
+		return len(deliveries) == 1 && deliveries[0].Status == webhook.StatusDelivered
+	}, 5*time.Second, 10*time.Millisecond)
+	webhookHandler := InitWebhookHandler(dispatcher, nil)
+	_, subnet, _ := net.ParseCIDR("10.0.0.0/8")
+	suite.router.With(middleware.TrustedSubnet(subnet)).Get("/api/internal/webhooks/deliveries", webhookHandler.HandleGetDeliveries())
+
+	client := resty.New()
+	res, err := client.R().SetHeader("X-Real-IP", "10.1.2.3").Get(suite.ts.URL + "/api/internal/webhooks/deliveries")
+	if err != nil {
+		suite.T().Fatalf("Could not perform GET request")
+	}
+	assert.Equal(suite.T(), http.StatusOK, res.StatusCode())
+	var deliveries []modeldto.ResponseWebhookDelivery
+	assert.NoError(suite.T(), json.Unmarshal(res.Body(), &deliveries))
+	if assert.Len(suite.T(), deliveries, 1) {
+		assert.Equal(suite.T(), modelurl.EventURLCreated, deliveries[0].EventType)
+		assert.Equal(suite.T(), target.URL, deliveries[0].Target)
+		assert.Equal(suite.T(), webhook.StatusDelivered, deliveries[0].Status)
+		assert.Equal(suite.T(), 1, deliveries[0].Attempts)
+	}
+
+	res, err = client.R().SetHeader("X-Real-IP", "10.1.2.3").Get(suite.ts.URL + "/api/internal/webhooks/deliveries?status=failed")
+	if err != nil {
+		suite.T().Fatalf("Could not perform GET request")
+	}
+	assert.Equal(suite.T(), http.StatusOK, res.StatusCode())
+	assert.JSONEq(suite.T(), "[]", string(res.Body()))
+
+	res, err = client.R().SetHeader("X-Real-IP", "10.1.2.3").Get(suite.ts.URL + "/api/internal/webhooks/deliveries?status=unknown")
+	if err != nil {
+		suite.T().Fatalf("Could not perform GET request")
+	}
+	assert.Equal(suite.T(), http.StatusBadRequest, res.StatusCode())
+
+	res, err = client.R().SetHeader("X-Real-IP", "192.168.1.1").Get(suite.ts.URL + "/api/internal/webhooks/deliveries")
+	if err != nil {
+		suite.T().Fatalf("Could not perform GET request")
+	}
+	assert.Equal(suite.T(), http.StatusForbidden, res.StatusCode())
+	defer suite.ts.Close()
+	suite.cancel()
+	suite.wg.Wait()
+}
+
+// unavailableStorage fails DB pings of the wrapped storage.
+type unavailableStorage struct {
+	storage.URLStorage
+}
+
+func (s unavailableStorage) PingDB() error {
+	return errors.New("connection refused")
+}
+
+func (suite *HandlersTestSuite) TestHandleHealth() {
+	healthHandler, _ := InitHealthHandler(suite.storage, suite.cfg.StorageConfig, nil)
+	unavailableHandler, _ := InitHealthHandler(unavailableStorage{suite.storage}, suite.cfg.StorageConfig, nil)
+	suite.router.Get("/healthz", healthHandler.HandleLiveness())
+	suite.router.Get("/readyz", healthHandler.HandleReadiness())
+	suite.router.Get("/unavailable/readyz", unavailableHandler.HandleReadiness())
+
+	client := resty.New()
+	res, err := client.R().Get(suite.ts.URL + "/healthz")
+	if err != nil {
+		suite.T().Fatalf("Could not perform GET request")
+	}
+	assert.Equal(suite.T(), http.StatusOK, res.StatusCode())
+	assert.JSONEq(suite.T(), `{"status":"ok"}`, string(res.Body()))
+
+	res, err = client.R().Get(suite.ts.URL + "/readyz")
+	if err != nil {
+		suite.T().Fatalf("Could not perform GET request")
+	}
+	assert.Equal(suite.T(), http.StatusOK, res.StatusCode())
+	var health modeldto.ResponseHealth
+	assert.NoError(suite.T(), json.Unmarshal(res.Body(), &health))
+	assert.Equal(suite.T(), "ok", health.Status)
+	assert.Equal(suite.T(), "ok", health.Checks["database"].Status)
+	assert.Equal(suite.T(), "ok", health.Checks["delete_queue"].Status)
+	// the file storage has no cache
+	assert.Equal(suite.T(), "disabled", health.Checks["cache"].Status)
+
+	res, err = client.R().Get(suite.ts.URL + "/unavailable/readyz")
+	if err != nil {
+		suite.T().Fatalf("Could not perform GET request")
+	}
+	assert.Equal(suite.T(), http.StatusServiceUnavailable, res.StatusCode())
+	health = modeldto.ResponseHealth{}
+	assert.NoError(suite.T(), json.Unmarshal(res.Body(), &health))
+	assert.Equal(suite.T(), "fail", health.Status)
+	assert.Equal(suite.T(), "fail", health.Checks["database"].Status)
+	assert.Equal(suite.T(), "connection refused", health.Checks["database"].Error)
+	defer suite.ts.Close()
+	suite.cancel()
+	suite.wg.Wait()
+}
+
+func (suite *HandlersTestSuite) TestRequireURLAccess() {
+	suite.router.Use(suite.cookieHandler.CookieHandle)
+	suite.router.With(suite.urlHandler.RequireURLAccess).Get("/api/urls/{urlID}/stats", suite.urlHandler.HandleGetURLStats())
+	userIDs := make(map[string]string)
+	logins := make(map[string]string)
+	for _, name := range []string{"owner", "member", "stranger"} {
+		userIDs[name] = suite.secretaryService.Encode(uuid.New().String())
+		logins[name] = name + "-" + uuid.New().String()[:8]
+		err := suite.storage.DumpUser(suite.ctx, modelstorage.UserEntry{Login: logins[name], PasswordHash: "-", UserID: userIDs[name]})
+		suite.Require().NoError(err)
+	}
+	org, err := suite.shortenerService.CreateOrg(suite.ctx, userIDs["owner"], "Marketing")
+	suite.Require().NoError(err)
+	_, err = suite.shortenerService.SetMember(suite.ctx, userIDs["owner"], org.ID, logins["member"], modelurl.RoleMember)
+	suite.Require().NoError(err)
+	personal, err := suite.shortenerService.Encode(suite.ctx, "https://www.yandex.com/"+uuid.New().String(), userIDs["owner"], modelurl.ShortenOptions{})
+	suite.Require().NoError(err)
+	shared, err := suite.shortenerService.Encode(suite.ctx, "https://www.yandex.com/"+uuid.New().String(), userIDs["owner"], modelurl.ShortenOptions{Org: org.ID})
+	suite.Require().NoError(err)
+
+	tests := []struct {
+		name string
+		user string
+		sURL string
+		code int
+	}{
+		{name: "Owner", user: "owner", sURL: personal, code: 200},
+		{name: "Another user", user: "stranger", sURL: personal, code: 403},
+		{name: "Organization member of a personal link", user: "member", sURL: personal, code: 403},
+		{name: "Organization member of an organization link", user: "member", sURL: shared, code: 200},
+		{name: "Another user of an organization link", user: "stranger", sURL: shared, code: 403},
+		{name: "Unknown URL", user: "owner", sURL: "unknown-" + uuid.New().String()[:8], code: 404},
+	}
+	for _, tt := range tests {
+		suite.T().Run(tt.name, func(t *testing.T) {
+			client := resty.New()
+			client.SetCookie(&http.Cookie{Name: "user", Value: userIDs[tt.user], Path: "/"})
+			res, err := client.R().Get(suite.ts.URL + "/api/urls/" + tt.sURL + "/stats")
+			if err != nil {
+				t.Fatalf(err.Error())
+			}
+			assert.Equal(t, tt.code, res.StatusCode())
+		})
+	}
+	defer suite.ts.Close()
+	suite.cancel()
+	suite.wg.Wait()
+}
+
+func (suite *HandlersTestSuite) TestHandleGetURLStats() {
+	userID := suite.secretaryService.Encode(uuid.New().String())
+	sURL, _ := suite.shortenerService.Encode(suite.ctx, "https://www.yandex.by", userID, modelurl.ShortenOptions{})
+	suite.router.Get("/{urlID}", suite.urlHandler.HandleGetURL())
+	suite.router.Get("/api/urls/{urlID}/stats", suite.urlHandler.HandleGetURLStats())
+	client := resty.New()
+	client.SetRedirectPolicy(resty.RedirectPolicyFunc(func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	}))
+	for i := 0; i < 3; i++ {
+		_, err := client.R().SetPathParams(map[string]string{"urlID": sURL}).Get(suite.ts.URL + "/{urlID}")
+		if err != nil {
+			suite.T().Fatalf(err.Error())
+		}
+	}
+
+	// set tests' parameters
+	type want struct {
+		code           int
+		totalClicks    int
+		uniqueVisitors int
+	}
+	tests := []struct {
+		name string
+		sURL string
+		want want
+	}{
+		{
+			name: "Correct GET stats query",
+			sURL: sURL,
+			want: want{
+				code:           200,
+				totalClicks:    3,
+				uniqueVisitors: 1,
+			},
+		},
+		{
+			name: "GET stats query for unknown URL",
+			sURL: "unknown-" + uuid.New().String()[:8],
+			want: want{
+				code: 404,
+			},
+		},
+	}
+
+	// perform each test
+	for _, tt := range tests {
+		suite.T().Run(tt.name, func(t *testing.T) {
+			res, err := client.R().SetPathParams(map[string]string{"urlID": tt.sURL}).Get(suite.ts.URL + "/api/urls/{urlID}/stats")
+			if err != nil {
+				t.Fatalf(err.Error())
+			}
+			assert.Equal(t, tt.want.code, res.StatusCode())
+			if tt.want.code == 200 {
+				var stats modeldto.ResponseURLStats
+				err = json.Unmarshal(res.Body(), &stats)
+				if err != nil {
+					t.Fatalf(err.Error())
+				}
+				assert.Equal(t, tt.want.totalClicks, stats.TotalClicks)
+				assert.NotEmpty(t, stats.ClicksPerDay)
+				// redirects of one client are made by one visitor
+				assert.Equal(t, tt.want.uniqueVisitors, stats.UniqueVisitors)
+				assert.Equal(t, tt.want.uniqueVisitors, stats.ClicksPerDay[len(stats.ClicksPerDay)-1].UniqueVisitors)
+			}
+		})
+	}
+	defer suite.ts.Close()
+	suite.cancel()
+	suite.wg.Wait()
+}
+
+func (suite *HandlersTestSuite) TestHandleGetURLTimeSeries() {
+	userID := suite.secretaryService.Encode(uuid.New().String())
+	sURL, _ := suite.shortenerService.Encode(suite.ctx, "https://www.yandex.uz", userID, modelurl.ShortenOptions{})
+	otherSURL, _ := suite.shortenerService.Encode(suite.ctx, "https://www.yandex.kz", suite.secretaryService.Encode(uuid.New().String()), modelurl.ShortenOptions{})
+	suite.router.Use(suite.cookieHandler.CookieHandle)
+	suite.router.Get("/{urlID}", suite.urlHandler.HandleGetURL())
+	suite.router.With(suite.urlHandler.RequireURLAccess).Get("/api/urls/{urlID}/stats/timeseries", suite.urlHandler.HandleGetURLTimeSeries())
+	client := resty.New()
+	client.SetCookie(&http.Cookie{Name: "user", Value: userID, Path: "/"})
+	client.SetRedirectPolicy(resty.RedirectPolicyFunc(func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	}))
+	for i := 0; i < 3; i++ {
+		_, err := client.R().SetPathParams(map[string]string{"urlID": sURL}).Get(suite.ts.URL + "/{urlID}")
+		if err != nil {
+			suite.T().Fatalf(err.Error())
+		}
+	}
+
+	// set tests' parameters
+	type want struct {
+		code    int
+		buckets int
+	}
+	tests := []struct {
+		name  string
+		sURL  string
+		query map[string]string
+		want  want
+	}{
+		{
+			name: "Daily time series of the last 30 days by default",
+			sURL: sURL,
+			want: want{code: 200, buckets: 30},
+		},
+		{
+			name:  "Hourly time series of the last 48 hours by default",
+			sURL:  sURL,
+			query: map[string]string{"granularity": "hour"},
+			want:  want{code: 200, buckets: 48},
+		},
+		{
+			name:  "Hourly time series within a range",
+			sURL:  sURL,
+			query: map[string]string{"granularity": "hour", "from": time.Now().UTC().Truncate(time.Hour).Add(-time.Hour).Format(time.RFC3339)},
+			want:  want{code: 200, buckets: 2},
+		},
+		{
+			name:  "Unknown granularity",
+			sURL:  sURL,
+			query: map[string]string{"granularity": "week"},
+			want:  want{code: 400},
+		},
+		{
+			name:  "Malformed range",
+			sURL:  sURL,
+			query: map[string]string{"from": "yesterday"},
+			want:  want{code: 400},
+		},
+		{
+			name:  "Too long range",
+			sURL:  sURL,
+			query: map[string]string{"granularity": "hour", "from": "2020-01-01T00:00:00Z"},
+			want:  want{code: 400},
+		},
+		{
+			name: "Time series of unknown URL",
+			sURL: "unknown-" + uuid.New().String()[:8],
+			want: want{code: 404},
+		},
+		{
+			name: "Time series of URL of another user",
+			sURL: otherSURL,
+			want: want{code: 403},
+		},
+	}
+
+	// perform each test
+	for _, tt := range tests {
+		suite.T().Run(tt.name, func(t *testing.T) {
+			res, err := client.R().SetPathParams(map[string]string{"urlID": tt.sURL}).SetQueryParams(tt.query).Get(suite.ts.URL + "/api/urls/{urlID}/stats/timeseries")
+			if err != nil {
+				t.Fatalf(err.Error())
+			}
+			assert.Equal(t, tt.want.code, res.StatusCode())
+			if tt.want.code == 200 {
+				var series modeldto.ResponseTimeSeries
+				err = json.Unmarshal(res.Body(), &series)
+				if err != nil {
+					t.Fatalf(err.Error())
+				}
+				assert.Len(t, series.Buckets, tt.want.buckets)
+				clicks := 0
+				for _, bucket := range series.Buckets {
+					clicks += bucket.Clicks
+				}
+				assert.Equal(t, 3, clicks)
+				// the latest bucket holds the redirects made just now
+				assert.Equal(t, 3, series.Buckets[len(series.Buckets)-1].Clicks)
+			}
+		})
+	}
+	defer suite.ts.Close()
+	suite.cancel()
+	suite.wg.Wait()
+}
+
+func (suite *HandlersTestSuite) TestHandleGetUserURLStats() {
+	userID := suite.secretaryService.Encode(uuid.New().String())
+	sURL, _ := suite.shortenerService.Encode(suite.ctx, "https://www.yandex.am", userID, modelurl.ShortenOptions{})
+	otherSURL, _ := suite.shortenerService.Encode(suite.ctx, "https://www.yandex.az", suite.secretaryService.Encode(uuid.New().String()), modelurl.ShortenOptions{})
+	suite.router.Use(suite.cookieHandler.CookieHandle)
+	suite.router.Get("/{urlID}", suite.urlHandler.HandleGetURL())
+	suite.router.With(suite.urlHandler.RequireURLAccess).Get("/api/user/urls/{urlID}/stats", suite.urlHandler.HandleGetUserURLStats())
+	client := resty.New()
+	client.SetCookie(&http.Cookie{Name: "user", Value: userID, Path: "/"})
+	client.SetRedirectPolicy(resty.RedirectPolicyFunc(func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	}))
+	for i := 0; i < 3; i++ {
+		_, err := client.R().Get(suite.ts.URL + "/" + sURL)
+		if err != nil {
+			suite.T().Fatalf(err.Error())
+		}
+	}
+	today := time.Now().UTC().Format("2006-01-02")
+
+	// set tests' parameters
+	type want struct {
+		code   int
+		days   int
+		clicks int
+	}
+	tests := []struct {
+		name  string
+		sURL  string
+		query map[string]string
+		want  want
+	}{
+		{
+			name: "Daily stats of the last 30 days by default",
+			sURL: sURL,
+			want: want{code: 200, days: 30, clicks: 3},
+		},
+		{
+			name:  "Daily stats of a day",
+			sURL:  sURL,
+			query: map[string]string{"from": today, "to": today},
+			want:  want{code: 200, days: 1, clicks: 3},
+		},
+		{
+			name:  "Malformed date",
+			sURL:  sURL,
+			query: map[string]string{"from": "yesterday"},
+			want:  want{code: 400},
+		},
+		{
+			name:  "Reversed range",
+			sURL:  sURL,
+			query: map[string]string{"from": "2021-02-01", "to": "2021-01-01"},
+			want:  want{code: 400},
+		},
+		{
+			name:  "Too long range",
+			sURL:  sURL,
+			query: map[string]string{"from": "2020-01-01", "to": "2021-01-01"},
+			want:  want{code: 400},
+		},
+		{
+			name: "Daily stats of URL of another user",
+			sURL: otherSURL,
+			want: want{code: 403},
+		},
+		{
+			name: "Daily stats of unknown URL",
+			sURL: "unknown-" + uuid.New().String()[:8],
+			want: want{code: 404},
+		},
+	}
+
+	// perform each test
+	for _, tt := range tests {
+		suite.T().Run(tt.name, func(t *testing.T) {
+			res, err := client.R().SetQueryParams(tt.query).Get(suite.ts.URL + "/api/user/urls/" + tt.sURL + "/stats")
+			if err != nil {
+				t.Fatalf(err.Error())
+			}
+			assert.Equal(t, tt.want.code, res.StatusCode())
+			if tt.want.code == 200 {
+				var stats modeldto.ResponseDailyStats
+				err = json.Unmarshal(res.Body(), &stats)
+				if err != nil {
+					t.Fatalf(err.Error())
+				}
+				assert.Len(t, stats.Days, tt.want.days)
+				assert.Equal(t, tt.want.clicks, stats.TotalClicks)
+				assert.Equal(t, today, stats.To)
+				assert.Equal(t, today, stats.Days[len(stats.Days)-1].Date)
+			}
+		})
+	}
+	defer suite.ts.Close()
+	suite.cancel()
+	suite.wg.Wait()
+}
+
+func (suite *HandlersTestSuite) TestHandleGetURLReferrers() {
+	userID := suite.secretaryService.Encode(uuid.New().String())
+	sURL, _ := suite.shortenerService.Encode(suite.ctx, "https://www.yandex.am", userID, modelurl.ShortenOptions{})
+	suite.router.Get("/{urlID}", suite.urlHandler.HandleGetURL())
+	suite.router.Get("/api/urls/{urlID}/stats/referrers", suite.urlHandler.HandleGetURLReferrers())
+	client := resty.New()
+	client.SetRedirectPolicy(resty.RedirectPolicyFunc(func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	}))
+	for _, referrer := range []string{"https://www.Example.com/post?id=1", "http://example.com", "https://news.example.org/", "", "not a URL"} {
+		_, err := client.R().SetHeader("Referer", referrer).SetPathParams(map[string]string{"urlID": sURL}).Get(suite.ts.URL + "/{urlID}")
+		if err != nil {
+			suite.T().Fatalf(err.Error())
+		}
+	}
+
+	// set tests' parameters
+	type want struct {
+		code     int
+		response modeldto.ResponseReferrers
+	}
+	tests := []struct {
+		name  string
+		sURL  string
+		limit string
+		want  want
+	}{
+		{
+			name: "Referrers by normalized domain",
+			sURL: sURL,
+			want: want{
+				code: 200,
+				response: modeldto.ResponseReferrers{
+					SURL:         suite.cfg.ServerConfig.BaseURL + "/" + sURL,
+					DirectClicks: 2,
+					Referrers:    []modeldto.ResponseReferrerClicks{{Domain: "example.com", Clicks: 2}, {Domain: "news.example.org", Clicks: 1}},
+				},
+			},
+		},
+		{
+			name:  "Top referrer",
+			sURL:  sURL,
+			limit: "1",
+			want: want{
+				code: 200,
+				response: modeldto.ResponseReferrers{
+					SURL:         suite.cfg.ServerConfig.BaseURL + "/" + sURL,
+					DirectClicks: 2,
+					Referrers:    []modeldto.ResponseReferrerClicks{{Domain: "example.com", Clicks: 2}},
+				},
+			},
+		},
+		{
+			name:  "Invalid limit",
+			sURL:  sURL,
+			limit: "0",
+			want:  want{code: 400},
+		},
+		{
+			name: "Referrers of unknown URL",
+			sURL: "unknown-" + uuid.New().String()[:8],
+			want: want{code: 404},
+		},
+	}
+
+	// perform each test
+	for _, tt := range tests {
+		suite.T().Run(tt.name, func(t *testing.T) {
+			req := client.R().SetPathParams(map[string]string{"urlID": tt.sURL})
+			if tt.limit != "" {
+				req.SetQueryParam("limit", tt.limit)
+			}
+			res, err := req.Get(suite.ts.URL + "/api/urls/{urlID}/stats/referrers")
+			if err != nil {
+				t.Fatalf(err.Error())
+			}
+			assert.Equal(t, tt.want.code, res.StatusCode())
+			if tt.want.code == 200 {
+				var response modeldto.ResponseReferrers
+				err = json.Unmarshal(res.Body(), &response)
+				if err != nil {
+					t.Fatalf(err.Error())
+				}
+				assert.Equal(t, tt.want.response, response)
+			}
+		})
+	}
+	defer suite.ts.Close()
+	suite.cancel()
+	suite.wg.Wait()
+}
+
+func (suite *HandlersTestSuite) TestHandleGetURLStatsBots() {
+	userID := suite.secretaryService.Encode(uuid.New().String())
+	sURL, _ := suite.shortenerService.Encode(suite.ctx, "https://www.yandex.md", userID, modelurl.ShortenOptions{})
+	suite.router.Get("/{urlID}", suite.urlHandler.HandleGetURL())
+	suite.router.Get("/api/urls/{urlID}/stats", suite.urlHandler.HandleGetURLStats())
+	suite.router.Get("/api/urls/{urlID}/stats/referrers", suite.urlHandler.HandleGetURLReferrers())
+	client := resty.New()
+	client.SetRedirectPolicy(resty.RedirectPolicyFunc(func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	}))
+	userAgents := []string{
+		"Mozilla/5.0 (X11; Linux x86_64; rv:109.0) Gecko/20100101 Firefox/115.0",
+		"Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)",
+		"facebookexternalhit/1.1",
+		"curl/8.4.0",
+	}
+	for _, userAgent := range userAgents {
+		_, err := client.R().SetHeader("User-Agent", userAgent).SetHeader("Referer", "https://example.com/").
+			SetPathParams(map[string]string{"urlID": sURL}).Get(suite.ts.URL + "/{urlID}")
+		if err != nil {
+			suite.T().Fatalf(err.Error())
+		}
+	}
+
+	// set tests' parameters
+	type want struct {
+		code           int
+		totalClicks    int
+		uniqueVisitors int
+		referrerClicks int
+	}
+	tests := []struct {
+		name        string
+		includeBots string
+		want        want
+	}{
+		{
+			name: "Bots are left out by default",
+			want: want{code: 200, totalClicks: 1, uniqueVisitors: 1, referrerClicks: 1},
+		},
+		{
+			name:        "Bots are counted on demand",
+			includeBots: "true",
+			want:        want{code: 200, totalClicks: 4, uniqueVisitors: 1, referrerClicks: 4},
+		},
+		{
+			name:        "Invalid include_bots",
+			includeBots: "sometimes",
+			want:        want{code: 400},
+		},
+	}
+
+	// perform each test
+	for _, tt := range tests {
+		suite.T().Run(tt.name, func(t *testing.T) {
+			req := client.R().SetPathParams(map[string]string{"urlID": sURL})
+			if tt.includeBots != "" {
+				req.SetQueryParam("include_bots", tt.includeBots)
+			}
+			res, err := req.Get(suite.ts.URL + "/api/urls/{urlID}/stats")
+			if err != nil {
+				t.Fatalf(err.Error())
+			}
+			assert.Equal(t, tt.want.code, res.StatusCode())
+			if tt.want.code != 200 {
+				return
+			}
+			var stats modeldto.ResponseURLStats
+			err = json.Unmarshal(res.Body(), &stats)
+			if err != nil {
+				t.Fatalf(err.Error())
+			}
+			assert.Equal(t, tt.want.totalClicks, stats.TotalClicks)
+			assert.Equal(t, tt.want.uniqueVisitors, stats.UniqueVisitors)
+			res, err = req.Get(suite.ts.URL + "/api/urls/{urlID}/stats/referrers")
+			if err != nil {
+				t.Fatalf(err.Error())
+			}
+			var referrers modeldto.ResponseReferrers
+			err = json.Unmarshal(res.Body(), &referrers)
+			if err != nil {
+				t.Fatalf(err.Error())
+			}
+			assert.Equal(t, []modeldto.ResponseReferrerClicks{{Domain: "example.com", Clicks: tt.want.referrerClicks}}, referrers.Referrers)
+		})
+	}
+	defer suite.ts.Close()
+	suite.cancel()
+	suite.wg.Wait()
+}
+
+func (suite *HandlersTestSuite) TestHandleGetURLCountries() {
+	userID := suite.secretaryService.Encode(uuid.New().String())
+	sURL, _ := suite.shortenerService.Encode(suite.ctx, "https://www.yandex.lv", userID, modelurl.ShortenOptions{})
+	suite.router.Get("/{urlID}", suite.urlHandler.HandleGetURL())
+	suite.router.Get("/api/urls/{urlID}/stats/countries", suite.urlHandler.HandleGetURLCountries())
+	client := resty.New()
+	client.SetRedirectPolicy(resty.RedirectPolicyFunc(func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	}))
+	// countries are not resolved without a GeoIP database
+	_, err := client.R().SetHeader("X-Real-IP", "81.169.145.1").SetPathParams(map[string]string{"urlID": sURL}).Get(suite.ts.URL + "/{urlID}")
+	if err != nil {
+		suite.T().Fatalf(err.Error())
+	}
+	for _, click := range []modelstorage.ClickEntry{
+		{SURL: sURL, ClickedAt: time.Now(), Country: "DE"},
+		{SURL: sURL, ClickedAt: time.Now(), Country: "FR"},
+		{SURL: sURL, ClickedAt: time.Now(), Country: "FR"},
+		{SURL: sURL, ClickedAt: time.Now(), Country: "US", Bot: true},
+	} {
+		suite.storage.SendClick(click)
+	}
+
+	// set tests' parameters
+	type want struct {
+		code     int
+		response modeldto.ResponseCountries
+	}
+	tests := []struct {
+		name        string
+		sURL        string
+		includeBots string
+		want        want
+	}{
+		{
+			name: "Countries by redirects",
+			sURL: sURL,
+			want: want{
+				code: 200,
+				response: modeldto.ResponseCountries{
+					SURL:          suite.cfg.ServerConfig.BaseURL + "/" + sURL,
+					UnknownClicks: 1,
+					Countries:     []modeldto.ResponseCountryClicks{{Country: "FR", Clicks: 2}, {Country: "DE", Clicks: 1}},
+				},
+			},
+		},
+		{
+			name:        "Countries with bots",
+			sURL:        sURL,
+			includeBots: "true",
+			want: want{
+				code: 200,
+				response: modeldto.ResponseCountries{
+					SURL:          suite.cfg.ServerConfig.BaseURL + "/" + sURL,
+					UnknownClicks: 1,
+					Countries:     []modeldto.ResponseCountryClicks{{Country: "FR", Clicks: 2}, {Country: "DE", Clicks: 1}, {Country: "US", Clicks: 1}},
+				},
+			},
+		},
+		{
+			name: "Countries of unknown URL",
+			sURL: "unknown-" + uuid.New().String()[:8],
+			want: want{code: 404},
+		},
+	}
+
+	// perform each test
+	for _, tt := range tests {
+		suite.T().Run(tt.name, func(t *testing.T) {
+			req := client.R().SetPathParams(map[string]string{"urlID": tt.sURL})
+			if tt.includeBots != "" {
+				req.SetQueryParam("include_bots", tt.includeBots)
+			}
+			res, err := req.Get(suite.ts.URL + "/api/urls/{urlID}/stats/countries")
+			if err != nil {
+				t.Fatalf(err.Error())
+			}
+			assert.Equal(t, tt.want.code, res.StatusCode())
+			if tt.want.code == 200 {
+				var response modeldto.ResponseCountries
+				err = json.Unmarshal(res.Body(), &response)
+				if err != nil {
+					t.Fatalf(err.Error())
+				}
+				assert.Equal(t, tt.want.response, response)
+			}
+		})
+	}
+	defer suite.ts.Close()
+	suite.cancel()
+	suite.wg.Wait()
+}
+
+func (suite *HandlersTestSuite) TestHandleGetURLSplit() {
+	suite.router.Use(suite.cookieHandler.CookieHandle)
+	suite.router.Post("/api/shorten", suite.urlHandler.JSONHandlePostURL())
+	suite.router.Get("/{urlID}", suite.urlHandler.HandleGetURL())
+	suite.router.Get("/api/urls/{urlID}/stats", suite.urlHandler.HandleGetURLStats())
+	base := "https://www.yandex.kz/" + uuid.New().String()
+	destinations := []modeldto.RequestDestination{{URL: base + "/a", Weight: 1}, {URL: base + "/b", Weight: 3}}
+	served := map[string]bool{base + "/a": true, base + "/b": true}
+	client := resty.New()
+	client.SetRedirectPolicy(resty.RedirectPolicyFunc(func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	}))
+	shorten := func(t *testing.T, request modeldto.RequestURL) string {
+		reqBody, _ := json.Marshal(request)
+		res, err := client.R().SetHeader("Content-Type", "application/json").SetBody(reqBody).Post(suite.ts.URL + "/api/shorten")
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		if !assert.Equal(t, 201, res.StatusCode()) {
+			return ""
+		}
+		var response modeldto.ResponseURL
+		_ = json.Unmarshal(res.Body(), &response)
+		return strings.TrimPrefix(response.SURL, suite.cfg.ServerConfig.BaseURL+"/")
+	}
+
+	suite.T().Run("Random destinations", func(t *testing.T) {
+		sURL := shorten(t, modeldto.RequestURL{Destinations: destinations})
+		for i := 0; i < 20; i++ {
+			res, err := client.R().Get(suite.ts.URL + "/" + sURL)
+			if err != nil {
+				t.Fatalf(err.Error())
+			}
+			assert.Equal(t, 307, res.StatusCode())
+			assert.True(t, served[res.Header().Get("Location")], res.Header().Get("Location"))
+		}
+		res, err := client.R().Get(suite.ts.URL + "/api/urls/" + sURL + "/stats")
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		var stats modeldto.ResponseURLStats
+		_ = json.Unmarshal(res.Body(), &stats)
+		total := 0
+		for _, clicks := range stats.ClicksPerDestination {
+			assert.True(t, served[clicks.URL], clicks.URL)
+			total += clicks.Clicks
+		}
+		assert.Equal(t, 20, total)
+	})
+	suite.T().Run("Sticky destinations", func(t *testing.T) {
+		sURL := shorten(t, modeldto.RequestURL{URL: base + "/c", Destinations: []modeldto.RequestDestination{{URL: base + "/c", Weight: 1}, {URL: base + "/d", Weight: 1}}, Sticky: true})
+		// the client keeps the user cookie set by the first response
+		var first string
+		for i := 0; i < 10; i++ {
+			res, err := client.R().Get(suite.ts.URL + "/" + sURL)
+			if err != nil {
+				t.Fatalf(err.Error())
+			}
+			assert.Equal(t, 307, res.StatusCode())
+			if i == 0 {
+				first = res.Header().Get("Location")
+			}
+			assert.Equal(t, first, res.Header().Get("Location"))
+		}
+	})
+
+	// set tests' parameters
+	tests := []struct {
+		name    string
+		request modeldto.RequestURL
+	}{
+		{name: "Single destination", request: modeldto.RequestURL{Destinations: destinations[:1]}},
+		{name: "Zero weight", request: modeldto.RequestURL{Destinations: []modeldto.RequestDestination{destinations[0], {URL: base + "/e"}}}},
+		{name: "Duplicate destinations", request: modeldto.RequestURL{Destinations: []modeldto.RequestDestination{destinations[0], destinations[0]}}},
+		{name: "URL differs from the first destination", request: modeldto.RequestURL{URL: base + "/f", Destinations: destinations}},
+		{name: "Invalid destination", request: modeldto.RequestURL{Destinations: []modeldto.RequestDestination{destinations[0], {URL: "not a URL", Weight: 1}}}},
+	}
+
+	// perform each test
+	for _, tt := range tests {
+		suite.T().Run(tt.name, func(t *testing.T) {
+			reqBody, _ := json.Marshal(tt.request)
+			res, err := client.R().SetHeader("Content-Type", "application/json").SetBody(reqBody).Post(suite.ts.URL + "/api/shorten")
+			if err != nil {
+				t.Fatalf(err.Error())
+			}
+			assert.Equal(t, 400, res.StatusCode())
+		})
+	}
+	defer suite.ts.Close()
+	suite.cancel()
+	suite.wg.Wait()
+}
+
+func (suite *HandlersTestSuite) TestHandleGetURLGeoTargets() {
+	suite.router.Use(suite.cookieHandler.CookieHandle)
+	suite.router.Post("/api/shorten", suite.urlHandler.JSONHandlePostURL())
+	suite.router.Get("/{urlID}", suite.urlHandler.HandleGetURL())
+	URL := "https://www.yandex.com/" + uuid.New().String()
+	client := resty.New()
+	client.SetRedirectPolicy(resty.RedirectPolicyFunc(func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	}))
+
+	// set tests' parameters
+	tests := []struct {
+		name       string
+		geoTargets map[string]string
+		code       int
+	}{
+		{name: "Valid targets", geoTargets: map[string]string{"de": URL + "/de", "FR": URL + "/fr"}, code: 201},
+		{name: "Invalid country code", geoTargets: map[string]string{"DEU": URL + "/de"}, code: 400},
+		{name: "Same country twice", geoTargets: map[string]string{"de": URL + "/de", "DE": URL + "/de"}, code: 400},
+		{name: "Invalid URL", geoTargets: map[string]string{"DE": "not a URL"}, code: 400},
+	}
+
+	// perform each test
+	for i, tt := range tests {
+		suite.T().Run(tt.name, func(t *testing.T) {
+			reqBody, _ := json.Marshal(modeldto.RequestURL{URL: fmt.Sprintf("%s/%d", URL, i), GeoTargets: tt.geoTargets})
+			res, err := client.R().SetHeader("Content-Type", "application/json").SetBody(reqBody).Post(suite.ts.URL + "/api/shorten")
+			if err != nil {
+				t.Fatalf(err.Error())
+			}
+			assert.Equal(t, tt.code, res.StatusCode())
+			if tt.code != 201 {
+				return
+			}
+			// countries are not resolved without a GeoIP database, so the default URL is served
+			var response modeldto.ResponseURL
+			_ = json.Unmarshal(res.Body(), &response)
+			sURL := strings.TrimPrefix(response.SURL, suite.cfg.ServerConfig.BaseURL+"/")
+			res, err = client.R().SetHeader("X-Real-IP", "81.169.145.1").Get(suite.ts.URL + "/" + sURL)
+			if err != nil {
+				t.Fatalf(err.Error())
+			}
+			assert.Equal(t, 307, res.StatusCode())
+			assert.Equal(t, fmt.Sprintf("%s/%d", URL, i), res.Header().Get("Location"))
+		})
+	}
+	defer suite.ts.Close()
+	suite.cancel()
+	suite.wg.Wait()
+}
+
+func (suite *HandlersTestSuite) TestHandleGetURLDeviceTargets() {
+	suite.router.Use(suite.cookieHandler.CookieHandle)
+	suite.router.Post("/api/shorten", suite.urlHandler.JSONHandlePostURL())
+	suite.router.Get("/{urlID}", suite.urlHandler.HandleGetURL())
+	URL := "https://www.yandex.com/" + uuid.New().String()
+	client := resty.New()
+	client.SetRedirectPolicy(resty.RedirectPolicyFunc(func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	}))
+	deviceTargets := map[string]string{"iOS": URL + "/ios", "android": URL + "/android", "desktop": URL + "/desktop"}
+
+	// invalid targets are rejected
+	for _, targets := range []map[string]string{{"tablet": URL + "/tablet"}, {"ios": URL + "/ios", "IOS": URL + "/ios"}} {
+		reqBody, _ := json.Marshal(modeldto.RequestURL{URL: URL, DeviceTargets: targets})
+		res, err := client.R().SetHeader("Content-Type", "application/json").SetBody(reqBody).Post(suite.ts.URL + "/api/shorten")
+		suite.NoError(err)
+		suite.Equal(400, res.StatusCode())
+	}
+	reqBody, _ := json.Marshal(modeldto.RequestURL{URL: URL, DeviceTargets: deviceTargets})
+	res, err := client.R().SetHeader("Content-Type", "application/json").SetBody(reqBody).Post(suite.ts.URL + "/api/shorten")
+	suite.NoError(err)
+	suite.Equal(201, res.StatusCode())
+	var response modeldto.ResponseURL
+	_ = json.Unmarshal(res.Body(), &response)
+	sURL := strings.TrimPrefix(response.SURL, suite.cfg.ServerConfig.BaseURL+"/")
+
+	// set tests' parameters
+	tests := []struct {
+		name      string
+		userAgent string
+		location  string
+	}{
+		{name: "iPhone", userAgent: "Mozilla/5.0 (iPhone; CPU iPhone OS 17_0 like Mac OS X) AppleWebKit/605.1.15 Mobile/15E148", location: URL + "/ios"},
+		{name: "Android", userAgent: "Mozilla/5.0 (Linux; Android 14; Pixel 8) AppleWebKit/537.36 Chrome/120.0 Mobile Safari/537.36", location: URL + "/android"},
+		{name: "Desktop", userAgent: "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 Chrome/120.0 Safari/537.36", location: URL + "/desktop"},
+		{name: "Other mobile", userAgent: "Mozilla/5.0 (Mobile; rv:48.0) Gecko/48.0 Firefox/48.0 KAIOS/2.5", location: URL},
+	}
+
+	// perform each test
+	for _, tt := range tests {
+		suite.T().Run(tt.name, func(t *testing.T) {
+			res, err := client.R().SetHeader("User-Agent", tt.userAgent).Get(suite.ts.URL + "/" + sURL)
+			if err != nil {
+				t.Fatalf(err.Error())
+			}
+			assert.Equal(t, 307, res.StatusCode())
+			assert.Equal(t, tt.location, res.Header().Get("Location"))
+		})
+	}
+	defer suite.ts.Close()
+	suite.cancel()
+	suite.wg.Wait()
+}
+
+func (suite *HandlersTestSuite) TestHandleGetURLUTM() {
+	suite.router.Use(suite.cookieHandler.CookieHandle)
+	suite.router.Post("/api/shorten", suite.urlHandler.JSONHandlePostURL())
+	suite.router.Get("/api/user/utm", suite.urlHandler.HandleGetUTMDefaults())
+	suite.router.Put("/api/user/utm", suite.urlHandler.HandleSetUTMDefaults())
+	suite.router.Get("/{urlID}", suite.urlHandler.HandleGetURL())
+	URL := "https://www.yandex.com/" + uuid.New().String()
+	client := resty.New()
+	client.SetRedirectPolicy(resty.RedirectPolicyFunc(func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	}))
+	shorten := func(URL string, utm map[string]string) (string, int) {
+		reqBody, _ := json.Marshal(modeldto.RequestURL{URL: URL, UTM: utm})
+		res, err := client.R().SetHeader("Content-Type", "application/json").SetBody(reqBody).Post(suite.ts.URL + "/api/shorten")
+		suite.Require().NoError(err)
+		var response modeldto.ResponseURL
+		_ = json.Unmarshal(res.Body(), &response)
+		return strings.TrimPrefix(response.SURL, suite.cfg.ServerConfig.BaseURL+"/"), res.StatusCode()
+	}
+	location := func(sURL string) string {
+		res, err := client.R().Get(suite.ts.URL + "/" + sURL)
+		suite.Require().NoError(err)
+		suite.Require().Equal(307, res.StatusCode())
+		return res.Header().Get("Location")
+	}
+
+	// invalid parameters are rejected
+	for _, utm := range []map[string]string{{"utm_foo": "bar"}, {"utm_source": " "}, {"utm_source": "a", "UTM_SOURCE": "b"}} {
+		_, code := shorten(URL, utm)
+		suite.Equal(400, code)
+	}
+	res, err := client.R().SetHeader("Content-Type", "application/json").SetBody(`{"ref": "x"}`).Put(suite.ts.URL + "/api/user/utm")
+	suite.Require().NoError(err)
+	suite.Equal(400, res.StatusCode())
+
+	// parameters are appended to the destination keeping the ones it already sets and its fragment
+	sURL, code := shorten(URL+"?utm_source=site&q=a+b#top", map[string]string{"UTM_Source": "newsletter", "utm_medium": "email"})
+	suite.Require().Equal(201, code)
+	suite.Equal(URL+"?utm_source=site&q=a+b&utm_medium=email#top", location(sURL))
+
+	// links without their own parameters are given the user defaults existing at creation
+	res, err = client.R().Get(suite.ts.URL + "/api/user/utm")
+	suite.Require().NoError(err)
+	suite.Equal(200, res.StatusCode())
+	suite.JSONEq(`{}`, string(res.Body()))
+	untagged, code := shorten(URL+"/untagged", nil)
+	suite.Require().Equal(201, code)
+	res, err = client.R().SetHeader("Content-Type", "application/json").SetBody(`{"utm_source": "twitter", "utm_campaign": "spring sale"}`).Put(suite.ts.URL + "/api/user/utm")
+	suite.Require().NoError(err)
+	suite.Equal(204, res.StatusCode())
+	res, err = client.R().Get(suite.ts.URL + "/api/user/utm")
+	suite.Require().NoError(err)
+	suite.JSONEq(`{"utm_source": "twitter", "utm_campaign": "spring sale"}`, string(res.Body()))
+	defaulted, code := shorten(URL+"/defaulted", nil)
+	suite.Require().Equal(201, code)
+	suite.Equal(URL+"/defaulted?utm_campaign=spring+sale&utm_source=twitter", location(defaulted))
+	suite.Equal(URL+"/untagged", location(untagged))
+	defer suite.ts.Close()
+	suite.cancel()
+	suite.wg.Wait()
+}
+
+func (suite *HandlersTestSuite) TestHandleGetURLPreview() {
+	userID := suite.secretaryService.Encode(uuid.New().String())
+	URL := "https://www.yandex.by/" + uuid.New().String() + "?q=<b>"
+	sURL, _ := suite.shortenerService.Encode(suite.ctx, URL, userID, modelurl.ShortenOptions{})
+	previewHandler, _ := InitPreviewHandler(suite.shortenerService, suite.cfg.ServerConfig, nil, nil)
+	suite.router.Get("/{urlID}", previewHandler.WithPreviewQuery(suite.urlHandler.HandleGetURL()))
+	suite.router.Get("/{urlID}+", previewHandler.HandleGetURLPreview())
+	client := resty.New()
+	client.SetRedirectPolicy(resty.RedirectPolicyFunc(func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	}))
+
+	// set tests' parameters
+	type want struct {
+		code    int
+		preview bool
+	}
+	tests := []struct {
+		name string
+		path string
+		want want
+	}{
+		{name: "Preview route", path: "/" + sURL + "+", want: want{code: 200, preview: true}},
+		{name: "Preview query", path: "/" + sURL + "?preview=1", want: want{code: 200, preview: true}},
+		{name: "Redirect without preview", path: "/" + sURL, want: want{code: 307}},
+		{name: "Preview of a missing short URL", path: "/missing+", want: want{code: 404}},
+	}
+
+	// perform each test
+	for _, tt := range tests {
+		suite.T().Run(tt.name, func(t *testing.T) {
+			res, err := client.R().Get(suite.ts.URL + tt.path)
+			if err != nil {
+				t.Fatalf(err.Error())
+			}
+			assert.Equal(t, tt.want.code, res.StatusCode())
+			if tt.want.preview {
+				assert.Equal(t, "text/html; charset=utf-8", res.Header().Get("Content-Type"))
+				assert.Contains(t, res.String(), "www.yandex.by")
+				// the destination is escaped and the continue button follows the short URL
+				assert.Contains(t, res.String(), "?q=&lt;b&gt;")
+				assert.Contains(t, res.String(), `href="`+suite.cfg.ServerConfig.BaseURL+"/"+sURL+`"`)
+			}
+		})
+	}
+	defer suite.ts.Close()
+	suite.cancel()
+	suite.wg.Wait()
+}
+
+func (suite *HandlersTestSuite) TestHandleGetURLQR() {
+	userID := suite.secretaryService.Encode(uuid.New().String())
+	sURL, _ := suite.shortenerService.Encode(suite.ctx, "https://www.yandex.by", userID, modelurl.ShortenOptions{})
+	suite.router.Get("/{urlID}/qr", suite.urlHandler.HandleGetURLQR())
+	client := resty.New()
+
+	// set tests' parameters
+	type want struct {
+		code        int
+		contentType string
+	}
+	tests := []struct {
+		name  string
+		sURL  string
+		query string
+		want  want
+	}{
+		{
+			name: "Correct GET QR code query with defaults",
+			sURL: sURL,
+			want: want{
+				code:        200,
+				contentType: "image/png",
+			},
+		},
+		{
+			name:  "Correct GET QR code query for SVG",
+			sURL:  sURL,
+			query: "size=512&level=H&format=svg",
+			want: want{
+				code:        200,
+				contentType: "image/svg+xml",
+			},
+		},
+		{
+			name:  "GET QR code query with invalid size",
+			sURL:  sURL,
+			query: "size=10",
+			want: want{
+				code: 400,
+			},
+		},
+		{
+			name:  "GET QR code query with invalid level",
+			sURL:  sURL,
+			query: "level=X",
+			want: want{
+				code: 400,
+			},
+		},
+		{
+			name:  "GET QR code query with invalid format",
+			sURL:  sURL,
+			query: "format=gif",
+			want: want{
+				code: 400,
+			},
+		},
+		{
+			name: "GET QR code query for unknown URL",
+			sURL: "unknown-" + uuid.New().String()[:8],
+			want: want{
+				code: 404,
+			},
+		},
+	}
+
+	// perform each test
+	for _, tt := range tests {
+		suite.T().Run(tt.name, func(t *testing.T) {
+			res, err := client.R().SetPathParams(map[string]string{"urlID": tt.sURL}).SetQueryString(tt.query).Get(suite.ts.URL + "/{urlID}/qr")
+			if err != nil {
+				t.Fatalf(err.Error())
+			}
+			assert.Equal(t, tt.want.code, res.StatusCode())
+			if tt.want.code == 200 {
+				assert.Equal(t, tt.want.contentType, res.Header().Get("Content-Type"))
+				assert.NotEmpty(t, res.Body())
+			}
+		})
+	}
+	defer suite.ts.Close()
+	suite.cancel()
+	suite.wg.Wait()
+}
+
+func (suite *HandlersTestSuite) TestUserAuthentication() {
+	authenticatorService, _ := authenticator.InitAuthenticator(suite.storage, suite.cfg.SecretConfig)
+	authHandler, _ := middleware.NewAuthHandler(authenticatorService)
+	userHandler, _ := InitUserHandler(authenticatorService, nil)
+	suite.router.Use(authHandler.AuthHandle)
+	suite.router.Use(suite.cookieHandler.CookieHandle)
+	suite.router.Post("/api/user/register", userHandler.HandleRegister())
+	suite.router.Post("/api/user/login", userHandler.HandleLogin())
+	suite.router.Get("/api/user/urls", suite.urlHandler.HandleGetURLsByUserID())
+	// create a link as an anonymous cookie user who registers afterwards
+	cookieUserID := suite.secretaryService.Encode(uuid.New().String())
+	_, _ = suite.shortenerService.Encode(suite.ctx, "https://www.yandex.by/"+uuid.New().String(), cookieUserID, modelurl.ShortenOptions{})
+	login := "user-" + uuid.New().String()[:8]
+	password := "correct horse"
+
+	// set tests' parameters
+	type want struct {
+		code int
+	}
+	tests := []struct {
+		name     string
+		endpoint string
+		login    string
+		password string
+		want     want
+	}{
+		{
+			name:     "Correct registration",
+			endpoint: "/api/user/register",
+			login:    login,
+			password: password,
+			want: want{
+				code: 201,
+			},
+		},
+		{
+			name:     "Registration with a taken login",
+			endpoint: "/api/user/register",
+			login:    login,
+			password: password,
+			want: want{
+				code: 409,
+			},
+		},
+		{
+			name:     "Registration with a short password",
+			endpoint: "/api/user/register",
+			login:    "user-" + uuid.New().String()[:8],
+			password: "short",
+			want: want{
+				code: 400,
+			},
+		},
+		{
+			name:     "Correct login",
+			endpoint: "/api/user/login",
+			login:    login,
+			password: password,
+			want: want{
+				code: 200,
+			},
+		},
+		{
+			name:     "Login with a wrong password",
+			endpoint: "/api/user/login",
+			login:    login,
+			password: "wrong password",
+			want: want{
+				code: 401,
+			},
+		},
+		{
+			name:     "Login with an unknown login",
+			endpoint: "/api/user/login",
+			login:    "user-" + uuid.New().String()[:8],
+			password: password,
+			want: want{
+				code: 401,
+			},
+		},
+	}
+
+	// perform each test
+	var token string
+	for _, tt := range tests {
+		suite.T().Run(tt.name, func(t *testing.T) {
+			client := resty.New()
+			client.SetCookie(&http.Cookie{
+				Name:  "user",
+				Value: cookieUserID,
+				Path:  "/",
+			})
+			res, err := client.R().
+				SetHeader("Content-Type", "application/json").
+				SetBody(modeldto.RequestCredentials{Login: tt.login, Password: tt.password}).
+				Post(suite.ts.URL + tt.endpoint)
+			if err != nil {
+				t.Fatalf(err.Error())
+			}
+			assert.Equal(t, tt.want.code, res.StatusCode())
+			if res.StatusCode() == 200 || res.StatusCode() == 201 {
+				var response modeldto.ResponseToken
+				err = json.Unmarshal(res.Body(), &response)
+				if err != nil {
+					t.Fatalf(err.Error())
+				}
+				assert.Equal(t, "Bearer "+response.Token, res.Header().Get("Authorization"))
+				token = response.Token
+			}
+		})
+	}
+
+	// the access token resolves to the registering cookie user and keeps their links
+	suite.T().Run("Links are available with access token", func(t *testing.T) {
+		res, err := resty.New().R().SetAuthToken(token).Get(suite.ts.URL + "/api/user/urls")
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		assert.Equal(t, 200, res.StatusCode())
+		assert.Empty(t, res.Cookies())
+	})
+	suite.T().Run("Invalid access token is rejected", func(t *testing.T) {
+		res, err := resty.New().R().SetAuthToken(token + "x").Get(suite.ts.URL + "/api/user/urls")
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		assert.Equal(t, 401, res.StatusCode())
+	})
+	defer suite.ts.Close()
+	suite.cancel()
+	suite.wg.Wait()
+}
+
+func (suite *HandlersTestSuite) TestAPIKeys() {
+	authenticatorService, _ := authenticator.InitAuthenticator(suite.storage, suite.cfg.SecretConfig)
+	authHandler, _ := middleware.NewAuthHandler(authenticatorService)
+	userHandler, _ := InitUserHandler(authenticatorService, nil)
+	suite.router.Use(authHandler.AuthHandle)
+	suite.router.Use(suite.cookieHandler.CookieHandle)
+	suite.router.Post("/api/keys", userHandler.HandleCreateAPIKey())
+	suite.router.Get("/api/keys", userHandler.HandleListAPIKeys())
+	suite.router.Delete("/api/keys/{keyID}", userHandler.HandleRevokeAPIKey())
+	suite.router.Get("/api/user/urls", suite.urlHandler.HandleGetURLsByUserID())
+	// create a link as a cookie user who mints an API key afterwards
+	cookieUserID := suite.secretaryService.Encode(uuid.New().String())
+	sURL, _ := suite.shortenerService.Encode(suite.ctx, "https://www.yandex.by/"+uuid.New().String(), cookieUserID, modelurl.ShortenOptions{})
+	client := resty.New()
+	client.SetCookie(&http.Cookie{
+		Name:  "user",
+		Value: cookieUserID,
+		Path:  "/",
+	})
+
+	var created modeldto.ResponseAPIKey
+	suite.T().Run("Create API key", func(t *testing.T) {
+		res, err := client.R().
+			SetHeader("Content-Type", "application/json").
+			SetBody(modeldto.RequestAPIKey{Name: "ci"}).
+			Post(suite.ts.URL + "/api/keys")
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		assert.Equal(t, 201, res.StatusCode())
+		err = json.Unmarshal(res.Body(), &created)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		assert.Equal(t, "ci", created.Name)
+		assert.True(t, strings.HasPrefix(created.Key, "usk_"))
+		assert.Equal(t, created.Key[:len(created.Prefix)], created.Prefix)
+	})
+	suite.T().Run("Create API key with a long name", func(t *testing.T) {
+		res, err := client.R().
+			SetHeader("Content-Type", "application/json").
+			SetBody(modeldto.RequestAPIKey{Name: strings.Repeat("a", 65)}).
+			Post(suite.ts.URL + "/api/keys")
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		assert.Equal(t, 400, res.StatusCode())
+	})
+	suite.T().Run("List API keys", func(t *testing.T) {
+		res, err := client.R().Get(suite.ts.URL + "/api/keys")
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		assert.Equal(t, 200, res.StatusCode())
+		var response []modeldto.ResponseAPIKey
+		err = json.Unmarshal(res.Body(), &response)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		if assert.Len(t, response, 1) {
+			assert.Equal(t, created.ID, response[0].ID)
+			assert.Empty(t, response[0].Key)
+			assert.Nil(t, response[0].RevokedAt)
+		}
+	})
+	// the API key resolves to the cookie user and acts on their links
+	suite.T().Run("Links are available with API key", func(t *testing.T) {
+		res, err := resty.New().R().SetAuthToken(created.Key).Get(suite.ts.URL + "/api/user/urls")
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		assert.Equal(t, 200, res.StatusCode())
+		assert.Contains(t, res.String(), sURL)
+		assert.Empty(t, res.Cookies())
+	})
+	suite.T().Run("Revoke API key of another user", func(t *testing.T) {
+		res, err := resty.New().R().Delete(suite.ts.URL + "/api/keys/" + created.ID)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		assert.Equal(t, 404, res.StatusCode())
+	})
+	suite.T().Run("Revoke API key", func(t *testing.T) {
+		res, err := client.R().Delete(suite.ts.URL + "/api/keys/" + created.ID)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		assert.Equal(t, 204, res.StatusCode())
+	})
+	suite.T().Run("Revoked API key is rejected", func(t *testing.T) {
+		res, err := resty.New().R().SetAuthToken(created.Key).Get(suite.ts.URL + "/api/user/urls")
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		assert.Equal(t, 401, res.StatusCode())
+	})
+	suite.T().Run("Unknown API key is rejected", func(t *testing.T) {
+		res, err := resty.New().R().SetAuthToken("usk_unknown").Get(suite.ts.URL + "/api/user/urls")
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		assert.Equal(t, 401, res.StatusCode())
+	})
+	defer suite.ts.Close()
+	suite.cancel()
+	suite.wg.Wait()
+}
+
+func (suite *HandlersTestSuite) TestDomains() {
+	suite.router.Use(suite.cookieHandler.CookieHandle)
+	suite.router.Post("/api/shorten", suite.urlHandler.JSONHandlePostURL())
+	suite.router.Get("/{urlID}", suite.urlHandler.HandleGetURL())
+	suite.router.Post("/api/user/domains", suite.urlHandler.HandleAddDomain())
+	suite.router.Get("/api/user/domains", suite.urlHandler.HandleListDomains())
+	suite.router.Post("/api/user/domains/{domain}/verify", suite.urlHandler.HandleVerifyDomain())
+	// TXT records are served by the test instead of DNS
+	records := make(map[string][]string)
+	suite.shortenerService.(*shortener.Shortener).SetTXTLookup(func(ctx context.Context, name string) ([]string, error) {
+		return records[name], nil
+	})
+	domain := "go-" + uuid.New().String()[:8] + ".example.com"
+	URL := "https://www.yandex.com/" + uuid.New().String()
+	rawUserID := uuid.New().String()
+	userID := suite.secretaryService.Encode(rawUserID)
+	client := resty.New()
+	client.SetCookie(&http.Cookie{
+		Name:  "user",
+		Value: userID,
+		Path:  "/",
+	})
+	other := resty.New()
+	other.SetCookie(&http.Cookie{
+		Name:  "user",
+		Value: suite.secretaryService.Encode(uuid.New().String()),
+		Path:  "/",
+	})
+
+	var added modeldto.ResponseDomain
+	suite.T().Run("Add domain", func(t *testing.T) {
+		res, err := client.R().
+			SetHeader("Content-Type", "application/json").
+			SetBody(modeldto.RequestDomain{Name: strings.ToUpper(domain) + "."}).
+			Post(suite.ts.URL + "/api/user/domains")
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		assert.Equal(t, 201, res.StatusCode())
+		err = json.Unmarshal(res.Body(), &added)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		assert.Equal(t, domain, added.Name)
+		assert.Equal(t, "_shortener-verify."+domain, added.VerificationRecord)
+		assert.Nil(t, added.VerifiedAt)
+	})
+	suite.T().Run("Add invalid domain", func(t *testing.T) {
+		for _, name := range []string{"localhost", "127.0.0.1", "bad_label.example.com", ""} {
+			res, err := client.R().
+				SetHeader("Content-Type", "application/json").
+				SetBody(modeldto.RequestDomain{Name: name}).
+				Post(suite.ts.URL + "/api/user/domains")
+			if err != nil {
+				t.Fatalf(err.Error())
+			}
+			assert.Equal(t, 400, res.StatusCode(), name)
+		}
+	})
+	suite.T().Run("Add domain twice", func(t *testing.T) {
+		res, err := client.R().
+			SetHeader("Content-Type", "application/json").
+			SetBody(modeldto.RequestDomain{Name: domain}).
+			Post(suite.ts.URL + "/api/user/domains")
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		assert.Equal(t, 409, res.StatusCode())
+	})
+	// unverified domains may be claimed by several users
+	var claimed modeldto.ResponseDomain
+	suite.T().Run("Add domain claimed by another user", func(t *testing.T) {
+		res, err := other.R().
+			SetHeader("Content-Type", "application/json").
+			SetBody(modeldto.RequestDomain{Name: domain}).
+			Post(suite.ts.URL + "/api/user/domains")
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		assert.Equal(t, 201, res.StatusCode())
+		err = json.Unmarshal(res.Body(), &claimed)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		assert.NotEqual(t, added.VerificationValue, claimed.VerificationValue)
+	})
+	suite.T().Run("Shorten on unverified domain", func(t *testing.T) {
+		res, err := client.R().
+			SetHeader("Content-Type", "application/json").
+			SetBody(modeldto.RequestURL{URL: URL, Domain: domain}).
+			Post(suite.ts.URL + "/api/shorten")
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		assert.Equal(t, 400, res.StatusCode())
+	})
+	suite.T().Run("Verify domain without TXT record", func(t *testing.T) {
+		res, err := client.R().Post(suite.ts.URL + "/api/user/domains/" + domain + "/verify")
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		assert.Equal(t, 422, res.StatusCode())
+	})
+	suite.T().Run("Verify domain of another user", func(t *testing.T) {
+		res, err := resty.New().R().Post(suite.ts.URL + "/api/user/domains/" + domain + "/verify")
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		assert.Equal(t, 404, res.StatusCode())
+	})
+	suite.T().Run("Verify domain", func(t *testing.T) {
+		records[added.VerificationRecord] = []string{"unrelated", added.VerificationValue}
+		res, err := client.R().Post(suite.ts.URL + "/api/user/domains/" + domain + "/verify")
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		assert.Equal(t, 200, res.StatusCode())
+		var response []modeldto.ResponseDomain
+		res, err = client.R().Get(suite.ts.URL + "/api/user/domains")
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		err = json.Unmarshal(res.Body(), &response)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		if assert.Len(t, response, 1) {
+			assert.Equal(t, domain, response[0].Name)
+			assert.NotNil(t, response[0].VerifiedAt)
+		}
+	})
+	// claims of other users are dropped once the domain is verified
+	suite.T().Run("Verify domain claimed by another user", func(t *testing.T) {
+		records[claimed.VerificationRecord] = append(records[claimed.VerificationRecord], claimed.VerificationValue)
+		res, err := other.R().Post(suite.ts.URL + "/api/user/domains/" + domain + "/verify")
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		assert.Equal(t, 404, res.StatusCode())
+		res, err = other.R().Get(suite.ts.URL + "/api/user/domains")
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		assert.NotContains(t, string(res.Body()), domain)
+	})
+	suite.T().Run("Add verified domain of another user", func(t *testing.T) {
+		res, err := other.R().
+			SetHeader("Content-Type", "application/json").
+			SetBody(modeldto.RequestDomain{Name: domain}).
+			Post(suite.ts.URL + "/api/user/domains")
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		assert.Equal(t, 409, res.StatusCode())
+	})
+	suite.T().Run("Expired claim", func(t *testing.T) {
+		expired := "go-" + uuid.New().String()[:8] + ".example.com"
+		err := suite.storage.DumpDomain(suite.ctx, modelstorage.DomainEntry{
+			Name:      expired,
+			UserID:    rawUserID,
+			Token:     "expired",
+			CreatedAt: time.Now().Add(-suite.cfg.StorageConfig.DomainClaimTTL),
+		})
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		res, err := client.R().Get(suite.ts.URL + "/api/user/domains")
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		assert.NotContains(t, string(res.Body()), expired)
+		res, err = client.R().Post(suite.ts.URL + "/api/user/domains/" + expired + "/verify")
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		assert.Equal(t, 404, res.StatusCode())
+		// the expired claim no longer holds the domain
+		res, err = client.R().
+			SetHeader("Content-Type", "application/json").
+			SetBody(modeldto.RequestDomain{Name: expired}).
+			Post(suite.ts.URL + "/api/user/domains")
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		assert.Equal(t, 201, res.StatusCode())
+	})
+
+	// links of the domain are only served on it
+	var sURL string
+	suite.T().Run("Shorten on verified domain", func(t *testing.T) {
+		res, err := client.R().
+			SetHeader("Content-Type", "application/json").
+			SetBody(modeldto.RequestURL{URL: URL, Domain: domain}).
+			Post(suite.ts.URL + "/api/shorten")
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		assert.Equal(t, 201, res.StatusCode())
+		var response modeldto.ResponseURL
+		err = json.Unmarshal(res.Body(), &response)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		assert.True(t, strings.HasPrefix(response.SURL, "http://"+domain+"/"), response.SURL)
+		sURL = strings.TrimPrefix(response.SURL, "http://"+domain+"/")
+	})
+	noRedirect := &http.Client{CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	tests := []struct {
+		name string
+		host string
+		code int
+	}{
+		{name: "Redirect on domain", host: domain, code: 307},
+		{name: "Redirect on domain with port", host: strings.ToUpper(domain) + ":8080", code: 307},
+		{name: "Redirect on base URL host", host: "localhost:8080", code: 404},
+	}
+	for _, tt := range tests {
+		suite.T().Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodGet, suite.ts.URL+"/"+sURL, nil)
+			if err != nil {
+				t.Fatalf(err.Error())
+			}
+			req.Host = tt.host
+			res, err := noRedirect.Do(req)
+			if err != nil {
+				t.Fatalf(err.Error())
+			}
+			_ = res.Body.Close()
+			assert.Equal(t, tt.code, res.StatusCode)
+			if tt.code == 307 {
+				assert.Equal(t, URL, res.Header.Get("Location"))
+			}
+		})
+	}
+	defer suite.ts.Close()
+	suite.cancel()
+	suite.wg.Wait()
+}
+
+func (suite *HandlersTestSuite) TestOrgs() {
+	suite.router.Use(suite.cookieHandler.CookieHandle)
+	suite.router.Post("/api/shorten", suite.urlHandler.JSONHandlePostURL())
+	suite.router.Post("/api/orgs", suite.urlHandler.HandleCreateOrg())
+	suite.router.Get("/api/orgs", suite.urlHandler.HandleListOrgs())
+	suite.router.Get("/api/orgs/{orgID}/members", suite.urlHandler.HandleListMembers())
+	suite.router.Post("/api/orgs/{orgID}/members", suite.urlHandler.HandleSetMember())
+	suite.router.Delete("/api/orgs/{orgID}/members/{userID}", suite.urlHandler.HandleRemoveMember())
+	suite.router.Get("/api/orgs/{orgID}/urls", suite.urlHandler.HandleGetURLsByOrgID())
+	// members are added by logins of registered users
+	clients := make(map[string]*resty.Client)
+	userIDs := make(map[string]string)
+	logins := make(map[string]string)
+	for _, name := range []string{"admin", "member", "outsider"} {
+		userIDs[name] = suite.secretaryService.Encode(uuid.New().String())
+		logins[name] = name + "-" + uuid.New().String()[:8]
+		err := suite.storage.DumpUser(suite.ctx, modelstorage.UserEntry{Login: logins[name], PasswordHash: "-", UserID: userIDs[name]})
+		if err != nil {
+			suite.T().Fatalf(err.Error())
+		}
+		clients[name] = resty.New()
+		clients[name].SetCookie(&http.Cookie{
+			Name:  "user",
+			Value: userIDs[name],
+			Path:  "/",
+		})
+	}
+
+	var org modeldto.ResponseOrg
+	suite.T().Run("Create org", func(t *testing.T) {
+		res, err := clients["admin"].R().
+			SetHeader("Content-Type", "application/json").
+			SetBody(modeldto.RequestOrg{Name: " Marketing "}).
+			Post(suite.ts.URL + "/api/orgs")
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		assert.Equal(t, 201, res.StatusCode())
+		err = json.Unmarshal(res.Body(), &org)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		assert.Equal(t, "Marketing", org.Name)
+		assert.Equal(t, modelurl.RoleAdmin, org.Role)
+	})
+	suite.T().Run("Create org without a name", func(t *testing.T) {
+		res, err := clients["admin"].R().
+			SetHeader("Content-Type", "application/json").
+			SetBody(modeldto.RequestOrg{Name: " "}).
+			Post(suite.ts.URL + "/api/orgs")
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		assert.Equal(t, 400, res.StatusCode())
+	})
+
+	tests := []struct {
+		name   string
+		client string
+		login  string
+		role   string
+		code   int
+	}{
+		{name: "Add member", client: "admin", login: logins["member"], code: 200},
+		{name: "Add unregistered user", client: "admin", login: "nobody-" + uuid.New().String(), code: 400},
+		{name: "Add member with unknown role", client: "admin", login: logins["outsider"], role: "owner", code: 400},
+		{name: "Add member as a member", client: "member", login: logins["outsider"], code: 403},
+		{name: "Add member as an outsider", client: "outsider", login: logins["outsider"], code: 403},
+		{name: "Demote the last admin", client: "admin", login: logins["admin"], role: modelurl.RoleMember, code: 400},
+	}
+	for _, tt := range tests {
+		suite.T().Run(tt.name, func(t *testing.T) {
+			res, err := clients[tt.client].R().
+				SetHeader("Content-Type", "application/json").
+				SetBody(modeldto.RequestMember{Login: tt.login, Role: tt.role}).
+				Post(suite.ts.URL + "/api/orgs/" + org.ID + "/members")
+			if err != nil {
+				t.Fatalf(err.Error())
+			}
+			assert.Equal(t, tt.code, res.StatusCode())
+		})
+	}
+	suite.T().Run("List members", func(t *testing.T) {
+		res, err := clients["member"].R().Get(suite.ts.URL + "/api/orgs/" + org.ID + "/members")
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		assert.Equal(t, 200, res.StatusCode())
+		var members []modeldto.ResponseMember
+		err = json.Unmarshal(res.Body(), &members)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		if assert.Len(t, members, 2) {
+			assert.Equal(t, userIDs["admin"], members[0].UserID)
+			assert.Equal(t, modelurl.RoleAdmin, members[0].Role)
+			assert.Equal(t, logins["member"], members[1].Login)
+			assert.Equal(t, modelurl.RoleMember, members[1].Role)
+		}
+	})
+	suite.T().Run("List orgs", func(t *testing.T) {
+		res, err := clients["member"].R().Get(suite.ts.URL + "/api/orgs")
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		assert.Equal(t, 200, res.StatusCode())
+		var orgs []modeldto.ResponseOrg
+		err = json.Unmarshal(res.Body(), &orgs)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		if assert.Len(t, orgs, 1) {
+			assert.Equal(t, org.ID, orgs[0].ID)
+			assert.Equal(t, modelurl.RoleMember, orgs[0].Role)
+		}
+	})
+
+	// links created in the org are shared with its members only
+	URL := "https://www.yandex.com/" + uuid.New().String()
+	suite.T().Run("Shorten in org as an outsider", func(t *testing.T) {
+		res, err := clients["outsider"].R().
+			SetHeader("Content-Type", "application/json").
+			SetBody(modeldto.RequestURL{URL: URL, Org: org.ID}).
+			Post(suite.ts.URL + "/api/shorten")
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		assert.Equal(t, 403, res.StatusCode())
+	})
+	var shortened modeldto.ResponseURL
+	suite.T().Run("Shorten in org", func(t *testing.T) {
+		res, err := clients["admin"].R().
+			SetHeader("Content-Type", "application/json").
+			SetBody(modeldto.RequestURL{URL: URL, Org: org.ID}).
+			Post(suite.ts.URL + "/api/shorten")
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		assert.Equal(t, 201, res.StatusCode())
+		err = json.Unmarshal(res.Body(), &shortened)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+	})
+	suite.T().Run("List org URLs as a member", func(t *testing.T) {
+		res, err := clients["member"].R().Get(suite.ts.URL + "/api/orgs/" + org.ID + "/urls")
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		assert.Equal(t, 200, res.StatusCode())
+		var URLs []modeldto.ResponseFullURL
+		err = json.Unmarshal(res.Body(), &URLs)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		if assert.Len(t, URLs, 1) {
+			assert.Equal(t, URL, URLs[0].URL)
+			assert.Equal(t, shortened.SURL, URLs[0].SURL)
+		}
+	})
+	suite.T().Run("List org URLs as an outsider", func(t *testing.T) {
+		res, err := clients["outsider"].R().Get(suite.ts.URL + "/api/orgs/" + org.ID + "/urls")
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		assert.Equal(t, 403, res.StatusCode())
+	})
+	suite.T().Run("List URLs of unknown org", func(t *testing.T) {
+		res, err := clients["admin"].R().Get(suite.ts.URL + "/api/orgs/" + uuid.New().String() + "/urls")
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		assert.Equal(t, 404, res.StatusCode())
+	})
+
+	removals := []struct {
+		name   string
+		client string
+		member string
+		code   int
+	}{
+		{name: "Remove the last admin", client: "admin", member: userIDs["admin"], code: 400},
+		{name: "Remove another member as a member", client: "member", member: userIDs["admin"], code: 403},
+		{name: "Remove an outsider", client: "admin", member: userIDs["outsider"], code: 404},
+		{name: "Leave org", client: "member", member: userIDs["member"], code: 204},
+	}
+	for _, tt := range removals {
+		suite.T().Run(tt.name, func(t *testing.T) {
+			res, err := clients[tt.client].R().Delete(suite.ts.URL + "/api/orgs/" + org.ID + "/members/" + tt.member)
+			if err != nil {
+				t.Fatalf(err.Error())
+			}
+			assert.Equal(t, tt.code, res.StatusCode())
+		})
+	}
+	suite.T().Run("List org URLs after leaving", func(t *testing.T) {
+		res, err := clients["member"].R().Get(suite.ts.URL + "/api/orgs/" + org.ID + "/urls")
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		assert.Equal(t, 403, res.StatusCode())
+	})
+	defer suite.ts.Close()
+	suite.cancel()
+	suite.wg.Wait()
+}
+
+func (suite *HandlersTestSuite) TestAdmin() {
+	adminLogin := "admin-" + uuid.New().String()[:8]
+	authenticatorService, _ := authenticator.InitAuthenticator(suite.storage, suite.cfg.SecretConfig)
+	authHandler, _ := middleware.NewAuthHandler(authenticatorService)
+	suite.router.Use(authHandler.AuthHandle)
+	suite.router.Use(suite.cookieHandler.CookieHandle)
+	suite.router.With(authHandler.RequireAdmin).Get("/api/admin/urls", suite.urlHandler.HandleSearchURLs())
+	suite.router.With(authHandler.RequireAdmin).Post("/api/admin/urls/disable", suite.urlHandler.HandleDisableURLBatch())
+	suite.router.With(authHandler.RequireAdmin).Get("/api/admin/users", suite.urlHandler.HandleListUsers())
+	suite.router.With(authHandler.RequireAdmin).Get("/api/admin/users/{userID}/stats", suite.urlHandler.HandleGetUserStats())
+	hash, err := authenticatorService.HashPassword("correct horse")
+	if err != nil {
+		suite.T().Fatalf(err.Error())
+	}
+	_, err = authenticatorService.Register(suite.ctx, adminLogin, hash, suite.secretaryService.Encode(uuid.New().String()))
+	if err != nil {
+		suite.T().Fatalf(err.Error())
+	}
+	// the admin role is granted out of band and carried by tokens issued afterwards
+	err = suite.storage.SetUserRole(suite.ctx, adminLogin, authService.RoleAdmin)
+	if err != nil {
+		suite.T().Fatalf(err.Error())
+	}
+	adminToken, err := authenticatorService.Login(suite.ctx, adminLogin, "correct horse")
+	if err != nil {
+		suite.T().Fatalf(err.Error())
+	}
+	userLogin := "user-" + uuid.New().String()[:8]
+	userID := suite.secretaryService.Encode(uuid.New().String())
+	userToken, err := authenticatorService.Register(suite.ctx, userLogin, hash, userID)
+	if err != nil {
+		suite.T().Fatalf(err.Error())
+	}
+	marker := uuid.New().String()
+	URL := "https://www.yandex.com/" + marker
+	sURL, err := suite.shortenerService.Encode(suite.ctx, URL, userID, modelurl.ShortenOptions{})
+	if err != nil {
+		suite.T().Fatalf(err.Error())
+	}
+
+	access := []struct {
+		name  string
+		token string
+		code  int
+	}{
+		{name: "Search without access token", code: 401},
+		{name: "Search as a regular user", token: userToken, code: 403},
+	}
+	for _, tt := range access {
+		suite.T().Run(tt.name, func(t *testing.T) {
+			res, err := resty.New().R().SetAuthToken(tt.token).Get(suite.ts.URL + "/api/admin/urls")
+			if err != nil {
+				t.Fatalf(err.Error())
+			}
+			assert.Equal(t, tt.code, res.StatusCode())
+		})
+	}
+	client := resty.New().SetAuthToken(adminToken)
+	search := func(t *testing.T) []modeldto.ResponseAdminURL {
+		res, err := client.R().SetQueryParam("q", strings.ToUpper(marker)).Get(suite.ts.URL + "/api/admin/urls")
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		assert.Equal(t, 200, res.StatusCode())
+		var URLs []modeldto.ResponseAdminURL
+		err = json.Unmarshal(res.Body(), &URLs)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		return URLs
+	}
+	suite.T().Run("Search URLs of all users", func(t *testing.T) {
+		URLs := search(t)
+		if assert.Len(t, URLs, 1) {
+			assert.Equal(t, URL, URLs[0].URL)
+			assert.Equal(t, suite.cfg.ServerConfig.BaseURL+"/"+sURL, URLs[0].SURL)
+			assert.Equal(t, userID, URLs[0].UserID)
+			assert.False(t, URLs[0].Disabled)
+		}
+	})
+	suite.T().Run("Disable URLs", func(t *testing.T) {
+		for _, want := range [][]string{{sURL}, {}} {
+			res, err := client.R().
+				SetHeader("Content-Type", "application/json").
+				SetBody([]string{sURL}).
+				Post(suite.ts.URL + "/api/admin/urls/disable")
+			if err != nil {
+				t.Fatalf(err.Error())
+			}
+			assert.Equal(t, 200, res.StatusCode())
+			var disabled []string
+			err = json.Unmarshal(res.Body(), &disabled)
+			if err != nil {
+				t.Fatalf(err.Error())
+			}
+			assert.Equal(t, want, disabled)
+		}
+		URLs := search(t)
+		if assert.Len(t, URLs, 1) {
+			assert.True(t, URLs[0].Disabled)
+		}
+	})
+	suite.T().Run("List users", func(t *testing.T) {
+		res, err := client.R().Get(suite.ts.URL + "/api/admin/users")
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		assert.Equal(t, 200, res.StatusCode())
+		var users []modeldto.ResponseUser
+		err = json.Unmarshal(res.Body(), &users)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		assert.Contains(t, users, modeldto.ResponseUser{Login: userLogin, UserID: userID})
+		assert.True(t, sort.SliceIsSorted(users, func(i, j int) bool { return users[i].Login < users[j].Login }))
+	})
+	suite.T().Run("Get user stats", func(t *testing.T) {
+		res, err := client.R().Get(suite.ts.URL + "/api/admin/users/" + userID + "/stats")
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		assert.Equal(t, 200, res.StatusCode())
+		var stats modeldto.ResponseUserStats
+		err = json.Unmarshal(res.Body(), &stats)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		assert.Equal(t, modeldto.ResponseUserStats{UserID: userID, URLs: 1, Disabled: 1}, stats)
+	})
+	suite.T().Run("Search after the admin role is revoked", func(t *testing.T) {
+		// the token issued before still carries the admin role claim
+		err := suite.storage.SetUserRole(suite.ctx, adminLogin, "")
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		res, err := client.R().Get(suite.ts.URL + "/api/admin/urls")
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		assert.Equal(t, 403, res.StatusCode())
+	})
+	defer suite.ts.Close()
+	suite.cancel()
+	suite.wg.Wait()
+}
+
+func (suite *HandlersTestSuite) TestAudit() {
+	adminLogin := "admin-" + uuid.New().String()[:8]
+	authenticatorService, _ := authenticator.InitAuthenticator(suite.storage, suite.cfg.SecretConfig)
+	authHandler, _ := middleware.NewAuthHandler(authenticatorService)
+	suite.router.Use(authHandler.AuthHandle)
+	suite.router.Use(suite.cookieHandler.CookieHandle)
+	suite.router.With(authHandler.RequireAdmin).Post("/api/admin/urls/disable", suite.urlHandler.HandleDisableURLBatch())
+	suite.router.With(authHandler.RequireAdmin).Get("/api/admin/audit", suite.urlHandler.HandleListAudit())
+	adminID := suite.secretaryService.Encode(uuid.New().String())
+	hash, err := authenticatorService.HashPassword("correct horse")
+	if err != nil {
+		suite.T().Fatalf(err.Error())
+	}
+	_, err = authenticatorService.Register(suite.ctx, adminLogin, hash, adminID)
+	if err != nil {
+		suite.T().Fatalf(err.Error())
+	}
+	// the admin role is granted out of band and carried by tokens issued afterwards
+	err = suite.storage.SetUserRole(suite.ctx, adminLogin, authService.RoleAdmin)
+	if err != nil {
+		suite.T().Fatalf(err.Error())
+	}
+	adminToken, err := authenticatorService.Login(suite.ctx, adminLogin, "correct horse")
+	if err != nil {
+		suite.T().Fatalf(err.Error())
+	}
+	userID := suite.secretaryService.Encode(uuid.New().String())
+	URL := "https://www.yandex.com/" + uuid.New().String()
+	sURL, err := suite.shortenerService.Encode(suite.ctx, URL, userID, modelurl.ShortenOptions{})
+	if err != nil {
+		suite.T().Fatalf(err.Error())
+	}
+	client := resty.New().SetAuthToken(adminToken)
+	res, err := client.R().
+		SetHeader("Content-Type", "application/json").
+		SetBody([]string{sURL}).
+		Post(suite.ts.URL + "/api/admin/urls/disable")
+	if err != nil {
+		suite.T().Fatalf(err.Error())
+	}
+	assert.Equal(suite.T(), 200, res.StatusCode())
+
+	tests := []struct {
+		name    string
+		query   map[string]string
+		code    int
+		actions []string
+	}{
+		{
+			name:    "List records of a link",
+			query:   map[string]string{"entity": "url", "entity_id": sURL, "order": "asc"},
+			code:    200,
+			actions: []string{"create", "update"},
+		},
+		{
+			name:    "List records of an actor",
+			query:   map[string]string{"actor": adminID, "entity_id": sURL},
+			code:    200,
+			actions: []string{"update"},
+		},
+		{
+			name:    "List records of a future period",
+			query:   map[string]string{"entity_id": sURL, "since": time.Now().Add(time.Hour).Format(time.RFC3339)},
+			code:    200,
+			actions: []string{},
+		},
+		{
+			name:  "List records since an invalid time",
+			query: map[string]string{"since": "yesterday"},
+			code:  400,
+		},
+	}
+	for _, tt := range tests {
+		suite.T().Run(tt.name, func(t *testing.T) {
+			res, err := client.R().SetQueryParams(tt.query).Get(suite.ts.URL + "/api/admin/audit")
+			if err != nil {
+				t.Fatalf(err.Error())
+			}
+			assert.Equal(t, tt.code, res.StatusCode())
+			if tt.code != 200 {
+				return
+			}
+			var records []modeldto.ResponseAuditRecord
+			err = json.Unmarshal(res.Body(), &records)
+			if err != nil {
+				t.Fatalf(err.Error())
+			}
+			actions := make([]string, 0, len(records))
+			for _, record := range records {
+				actions = append(actions, record.Action)
+			}
+			assert.Equal(t, tt.actions, actions)
+		})
+	}
+	suite.T().Run("Record states of a link", func(t *testing.T) {
+		res, err := client.R().SetQueryParams(map[string]string{"entity_id": sURL, "order": "asc"}).Get(suite.ts.URL + "/api/admin/audit")
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		var records []modeldto.ResponseAuditRecord
+		err = json.Unmarshal(res.Body(), &records)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		if !assert.Len(t, records, 2) {
+			return
+		}
+		assert.Equal(t, userID, records[0].Actor)
+		assert.Equal(t, "null", string(records[0].Before))
+		assert.JSONEq(t, fmt.Sprintf(`{"sURL": %q, "URL": %q, "userID": %q, "deleted": false, "disabled": false}`, sURL, URL, userID), string(records[0].After))
+		assert.Equal(t, adminID, records[1].Actor)
+		assert.JSONEq(t, fmt.Sprintf(`{"sURL": %q, "deleted": false, "disabled": false}`, sURL), string(records[1].Before))
+		assert.JSONEq(t, fmt.Sprintf(`{"sURL": %q, "deleted": false, "disabled": true}`, sURL), string(records[1].After))
+	})
+	defer suite.ts.Close()
+	suite.cancel()
+	suite.wg.Wait()
+}
+
+func (suite *HandlersTestSuite) TestHandleShortenV2() {
+	suite.router.Use(suite.cookieHandler.CookieHandle)
+	suite.router.Route("/api/v2", func(r chi.Router) {
+		r.Use(middleware.Negotiate("application/json", MediaTypeV2))
+		r.Post("/shorten", suite.urlHandler.HandleShortenV2())
+		r.Post("/shorten/batch", suite.urlHandler.HandleShortenBatchV2())
+	})
+	client := resty.New()
+	base := suite.cfg.ServerConfig.BaseURL
+
+	// links are described along with URLs of their stats, QR code and preview
+	URL := "https://www.yandex.kg/" + uuid.New().String()
+	res, err := client.R().SetHeader("Content-Type", "application/json").
+		SetBody(`{"url": "` + URL + `", "redirect_type": 302, "max_clicks": 5, "tags": ["docs"]}`).Post(suite.ts.URL + "/api/v2/shorten")
+	suite.Require().NoError(err)
+	suite.Require().Equal(201, res.StatusCode())
+	suite.Equal("application/json", res.Header().Get("Content-Type"))
+	var link modeldto.ResponseLink
+	suite.Require().NoError(json.Unmarshal(res.Body(), &link))
+	suite.NotEmpty(link.ID)
+	suite.Equal(base+"/"+link.ID, link.SURL)
+	suite.Equal(URL, link.URL)
+	suite.Equal(base+"/"+link.ID+"+", link.PreviewURL)
+	suite.Equal(base+"/api/urls/"+link.ID+"/stats", link.StatsURL)
+	suite.Equal(base+"/"+link.ID+"/qr", link.QRURL)
+	suite.Equal(302, link.RedirectType)
+	suite.Equal(5, link.MaxClicks)
+	suite.Equal([]string{"docs"}, link.Tags)
+
+	// the vendor media type is served when it is requested
+	res, err = client.R().SetHeader("Content-Type", "application/json").SetHeader("Accept", MediaTypeV2).
+		SetBody(`{"url": "https://www.yandex.kg/` + uuid.New().String() + `"}`).Post(suite.ts.URL + "/api/v2/shorten")
+	suite.Require().NoError(err)
+	suite.Equal(201, res.StatusCode())
+	suite.Equal(MediaTypeV2, res.Header().Get("Content-Type"))
+	res, err = client.R().SetHeader("Content-Type", "application/json").SetHeader("Accept", "text/html").
+		SetBody(`{"url": "https://www.yandex.kg/` + uuid.New().String() + `"}`).Post(suite.ts.URL + "/api/v2/shorten")
+	suite.Require().NoError(err)
+	suite.Equal(406, res.StatusCode())
+
+	// batches are described with their IDs and stats URLs
+	res, err = client.R().SetHeader("Content-Type", "application/json").
+		SetBody(`[{"correlation_id": "a", "original_url": "https://www.yandex.kg/` + uuid.New().String() + `"}]`).
+		Post(suite.ts.URL + "/api/v2/shorten/batch")
+	suite.Require().NoError(err)
+	suite.Require().Equal(201, res.StatusCode())
+	var batch []modeldto.ResponseBatchLink
+	suite.Require().NoError(json.Unmarshal(res.Body(), &batch))
+	suite.Require().Len(batch, 1)
+	suite.Equal("a", batch[0].CorrelationID)
+	suite.Equal(base+"/"+batch[0].ID, batch[0].SURL)
+	suite.Equal(base+"/api/urls/"+batch[0].ID+"/stats", batch[0].StatsURL)
+	defer suite.ts.Close()
+	suite.cancel()
+	suite.wg.Wait()
+}
+
+func TestRequestContext(t *testing.T) {
+	// routes without a timeout budget are given the default one
+	r := httptest.NewRequest(http.MethodGet, "/api/user/urls", nil)
+	ctx, cancel := requestContext(r)
+	defer cancel()
+	deadline, ok := ctx.Deadline()
+	assert.True(t, ok)
+	assert.WithinDuration(t, time.Now().Add(defaultTimeout), deadline, 100*time.Millisecond)
+
+	// the budget of the route is kept even when it exceeds the default one
+	var budgeted time.Time
+	middleware.Timeout(5*time.Second)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := requestContext(r)
+		defer cancel()
+		budgeted, _ = ctx.Deadline()
+	})).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/api/shorten/batch", nil))
+	assert.WithinDuration(t, time.Now().Add(5*time.Second), budgeted, time.Second)
+}
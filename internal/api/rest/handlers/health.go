@@ -0,0 +1,140 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/api/rest/modeldto"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/config"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/logger"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/storage/v2"
+	"net/http"
+	"time"
+)
+
+// Health statuses of the service and of its readiness checks.
+const (
+	healthOK       = "ok"
+	healthFail     = "fail"
+	healthDisabled = "disabled"
+)
+
+// readinessTimeout limits the time taken by all readiness checks so that probes do not pile up on a stuck DB.
+const readinessTimeout = time.Second
+
+// HealthHandler defines data structure handling liveness and readiness probes.
+type HealthHandler struct {
+	storage       storage.URLStorage
+	queueCapacity int
+	log           *logger.Logger
+}
+
+// InitHealthHandler initializes a HealthHandler object checking st, which must not be wrapped so that its optional
+// interfaces are visible, and sets its attributes.
+func InitHealthHandler(st storage.URLStorage, cfg *config.StorageConfig, log *logger.Logger) (*HealthHandler, error) {
+	if st == nil {
+		return nil, fmt.Errorf("nil storage was passed to service Health Handler initializer")
+	}
+	return &HealthHandler{storage: st, queueCapacity: cfg.DeleteQueueSize, log: log}, nil
+}
+
+// logger returns a request-scoped logger carried by r context or the handler one.
+func (h *HealthHandler) logger(r *http.Request) *logger.Logger {
+	return logger.FromContext(r.Context(), h.log)
+}
+
+// HandleLiveness reports that the process serves requests using modeldto.ResponseHealth schema, it checks no
+// dependencies so that their outages do not get the service restarted.
+func (h *HealthHandler) HandleLiveness() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		h.respond(w, r, http.StatusOK, modeldto.ResponseHealth{Status: healthOK})
+	}
+}
+
+// HandleReadiness checks the DB connection, the deletion queue and the cache and reports their state using
+// modeldto.ResponseHealth schema, responding with 503 if any check fails.
+func (h *HealthHandler) HandleReadiness() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), readinessTimeout)
+		defer cancel()
+		response := modeldto.ResponseHealth{
+			Status: healthOK,
+			Checks: map[string]modeldto.ResponseHealthCheck{
+				"database":     h.checkDatabase(ctx),
+				"delete_queue": h.checkDeleteQueue(),
+				"cache":        h.checkCache(),
+			},
+		}
+		code := http.StatusOK
+		for name, check := range response.Checks {
+			if check.Status == healthFail {
+				h.logger(r).Warn("HandleReadiness: check failed", logger.String("check", name), logger.String("error", check.Error))
+				response.Status = healthFail
+				code = http.StatusServiceUnavailable
+			}
+		}
+		h.respond(w, r, code, response)
+	}
+}
+
+// checkDatabase pings the DB, giving up when ctx is done.
+func (h *HealthHandler) checkDatabase(ctx context.Context) modeldto.ResponseHealthCheck {
+	start := time.Now()
+	pingErr := make(chan error, 1)
+	go func() {
+		pingErr <- h.storage.PingDB()
+	}()
+	var err error
+	select {
+	case err = <-pingErr:
+	case <-ctx.Done():
+		err = fmt.Errorf("ping timed out after %s", readinessTimeout)
+	}
+	check := modeldto.ResponseHealthCheck{
+		Status:  healthOK,
+		Details: map[string]interface{}{"latency_ms": time.Since(start).Milliseconds()},
+	}
+	if err != nil {
+		check.Status = healthFail
+		check.Error = err.Error()
+	}
+	return check
+}
+
+// checkDeleteQueue fails when deletion requests block waiting for a full queue, i.e. workers do not keep up.
+func (h *HealthHandler) checkDeleteQueue() modeldto.ResponseHealthCheck {
+	depth := h.storage.QueueDepth()
+	check := modeldto.ResponseHealthCheck{
+		Status:  healthOK,
+		Details: map[string]interface{}{"depth": depth, "capacity": h.queueCapacity},
+	}
+	if depth > h.queueCapacity {
+		check.Status = healthFail
+		check.Error = fmt.Sprintf("%d deletion requests wait for a full queue", depth-h.queueCapacity)
+	}
+	return check
+}
+
+// checkCache reports cache statistics, the in-memory cache cannot fail and is disabled for storages without one.
+func (h *HealthHandler) checkCache() modeldto.ResponseHealthCheck {
+	cached, ok := h.storage.(storage.CacheStatsGetter)
+	if !ok {
+		return modeldto.ResponseHealthCheck{Status: healthDisabled}
+	}
+	hits, misses := cached.CacheStats()
+	return modeldto.ResponseHealthCheck{
+		Status:  healthOK,
+		Details: map[string]interface{}{"hits": hits, "misses": misses},
+	}
+}
+
+// respond sends response with code.
+func (h *HealthHandler) respond(w http.ResponseWriter, r *http.Request, code int, response modeldto.ResponseHealth) {
+	// probes must never see a cached state
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	err := encodeJSON(w, response)
+	if err != nil {
+		h.logger(r).Warn("HandleHealth", logger.Error(err))
+	}
+}
@@ -0,0 +1,192 @@
+package handlers
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/api/rest/middleware"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/logger"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/service/modelurl"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	// importChunkSize limits the number of CSV rows mapped at once
+	importChunkSize = 500
+	// importChunkTimeout limits the time spent on storing one chunk
+	importChunkTimeout = 5 * time.Second
+	// maxImportSize limits the size of an uploaded CSV
+	maxImportSize = 10 << 20
+	// importFileField is the multipart form field carrying the CSV
+	importFileField = "file"
+)
+
+// importHeader is the header row of the mapping file sent in response to an import.
+var importHeader = []string{"original_url", "alias", "short_url", "status", "error"}
+
+// HandleImport shortens URLs uploaded as a CSV of url[,alias] rows either as a text/csv body or as the file field
+// of a multipart form. Rows are streamed through the service in chunks and the response is a downloadable CSV
+// mapping every row to its short URL or to the reason it was not imported.
+func (h *URLHandler) HandleImport() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// retrieve user identifier
+		userID, err := getUserID(r)
+		if err != nil {
+			middleware.Error(w, r, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		u, err := url.Parse(h.serverConfig.BaseURL)
+		if err != nil {
+			h.logger(r).Warn("HandleImport", logger.Error(err))
+			middleware.Error(w, r, err.Error(), http.StatusBadRequest)
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, maxImportSize)
+		body, err := importBody(r)
+		if err != nil {
+			h.logger(r).Warn("HandleImport", logger.Error(err))
+			middleware.Error(w, r, err.Error(), http.StatusBadRequest)
+			return
+		}
+		reader := csv.NewReader(body)
+		reader.FieldsPerRecord = -1
+		reader.TrimLeadingSpace = true
+
+		w.Header().Set("Content-Type", "text/csv")
+		w.Header().Set("Content-Disposition", `attachment; filename="import.csv"`)
+		out := csv.NewWriter(w)
+		_ = out.Write(importHeader)
+		// rows are buffered until a chunk is full, rejected rows keep their position among accepted ones
+		var results []modelurl.ImportResult
+		var rows []modelurl.ImportRow
+		var positions []int
+		flush := func() error {
+			h.importChunk(r, userID, rows, positions, results)
+			for _, result := range results {
+				_ = out.Write(importRecord(u, result))
+			}
+			results, rows, positions = results[:0], rows[:0], positions[:0]
+			out.Flush()
+			return out.Error()
+		}
+		for line := 0; ; line++ {
+			record, err := reader.Read()
+			if err == io.EOF {
+				break
+			}
+			var parseError *csv.ParseError
+			if errors.As(err, &parseError) {
+				results = append(results, modelurl.ImportResult{Error: parseError.Error()})
+			} else if err != nil {
+				// the upload itself is broken, there is nothing left to map
+				h.logger(r).Warn("HandleImport", logger.Error(err))
+				break
+			} else if line == 0 && isImportHeader(record) {
+				continue
+			} else if len(record) > 2 {
+				results = append(results, modelurl.ImportResult{
+					ImportRow: modelurl.ImportRow{URL: record[0]},
+					Error:     fmt.Sprintf("expected an URL and an optional alias, got %d fields", len(record)),
+				})
+			} else {
+				row := modelurl.ImportRow{URL: strings.TrimSpace(record[0])}
+				if len(record) == 2 {
+					row.Alias = strings.TrimSpace(record[1])
+				}
+				rows = append(rows, row)
+				positions = append(positions, len(results))
+				results = append(results, modelurl.ImportResult{ImportRow: row})
+			}
+			if len(results) == importChunkSize {
+				if err = flush(); err != nil {
+					h.logger(r).Warn("HandleImport", logger.Error(err))
+					return
+				}
+			}
+		}
+		if err = flush(); err != nil {
+			h.logger(r).Warn("HandleImport", logger.Error(err))
+		}
+	}
+}
+
+// importChunk imports rows and stores the outcomes into results at positions, a chunk failing as a whole marks
+// all of its rows with the error so that the rest of the upload is still processed.
+func (h *URLHandler) importChunk(r *http.Request, userID string, rows []modelurl.ImportRow, positions []int, results []modelurl.ImportResult) {
+	if len(rows) == 0 {
+		return
+	}
+	// set context timeout for timing DB operations of one chunk
+	ctx, cancel := context.WithTimeout(r.Context(), importChunkTimeout)
+	defer cancel()
+	imported, err := h.processor.Import(ctx, rows, userID)
+	if err != nil {
+		h.logger(r).Warn("HandleImport", logger.Error(err), logger.Int("rows", len(rows)))
+		for _, i := range positions {
+			results[i].Error = err.Error()
+		}
+		return
+	}
+	for j, i := range positions {
+		results[i] = imported[j]
+	}
+}
+
+// importBody returns the uploaded CSV of r depending on its content type.
+func importBody(r *http.Request) (io.Reader, error) {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid content type: %w", err)
+	}
+	switch mediaType {
+	case "text/csv":
+		return r.Body, nil
+	case "multipart/form-data":
+		reader, err := r.MultipartReader()
+		if err != nil {
+			return nil, err
+		}
+		for {
+			part, err := reader.NextPart()
+			if err == io.EOF {
+				return nil, fmt.Errorf("multipart form has no %q field", importFileField)
+			}
+			if err != nil {
+				return nil, err
+			}
+			if part.FormName() == importFileField {
+				return part, nil
+			}
+		}
+	default:
+		return nil, fmt.Errorf("unsupported content type %q, expected text/csv or multipart/form-data", mediaType)
+	}
+}
+
+// isImportHeader reports whether record is a header row rather than an URL to import.
+func isImportHeader(record []string) bool {
+	switch strings.ToLower(strings.TrimSpace(record[0])) {
+	case "url", "original_url":
+		return true
+	}
+	return false
+}
+
+// importRecord formats result as a row of the mapping file.
+func importRecord(u *url.URL, result modelurl.ImportResult) []string {
+	if result.Error != "" {
+		return []string{result.URL, result.Alias, "", "error", result.Error}
+	}
+	u.Path = result.SURL
+	status := "created"
+	if result.Existed {
+		status = "exists"
+	}
+	return []string{result.URL, result.Alias, u.String(), status, ""}
+}
@@ -0,0 +1,233 @@
+package handlers
+
+import (
+	"github.com/danilovkiri/dk_go_url_shortener/internal/api/rest/middleware"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/api/rest/modeldto"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/logger"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/service/modelurl"
+	"github.com/go-chi/chi"
+	"net/http"
+	"net/url"
+)
+
+// HandleCreateOrg creates an organization administered by the current user using modeldto.RequestOrg schema and
+// responds with it using modeldto.ResponseOrg schema.
+func (h *URLHandler) HandleCreateOrg() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// bound DB operations by the timeout budget of the route
+		ctx, cancel := requestContext(r)
+		defer cancel()
+		// check for POST body content type compliance
+		if r.Header.Get("Content-Type") != "application/json" {
+			middleware.Error(w, r, "Invalid Content-Type", http.StatusBadRequest)
+			return
+		}
+		var request modeldto.RequestOrg
+		err := decodeJSON(r.Body, &request)
+		if err != nil {
+			h.logger(r).Warn("HandleCreateOrg", logger.Error(err))
+			middleware.Error(w, r, err.Error(), http.StatusBadRequest)
+			return
+		}
+		userID, err := getUserID(r)
+		if err != nil {
+			h.logger(r).Error("HandleCreateOrg", logger.Error(err))
+			middleware.Error(w, r, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		org, err := h.processor.CreateOrg(ctx, userID, request.Name)
+		if err != nil {
+			writeError(w, r, h.logger(r), "HandleCreateOrg", err)
+			return
+		}
+		h.logger(r).Info("organization created", logger.String("org", org.ID))
+		// set and send response body
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		err = encodeJSON(w, toResponseOrg(org))
+		if err != nil {
+			h.logger(r).Warn("HandleCreateOrg", logger.Error(err))
+		}
+	}
+}
+
+// HandleListOrgs responds with organizations of the current user using modeldto.ResponseOrg schema.
+func (h *URLHandler) HandleListOrgs() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// bound DB operations by the timeout budget of the route
+		ctx, cancel := requestContext(r)
+		defer cancel()
+		userID, err := getUserID(r)
+		if err != nil {
+			h.logger(r).Error("HandleListOrgs", logger.Error(err))
+			middleware.Error(w, r, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		orgs, err := h.processor.ListOrgs(ctx, userID)
+		if err != nil {
+			writeError(w, r, h.logger(r), "HandleListOrgs", err)
+			return
+		}
+		responseOrgs := make([]modeldto.ResponseOrg, 0, len(orgs))
+		for _, org := range orgs {
+			responseOrgs = append(responseOrgs, toResponseOrg(org))
+		}
+		// set and send response body
+		w.Header().Set("Content-Type", "application/json")
+		err = encodeJSON(w, responseOrgs)
+		if err != nil {
+			h.logger(r).Warn("HandleListOrgs", logger.Error(err))
+		}
+	}
+}
+
+// HandleListMembers responds with members of an organization of the current user using modeldto.ResponseMember
+// schema.
+func (h *URLHandler) HandleListMembers() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// bound DB operations by the timeout budget of the route
+		ctx, cancel := requestContext(r)
+		defer cancel()
+		orgID := chi.URLParam(r, "orgID")
+		userID, err := getUserID(r)
+		if err != nil {
+			h.logger(r).Error("HandleListMembers", logger.Error(err))
+			middleware.Error(w, r, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		members, err := h.processor.ListMembers(ctx, userID, orgID)
+		if err != nil {
+			writeError(w, r, h.logger(r), "HandleListMembers", err)
+			return
+		}
+		responseMembers := make([]modeldto.ResponseMember, 0, len(members))
+		for _, member := range members {
+			responseMembers = append(responseMembers, toResponseMember(member))
+		}
+		// set and send response body
+		w.Header().Set("Content-Type", "application/json")
+		err = encodeJSON(w, responseMembers)
+		if err != nil {
+			h.logger(r).Warn("HandleListMembers", logger.Error(err))
+		}
+	}
+}
+
+// HandleSetMember adds a registered user to an organization administered by the current user or changes their role
+// using modeldto.RequestMember schema and responds with the member using modeldto.ResponseMember schema.
+func (h *URLHandler) HandleSetMember() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// bound DB operations by the timeout budget of the route
+		ctx, cancel := requestContext(r)
+		defer cancel()
+		// check for POST body content type compliance
+		if r.Header.Get("Content-Type") != "application/json" {
+			middleware.Error(w, r, "Invalid Content-Type", http.StatusBadRequest)
+			return
+		}
+		var request modeldto.RequestMember
+		err := decodeJSON(r.Body, &request)
+		if err != nil {
+			h.logger(r).Warn("HandleSetMember", logger.Error(err))
+			middleware.Error(w, r, err.Error(), http.StatusBadRequest)
+			return
+		}
+		orgID := chi.URLParam(r, "orgID")
+		userID, err := getUserID(r)
+		if err != nil {
+			h.logger(r).Error("HandleSetMember", logger.Error(err))
+			middleware.Error(w, r, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		member, err := h.processor.SetMember(ctx, userID, orgID, request.Login, request.Role)
+		if err != nil {
+			writeError(w, r, h.logger(r), "HandleSetMember", err)
+			return
+		}
+		h.logger(r).Info("organization member set", logger.String("org", orgID), logger.String("member", member.UserID))
+		// set and send response body
+		w.Header().Set("Content-Type", "application/json")
+		err = encodeJSON(w, toResponseMember(member))
+		if err != nil {
+			h.logger(r).Warn("HandleSetMember", logger.Error(err))
+		}
+	}
+}
+
+// HandleRemoveMember removes a member from an organization, admins remove any member and members remove themselves.
+func (h *URLHandler) HandleRemoveMember() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// bound DB operations by the timeout budget of the route
+		ctx, cancel := requestContext(r)
+		defer cancel()
+		orgID := chi.URLParam(r, "orgID")
+		memberID := chi.URLParam(r, "userID")
+		userID, err := getUserID(r)
+		if err != nil {
+			h.logger(r).Error("HandleRemoveMember", logger.Error(err))
+			middleware.Error(w, r, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		err = h.processor.RemoveMember(ctx, userID, orgID, memberID)
+		if err != nil {
+			writeError(w, r, h.logger(r), "HandleRemoveMember", err)
+			return
+		}
+		h.logger(r).Info("organization member removed", logger.String("org", orgID), logger.String("member", memberID))
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// HandleGetURLsByOrgID responds with URLs of an organization of the current user using modeldto.ResponseFullURL schema,
+// paged and sorted the same way as HandleGetURLsByUserID does.
+func (h *URLHandler) HandleGetURLsByOrgID() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// bound DB operations by the timeout budget of the route
+		ctx, cancel := requestContext(r)
+		defer cancel()
+		orgID := chi.URLParam(r, "orgID")
+		userID, err := getUserID(r)
+		if err != nil {
+			h.logger(r).Error("HandleGetURLsByOrgID", logger.Error(err))
+			middleware.Error(w, r, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		opts, err := parseListOptions(r)
+		if err != nil {
+			h.logger(r).Warn("HandleGetURLsByOrgID", logger.Error(err))
+			middleware.Error(w, r, err.Error(), http.StatusBadRequest)
+			return
+		}
+		URLs, err := h.processor.DecodeByOrgID(ctx, userID, orgID, opts)
+		if err != nil {
+			writeError(w, r, h.logger(r), "HandleGetURLsByOrgID", err)
+			return
+		}
+		u, err := url.Parse(h.serverConfig.BaseURL)
+		if err != nil {
+			h.logger(r).Error("HandleGetURLsByOrgID", logger.Error(err))
+			middleware.Error(w, r, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		responseURLs := make([]modeldto.ResponseFullURL, 0, len(URLs))
+		for _, fullURL := range URLs {
+			responseURLs = append(responseURLs, toResponseFullURL(*u, fullURL))
+		}
+		// set and send response body
+		w.Header().Set("Content-Type", "application/json")
+		err = encodeJSON(w, responseURLs)
+		if err != nil {
+			h.logger(r).Warn("HandleGetURLsByOrgID", logger.Error(err))
+		}
+	}
+}
+
+// toResponseOrg converts an organization to modeldto.ResponseOrg schema.
+func toResponseOrg(org modelurl.Org) modeldto.ResponseOrg {
+	return modeldto.ResponseOrg{ID: org.ID, Name: org.Name, Role: org.Role, CreatedAt: org.CreatedAt}
+}
+
+// toResponseMember converts an organization member to modeldto.ResponseMember schema.
+func toResponseMember(member modelurl.Member) modeldto.ResponseMember {
+	return modeldto.ResponseMember{UserID: member.UserID, Login: member.Login, Role: member.Role, CreatedAt: member.CreatedAt}
+}
@@ -0,0 +1,81 @@
+package handlers
+
+import (
+	"errors"
+	serviceErrors "github.com/danilovkiri/dk_go_url_shortener/internal/service/errors"
+	"html/template"
+	"net/http"
+)
+
+// ways clients present the password of a protected link, the form field is submitted by passwordPage
+const (
+	passwordHeader     = "X-Link-Password"
+	passwordQueryParam = "pw"
+	passwordFormField  = "password"
+)
+
+// passwordPage renders the form asking for the password of a protected link, it is posted to Action or to the page
+// URL itself when Action is empty.
+var passwordPage = template.Must(template.New("password").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+  <meta charset="utf-8">
+  <meta name="viewport" content="width=device-width, initial-scale=1">
+  <meta name="robots" content="noindex">
+  <title>Protected link</title>
+  <style>
+    body { font-family: sans-serif; max-width: 40rem; margin: 4rem auto; padding: 0 1rem; color: #222; }
+    .error { color: #b3261e; }
+    input, button { font-size: 1rem; padding: 0.5rem; }
+    button { background: #0b57d0; color: #fff; border: none; border-radius: 4px; padding: 0.5rem 1.2rem; }
+  </style>
+</head>
+<body>
+  <p>This short link is protected with a password.</p>
+  {{if .Invalid}}<p class="error">The password is wrong, try again.</p>{{end}}
+  <form method="post"{{if .Action}} action="{{.Action}}"{{end}}>
+    <input type="password" name="password" aria-label="Password" required autofocus>
+    <button type="submit">Continue</button>
+  </form>
+</body>
+</html>
+`))
+
+// linkPassword returns the link password presented with r via the X-Link-Password header, the password form field or
+// the pw query parameter.
+func linkPassword(r *http.Request) string {
+	if password := r.Header.Get(passwordHeader); password != "" {
+		return password
+	}
+	if r.Method == http.MethodPost {
+		if password := r.PostFormValue(passwordFormField); password != "" {
+			return password
+		}
+	}
+	return r.URL.Query().Get(passwordQueryParam)
+}
+
+// writePasswordForm responds with the password form when err reports a missing or wrong link password, with 401 and
+// 403 status codes respectively, and reports whether it did.
+func writePasswordForm(w http.ResponseWriter, err error, action string) (bool, error) {
+	var passwordRequired *serviceErrors.ServicePasswordRequired
+	var invalidPassword *serviceErrors.ServiceInvalidPassword
+	status := http.StatusUnauthorized
+	switch {
+	case errors.As(err, &passwordRequired):
+	case errors.As(err, &invalidPassword):
+		status = http.StatusForbidden
+	default:
+		return false, nil
+	}
+	// the form must neither be cached nor framed so that typed passwords cannot be clickjacked
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("X-Frame-Options", "DENY")
+	w.Header().Set("Referrer-Policy", "no-referrer")
+	w.WriteHeader(status)
+	return true, passwordPage.Execute(w, struct {
+		Invalid bool
+		Action  string
+	}{status == http.StatusForbidden, action})
+}
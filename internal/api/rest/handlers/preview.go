@@ -0,0 +1,136 @@
+package handlers
+
+import (
+	"fmt"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/api/rest/middleware"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/config"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/logger"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/preview"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/service/shortener"
+	"github.com/go-chi/chi"
+	"html/template"
+	"net/http"
+	"net/url"
+)
+
+// previewPage renders the interstitial page shown instead of redirecting, the continue button follows the short URL
+// so that the redirect is still counted.
+var previewPage = template.Must(template.New("preview").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+  <meta charset="utf-8">
+  <meta name="viewport" content="width=device-width, initial-scale=1">
+  <meta name="robots" content="noindex">
+  <title>Link preview</title>
+  <style>
+    body { font-family: sans-serif; max-width: 40rem; margin: 4rem auto; padding: 0 1rem; color: #222; }
+    .host { font-size: 1.5rem; font-weight: bold; }
+    .url { word-break: break-all; color: #555; }
+    .continue { display: inline-block; margin-top: 1.5rem; padding: 0.6rem 1.2rem; background: #0b57d0; color: #fff; text-decoration: none; border-radius: 4px; }
+  </style>
+</head>
+<body>
+  <p>This short link leads to</p>
+  <p class="host">{{.Host}}</p>
+  {{if .Title}}<p>{{.Title}}</p>{{end}}
+  <p class="url">{{.URL}}</p>
+  <a class="continue" href="{{.ShortURL}}" rel="noreferrer">Continue</a>
+</body>
+</html>
+`))
+
+// PreviewHandler defines data structure serving link preview pages.
+type PreviewHandler struct {
+	processor    shortener.Processor
+	serverConfig *config.ServerConfig
+	fetcher      *preview.Fetcher
+	log          *logger.Logger
+}
+
+// InitPreviewHandler initializes a PreviewHandler object and sets its attributes, destination titles are not shown
+// when fetcher is nil.
+func InitPreviewHandler(processor shortener.Processor, serverConfig *config.ServerConfig, fetcher *preview.Fetcher, log *logger.Logger) (*PreviewHandler, error) {
+	if processor == nil {
+		return nil, fmt.Errorf("nil Shortener Service was passed to service Preview Handler initializer")
+	}
+	return &PreviewHandler{processor: processor, serverConfig: serverConfig, fetcher: fetcher, log: log}, nil
+}
+
+// logger returns a request-scoped logger carried by r context or the handler one.
+func (h *PreviewHandler) logger(r *http.Request) *logger.Logger {
+	return logger.FromContext(r.Context(), h.log)
+}
+
+// HandleGetURLPreview provides client with an HTML page showing the destination of a short URL, its host, page title
+// and a button continuing to it, instead of redirecting blindly.
+func (h *PreviewHandler) HandleGetURLPreview() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// bound DB operations by the timeout budget of the route
+		ctx, cancel := requestContext(r)
+		defer cancel()
+		// retrieve sURL from query
+		sURL := chi.URLParam(r, "urlID")
+		h.logger(r).Info("GET preview request detected", logger.String("sURL", sURL))
+		baseURL, err := url.Parse(h.serverConfig.BaseURL)
+		if err != nil {
+			h.logger(r).Warn("HandleGetURLPreview", logger.Error(err))
+			middleware.Error(w, r, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		var URL string
+		domain, err := h.processor.ResolveDomain(ctx, requestHost(r, h.serverConfig.BaseURL))
+		if err == nil {
+			URL, _, err = h.processor.Decode(ctx, sURL, domain, linkPassword(r))
+		}
+		// the continue button follows the short URL on the domain serving it
+		link := shortURL(*baseURL, sURL, domain)
+		if err != nil {
+			// the password form of protected links is posted to the short URL which redirects once it is accepted
+			if written, errForm := writePasswordForm(w, err, link); written {
+				h.logger(r).Info("HandleGetURLPreview", logger.Error(err))
+				if errForm != nil {
+					h.logger(r).Warn("HandleGetURLPreview", logger.Error(errForm))
+				}
+				return
+			}
+			writeError(w, r, h.logger(r), "HandleGetURLPreview", err)
+			return
+		}
+		destination, err := url.Parse(URL)
+		if err != nil {
+			h.logger(r).Warn("HandleGetURLPreview", logger.Error(err))
+			middleware.Error(w, r, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		// the page is still served when the destination does not respond in time
+		title, err := h.fetcher.Title(r.Context(), URL)
+		if err != nil {
+			h.logger(r).Debug("HandleGetURLPreview: fetching title", logger.Error(err))
+		}
+		// set and send response, framing is denied so that the continue button cannot be clickjacked
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Header().Set("X-Frame-Options", "DENY")
+		w.Header().Set("Referrer-Policy", "no-referrer")
+		err = previewPage.Execute(w, struct {
+			Host     string
+			Title    string
+			URL      string
+			ShortURL string
+		}{destination.Host, title, URL, link})
+		if err != nil {
+			h.logger(r).Warn("HandleGetURLPreview", logger.Error(err))
+		}
+	}
+}
+
+// WithPreviewQuery serves the preview page instead of next for requests with the preview=1 query parameter.
+func (h *PreviewHandler) WithPreviewQuery(next http.HandlerFunc) http.HandlerFunc {
+	previewHandler := h.HandleGetURLPreview()
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("preview") == "1" {
+			previewHandler(w, r)
+			return
+		}
+		next(w, r)
+	}
+}
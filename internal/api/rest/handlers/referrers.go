@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"fmt"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/api/rest/middleware"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/api/rest/modeldto"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/logger"
+	"github.com/go-chi/chi"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// limits of the limit query parameter of referrer breakdowns
+const (
+	defaultReferrersLimit = 10
+	maxReferrersLimit     = 100
+)
+
+// HandleGetURLReferrers provides referrer domains of a shortened URL with the most redirects, 10 of them unless the
+// limit query parameter says otherwise, along with the number of direct redirects using modeldto.ResponseReferrers
+// schema. Redirects of bots are only counted with include_bots=true.
+func (h *URLHandler) HandleGetURLReferrers() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// bound DB operations by the timeout budget of the route
+		ctx, cancel := requestContext(r)
+		defer cancel()
+		includeBots, err := parseIncludeBots(r.URL.Query())
+		if err != nil {
+			h.logger(r).Warn("HandleGetURLReferrers", logger.Error(err))
+			middleware.Error(w, r, err.Error(), http.StatusBadRequest)
+			return
+		}
+		limit := defaultReferrersLimit
+		if rawLimit := r.URL.Query().Get("limit"); rawLimit != "" {
+			limit, err = strconv.Atoi(rawLimit)
+			if err != nil || limit < 1 || limit > maxReferrersLimit {
+				err = fmt.Errorf("limit must be an integer between 1 and %d", maxReferrersLimit)
+				h.logger(r).Warn("HandleGetURLReferrers", logger.Error(err))
+				middleware.Error(w, r, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+		sURL := chi.URLParam(r, "urlID")
+		stats, err := h.processor.Referrers(ctx, sURL, limit, includeBots)
+		if err != nil {
+			writeError(w, r, h.logger(r), "HandleGetURLReferrers", err)
+			return
+		}
+		// create and serialize response object into JSON
+		u, err := url.Parse(h.serverConfig.BaseURL)
+		if err != nil {
+			h.logger(r).Warn("HandleGetURLReferrers", logger.Error(err))
+			middleware.Error(w, r, err.Error(), http.StatusBadRequest)
+			return
+		}
+		u.Path = stats.SURL
+		response := modeldto.ResponseReferrers{
+			SURL:         u.String(),
+			DirectClicks: stats.DirectClicks,
+			Referrers:    make([]modeldto.ResponseReferrerClicks, 0, len(stats.Referrers)),
+		}
+		for _, referrer := range stats.Referrers {
+			response.Referrers = append(response.Referrers, modeldto.ResponseReferrerClicks{Domain: referrer.Domain, Clicks: referrer.Clicks})
+		}
+		// set and send response body
+		w.Header().Set("Content-Type", "application/json")
+		err = encodeJSON(w, response)
+		if err != nil {
+			h.logger(r).Warn("HandleGetURLReferrers", logger.Error(err))
+		}
+	}
+}
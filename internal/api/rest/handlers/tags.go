@@ -0,0 +1,112 @@
+package handlers
+
+import (
+	"github.com/danilovkiri/dk_go_url_shortener/internal/api/rest/middleware"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/api/rest/modeldto"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/logger"
+	"github.com/go-chi/chi"
+	"net/http"
+)
+
+// HandleSetTags replaces tags of a URL entry owned by the user with a JSON array of tags, an empty array untags it.
+// Entries of other users are not found.
+func (h *URLHandler) HandleSetTags() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// bound DB operations by the timeout budget of the route
+		ctx, cancel := requestContext(r)
+		defer cancel()
+		// check for PUT body content type compliance
+		if r.Header.Get("Content-Type") != "application/json" {
+			middleware.Error(w, r, "Invalid Content-Type", http.StatusBadRequest)
+			return
+		}
+		var tags []string
+		err := decodeJSON(r.Body, &tags)
+		if err != nil {
+			h.logger(r).Warn("HandleSetTags", logger.Error(err))
+			middleware.Error(w, r, err.Error(), http.StatusBadRequest)
+			return
+		}
+		userID, err := getUserID(r)
+		if err != nil {
+			h.logger(r).Error("HandleSetTags", logger.Error(err))
+			middleware.Error(w, r, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		sURL := chi.URLParam(r, "urlID")
+		err = h.processor.SetTags(ctx, sURL, userID, tags)
+		if err != nil {
+			writeError(w, r, h.logger(r), "HandleSetTags", err)
+			return
+		}
+		h.logger(r).Info("URL tags set", logger.String("sURL", sURL), logger.Int("count", len(tags)))
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// HandleListTags responds with tags of the current user's links along with the number of links tagged with each of
+// them using modeldto.ResponseTag schema.
+func (h *URLHandler) HandleListTags() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// bound DB operations by the timeout budget of the route
+		ctx, cancel := requestContext(r)
+		defer cancel()
+		userID, err := getUserID(r)
+		if err != nil {
+			h.logger(r).Error("HandleListTags", logger.Error(err))
+			middleware.Error(w, r, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		tags, err := h.processor.ListTags(ctx, userID)
+		if err != nil {
+			writeError(w, r, h.logger(r), "HandleListTags", err)
+			return
+		}
+		responseTags := make([]modeldto.ResponseTag, 0, len(tags))
+		for _, tag := range tags {
+			responseTags = append(responseTags, modeldto.ResponseTag{Name: tag.Name, Count: tag.Count})
+		}
+		// set and send response body
+		w.Header().Set("Content-Type", "application/json")
+		err = encodeJSON(w, responseTags)
+		if err != nil {
+			h.logger(r).Warn("HandleListTags", logger.Error(err))
+		}
+	}
+}
+
+// HandleRenameTag renames a tag of the current user's links using modeldto.RequestTag schema, links already tagged
+// with the new name keep one tag.
+func (h *URLHandler) HandleRenameTag() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// bound DB operations by the timeout budget of the route
+		ctx, cancel := requestContext(r)
+		defer cancel()
+		// check for PATCH body content type compliance
+		if r.Header.Get("Content-Type") != "application/json" {
+			middleware.Error(w, r, "Invalid Content-Type", http.StatusBadRequest)
+			return
+		}
+		var request modeldto.RequestTag
+		err := decodeJSON(r.Body, &request)
+		if err != nil {
+			h.logger(r).Warn("HandleRenameTag", logger.Error(err))
+			middleware.Error(w, r, err.Error(), http.StatusBadRequest)
+			return
+		}
+		userID, err := getUserID(r)
+		if err != nil {
+			h.logger(r).Error("HandleRenameTag", logger.Error(err))
+			middleware.Error(w, r, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		tag := chi.URLParam(r, "tag")
+		err = h.processor.RenameTag(ctx, userID, tag, request.Name)
+		if err != nil {
+			writeError(w, r, h.logger(r), "HandleRenameTag", err)
+			return
+		}
+		h.logger(r).Info("tag renamed", logger.String("tag", tag), logger.String("name", request.Name))
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	"github.com/danilovkiri/dk_go_url_shortener/internal/api/rest/middleware"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/api/rest/modeldto"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/logger"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/service/modelurl"
+	"github.com/go-chi/chi"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// HandleGetURLTimeSeries provides redirect counts of a shortened URL per hour or day within a range using
+// modeldto.ResponseTimeSeries schema, daily counts of the last 30 days are provided by default. Redirects of bots are
+// only counted with include_bots=true.
+func (h *URLHandler) HandleGetURLTimeSeries() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// bound DB operations by the timeout budget of the route
+		ctx, cancel := requestContext(r)
+		defer cancel()
+		query := r.URL.Query()
+		granularity := query.Get("granularity")
+		if granularity == "" {
+			granularity = modelurl.GranularityDay
+		}
+		since, err := parseTimeParam(query, "from")
+		if err != nil {
+			h.logger(r).Warn("HandleGetURLTimeSeries", logger.Error(err))
+			middleware.Error(w, r, err.Error(), http.StatusBadRequest)
+			return
+		}
+		until, err := parseTimeParam(query, "to")
+		if err != nil {
+			h.logger(r).Warn("HandleGetURLTimeSeries", logger.Error(err))
+			middleware.Error(w, r, err.Error(), http.StatusBadRequest)
+			return
+		}
+		includeBots, err := parseIncludeBots(query)
+		if err != nil {
+			h.logger(r).Warn("HandleGetURLTimeSeries", logger.Error(err))
+			middleware.Error(w, r, err.Error(), http.StatusBadRequest)
+			return
+		}
+		// missing bounds are left zero for the service to default them
+		var from, to time.Time
+		if since != nil {
+			from = *since
+		}
+		if until != nil {
+			to = *until
+		}
+		sURL := chi.URLParam(r, "urlID")
+		series, err := h.processor.TimeSeries(ctx, sURL, granularity, from, to, includeBots)
+		if err != nil {
+			writeError(w, r, h.logger(r), "HandleGetURLTimeSeries", err)
+			return
+		}
+		// create and serialize response object into JSON
+		u, err := url.Parse(h.serverConfig.BaseURL)
+		if err != nil {
+			h.logger(r).Warn("HandleGetURLTimeSeries", logger.Error(err))
+			middleware.Error(w, r, err.Error(), http.StatusBadRequest)
+			return
+		}
+		u.Path = series.SURL
+		response := modeldto.ResponseTimeSeries{
+			SURL:        u.String(),
+			Granularity: series.Granularity,
+			From:        series.From,
+			To:          series.To,
+			Buckets:     make([]modeldto.ResponseClickBucket, 0, len(series.Buckets)),
+		}
+		for _, bucket := range series.Buckets {
+			response.Buckets = append(response.Buckets, modeldto.ResponseClickBucket{Start: bucket.Start, Clicks: bucket.Clicks})
+		}
+		// set and send response body
+		w.Header().Set("Content-Type", "application/json")
+		err = encodeJSON(w, response)
+		if err != nil {
+			h.logger(r).Warn("HandleGetURLTimeSeries", logger.Error(err))
+		}
+	}
+}
@@ -0,0 +1,227 @@
+package handlers
+
+import (
+	"fmt"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/api/rest/middleware"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/api/rest/modeldto"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/logger"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/service/authenticator"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/service/modelurl"
+	"github.com/go-chi/chi"
+	"github.com/google/uuid"
+	"net/http"
+)
+
+// UserHandler defines data structure handling user accounts and provides support for adding new implementations.
+type UserHandler struct {
+	auth authenticator.Authenticator
+	log  *logger.Logger
+}
+
+// InitUserHandler initializes a UserHandler object and sets its attributes.
+func InitUserHandler(auth authenticator.Authenticator, log *logger.Logger) (*UserHandler, error) {
+	if auth == nil {
+		return nil, fmt.Errorf("nil Authenticator Service was passed to service User Handler initializer")
+	}
+	return &UserHandler{auth: auth, log: log}, nil
+}
+
+// logger returns a request-scoped logger carried by r context or the handler one.
+func (h *UserHandler) logger(r *http.Request) *logger.Logger {
+	return logger.FromContext(r.Context(), h.log)
+}
+
+// HandleRegister creates a user account using modeldto.RequestCredentials schema and responds with an access token
+// using modeldto.ResponseToken schema. Links created with the current user cookie are kept by the new account.
+func (h *UserHandler) HandleRegister() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		credentials, ok := h.readCredentials(w, r)
+		if !ok {
+			return
+		}
+		// adopt the cookie identity, token holders and clients without cookies get a new one
+		userID := uuid.New().String()
+		if _, ok := middleware.UserIDFromContext(r.Context()); !ok {
+			cookieUserID, err := getCookieUserID(r)
+			if err == nil {
+				userID = cookieUserID
+			}
+		}
+		h.logger(r).Info("Registration request detected", logger.String("login", credentials.Login))
+		// hash the password before the timeout budget starts since hashing is deliberately slow
+		hash, err := h.auth.HashPassword(credentials.Password)
+		if err != nil {
+			writeError(w, r, h.logger(r), "HandleRegister", err)
+			return
+		}
+		// bound DB operations by the timeout budget of the route
+		ctx, cancel := requestContext(r)
+		defer cancel()
+		token, err := h.auth.Register(ctx, credentials.Login, hash, userID)
+		if err != nil {
+			writeError(w, r, h.logger(r), "HandleRegister", err)
+			return
+		}
+		h.writeToken(w, r, token, http.StatusCreated)
+	}
+}
+
+// HandleLogin checks user credentials using modeldto.RequestCredentials schema and responds with an access token
+// using modeldto.ResponseToken schema.
+func (h *UserHandler) HandleLogin() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// bound DB operations by the timeout budget of the route
+		ctx, cancel := requestContext(r)
+		defer cancel()
+		credentials, ok := h.readCredentials(w, r)
+		if !ok {
+			return
+		}
+		h.logger(r).Info("Login request detected", logger.String("login", credentials.Login))
+		// the password is compared after the account lookup bounded by ctx, hashing does not spend the budget
+		token, err := h.auth.Login(ctx, credentials.Login, credentials.Password)
+		if err != nil {
+			writeError(w, r, h.logger(r), "HandleLogin", err)
+			return
+		}
+		h.writeToken(w, r, token, http.StatusOK)
+	}
+}
+
+// HandleCreateAPIKey mints an API key of the current user using modeldto.RequestAPIKey schema and responds with it
+// using modeldto.ResponseAPIKey schema, the key is never shown again.
+func (h *UserHandler) HandleCreateAPIKey() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// bound DB operations by the timeout budget of the route
+		ctx, cancel := requestContext(r)
+		defer cancel()
+		// check for POST body content type compliance
+		if r.Header.Get("Content-Type") != "application/json" {
+			middleware.Error(w, r, "Invalid Content-Type", http.StatusBadRequest)
+			return
+		}
+		var request modeldto.RequestAPIKey
+		err := decodeJSON(r.Body, &request)
+		if err != nil {
+			h.logger(r).Warn("HandleCreateAPIKey", logger.Error(err))
+			middleware.Error(w, r, err.Error(), http.StatusBadRequest)
+			return
+		}
+		userID, err := getUserID(r)
+		if err != nil {
+			h.logger(r).Error("HandleCreateAPIKey", logger.Error(err))
+			middleware.Error(w, r, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		key, apiKey, err := h.auth.CreateAPIKey(ctx, userID, request.Name)
+		if err != nil {
+			writeError(w, r, h.logger(r), "HandleCreateAPIKey", err)
+			return
+		}
+		h.logger(r).Info("API key created", logger.String("id", apiKey.ID))
+		response := toResponseAPIKey(apiKey)
+		response.Key = key
+		// set and send response body
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		w.WriteHeader(http.StatusCreated)
+		err = encodeJSON(w, response)
+		if err != nil {
+			h.logger(r).Warn("HandleCreateAPIKey", logger.Error(err))
+		}
+	}
+}
+
+// HandleListAPIKeys responds with API keys of the current user including revoked ones using modeldto.ResponseAPIKey
+// schema.
+func (h *UserHandler) HandleListAPIKeys() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// bound DB operations by the timeout budget of the route
+		ctx, cancel := requestContext(r)
+		defer cancel()
+		userID, err := getUserID(r)
+		if err != nil {
+			h.logger(r).Error("HandleListAPIKeys", logger.Error(err))
+			middleware.Error(w, r, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		apiKeys, err := h.auth.ListAPIKeys(ctx, userID)
+		if err != nil {
+			writeError(w, r, h.logger(r), "HandleListAPIKeys", err)
+			return
+		}
+		responseAPIKeys := make([]modeldto.ResponseAPIKey, 0, len(apiKeys))
+		for _, apiKey := range apiKeys {
+			responseAPIKeys = append(responseAPIKeys, toResponseAPIKey(apiKey))
+		}
+		// set and send response body
+		w.Header().Set("Content-Type", "application/json")
+		err = encodeJSON(w, responseAPIKeys)
+		if err != nil {
+			h.logger(r).Warn("HandleListAPIKeys", logger.Error(err))
+		}
+	}
+}
+
+// HandleRevokeAPIKey revokes an API key of the current user, requests bearing the key are rejected afterwards.
+func (h *UserHandler) HandleRevokeAPIKey() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// bound DB operations by the timeout budget of the route
+		ctx, cancel := requestContext(r)
+		defer cancel()
+		keyID := chi.URLParam(r, "keyID")
+		userID, err := getUserID(r)
+		if err != nil {
+			h.logger(r).Error("HandleRevokeAPIKey", logger.Error(err))
+			middleware.Error(w, r, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		err = h.auth.RevokeAPIKey(ctx, userID, keyID)
+		if err != nil {
+			writeError(w, r, h.logger(r), "HandleRevokeAPIKey", err)
+			return
+		}
+		h.logger(r).Info("API key revoked", logger.String("id", keyID))
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// toResponseAPIKey converts an API key to modeldto.ResponseAPIKey schema without the key itself.
+func toResponseAPIKey(apiKey modelurl.APIKey) modeldto.ResponseAPIKey {
+	return modeldto.ResponseAPIKey{
+		ID:        apiKey.ID,
+		Name:      apiKey.Name,
+		Prefix:    apiKey.Prefix,
+		CreatedAt: apiKey.CreatedAt,
+		RevokedAt: apiKey.RevokedAt,
+	}
+}
+
+// readCredentials deserializes credentials from JSON request body, it responds with an error and returns false when
+// the body is invalid.
+func (h *UserHandler) readCredentials(w http.ResponseWriter, r *http.Request) (modeldto.RequestCredentials, bool) {
+	var credentials modeldto.RequestCredentials
+	// check for POST body content type compliance
+	if r.Header.Get("Content-Type") != "application/json" {
+		middleware.Error(w, r, "Invalid Content-Type", http.StatusBadRequest)
+		return credentials, false
+	}
+	err := decodeJSON(r.Body, &credentials)
+	if err != nil {
+		h.logger(r).Warn("Reading credentials", logger.Error(err))
+		middleware.Error(w, r, err.Error(), http.StatusBadRequest)
+		return credentials, false
+	}
+	return credentials, true
+}
+
+// writeToken sends an access token both in the Authorization header and in the response body.
+func (h *UserHandler) writeToken(w http.ResponseWriter, r *http.Request, token string, code int) {
+	w.Header().Set("Authorization", "Bearer "+token)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	err := encodeJSON(w, modeldto.ResponseToken{Token: token})
+	if err != nil {
+		h.logger(r).Warn("Sending token", logger.Error(err))
+	}
+}
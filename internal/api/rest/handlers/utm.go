@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"github.com/danilovkiri/dk_go_url_shortener/internal/api/rest/middleware"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/logger"
+	"net/http"
+)
+
+// HandleSetUTMDefaults replaces UTM parameters links of the current user are given unless they are created with their
+// own with a JSON object of UTM parameter names to values, an empty object removes them. Links created before keep
+// their UTM parameters.
+func (h *URLHandler) HandleSetUTMDefaults() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// bound DB operations by the timeout budget of the route
+		ctx, cancel := requestContext(r)
+		defer cancel()
+		// check for PUT body content type compliance
+		if r.Header.Get("Content-Type") != "application/json" {
+			middleware.Error(w, r, "Invalid Content-Type", http.StatusBadRequest)
+			return
+		}
+		var utm map[string]string
+		err := decodeJSON(r.Body, &utm)
+		if err != nil {
+			h.logger(r).Warn("HandleSetUTMDefaults", logger.Error(err))
+			middleware.Error(w, r, err.Error(), http.StatusBadRequest)
+			return
+		}
+		userID, err := getUserID(r)
+		if err != nil {
+			h.logger(r).Error("HandleSetUTMDefaults", logger.Error(err))
+			middleware.Error(w, r, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		err = h.processor.SetUTMDefaults(ctx, userID, utm)
+		if err != nil {
+			writeError(w, r, h.logger(r), "HandleSetUTMDefaults", err)
+			return
+		}
+		h.logger(r).Info("UTM defaults set", logger.Int("count", len(utm)))
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// HandleGetUTMDefaults responds with UTM parameters links of the current user are given unless they are created with
+// their own as a JSON object of UTM parameter names to values.
+func (h *URLHandler) HandleGetUTMDefaults() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// bound DB operations by the timeout budget of the route
+		ctx, cancel := requestContext(r)
+		defer cancel()
+		userID, err := getUserID(r)
+		if err != nil {
+			h.logger(r).Error("HandleGetUTMDefaults", logger.Error(err))
+			middleware.Error(w, r, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		utm, err := h.processor.UTMDefaults(ctx, userID)
+		if err != nil {
+			writeError(w, r, h.logger(r), "HandleGetUTMDefaults", err)
+			return
+		}
+		if utm == nil {
+			utm = map[string]string{}
+		}
+		// set and send response body
+		w.Header().Set("Content-Type", "application/json")
+		err = encodeJSON(w, utm)
+		if err != nil {
+			h.logger(r).Warn("HandleGetUTMDefaults", logger.Error(err))
+		}
+	}
+}
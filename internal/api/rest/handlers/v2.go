@@ -0,0 +1,168 @@
+package handlers
+
+import (
+	"errors"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/api/rest/middleware"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/api/rest/modeldto"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/logger"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/service/modelurl"
+	storageErrors "github.com/danilovkiri/dk_go_url_shortener/internal/storage/v2/errors"
+	"net/http"
+	"net/url"
+)
+
+// MediaTypeV2 is the vendor media type of /api/v2 responses, clients may request it instead of application/json to
+// pin the version of the response shape.
+const MediaTypeV2 = "application/vnd.shortener.v2+json"
+
+// HandleShortenV2 provides shortening service for single URL processing using modeldto.RequestURL and
+// modeldto.ResponseLink schemas, the response describes the link created along with URLs of its stats, QR code and
+// preview. URLs already shortened are answered with 409 and the existing link. Responses are of the media type picked
+// by middleware.Negotiate.
+func (h *URLHandler) HandleShortenV2() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// check for POST body content type compliance
+		if r.Header.Get("Content-Type") != "application/json" {
+			middleware.Error(w, r, "Invalid Content-Type", http.StatusBadRequest)
+			return
+		}
+		var post modeldto.RequestURL
+		err := decodeJSON(r.Body, &post)
+		if err != nil {
+			h.logger(r).Warn("HandleShortenV2", logger.Error(err))
+			middleware.Error(w, r, err.Error(), http.StatusBadRequest)
+			return
+		}
+		userID, err := getUserID(r)
+		if err != nil {
+			h.logger(r).Error("HandleShortenV2", logger.Error(err))
+			middleware.Error(w, r, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		base, err := url.Parse(h.serverConfig.BaseURL)
+		if err != nil {
+			h.logger(r).Error("HandleShortenV2", logger.Error(err))
+			middleware.Error(w, r, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		opts := shortenOptions(&post)
+		// hash the password before the timeout budget starts since hashing is deliberately slow
+		opts.PasswordHash, err = h.processor.HashPassword(opts.Password)
+		if err != nil {
+			writeError(w, r, h.logger(r), "HandleShortenV2", err)
+			return
+		}
+		// bound DB operations by the timeout budget of the route
+		ctx, cancel := requestContext(r)
+		defer cancel()
+		link, err := h.processor.Shorten(ctx, post.URL, userID, opts)
+		status := http.StatusCreated
+		if err != nil {
+			var alreadyExistsError *storageErrors.AlreadyExistsError
+			if !errors.As(err, &alreadyExistsError) {
+				writeError(w, r, h.logger(r), "HandleShortenV2", err)
+				return
+			}
+			// respond with the existing link when URL violates unique constraint
+			link = modelurl.Link{SURL: alreadyExistsError.ValidSURL, URL: post.URL}
+			status = http.StatusConflict
+		}
+		h.logger(r).Debug("HandleShortenV2: stored", logger.String("url", link.URL), logger.String("sURL", link.SURL))
+		w.Header().Set("Content-Type", middleware.NegotiatedType(r.Context()))
+		w.WriteHeader(status)
+		err = encodeJSON(w, toResponseLink(*base, link))
+		if err != nil {
+			h.logger(r).Warn("HandleShortenV2", logger.Error(err))
+		}
+	}
+}
+
+// HandleShortenBatchV2 provides shortening service for batch processing using modeldto.RequestBatchURL and
+// modeldto.ResponseBatchLink schemas, responses are of the media type picked by middleware.Negotiate.
+func (h *URLHandler) HandleShortenBatchV2() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// bound DB operations by the timeout budget of the route
+		ctx, cancel := requestContext(r)
+		defer cancel()
+		// check for POST body content type compliance
+		if r.Header.Get("Content-Type") != "application/json" {
+			middleware.Error(w, r, "Invalid Content-Type", http.StatusBadRequest)
+			return
+		}
+		var post []modeldto.RequestBatchURL
+		err := decodeJSON(r.Body, &post)
+		if err != nil {
+			h.logger(r).Warn("HandleShortenBatchV2", logger.Error(err))
+			middleware.Error(w, r, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if len(post) == 0 {
+			middleware.Error(w, r, "empty request body received", http.StatusBadRequest)
+			return
+		}
+		userID, err := getUserID(r)
+		if err != nil {
+			h.logger(r).Error("HandleShortenBatchV2", logger.Error(err))
+			middleware.Error(w, r, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		base, err := url.Parse(h.serverConfig.BaseURL)
+		if err != nil {
+			h.logger(r).Error("HandleShortenBatchV2", logger.Error(err))
+			middleware.Error(w, r, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		URLs := make([]string, 0, len(post))
+		for _, requestBatchURL := range post {
+			URLs = append(URLs, requestBatchURL.URL)
+		}
+		sURLs, err := h.processor.EncodeBatch(ctx, URLs, userID)
+		if err != nil {
+			writeError(w, r, h.logger(r), "HandleShortenBatchV2", err)
+			return
+		}
+		responseBatchLinks := make([]modeldto.ResponseBatchLink, 0, len(post))
+		for i, requestBatchURL := range post {
+			responseBatchLinks = append(responseBatchLinks, modeldto.ResponseBatchLink{
+				CorrelationID: requestBatchURL.CorrelationID,
+				ID:            sURLs[i],
+				SURL:          shortURL(*base, sURLs[i], ""),
+				StatsURL:      statsURL(*base, sURLs[i]),
+			})
+		}
+		w.Header().Set("Content-Type", middleware.NegotiatedType(r.Context()))
+		w.WriteHeader(http.StatusCreated)
+		err = encodeJSON(w, responseBatchLinks)
+		if err != nil {
+			h.logger(r).Warn("HandleShortenBatchV2", logger.Error(err))
+		}
+	}
+}
+
+// toResponseLink converts link to modeldto.ResponseLink schema, stats and QR codes of links are served on the base
+// URL host whereas previews are served along with redirects.
+func toResponseLink(base url.URL, link modelurl.Link) modeldto.ResponseLink {
+	short := shortURL(base, link.SURL, link.Domain)
+	qr := base
+	qr.Path = "/" + link.SURL + "/qr"
+	return modeldto.ResponseLink{
+		ID:           link.SURL,
+		SURL:         short,
+		URL:          link.URL,
+		PreviewURL:   short + "+",
+		StatsURL:     statsURL(base, link.SURL),
+		QRURL:        qr.String(),
+		Domain:       link.Domain,
+		RedirectType: link.RedirectType,
+		ExpiresAt:    link.ExpiresAt,
+		ActiveFrom:   link.ActiveFrom,
+		MaxClicks:    link.MaxClicks,
+		Tags:         link.Tags,
+	}
+}
+
+// statsURL returns the URL of redirect stats of sURL.
+func statsURL(base url.URL, sURL string) string {
+	base.Path = "/api/urls/" + sURL + "/stats"
+	return base.String()
+}
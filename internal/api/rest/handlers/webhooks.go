@@ -0,0 +1,65 @@
+package handlers
+
+import (
+	"github.com/danilovkiri/dk_go_url_shortener/internal/api/rest/middleware"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/api/rest/modeldto"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/logger"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/webhook"
+	"net/http"
+)
+
+// WebhookHandler defines data structure handling webhook delivery status requests.
+type WebhookHandler struct {
+	dispatcher *webhook.Dispatcher
+	log        *logger.Logger
+}
+
+// InitWebhookHandler initializes a WebhookHandler object and sets its attributes, dispatcher is nil when webhooks are
+// disabled.
+func InitWebhookHandler(dispatcher *webhook.Dispatcher, log *logger.Logger) *WebhookHandler {
+	return &WebhookHandler{dispatcher: dispatcher, log: log}
+}
+
+// logger returns a request-scoped logger carried by r context or the handler one.
+func (h *WebhookHandler) logger(r *http.Request) *logger.Logger {
+	return logger.FromContext(r.Context(), h.log)
+}
+
+// HandleGetDeliveries provides recent webhook deliveries, newest first, using modeldto.ResponseWebhookDelivery
+// schema; an optional status query parameter filters them by delivery status.
+func (h *WebhookHandler) HandleGetDeliveries() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		status := r.URL.Query().Get("status")
+		switch status {
+		case "", webhook.StatusPending, webhook.StatusDelivered, webhook.StatusFailed:
+		default:
+			middleware.Error(w, r, "status must be one of pending, delivered and failed", http.StatusBadRequest)
+			return
+		}
+		responseDeliveries := make([]modeldto.ResponseWebhookDelivery, 0)
+		for _, delivery := range h.dispatcher.Deliveries() {
+			if status != "" && delivery.Status != status {
+				continue
+			}
+			responseDeliveries = append(responseDeliveries, modeldto.ResponseWebhookDelivery{
+				ID:             delivery.ID,
+				EventID:        delivery.EventID,
+				EventType:      delivery.EventType,
+				Target:         delivery.Target,
+				Status:         delivery.Status,
+				Attempts:       delivery.Attempts,
+				LastStatusCode: delivery.LastStatusCode,
+				LastError:      delivery.LastError,
+				CreatedAt:      delivery.CreatedAt,
+				UpdatedAt:      delivery.UpdatedAt,
+				NextAttemptAt:  delivery.NextAttemptAt,
+			})
+		}
+		// set and stream response body
+		w.Header().Set("Content-Type", "application/json")
+		err := encodeJSON(w, responseDeliveries)
+		if err != nil {
+			h.logger(r).Warn("HandleGetDeliveries", logger.Error(err))
+		}
+	}
+}
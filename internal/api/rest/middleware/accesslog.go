@@ -0,0 +1,118 @@
+package middleware
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/logger"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// combinedTimeFormat is the time format of the combined log format.
+const combinedTimeFormat = "02/Jan/2006:15:04:05 -0700"
+
+// accessWriter redefines http.ResponseWriter recording the response status code and the number of body bytes.
+type accessWriter struct {
+	statusWriter
+	size int
+}
+
+// Write method redefines statusWriter Write method.
+func (w *accessWriter) Write(b []byte) (int, error) {
+	n, err := w.statusWriter.Write(b)
+	w.size += n
+	return n, err
+}
+
+// accessEntry defines a JSON access log line.
+type accessEntry struct {
+	Time       time.Time `json:"time"`
+	RemoteAddr string    `json:"remote_addr"`
+	Method     string    `json:"method"`
+	URI        string    `json:"uri"`
+	Proto      string    `json:"proto"`
+	Status     int       `json:"status"`
+	Bytes      int       `json:"bytes"`
+	Referer    string    `json:"referer,omitempty"`
+	UserAgent  string    `json:"user_agent,omitempty"`
+	Duration   float64   `json:"duration_ms"`
+	RequestID  string    `json:"request_id,omitempty"`
+}
+
+// AccessLog returns a middleware handler writing a line per served request to out in the given format, either the
+// combined log format of Apache (logger.FormatCombined) or JSON (logger.FormatJSON). Remote users are not known at
+// this point and are logged as "-".
+func AccessLog(out io.Writer, format string) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			aw := &accessWriter{statusWriter: statusWriter{ResponseWriter: w}}
+			start := time.Now()
+			next.ServeHTTP(aw, r)
+			if aw.code == 0 {
+				aw.code = http.StatusOK
+			}
+			var line []byte
+			if format == logger.FormatJSON {
+				line, _ = json.Marshal(accessEntry{
+					Time:       start,
+					RemoteAddr: requestIP(r),
+					Method:     r.Method,
+					URI:        r.RequestURI,
+					Proto:      r.Proto,
+					Status:     aw.code,
+					Bytes:      aw.size,
+					Referer:    r.Referer(),
+					UserAgent:  r.UserAgent(),
+					Duration:   float64(time.Since(start).Microseconds()) / 1000,
+					RequestID:  RequestIDFromContext(r.Context()),
+				})
+				line = append(line, '\n')
+			} else {
+				line = []byte(combinedLine(r, start, aw.code, aw.size))
+			}
+			// a failing access log must not fail requests
+			_, _ = out.Write(line)
+		})
+	}
+}
+
+// combinedLine returns a line of the combined log format describing r served at start with status and size bytes.
+func combinedLine(r *http.Request, start time.Time, status, size int) string {
+	bytes := "-"
+	if size > 0 {
+		bytes = strconv.Itoa(size)
+	}
+	return fmt.Sprintf("%s - - [%s] \"%s %s %s\" %d %s \"%s\" \"%s\"\n",
+		requestIP(r),
+		start.Format(combinedTimeFormat),
+		escapeCombined(r.Method),
+		escapeCombined(r.RequestURI),
+		escapeCombined(r.Proto),
+		status,
+		bytes,
+		escapeCombined(r.Referer()),
+		escapeCombined(r.UserAgent()),
+	)
+}
+
+// escapeCombined escapes quotes, backslashes and non-printable characters of s the way Apache does, so that a field
+// cannot break the line into more fields or lines.
+func escapeCombined(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '"' || c == '\\':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		case c < 0x20 || c >= 0x7f:
+			fmt.Fprintf(&b, "\\x%02x", c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,55 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+
+	"github.com/danilovkiri/dk_go_url_shortener/internal/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAccessLog(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte("http://localhost:8080/abc"))
+	})
+	request := func() *http.Request {
+		r := httptest.NewRequest(http.MethodPost, "/?q=1", nil)
+		r.RemoteAddr = "192.168.1.10:51234"
+		r.Header.Set("Referer", "https://example.com/")
+		r.Header.Set("User-Agent", `curl "quoted"`)
+		return r
+	}
+
+	var out bytes.Buffer
+	AccessLog(&out, logger.FormatCombined)(handler).ServeHTTP(httptest.NewRecorder(), request())
+	assert.Regexp(t, regexp.MustCompile(`^192\.168\.1\.10 - - \[\d{2}/\w{3}/\d{4}:\d{2}:\d{2}:\d{2} [+-]\d{4}\] `+
+		`"POST /\?q=1 HTTP/1\.1" 201 25 "https://example\.com/" "curl \\"quoted\\""\n$`), out.String())
+
+	out.Reset()
+	AccessLog(&out, logger.FormatJSON)(handler).ServeHTTP(httptest.NewRecorder(), request())
+	var entry accessEntry
+	require.NoError(t, json.Unmarshal(out.Bytes(), &entry))
+	assert.Equal(t, "192.168.1.10", entry.RemoteAddr)
+	assert.Equal(t, "/?q=1", entry.URI)
+	assert.Equal(t, http.StatusCreated, entry.Status)
+	assert.Equal(t, 25, entry.Bytes)
+	assert.Equal(t, `curl "quoted"`, entry.UserAgent)
+
+	// empty bodies are logged as "-"
+	out.Reset()
+	empty := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+	AccessLog(&out, logger.FormatCombined)(empty).ServeHTTP(httptest.NewRecorder(), request())
+	assert.Contains(t, out.String(), `" 204 - "`)
+}
+
+func TestEscapeCombined(t *testing.T) {
+	assert.Equal(t, `a\"b\\c\x0ad\xc3\xa9`, escapeCombined("a\"b\\c\ndé"))
+}
@@ -0,0 +1,136 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/service/authenticator"
+	serviceErrors "github.com/danilovkiri/dk_go_url_shortener/internal/service/errors"
+	storageErrors "github.com/danilovkiri/dk_go_url_shortener/internal/storage/v2/errors"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// userIDContextKey is the request context key of the user ID resolved from an access token or API key.
+type userIDContextKey struct{}
+
+// roleContextKey is the request context key of the role claim of an access token.
+type roleContextKey struct{}
+
+// bearerPrefix prefixes access tokens in the Authorization header.
+const bearerPrefix = "Bearer "
+
+// defaultLookupTimeout bounds API key and role lookups of requests without a timeout budget.
+const defaultLookupTimeout = 500 * time.Millisecond
+
+// AuthHandler sets object structure.
+type AuthHandler struct {
+	auth authenticator.Authenticator
+}
+
+// NewAuthHandler initializes a new access token handler.
+func NewAuthHandler(auth authenticator.Authenticator) (*AuthHandler, error) {
+	if auth == nil {
+		return nil, &serviceErrors.ServiceFoundNilStorage{Msg: "nil authenticator was passed to service initializer"}
+	}
+	return &AuthHandler{auth: auth}, nil
+}
+
+// AuthHandle resolves user identity from a bearer access token or API key, requests without the Authorization header are passed
+// through to be identified by cookie.
+func (a *AuthHandler) AuthHandle(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header := r.Header.Get("Authorization")
+		if header == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if !strings.HasPrefix(header, bearerPrefix) {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			Error(w, r, "Unsupported authorization scheme", http.StatusUnauthorized)
+			return
+		}
+		userID, role, err := a.verify(r, strings.TrimPrefix(header, bearerPrefix))
+		if err != nil {
+			var invalidTokenError *serviceErrors.ServiceInvalidToken
+			var contextTimeoutExceededError *storageErrors.ContextTimeoutExceededError
+			switch {
+			case errors.As(err, &invalidTokenError):
+				w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+				Error(w, r, err.Error(), http.StatusUnauthorized)
+			case errors.As(err, &contextTimeoutExceededError):
+				Error(w, r, err.Error(), http.StatusGatewayTimeout)
+			default:
+				Error(w, r, err.Error(), http.StatusInternalServerError)
+			}
+			return
+		}
+		ctx := context.WithValue(r.Context(), userIDContextKey{}, userID)
+		if role != "" {
+			ctx = context.WithValue(ctx, roleContextKey{}, role)
+		}
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// verify resolves the user ID and the role of a bearer credential of r, API keys are looked up in storage while access
+// tokens are verified locally.
+func (a *AuthHandler) verify(r *http.Request, credential string) (userID, role string, err error) {
+	if !authenticator.IsAPIKey(credential) {
+		return a.auth.Verify(credential)
+	}
+	// bound DB operations by the timeout budget set for the whole router, route budgets are not set yet
+	ctx, cancel := Context(r, defaultLookupTimeout)
+	defer cancel()
+	userID, err = a.auth.VerifyAPIKey(ctx, credential)
+	return userID, "", err
+}
+
+// RequireAdmin lets through only requests whose access token resolved by AuthHandle carries the admin role claim of
+// an account still holding the admin role, so that revoking the role takes effect before the token expires. Requests
+// without an access token get 401 Unauthorized and other users get 403 Forbidden.
+func (a *AuthHandler) RequireAdmin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := UserIDFromContext(r.Context())
+		if !ok {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			Error(w, r, "access token is required", http.StatusUnauthorized)
+			return
+		}
+		if RoleFromContext(r.Context()) != authenticator.RoleAdmin {
+			Error(w, r, "access is allowed to admins only", http.StatusForbidden)
+			return
+		}
+		// bound DB operations by the timeout budget of the request
+		ctx, cancel := Context(r, defaultLookupTimeout)
+		defer cancel()
+		ok, err := a.auth.HasRole(ctx, userID, authenticator.RoleAdmin)
+		if err != nil {
+			var contextTimeoutExceededError *storageErrors.ContextTimeoutExceededError
+			if errors.As(err, &contextTimeoutExceededError) {
+				Error(w, r, err.Error(), http.StatusGatewayTimeout)
+				return
+			}
+			Error(w, r, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if !ok {
+			Error(w, r, "access is allowed to admins only", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// UserIDFromContext returns the user ID resolved from an access token or API key by AuthHandle.
+func UserIDFromContext(ctx context.Context) (string, bool) {
+	userID, ok := ctx.Value(userIDContextKey{}).(string)
+	return userID, ok
+}
+
+// RoleFromContext returns the role claim of the access token resolved by AuthHandle, it is empty for regular users and
+// API keys.
+func RoleFromContext(ctx context.Context) string {
+	role, _ := ctx.Value(roleContextKey{}).(string)
+	return role
+}
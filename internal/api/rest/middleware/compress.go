@@ -4,51 +4,197 @@ package middleware
 import (
 	"compress/gzip"
 	"io"
+	"mime"
 	"net/http"
+	"strconv"
 	"strings"
+	"sync"
 )
 
-// Type gzipWriter redefines http.ResponseWriter changing its Writer method to use gzip.
+// compressibleTypes lists media types and prefixes of media types of responses worth compressing.
+var compressibleTypes = []string{"application/json", "text/"}
+
+// Type gzipWriter redefines http.ResponseWriter holding the response back until minSize bytes are written and
+// compressing it with gzip if it is large enough and of a compressible type.
 type gzipWriter struct {
 	http.ResponseWriter
-	Writer io.Writer
+	minSize int
+	pool    *sync.Pool
+	status  int
+	buf     []byte
+	// started is set once the header is sent, gz is set if the response is compressed
+	started bool
+	gz      *gzip.Writer
+}
+
+// WriteHeader method redefines default http.ResponseWriter WriteHeader method postponing the header until the
+// response is known to be compressed or not.
+func (w *gzipWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
 }
 
 // Write method redefines default http.ResponseWriter Write method.
-func (w gzipWriter) Write(b []byte) (int, error) {
-	return w.Writer.Write(b)
+func (w *gzipWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	if !w.started {
+		w.buf = append(w.buf, b...)
+		if len(w.buf) < w.minSize {
+			return len(b), nil
+		}
+		return len(b), w.start(true)
+	}
+	if w.gz != nil {
+		return w.gz.Write(b)
+	}
+	return w.ResponseWriter.Write(b)
 }
 
-// CompressHandle serves as a middleware handler implementing gzip compressing.
-func CompressHandle(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if !strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") {
-			next.ServeHTTP(w, r)
+// Flush method implements http.Flusher, a flushed response is compressed regardless of its size.
+func (w *gzipWriter) Flush() {
+	if !w.started {
+		if w.status == 0 {
+			w.status = http.StatusOK
+		}
+		if w.start(true) != nil {
 			return
 		}
-		gz, err := gzip.NewWriterLevel(w, gzip.BestSpeed)
-		if err != nil {
-			io.WriteString(w, err.Error())
+	}
+	if w.gz != nil {
+		_ = w.gz.Flush()
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// start sends the header and the held back part of the response, compressing it if compress is set and the response
+// is of a compressible type.
+func (w *gzipWriter) start(compress bool) error {
+	w.started = true
+	h := w.Header()
+	if h.Get("Content-Type") == "" && len(w.buf) > 0 {
+		h.Set("Content-Type", http.DetectContentType(w.buf))
+	}
+	if compress && h.Get("Content-Encoding") == "" && isCompressible(h.Get("Content-Type")) {
+		h.Set("Content-Encoding", "gzip")
+		h.Del("Content-Length")
+		w.gz = w.pool.Get().(*gzip.Writer)
+		w.gz.Reset(w.ResponseWriter)
+	}
+	w.ResponseWriter.WriteHeader(w.status)
+	if len(w.buf) == 0 {
+		return nil
+	}
+	var err error
+	if w.gz != nil {
+		_, err = w.gz.Write(w.buf)
+	} else {
+		_, err = w.ResponseWriter.Write(w.buf)
+	}
+	w.buf = nil
+	return err
+}
+
+// close sends a response shorter than minSize as is and completes a compressed one.
+func (w *gzipWriter) close() {
+	if !w.started {
+		if w.status == 0 {
+			// nothing was written, the default response is left to the server
 			return
 		}
-		defer gz.Close()
-		w.Header().Set("Content-Encoding", "gzip")
-		next.ServeHTTP(gzipWriter{ResponseWriter: w, Writer: gz}, r)
-	})
+		_ = w.start(false)
+	}
+	if w.gz != nil {
+		_ = w.gz.Close()
+		w.gz.Reset(io.Discard)
+		w.pool.Put(w.gz)
+		w.gz = nil
+	}
 }
 
-// DecompressHandle serves as a middleware handler implementing gzip decompressing.
+// isCompressible reports whether responses of contentType are worth compressing.
+func isCompressible(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	for _, t := range compressibleTypes {
+		if mediaType == t || strings.HasSuffix(t, "/") && strings.HasPrefix(mediaType, t) {
+			return true
+		}
+	}
+	return false
+}
+
+// acceptsGzip reports whether the Accept-Encoding header value accepts gzip, i.e. lists gzip or * with a non-zero
+// quality.
+func acceptsGzip(acceptEncoding string) bool {
+	for _, item := range strings.Split(acceptEncoding, ",") {
+		params := strings.Split(item, ";")
+		coding := strings.ToLower(strings.TrimSpace(params[0]))
+		if coding != "gzip" && coding != "*" {
+			continue
+		}
+		accepted := true
+		for _, param := range params[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				q, err := strconv.ParseFloat(param[len("q="):], 64)
+				accepted = err == nil && q > 0
+			}
+		}
+		if accepted {
+			return true
+		}
+	}
+	return false
+}
+
+// Compress serves as a middleware compressing JSON and text responses of at least minSize bytes with gzip at level
+// for clients accepting it. The level must be valid for gzip.NewWriterLevel.
+func Compress(minSize, level int) func(http.Handler) http.Handler {
+	pool := &sync.Pool{New: func() interface{} {
+		gz, err := gzip.NewWriterLevel(io.Discard, level)
+		if err != nil {
+			panic(err)
+		}
+		return gz
+	}}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Add("Vary", "Accept-Encoding")
+			if !acceptsGzip(r.Header.Get("Accept-Encoding")) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			gw := &gzipWriter{ResponseWriter: w, minSize: minSize, pool: pool}
+			defer gw.close()
+			next.ServeHTTP(gw, r)
+		})
+	}
+}
+
+// DecompressHandle serves as a middleware handler implementing gzip decompressing of request bodies sent with
+// Content-Encoding: gzip, malformed ones are rejected.
 func DecompressHandle(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if !strings.Contains(r.Header.Get("Content-Encoding"), "gzip") {
+		if !strings.EqualFold(strings.TrimSpace(r.Header.Get("Content-Encoding")), "gzip") {
 			next.ServeHTTP(w, r)
 			return
 		}
 		gz, err := gzip.NewReader(r.Body)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			Error(w, r, "request body is not valid gzip", http.StatusBadRequest)
 			return
 		}
+		defer gz.Close()
+		r.Header.Del("Content-Encoding")
+		r.Header.Del("Content-Length")
+		r.ContentLength = -1
 		r.Body = gz
 		next.ServeHTTP(w, r)
 	})
@@ -0,0 +1,96 @@
+package middleware
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompress(t *testing.T) {
+	h := Compress(16, gzip.BestSpeed)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/qr":
+			w.Header().Set("Content-Type", "image/png")
+		case "/empty":
+			w.WriteHeader(http.StatusNoContent)
+			return
+		default:
+			w.Header().Set("Content-Type", "application/json")
+		}
+		w.WriteHeader(http.StatusCreated)
+		// the response is written in parts to cross the minimum size in the middle of a write
+		for _, part := range strings.SplitAfter(r.URL.Query().Get("body"), ",") {
+			_, _ = w.Write([]byte(part))
+		}
+	}))
+	request := func(target, acceptEncoding string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, target, nil)
+		r.Header.Set("Accept-Encoding", acceptEncoding)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w
+	}
+	body := `{"result":"http://localhost:8080/abc","extra":"x"}`
+
+	w := request("/api/shorten?body="+body, "deflate, gzip;q=0.5")
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Equal(t, "gzip", w.Header().Get("Content-Encoding"))
+	assert.Equal(t, "Accept-Encoding", w.Header().Get("Vary"))
+	gz, err := gzip.NewReader(w.Body)
+	require.NoError(t, err)
+	decompressed, err := ioutil.ReadAll(gz)
+	require.NoError(t, err)
+	assert.Equal(t, body, string(decompressed))
+
+	// short responses, other types and clients not accepting gzip get the response as is
+	for _, w := range []*httptest.ResponseRecorder{
+		request("/api/shorten?body={}", "gzip"),
+		request("/qr?body="+body, "gzip"),
+		request("/api/shorten?body="+body, "gzip;q=0, deflate"),
+	} {
+		assert.Equal(t, http.StatusCreated, w.Code)
+		assert.Empty(t, w.Header().Get("Content-Encoding"))
+	}
+	assert.Equal(t, body, request("/qr?body="+body, "gzip").Body.String())
+
+	w = request("/empty", "gzip")
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Empty(t, w.Header().Get("Content-Encoding"))
+	assert.Zero(t, w.Body.Len())
+}
+
+func TestDecompressHandle(t *testing.T) {
+	h := DecompressHandle(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		_, _ = w.Write(body)
+	}))
+	var compressed bytes.Buffer
+	gz := gzip.NewWriter(&compressed)
+	_, err := gz.Write([]byte(`{"url":"https://example.com"}`))
+	require.NoError(t, err)
+	require.NoError(t, gz.Close())
+
+	r := httptest.NewRequest(http.MethodPost, "/api/shorten", &compressed)
+	r.Header.Set("Content-Encoding", "gzip")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, `{"url":"https://example.com"}`, w.Body.String())
+
+	r = httptest.NewRequest(http.MethodPost, "/api/shorten", strings.NewReader(`{"url":"https://example.com"}`))
+	r.Header.Set("Content-Encoding", "gzip")
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
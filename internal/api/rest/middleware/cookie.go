@@ -30,9 +30,14 @@ func NewCookieHandler(sec secretary.Secretary, cfg *config.SecretConfig) (*Cooki
 	}, nil
 }
 
-// CookieHandle provides cookie handling functionality.
+// CookieHandle provides cookie handling functionality, requests already identified by an access token are passed
+// through without a cookie.
 func (c *CookieHandler) CookieHandle(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := UserIDFromContext(r.Context()); ok {
+			next.ServeHTTP(w, r)
+			return
+		}
 		cookie, err := r.Cookie(UserCookieKey)
 		if errors.Is(err, http.ErrNoCookie) {
 			userID := uuid.New().String()
@@ -45,11 +50,13 @@ func (c *CookieHandler) CookieHandle(next http.Handler) http.Handler {
 			http.SetCookie(w, newCookie)
 			r.AddCookie(newCookie)
 		} else if err != nil {
-			http.Error(w, "Cookie crumbled", http.StatusInternalServerError)
+			Error(w, r, "Cookie crumbled", http.StatusInternalServerError)
+			return
 		} else {
 			_, err := c.sec.Decode(cookie.Value)
 			if err != nil {
-				http.Error(w, err.Error(), http.StatusUnauthorized)
+				Error(w, r, err.Error(), http.StatusUnauthorized)
+				return
 			}
 		}
 		next.ServeHTTP(w, r)
@@ -0,0 +1,128 @@
+package middleware
+
+import (
+	"github.com/danilovkiri/dk_go_url_shortener/internal/config"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// CORSHandler answers cross-origin requests of browsers from allowed origins.
+type CORSHandler struct {
+	// origins holds allowed origins, wildcards holds the scheme and the parent domain of "*." origins as
+	// "https://" and ".example.com"
+	origins          map[string]bool
+	wildcards        [][2]string
+	anyOrigin        bool
+	methods          map[string]bool
+	allowMethods     string
+	headers          map[string]bool
+	exposeHeaders    string
+	allowCredentials bool
+	maxAge           string
+}
+
+// NewCORSHandler initializes a CORSHandler as configured by cfg.
+func NewCORSHandler(cfg *config.CORSConfig) *CORSHandler {
+	h := &CORSHandler{
+		origins:          make(map[string]bool),
+		methods:          make(map[string]bool),
+		headers:          make(map[string]bool),
+		allowMethods:     strings.Join(cfg.AllowedMethods, ", "),
+		exposeHeaders:    strings.Join(cfg.ExposedHeaders, ", "),
+		allowCredentials: cfg.AllowCredentials,
+		maxAge:           strconv.Itoa(int(cfg.MaxAge.Seconds())),
+	}
+	for _, origin := range cfg.AllowedOrigins {
+		origin = strings.ToLower(origin)
+		switch {
+		case origin == "*":
+			h.anyOrigin = true
+		case strings.Contains(origin, "://*."):
+			i := strings.Index(origin, "://*.")
+			h.wildcards = append(h.wildcards, [2]string{origin[:i+len("://")], origin[i+len("://*"):]})
+		default:
+			h.origins[origin] = true
+		}
+	}
+	for _, method := range cfg.AllowedMethods {
+		h.methods[method] = true
+	}
+	for _, header := range cfg.AllowedHeaders {
+		h.headers[http.CanonicalHeaderKey(strings.TrimSpace(header))] = true
+	}
+	return h
+}
+
+// allowsOrigin checks whether origin is allowed.
+func (h *CORSHandler) allowsOrigin(origin string) bool {
+	origin = strings.ToLower(origin)
+	if h.anyOrigin || h.origins[origin] {
+		return true
+	}
+	for _, w := range h.wildcards {
+		if strings.HasPrefix(origin, w[0]) && strings.HasSuffix(origin, w[1]) && len(origin) > len(w[0])+len(w[1]) {
+			return true
+		}
+	}
+	return false
+}
+
+// allowsHeaders checks whether every header of the comma-separated list requested is allowed.
+func (h *CORSHandler) allowsHeaders(requested string) bool {
+	for _, header := range strings.Split(requested, ",") {
+		header = strings.TrimSpace(header)
+		if header != "" && !h.headers[http.CanonicalHeaderKey(header)] {
+			return false
+		}
+	}
+	return true
+}
+
+// setOrigin sets headers allowing the response to be read by origin.
+func (h *CORSHandler) setOrigin(header http.Header, origin string) {
+	if h.anyOrigin && !h.allowCredentials {
+		header.Set("Access-Control-Allow-Origin", "*")
+	} else {
+		header.Set("Access-Control-Allow-Origin", origin)
+	}
+	if h.allowCredentials {
+		header.Set("Access-Control-Allow-Credentials", "true")
+	}
+}
+
+// CORSHandle serves as a middleware handler answering preflight requests from allowed origins and allowing responses
+// to other requests from them to be read, preflight requests of disallowed origins, methods or headers are rejected.
+// Requests are passed on regardless of their origin since it is browsers enforcing CORS.
+func (h *CORSHandler) CORSHandle(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		requestMethod := r.Header.Get("Access-Control-Request-Method")
+		if r.Method == http.MethodOptions && origin != "" && requestMethod != "" {
+			w.Header().Add("Vary", "Origin")
+			w.Header().Add("Vary", "Access-Control-Request-Method")
+			w.Header().Add("Vary", "Access-Control-Request-Headers")
+			requestHeaders := r.Header.Get("Access-Control-Request-Headers")
+			if !h.allowsOrigin(origin) || !h.methods[requestMethod] || !h.allowsHeaders(requestHeaders) {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			h.setOrigin(w.Header(), origin)
+			w.Header().Set("Access-Control-Allow-Methods", h.allowMethods)
+			if requestHeaders != "" {
+				w.Header().Set("Access-Control-Allow-Headers", requestHeaders)
+			}
+			w.Header().Set("Access-Control-Max-Age", h.maxAge)
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		w.Header().Add("Vary", "Origin")
+		if origin != "" && h.allowsOrigin(origin) {
+			h.setOrigin(w.Header(), origin)
+			if h.exposeHeaders != "" {
+				w.Header().Set("Access-Control-Expose-Headers", h.exposeHeaders)
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,74 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/danilovkiri/dk_go_url_shortener/internal/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCORSHandle(t *testing.T) {
+	h := NewCORSHandler(&config.CORSConfig{
+		AllowedOrigins:   []string{"https://dashboard.example", "https://*.example.com"},
+		AllowedMethods:   []string{"GET", "POST"},
+		AllowedHeaders:   []string{"Content-Type", "Authorization"},
+		ExposedHeaders:   []string{"Location"},
+		AllowCredentials: true,
+		MaxAge:           10 * time.Minute,
+	}).CORSHandle(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+	}))
+	request := func(method, origin string, header map[string]string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, "/api/shorten", nil)
+		if origin != "" {
+			r.Header.Set("Origin", origin)
+		}
+		for k, v := range header {
+			r.Header.Set(k, v)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w
+	}
+
+	w := request(http.MethodOptions, "https://dashboard.example", map[string]string{
+		"Access-Control-Request-Method":  "POST",
+		"Access-Control-Request-Headers": "content-type, authorization",
+	})
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Equal(t, "https://dashboard.example", w.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "true", w.Header().Get("Access-Control-Allow-Credentials"))
+	assert.Equal(t, "GET, POST", w.Header().Get("Access-Control-Allow-Methods"))
+	assert.Equal(t, "content-type, authorization", w.Header().Get("Access-Control-Allow-Headers"))
+	assert.Equal(t, "600", w.Header().Get("Access-Control-Max-Age"))
+
+	// disallowed origins, methods and headers fail preflight
+	for _, w := range []*httptest.ResponseRecorder{
+		request(http.MethodOptions, "https://evil.example", map[string]string{"Access-Control-Request-Method": "POST"}),
+		request(http.MethodOptions, "https://example.com", map[string]string{"Access-Control-Request-Method": "POST"}),
+		request(http.MethodOptions, "https://dashboard.example", map[string]string{"Access-Control-Request-Method": "DELETE"}),
+		request(http.MethodOptions, "https://dashboard.example", map[string]string{
+			"Access-Control-Request-Method":  "POST",
+			"Access-Control-Request-Headers": "X-Custom",
+		}),
+	} {
+		assert.Equal(t, http.StatusForbidden, w.Code)
+		assert.Empty(t, w.Header().Get("Access-Control-Allow-Origin"))
+	}
+
+	// actual requests are passed on, only allowed origins may read responses
+	w = request(http.MethodPost, "https://app.example.com", nil)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Equal(t, "https://app.example.com", w.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "Location", w.Header().Get("Access-Control-Expose-Headers"))
+	assert.Equal(t, "Origin", w.Header().Get("Vary"))
+	w = request(http.MethodPost, "https://evil.example", nil)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Empty(t, w.Header().Get("Access-Control-Allow-Origin"))
+	w = request(http.MethodPost, "", nil)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Empty(t, w.Header().Get("Access-Control-Allow-Origin"))
+}
@@ -0,0 +1,38 @@
+package middleware
+
+import (
+	"context"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/logger"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/tracing"
+	"net/http"
+	"time"
+)
+
+// LogRequests returns a middleware handler attaching the request ID and a logger with request ID, method and path
+// fields (and the trace ID of a traced request) to the request context, returning the request ID in the response and
+// logging served requests. The request ID is recorded by the span of a traced request as well.
+func LogRequests(log *logger.Logger) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requestID := requestID(r)
+			w.Header().Set(RequestIDHeader, requestID)
+			requestLog := log.With(
+				logger.String("request_id", requestID),
+				logger.String("method", r.Method),
+				logger.String("path", r.URL.Path),
+			)
+			if span := tracing.SpanFromContext(r.Context()); span.SpanContext().IsValid() {
+				requestLog = requestLog.With(logger.String("trace_id", span.SpanContext().TraceID.String()))
+				span.SetAttributes(tracing.String("http.request_id", requestID))
+			}
+			sw := &statusWriter{ResponseWriter: w}
+			start := time.Now()
+			ctx := context.WithValue(r.Context(), requestIDContextKey{}, requestID)
+			next.ServeHTTP(sw, r.WithContext(logger.NewContext(ctx, requestLog)))
+			if sw.code == 0 {
+				sw.code = http.StatusOK
+			}
+			requestLog.Info("Request served", logger.Int("status", sw.code), logger.Duration("duration", time.Since(start)))
+		})
+	}
+}
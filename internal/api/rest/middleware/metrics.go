@@ -0,0 +1,44 @@
+// Package middleware provides various middleware functionality.
+package middleware
+
+import (
+	"github.com/danilovkiri/dk_go_url_shortener/internal/metrics"
+	"net/http"
+	"strconv"
+)
+
+// Type statusWriter redefines http.ResponseWriter recording the response status code.
+type statusWriter struct {
+	http.ResponseWriter
+	code int
+}
+
+// WriteHeader method redefines default http.ResponseWriter WriteHeader method.
+func (w *statusWriter) WriteHeader(code int) {
+	if w.code == 0 {
+		w.code = code
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+// Write method redefines default http.ResponseWriter Write method.
+func (w *statusWriter) Write(b []byte) (int, error) {
+	if w.code == 0 {
+		w.code = http.StatusOK
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// CountRequests returns a middleware handler counting requests by response status code.
+func CountRequests(counter *metrics.CounterVec) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			sw := &statusWriter{ResponseWriter: w}
+			next.ServeHTTP(sw, r)
+			if sw.code == 0 {
+				sw.code = http.StatusOK
+			}
+			counter.Inc(strconv.Itoa(sw.code))
+		})
+	}
+}
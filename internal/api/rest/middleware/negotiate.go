@@ -0,0 +1,79 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// negotiatedTypeContextKey is a key of the media type picked by Negotiate in the request context.
+type negotiatedTypeContextKey struct{}
+
+// Negotiate picks the media type of responses among offers by the Accept header of requests, offers are listed in the
+// order of preference among equally accepted ones. Requests without the header get the first offer, ones accepting
+// none of offers are answered with 406.
+func Negotiate(offers ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mediaType := negotiate(r.Header.Get("Accept"), offers)
+			if mediaType == "" {
+				Error(w, r, "none of the media types "+strings.Join(offers, ", ")+" is accepted", http.StatusNotAcceptable)
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), negotiatedTypeContextKey{}, mediaType)))
+		})
+	}
+}
+
+// NegotiatedType returns the media type picked by Negotiate for the request of ctx, empty if there is none.
+func NegotiatedType(ctx context.Context) string {
+	mediaType, _ := ctx.Value(negotiatedTypeContextKey{}).(string)
+	return mediaType
+}
+
+// negotiate returns the offer of the highest quality in accept, the first one of equal quality and the most specific
+// matching media range. An empty accept takes any offer, empty is returned when no offer is accepted.
+func negotiate(accept string, offers []string) string {
+	if strings.TrimSpace(accept) == "" {
+		return offers[0]
+	}
+	best, bestQuality := "", 0.0
+	for _, offer := range offers {
+		quality, specificity := 0.0, -1
+		for _, mediaRange := range strings.Split(accept, ",") {
+			params := strings.Split(mediaRange, ";")
+			name := strings.ToLower(strings.TrimSpace(params[0]))
+			matched := -1
+			switch {
+			case name == offer:
+				matched = 2
+			case name == "*/*":
+				matched = 0
+			case strings.HasSuffix(name, "/*") && strings.HasPrefix(offer, strings.TrimSuffix(name, "*")):
+				matched = 1
+			}
+			// the most specific media range matching the offer sets its quality
+			if matched <= specificity {
+				continue
+			}
+			specificity, quality = matched, 1
+			for _, param := range params[1:] {
+				key, value := param, ""
+				if i := strings.Index(param, "="); i >= 0 {
+					key, value = param[:i], param[i+1:]
+				}
+				if strings.EqualFold(strings.TrimSpace(key), "q") {
+					q, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+					if err == nil {
+						quality = q
+					}
+				}
+			}
+		}
+		if quality > bestQuality {
+			best, bestQuality = offer, quality
+		}
+	}
+	return best
+}
@@ -0,0 +1,46 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNegotiate(t *testing.T) {
+	const vendor = "application/vnd.shortener.v2+json"
+	var picked string
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		picked = NegotiatedType(r.Context())
+	})
+	tests := []struct {
+		name   string
+		accept string
+		code   int
+		picked string
+	}{
+		{"no Accept header", "", http.StatusOK, "application/json"},
+		{"any media type", "*/*", http.StatusOK, "application/json"},
+		{"vendor media type", vendor, http.StatusOK, vendor},
+		{"media type case", "Application/JSON", http.StatusOK, "application/json"},
+		{"subtype wildcard", "application/*", http.StatusOK, "application/json"},
+		{"higher quality", "application/json;q=0.5, " + vendor, http.StatusOK, vendor},
+		{"specific range overrides wildcard", "*/*;q=1, application/json;q=0", http.StatusOK, vendor},
+		{"zero quality", "application/json;q=0", http.StatusNotAcceptable, ""},
+		{"unsupported media type", "text/html", http.StatusNotAcceptable, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			picked = ""
+			r := httptest.NewRequest(http.MethodPost, "/api/v2/shorten", nil)
+			if tt.accept != "" {
+				r.Header.Set("Accept", tt.accept)
+			}
+			w := httptest.NewRecorder()
+			Negotiate("application/json", vendor)(ok).ServeHTTP(w, r)
+			assert.Equal(t, tt.code, w.Code)
+			assert.Equal(t, tt.picked, picked)
+		})
+	}
+}
@@ -0,0 +1,29 @@
+package middleware
+
+import (
+	"encoding/json"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/api/rest/modeldto"
+	"net/http"
+)
+
+// ProblemContentType is the media type of error responses.
+const ProblemContentType = "application/problem+json"
+
+// Error replies to r with RFC 7807 problem details of the error msg and HTTP code, the problem type is left blank so
+// that the title is the status text of code. The request ID of r is included so that clients can refer to the request
+// when reporting a problem.
+func Error(w http.ResponseWriter, r *http.Request, msg string, code int) {
+	h := w.Header()
+	h.Del("Content-Length")
+	h.Set("Content-Type", ProblemContentType)
+	h.Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(modeldto.ResponseProblem{
+		Type:      "about:blank",
+		Title:     http.StatusText(code),
+		Status:    code,
+		Detail:    msg,
+		Instance:  r.URL.Path,
+		RequestID: RequestIDFromContext(r.Context()),
+	})
+}
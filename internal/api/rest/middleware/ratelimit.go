@@ -0,0 +1,178 @@
+package middleware
+
+import (
+	"github.com/danilovkiri/dk_go_url_shortener/internal/config"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// sweepInterval sets how often buckets refilled to capacity are evicted, such buckets are indistinguishable from
+// absent ones.
+const sweepInterval = time.Minute
+
+// bucket is a token bucket holding up to burst tokens and refilled at rate tokens per second.
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// limit defines token bucket parameters shared by all buckets of one kind.
+type limit struct {
+	rate  float64
+	burst float64
+}
+
+// refill adds tokens accumulated since the last update and returns the bucket, a missing bucket is created full.
+func (l limit) refill(b *bucket, now time.Time) *bucket {
+	if b == nil {
+		return &bucket{tokens: l.burst, last: now}
+	}
+	if elapsed := now.Sub(b.last).Seconds(); elapsed > 0 {
+		b.tokens = math.Min(l.burst, b.tokens+elapsed*l.rate)
+		b.last = now
+	}
+	return b
+}
+
+// wait returns how long b has to refill up to one token.
+func (l limit) wait(b *bucket) time.Duration {
+	return time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+}
+
+// RateLimiter sets object structure, it keeps a token bucket per user and per client IP.
+type RateLimiter struct {
+	mu        sync.Mutex
+	user      limit
+	ip        limit
+	users     map[string]*bucket
+	ips       map[string]*bucket
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+// NewRateLimiter initializes a new rate limiter.
+func NewRateLimiter(cfg *config.RateLimitConfig) *RateLimiter {
+	return &RateLimiter{
+		user:  limit{rate: cfg.UserRPS, burst: float64(cfg.UserBurst)},
+		ip:    limit{rate: cfg.IPRPS, burst: float64(cfg.IPBurst)},
+		users: make(map[string]*bucket),
+		ips:   make(map[string]*bucket),
+		now:   time.Now,
+	}
+}
+
+// SetLimits replaces token bucket parameters with those of cfg, existing buckets keep their tokens up to the new
+// burst so that clients are not granted a fresh burst on every change.
+func (l *RateLimiter) SetLimits(cfg *config.RateLimitConfig) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.user = limit{rate: cfg.UserRPS, burst: float64(cfg.UserBurst)}
+	l.ip = limit{rate: cfg.IPRPS, burst: float64(cfg.IPBurst)}
+	for _, kind := range []struct {
+		limit   limit
+		buckets map[string]*bucket
+	}{{l.user, l.users}, {l.ip, l.ips}} {
+		for _, b := range kind.buckets {
+			b.tokens = math.Min(b.tokens, kind.limit.burst)
+		}
+	}
+}
+
+// LimitHandle rejects requests with 429 Too Many Requests and a Retry-After header once either the user or the client
+// IP bucket is exhausted. A token is taken from both buckets only when both allow the request. It must follow
+// AuthHandle and CookieHandle so that the user is already identified.
+func (l *RateLimiter) LimitHandle(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		retryAfter, ok := l.allow(requestUser(r), requestIP(r))
+		if !ok {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+			Error(w, r, "Too many requests", http.StatusTooManyRequests)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// allow takes a token from the user and the IP buckets if both have one, otherwise it returns the time left until
+// the request would be allowed.
+func (l *RateLimiter) allow(user, ip string) (time.Duration, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+	l.sweep(now)
+	var userBucket, ipBucket *bucket
+	var retryAfter time.Duration
+	if l.user.rate > 0 && user != "" {
+		userBucket = l.user.refill(l.users[user], now)
+		l.users[user] = userBucket
+		if userBucket.tokens < 1 {
+			retryAfter = l.user.wait(userBucket)
+		}
+	}
+	if l.ip.rate > 0 && ip != "" {
+		ipBucket = l.ip.refill(l.ips[ip], now)
+		l.ips[ip] = ipBucket
+		if ipBucket.tokens < 1 {
+			if wait := l.ip.wait(ipBucket); wait > retryAfter {
+				retryAfter = wait
+			}
+		}
+	}
+	if retryAfter > 0 {
+		return retryAfter, false
+	}
+	if userBucket != nil {
+		userBucket.tokens--
+	}
+	if ipBucket != nil {
+		ipBucket.tokens--
+	}
+	return 0, true
+}
+
+// sweep evicts buckets refilled to capacity, it runs at most once per sweepInterval.
+func (l *RateLimiter) sweep(now time.Time) {
+	if l.lastSweep.IsZero() {
+		l.lastSweep = now
+	}
+	if now.Sub(l.lastSweep) < sweepInterval {
+		return
+	}
+	l.lastSweep = now
+	for _, kind := range []struct {
+		limit   limit
+		buckets map[string]*bucket
+	}{{l.user, l.users}, {l.ip, l.ips}} {
+		for key, b := range kind.buckets {
+			if kind.limit.refill(b, now).tokens >= kind.limit.burst {
+				delete(kind.buckets, key)
+			}
+		}
+	}
+}
+
+// requestUser returns the user identified by an access token or, failing that, by the user cookie validated in
+// CookieHandle.
+func requestUser(r *http.Request) string {
+	if userID, ok := UserIDFromContext(r.Context()); ok {
+		return "token:" + userID
+	}
+	if cookie, err := r.Cookie(UserCookieKey); err == nil {
+		return "cookie:" + cookie.Value
+	}
+	return ""
+}
+
+// requestIP returns the client IP of the connection, forwarding headers are not trusted since they are set by
+// clients.
+func requestIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,70 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/danilovkiri/dk_go_url_shortener/internal/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRateLimiter(t *testing.T) {
+	now := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	l := NewRateLimiter(&config.RateLimitConfig{UserRPS: 1, UserBurst: 2, IPRPS: 2, IPBurst: 3})
+	l.now = func() time.Time { return now }
+	h := l.LimitHandle(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+	}))
+	request := func(userID, remoteAddr string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, "/api/shorten", nil)
+		r.RemoteAddr = remoteAddr
+		r = r.WithContext(context.WithValue(r.Context(), userIDContextKey{}, userID))
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w
+	}
+
+	// the user burst is exhausted first
+	assert.Equal(t, http.StatusCreated, request("alice", "10.0.0.1:1000").Code)
+	assert.Equal(t, http.StatusCreated, request("alice", "10.0.0.1:1001").Code)
+	w := request("alice", "10.0.0.1:1002")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "1", w.Header().Get("Retry-After"))
+	// another user from the same IP takes the last IP token, the rejected request above took none
+	assert.Equal(t, http.StatusCreated, request("bob", "10.0.0.1:1003").Code)
+	w = request("bob", "10.0.0.1:1004")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "1", w.Header().Get("Retry-After"))
+	// other IPs are not affected
+	assert.Equal(t, http.StatusCreated, request("carol", "10.0.0.2:1000").Code)
+	// buckets refill over time
+	now = now.Add(time.Second)
+	assert.Equal(t, http.StatusCreated, request("alice", "10.0.0.1:1005").Code)
+	assert.Equal(t, http.StatusTooManyRequests, request("alice", "10.0.0.1:1006").Code)
+	// idle buckets are evicted once full
+	now = now.Add(sweepInterval)
+	request("carol", "10.0.0.2:1001")
+	assert.Len(t, l.users, 1)
+	assert.Len(t, l.ips, 1)
+}
+
+func TestRateLimiterSetLimits(t *testing.T) {
+	now := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	l := NewRateLimiter(&config.RateLimitConfig{UserRPS: 1, UserBurst: 5})
+	l.now = func() time.Time { return now }
+	_, ok := l.allow("alice", "10.0.0.1")
+	assert.True(t, ok)
+	// buckets are capped at the new burst
+	l.SetLimits(&config.RateLimitConfig{UserRPS: 1, UserBurst: 1})
+	_, ok = l.allow("alice", "10.0.0.1")
+	assert.True(t, ok)
+	_, ok = l.allow("alice", "10.0.0.1")
+	assert.False(t, ok)
+	// zero rates disable limits
+	l.SetLimits(&config.RateLimitConfig{})
+	_, ok = l.allow("alice", "10.0.0.1")
+	assert.True(t, ok)
+}
@@ -0,0 +1,42 @@
+package middleware
+
+import (
+	"github.com/danilovkiri/dk_go_url_shortener/internal/errreport"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/logger"
+	"net/http"
+	"runtime/debug"
+)
+
+// Recover returns a middleware handler answering requests whose handlers panic with 500 problem details, panics are
+// logged along with the stack trace and reported to reporter (unless it is nil) along with the method, path and request
+// ID. Responses already started when the handler panics cannot be answered with 500 and are aborted instead, so that
+// clients do not take a truncated response for a complete one. http.ErrAbortHandler panics abort the response as
+// net/http does and are not reported.
+func Recover(reporter *errreport.Reporter, log *logger.Logger) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			sw := &statusWriter{ResponseWriter: w}
+			defer func() {
+				value := recover()
+				if value == nil {
+					return
+				}
+				if value == http.ErrAbortHandler {
+					panic(value)
+				}
+				stack := debug.Stack()
+				logger.FromContext(r.Context(), log).Error("Request panicked", logger.Any("panic", value), logger.String("stack", string(stack)))
+				reporter.ReportPanic(value, stack, map[string]string{
+					"method":     r.Method,
+					"path":       r.URL.Path,
+					"request_id": RequestIDFromContext(r.Context()),
+				})
+				if sw.code != 0 {
+					panic(http.ErrAbortHandler)
+				}
+				Error(sw, r, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			}()
+			next.ServeHTTP(sw, r)
+		})
+	}
+}
@@ -0,0 +1,69 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/danilovkiri/dk_go_url_shortener/internal/config"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/errreport"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecover(t *testing.T) {
+	events := make(chan errreport.Event, 1)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var event errreport.Event
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&event))
+		events <- event
+	}))
+	defer ts.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	reporter, err := errreport.NewReporter(ctx, &config.ErrorReportConfig{
+		DSN:        strings.Replace(ts.URL, "://", "://key@", 1) + "/1",
+		SampleRate: 1,
+		QueueSize:  1,
+		Timeout:    time.Second,
+	}, nil)
+	require.NoError(t, err)
+	panicking := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	})
+
+	r := httptest.NewRequest(http.MethodGet, "/abc", nil)
+	w := httptest.NewRecorder()
+	Recover(reporter, nil)(panicking).ServeHTTP(w, r)
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Equal(t, ProblemContentType, w.Header().Get("Content-Type"))
+	event := <-events
+	assert.Equal(t, "boom", event.Message)
+	assert.Equal(t, "/abc", event.Tags["path"])
+	assert.Contains(t, event.Extra["stack"], "TestRecover")
+
+	// panics are recovered without a reporter as well
+	w = httptest.NewRecorder()
+	Recover(nil, nil)(panicking).ServeHTTP(w, r)
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+
+	// started responses are aborted
+	started := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("partial"))
+		panic("boom")
+	})
+	assert.PanicsWithValue(t, http.ErrAbortHandler, func() {
+		Recover(nil, nil)(started).ServeHTTP(httptest.NewRecorder(), r)
+	})
+
+	aborting := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic(http.ErrAbortHandler)
+	})
+	assert.PanicsWithValue(t, http.ErrAbortHandler, func() {
+		Recover(nil, nil)(aborting).ServeHTTP(httptest.NewRecorder(), r)
+	})
+}
@@ -0,0 +1,39 @@
+package middleware
+
+import (
+	"context"
+	"github.com/google/uuid"
+	"net/http"
+)
+
+// RequestIDHeader sets a header carrying the request ID, it is taken from the request when present and generated
+// otherwise.
+const RequestIDHeader = "X-Request-ID"
+
+// maxRequestIDLength limits the length of request IDs taken from requests.
+const maxRequestIDLength = 128
+
+// requestIDContextKey is a key of the request ID in the request context.
+type requestIDContextKey struct{}
+
+// requestID returns the request ID of r: the one it carries when it is short and printable (it ends up in logs and
+// responses) or a newly generated one otherwise.
+func requestID(r *http.Request) string {
+	id := r.Header.Get(RequestIDHeader)
+	if id == "" || len(id) > maxRequestIDLength {
+		return uuid.New().String()
+	}
+	for i := 0; i < len(id); i++ {
+		c := id[i]
+		if !('a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' || c == '-' || c == '_' || c == '.' || c == ':') {
+			return uuid.New().String()
+		}
+	}
+	return id
+}
+
+// RequestIDFromContext returns the request ID attached to ctx by LogRequests, empty if there is none.
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDContextKey{}).(string)
+	return id
+}
@@ -0,0 +1,64 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/danilovkiri/dk_go_url_shortener/internal/api/rest/modeldto"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequestID(t *testing.T) {
+	var logs bytes.Buffer
+	log, err := logger.New(&logs, logger.LevelInfo, logger.FormatText)
+	require.NoError(t, err)
+	var seen string
+	h := LogRequests(log)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = RequestIDFromContext(r.Context())
+		Error(w, r, "short URL not found", http.StatusNotFound)
+	}))
+	request := func(requestID string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, "/abc", nil)
+		if requestID != "" {
+			r.Header.Set(RequestIDHeader, requestID)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w
+	}
+
+	// incoming request IDs are honored
+	w := request("req-42")
+	assert.Equal(t, "req-42", seen)
+	assert.Equal(t, "req-42", w.Header().Get(RequestIDHeader))
+	var problem modeldto.ResponseProblem
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &problem))
+	assert.Equal(t, modeldto.ResponseProblem{
+		Type:      "about:blank",
+		Title:     "Not Found",
+		Status:    http.StatusNotFound,
+		Detail:    "short URL not found",
+		Instance:  "/abc",
+		RequestID: "req-42",
+	}, problem)
+	assert.Contains(t, logs.String(), "request_id=req-42")
+
+	// missing and unprintable ones are replaced with generated IDs
+	for _, requestID := range []string{"", "forged\nlevel=error", strings.Repeat("a", maxRequestIDLength+1)} {
+		w = request(requestID)
+		assert.Len(t, seen, 36)
+		assert.Equal(t, seen, w.Header().Get(RequestIDHeader))
+	}
+
+	// responses outside of LogRequests carry no request ID
+	w = httptest.NewRecorder()
+	Error(w, httptest.NewRequest(http.MethodGet, "/abc", nil), "short URL not found", http.StatusNotFound)
+	assert.Equal(t, ProblemContentType, w.Header().Get("Content-Type"))
+	assert.NotContains(t, w.Body.String(), "request_id")
+}
@@ -0,0 +1,21 @@
+package middleware
+
+import (
+	"net"
+	"net/http"
+)
+
+// TrustedSubnet returns a middleware handler letting through only requests whose X-Real-IP header belongs to
+// subnet, a nil subnet denies all requests. X-Real-IP must be set by a reverse proxy in front of the server.
+func TrustedSubnet(subnet *net.IPNet) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ip := net.ParseIP(r.Header.Get("X-Real-IP"))
+			if subnet == nil || ip == nil || !subnet.Contains(ip) {
+				Error(w, r, "access is allowed from the trusted subnet only", http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
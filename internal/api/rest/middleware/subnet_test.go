@@ -0,0 +1,38 @@
+package middleware
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTrustedSubnet(t *testing.T) {
+	_, subnet, _ := net.ParseCIDR("192.168.1.0/24")
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	tests := []struct {
+		name   string
+		subnet *net.IPNet
+		realIP string
+		code   int
+	}{
+		{"IP within subnet", subnet, "192.168.1.10", http.StatusOK},
+		{"IP outside subnet", subnet, "10.0.0.1", http.StatusForbidden},
+		{"missing header", subnet, "", http.StatusForbidden},
+		{"invalid header", subnet, "not an IP", http.StatusForbidden},
+		{"subnet not configured", nil, "192.168.1.10", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/api/internal/stats", nil)
+			if tt.realIP != "" {
+				r.Header.Set("X-Real-IP", tt.realIP)
+			}
+			w := httptest.NewRecorder()
+			TrustedSubnet(tt.subnet)(ok).ServeHTTP(w, r)
+			assert.Equal(t, tt.code, w.Code)
+		})
+	}
+}
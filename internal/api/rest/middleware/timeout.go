@@ -0,0 +1,42 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// budgetContextKey is a key of the timeout budget set by Timeout in the request context.
+type budgetContextKey struct{}
+
+// Timeout returns a middleware handler giving requests a timeout budget, handlers bound the time they wait for a slow
+// storage by it and answer with 504 once it is spent. The budget starts once the handler starts waiting rather than
+// when the request arrives, so that deliberately slow work such as password hashing done beforehand does not spend
+// it. Zero budget leaves requests with the default budget of handlers.
+func Timeout(budget time.Duration) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if budget <= 0 {
+				next.ServeHTTP(w, r)
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), budgetContextKey{}, budget)))
+		})
+	}
+}
+
+// Context returns the context of r bounded by the timeout budget set by Timeout or by fallback when there is none, the
+// budget starts with the call. Timeout set for a route overrides the one set for the whole router.
+func Context(r *http.Request, fallback time.Duration) (context.Context, context.CancelFunc) {
+	budget, ok := Budget(r.Context())
+	if !ok {
+		budget = fallback
+	}
+	return context.WithTimeout(r.Context(), budget)
+}
+
+// Budget returns the timeout budget set by Timeout for the request of ctx, false if there is none.
+func Budget(ctx context.Context) (time.Duration, bool) {
+	budget, ok := ctx.Value(budgetContextKey{}).(time.Duration)
+	return budget, ok
+}
@@ -0,0 +1,45 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTimeout(t *testing.T) {
+	var budget time.Duration
+	var bounded, deadline bool
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		budget, bounded = Budget(r.Context())
+		_, deadline = r.Context().Deadline()
+	})
+
+	Timeout(5*time.Second)(handler).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.True(t, bounded)
+	assert.Equal(t, 5*time.Second, budget)
+	// the budget starts once the handler waits for storage
+	assert.False(t, deadline)
+
+	Timeout(0)(handler).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.False(t, bounded)
+}
+
+func TestContext(t *testing.T) {
+	var remaining time.Duration
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := Context(r, time.Minute)
+		defer cancel()
+		deadline, _ := ctx.Deadline()
+		remaining = time.Until(deadline)
+	})
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.InDelta(t, float64(time.Minute), float64(remaining), float64(time.Second))
+
+	// the budget of a route overrides the one of the router
+	Timeout(5*time.Second)(Timeout(time.Second)(handler)).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.InDelta(t, float64(time.Second), float64(remaining), float64(100*time.Millisecond))
+}
@@ -0,0 +1,39 @@
+package middleware
+
+import (
+	"fmt"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/tracing"
+	"github.com/go-chi/chi"
+	"net/http"
+)
+
+// Trace returns a middleware handler starting a server span for every request, continuing the trace of the caller
+// when the request carries a traceparent header.
+func Trace(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		if parent, ok := tracing.ParseTraceparent(r.Header.Get(tracing.TraceparentHeader)); ok {
+			ctx = tracing.ContextWithRemoteParent(ctx, parent)
+		}
+		ctx, span := tracing.Start(ctx, r.Method, tracing.KindServer,
+			tracing.String("http.method", r.Method),
+			tracing.String("http.target", r.URL.Path),
+		)
+		sw := &statusWriter{ResponseWriter: w}
+		next.ServeHTTP(sw, r.WithContext(ctx))
+		if sw.code == 0 {
+			sw.code = http.StatusOK
+		}
+		// the route pattern is resolved while routing, naming spans by it keeps their names low-cardinality
+		if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePattern() != "" {
+			span.SetName(r.Method + " " + rctx.RoutePattern())
+			span.SetAttributes(tracing.String("http.route", rctx.RoutePattern()))
+		}
+		span.SetAttributes(tracing.Int("http.status_code", sw.code))
+		var err error
+		if sw.code >= http.StatusInternalServerError {
+			err = fmt.Errorf("responded with %d %s", sw.code, http.StatusText(sw.code))
+		}
+		span.End(err)
+	})
+}
@@ -1,10 +1,37 @@
 // Package modeldto provides locally used types and their structure for data transfer objects.
 package modeldto
 
+import (
+	"encoding/json"
+	"time"
+)
+
 type (
-	// RequestURL is used in JSONHandlePostURL
+	// RequestURL is used in JSONHandlePostURL, TTL is set in seconds, RedirectType is one of 301, 302 and 307
 	RequestURL struct {
-		URL string `json:"url"`
+		URL           string               `json:"url"`
+		Alias         string               `json:"alias,omitempty"`
+		ExpiresAt     *time.Time           `json:"expires_at,omitempty"`
+		TTL           int64                `json:"ttl,omitempty"`
+		RedirectType  int                  `json:"redirect_type,omitempty"`
+		Password      string               `json:"password,omitempty"`
+		MaxClicks     int                  `json:"max_clicks,omitempty"`
+		ActiveFrom    *time.Time           `json:"active_from,omitempty"`
+		ActiveUntil   *time.Time           `json:"active_until,omitempty"`
+		Destinations  []RequestDestination `json:"destinations,omitempty"`
+		Sticky        bool                 `json:"sticky,omitempty"`
+		GeoTargets    map[string]string    `json:"geo_targets,omitempty"`
+		DeviceTargets map[string]string    `json:"device_targets,omitempty"`
+		Domain        string               `json:"domain,omitempty"`
+		Org           string               `json:"org,omitempty"`
+		Tags          []string             `json:"tags,omitempty"`
+		UTM           map[string]string    `json:"utm,omitempty"`
+	}
+
+	// RequestDestination is used in JSONHandlePostURL
+	RequestDestination struct {
+		URL    string `json:"url"`
+		Weight int    `json:"weight"`
 	}
 
 	// ResponseURL is used in JSONHandlePostURL
@@ -14,8 +41,165 @@ type (
 
 	// ResponseFullURL is used in HandleGetURLsByUserID
 	ResponseFullURL struct {
-		URL  string `json:"original_url"`
-		SURL string `json:"short_url"`
+		URL        string   `json:"original_url"`
+		SURL       string   `json:"short_url"`
+		Title      string   `json:"title,omitempty"`
+		FaviconURL string   `json:"favicon_url,omitempty"`
+		Disabled   bool     `json:"disabled,omitempty"`
+		Tags       []string `json:"tags,omitempty"`
+		// LastAccessedAt is omitted for links never redirected to since last access times are tracked
+		CreatedAt      *time.Time `json:"created_at,omitempty"`
+		LastAccessedAt *time.Time `json:"last_accessed_at,omitempty"`
+		ArchivedAt     *time.Time `json:"archived_at,omitempty"`
+	}
+
+	// ResponseURLStats is used in HandleGetURLStats
+	ResponseURLStats struct {
+		SURL         string              `json:"short_url"`
+		TotalClicks  int                 `json:"total_clicks"`
+		ClicksPerDay []ResponseDayClicks `json:"clicks_per_day"`
+		// ClicksPerDestination counts redirects per served destination, destinations of split links differ
+		ClicksPerDestination []ResponseDestinationClicks `json:"clicks_per_destination"`
+		// UniqueVisitors approximates the number of distinct visitors over all days
+		UniqueVisitors int `json:"unique_visitors"`
+	}
+
+	// ResponseDayClicks is used in HandleGetURLStats
+	ResponseDayClicks struct {
+		Date           string `json:"date"`
+		Clicks         int    `json:"clicks"`
+		UniqueVisitors int    `json:"unique_visitors"`
+	}
+
+	// ResponseDestinationClicks is used in HandleGetURLStats
+	ResponseDestinationClicks struct {
+		URL    string `json:"url"`
+		Clicks int    `json:"clicks"`
+	}
+
+	// ResponseTimeSeries is used in HandleGetURLTimeSeries
+	ResponseTimeSeries struct {
+		SURL        string                `json:"short_url"`
+		Granularity string                `json:"granularity"`
+		From        time.Time             `json:"from"`
+		To          time.Time             `json:"to"`
+		Buckets     []ResponseClickBucket `json:"buckets"`
+	}
+
+	// ResponseClickBucket is used in HandleGetURLTimeSeries
+	ResponseClickBucket struct {
+		Start  time.Time `json:"start"`
+		Clicks int       `json:"clicks"`
+	}
+
+	// ResponseDailyStats is used in HandleGetUserURLStats
+	ResponseDailyStats struct {
+		SURL        string                `json:"short_url"`
+		From        string                `json:"from"`
+		To          string                `json:"to"`
+		TotalClicks int                   `json:"total_clicks"`
+		Days        []ResponseDailyClicks `json:"days"`
+	}
+
+	// ResponseDailyClicks is used in HandleGetUserURLStats
+	ResponseDailyClicks struct {
+		Date   string `json:"date"`
+		Clicks int    `json:"clicks"`
+	}
+
+	// ResponseReferrers is used in HandleGetURLReferrers
+	ResponseReferrers struct {
+		SURL         string                   `json:"short_url"`
+		DirectClicks int                      `json:"direct_clicks"`
+		Referrers    []ResponseReferrerClicks `json:"referrers"`
+	}
+
+	// ResponseReferrerClicks is used in HandleGetURLReferrers
+	ResponseReferrerClicks struct {
+		Domain string `json:"domain"`
+		Clicks int    `json:"clicks"`
+	}
+
+	// ResponseCountries is used in HandleGetURLCountries
+	ResponseCountries struct {
+		SURL          string                  `json:"short_url"`
+		UnknownClicks int                     `json:"unknown_clicks"`
+		Countries     []ResponseCountryClicks `json:"countries"`
+	}
+
+	// ResponseCountryClicks is used in HandleGetURLCountries
+	ResponseCountryClicks struct {
+		Country string `json:"country"`
+		Clicks  int    `json:"clicks"`
+	}
+
+	// ResponseServiceStats is used in HandleGetServiceStats
+	ResponseServiceStats struct {
+		URLs  int `json:"urls"`
+		Users int `json:"users"`
+	}
+
+	// ResponseAdminURL is used in HandleSearchURLs
+	ResponseAdminURL struct {
+		URL      string `json:"original_url"`
+		SURL     string `json:"short_url"`
+		UserID   string `json:"user_id"`
+		Title    string `json:"title,omitempty"`
+		Disabled bool   `json:"disabled,omitempty"`
+	}
+
+	// ResponseUser is used in HandleListUsers
+	ResponseUser struct {
+		Login  string `json:"login"`
+		UserID string `json:"user_id"`
+	}
+
+	// ResponseUserStats is used in HandleGetUserStats
+	ResponseUserStats struct {
+		UserID   string `json:"user_id"`
+		URLs     int    `json:"urls"`
+		Disabled int    `json:"disabled"`
+		Clicks   int    `json:"clicks"`
+	}
+
+	// ResponseAuditRecord is used in HandleListAudit, Before and After are null when the entity did not exist
+	ResponseAuditRecord struct {
+		ID        string          `json:"id"`
+		Actor     string          `json:"actor"`
+		Action    string          `json:"action"`
+		Entity    string          `json:"entity"`
+		EntityID  string          `json:"entity_id"`
+		Before    json.RawMessage `json:"before"`
+		After     json.RawMessage `json:"after"`
+		CreatedAt time.Time       `json:"created_at"`
+	}
+
+	// ResponseWebhookDelivery is used in HandleGetDeliveries
+	ResponseWebhookDelivery struct {
+		ID             string     `json:"id"`
+		EventID        string     `json:"event_id"`
+		EventType      string     `json:"event_type"`
+		Target         string     `json:"target"`
+		Status         string     `json:"status"`
+		Attempts       int        `json:"attempts"`
+		LastStatusCode int        `json:"last_status_code,omitempty"`
+		LastError      string     `json:"last_error,omitempty"`
+		CreatedAt      time.Time  `json:"created_at"`
+		UpdatedAt      time.Time  `json:"updated_at"`
+		NextAttemptAt  *time.Time `json:"next_attempt_at,omitempty"`
+	}
+
+	// ResponseHealth is used in HandleLiveness and HandleReadiness, Checks are only set by HandleReadiness
+	ResponseHealth struct {
+		Status string                         `json:"status"`
+		Checks map[string]ResponseHealthCheck `json:"checks,omitempty"`
+	}
+
+	// ResponseHealthCheck is used in HandleReadiness
+	ResponseHealthCheck struct {
+		Status  string                 `json:"status"`
+		Error   string                 `json:"error,omitempty"`
+		Details map[string]interface{} `json:"details,omitempty"`
 	}
 
 	// RequestBatchURL is used in JSONHandlePostURLBatch
@@ -24,9 +208,148 @@ type (
 		URL           string `json:"original_url"`
 	}
 
+	// RequestEditURL is used in HandleEditURL
+	RequestEditURL struct {
+		URL string `json:"url"`
+	}
+
+	// RequestTag is used in HandleRenameTag
+	RequestTag struct {
+		Name string `json:"name"`
+	}
+
+	// ResponseTag is used in HandleListTags
+	ResponseTag struct {
+		Name  string `json:"name"`
+		Count int    `json:"count"`
+	}
+
+	// RequestCredentials is used in HandleRegister and HandleLogin
+	RequestCredentials struct {
+		Login    string `json:"login"`
+		Password string `json:"password"`
+	}
+
+	// ResponseToken is used in HandleRegister and HandleLogin
+	ResponseToken struct {
+		Token string `json:"token"`
+	}
+
+	// RequestAPIKey is used in HandleCreateAPIKey
+	RequestAPIKey struct {
+		Name string `json:"name"`
+	}
+
+	// RequestDomain is used in HandleAddDomain
+	RequestDomain struct {
+		Name string `json:"name"`
+	}
+
+	// ResponseDomain is used in HandleAddDomain, HandleListDomains and HandleVerifyDomain, the domain is verified once
+	// a TXT record named VerificationRecord holds VerificationValue
+	ResponseDomain struct {
+		Name               string     `json:"name"`
+		VerificationRecord string     `json:"verification_record"`
+		VerificationValue  string     `json:"verification_value"`
+		CreatedAt          time.Time  `json:"created_at"`
+		VerifiedAt         *time.Time `json:"verified_at,omitempty"`
+	}
+
+	// RequestOrg is used in HandleCreateOrg
+	RequestOrg struct {
+		Name string `json:"name"`
+	}
+
+	// ResponseOrg is used in HandleCreateOrg and HandleListOrgs, Role is the role of the current user in the organization
+	ResponseOrg struct {
+		ID        string    `json:"id"`
+		Name      string    `json:"name"`
+		Role      string    `json:"role"`
+		CreatedAt time.Time `json:"created_at"`
+	}
+
+	// RequestMember is used in HandleSetMember, Role defaults to member
+	RequestMember struct {
+		Login string `json:"login"`
+		Role  string `json:"role,omitempty"`
+	}
+
+	// ResponseMember is used in HandleListMembers and HandleSetMember
+	ResponseMember struct {
+		UserID    string    `json:"user_id"`
+		Login     string    `json:"login,omitempty"`
+		Role      string    `json:"role"`
+		CreatedAt time.Time `json:"created_at"`
+	}
+
+	// ResponseAPIKey is used in HandleCreateAPIKey and HandleListAPIKeys, Key is only set once on creation
+	ResponseAPIKey struct {
+		ID        string     `json:"id"`
+		Name      string     `json:"name"`
+		Prefix    string     `json:"prefix"`
+		Key       string     `json:"key,omitempty"`
+		CreatedAt time.Time  `json:"created_at"`
+		RevokedAt *time.Time `json:"revoked_at,omitempty"`
+	}
+
+	// ResponseUserData is used in HandleExportUserData
+	ResponseUserData struct {
+		UserID  string            `json:"user_id"`
+		Logins  []string          `json:"logins"`
+		URLs    []ResponseUserURL `json:"urls"`
+		APIKeys []ResponseAPIKey  `json:"api_keys"`
+		Domains []ResponseDomain  `json:"domains"`
+		Orgs    []ResponseOrg     `json:"orgs"`
+		// UTMDefaults holds UTM parameters links of the user are given unless they are created with their own
+		UTMDefaults map[string]string `json:"utm_defaults,omitempty"`
+	}
+
+	// ResponseUserURL is used in HandleExportUserData, it carries redirect statistics of the link
+	ResponseUserURL struct {
+		ResponseFullURL
+		TotalClicks          int                         `json:"total_clicks"`
+		ClicksPerDay         []ResponseDayClicks         `json:"clicks_per_day"`
+		ClicksPerDestination []ResponseDestinationClicks `json:"clicks_per_destination"`
+		UniqueVisitors       int                         `json:"unique_visitors"`
+	}
+
 	// ResponseBatchURL is used in JSONHandlePostURLBatch
 	ResponseBatchURL struct {
 		CorrelationID string `json:"correlation_id"`
 		SURL          string `json:"short_url"`
 	}
+
+	// ResponseLink is used in HandleShortenV2, links found already shortened are described without their options
+	ResponseLink struct {
+		ID           string     `json:"id"`
+		SURL         string     `json:"short_url"`
+		URL          string     `json:"original_url"`
+		PreviewURL   string     `json:"preview_url"`
+		StatsURL     string     `json:"stats_url"`
+		QRURL        string     `json:"qr_url"`
+		Domain       string     `json:"domain,omitempty"`
+		RedirectType int        `json:"redirect_type,omitempty"`
+		ExpiresAt    *time.Time `json:"expires_at,omitempty"`
+		ActiveFrom   *time.Time `json:"active_from,omitempty"`
+		MaxClicks    int        `json:"max_clicks,omitempty"`
+		Tags         []string   `json:"tags,omitempty"`
+	}
+
+	// ResponseBatchLink is used in HandleShortenBatchV2
+	ResponseBatchLink struct {
+		CorrelationID string `json:"correlation_id"`
+		ID            string `json:"id"`
+		SURL          string `json:"short_url"`
+		StatsURL      string `json:"stats_url"`
+	}
+
+	// ResponseProblem is used in error responses, it holds RFC 7807 problem details extended with the request ID
+	ResponseProblem struct {
+		Type      string `json:"type"`
+		Title     string `json:"title"`
+		Status    int    `json:"status"`
+		Detail    string `json:"detail,omitempty"`
+		Instance  string `json:"instance,omitempty"`
+		RequestID string `json:"request_id,omitempty"`
+	}
 )
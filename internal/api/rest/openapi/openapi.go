@@ -0,0 +1,58 @@
+// Package openapi provides the OpenAPI 3 document describing the REST API and handlers serving it.
+package openapi
+
+import (
+	_ "embed"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/api/rest/middleware"
+	"html/template"
+	"net/http"
+)
+
+// Spec is the OpenAPI 3 document in JSON, it must be updated along with routes and modeldto types.
+//
+//go:embed openapi.json
+var Spec []byte
+
+// swaggerUIVersion pins the Swagger UI release loaded from CDN.
+const swaggerUIVersion = "4.15.5"
+
+var swaggerUI = template.Must(template.New("swagger-ui").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+  <meta charset="utf-8">
+  <title>URL shortener API</title>
+  <link rel="stylesheet" href="https://unpkg.com/swagger-ui-dist@{{.Version}}/swagger-ui.css">
+</head>
+<body>
+  <div id="swagger-ui"></div>
+  <script src="https://unpkg.com/swagger-ui-dist@{{.Version}}/swagger-ui-bundle.js" crossorigin></script>
+  <script>
+    window.onload = function () {
+      window.ui = SwaggerUIBundle({url: {{.SpecURL}}, dom_id: "#swagger-ui"});
+    };
+  </script>
+</body>
+</html>
+`))
+
+// Handler serves Spec.
+func Handler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(Spec)
+	}
+}
+
+// UIHandler serves a Swagger UI page rendering the document served at specURL, UI assets are loaded from CDN.
+func UIHandler(specURL string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		err := swaggerUI.Execute(w, struct {
+			Version string
+			SpecURL string
+		}{swaggerUIVersion, specURL})
+		if err != nil {
+			middleware.Error(w, r, err.Error(), http.StatusInternalServerError)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package openapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSpecReferencesResolve(t *testing.T) {
+	var doc map[string]interface{}
+	require.NoError(t, json.Unmarshal(Spec, &doc))
+	assert.Equal(t, "3.0.3", doc["openapi"])
+	var walk func(node interface{})
+	walk = func(node interface{}) {
+		switch v := node.(type) {
+		case map[string]interface{}:
+			if ref, ok := v["$ref"].(string); ok {
+				assert.True(t, resolve(doc, ref), "unresolved reference %s", ref)
+			}
+			for _, child := range v {
+				walk(child)
+			}
+		case []interface{}:
+			for _, child := range v {
+				walk(child)
+			}
+		}
+	}
+	walk(doc)
+}
+
+// resolve reports whether a local JSON pointer reference points to an existing node of doc.
+func resolve(doc map[string]interface{}, ref string) bool {
+	if !strings.HasPrefix(ref, "#/") {
+		return false
+	}
+	var node interface{} = doc
+	for _, key := range strings.Split(strings.TrimPrefix(ref, "#/"), "/") {
+		m, ok := node.(map[string]interface{})
+		if !ok {
+			return false
+		}
+		node, ok = m[key]
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+func TestHandlers(t *testing.T) {
+	w := httptest.NewRecorder()
+	Handler()(w, httptest.NewRequest(http.MethodGet, "/api/openapi.json", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+	assert.Equal(t, Spec, w.Body.Bytes())
+
+	w = httptest.NewRecorder()
+	UIHandler("/api/openapi.json")(w, httptest.NewRequest(http.MethodGet, "/api/docs", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `url: "/api/openapi.json"`)
+}
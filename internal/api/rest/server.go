@@ -5,22 +5,172 @@ import (
 	"context"
 	"github.com/danilovkiri/dk_go_url_shortener/internal/api/rest/handlers"
 	"github.com/danilovkiri/dk_go_url_shortener/internal/api/rest/middleware"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/api/rest/openapi"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/backup"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/clickstream"
 	"github.com/danilovkiri/dk_go_url_shortener/internal/config"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/errreport"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/geoip"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/logger"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/metrics"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/preview"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/reload"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/safety"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/service/authenticator/v1"
 	"github.com/danilovkiri/dk_go_url_shortener/internal/service/secretary/v1"
 	"github.com/danilovkiri/dk_go_url_shortener/internal/service/shortener/v2"
 	"github.com/danilovkiri/dk_go_url_shortener/internal/storage/v2"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/storage/v2/deduplicating"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/storage/v2/enriching"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/storage/v2/filtering"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/storage/v2/instrumented"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/storage/v2/notifying"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/storage/v2/streaming"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/webhook"
 	"github.com/go-chi/chi"
+	"io"
+	"net"
 	"net/http"
+	"net/http/pprof"
+	"os"
 	"time"
 )
 
-// InitServer returns a http.Server object ready to be listening and serving .
-func InitServer(ctx context.Context, cfg *config.Config, storage storage.URLStorage) (server *http.Server, err error) {
-	shortenerService, err := shortener.InitShortener(storage)
+// API documentation and profiling routes, the OpenAPI document must describe all other routes.
+const (
+	openAPIPath   = "/api/openapi.json"
+	swaggerUIPath = "/api/docs"
+	pprofPath     = "/debug/pprof"
+)
+
+// openAccessLog returns the writer of access logs configured by cfg, the file is kept open for the lifetime of the
+// process since requests are served until it exits.
+func openAccessLog(cfg *config.LogConfig) (io.Writer, error) {
+	if cfg.AccessLogPath == "-" {
+		return os.Stdout, nil
+	}
+	return logger.NewRotatingFile(cfg.AccessLogPath, int64(cfg.AccessLogMaxSize)<<20, cfg.AccessLogMaxBackups)
+}
+
+// InitServer returns a http.Server object ready to be listening and serving, redirects are published to clicks unless
+// it is nil. Components whose parameters can be reloaded are registered with watcher unless it is nil.
+func InitServer(ctx context.Context, cfg *config.Config, urlStorage storage.URLStorage, clicks *clickstream.Publisher, watcher *reload.Watcher, log *logger.Logger) (server *http.Server, err error) {
+	// register metrics exposed at /metrics
+	registry := metrics.NewRegistry(log)
+	shortenRequests := registry.NewCounterVec("shortener_shorten_requests_total", "Number of URL shortening requests.", "code")
+	redirectRequests := registry.NewCounterVec("shortener_redirect_requests_total", "Number of short URL redirect requests.", "code")
+	deleteRequests := registry.NewCounterVec("shortener_delete_requests_total", "Number of URL deletion requests.", "code")
+	storageLatency := registry.NewHistogramVec("shortener_storage_operation_duration_seconds", "Storage operations latency.", "operation", metrics.DefBuckets)
+	if cached, ok := urlStorage.(storage.CacheStatsGetter); ok {
+		registry.NewCounterFunc("shortener_storage_cache_hits_total", "Number of storage cache hits.", func() float64 {
+			hits, _ := cached.CacheStats()
+			return float64(hits)
+		})
+		registry.NewCounterFunc("shortener_storage_cache_misses_total", "Number of storage cache misses.", func() float64 {
+			_, misses := cached.CacheStats()
+			return float64(misses)
+		})
+	}
+	// the lookup filter is built of sURLs listed by the storage itself, the wrappers below hide the listing
+	scanner, _ := urlStorage.(storage.SURLScanner)
+	// back up entries listed by the storage itself on schedule until ctx is done
+	if entries, ok := urlStorage.(storage.EntryScanner); ok && cfg.BackupConfig.Schedule != "" {
+		scheduler, err := backup.NewScheduler(cfg.BackupConfig, entries, log)
+		if err != nil {
+			return nil, err
+		}
+		registry.NewGaugeFunc("shortener_backup_last_success_timestamp_seconds", "Unix time of the last successful backup, zero until a backup succeeds.", func() float64 {
+			lastSuccess := scheduler.LastSuccess()
+			if lastSuccess.IsZero() {
+				return 0
+			}
+			return float64(lastSuccess.Unix())
+		})
+		go scheduler.Run(ctx)
+	}
+	// runtime and storage stats exposed at /debug/vars need optional storage interfaces hidden by the wrappers below
+	vars := newVars(urlStorage)
+	// readiness checks need optional storage interfaces hidden by the wrappers below
+	healthHandler, err := handlers.InitHealthHandler(urlStorage, cfg.StorageConfig, log)
+	if err != nil {
+		return nil, err
+	}
+	// report panics and storage failures, the reporter stops when ctx is done
+	reporter, err := errreport.NewReporter(ctx, cfg.ErrorReportConfig, log)
 	if err != nil {
 		return nil, err
 	}
-	urlHandler, err := handlers.InitURLHandler(shortenerService, cfg.ServerConfig)
+	// post link lifecycle events to webhook targets, the dispatcher stops along with storage when ctx is done
+	dispatcher := webhook.NewDispatcher(ctx, cfg.WebhookConfig, log)
+	if urlStorage != nil {
+		registry.NewGaugeFunc("shortener_delete_queue_depth", "Number of URLs queued for deletion and not yet deleted.", func() float64 {
+			return float64(urlStorage.QueueDepth())
+		})
+		if dispatcher != nil {
+			notifyingStorage := notifying.InitStorage(urlStorage)
+			notifyingStorage.SetEventHandler(dispatcher.Publish)
+			urlStorage = notifyingStorage
+		}
+		if clicks != nil {
+			urlStorage = streaming.InitStorage(urlStorage, clicks.Publish)
+		}
+		// answer lookups of never stored links without querying the storage, the filter is rebuilt until ctx is done
+		if scanner != nil && cfg.StorageConfig.LookupFilterInterval > 0 {
+			filteringStorage := filtering.InitStorage(urlStorage, scanner, log)
+			go filteringStorage.Run(ctx, cfg.StorageConfig.LookupFilterInterval)
+			registry.NewCounterFunc("shortener_storage_filtered_lookups_total", "Number of short URL lookups answered by the lookup filter without querying the storage.", func() float64 {
+				return float64(filteringStorage.Filtered())
+			})
+			urlStorage = filteringStorage
+		}
+		// collapse bursts of lookups of the same link so that only one of them reaches the storage
+		urlStorage = deduplicating.InitStorage(urlStorage)
+		urlStorage = instrumented.InitStorage(urlStorage, storageLatency, reporter)
+		// fetch destination titles and favicons for URL listings, workers stop along with storage when ctx is done
+		if cfg.MetadataConfig.Timeout > 0 {
+			urlStorage = enriching.InitStorage(ctx, urlStorage, cfg.MetadataConfig, log)
+		}
+	}
+	shortenerService, err := shortener.InitShortener(urlStorage, cfg.ShortenerConfig)
+	if err != nil {
+		return nil, err
+	}
+	// screen destinations before shortening and disable links found unsafe later, rescans stop when ctx is done
+	checker, err := safety.NewChecker(cfg.SafetyConfig, log)
+	if err != nil {
+		return nil, err
+	}
+	shortenerService.SetSafetyChecker(checker)
+	shortenerService.SetBaseURL(cfg.ServerConfig.BaseURL)
+	// keep checked sURLs ready for shortening, the pool is refilled until ctx is done
+	if cfg.ShortenerConfig.IDPoolSize > 0 {
+		shortenerService.StartCodePool(ctx, cfg.ShortenerConfig.IDPoolSize, cfg.ShortenerConfig.IDPoolRefillThreshold)
+	}
+	if checker != nil {
+		watcher.Add("safety checker", func(cfg *config.Config) error {
+			return checker.Reload(cfg.SafetyConfig)
+		}, "SAFETY_BLOCKED_DOMAINS", "SAFETY_BLOCKLIST_FILE", "SAFE_BROWSING_API_KEY", "SAFE_BROWSING_URL", "SAFE_BROWSING_TIMEOUT")
+	}
+	if checker != nil && urlStorage != nil && cfg.SafetyConfig.RescanInterval > 0 {
+		go checker.Run(ctx, urlStorage, cfg.SafetyConfig.RescanInterval)
+	}
+	// resolve visitor countries for geo-targeted redirects
+	if cfg.GeoIPConfig.DatabasePath != "" {
+		geo, err := geoip.Open(cfg.GeoIPConfig.DatabasePath)
+		if err != nil {
+			return nil, err
+		}
+		shortenerService.SetGeoIP(geo)
+	}
+	urlHandler, err := handlers.InitURLHandler(shortenerService, cfg.ServerConfig, log)
+	if err != nil {
+		return nil, err
+	}
+	var titleFetcher *preview.Fetcher
+	if cfg.ServerConfig.PreviewTitleTimeout > 0 {
+		titleFetcher = preview.NewFetcher(cfg.ServerConfig.PreviewTitleTimeout)
+	}
+	previewHandler, err := handlers.InitPreviewHandler(shortenerService, cfg.ServerConfig, titleFetcher, log)
 	if err != nil {
 		return nil, err
 	}
@@ -32,17 +182,140 @@ func InitServer(ctx context.Context, cfg *config.Config, storage storage.URLStor
 	if err != nil {
 		return nil, err
 	}
+	authenticatorService, err := authenticator.InitAuthenticator(urlStorage, cfg.SecretConfig)
+	if err != nil {
+		return nil, err
+	}
+	authHandler, err := middleware.NewAuthHandler(authenticatorService)
+	if err != nil {
+		return nil, err
+	}
+	userHandler, err := handlers.InitUserHandler(authenticatorService, log)
+	if err != nil {
+		return nil, err
+	}
+	webhookHandler := handlers.InitWebhookHandler(dispatcher, log)
+	// internal endpoints are only served to the trusted subnet, nil denies everyone
+	var trustedSubnet *net.IPNet
+	if cfg.ServerConfig.TrustedSubnet != "" {
+		_, trustedSubnet, err = net.ParseCIDR(cfg.ServerConfig.TrustedSubnet)
+		if err != nil {
+			return nil, err
+		}
+	}
+	// throttle shortening per user and per client IP so that a single client cannot exhaust the DB
+	rateLimiter := middleware.NewRateLimiter(cfg.RateLimitConfig)
+	watcher.Add("rate limiter", func(cfg *config.Config) error {
+		rateLimiter.SetLimits(cfg.RateLimitConfig)
+		return nil
+	}, "RATE_LIMIT_USER_RPS", "RATE_LIMIT_USER_BURST", "RATE_LIMIT_IP_RPS", "RATE_LIMIT_IP_BURST")
 	r := chi.NewRouter()
+	r.Use(middleware.Trace)
+	r.Use(middleware.LogRequests(log))
+	if cfg.LogConfig.AccessLogPath != "" {
+		accessLog, err := openAccessLog(cfg.LogConfig)
+		if err != nil {
+			return nil, err
+		}
+		r.Use(middleware.AccessLog(accessLog, cfg.LogConfig.AccessLogFormat))
+	}
+	r.Use(middleware.Recover(reporter, log))
+	// preflight requests carry no credentials, answer them before authentication
+	if len(cfg.CORSConfig.AllowedOrigins) > 0 {
+		r.Use(middleware.NewCORSHandler(cfg.CORSConfig).CORSHandle)
+	}
+	// routes with a timeout budget of their own override this one
+	r.Use(middleware.Timeout(cfg.ServerConfig.RequestTimeout))
+	// resolve identity from access tokens first, falling back to cookies
+	r.Use(authHandler.AuthHandle)
 	r.Use(cookieHandler.CookieHandle)
-	r.Use(middleware.CompressHandle)
+	r.Use(middleware.Compress(cfg.ServerConfig.GzipMinSize, cfg.ServerConfig.GzipLevel))
 	r.Use(middleware.DecompressHandle)
-	r.Post("/", urlHandler.HandlePostURL())
-	r.Post("/api/shorten", urlHandler.JSONHandlePostURL())
-	r.Post("/api/shorten/batch", urlHandler.JSONHandlePostURLBatch())
-	r.Get("/{urlID}", urlHandler.HandleGetURL())
+	// shortening and redirects wait for storage within their own timeout budgets
+	shortenTimeout := middleware.Timeout(cfg.ServerConfig.ShortenTimeout)
+	batchTimeout := middleware.Timeout(cfg.ServerConfig.BatchTimeout)
+	redirectTimeout := middleware.Timeout(cfg.ServerConfig.RedirectTimeout)
+	r.With(middleware.CountRequests(shortenRequests), rateLimiter.LimitHandle, shortenTimeout).Post("/", urlHandler.HandlePostURL())
+	r.With(middleware.CountRequests(shortenRequests), rateLimiter.LimitHandle, shortenTimeout).Post("/api/shorten", urlHandler.JSONHandlePostURL())
+	r.With(middleware.CountRequests(shortenRequests), rateLimiter.LimitHandle, batchTimeout).Post("/api/shorten/batch", urlHandler.JSONHandlePostURLBatch())
+	r.With(middleware.CountRequests(shortenRequests), rateLimiter.LimitHandle).Post("/api/import", urlHandler.HandleImport())
+	// response shapes of v1 endpoints are frozen, richer ones are served under /api/v2
+	r.Route("/api/v2", func(r chi.Router) {
+		r.Use(middleware.Negotiate("application/json", handlers.MediaTypeV2))
+		r.With(middleware.CountRequests(shortenRequests), rateLimiter.LimitHandle, shortenTimeout).Post("/shorten", urlHandler.HandleShortenV2())
+		r.With(middleware.CountRequests(shortenRequests), rateLimiter.LimitHandle, batchTimeout).Post("/shorten/batch", urlHandler.HandleShortenBatchV2())
+	})
+	// previews fetch destination titles within their own timeout rather than the redirect budget
+	redirect := previewHandler.WithPreviewQuery(redirectTimeout(urlHandler.HandleGetURL()).ServeHTTP)
+	r.With(middleware.CountRequests(redirectRequests)).Get("/{urlID}", redirect)
+	r.With(middleware.CountRequests(redirectRequests)).Head("/{urlID}", redirect)
+	// passwords of protected links are submitted by posting the password form, throttle guessing them
+	r.With(middleware.CountRequests(redirectRequests), rateLimiter.LimitHandle, redirectTimeout).Post("/{urlID}", urlHandler.HandleGetURL())
+	r.Get("/{urlID}+", previewHandler.HandleGetURLPreview())
+	r.Get("/{urlID}/qr", urlHandler.HandleGetURLQR())
+	// stats of links are only served to their owners
+	r.With(urlHandler.RequireURLAccess).Get("/api/urls/{urlID}/stats", urlHandler.HandleGetURLStats())
+	r.With(urlHandler.RequireURLAccess).Get("/api/urls/{urlID}/stats/timeseries", urlHandler.HandleGetURLTimeSeries())
+	r.With(urlHandler.RequireURLAccess).Get("/api/urls/{urlID}/stats/referrers", urlHandler.HandleGetURLReferrers())
+	r.With(urlHandler.RequireURLAccess).Get("/api/urls/{urlID}/stats/countries", urlHandler.HandleGetURLCountries())
+	r.Post("/api/user/register", userHandler.HandleRegister())
+	r.Post("/api/user/login", userHandler.HandleLogin())
+	r.Get("/api/user/export", urlHandler.HandleExportUserData())
+	r.Delete("/api/user", urlHandler.HandleEraseUser())
+	r.Post("/api/keys", userHandler.HandleCreateAPIKey())
+	r.Get("/api/keys", userHandler.HandleListAPIKeys())
+	r.Delete("/api/keys/{keyID}", userHandler.HandleRevokeAPIKey())
 	r.Get("/api/user/urls", urlHandler.HandleGetURLsByUserID())
-	r.Delete("/api/user/urls", urlHandler.HandleDeleteURLBatch())
+	r.Get("/api/user/urls/export", urlHandler.HandleExport())
+	r.Get("/api/user/urls/search", urlHandler.HandleSearchUserURLs())
+	r.With(middleware.CountRequests(deleteRequests)).Delete("/api/user/urls", urlHandler.HandleDeleteURLBatch())
+	r.Post("/api/user/urls/restore", urlHandler.HandleRestoreURLBatch())
+	r.Put("/api/user/urls/{urlID}", urlHandler.HandleEditURL())
+	r.With(urlHandler.RequireURLAccess).Get("/api/user/urls/{urlID}/stats", urlHandler.HandleGetUserURLStats())
+	r.Put("/api/user/urls/{urlID}/tags", urlHandler.HandleSetTags())
+	r.Get("/api/user/tags", urlHandler.HandleListTags())
+	r.Patch("/api/user/tags/{tag}", urlHandler.HandleRenameTag())
+	r.Get("/api/user/utm", urlHandler.HandleGetUTMDefaults())
+	r.Put("/api/user/utm", urlHandler.HandleSetUTMDefaults())
+	r.Post("/api/user/domains", urlHandler.HandleAddDomain())
+	r.Get("/api/user/domains", urlHandler.HandleListDomains())
+	// DNS lookups take longer than DB operations
+	r.With(middleware.Timeout(cfg.ServerConfig.DomainVerifyTimeout)).Post("/api/user/domains/{domain}/verify", urlHandler.HandleVerifyDomain())
+	r.Post("/api/orgs", urlHandler.HandleCreateOrg())
+	r.Get("/api/orgs", urlHandler.HandleListOrgs())
+	r.Get("/api/orgs/{orgID}/members", urlHandler.HandleListMembers())
+	r.Post("/api/orgs/{orgID}/members", urlHandler.HandleSetMember())
+	r.Delete("/api/orgs/{orgID}/members/{userID}", urlHandler.HandleRemoveMember())
+	r.Get("/api/orgs/{orgID}/urls", urlHandler.HandleGetURLsByOrgID())
+	r.With(authHandler.RequireAdmin).Get("/api/admin/urls", urlHandler.HandleSearchURLs())
+	r.With(authHandler.RequireAdmin).Post("/api/admin/urls/disable", urlHandler.HandleDisableURLBatch())
+	r.With(authHandler.RequireAdmin).Get("/api/admin/users", urlHandler.HandleListUsers())
+	r.With(authHandler.RequireAdmin).Get("/api/admin/users/{userID}/stats", urlHandler.HandleGetUserStats())
+	r.With(authHandler.RequireAdmin).Get("/api/admin/audit", urlHandler.HandleListAudit())
+	r.With(middleware.TrustedSubnet(trustedSubnet)).Get("/api/internal/stats", urlHandler.HandleGetServiceStats())
+	r.With(middleware.TrustedSubnet(trustedSubnet)).Get("/api/internal/webhooks/deliveries", webhookHandler.HandleGetDeliveries())
 	r.Get("/ping", urlHandler.HandlePingDB())
+	r.Get("/healthz", healthHandler.HandleLiveness())
+	r.Get("/readyz", healthHandler.HandleReadiness())
+	r.Get("/metrics", registry.Handler())
+	r.With(middleware.TrustedSubnet(trustedSubnet)).Get("/debug/vars", varsHandler(vars))
+	r.Get(openAPIPath, openapi.Handler())
+	if cfg.ServerConfig.SwaggerUI {
+		r.Get(swaggerUIPath, openapi.UIHandler(openAPIPath))
+	}
+	// profiles expose internals of the process, e.g. command line arguments, and are restricted to the trusted subnet
+	if cfg.ServerConfig.Pprof {
+		r.Route(pprofPath, func(r chi.Router) {
+			r.Use(middleware.TrustedSubnet(trustedSubnet))
+			r.Get("/cmdline", pprof.Cmdline)
+			r.Get("/profile", pprof.Profile)
+			r.Get("/symbol", pprof.Symbol)
+			r.Post("/symbol", pprof.Symbol)
+			r.Get("/trace", pprof.Trace)
+			// the index page and named profiles, e.g. heap and goroutine
+			r.Get("/*", pprof.Index)
+		})
+	}
 
 	srv := &http.Server{
 		Addr: cfg.ServerConfig.ServerAddress,
@@ -0,0 +1,139 @@
+package rest
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/danilovkiri/dk_go_url_shortener/internal/api/rest/openapi"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/config"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/storage/v2/infile"
+	"github.com/go-chi/chi"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestOpenAPIDescribesRoutes makes sure that every route registered by InitServer is described in the OpenAPI
+// document and vice versa.
+func TestOpenAPIDescribesRoutes(t *testing.T) {
+	cfg, err := config.NewDefaultConfiguration()
+	require.NoError(t, err)
+	cfg.SecretConfig.JWTKey = "test-jwt-key"
+	cfg.StorageConfig.FileStoragePath = filepath.Join(t.TempDir(), "url_storage.json")
+	cfg.ServerConfig.SwaggerUI = true
+	cfg.ServerConfig.Pprof = true
+	ctx, cancel := context.WithCancel(context.Background())
+	wg := &sync.WaitGroup{}
+	wg.Add(1)
+	defer wg.Wait()
+	defer cancel()
+	st, err := infile.InitStorage(ctx, wg, cfg.StorageConfig, nil)
+	require.NoError(t, err)
+	server, err := InitServer(ctx, cfg, st, nil, nil, nil)
+	require.NoError(t, err)
+
+	var doc struct {
+		Paths map[string]map[string]json.RawMessage `json:"paths"`
+	}
+	require.NoError(t, json.Unmarshal(openapi.Spec, &doc))
+	documented := make(map[string]bool)
+	for path, operations := range doc.Paths {
+		for method := range operations {
+			documented[strings.ToUpper(method)+" "+path] = true
+		}
+	}
+	registered := make(map[string]bool)
+	err = chi.Walk(server.Handler.(chi.Routes), func(method, route string, handler http.Handler, middlewares ...func(http.Handler) http.Handler) error {
+		// the documentation page and profiles are not a part of the API
+		if route != swaggerUIPath && !strings.HasPrefix(route, pprofPath+"/") {
+			registered[method+" "+route] = true
+		}
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, documented, registered)
+}
+
+// TestPprofTrustedSubnet makes sure that profiles are only served to clients of the trusted subnet.
+func TestPprofTrustedSubnet(t *testing.T) {
+	cfg, err := config.NewDefaultConfiguration()
+	require.NoError(t, err)
+	cfg.SecretConfig.JWTKey = "test-jwt-key"
+	cfg.StorageConfig.FileStoragePath = filepath.Join(t.TempDir(), "url_storage.json")
+	cfg.ServerConfig.Pprof = true
+	cfg.ServerConfig.TrustedSubnet = "192.168.1.0/24"
+	ctx, cancel := context.WithCancel(context.Background())
+	wg := &sync.WaitGroup{}
+	wg.Add(1)
+	defer wg.Wait()
+	defer cancel()
+	st, err := infile.InitStorage(ctx, wg, cfg.StorageConfig, nil)
+	require.NoError(t, err)
+	server, err := InitServer(ctx, cfg, st, nil, nil, nil)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name   string
+		path   string
+		realIP string
+		code   int
+	}{
+		{"index within subnet", pprofPath + "/", "192.168.1.10", http.StatusOK},
+		{"named profile within subnet", pprofPath + "/goroutine?debug=1", "192.168.1.10", http.StatusOK},
+		{"index outside subnet", pprofPath + "/", "10.0.0.1", http.StatusForbidden},
+		{"profile outside subnet", pprofPath + "/heap", "", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			if tt.realIP != "" {
+				r.Header.Set("X-Real-IP", tt.realIP)
+			}
+			w := httptest.NewRecorder()
+			server.Handler.ServeHTTP(w, r)
+			assert.Equal(t, tt.code, w.Code)
+		})
+	}
+}
+
+// TestVars makes sure that runtime and storage stats are served to clients of the trusted subnet.
+func TestVars(t *testing.T) {
+	cfg, err := config.NewDefaultConfiguration()
+	require.NoError(t, err)
+	cfg.SecretConfig.JWTKey = "test-jwt-key"
+	cfg.StorageConfig.FileStoragePath = filepath.Join(t.TempDir(), "url_storage.json")
+	cfg.ServerConfig.TrustedSubnet = "192.168.1.0/24"
+	ctx, cancel := context.WithCancel(context.Background())
+	wg := &sync.WaitGroup{}
+	wg.Add(1)
+	defer wg.Wait()
+	defer cancel()
+	st, err := infile.InitStorage(ctx, wg, cfg.StorageConfig, nil)
+	require.NoError(t, err)
+	server, err := InitServer(ctx, cfg, st, nil, nil, nil)
+	require.NoError(t, err)
+
+	r := httptest.NewRequest(http.MethodGet, "/debug/vars", nil)
+	r.Header.Set("X-Real-IP", "192.168.1.10")
+	w := httptest.NewRecorder()
+	server.Handler.ServeHTTP(w, r)
+	require.Equal(t, http.StatusOK, w.Code)
+	var vars map[string]json.RawMessage
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &vars))
+	for _, name := range []string{"cmdline", "memstats", "goroutines", "gc", "delete_queue_depth"} {
+		assert.Contains(t, vars, name)
+	}
+	// the file storage has no DB pool
+	assert.NotContains(t, vars, "db")
+
+	r = httptest.NewRequest(http.MethodGet, "/debug/vars", nil)
+	r.Header.Set("X-Real-IP", "10.0.0.1")
+	w = httptest.NewRecorder()
+	server.Handler.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+}
@@ -0,0 +1,71 @@
+package rest
+
+import (
+	"crypto/tls"
+	"fmt"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/config"
+	"golang.org/x/crypto/acme/autocert"
+	"net"
+	"net/http"
+	"time"
+)
+
+// InitTLS configures server to serve HTTPS according to cfg, server must then be started with
+// ListenAndServeTLS(cfg.TLSCertFile, cfg.TLSKeyFile). It returns a server redirecting plain HTTP requests to HTTPS,
+// which is nil when cfg.HTTPRedirectAddress is empty.
+func InitTLS(server *http.Server, cfg *config.ServerConfig) (redirectServer *http.Server, err error) {
+	var manager *autocert.Manager
+	switch {
+	case (cfg.TLSCertFile == "") != (cfg.TLSKeyFile == ""):
+		return nil, fmt.Errorf("TLS_CERT_FILE and TLS_KEY_FILE must be set together")
+	case cfg.TLSCertFile == "" && len(cfg.AutocertHosts) == 0:
+		return nil, fmt.Errorf("HTTPS requires either TLS_CERT_FILE and TLS_KEY_FILE or AUTOCERT_HOSTS")
+	case cfg.TLSCertFile == "":
+		manager = &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			Cache:      autocert.DirCache(cfg.AutocertCacheDir),
+			HostPolicy: autocert.HostWhitelist(cfg.AutocertHosts...),
+			Email:      cfg.AutocertEmail,
+		}
+		server.TLSConfig = manager.TLSConfig()
+	default:
+		server.TLSConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+	}
+	if cfg.HTTPRedirectAddress == "" {
+		return nil, nil
+	}
+	_, port, err := net.SplitHostPort(cfg.ServerAddress)
+	if err != nil {
+		return nil, fmt.Errorf("parsing server address: %w", err)
+	}
+	var handler http.Handler = redirectToHTTPS(port)
+	if manager != nil {
+		// HTTP-01 challenges are answered over plain HTTP
+		handler = manager.HTTPHandler(handler)
+	}
+	return &http.Server{
+		Addr:              cfg.HTTPRedirectAddress,
+		Handler:           handler,
+		ReadHeaderTimeout: 5 * time.Second,
+	}, nil
+}
+
+// redirectToHTTPS redirects requests to the same URL served over HTTPS at port.
+func redirectToHTTPS(port string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if port != "" && port != "443" {
+			host = net.JoinHostPort(host, port)
+		}
+		target := "https://" + host + r.URL.RequestURI()
+		// keep the method and body of non-idempotent requests
+		code := http.StatusPermanentRedirect
+		if r.Method == http.MethodGet || r.Method == http.MethodHead {
+			code = http.StatusMovedPermanently
+		}
+		http.Redirect(w, r, target, code)
+	}
+}
@@ -0,0 +1,58 @@
+package rest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/danilovkiri/dk_go_url_shortener/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInitTLS(t *testing.T) {
+	cfg := &config.ServerConfig{ServerAddress: ":443", HTTPRedirectAddress: ":80", TLSCertFile: "cert.pem"}
+	_, err := InitTLS(&http.Server{}, cfg)
+	assert.Error(t, err, "key file is missing")
+
+	cfg.TLSCertFile = ""
+	_, err = InitTLS(&http.Server{}, cfg)
+	assert.Error(t, err, "neither files nor autocert hosts are set")
+
+	cfg.AutocertHosts = []string{"example.com"}
+	cfg.AutocertCacheDir = t.TempDir()
+	server := &http.Server{}
+	redirectServer, err := InitTLS(server, cfg)
+	require.NoError(t, err)
+	require.NotNil(t, server.TLSConfig)
+	assert.NotNil(t, server.TLSConfig.GetCertificate)
+	assert.Equal(t, ":80", redirectServer.Addr)
+
+	cfg.HTTPRedirectAddress = ""
+	redirectServer, err = InitTLS(&http.Server{}, cfg)
+	require.NoError(t, err)
+	assert.Nil(t, redirectServer)
+}
+
+func TestRedirectToHTTPS(t *testing.T) {
+	tests := []struct {
+		name     string
+		port     string
+		method   string
+		target   string
+		code     int
+		location string
+	}{
+		{"default port", "443", http.MethodGet, "http://example.com/abc?x=1", http.StatusMovedPermanently, "https://example.com/abc?x=1"},
+		{"custom port", "8443", http.MethodGet, "http://example.com:8080/abc", http.StatusMovedPermanently, "https://example.com:8443/abc"},
+		{"method is kept", "443", http.MethodPost, "http://example.com/api/shorten", http.StatusPermanentRedirect, "https://example.com/api/shorten"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			redirectToHTTPS(tt.port)(w, httptest.NewRequest(tt.method, tt.target, nil))
+			assert.Equal(t, tt.code, w.Code)
+			assert.Equal(t, tt.location, w.Header().Get("Location"))
+		})
+	}
+}
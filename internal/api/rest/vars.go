@@ -0,0 +1,70 @@
+package rest
+
+import (
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/storage/v2"
+	"net/http"
+	"runtime"
+	"runtime/debug"
+)
+
+// newVars returns runtime and storage stats of the service: the goroutine count, GC stats, the deletion queue depth of
+// urlStorage and the DB connection pool stats of storages backed by a SQL DB.
+func newVars(urlStorage storage.URLStorage) *expvar.Map {
+	vars := new(expvar.Map).Init()
+	vars.Set("goroutines", expvar.Func(func() interface{} {
+		return runtime.NumGoroutine()
+	}))
+	vars.Set("gc", expvar.Func(func() interface{} {
+		var stats debug.GCStats
+		debug.ReadGCStats(&stats)
+		return map[string]interface{}{
+			"num_gc":         stats.NumGC,
+			"last_gc":        stats.LastGC,
+			"pause_total_ns": stats.PauseTotal.Nanoseconds(),
+		}
+	}))
+	if urlStorage == nil {
+		return vars
+	}
+	vars.Set("delete_queue_depth", expvar.Func(func() interface{} {
+		return urlStorage.QueueDepth()
+	}))
+	if db, ok := urlStorage.(storage.DBStatsGetter); ok {
+		vars.Set("db", expvar.Func(func() interface{} {
+			stats := db.DBStats()
+			return map[string]interface{}{
+				"max_open_connections": stats.MaxOpenConnections,
+				"open_connections":     stats.OpenConnections,
+				"in_use":               stats.InUse,
+				"idle":                 stats.Idle,
+				"wait_count":           stats.WaitCount,
+				"wait_duration_ns":     stats.WaitDuration.Nanoseconds(),
+				"max_idle_closed":      stats.MaxIdleClosed,
+				"max_idle_time_closed": stats.MaxIdleTimeClosed,
+				"max_lifetime_closed":  stats.MaxLifetimeClosed,
+			}
+		}))
+	}
+	return vars
+}
+
+// varsHandler serves variables published with expvar, e.g. cmdline and memstats, along with vars as one JSON object
+// the way expvar.Handler does. vars are not published themselves since servers are initialized more than once in
+// tests and publishing a name twice panics.
+func varsHandler(vars *expvar.Map) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		separator := "{\n"
+		write := func(kv expvar.KeyValue) {
+			key, _ := json.Marshal(kv.Key)
+			fmt.Fprintf(w, "%s%s: %s", separator, key, kv.Value)
+			separator = ",\n"
+		}
+		expvar.Do(write)
+		vars.Do(write)
+		fmt.Fprintf(w, "\n}\n")
+	}
+}
@@ -0,0 +1,157 @@
+// Package backup provides periodic backups of stored URLs to a bucket of an S3-compatible object storage.
+package backup
+
+import (
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/config"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/cron"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/logger"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/storage/v2"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/storage/v2/transfer"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// snapshot object keys are the prefix followed by snapshotPrefix, the snapshot time and snapshotSuffix, so that they
+// sort by time
+const (
+	snapshotPrefix     = "urls-"
+	snapshotTimeFormat = "20060102T150405Z"
+	snapshotSuffix     = ".jsonl.gz"
+)
+
+// Scheduler uploads gzipped snapshots of all entries of a storage in the format of transfer.Backup on a cron schedule
+// and removes all but the latest ones.
+type Scheduler struct {
+	// lastSuccess holds the unix time of the last successful backup, keep it first for 64-bit alignment
+	lastSuccess int64
+	cfg         *config.BackupConfig
+	schedule    *cron.Schedule
+	scanner     storage.EntryScanner
+	bucket      *bucket
+	log         *logger.Logger
+}
+
+// NewScheduler initializes a Scheduler backing up entries listed by scanner as configured by cfg.
+func NewScheduler(cfg *config.BackupConfig, scanner storage.EntryScanner, log *logger.Logger) (*Scheduler, error) {
+	schedule, err := cron.Parse(cfg.Schedule)
+	if err != nil {
+		return nil, err
+	}
+	return &Scheduler{
+		cfg:      cfg,
+		schedule: schedule,
+		scanner:  scanner,
+		bucket: &bucket{
+			endpoint:        cfg.Endpoint,
+			region:          cfg.Region,
+			name:            cfg.Bucket,
+			accessKeyID:     cfg.AccessKeyID,
+			secretAccessKey: cfg.SecretAccessKey,
+			client:          &http.Client{},
+			now:             time.Now,
+		},
+		log: log,
+	}, nil
+}
+
+// Run backs up entries on schedule until ctx is done, a failed backup is logged and retried on schedule.
+func (s *Scheduler) Run(ctx context.Context) {
+	for {
+		next := s.schedule.Next(time.Now())
+		if next.IsZero() {
+			s.log.Error("Backing up URLs: schedule has no next run", logger.String("schedule", s.cfg.Schedule))
+			return
+		}
+		t := time.NewTimer(time.Until(next))
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return
+		case <-t.C:
+		}
+		err := s.Backup(ctx)
+		if err != nil {
+			s.log.Error("Backing up URLs", logger.Error(err))
+		}
+	}
+}
+
+// Backup uploads a snapshot of all entries and removes snapshots but the configured number of latest ones.
+func (s *Scheduler) Backup(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, s.cfg.Timeout)
+	defer cancel()
+	now := time.Now().UTC()
+	// the snapshot is written to a file first since uploads are signed with the hash of their content
+	file, err := ioutil.TempFile("", "shortener-backup-*"+snapshotSuffix)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+	hash := sha256.New()
+	gz := gzip.NewWriter(io.MultiWriter(file, hash))
+	count, err := transfer.Backup(ctx, s.scanner, gz)
+	if err != nil {
+		return err
+	}
+	err = gz.Close()
+	if err != nil {
+		return err
+	}
+	size, err := file.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	_, err = file.Seek(0, io.SeekStart)
+	if err != nil {
+		return err
+	}
+	key := s.cfg.Prefix + snapshotPrefix + now.Format(snapshotTimeFormat) + snapshotSuffix
+	err = s.bucket.put(ctx, key, file, size, hex.EncodeToString(hash.Sum(nil)))
+	if err != nil {
+		return err
+	}
+	atomic.StoreInt64(&s.lastSuccess, now.Unix())
+	s.log.Info("Backing up URLs", logger.String("key", key), logger.Int("count", count))
+	return s.prune(ctx)
+}
+
+// prune removes snapshots but the configured number of latest ones.
+func (s *Scheduler) prune(ctx context.Context) error {
+	keys, err := s.bucket.list(ctx, s.cfg.Prefix+snapshotPrefix)
+	if err != nil {
+		return err
+	}
+	snapshots := keys[:0]
+	for _, key := range keys {
+		if strings.HasSuffix(key, snapshotSuffix) {
+			snapshots = append(snapshots, key)
+		}
+	}
+	for i := 0; i < len(snapshots)-s.cfg.Keep; i++ {
+		err = s.bucket.delete(ctx, snapshots[i])
+		if err != nil {
+			return err
+		}
+		s.log.Info("Removing backup", logger.String("key", snapshots[i]))
+	}
+	return nil
+}
+
+// LastSuccess returns the time of the last successful backup, it is zero until a backup succeeds.
+func (s *Scheduler) LastSuccess() time.Time {
+	lastSuccess := atomic.LoadInt64(&s.lastSuccess)
+	if lastSuccess == 0 {
+		return time.Time{}
+	}
+	return time.Unix(lastSuccess, 0)
+}
@@ -0,0 +1,167 @@
+// Package clickstream provides publishing of an event per redirect to Kafka or NATS so that downstream analytics can
+// consume click streams without querying the primary storage.
+package clickstream
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/config"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/logger"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/storage/v2/modelstorage"
+	"time"
+)
+
+// publisher parameters
+const (
+	queueSize      = 4096
+	batchSize      = 256
+	flushInterval  = time.Second
+	publishTimeout = 5 * time.Second
+)
+
+// Event defines the message published per redirect, the user agent is hashed so that raw client data does not leave
+// the service.
+type Event struct {
+	ShortID       string    `json:"short_id"`
+	ClickedAt     time.Time `json:"clicked_at"`
+	UserAgentHash string    `json:"user_agent_hash,omitempty"`
+	// Destination is the URL the redirect was served to, it tells apart the arms of split links
+	Destination string `json:"destination,omitempty"`
+	// Country is the ISO 3166-1 alpha-2 code of the visitor country when it is resolved
+	Country string `json:"country,omitempty"`
+	// Bot marks redirects of crawlers and other bots, consumers counting visitors are expected to leave them out
+	Bot bool `json:"bot,omitempty"`
+}
+
+// NewEvent returns the Event of click.
+func NewEvent(click modelstorage.ClickEntry) Event {
+	event := Event{ShortID: click.SURL, ClickedAt: click.ClickedAt, Destination: click.Destination, Country: click.Country, Bot: click.Bot}
+	if click.UserAgent != "" {
+		sum := sha256.Sum256([]byte(click.UserAgent))
+		event.UserAgentHash = hex.EncodeToString(sum[:])
+	}
+	return event
+}
+
+// broker delivers batches of events to the configured topic.
+type broker interface {
+	publish(ctx context.Context, events []Event) error
+	close() error
+}
+
+// Publisher batches click events and publishes them to a broker in the background. A nil Publisher drops events.
+type Publisher struct {
+	broker  broker
+	log     *logger.Logger
+	queue   chan Event
+	done    chan struct{}
+	stopped chan struct{}
+}
+
+// NewPublisher initializes a Publisher for the broker of cfg and starts its goroutine, it returns nil when no broker
+// is set. Publisher must be shut down to publish events still queued.
+func NewPublisher(cfg *config.ClickEventsConfig, log *logger.Logger) (*Publisher, error) {
+	var b broker
+	switch cfg.Broker {
+	case "":
+		return nil, nil
+	case "kafka":
+		b = newKafkaBroker(cfg)
+	case "nats":
+		nb, err := newNATSBroker(cfg)
+		if err != nil {
+			return nil, err
+		}
+		b = nb
+	default:
+		return nil, fmt.Errorf("unknown click events broker %q", cfg.Broker)
+	}
+	p := &Publisher{
+		broker:  b,
+		log:     log,
+		queue:   make(chan Event, queueSize),
+		done:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+	go p.run()
+	return p, nil
+}
+
+// Publish queues an event of click, events are dropped rather than blocking redirects when the queue is full or the
+// Publisher is shut down.
+func (p *Publisher) Publish(click modelstorage.ClickEntry) {
+	if p == nil {
+		return
+	}
+	select {
+	case <-p.done:
+		return
+	default:
+	}
+	select {
+	case p.queue <- NewEvent(click):
+	default:
+		p.log.Debug("Publishing click events: queue is full, dropping event", logger.String("sURL", click.SURL))
+	}
+}
+
+// Shutdown stops accepting events, waits until queued ones are published or ctx is done and closes the broker
+// connection.
+func (p *Publisher) Shutdown(ctx context.Context) error {
+	if p == nil {
+		return nil
+	}
+	close(p.done)
+	select {
+	case <-p.stopped:
+		return p.broker.close()
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// run collects queued events into batches and publishes them by size, by interval and on shutdown.
+func (p *Publisher) run() {
+	defer close(p.stopped)
+	t := time.NewTicker(flushInterval)
+	defer t.Stop()
+	batch := make([]Event, 0, batchSize)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), publishTimeout)
+		defer cancel()
+		err := p.broker.publish(ctx, batch)
+		if err != nil {
+			p.log.Warn("Publishing click events", logger.Error(err), logger.Int("count", len(batch)))
+		}
+		batch = make([]Event, 0, batchSize)
+	}
+	for {
+		select {
+		case event := <-p.queue:
+			batch = append(batch, event)
+			if len(batch) >= batchSize {
+				flush()
+			}
+		case <-t.C:
+			flush()
+		case <-p.done:
+			for {
+				select {
+				case event := <-p.queue:
+					batch = append(batch, event)
+					if len(batch) >= batchSize {
+						flush()
+					}
+				default:
+					flush()
+					return
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,149 @@
+package clickstream
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/config"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/storage/v2/modelstorage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewEvent(t *testing.T) {
+	clickedAt := time.Now().UTC()
+	event := NewEvent(modelstorage.ClickEntry{SURL: "abc", ClickedAt: clickedAt, Referrer: "https://example.com", UserAgent: "curl/7.79.1"})
+	assert.Equal(t, "abc", event.ShortID)
+	assert.Equal(t, clickedAt, event.ClickedAt)
+	assert.Len(t, event.UserAgentHash, 64)
+	assert.NotContains(t, event.UserAgentHash, "curl")
+	assert.Empty(t, NewEvent(modelstorage.ClickEntry{SURL: "abc"}).UserAgentHash)
+}
+
+func TestPublisherKafka(t *testing.T) {
+	requests := make(chan kafkaProduceRequest, 1)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/topics/clicks", r.URL.Path)
+		assert.Equal(t, kafkaContentType, r.Header.Get("Content-Type"))
+		var req kafkaProduceRequest
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		offsets := make([]string, len(req.Records))
+		for i := range offsets {
+			offsets[i] = fmt.Sprintf(`{"partition":0,"offset":%d}`, i)
+		}
+		w.Header().Set("Content-Type", kafkaAccept)
+		fmt.Fprintf(w, `{"offsets":[%s]}`, strings.Join(offsets, ","))
+		requests <- req
+	}))
+	defer ts.Close()
+	p, err := NewPublisher(&config.ClickEventsConfig{Broker: "kafka", URL: ts.URL, Topic: "clicks"}, nil)
+	require.NoError(t, err)
+
+	p.Publish(modelstorage.ClickEntry{SURL: "abc", ClickedAt: time.Now().UTC()})
+	p.Publish(modelstorage.ClickEntry{SURL: "def", ClickedAt: time.Now().UTC()})
+	require.NoError(t, p.Shutdown(context.Background()))
+	req := <-requests
+	require.Len(t, req.Records, 2)
+	assert.Equal(t, "abc", req.Records[0].Key)
+	assert.Equal(t, "def", req.Records[1].Value.ShortID)
+}
+
+func TestKafkaRecordErrors(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"offsets":[{"partition":0,"offset":1},{"error_code":50002,"error":"topic authorization failed"}]}`)
+	}))
+	defer ts.Close()
+	b := newKafkaBroker(&config.ClickEventsConfig{URL: ts.URL, Topic: "clicks"})
+	err := b.publish(context.Background(), []Event{{ShortID: "abc"}, {ShortID: "def"}})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "topic authorization failed")
+}
+
+// natsServer imitates a NATS server accepting one connection at a time and passing published messages to messages.
+func natsServer(t *testing.T, messages chan<- string) (url string, closeServer func()) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				_, _ = conn.Write([]byte(`INFO {"server_id":"test","max_payload":1048576}` + "\r\n"))
+				r := bufio.NewReader(conn)
+				for {
+					line, err := r.ReadString('\n')
+					if err != nil {
+						return
+					}
+					fields := strings.Fields(line)
+					switch fields[0] {
+					case "CONNECT":
+						assert.Contains(t, line, `"auth_token":"secret"`)
+					case "PING":
+						_, _ = conn.Write([]byte("PONG\r\n"))
+					case "PUB":
+						assert.Equal(t, "clicks", fields[1])
+						size, _ := strconv.Atoi(fields[2])
+						payload := make([]byte, size+2)
+						if _, err := io.ReadFull(r, payload); err != nil {
+							return
+						}
+						messages <- string(payload[:size])
+					}
+				}
+			}()
+		}
+	}()
+	return "nats://secret@" + l.Addr().String(), func() { l.Close() }
+}
+
+func TestPublisherNATS(t *testing.T) {
+	messages := make(chan string, 10)
+	url, closeServer := natsServer(t, messages)
+	defer closeServer()
+	p, err := NewPublisher(&config.ClickEventsConfig{Broker: "nats", URL: url, Topic: "clicks"}, nil)
+	require.NoError(t, err)
+
+	p.Publish(modelstorage.ClickEntry{SURL: "abc", ClickedAt: time.Now().UTC(), UserAgent: "curl/7.79.1"})
+	require.NoError(t, p.Shutdown(context.Background()))
+	require.Len(t, messages, 1)
+	var event Event
+	require.NoError(t, json.Unmarshal([]byte(<-messages), &event))
+	assert.Equal(t, "abc", event.ShortID)
+	assert.NotEmpty(t, event.UserAgentHash)
+}
+
+func TestNATSReconnects(t *testing.T) {
+	messages := make(chan string, 10)
+	url, closeServer := natsServer(t, messages)
+	defer closeServer()
+	b, err := newNATSBroker(&config.ClickEventsConfig{URL: url, Topic: "clicks"})
+	require.NoError(t, err)
+	defer b.close()
+
+	require.NoError(t, b.publish(context.Background(), []Event{{ShortID: "abc"}}))
+	// break the connection behind the broker's back
+	require.NoError(t, b.conn.Close())
+	require.NoError(t, b.publish(context.Background(), []Event{{ShortID: "def"}}))
+	assert.Len(t, messages, 2)
+}
+
+func TestNilPublisher(t *testing.T) {
+	p, err := NewPublisher(&config.ClickEventsConfig{}, nil)
+	require.NoError(t, err)
+	assert.Nil(t, p)
+	p.Publish(modelstorage.ClickEntry{SURL: "abc"})
+	assert.NoError(t, p.Shutdown(context.Background()))
+}
@@ -0,0 +1,102 @@
+package clickstream
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/config"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Kafka REST Proxy v2 media types of JSON-encoded records.
+const (
+	kafkaContentType = "application/vnd.kafka.json.v2+json"
+	kafkaAccept      = "application/vnd.kafka.v2+json"
+)
+
+// kafkaBroker produces events to a Kafka topic through the Kafka REST Proxy, keying records by short URL ID so that
+// clicks of one link keep their order within a partition.
+type kafkaBroker struct {
+	url    string
+	client *http.Client
+}
+
+// newKafkaBroker initializes a kafkaBroker producing to the topic of cfg.
+func newKafkaBroker(cfg *config.ClickEventsConfig) *kafkaBroker {
+	return &kafkaBroker{
+		url:    strings.TrimSuffix(cfg.URL, "/") + "/topics/" + url.PathEscape(cfg.Topic),
+		client: &http.Client{},
+	}
+}
+
+// publish produces events in one request.
+func (b *kafkaBroker) publish(ctx context.Context, events []Event) error {
+	records := make([]kafkaRecord, 0, len(events))
+	for _, event := range events {
+		records = append(records, kafkaRecord{Key: event.ShortID, Value: event})
+	}
+	body, err := json.Marshal(kafkaProduceRequest{Records: records})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, b.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", kafkaContentType)
+	req.Header.Set("Accept", kafkaAccept)
+	res, err := b.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("kafka REST proxy responded with %s", res.Status)
+	}
+	// the proxy responds with 200 even when some records fail, reporting errors per record
+	var produced kafkaProduceResponse
+	if err := json.NewDecoder(res.Body).Decode(&produced); err != nil {
+		return err
+	}
+	failed := 0
+	var lastErr string
+	for _, offset := range produced.Offsets {
+		if offset.ErrorCode != nil {
+			failed++
+			lastErr = offset.Error
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("kafka REST proxy failed to produce %d of %d records: %s", failed, len(records), lastErr)
+	}
+	return nil
+}
+
+// close releases idle connections.
+func (b *kafkaBroker) close() error {
+	b.client.CloseIdleConnections()
+	return nil
+}
+
+// Kafka REST Proxy v2 produce request and response bodies.
+type (
+	kafkaProduceRequest struct {
+		Records []kafkaRecord `json:"records"`
+	}
+	kafkaRecord struct {
+		Key   string `json:"key"`
+		Value Event  `json:"value"`
+	}
+	kafkaProduceResponse struct {
+		Offsets []kafkaOffset `json:"offsets"`
+	}
+	kafkaOffset struct {
+		Partition *int   `json:"partition"`
+		Offset    *int64 `json:"offset"`
+		ErrorCode *int   `json:"error_code"`
+		Error     string `json:"error"`
+	}
+)
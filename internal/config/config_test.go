@@ -0,0 +1,183 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeConfigFile writes content to a configuration file named name in a temporary directory and returns its path.
+func writeConfigFile(t *testing.T, name, content string) string {
+	path := filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+	return path
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	path := writeConfigFile(t, "config.yaml", `
+server_address: ":9090"
+base_url: http://short.example
+delete_workers: 8
+token_ttl: 12h
+allowed_schemes: [https, ftp]
+`)
+	t.Setenv("DELETE_WORKERS", "6")
+	cfg, err := Load([]string{"-config", path, "-a", ":7070"})
+	require.NoError(t, err)
+	// flags override environment variables and the file
+	assert.Equal(t, ":7070", cfg.ServerConfig.ServerAddress)
+	// environment variables override the file
+	assert.Equal(t, 6, cfg.StorageConfig.DeleteWorkers)
+	// the file overrides defaults
+	assert.Equal(t, "http://short.example", cfg.ServerConfig.BaseURL)
+	assert.Equal(t, 12*time.Hour, cfg.SecretConfig.TokenTTL)
+	assert.Equal(t, []string{"https", "ftp"}, cfg.ShortenerConfig.AllowedSchemes)
+	// defaults apply to parameters set nowhere
+	assert.Equal(t, 10000, cfg.StorageConfig.CacheSize)
+	assert.Equal(t, "url_storage.json", cfg.StorageConfig.FileStoragePath)
+}
+
+func TestLoadJSON(t *testing.T) {
+	path := writeConfigFile(t, "config.json", `{"DELETE_BATCH_SIZE": 20, "allowed_schemes": "https", "rate_limit_ip_rps": 2.5}`)
+	t.Setenv("CONFIG_FILE", path)
+	cfg, err := Load(nil)
+	require.NoError(t, err)
+	assert.Equal(t, 20, cfg.StorageConfig.DeleteBatchSize)
+	assert.Equal(t, []string{"https"}, cfg.ShortenerConfig.AllowedSchemes)
+	assert.Equal(t, 2.5, cfg.RateLimitConfig.IPRPS)
+}
+
+func TestLoadListsEveryProblem(t *testing.T) {
+	path := writeConfigFile(t, "config.yaml", `
+delete_workers: 0
+log_format: xml
+listen_port: 80
+webhook_urls: {primary: http://hooks.example}
+`)
+	_, err := Load([]string{"-config", path, "-t", "10.0.0.1"})
+	var validationError *ValidationError
+	require.True(t, errors.As(err, &validationError), err)
+	assert.Len(t, validationError.Problems, 5)
+	assert.Contains(t, err.Error(), `unknown parameter "listen_port"`)
+	assert.Contains(t, err.Error(), "webhook_urls must be a scalar or a list of scalars")
+	assert.Contains(t, err.Error(), "DELETE_WORKERS must be at least 1, got 0")
+	assert.Contains(t, err.Error(), `LOG_FORMAT must be either text or json, got "xml"`)
+	assert.Contains(t, err.Error(), "TRUSTED_SUBNET must be a CIDR")
+}
+
+func TestLoadBackup(t *testing.T) {
+	t.Setenv("BACKUP_SCHEDULE", "0 25 * * *")
+	t.Setenv("BACKUP_KEEP", "0")
+	_, err := Load(nil)
+	var validationError *ValidationError
+	require.True(t, errors.As(err, &validationError), err)
+	assert.Len(t, validationError.Problems, 4)
+
+	t.Setenv("BACKUP_SCHEDULE", "@daily")
+	t.Setenv("BACKUP_KEEP", "3")
+	t.Setenv("BACKUP_BUCKET", "backups")
+	t.Setenv("BACKUP_ACCESS_KEY_ID", "key")
+	t.Setenv("BACKUP_SECRET_ACCESS_KEY", "secret")
+	cfg, err := Load(nil)
+	require.NoError(t, err)
+	assert.Equal(t, "https://s3.amazonaws.com", cfg.BackupConfig.Endpoint)
+	assert.Equal(t, 3, cfg.BackupConfig.Keep)
+}
+
+func TestLoadCORS(t *testing.T) {
+	t.Setenv("CORS_ALLOWED_ORIGINS", "*,https://dashboard.example/path")
+	t.Setenv("CORS_ALLOW_CREDENTIALS", "true")
+	_, err := Load(nil)
+	var validationError *ValidationError
+	require.True(t, errors.As(err, &validationError), err)
+	assert.Len(t, validationError.Problems, 2)
+
+	t.Setenv("CORS_ALLOWED_ORIGINS", "https://dashboard.example,https://*.example.com:8443")
+	cfg, err := Load(nil)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"GET", "POST", "PUT", "PATCH", "DELETE"}, cfg.CORSConfig.AllowedMethods)
+}
+
+func TestLoadURLValidation(t *testing.T) {
+	t.Setenv("MIN_URL_LENGTH", "20")
+	t.Setenv("MAX_URL_LENGTH", "10")
+	t.Setenv("IDN_POLICY", "punycode")
+	t.Setenv("ALLOWED_DOMAINS", "example.com,*.example.org")
+	_, err := Load(nil)
+	var validationError *ValidationError
+	require.True(t, errors.As(err, &validationError), err)
+	assert.Len(t, validationError.Problems, 3)
+
+	t.Setenv("MAX_URL_LENGTH", "2048")
+	t.Setenv("IDN_POLICY", "reject")
+	t.Setenv("ALLOWED_DOMAINS", "example.com,пример.рф")
+	cfg, err := Load(nil)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"example.com", "пример.рф"}, cfg.ShortenerConfig.AllowedDomains)
+}
+
+func TestLoadErrorReport(t *testing.T) {
+	t.Setenv("ERROR_REPORT_DSN", "https://sentry.example/42")
+	t.Setenv("ERROR_REPORT_SAMPLE_RATE", "1.5")
+	_, err := Load(nil)
+	var validationError *ValidationError
+	require.True(t, errors.As(err, &validationError), err)
+	assert.Len(t, validationError.Problems, 2)
+
+	t.Setenv("ERROR_REPORT_DSN", "https://public-key@sentry.example/42")
+	t.Setenv("ERROR_REPORT_SAMPLE_RATE", "0.1")
+	cfg, err := Load(nil)
+	require.NoError(t, err)
+	assert.Equal(t, 0.1, cfg.ErrorReportConfig.SampleRate)
+	assert.Equal(t, 100, cfg.ErrorReportConfig.QueueSize)
+}
+
+func TestLoadAccessLog(t *testing.T) {
+	t.Setenv("ACCESS_LOG_FORMAT", "common")
+	t.Setenv("ACCESS_LOG_MAX_SIZE", "-1")
+	_, err := Load(nil)
+	var validationError *ValidationError
+	require.True(t, errors.As(err, &validationError), err)
+	assert.Len(t, validationError.Problems, 2)
+
+	t.Setenv("ACCESS_LOG_FORMAT", "json")
+	t.Setenv("ACCESS_LOG_MAX_SIZE", "0")
+	cfg, err := Load(nil)
+	require.NoError(t, err)
+	assert.Equal(t, 7, cfg.LogConfig.AccessLogMaxBackups)
+}
+
+func TestLoadParseError(t *testing.T) {
+	path := writeConfigFile(t, "config.yaml", "delete_workers: many\ntoken_ttl: soon\n")
+	_, err := Load([]string{"-config", path})
+	var validationError *ValidationError
+	require.True(t, errors.As(err, &validationError), err)
+	assert.Len(t, validationError.Problems, 2)
+}
+
+func TestLoadReplicasRequirePrimary(t *testing.T) {
+	t.Setenv("DATABASE_REPLICA_DSNS", "postgres://replica1/db,postgres://replica2/db")
+	_, err := Load(nil)
+	assert.EqualError(t, err, "invalid configuration: DATABASE_REPLICA_DSNS requires DATABASE_DSN or STORAGE_URI")
+
+	cfg, err := Load([]string{"-d", "postgres://primary/db"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"postgres://replica1/db", "postgres://replica2/db"}, cfg.StorageConfig.DatabaseReplicaDSNs)
+}
+
+func TestLoadStaleArchiving(t *testing.T) {
+	t.Setenv("STALE_NOTICE_BEFORE", "168h")
+	_, err := Load(nil)
+	assert.EqualError(t, err, "invalid configuration: STALE_NOTICE_BEFORE must be non-negative and shorter than STALE_AFTER, got 168h0m0s")
+
+	t.Setenv("STALE_AFTER", "4320h")
+	cfg, err := Load(nil)
+	require.NoError(t, err)
+	assert.Equal(t, 180*24*time.Hour, cfg.StorageConfig.StaleAfter)
+	assert.Equal(t, 24*time.Hour, cfg.StorageConfig.StaleArchiveInterval)
+}
@@ -0,0 +1,96 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+)
+
+// readConfigFile reads parameters from the configuration file at path, JSON when its extension is .json and YAML
+// otherwise, and returns them keyed by their environment variable names. Unknown keys and values which are neither
+// scalars nor lists of scalars are added to p, failures to read or decode the file are returned.
+func readConfigFile(path string, p *problems) (map[string]string, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	raw := make(map[string]interface{})
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		decoder := json.NewDecoder(bytes.NewReader(content))
+		// keep numbers as written, float64 would turn large integers into exponents
+		decoder.UseNumber()
+		err = decoder.Decode(&raw)
+	} else {
+		err = yaml.Unmarshal(content, &raw)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("config file %s: %w", path, err)
+	}
+	known := envNames()
+	values := make(map[string]string, len(raw))
+	for key, value := range raw {
+		name := strings.ToUpper(key)
+		if !known[name] {
+			p.addf("config file %s: unknown parameter %q", path, key)
+			continue
+		}
+		if value == nil {
+			continue
+		}
+		item, ok := fileValue(value)
+		if ok {
+			values[name] = item
+			continue
+		}
+		items, ok := value.([]interface{})
+		if !ok {
+			p.addf("config file %s: %s must be a scalar or a list of scalars", path, key)
+			continue
+		}
+		list := make([]string, 0, len(items))
+		for _, value := range items {
+			item, ok = fileValue(value)
+			if !ok {
+				break
+			}
+			list = append(list, item)
+		}
+		if !ok {
+			p.addf("config file %s: %s must be a scalar or a list of scalars", path, key)
+			continue
+		}
+		// all list parameters are separated by commas
+		values[name] = strings.Join(list, ",")
+	}
+	return values, nil
+}
+
+// fileValue formats a scalar value of the configuration file the way it is written in environment variables.
+func fileValue(value interface{}) (string, bool) {
+	switch value.(type) {
+	case string, bool, int, int64, uint64, float64, json.Number:
+		return fmt.Sprint(value), true
+	}
+	return "", false
+}
+
+// envNames returns names of environment variables of all configuration parameters.
+func envNames() map[string]bool {
+	names := make(map[string]bool)
+	cfg := reflect.TypeOf(Config{})
+	for i := 0; i < cfg.NumField(); i++ {
+		s := cfg.Field(i).Type.Elem()
+		for j := 0; j < s.NumField(); j++ {
+			name := s.Field(j).Tag.Get("env")
+			if name != "" {
+				names[name] = true
+			}
+		}
+	}
+	return names
+}
@@ -0,0 +1,42 @@
+package cron
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNext(t *testing.T) {
+	// Thursday
+	now := time.Date(2026, 10, 15, 10, 17, 30, 0, time.UTC)
+	tests := []struct {
+		spec string
+		next time.Time
+	}{
+		{"* * * * *", time.Date(2026, 10, 15, 10, 18, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2026, 10, 15, 10, 30, 0, 0, time.UTC)},
+		{"@daily", time.Date(2026, 10, 16, 0, 0, 0, 0, time.UTC)},
+		{"30 2 * * *", time.Date(2026, 10, 16, 2, 30, 0, 0, time.UTC)},
+		{"0 3 * * 7", time.Date(2026, 10, 18, 3, 0, 0, 0, time.UTC)},
+		{"0 0 1 1 *", time.Date(2027, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 12 1-5/2,20 * *", time.Date(2026, 10, 20, 12, 0, 0, 0, time.UTC)},
+		// either day field matches when both are restricted
+		{"0 0 31 * 5", time.Date(2026, 10, 16, 0, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", time.Date(2028, 2, 29, 0, 0, 0, 0, time.UTC)},
+		{"0 0 30 2 *", time.Time{}},
+	}
+	for _, tt := range tests {
+		s, err := Parse(tt.spec)
+		require.NoError(t, err, tt.spec)
+		assert.Equal(t, tt.next, s.Next(now), tt.spec)
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	for _, spec := range []string{"", "* * * *", "60 * * * *", "* * 0 * *", "*/0 * * * *", "5-1 * * * *", "a * * * *", "@often"} {
+		_, err := Parse(spec)
+		assert.Error(t, err, spec)
+	}
+}
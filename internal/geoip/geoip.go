@@ -0,0 +1,344 @@
+// Package geoip provides resolving of client IP addresses to countries with a MaxMind GeoIP2 or GeoLite2 database in
+// the MaxMind DB format, such as GeoLite2-Country.mmdb or GeoLite2-City.mmdb.
+package geoip
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"os"
+	"strings"
+)
+
+// metadataMarker precedes the metadata section at the end of a database file.
+var metadataMarker = []byte("\xab\xcd\xefMaxMind.com")
+
+// dataSectionSeparator is the number of zero bytes between the search tree and the data section.
+const dataSectionSeparator = 16
+
+// maxDepth bounds nesting of decoded data so that corrupted databases cannot exhaust the stack.
+const maxDepth = 32
+
+// data field types of the MaxMind DB format
+const (
+	typeExtended = iota
+	typePointer
+	typeString
+	typeDouble
+	typeBytes
+	typeUint16
+	typeUint32
+	typeMap
+	typeInt32
+	typeUint64
+	typeUint128
+	typeArray
+	typeContainer
+	typeEndMarker
+	typeBool
+	typeFloat
+)
+
+// Reader resolves IP addresses to countries, the whole database is kept in memory. A nil Reader resolves no address.
+type Reader struct {
+	buf        []byte
+	nodeCount  uint
+	recordSize uint
+	ipVersion  uint
+	treeSize   uint
+	// ipv4Start is the node IPv4 lookups start at in IPv6 databases, found by following 96 zero bits
+	ipv4Start uint
+}
+
+// Open reads the database at path.
+func Open(path string) (*Reader, error) {
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return New(buf)
+}
+
+// New initializes a Reader of the database contents buf.
+func New(buf []byte) (*Reader, error) {
+	start := bytes.LastIndex(buf, metadataMarker)
+	if start < 0 {
+		return nil, errors.New("geoip: metadata section not found, not a MaxMind DB file")
+	}
+	metadataStart := start + len(metadataMarker)
+	d := decoder{buf: buf[metadataStart:]}
+	value, _, err := d.decode(0, 0)
+	if err != nil {
+		return nil, fmt.Errorf("geoip: decoding metadata: %w", err)
+	}
+	metadata, ok := value.(map[string]interface{})
+	if !ok {
+		return nil, errors.New("geoip: metadata is not a map")
+	}
+	r := &Reader{
+		buf:        buf[:start],
+		nodeCount:  uint(toUint(metadata["node_count"])),
+		recordSize: uint(toUint(metadata["record_size"])),
+		ipVersion:  uint(toUint(metadata["ip_version"])),
+	}
+	switch r.recordSize {
+	case 24, 28, 32:
+	default:
+		return nil, fmt.Errorf("geoip: unsupported record size %d", r.recordSize)
+	}
+	if r.ipVersion != 4 && r.ipVersion != 6 {
+		return nil, fmt.Errorf("geoip: unsupported IP version %d", r.ipVersion)
+	}
+	r.treeSize = r.nodeCount * r.recordSize / 4
+	if r.treeSize+dataSectionSeparator > uint(len(r.buf)) {
+		return nil, errors.New("geoip: search tree exceeds the database size")
+	}
+	if r.ipVersion == 6 {
+		node := uint(0)
+		for i := 0; i < 96 && node < r.nodeCount; i++ {
+			node = r.record(node, 0)
+		}
+		r.ipv4Start = node
+	}
+	return r, nil
+}
+
+// Country returns the ISO 3166-1 alpha-2 code of the country ip is located in, falling back to the country it is
+// registered in. Addresses missing in the database have an empty code.
+func (r *Reader) Country(ip net.IP) (string, error) {
+	if r == nil || ip == nil {
+		return "", nil
+	}
+	record, err := r.lookup(ip)
+	if err != nil || record == nil {
+		return "", err
+	}
+	for _, key := range []string{"country", "registered_country"} {
+		country, _ := record[key].(map[string]interface{})
+		if code, _ := country["iso_code"].(string); code != "" {
+			return strings.ToUpper(code), nil
+		}
+	}
+	return "", nil
+}
+
+// lookup returns the data record of the network ip belongs to, nil when there is none.
+func (r *Reader) lookup(ip net.IP) (map[string]interface{}, error) {
+	node := uint(0)
+	bits := ip.To4()
+	if bits != nil {
+		node = r.ipv4Start
+	} else if bits = ip.To16(); bits == nil || r.ipVersion == 4 {
+		return nil, nil
+	}
+	for i := 0; i < len(bits)*8 && node < r.nodeCount; i++ {
+		bit := uint(bits[i/8]>>(7-uint(i%8))) & 1
+		node = r.record(node, bit)
+	}
+	if node == r.nodeCount {
+		return nil, nil
+	}
+	if node < r.nodeCount {
+		return nil, errors.New("geoip: search tree is deeper than addresses")
+	}
+	offset := node - r.nodeCount - dataSectionSeparator
+	d := decoder{buf: r.buf[r.treeSize+dataSectionSeparator:]}
+	value, _, err := d.decode(offset, 0)
+	if err != nil {
+		return nil, fmt.Errorf("geoip: decoding record: %w", err)
+	}
+	record, _ := value.(map[string]interface{})
+	return record, nil
+}
+
+// record returns the left (bit 0) or the right (bit 1) record of node.
+func (r *Reader) record(node, bit uint) uint {
+	b := r.buf[node*r.recordSize/4:]
+	switch r.recordSize {
+	case 24:
+		b = b[bit*3:]
+		return uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+	case 28:
+		if bit == 0 {
+			return uint(b[3]&0xf0)<<20 | uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+		}
+		return uint(b[3]&0x0f)<<24 | uint(b[4])<<16 | uint(b[5])<<8 | uint(b[6])
+	default:
+		return uint(binary.BigEndian.Uint32(b[bit*4:]))
+	}
+}
+
+// decoder decodes data fields of a MaxMind DB section, pointers are offsets from the section start.
+type decoder struct {
+	buf []byte
+}
+
+// decode returns the value of the field at offset and the offset following it.
+func (d *decoder) decode(offset uint, depth int) (interface{}, uint, error) {
+	if depth > maxDepth {
+		return nil, 0, errors.New("data is nested too deeply")
+	}
+	ctrl, err := d.byteAt(offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	offset++
+	kind := uint(ctrl >> 5)
+	if kind == typePointer {
+		pointer, next, err := d.pointer(ctrl, offset)
+		if err != nil {
+			return nil, 0, err
+		}
+		value, _, err := d.decode(pointer, depth+1)
+		return value, next, err
+	}
+	if kind == typeExtended {
+		extended, err := d.byteAt(offset)
+		if err != nil {
+			return nil, 0, err
+		}
+		kind = 7 + uint(extended)
+		offset++
+	}
+	size := uint(ctrl & 0x1f)
+	if size >= 29 {
+		n := size - 28
+		extra, err := d.bytesAt(offset, n)
+		if err != nil {
+			return nil, 0, err
+		}
+		offset += n
+		switch n {
+		case 1:
+			size = 29 + uint(extra[0])
+		case 2:
+			size = 285 + (uint(extra[0])<<8 | uint(extra[1]))
+		default:
+			size = 65821 + (uint(extra[0])<<16 | uint(extra[1])<<8 | uint(extra[2]))
+		}
+	}
+	// every map pair and array item takes at least a byte, larger sizes are corrupted
+	if (kind == typeMap || kind == typeArray) && size > uint(len(d.buf)) {
+		return nil, 0, fmt.Errorf("invalid container size %d", size)
+	}
+	switch kind {
+	case typeMap:
+		value := make(map[string]interface{}, size)
+		for i := uint(0); i < size; i++ {
+			key, next, err := d.decode(offset, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			name, ok := key.(string)
+			if !ok {
+				return nil, 0, errors.New("map key is not a string")
+			}
+			value[name], offset, err = d.decode(next, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+		}
+		return value, offset, nil
+	case typeArray:
+		value := make([]interface{}, 0, size)
+		for i := uint(0); i < size; i++ {
+			var item interface{}
+			item, offset, err = d.decode(offset, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			value = append(value, item)
+		}
+		return value, offset, nil
+	case typeBool:
+		return size != 0, offset, nil
+	}
+	payload, err := d.bytesAt(offset, size)
+	if err != nil {
+		return nil, 0, err
+	}
+	offset += size
+	switch kind {
+	case typeString:
+		return string(payload), offset, nil
+	case typeBytes:
+		return append([]byte(nil), payload...), offset, nil
+	case typeDouble:
+		if size != 8 {
+			return nil, 0, fmt.Errorf("invalid double size %d", size)
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(payload)), offset, nil
+	case typeFloat:
+		if size != 4 {
+			return nil, 0, fmt.Errorf("invalid float size %d", size)
+		}
+		return math.Float32frombits(binary.BigEndian.Uint32(payload)), offset, nil
+	case typeUint16, typeUint32, typeUint64, typeInt32:
+		if size > 8 {
+			return nil, 0, fmt.Errorf("invalid integer size %d", size)
+		}
+		var value uint64
+		for _, b := range payload {
+			value = value<<8 | uint64(b)
+		}
+		if kind == typeInt32 {
+			return int32(value), offset, nil
+		}
+		return value, offset, nil
+	case typeUint128:
+		// 128-bit integers are not used by country lookups, keep their bytes
+		return append([]byte(nil), payload...), offset, nil
+	}
+	return nil, 0, fmt.Errorf("unsupported data type %d", kind)
+}
+
+// pointer returns the offset a pointer field with the control byte ctrl points to and the offset following it.
+func (d *decoder) pointer(ctrl byte, offset uint) (uint, uint, error) {
+	n := uint(ctrl>>3)&0x3 + 1
+	b, err := d.bytesAt(offset, n)
+	if err != nil {
+		return 0, 0, err
+	}
+	value := uint(ctrl & 0x7)
+	if n == 4 {
+		value = 0
+	}
+	for _, c := range b {
+		value = value<<8 | uint(c)
+	}
+	switch n {
+	case 2:
+		value += 2048
+	case 3:
+		value += 526336
+	}
+	return value, offset + n, nil
+}
+
+func (d *decoder) byteAt(offset uint) (byte, error) {
+	if offset >= uint(len(d.buf)) {
+		return 0, errors.New("unexpected end of data")
+	}
+	return d.buf[offset], nil
+}
+
+func (d *decoder) bytesAt(offset, n uint) ([]byte, error) {
+	if offset+n > uint(len(d.buf)) {
+		return nil, errors.New("unexpected end of data")
+	}
+	return d.buf[offset : offset+n], nil
+}
+
+// toUint converts decoded unsigned integers of metadata.
+func toUint(value interface{}) uint64 {
+	switch v := value.(type) {
+	case uint64:
+		return v
+	case int32:
+		return uint64(v)
+	}
+	return 0
+}
@@ -0,0 +1,155 @@
+package geoip
+
+import (
+	"bytes"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testNetwork maps a network to a data record encoded by the test.
+type testNetwork struct {
+	cidr string
+	data []byte
+}
+
+// field encodes a control byte of kind and size followed by payload, sizes must be below 29.
+func field(kind, size int, payload ...byte) []byte {
+	if kind > 7 {
+		return append([]byte{byte(size), byte(kind - 7)}, payload...)
+	}
+	return append([]byte{byte(kind<<5 | size)}, payload...)
+}
+
+func str(s string) []byte {
+	return field(typeString, len(s), []byte(s)...)
+}
+
+func mapOf(pairs ...[]byte) []byte {
+	return append(field(typeMap, len(pairs)/2), bytes.Join(pairs, nil)...)
+}
+
+// buildDatabase encodes an IPv6 database of networks with the given record size, IPv4 networks are mapped into
+// ::/96 the way MaxMind databases keep them.
+func buildDatabase(t *testing.T, recordSize int, networks []testNetwork) []byte {
+	// nodes hold records: -1 is empty, values below dataBase are nodes and ones from it are data offsets
+	const dataBase = 1 << 20
+	nodes := [][2]int{{-1, -1}}
+	var data []byte
+	for _, network := range networks {
+		_, ipNet, err := net.ParseCIDR(network.cidr)
+		require.NoError(t, err)
+		ones, bits := ipNet.Mask.Size()
+		ip := ipNet.IP.To16()
+		if bits == 32 {
+			ip = append(make(net.IP, 12), ipNet.IP.To4()...)
+			ones += 96
+		}
+		node := 0
+		for i := 0; i < ones; i++ {
+			bit := int(ip[i/8]>>(7-uint(i%8))) & 1
+			if i == ones-1 {
+				nodes[node][bit] = dataBase + len(data)
+				break
+			}
+			if nodes[node][bit] < 0 {
+				nodes = append(nodes, [2]int{-1, -1})
+				nodes[node][bit] = len(nodes) - 1
+			}
+			node = nodes[node][bit]
+		}
+		data = append(data, network.data...)
+	}
+	nodeCount := len(nodes)
+	var tree []byte
+	for _, node := range nodes {
+		var values [2]uint32
+		for i, value := range node {
+			switch {
+			case value < 0:
+				values[i] = uint32(nodeCount)
+			case value >= dataBase:
+				values[i] = uint32(nodeCount + dataSectionSeparator + value - dataBase)
+			default:
+				values[i] = uint32(value)
+			}
+		}
+		l, r := values[0], values[1]
+		switch recordSize {
+		case 24:
+			tree = append(tree, byte(l>>16), byte(l>>8), byte(l), byte(r>>16), byte(r>>8), byte(r))
+		case 28:
+			tree = append(tree, byte(l>>16), byte(l>>8), byte(l), byte(l>>24)<<4|byte(r>>24), byte(r>>16), byte(r>>8), byte(r))
+		case 32:
+			tree = append(tree, byte(l>>24), byte(l>>16), byte(l>>8), byte(l), byte(r>>24), byte(r>>16), byte(r>>8), byte(r))
+		}
+	}
+	metadata := mapOf(
+		str("node_count"), field(typeUint32, 2, byte(nodeCount>>8), byte(nodeCount)),
+		str("record_size"), field(typeUint16, 1, byte(recordSize)),
+		str("ip_version"), field(typeUint16, 1, 6),
+		str("database_type"), str("Test-Country"),
+		str("build_epoch"), field(typeUint64, 4, 0x62, 0x00, 0x00, 0x00),
+	)
+	buf := append(tree, make([]byte, dataSectionSeparator)...)
+	buf = append(buf, data...)
+	buf = append(buf, metadataMarker...)
+	return append(buf, metadata...)
+}
+
+func TestReaderCountry(t *testing.T) {
+	germany := mapOf(str("country"), mapOf(str("iso_code"), str("de"), str("geoname_id"), field(typeUint32, 3, 0x2a, 0x9a, 0x09)))
+	// the second record points to the iso_code key of the first one: the map control byte, the country key and the
+	// inner map control byte precede it
+	keyOffset := len(field(typeMap, 1)) + len(str("country")) + len(field(typeMap, 2))
+	unitedStates := mapOf(str("registered_country"), mapOf(field(typePointer, 0, byte(keyOffset)), str("US")))
+	networks := []testNetwork{
+		{cidr: "1.2.3.0/24", data: germany},
+		{cidr: "2001:db8::/32", data: unitedStates},
+	}
+	for _, recordSize := range []int{24, 28, 32} {
+		reader, err := New(buildDatabase(t, recordSize, networks))
+		require.NoError(t, err, "record size %d", recordSize)
+		tests := []struct {
+			ip      string
+			country string
+		}{
+			{ip: "1.2.3.4", country: "DE"},
+			{ip: "::ffff:1.2.3.200", country: "DE"},
+			{ip: "1.2.4.1", country: ""},
+			{ip: "2001:db8::1", country: "US"},
+			{ip: "2001:db9::1", country: ""},
+		}
+		for _, tt := range tests {
+			country, err := reader.Country(net.ParseIP(tt.ip))
+			assert.NoError(t, err)
+			assert.Equal(t, tt.country, country, "record size %d, IP %s", recordSize, tt.ip)
+		}
+	}
+
+	var nilReader *Reader
+	country, err := nilReader.Country(net.ParseIP("1.2.3.4"))
+	assert.NoError(t, err)
+	assert.Empty(t, country)
+}
+
+func TestOpen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "country.mmdb")
+	require.NoError(t, os.WriteFile(path, buildDatabase(t, 24, nil), 0600))
+	reader, err := Open(path)
+	require.NoError(t, err)
+	country, err := reader.Country(net.ParseIP("1.2.3.4"))
+	assert.NoError(t, err)
+	assert.Empty(t, country)
+
+	_, err = Open(filepath.Join(t.TempDir(), "missing.mmdb"))
+	assert.Error(t, err)
+	_, err = New([]byte("not a database"))
+	assert.Error(t, err)
+	_, err = New(append(append([]byte(nil), metadataMarker...), mapOf(str("record_size"), field(typeUint16, 1, 20))...))
+	assert.Error(t, err)
+}
@@ -0,0 +1,231 @@
+// Package logger provides a leveled structured logger writing text or JSON lines.
+package logger
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Level defines logging severity.
+type Level int8
+
+// Logging levels in the increasing order of severity.
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+var levelNames = [...]string{LevelDebug: "debug", LevelInfo: "info", LevelWarn: "warn", LevelError: "error"}
+
+// String returns a lower-case level name.
+func (l Level) String() string {
+	if l < LevelDebug || l > LevelError {
+		return "level(" + strconv.Itoa(int(l)) + ")"
+	}
+	return levelNames[l]
+}
+
+// ParseLevel converts a level name (debug, info, warn or error, case-insensitive) into a Level.
+func ParseLevel(s string) (Level, error) {
+	for level, name := range levelNames {
+		if strings.EqualFold(s, name) {
+			return Level(level), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown log level %q, expected one of debug, info, warn, error", s)
+}
+
+// Output formats, FormatCombined is only supported by access logs.
+const (
+	FormatText     = "text"
+	FormatJSON     = "json"
+	FormatCombined = "combined"
+)
+
+// Field defines a key-value pair attached to a log entry.
+type Field struct {
+	Key   string
+	Value interface{}
+}
+
+// String returns a string Field.
+func String(key, value string) Field {
+	return Field{Key: key, Value: value}
+}
+
+// Int returns an integer Field.
+func Int(key string, value int) Field {
+	return Field{Key: key, Value: value}
+}
+
+// Duration returns a time.Duration Field rendered as a string.
+func Duration(key string, value time.Duration) Field {
+	return Field{Key: key, Value: value.String()}
+}
+
+// Error returns an error Field with the "error" key.
+func Error(err error) Field {
+	if err == nil {
+		return Field{Key: "error", Value: nil}
+	}
+	return Field{Key: "error", Value: err.Error()}
+}
+
+// Any returns a Field holding an arbitrary value, it is rendered via fmt in text format and via encoding/json in JSON
+// format.
+func Any(key string, value interface{}) Field {
+	return Field{Key: key, Value: value}
+}
+
+// Logger writes leveled log entries with fields, it is safe for concurrent use. A nil Logger discards all entries.
+type Logger struct {
+	out    *output
+	json   bool
+	fields []Field
+}
+
+// output is shared by loggers derived from one another, it serializes their writes and holds their level.
+type output struct {
+	mu    sync.Mutex
+	w     io.Writer
+	level int32
+}
+
+// New initializes a Logger writing entries of level and above to w in the given format.
+func New(w io.Writer, level Level, format string) (*Logger, error) {
+	if format != FormatText && format != FormatJSON {
+		return nil, fmt.Errorf("unknown log format %q, expected either %s or %s", format, FormatText, FormatJSON)
+	}
+	return &Logger{out: &output{w: w, level: int32(level)}, json: format == FormatJSON}, nil
+}
+
+// SetLevel makes l and all loggers derived from one another along with it write entries of level and above only.
+func (l *Logger) SetLevel(level Level) {
+	if l == nil {
+		return
+	}
+	atomic.StoreInt32(&l.out.level, int32(level))
+}
+
+// With returns a Logger adding fields to every entry.
+func (l *Logger) With(fields ...Field) *Logger {
+	if l == nil {
+		return nil
+	}
+	child := *l
+	child.fields = append(append(make([]Field, 0, len(l.fields)+len(fields)), l.fields...), fields...)
+	return &child
+}
+
+// Debug logs a message at LevelDebug.
+func (l *Logger) Debug(msg string, fields ...Field) {
+	l.log(LevelDebug, msg, fields)
+}
+
+// Info logs a message at LevelInfo.
+func (l *Logger) Info(msg string, fields ...Field) {
+	l.log(LevelInfo, msg, fields)
+}
+
+// Warn logs a message at LevelWarn.
+func (l *Logger) Warn(msg string, fields ...Field) {
+	l.log(LevelWarn, msg, fields)
+}
+
+// Error logs a message at LevelError.
+func (l *Logger) Error(msg string, fields ...Field) {
+	l.log(LevelError, msg, fields)
+}
+
+// Fatal logs a message at LevelError and terminates the program.
+func (l *Logger) Fatal(msg string, fields ...Field) {
+	l.log(LevelError, msg, fields)
+	os.Exit(1)
+}
+
+func (l *Logger) log(level Level, msg string, fields []Field) {
+	if l == nil || level < Level(atomic.LoadInt32(&l.out.level)) {
+		return
+	}
+	now := time.Now().UTC().Format(time.RFC3339Nano)
+	var b strings.Builder
+	if l.json {
+		b.WriteString(`{"time":`)
+		writeJSON(&b, now)
+		b.WriteString(`,"level":`)
+		writeJSON(&b, level.String())
+		b.WriteString(`,"msg":`)
+		writeJSON(&b, msg)
+		for _, fs := range [][]Field{l.fields, fields} {
+			for _, f := range fs {
+				b.WriteByte(',')
+				writeJSON(&b, f.Key)
+				b.WriteByte(':')
+				writeJSON(&b, f.Value)
+			}
+		}
+		b.WriteString("}\n")
+	} else {
+		b.WriteString(now)
+		b.WriteByte(' ')
+		b.WriteString(strings.ToUpper(level.String()))
+		b.WriteByte(' ')
+		b.WriteString(msg)
+		for _, fs := range [][]Field{l.fields, fields} {
+			for _, f := range fs {
+				b.WriteByte(' ')
+				b.WriteString(f.Key)
+				b.WriteByte('=')
+				writeText(&b, f.Value)
+			}
+		}
+		b.WriteByte('\n')
+	}
+	l.out.mu.Lock()
+	defer l.out.mu.Unlock()
+	_, _ = io.WriteString(l.out.w, b.String())
+}
+
+// writeJSON writes v encoded as JSON, values which cannot be encoded are written as strings.
+func writeJSON(b *strings.Builder, v interface{}) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		data, _ = json.Marshal(fmt.Sprint(v))
+	}
+	b.Write(data)
+}
+
+// writeText writes v quoting it when it is empty or contains spaces, quotes or equal signs.
+func writeText(b *strings.Builder, v interface{}) {
+	s := fmt.Sprint(v)
+	if s == "" || strings.ContainsAny(s, " \t\n\"=") {
+		s = strconv.Quote(s)
+	}
+	b.WriteString(s)
+}
+
+// contextKey is the context key of a request-scoped Logger.
+type contextKey struct{}
+
+// NewContext returns a copy of ctx carrying l.
+func NewContext(ctx context.Context, l *Logger) context.Context {
+	return context.WithValue(ctx, contextKey{}, l)
+}
+
+// FromContext returns a Logger carried by ctx or fallback if there is none.
+func FromContext(ctx context.Context, fallback *Logger) *Logger {
+	if l, ok := ctx.Value(contextKey{}).(*Logger); ok && l != nil {
+		return l
+	}
+	return fallback
+}
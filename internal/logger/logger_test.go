@@ -0,0 +1,71 @@
+package logger
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoggerText(t *testing.T) {
+	var buf bytes.Buffer
+	l, err := New(&buf, LevelInfo, FormatText)
+	require.NoError(t, err)
+	l.Debug("hidden")
+	l.With(String("request_id", "abc")).Info("retrieved URL", String("sURL", "xyz"), String("url", "https://a b"))
+	line := buf.String()
+	assert.NotContains(t, line, "hidden")
+	assert.True(t, strings.HasSuffix(line, " INFO retrieved URL request_id=abc sURL=xyz url=\"https://a b\"\n"), line)
+}
+
+func TestLoggerJSON(t *testing.T) {
+	var buf bytes.Buffer
+	l, err := New(&buf, LevelDebug, FormatJSON)
+	require.NoError(t, err)
+	l.With(Int("worker", 2)).Warn("flush failed", Error(errors.New("boom")))
+	var entry map[string]interface{}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &entry))
+	assert.Equal(t, "warn", entry["level"])
+	assert.Equal(t, "flush failed", entry["msg"])
+	assert.Equal(t, float64(2), entry["worker"])
+	assert.Equal(t, "boom", entry["error"])
+}
+
+func TestParseLevel(t *testing.T) {
+	level, err := ParseLevel("WARN")
+	require.NoError(t, err)
+	assert.Equal(t, LevelWarn, level)
+	_, err = ParseLevel("verbose")
+	assert.Error(t, err)
+	_, err = New(&bytes.Buffer{}, LevelInfo, "xml")
+	assert.Error(t, err)
+}
+
+func TestContext(t *testing.T) {
+	var nilLogger *Logger
+	nilLogger.With(String("k", "v")).Error("discarded")
+
+	var buf bytes.Buffer
+	l, _ := New(&buf, LevelInfo, FormatText)
+	assert.Equal(t, l, FromContext(context.Background(), l))
+	scoped := l.With(String("request_id", "abc"))
+	assert.Equal(t, scoped, FromContext(NewContext(context.Background(), scoped), l))
+}
+
+func TestSetLevel(t *testing.T) {
+	var buf bytes.Buffer
+	l, _ := New(&buf, LevelInfo, FormatText)
+	scoped := l.With(String("request_id", "abc"))
+	scoped.Debug("hidden")
+	l.SetLevel(LevelDebug)
+	scoped.Debug("shown")
+	scoped.SetLevel(LevelError)
+	l.Warn("hidden")
+	assert.NotContains(t, buf.String(), "hidden")
+	assert.Contains(t, buf.String(), "DEBUG shown request_id=abc")
+}
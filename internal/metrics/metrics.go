@@ -0,0 +1,209 @@
+// Package metrics provides counters, histograms and gauges exposed in the Prometheus text format.
+package metrics
+
+import (
+	"fmt"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/logger"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefBuckets sets default histogram buckets (in seconds) suitable for measuring storage latency.
+var DefBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// collector defines a metric which can write itself in the Prometheus text format.
+type collector interface {
+	write(w io.Writer) error
+}
+
+// Registry holds metrics to be exposed via Handler.
+type Registry struct {
+	mu         sync.Mutex
+	collectors []collector
+	log        *logger.Logger
+}
+
+// NewRegistry initializes an empty Registry logging failures to serve metrics to log.
+func NewRegistry(log *logger.Logger) *Registry {
+	return &Registry{log: log}
+}
+
+// NewCounterVec registers and returns a counter partitioned by values of one label.
+func (r *Registry) NewCounterVec(name, help, label string) *CounterVec {
+	c := &CounterVec{name: name, help: help, label: label, values: make(map[string]uint64)}
+	r.register(c)
+	return c
+}
+
+// NewHistogramVec registers and returns a histogram with the given upper bounds partitioned by values of one label.
+func (r *Registry) NewHistogramVec(name, help, label string, buckets []float64) *HistogramVec {
+	h := &HistogramVec{name: name, help: help, label: label, buckets: buckets, values: make(map[string]*histogram)}
+	r.register(h)
+	return h
+}
+
+// NewGaugeFunc registers a gauge whose value is retrieved by calling fn on every scrape.
+func (r *Registry) NewGaugeFunc(name, help string, fn func() float64) {
+	r.register(&valueFunc{name: name, help: help, metricType: "gauge", fn: fn})
+}
+
+// NewCounterFunc registers a counter whose value is retrieved by calling fn on every scrape, fn must never return a
+// value lower than the previous one.
+func (r *Registry) NewCounterFunc(name, help string, fn func() float64) {
+	r.register(&valueFunc{name: name, help: help, metricType: "counter", fn: fn})
+}
+
+// Handler returns a http.HandlerFunc serving all registered metrics.
+func (r *Registry) Handler() http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		r.mu.Lock()
+		collectors := append([]collector(nil), r.collectors...)
+		r.mu.Unlock()
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		for _, c := range collectors {
+			err := c.write(w)
+			if err != nil {
+				logger.FromContext(req.Context(), r.log).Error("Serving metrics", logger.Error(err))
+				return
+			}
+		}
+	}
+}
+
+// register adds a collector to the Registry.
+func (r *Registry) register(c collector) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.collectors = append(r.collectors, c)
+}
+
+// CounterVec defines a monotonically increasing counter partitioned by values of one label.
+type CounterVec struct {
+	mu     sync.Mutex
+	name   string
+	help   string
+	label  string
+	values map[string]uint64
+}
+
+// Inc increments the counter for the given label value.
+func (c *CounterVec) Inc(value string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.values[value]++
+}
+
+// Value returns the current counter value for the given label value.
+func (c *CounterVec) Value(value string) uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.values[value]
+}
+
+func (c *CounterVec) write(w io.Writer) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var b strings.Builder
+	writeHeader(&b, c.name, c.help, "counter")
+	values := make([]string, 0, len(c.values))
+	for value := range c.values {
+		values = append(values, value)
+	}
+	sort.Strings(values)
+	for _, value := range values {
+		fmt.Fprintf(&b, "%s{%s=%q} %d\n", c.name, c.label, value, c.values[value])
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// HistogramVec defines a histogram partitioned by values of one label.
+type HistogramVec struct {
+	mu      sync.Mutex
+	name    string
+	help    string
+	label   string
+	buckets []float64
+	values  map[string]*histogram
+}
+
+// histogram holds non-cumulative bucket counts, the last one counting observations above all upper bounds.
+type histogram struct {
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+// Observe adds an observation to the histogram for the given label value.
+func (h *HistogramVec) Observe(value string, v float64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	hist, ok := h.values[value]
+	if !ok {
+		hist = &histogram{counts: make([]uint64, len(h.buckets)+1)}
+		h.values[value] = hist
+	}
+	hist.counts[sort.SearchFloat64s(h.buckets, v)]++
+	hist.sum += v
+	hist.count++
+}
+
+func (h *HistogramVec) write(w io.Writer) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	var b strings.Builder
+	writeHeader(&b, h.name, h.help, "histogram")
+	values := make([]string, 0, len(h.values))
+	for value := range h.values {
+		values = append(values, value)
+	}
+	sort.Strings(values)
+	for _, value := range values {
+		hist := h.values[value]
+		var cumulative uint64
+		for i, bound := range h.buckets {
+			cumulative += hist.counts[i]
+			fmt.Fprintf(&b, "%s_bucket{%s=%q,le=%q} %d\n", h.name, h.label, value, formatFloat(bound), cumulative)
+		}
+		fmt.Fprintf(&b, "%s_bucket{%s=%q,le=\"+Inf\"} %d\n", h.name, h.label, value, hist.count)
+		fmt.Fprintf(&b, "%s_sum{%s=%q} %s\n", h.name, h.label, value, formatFloat(hist.sum))
+		fmt.Fprintf(&b, "%s_count{%s=%q} %d\n", h.name, h.label, value, hist.count)
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// valueFunc defines a gauge or a counter whose value is retrieved on every scrape.
+type valueFunc struct {
+	name       string
+	help       string
+	metricType string
+	fn         func() float64
+}
+
+func (g *valueFunc) write(w io.Writer) error {
+	var b strings.Builder
+	writeHeader(&b, g.name, g.help, g.metricType)
+	fmt.Fprintf(&b, "%s %s\n", g.name, formatFloat(g.fn()))
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// writeHeader writes HELP and TYPE lines of a metric.
+func writeHeader(b *strings.Builder, name, help, metricType string) {
+	fmt.Fprintf(b, "# HELP %s %s\n", name, strings.ReplaceAll(help, "\n", `\n`))
+	fmt.Fprintf(b, "# TYPE %s %s\n", name, metricType)
+}
+
+// formatFloat formats a float value the way Prometheus expects it.
+func formatFloat(v float64) string {
+	if math.IsInf(v, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
@@ -0,0 +1,47 @@
+package metrics
+
+import (
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRegistryHandler(t *testing.T) {
+	registry := NewRegistry(nil)
+	requests := registry.NewCounterVec("test_requests_total", "Number of requests.", "code")
+	latency := registry.NewHistogramVec("test_duration_seconds", "Operations latency.", "operation", []float64{0.1, 1})
+	registry.NewGaugeFunc("test_queue_depth", "Queue depth.", func() float64 { return 3 })
+	registry.NewCounterFunc("test_hits_total", "Number of hits.", func() float64 { return 7 })
+	requests.Inc("201")
+	requests.Inc("201")
+	requests.Inc("400")
+	latency.Observe("dump", 0.05)
+	latency.Observe("dump", 0.5)
+	latency.Observe("dump", 2)
+
+	rec := httptest.NewRecorder()
+	registry.Handler()(rec, httptest.NewRequest("GET", "/metrics", nil))
+	body, _ := ioutil.ReadAll(rec.Result().Body)
+
+	want := `# HELP test_requests_total Number of requests.
+# TYPE test_requests_total counter
+test_requests_total{code="201"} 2
+test_requests_total{code="400"} 1
+# HELP test_duration_seconds Operations latency.
+# TYPE test_duration_seconds histogram
+test_duration_seconds_bucket{operation="dump",le="0.1"} 1
+test_duration_seconds_bucket{operation="dump",le="1"} 2
+test_duration_seconds_bucket{operation="dump",le="+Inf"} 3
+test_duration_seconds_sum{operation="dump"} 2.55
+test_duration_seconds_count{operation="dump"} 3
+# HELP test_queue_depth Queue depth.
+# TYPE test_queue_depth gauge
+test_queue_depth 3
+# HELP test_hits_total Number of hits.
+# TYPE test_hits_total counter
+test_hits_total 7
+`
+	assert.Equal(t, want, string(body))
+	assert.Equal(t, uint64(2), requests.Value("201"))
+}
@@ -0,0 +1,191 @@
+// Package preview provides fetching of destination page titles and favicons shown on link preview pages and in URL
+// listings.
+package preview
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// fetcher parameters
+const (
+	// maxBodySize limits the part of a destination page searched for its title
+	maxBodySize = 64 << 10
+	// maxTitleLength limits the length of returned titles in runes
+	maxTitleLength = 200
+	maxRedirects   = 3
+	userAgent      = "url-shortener-preview"
+)
+
+// patterns extracting page metadata, attributes of link elements are matched one by one since their order varies
+var (
+	titlePattern     = regexp.MustCompile(`(?is)<title[^>]*>(.*?)</title>`)
+	linkPattern      = regexp.MustCompile(`(?is)<link\s[^>]*>`)
+	attributePattern = regexp.MustCompile(`(?is)\b(rel|href)\s*=\s*(?:"([^"]*)"|'([^']*)'|([^\s"'>]+))`)
+)
+
+// defaultFavicon is the path browsers request a favicon at when a page does not declare one.
+const defaultFavicon = "/favicon.ico"
+
+// errNotPublic is returned when a destination resolves to an address which is not publicly routable.
+var errNotPublic = errors.New("destination address is not public")
+
+// Fetcher retrieves metadata of destination pages. Only publicly routable addresses are dialed, so that preview pages
+// cannot be used to read pages of the internal network. A nil Fetcher fetches nothing.
+type Fetcher struct {
+	client *http.Client
+}
+
+// NewFetcher initializes a Fetcher, a single fetch including redirects takes at most timeout.
+func NewFetcher(timeout time.Duration) *Fetcher {
+	return newFetcher(timeout, publicOnly)
+}
+
+// newFetcher initializes a Fetcher checking dialed addresses with control.
+func newFetcher(timeout time.Duration, control func(network, address string, c syscall.RawConn) error) *Fetcher {
+	dialer := &net.Dialer{Timeout: timeout, Control: control}
+	transport := &http.Transport{
+		// a proxy would dial destinations on behalf of the Fetcher bypassing the address check
+		Proxy:                 nil,
+		DialContext:           dialer.DialContext,
+		TLSHandshakeTimeout:   timeout,
+		ResponseHeaderTimeout: timeout,
+		MaxIdleConns:          10,
+		IdleConnTimeout:       time.Minute,
+	}
+	return &Fetcher{client: &http.Client{
+		Transport: transport,
+		Timeout:   timeout,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= maxRedirects {
+				return fmt.Errorf("stopped after %d redirects", maxRedirects)
+			}
+			return nil
+		},
+	}}
+}
+
+// Metadata describes a destination page.
+type Metadata struct {
+	Title string
+	// FaviconURL is the absolute URL of the page icon, it is not checked to exist
+	FaviconURL string
+}
+
+// Title returns the title of the HTML page at URL or an error if it cannot be retrieved, pages without a title have
+// an empty one.
+func (f *Fetcher) Title(ctx context.Context, URL string) (string, error) {
+	metadata, err := f.Metadata(ctx, URL)
+	return metadata.Title, err
+}
+
+// Metadata returns the title and the favicon URL of the HTML page at URL or an error if it cannot be retrieved, the
+// favicon defaults to /favicon.ico of the host the page was finally served by. Resources other than HTML pages have
+// empty metadata.
+func (f *Fetcher) Metadata(ctx context.Context, URL string) (Metadata, error) {
+	if f == nil {
+		return Metadata{}, nil
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, URL, nil)
+	if err != nil {
+		return Metadata{}, err
+	}
+	if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+		return Metadata{}, fmt.Errorf("unsupported scheme %q", req.URL.Scheme)
+	}
+	req.Header.Set("User-Agent", userAgent)
+	req.Header.Set("Accept", "text/html")
+	res, err := f.client.Do(req)
+	if err != nil {
+		return Metadata{}, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return Metadata{}, fmt.Errorf("destination responded with %d %s", res.StatusCode, http.StatusText(res.StatusCode))
+	}
+	mediaType, _, _ := mime.ParseMediaType(res.Header.Get("Content-Type"))
+	if mediaType != "text/html" {
+		return Metadata{}, nil
+	}
+	body, err := ioutil.ReadAll(io.LimitReader(res.Body, maxBodySize))
+	if err != nil {
+		return Metadata{}, err
+	}
+	// relative references resolve against the page URL after redirects
+	return Metadata{Title: parseTitle(body), FaviconURL: parseFavicon(body, res.Request.URL)}, nil
+}
+
+// parseTitle extracts the title of an HTML page with entities unescaped and whitespace collapsed.
+func parseTitle(body []byte) string {
+	match := titlePattern.FindSubmatch(body)
+	if match == nil {
+		return ""
+	}
+	title := strings.Join(strings.Fields(html.UnescapeString(string(match[1]))), " ")
+	if runes := []rune(title); len(runes) > maxTitleLength {
+		title = string(runes[:maxTitleLength-1]) + "…"
+	}
+	return title
+}
+
+// parseFavicon returns the absolute URL of the first icon declared by an HTML page served at base or the default
+// favicon URL of base host.
+func parseFavicon(body []byte, base *url.URL) string {
+	for _, link := range linkPattern.FindAll(body, -1) {
+		var rel, href string
+		for _, attribute := range attributePattern.FindAllSubmatch(link, -1) {
+			value := html.UnescapeString(string(attribute[2]) + string(attribute[3]) + string(attribute[4]))
+			if strings.EqualFold(string(attribute[1]), "rel") {
+				rel = value
+			} else {
+				href = strings.TrimSpace(value)
+			}
+		}
+		if href == "" || !isIconRel(rel) {
+			continue
+		}
+		icon, err := base.Parse(href)
+		if err != nil || (icon.Scheme != "http" && icon.Scheme != "https") {
+			continue
+		}
+		return icon.String()
+	}
+	return (&url.URL{Scheme: base.Scheme, Host: base.Host, Path: defaultFavicon}).String()
+}
+
+// isIconRel reports whether a link relation list declares an icon, e.g. "icon" or "shortcut icon".
+func isIconRel(rel string) bool {
+	for _, token := range strings.Fields(rel) {
+		if strings.EqualFold(token, "icon") {
+			return true
+		}
+	}
+	return false
+}
+
+// publicOnly rejects dialing addresses which are not publicly routable, it runs after name resolution so that host
+// names resolving to internal addresses are rejected too.
+func publicOnly(network, address string, c syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() || ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() || ip.IsMulticast() {
+		return errNotPublic
+	}
+	return nil
+}
@@ -0,0 +1,104 @@
+package preview
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseTitle(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want string
+	}{
+		{name: "Plain", body: "<html><head><title>Example</title></head></html>", want: "Example"},
+		{name: "Attributes and entities", body: `<TITLE lang="en">Tom &amp; Jerry</TITLE>`, want: "Tom & Jerry"},
+		{name: "Whitespace", body: "<title>\n  Multi\n  line\n</title>", want: "Multi line"},
+		{name: "Missing", body: "<html><body>No title</body></html>", want: ""},
+		{name: "Long", body: "<title>" + strings.Repeat("a", 300) + "</title>", want: strings.Repeat("a", maxTitleLength-1) + "…"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, parseTitle([]byte(tt.body)))
+		})
+	}
+}
+
+func TestParseFavicon(t *testing.T) {
+	base, err := url.Parse("https://example.com/docs/page")
+	require.NoError(t, err)
+	tests := []struct {
+		name string
+		body string
+		want string
+	}{
+		{name: "Relative", body: `<link rel="icon" href="/static/icon.png">`, want: "https://example.com/static/icon.png"},
+		{name: "Relative to page", body: `<link href='icon.svg' rel='icon'>`, want: "https://example.com/docs/icon.svg"},
+		{name: "Shortcut icon", body: `<LINK REL="Shortcut Icon" HREF="https://cdn.example.com/f.ico">`, want: "https://cdn.example.com/f.ico"},
+		{name: "Other relations skipped", body: `<link rel="stylesheet" href="/a.css"><link rel=icon href=/b.ico>`, want: "https://example.com/b.ico"},
+		{name: "Unsupported scheme skipped", body: `<link rel="icon" href="javascript:alert(1)">`, want: "https://example.com/favicon.ico"},
+		{name: "Missing", body: "<html><head></head></html>", want: "https://example.com/favicon.ico"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, parseFavicon([]byte(tt.body), base))
+		})
+	}
+}
+
+func TestFetcherTitle(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/page":
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			_, _ = w.Write([]byte("<title>Page</title>"))
+		case "/redirect":
+			http.Redirect(w, r, "/page", http.StatusFound)
+		case "/image":
+			w.Header().Set("Content-Type", "image/png")
+			_, _ = w.Write([]byte("<title>Not a page</title>"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+	allowAll := func(network, address string, c syscall.RawConn) error { return nil }
+	f := newFetcher(time.Second, allowAll)
+
+	title, err := f.Title(context.Background(), ts.URL+"/redirect")
+	require.NoError(t, err)
+	assert.Equal(t, "Page", title)
+
+	title, err = f.Title(context.Background(), ts.URL+"/image")
+	require.NoError(t, err)
+	assert.Empty(t, title)
+
+	_, err = f.Title(context.Background(), ts.URL+"/missing")
+	assert.Error(t, err)
+
+	_, err = f.Title(context.Background(), "ftp://example.com/file")
+	assert.Error(t, err)
+
+	// the test server listens on loopback which must not be dialed by default
+	_, err = NewFetcher(time.Second).Title(context.Background(), ts.URL+"/page")
+	assert.True(t, errors.Is(err, errNotPublic))
+
+	metadata, err := f.Metadata(context.Background(), ts.URL+"/redirect")
+	require.NoError(t, err)
+	assert.Equal(t, Metadata{Title: "Page", FaviconURL: ts.URL + "/favicon.ico"}, metadata)
+
+	var nilFetcher *Fetcher
+	title, err = nilFetcher.Title(context.Background(), ts.URL+"/page")
+	assert.NoError(t, err)
+	assert.Empty(t, title)
+}
@@ -0,0 +1,497 @@
+// Package qrcode provides a QR code (ISO/IEC 18004) encoder for short links rendered as PNG or SVG images.
+//
+// Only byte mode and versions 1 to 10 are supported, which holds up to 271 bytes at level L and 119 bytes at level H
+// and is more than enough for short links.
+package qrcode
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Level defines the error correction level of a QR code.
+type Level int
+
+// Error correction levels, each recovering roughly 7%, 15%, 25% and 30% of damaged codewords respectively.
+const (
+	LevelL Level = iota
+	LevelM
+	LevelQ
+	LevelH
+)
+
+// maxVersion is the largest supported QR code version.
+const maxVersion = 10
+
+// formatBits are the error correction level bits stored in the format information.
+var formatBits = [...]int{LevelL: 1, LevelM: 0, LevelQ: 3, LevelH: 2}
+
+// blockGroup defines a number of error correction blocks holding the same number of data codewords.
+type blockGroup struct {
+	blocks    int
+	dataWords int
+}
+
+// ecBlocks defines the number of error correction codewords per block and block groups of a version and a level.
+type ecBlocks struct {
+	ecWords int
+	groups  []blockGroup
+}
+
+// ecTable holds error correction parameters indexed by version and level.
+var ecTable = [maxVersion + 1][4]ecBlocks{
+	1:  {{7, []blockGroup{{1, 19}}}, {10, []blockGroup{{1, 16}}}, {13, []blockGroup{{1, 13}}}, {17, []blockGroup{{1, 9}}}},
+	2:  {{10, []blockGroup{{1, 34}}}, {16, []blockGroup{{1, 28}}}, {22, []blockGroup{{1, 22}}}, {28, []blockGroup{{1, 16}}}},
+	3:  {{15, []blockGroup{{1, 55}}}, {26, []blockGroup{{1, 44}}}, {18, []blockGroup{{2, 17}}}, {22, []blockGroup{{2, 13}}}},
+	4:  {{20, []blockGroup{{1, 80}}}, {18, []blockGroup{{2, 32}}}, {26, []blockGroup{{2, 24}}}, {16, []blockGroup{{4, 9}}}},
+	5:  {{26, []blockGroup{{1, 108}}}, {24, []blockGroup{{2, 43}}}, {18, []blockGroup{{2, 15}, {2, 16}}}, {22, []blockGroup{{2, 11}, {2, 12}}}},
+	6:  {{18, []blockGroup{{2, 68}}}, {16, []blockGroup{{4, 27}}}, {24, []blockGroup{{4, 19}}}, {28, []blockGroup{{4, 15}}}},
+	7:  {{20, []blockGroup{{2, 78}}}, {18, []blockGroup{{4, 31}}}, {18, []blockGroup{{2, 14}, {4, 15}}}, {26, []blockGroup{{4, 13}, {1, 14}}}},
+	8:  {{24, []blockGroup{{2, 97}}}, {22, []blockGroup{{2, 38}, {2, 39}}}, {22, []blockGroup{{4, 18}, {2, 19}}}, {26, []blockGroup{{4, 14}, {2, 15}}}},
+	9:  {{30, []blockGroup{{2, 116}}}, {22, []blockGroup{{3, 36}, {2, 37}}}, {20, []blockGroup{{4, 16}, {4, 17}}}, {24, []blockGroup{{4, 12}, {4, 13}}}},
+	10: {{18, []blockGroup{{2, 68}, {2, 69}}}, {26, []blockGroup{{4, 43}, {1, 44}}}, {24, []blockGroup{{6, 19}, {2, 20}}}, {28, []blockGroup{{6, 15}, {2, 16}}}},
+}
+
+// alignmentPositions holds alignment pattern center coordinates indexed by version.
+var alignmentPositions = [maxVersion + 1][]int{
+	2:  {6, 18},
+	3:  {6, 22},
+	4:  {6, 26},
+	5:  {6, 30},
+	6:  {6, 34},
+	7:  {6, 22, 38},
+	8:  {6, 24, 42},
+	9:  {6, 26, 46},
+	10: {6, 28, 50},
+}
+
+// ParseLevel converts a level name (L, M, Q or H, case-insensitive) into a Level.
+func ParseLevel(s string) (Level, error) {
+	switch strings.ToUpper(s) {
+	case "L":
+		return LevelL, nil
+	case "M":
+		return LevelM, nil
+	case "Q":
+		return LevelQ, nil
+	case "H":
+		return LevelH, nil
+	}
+	return 0, fmt.Errorf("unknown error correction level %q, expected one of L, M, Q, H", s)
+}
+
+// Code defines an encoded QR code as a square matrix of modules.
+type Code struct {
+	Size       int
+	modules    [][]bool
+	isFunction [][]bool
+}
+
+// Dark reports whether the module at column x and row y is dark.
+func (c *Code) Dark(x, y int) bool {
+	return c.modules[y][x]
+}
+
+// Encode encodes data in byte mode choosing the smallest version fitting it at the given error correction level.
+func Encode(data string, level Level) (*Code, error) {
+	if level < LevelL || level > LevelH {
+		return nil, fmt.Errorf("unknown error correction level %d", level)
+	}
+	version := 0
+	for v := 1; v <= maxVersion; v++ {
+		if dataBitsLength(len(data), v) <= dataWords(v, level)*8 {
+			version = v
+			break
+		}
+	}
+	if version == 0 {
+		return nil, fmt.Errorf("data of %d bytes does not fit into a QR code of version %d at the requested level", len(data), maxVersion)
+	}
+	codewords := addErrorCorrection(encodeData(data, version, level), version, level)
+
+	size := version*4 + 17
+	c := &Code{Size: size, modules: newMatrix(size), isFunction: newMatrix(size)}
+	c.drawFunctionPatterns(version)
+	c.drawCodewords(codewords)
+	// choose the mask with the lowest penalty
+	bestMask, bestPenalty := 0, -1
+	for mask := 0; mask < 8; mask++ {
+		c.applyMask(mask)
+		c.drawFormatBits(level, mask)
+		penalty := c.penalty()
+		if bestPenalty < 0 || penalty < bestPenalty {
+			bestMask, bestPenalty = mask, penalty
+		}
+		// masking is an XOR, so applying it again reverts it
+		c.applyMask(mask)
+	}
+	c.applyMask(bestMask)
+	c.drawFormatBits(level, bestMask)
+	return c, nil
+}
+
+// charCountBits returns the length of the byte mode character count indicator for a version.
+func charCountBits(version int) int {
+	if version < 10 {
+		return 8
+	}
+	return 16
+}
+
+// dataBitsLength returns the number of bits needed to encode n bytes in byte mode.
+func dataBitsLength(n, version int) int {
+	return 4 + charCountBits(version) + n*8
+}
+
+// dataWords returns the number of data codewords of a version and a level.
+func dataWords(version int, level Level) int {
+	n := 0
+	for _, g := range ecTable[version][level].groups {
+		n += g.blocks * g.dataWords
+	}
+	return n
+}
+
+// encodeData builds padded data codewords for data in byte mode.
+func encodeData(data string, version int, level Level) []byte {
+	capacity := dataWords(version, level) * 8
+	var bb bitBuffer
+	bb.append(0x4, 4)
+	bb.append(len(data), charCountBits(version))
+	for i := 0; i < len(data); i++ {
+		bb.append(int(data[i]), 8)
+	}
+	// add a terminator of up to four zero bits and pad to a byte boundary
+	terminator := capacity - len(bb)
+	if terminator > 4 {
+		terminator = 4
+	}
+	bb.append(0, terminator)
+	bb.append(0, (8-len(bb)%8)%8)
+	// fill the remaining capacity with alternating pad bytes
+	for pad := 0xEC; len(bb) < capacity; pad ^= 0xEC ^ 0x11 {
+		bb.append(pad, 8)
+	}
+	words := make([]byte, len(bb)/8)
+	for i, bit := range bb {
+		if bit {
+			words[i/8] |= 1 << uint(7-i%8)
+		}
+	}
+	return words
+}
+
+// addErrorCorrection splits data codewords into blocks, computes their error correction codewords and interleaves
+// the result.
+func addErrorCorrection(data []byte, version int, level Level) []byte {
+	ec := ecTable[version][level]
+	generator := rsGenerator(ec.ecWords)
+	var dataBlocks, ecBlocks [][]byte
+	maxDataWords := 0
+	offset := 0
+	for _, g := range ec.groups {
+		for i := 0; i < g.blocks; i++ {
+			block := data[offset : offset+g.dataWords]
+			offset += g.dataWords
+			dataBlocks = append(dataBlocks, block)
+			ecBlocks = append(ecBlocks, rsRemainder(block, generator))
+		}
+		if g.dataWords > maxDataWords {
+			maxDataWords = g.dataWords
+		}
+	}
+	result := make([]byte, 0, len(data)+len(dataBlocks)*ec.ecWords)
+	for i := 0; i < maxDataWords; i++ {
+		for _, block := range dataBlocks {
+			if i < len(block) {
+				result = append(result, block[i])
+			}
+		}
+	}
+	for i := 0; i < ec.ecWords; i++ {
+		for _, block := range ecBlocks {
+			result = append(result, block[i])
+		}
+	}
+	return result
+}
+
+// newMatrix returns a size by size matrix of light modules.
+func newMatrix(size int) [][]bool {
+	m := make([][]bool, size)
+	for i := range m {
+		m[i] = make([]bool, size)
+	}
+	return m
+}
+
+// setFunction sets a function module which is never masked nor overwritten by data.
+func (c *Code) setFunction(x, y int, dark bool) {
+	c.modules[y][x] = dark
+	c.isFunction[y][x] = true
+}
+
+// drawFunctionPatterns draws timing, finder and alignment patterns, reserves format information and draws version
+// information.
+func (c *Code) drawFunctionPatterns(version int) {
+	for i := 0; i < c.Size; i++ {
+		c.setFunction(6, i, i%2 == 0)
+		c.setFunction(i, 6, i%2 == 0)
+	}
+	c.drawFinder(3, 3)
+	c.drawFinder(c.Size-4, 3)
+	c.drawFinder(3, c.Size-4)
+	positions := alignmentPositions[version]
+	last := len(positions) - 1
+	for i, x := range positions {
+		for j, y := range positions {
+			// skip the ones overlapping finder patterns
+			if (i == 0 && j == 0) || (i == 0 && j == last) || (i == last && j == 0) {
+				continue
+			}
+			c.drawAlignment(x, y)
+		}
+	}
+	// reserve format information areas, they are drawn once the mask is chosen
+	c.drawFormatBits(LevelL, 0)
+	c.drawVersion(version)
+}
+
+// drawFinder draws a finder pattern with its separator centered at x, y.
+func (c *Code) drawFinder(x, y int) {
+	for dy := -4; dy <= 4; dy++ {
+		for dx := -4; dx <= 4; dx++ {
+			xx, yy := x+dx, y+dy
+			if xx < 0 || xx >= c.Size || yy < 0 || yy >= c.Size {
+				continue
+			}
+			dist := max(abs(dx), abs(dy))
+			c.setFunction(xx, yy, dist != 2 && dist != 4)
+		}
+	}
+}
+
+// drawAlignment draws an alignment pattern centered at x, y.
+func (c *Code) drawAlignment(x, y int) {
+	for dy := -2; dy <= 2; dy++ {
+		for dx := -2; dx <= 2; dx++ {
+			c.setFunction(x+dx, y+dy, max(abs(dx), abs(dy)) != 1)
+		}
+	}
+}
+
+// drawFormatBits draws both copies of format information for a level and a mask along with the dark module.
+func (c *Code) drawFormatBits(level Level, mask int) {
+	bits := formatInfo(level, mask)
+	for i := 0; i <= 5; i++ {
+		c.setFunction(8, i, bit(bits, i))
+	}
+	c.setFunction(8, 7, bit(bits, 6))
+	c.setFunction(8, 8, bit(bits, 7))
+	c.setFunction(7, 8, bit(bits, 8))
+	for i := 9; i < 15; i++ {
+		c.setFunction(14-i, 8, bit(bits, i))
+	}
+	for i := 0; i < 8; i++ {
+		c.setFunction(c.Size-1-i, 8, bit(bits, i))
+	}
+	for i := 8; i < 15; i++ {
+		c.setFunction(8, c.Size-15+i, bit(bits, i))
+	}
+	c.setFunction(8, c.Size-8, true)
+}
+
+// formatInfo returns 15 bits of format information protected by a BCH code and masked as the standard requires.
+func formatInfo(level Level, mask int) int {
+	data := formatBits[level]<<3 | mask
+	rem := data
+	for i := 0; i < 10; i++ {
+		rem = (rem << 1) ^ ((rem >> 9) * 0x537)
+	}
+	return (data<<10 | rem) ^ 0x5412
+}
+
+// drawVersion draws both copies of version information, versions below 7 have none.
+func (c *Code) drawVersion(version int) {
+	if version < 7 {
+		return
+	}
+	bits := versionInfo(version)
+	for i := 0; i < 18; i++ {
+		a, b := c.Size-11+i%3, i/3
+		c.setFunction(a, b, bit(bits, i))
+		c.setFunction(b, a, bit(bits, i))
+	}
+}
+
+// versionInfo returns 18 bits of version information protected by a BCH code.
+func versionInfo(version int) int {
+	rem := version
+	for i := 0; i < 12; i++ {
+		rem = (rem << 1) ^ ((rem >> 11) * 0x1F25)
+	}
+	return version<<12 | rem
+}
+
+// drawCodewords places codewords in the zigzag order over modules which are not function modules.
+func (c *Code) drawCodewords(codewords []byte) {
+	i := 0
+	for right := c.Size - 1; right >= 1; right -= 2 {
+		// skip the vertical timing pattern column
+		if right == 6 {
+			right = 5
+		}
+		upward := (right+1)&2 == 0
+		for vert := 0; vert < c.Size; vert++ {
+			y := vert
+			if upward {
+				y = c.Size - 1 - vert
+			}
+			for j := 0; j < 2; j++ {
+				x := right - j
+				if !c.isFunction[y][x] && i < len(codewords)*8 {
+					c.modules[y][x] = bit(int(codewords[i/8]), 7-i%8)
+					i++
+				}
+			}
+		}
+	}
+}
+
+// applyMask inverts data modules matching the mask pattern.
+func (c *Code) applyMask(mask int) {
+	for y := 0; y < c.Size; y++ {
+		for x := 0; x < c.Size; x++ {
+			if !c.isFunction[y][x] && maskCondition(mask, x, y) {
+				c.modules[y][x] = !c.modules[y][x]
+			}
+		}
+	}
+}
+
+// maskCondition reports whether the module at x, y is inverted by the mask pattern.
+func maskCondition(mask, x, y int) bool {
+	switch mask {
+	case 0:
+		return (x+y)%2 == 0
+	case 1:
+		return y%2 == 0
+	case 2:
+		return x%3 == 0
+	case 3:
+		return (x+y)%3 == 0
+	case 4:
+		return (x/3+y/2)%2 == 0
+	case 5:
+		return x*y%2+x*y%3 == 0
+	case 6:
+		return (x*y%2+x*y%3)%2 == 0
+	default:
+		return ((x+y)%2+x*y%3)%2 == 0
+	}
+}
+
+// penalty scores the symbol by the standard mask evaluation rules, a lower score is better.
+func (c *Code) penalty() int {
+	result := 0
+	finderLike := []bool{true, false, true, true, true, false, true}
+	for i := 0; i < c.Size; i++ {
+		row := make([]bool, c.Size)
+		col := make([]bool, c.Size)
+		for j := 0; j < c.Size; j++ {
+			row[j] = c.modules[i][j]
+			col[j] = c.modules[j][i]
+		}
+		for _, line := range [][]bool{row, col} {
+			// runs of five or more modules of the same color
+			run := 1
+			for j := 1; j <= len(line); j++ {
+				if j < len(line) && line[j] == line[j-1] {
+					run++
+					continue
+				}
+				if run >= 5 {
+					result += run - 2
+				}
+				run = 1
+			}
+			// finder-like patterns preceded or followed by four light modules
+			for j := 0; j+len(finderLike) <= len(line); j++ {
+				if !matches(line[j:j+len(finderLike)], finderLike) {
+					continue
+				}
+				if isLight(line, j-4, j) || isLight(line, j+len(finderLike), j+len(finderLike)+4) {
+					result += 40
+				}
+			}
+		}
+	}
+	// 2x2 blocks of the same color
+	dark := 0
+	for y := 0; y < c.Size; y++ {
+		for x := 0; x < c.Size; x++ {
+			if c.modules[y][x] {
+				dark++
+			}
+			if x > 0 && y > 0 {
+				color := c.modules[y][x]
+				if color == c.modules[y][x-1] && color == c.modules[y-1][x] && color == c.modules[y-1][x-1] {
+					result += 3
+				}
+			}
+		}
+	}
+	// deviation of the dark modules share from 50% in 5% steps
+	total := c.Size * c.Size
+	result += abs(dark*20-total*10) / total * 10
+	return result
+}
+
+// matches reports whether line equals pattern.
+func matches(line, pattern []bool) bool {
+	for i := range pattern {
+		if line[i] != pattern[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// isLight reports whether all modules of line in [from, to) are light, modules outside the symbol count as light.
+func isLight(line []bool, from, to int) bool {
+	for i := from; i < to; i++ {
+		if i >= 0 && i < len(line) && line[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// bit returns the i-th bit of x.
+func bit(x, i int) bool {
+	return (x>>uint(i))&1 != 0
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
+
+func max(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+// bitBuffer accumulates bits in the most significant bit first order.
+type bitBuffer []bool
+
+// append adds n least significant bits of value.
+func (bb *bitBuffer) append(value, n int) {
+	for i := n - 1; i >= 0; i-- {
+		*bb = append(*bb, bit(value, i))
+	}
+}
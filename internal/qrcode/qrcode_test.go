@@ -0,0 +1,148 @@
+package qrcode
+
+import (
+	"bytes"
+	"image/png"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRSRemainder(t *testing.T) {
+	// "HELLO WORLD" at 1-M from the Thonky QR code tutorial
+	data := []byte{32, 91, 11, 120, 209, 114, 220, 77, 67, 64, 236, 17, 236, 17, 236, 17}
+	want := []byte{196, 35, 39, 119, 235, 215, 231, 226, 93, 23}
+	assert.Equal(t, want, rsRemainder(data, rsGenerator(len(want))))
+}
+
+func TestFormatInfo(t *testing.T) {
+	tests := []struct {
+		level Level
+		mask  int
+		want  int
+	}{
+		{LevelL, 0, 0x77C4},
+		{LevelL, 4, 0x662F},
+		{LevelM, 0, 0x5412},
+		{LevelM, 7, 0x4AA0},
+		{LevelQ, 0, 0x355F},
+		{LevelH, 0, 0x1689},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, formatInfo(tt.level, tt.mask), "level %d mask %d", tt.level, tt.mask)
+	}
+}
+
+func TestVersionInfo(t *testing.T) {
+	assert.Equal(t, 0x07C94, versionInfo(7))
+	assert.Equal(t, 0x0A4D3, versionInfo(10))
+}
+
+func TestParseLevel(t *testing.T) {
+	level, err := ParseLevel("q")
+	require.NoError(t, err)
+	assert.Equal(t, LevelQ, level)
+	_, err = ParseLevel("X")
+	assert.Error(t, err)
+}
+
+func TestEncode(t *testing.T) {
+	tests := []struct {
+		name        string
+		data        string
+		level       Level
+		wantVersion int
+	}{
+		{name: "short link at L", data: "http://localhost:8080/xyz", level: LevelL, wantVersion: 2},
+		{name: "short link at H", data: "http://localhost:8080/xyz", level: LevelH, wantVersion: 4},
+		{name: "version with version information", data: strings.Repeat("a", 120), level: LevelM, wantVersion: 7},
+		{name: "largest version", data: strings.Repeat("a", 119), level: LevelH, wantVersion: 10},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := Encode(tt.data, tt.level)
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantVersion*4+17, c.Size)
+			// read the chosen mask from format information and verify that both copies match
+			format := 0
+			for i := 0; i <= 5; i++ {
+				format |= b2i(c.Dark(8, i)) << uint(i)
+			}
+			format |= b2i(c.Dark(8, 7))<<6 | b2i(c.Dark(8, 8))<<7 | b2i(c.Dark(7, 8))<<8
+			for i := 9; i < 15; i++ {
+				format |= b2i(c.Dark(14-i, 8)) << uint(i)
+			}
+			second := 0
+			for i := 0; i < 8; i++ {
+				second |= b2i(c.Dark(c.Size-1-i, 8)) << uint(i)
+			}
+			for i := 8; i < 15; i++ {
+				second |= b2i(c.Dark(8, c.Size-15+i)) << uint(i)
+			}
+			assert.Equal(t, format, second)
+			mask := (format ^ 0x5412) >> 10 & 7
+			assert.Equal(t, formatInfo(tt.level, mask), format)
+			// unmasked modules must hold the encoded codewords
+			c.applyMask(mask)
+			want := addErrorCorrection(encodeData(tt.data, tt.wantVersion, tt.level), tt.wantVersion, tt.level)
+			assert.Equal(t, want, readCodewords(c, len(want)))
+		})
+	}
+}
+
+func TestEncodeTooLong(t *testing.T) {
+	_, err := Encode(strings.Repeat("a", 120), LevelH)
+	assert.Error(t, err)
+}
+
+func TestRender(t *testing.T) {
+	c, err := Encode("http://localhost:8080/xyz", LevelM)
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	require.NoError(t, c.WritePNG(&buf, 256))
+	img, err := png.Decode(&buf)
+	require.NoError(t, err)
+	// 25 modules plus quiet zones give 33 modules of 7 pixels
+	assert.Equal(t, 231, img.Bounds().Dx())
+	assert.Equal(t, 231, img.Bounds().Dy())
+
+	buf.Reset()
+	require.NoError(t, c.WriteSVG(&buf, 256))
+	assert.Contains(t, buf.String(), `width="256" height="256" viewBox="0 0 33 33"`)
+}
+
+// readCodewords reads n codewords from data modules in the placement order.
+func readCodewords(c *Code, n int) []byte {
+	result := make([]byte, n)
+	i := 0
+	for right := c.Size - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			right = 5
+		}
+		upward := (right+1)&2 == 0
+		for vert := 0; vert < c.Size; vert++ {
+			y := vert
+			if upward {
+				y = c.Size - 1 - vert
+			}
+			for j := 0; j < 2; j++ {
+				x := right - j
+				if !c.isFunction[y][x] && i < n*8 {
+					result[i/8] |= byte(b2i(c.Dark(x, y))) << uint(7-i%8)
+					i++
+				}
+			}
+		}
+	}
+	return result
+}
+
+func b2i(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,71 @@
+package qrcode
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"strings"
+)
+
+// quietZone is the width of the light border around the symbol in modules required by the standard.
+const quietZone = 4
+
+// scale returns the module size in pixels fitting the symbol with its quiet zone into size pixels, at least one.
+func (c *Code) scale(size int) int {
+	scale := size / (c.Size + 2*quietZone)
+	if scale < 1 {
+		scale = 1
+	}
+	return scale
+}
+
+// Image renders the code as a grayscale image of at most size by size pixels including the quiet zone; the image
+// is larger only when size is too small to fit one pixel per module.
+func (c *Code) Image(size int) image.Image {
+	scale := c.scale(size)
+	side := (c.Size + 2*quietZone) * scale
+	img := image.NewGray(image.Rect(0, 0, side, side))
+	for i := range img.Pix {
+		img.Pix[i] = 0xFF
+	}
+	for y := 0; y < c.Size; y++ {
+		for x := 0; x < c.Size; x++ {
+			if !c.Dark(x, y) {
+				continue
+			}
+			for dy := 0; dy < scale; dy++ {
+				for dx := 0; dx < scale; dx++ {
+					img.SetGray((x+quietZone)*scale+dx, (y+quietZone)*scale+dy, color.Gray{})
+				}
+			}
+		}
+	}
+	return img
+}
+
+// WritePNG writes the code as a PNG image of at most size by size pixels.
+func (c *Code) WritePNG(w io.Writer, size int) error {
+	return png.Encode(w, c.Image(size))
+}
+
+// WriteSVG writes the code as an SVG image of size by size pixels.
+func (c *Code) WriteSVG(w io.Writer, size int) error {
+	side := c.Size + 2*quietZone
+	var path strings.Builder
+	for y := 0; y < c.Size; y++ {
+		for x := 0; x < c.Size; x++ {
+			if c.Dark(x, y) {
+				fmt.Fprintf(&path, "M%d,%dh1v1h-1z", x+quietZone, y+quietZone)
+			}
+		}
+	}
+	_, err := fmt.Fprintf(w, `<?xml version="1.0" encoding="UTF-8"?>
+<svg xmlns="http://www.w3.org/2000/svg" version="1.1" width="%d" height="%d" viewBox="0 0 %d %d" shape-rendering="crispEdges">
+<rect width="100%%" height="100%%" fill="#FFFFFF"/>
+<path d="%s" fill="#000000"/>
+</svg>
+`, size, size, side, side, path.String())
+	return err
+}
@@ -0,0 +1,104 @@
+// Package reload provides reloading of configuration parameters which can be changed while the server runs.
+package reload
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+
+	"github.com/danilovkiri/dk_go_url_shortener/internal/config"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/logger"
+)
+
+// Func applies a reloaded configuration to one application component, it must replace derived objects atomically so
+// that requests in flight see either the old or the new parameters.
+type Func func(cfg *config.Config) error
+
+type namedFunc struct {
+	name   string
+	params []string
+	fn     Func
+}
+
+// Watcher reloads the configuration on SIGHUP and applies it to registered components in the order of registration.
+// Parameters no component applies only take effect after a restart.
+type Watcher struct {
+	load    func() (*config.Config, error)
+	log     *logger.Logger
+	mu      sync.Mutex
+	funcs   []namedFunc
+	current *config.Config
+}
+
+// NewWatcher initializes a Watcher of the running configuration cfg, load sets up a new configuration from the same
+// sources.
+func NewWatcher(cfg *config.Config, load func() (*config.Config, error), log *logger.Logger) *Watcher {
+	return &Watcher{load: load, log: log, current: cfg}
+}
+
+// Add registers fn applying parameters named by their environment variables, fn is called on every reload since
+// parameters may be read from files whose content changes. A nil Watcher ignores it.
+func (w *Watcher) Add(name string, fn Func, params ...string) {
+	if w == nil {
+		return
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.funcs = append(w.funcs, namedFunc{name: name, params: params, fn: fn})
+}
+
+// Reload loads the configuration and applies it to all registered components. An invalid configuration is rejected
+// as a whole keeping the running one. A component failing to apply it keeps its parameters and does not prevent
+// other components from applying theirs, the first error encountered is returned.
+func (w *Watcher) Reload() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	cfg, err := w.load()
+	if err != nil {
+		w.log.Error("Reloading configuration", logger.Error(err))
+		return err
+	}
+	applied := make(map[string]bool)
+	var firstErr error
+	for _, f := range w.funcs {
+		err := f.fn(cfg)
+		if err != nil {
+			w.log.Error("Reloading configuration", logger.String("component", f.name), logger.Error(err))
+			if firstErr == nil {
+				firstErr = fmt.Errorf("reloading %s: %w", f.name, err)
+			}
+			continue
+		}
+		for _, param := range f.params {
+			applied[param] = true
+		}
+	}
+	for _, param := range config.Changed(w.current, cfg) {
+		if applied[param] {
+			w.log.Info("Reloading configuration: parameter changed", logger.String("param", param))
+		} else {
+			w.log.Warn("Reloading configuration: parameter change requires a restart", logger.String("param", param))
+		}
+	}
+	w.current = cfg
+	return firstErr
+}
+
+// Run reloads the configuration on every SIGHUP until ctx is done.
+func (w *Watcher) Run(ctx context.Context) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			w.log.Info("Reloading configuration")
+			_ = w.Reload()
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package reload
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/danilovkiri/dk_go_url_shortener/internal/config"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWatcherReload(t *testing.T) {
+	running, err := config.NewDefaultConfiguration()
+	require.NoError(t, err)
+	loaded, err := config.NewDefaultConfiguration()
+	require.NoError(t, err)
+	loaded.LogConfig.Level = "debug"
+	loaded.LogConfig.Format = "json"
+	var loadErr error
+	var buf bytes.Buffer
+	log, _ := logger.New(&buf, logger.LevelInfo, logger.FormatText)
+	w := NewWatcher(running, func() (*config.Config, error) {
+		return loaded, loadErr
+	}, log)
+	var levels []string
+	w.Add("logger", func(cfg *config.Config) error {
+		levels = append(levels, cfg.LogConfig.Level)
+		return nil
+	}, "LOG_LEVEL")
+	errFailed := errors.New("failed")
+	w.Add("failing", func(cfg *config.Config) error {
+		return errFailed
+	})
+
+	assert.ErrorIs(t, w.Reload(), errFailed)
+	assert.Equal(t, []string{"debug"}, levels)
+	assert.Contains(t, buf.String(), "INFO Reloading configuration: parameter changed param=LOG_LEVEL")
+	assert.Contains(t, buf.String(), "WARN Reloading configuration: parameter change requires a restart param=LOG_FORMAT")
+
+	// an invalid configuration is not applied at all
+	loadErr = errors.New("invalid")
+	assert.ErrorIs(t, w.Reload(), loadErr)
+	assert.Equal(t, []string{"debug"}, levels)
+
+	// a nil Watcher ignores registrations
+	var nilWatcher *Watcher
+	nilWatcher.Add("ignored", func(cfg *config.Config) error { return nil })
+}
@@ -0,0 +1,313 @@
+// Package safety provides screening of destination URLs against a domain blocklist and the Google Safe Browsing API,
+// and disabling of existing links found unsafe later.
+package safety
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/config"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/logger"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/service/modelurl"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/storage/v2"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// checker parameters
+const (
+	// batchSize limits the number of URLs sent in one Safe Browsing request, the API accepts up to 500
+	batchSize = 500
+	// disableTimeout bounds disabling a batch of links the same way handlers bound storage calls
+	disableTimeout = 500 * time.Millisecond
+	clientID       = "url-shortener"
+	clientVersion  = "1.0"
+)
+
+// threatTypes lists Safe Browsing threat types URLs are checked for.
+var threatTypes = []string{"MALWARE", "SOCIAL_ENGINEERING", "UNWANTED_SOFTWARE", "POTENTIALLY_HARMFUL_APPLICATION"}
+
+// Store defines storage methods used to rescan existing links.
+type Store interface {
+	storage.URLScanner
+	storage.URLBatchDisabler
+}
+
+// Checker screens destination URLs. Safe Browsing failures are logged and URLs are then screened against the blocklist
+// only, so that an outage of the API does not stop shortening. A nil Checker reports every URL safe.
+type Checker struct {
+	// rules holds *rules replaced as a whole on Reload so that a screening never mixes old and new rules
+	rules atomic.Value
+	log   *logger.Logger
+}
+
+// rules defines what URLs are screened against.
+type rules struct {
+	blocked map[string]bool
+	apiKey  string
+	apiURL  string
+	client  *http.Client
+}
+
+// NewChecker initializes a Checker reading the blocklist file of cfg, it returns nil when neither blocked domains nor
+// a Safe Browsing API key are configured.
+func NewChecker(cfg *config.SafetyConfig, log *logger.Logger) (*Checker, error) {
+	r, err := newRules(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if len(r.blocked) == 0 && r.apiKey == "" {
+		return nil, nil
+	}
+	c := &Checker{log: log}
+	c.rules.Store(r)
+	return c, nil
+}
+
+// Reload replaces the blocklist and Safe Browsing parameters of c with those of cfg re-reading the blocklist file,
+// the current rules are kept when the file cannot be read. URLs are still screened by c when cfg configures no rules.
+func (c *Checker) Reload(cfg *config.SafetyConfig) error {
+	r, err := newRules(cfg)
+	if err != nil {
+		return err
+	}
+	c.rules.Store(r)
+	return nil
+}
+
+// newRules reads the blocklist file of cfg and sets up rules.
+func newRules(cfg *config.SafetyConfig) (*rules, error) {
+	domains := cfg.BlockedDomains
+	if cfg.BlocklistFile != "" {
+		listed, err := readBlocklist(cfg.BlocklistFile)
+		if err != nil {
+			return nil, err
+		}
+		domains = append(append([]string(nil), domains...), listed...)
+	}
+	blocked := make(map[string]bool)
+	for _, domain := range domains {
+		domain = strings.TrimSuffix(strings.ToLower(strings.TrimSpace(domain)), ".")
+		if domain != "" {
+			blocked[domain] = true
+		}
+	}
+	return &rules{
+		blocked: blocked,
+		apiKey:  cfg.SafeBrowsingAPIKey,
+		apiURL:  cfg.SafeBrowsingURL,
+		client:  &http.Client{Timeout: cfg.SafeBrowsingTimeout},
+	}, nil
+}
+
+// readBlocklist reads domains listed one per line, empty lines and lines starting with # are skipped.
+func readBlocklist(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	var domains []string
+	reader := bufio.NewScanner(file)
+	for reader.Scan() {
+		line := strings.TrimSpace(reader.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		domains = append(domains, line)
+	}
+	return domains, reader.Err()
+}
+
+// Unsafe returns the reasons URLs must not be shortened keyed by URL, safe URLs are not included.
+func (c *Checker) Unsafe(ctx context.Context, URLs []string) map[string]string {
+	unsafe := make(map[string]string)
+	if c == nil {
+		return unsafe
+	}
+	r := c.rules.Load().(*rules)
+	var remaining []string
+	for _, URL := range URLs {
+		if domain, ok := r.blockedDomain(URL); ok {
+			unsafe[URL] = fmt.Sprintf("domain %s is blocked", domain)
+			continue
+		}
+		remaining = append(remaining, URL)
+	}
+	if r.apiKey == "" {
+		return unsafe
+	}
+	for start := 0; start < len(remaining); start += batchSize {
+		end := start + batchSize
+		if end > len(remaining) {
+			end = len(remaining)
+		}
+		threats, err := r.lookup(ctx, remaining[start:end])
+		if err != nil {
+			c.log.Warn("Checking URLs with Safe Browsing", logger.Error(err), logger.Int("count", end-start))
+			continue
+		}
+		for URL, threat := range threats {
+			unsafe[URL] = fmt.Sprintf("reported as %s", strings.ToLower(strings.ReplaceAll(threat, "_", " ")))
+		}
+	}
+	return unsafe
+}
+
+// blockedDomain returns the blocked domain the host of URL equals or belongs to.
+func (r *rules) blockedDomain(URL string) (string, bool) {
+	if len(r.blocked) == 0 {
+		return "", false
+	}
+	u, err := url.Parse(URL)
+	if err != nil {
+		return "", false
+	}
+	host := strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+	for host != "" {
+		if r.blocked[host] {
+			return host, true
+		}
+		i := strings.IndexByte(host, '.')
+		if i < 0 {
+			break
+		}
+		host = host[i+1:]
+	}
+	return "", false
+}
+
+// lookupRequest defines the body of a Safe Browsing threatMatches:find request.
+type lookupRequest struct {
+	Client struct {
+		ClientID      string `json:"clientId"`
+		ClientVersion string `json:"clientVersion"`
+	} `json:"client"`
+	ThreatInfo struct {
+		ThreatTypes      []string      `json:"threatTypes"`
+		PlatformTypes    []string      `json:"platformTypes"`
+		ThreatEntryTypes []string      `json:"threatEntryTypes"`
+		ThreatEntries    []threatEntry `json:"threatEntries"`
+	} `json:"threatInfo"`
+}
+
+// lookupResponse defines the body of a Safe Browsing threatMatches:find response, it has no matches for safe URLs.
+type lookupResponse struct {
+	Matches []struct {
+		ThreatType string      `json:"threatType"`
+		Threat     threatEntry `json:"threat"`
+	} `json:"matches"`
+}
+
+type threatEntry struct {
+	URL string `json:"url"`
+}
+
+// lookup returns threat types Safe Browsing reports for URLs keyed by URL.
+func (r *rules) lookup(ctx context.Context, URLs []string) (map[string]string, error) {
+	var body lookupRequest
+	body.Client.ClientID = clientID
+	body.Client.ClientVersion = clientVersion
+	body.ThreatInfo.ThreatTypes = threatTypes
+	body.ThreatInfo.PlatformTypes = []string{"ANY_PLATFORM"}
+	body.ThreatInfo.ThreatEntryTypes = []string{"URL"}
+	for _, URL := range URLs {
+		body.ThreatInfo.ThreatEntries = append(body.ThreatInfo.ThreatEntries, threatEntry{URL: URL})
+	}
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, r.apiURL+"?key="+url.QueryEscape(r.apiKey), bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	res, err := r.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("safe browsing responded with %d %s", res.StatusCode, http.StatusText(res.StatusCode))
+	}
+	var found lookupResponse
+	err = json.NewDecoder(res.Body).Decode(&found)
+	if err != nil {
+		return nil, err
+	}
+	threats := make(map[string]string)
+	for _, match := range found.Matches {
+		threats[match.Threat.URL] = match.ThreatType
+	}
+	return threats, nil
+}
+
+// Rescan screens every active link of st and disables the unsafe ones, it returns the number of disabled links.
+func (c *Checker) Rescan(ctx context.Context, st Store) (disabled int, err error) {
+	if c == nil {
+		return 0, nil
+	}
+	var batch []modelurl.FullURL
+	flush := func() error {
+		URLs := make([]string, 0, len(batch))
+		for _, URL := range batch {
+			URLs = append(URLs, URL.URL)
+		}
+		unsafe := c.Unsafe(ctx, URLs)
+		var sURLs []string
+		for _, URL := range batch {
+			if reason, ok := unsafe[URL.URL]; ok {
+				c.log.Info("Disabling unsafe URL", logger.String("sURL", URL.SURL), logger.String("reason", reason))
+				sURLs = append(sURLs, URL.SURL)
+			}
+		}
+		batch = batch[:0]
+		if len(sURLs) == 0 {
+			return nil
+		}
+		ctxTO, cancel := context.WithTimeout(ctx, disableTimeout)
+		defer cancel()
+		done, err := st.DisableBatch(ctxTO, sURLs)
+		disabled += len(done)
+		return err
+	}
+	err = st.ScanURLs(ctx, func(URL modelurl.FullURL) error {
+		batch = append(batch, URL)
+		if len(batch) < batchSize {
+			return nil
+		}
+		return flush()
+	})
+	if err == nil && len(batch) > 0 {
+		err = flush()
+	}
+	return disabled, err
+}
+
+// Run rescans links of st every interval until ctx is done.
+func (c *Checker) Run(ctx context.Context, st Store, interval time.Duration) {
+	if c == nil {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			disabled, err := c.Rescan(ctx, st)
+			if err != nil {
+				c.log.Warn("Rescanning URLs", logger.Error(err))
+			}
+			c.log.Info("Rescanning URLs", logger.Int("disabled", disabled))
+		}
+	}
+}
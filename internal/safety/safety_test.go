@@ -0,0 +1,170 @@
+package safety
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/danilovkiri/dk_go_url_shortener/internal/config"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/service/modelurl"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testConfig() *config.SafetyConfig {
+	return &config.SafetyConfig{SafeBrowsingTimeout: time.Second}
+}
+
+func TestNewChecker(t *testing.T) {
+	checker, err := NewChecker(testConfig(), nil)
+	require.NoError(t, err)
+	assert.Nil(t, checker)
+	assert.Empty(t, checker.Unsafe(context.Background(), []string{"https://example.com"}))
+
+	path := filepath.Join(t.TempDir(), "blocklist")
+	require.NoError(t, os.WriteFile(path, []byte("# phishing\n\nEvil.example.\n"), 0600))
+	cfg := testConfig()
+	cfg.BlockedDomains = []string{"bad.example"}
+	cfg.BlocklistFile = path
+	checker, err = NewChecker(cfg, nil)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]bool{"bad.example": true, "evil.example": true}, checker.rules.Load().(*rules).blocked)
+
+	cfg.BlocklistFile = filepath.Join(t.TempDir(), "missing")
+	_, err = NewChecker(cfg, nil)
+	assert.Error(t, err)
+}
+
+func TestCheckerReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "blocklist")
+	require.NoError(t, os.WriteFile(path, []byte("bad.example\n"), 0600))
+	cfg := testConfig()
+	cfg.BlocklistFile = path
+	checker, err := NewChecker(cfg, nil)
+	require.NoError(t, err)
+	URLs := []string{"https://bad.example/", "https://evil.example/"}
+	assert.Len(t, checker.Unsafe(context.Background(), URLs), 1)
+
+	require.NoError(t, os.WriteFile(path, []byte("bad.example\nevil.example\n"), 0600))
+	require.NoError(t, checker.Reload(cfg))
+	assert.Len(t, checker.Unsafe(context.Background(), URLs), 2)
+
+	// the current rules are kept when the blocklist cannot be read
+	cfg.BlocklistFile = filepath.Join(t.TempDir(), "missing")
+	assert.Error(t, checker.Reload(cfg))
+	assert.Len(t, checker.Unsafe(context.Background(), URLs), 2)
+}
+
+func TestCheckerBlocklist(t *testing.T) {
+	cfg := testConfig()
+	cfg.BlockedDomains = []string{"bad.example"}
+	checker, err := NewChecker(cfg, nil)
+	require.NoError(t, err)
+	tests := []struct {
+		name    string
+		URL     string
+		blocked bool
+	}{
+		{name: "Domain", URL: "https://bad.example/login", blocked: true},
+		{name: "Subdomain", URL: "http://WWW.Bad.Example:8080/", blocked: true},
+		{name: "Other domain", URL: "https://notbad.example/", blocked: false},
+		{name: "Parent domain", URL: "https://example/", blocked: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			unsafe := checker.Unsafe(context.Background(), []string{tt.URL})
+			if tt.blocked {
+				assert.Equal(t, "domain bad.example is blocked", unsafe[tt.URL])
+			} else {
+				assert.Empty(t, unsafe)
+			}
+		})
+	}
+}
+
+func TestCheckerSafeBrowsing(t *testing.T) {
+	malware := "https://malware.example/payload"
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("key") != "secret" {
+			http.Error(w, "invalid key", http.StatusForbidden)
+			return
+		}
+		var body lookupRequest
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		var found lookupResponse
+		for _, entry := range body.ThreatInfo.ThreatEntries {
+			if entry.URL == malware {
+				found.Matches = append(found.Matches, struct {
+					ThreatType string      `json:"threatType"`
+					Threat     threatEntry `json:"threat"`
+				}{ThreatType: "MALWARE", Threat: entry})
+			}
+		}
+		_ = json.NewEncoder(w).Encode(found)
+	}))
+	defer ts.Close()
+	cfg := testConfig()
+	cfg.SafeBrowsingURL = ts.URL
+	cfg.SafeBrowsingAPIKey = "secret"
+	checker, err := NewChecker(cfg, nil)
+	require.NoError(t, err)
+
+	unsafe := checker.Unsafe(context.Background(), []string{"https://example.com", malware})
+	assert.Equal(t, map[string]string{malware: "reported as malware"}, unsafe)
+
+	// failed lookups do not block shortening
+	cfg.SafeBrowsingAPIKey = "invalid"
+	checker, err = NewChecker(cfg, nil)
+	require.NoError(t, err)
+	assert.Empty(t, checker.Unsafe(context.Background(), []string{malware}))
+}
+
+// testStore keeps links in memory and records disabled ones.
+type testStore struct {
+	URLs     []modelurl.FullURL
+	disabled []string
+}
+
+func (s *testStore) ScanURLs(ctx context.Context, fn func(URL modelurl.FullURL) error) error {
+	for _, URL := range s.URLs {
+		if err := fn(URL); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *testStore) DisableBatch(ctx context.Context, sURLs []string) ([]string, error) {
+	s.disabled = append(s.disabled, sURLs...)
+	return sURLs, nil
+}
+
+func TestCheckerRescan(t *testing.T) {
+	cfg := testConfig()
+	cfg.BlockedDomains = []string{"bad.example"}
+	checker, err := NewChecker(cfg, nil)
+	require.NoError(t, err)
+	st := &testStore{}
+	for i := 0; i < batchSize+1; i++ {
+		st.URLs = append(st.URLs, modelurl.FullURL{URL: "https://good.example/", SURL: "good"})
+	}
+	st.URLs = append(st.URLs, modelurl.FullURL{URL: "https://bad.example/", SURL: "bad"})
+
+	disabled, err := checker.Rescan(context.Background(), st)
+	require.NoError(t, err)
+	assert.Equal(t, 1, disabled)
+	assert.Equal(t, []string{"bad"}, st.disabled)
+
+	var nilChecker *Checker
+	disabled, err = nilChecker.Rescan(context.Background(), st)
+	assert.NoError(t, err)
+	assert.Zero(t, disabled)
+}
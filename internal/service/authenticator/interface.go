@@ -0,0 +1,32 @@
+// Package authenticator provides user account registration and access token handling.
+package authenticator
+
+import (
+	"context"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/service/modelurl"
+	"strings"
+)
+
+// APIKeyPrefix prefixes all API keys telling them apart from access tokens.
+const APIKeyPrefix = "usk_"
+
+// RoleAdmin is the role claim of access tokens issued to service administrators, API keys never carry a role.
+const RoleAdmin = "admin"
+
+// Authenticator defines a set of methods for types implementing Authenticator.
+type Authenticator interface {
+	HashPassword(password string) (hash string, err error)
+	Register(ctx context.Context, login, passwordHash, userID string) (token string, err error)
+	Login(ctx context.Context, login, password string) (token string, err error)
+	Verify(token string) (userID, role string, err error)
+	HasRole(ctx context.Context, userID, role string) (ok bool, err error)
+	CreateAPIKey(ctx context.Context, userID, name string) (key string, apiKey modelurl.APIKey, err error)
+	ListAPIKeys(ctx context.Context, userID string) (apiKeys []modelurl.APIKey, err error)
+	RevokeAPIKey(ctx context.Context, userID, id string) error
+	VerifyAPIKey(ctx context.Context, key string) (userID string, err error)
+}
+
+// IsAPIKey reports whether a bearer credential is an API key rather than an access token.
+func IsAPIKey(credential string) bool {
+	return strings.HasPrefix(credential, APIKeyPrefix)
+}
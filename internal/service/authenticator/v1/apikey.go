@@ -0,0 +1,106 @@
+package authenticator
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/service/authenticator"
+	serviceErrors "github.com/danilovkiri/dk_go_url_shortener/internal/service/errors"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/service/modelurl"
+	storageErrors "github.com/danilovkiri/dk_go_url_shortener/internal/storage/v2/errors"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/storage/v2/modelstorage"
+	"github.com/google/uuid"
+	"strings"
+	"time"
+)
+
+// API key parameters, keys are only stored hashed and the displayed prefix lets users tell them apart
+const (
+	apiKeyBytes         = 32
+	apiKeyPrefixLength  = 12
+	maxAPIKeyNameLength = 64
+)
+
+// CreateAPIKey mints a new API key acting on behalf of userID, the key is returned only once.
+func (a *Authenticator) CreateAPIKey(ctx context.Context, userID, name string) (key string, apiKey modelurl.APIKey, err error) {
+	name = strings.TrimSpace(name)
+	if len(name) > maxAPIKeyNameLength {
+		return "", modelurl.APIKey{}, &serviceErrors.ServiceIncorrectInputAPIKeyName{Msg: "API key name must be at most 64 characters long"}
+	}
+	secret := make([]byte, apiKeyBytes)
+	_, err = rand.Read(secret)
+	if err != nil {
+		return "", modelurl.APIKey{}, err
+	}
+	key = authenticator.APIKeyPrefix + base64.RawURLEncoding.EncodeToString(secret)
+	entry := modelstorage.APIKeyEntry{
+		ID:        uuid.New().String(),
+		UserID:    userID,
+		Name:      name,
+		Prefix:    key[:apiKeyPrefixLength],
+		Hash:      hashAPIKey(key),
+		CreatedAt: time.Now().UTC(),
+	}
+	err = a.URLStorage.DumpAPIKey(ctx, entry)
+	if err != nil {
+		return "", modelurl.APIKey{}, err
+	}
+	return key, toAPIKey(entry), nil
+}
+
+// ListAPIKeys returns API keys of userID including revoked ones sorted by creation time.
+func (a *Authenticator) ListAPIKeys(ctx context.Context, userID string) (apiKeys []modelurl.APIKey, err error) {
+	entries, err := a.URLStorage.RetrieveAPIKeysByUserID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	apiKeys = make([]modelurl.APIKey, 0, len(entries))
+	for _, entry := range entries {
+		apiKeys = append(apiKeys, toAPIKey(entry))
+	}
+	return apiKeys, nil
+}
+
+// RevokeAPIKey revokes the API key with id owned by userID, requests bearing it are rejected afterwards.
+func (a *Authenticator) RevokeAPIKey(ctx context.Context, userID, id string) error {
+	return a.URLStorage.RevokeAPIKey(ctx, id, userID)
+}
+
+// VerifyAPIKey checks that an API key exists and is not revoked and returns the user ID it acts on behalf of.
+func (a *Authenticator) VerifyAPIKey(ctx context.Context, key string) (userID string, err error) {
+	if !authenticator.IsAPIKey(key) {
+		return "", &serviceErrors.ServiceInvalidToken{Msg: "malformed API key"}
+	}
+	entry, err := a.URLStorage.RetrieveAPIKey(ctx, hashAPIKey(key))
+	if err != nil {
+		var apiKeyNotFoundError *storageErrors.APIKeyNotFoundError
+		if errors.As(err, &apiKeyNotFoundError) {
+			return "", &serviceErrors.ServiceInvalidToken{Msg: "invalid API key"}
+		}
+		return "", err
+	}
+	if entry.RevokedAt != nil {
+		return "", &serviceErrors.ServiceInvalidToken{Msg: "API key has been revoked"}
+	}
+	return entry.UserID, nil
+}
+
+// hashAPIKey returns the hex-encoded SHA-256 of key, keys are random enough not to need a slow salted hash.
+func hashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// toAPIKey converts a stored API key to its service representation.
+func toAPIKey(entry modelstorage.APIKeyEntry) modelurl.APIKey {
+	return modelurl.APIKey{
+		ID:        entry.ID,
+		Name:      entry.Name,
+		Prefix:    entry.Prefix,
+		CreatedAt: entry.CreatedAt,
+		RevokedAt: entry.RevokedAt,
+	}
+}
@@ -0,0 +1,111 @@
+// Package authenticator provides user account registration and access token handling.
+package authenticator
+
+import (
+	"context"
+	"errors"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/config"
+	serviceErrors "github.com/danilovkiri/dk_go_url_shortener/internal/service/errors"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/storage/v2"
+	storageErrors "github.com/danilovkiri/dk_go_url_shortener/internal/storage/v2/errors"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/storage/v2/modelstorage"
+	"golang.org/x/crypto/bcrypt"
+	"strings"
+	"time"
+)
+
+// credential length limits, bcrypt ignores password bytes beyond 72
+const (
+	maxLoginLength    = 64
+	minPasswordLength = 8
+	maxPasswordLength = 72
+)
+
+// Authenticator struct defines data structure handling and provides support for adding new implementations.
+type Authenticator struct {
+	URLStorage storage.URLStorage
+	key        []byte
+	tokenTTL   time.Duration
+}
+
+// InitAuthenticator initializes an Authenticator object and sets its attributes, it fails when no JWT signing key is
+// configured.
+func InitAuthenticator(s storage.URLStorage, cfg *config.SecretConfig) (*Authenticator, error) {
+	if s == nil {
+		return nil, &serviceErrors.ServiceFoundNilStorage{Msg: "nil storage was passed to service initializer"}
+	}
+	if cfg.JWTKey == "" {
+		return nil, &serviceErrors.ServiceMissingSigningKey{Msg: "JWT_KEY must be set to sign access tokens"}
+	}
+	return &Authenticator{URLStorage: s, key: []byte(cfg.JWTKey), tokenTTL: cfg.TokenTTL}, nil
+}
+
+// HashPassword checks a password of a new account and returns its hash to be passed to Register, so that handlers hash
+// passwords before their timeout budget starts.
+func (a *Authenticator) HashPassword(password string) (hash string, err error) {
+	if len(password) < minPasswordLength || len(password) > maxPasswordLength {
+		return "", &serviceErrors.ServiceIncorrectInputCredentials{Msg: "password must be 8 to 72 bytes long"}
+	}
+	hashed, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hashed), nil
+}
+
+// Register creates a user account owning links of userID with the password hash returned by HashPassword and returns
+// an access token for it. Registered accounts have no role, roles are granted out of band.
+func (a *Authenticator) Register(ctx context.Context, login, passwordHash, userID string) (token string, err error) {
+	login = strings.TrimSpace(login)
+	if login == "" || len(login) > maxLoginLength {
+		return "", &serviceErrors.ServiceIncorrectInputCredentials{Msg: "login must be 1 to 64 characters long"}
+	}
+	entry := modelstorage.UserEntry{Login: login, PasswordHash: passwordHash, UserID: userID}
+	err = a.URLStorage.DumpUser(ctx, entry)
+	if err != nil {
+		return "", err
+	}
+	return a.issueToken(userID, "", time.Now())
+}
+
+// Login checks user credentials and returns an access token for the account, the password is compared once the account
+// is retrieved so that hashing it does not spend the time ctx allows for storage.
+func (a *Authenticator) Login(ctx context.Context, login, password string) (token string, err error) {
+	user, err := a.URLStorage.RetrieveUser(ctx, strings.TrimSpace(login))
+	if err != nil {
+		var userNotFoundError *storageErrors.UserNotFoundError
+		if errors.As(err, &userNotFoundError) {
+			return "", &serviceErrors.ServiceInvalidCredentials{Msg: "invalid login or password"}
+		}
+		return "", err
+	}
+	err = bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password))
+	if err != nil {
+		return "", &serviceErrors.ServiceInvalidCredentials{Msg: "invalid login or password"}
+	}
+	return a.issueToken(user.UserID, user.Role, time.Now())
+}
+
+// Verify checks an access token signature and expiration and returns the user ID and the role it was issued for.
+func (a *Authenticator) Verify(token string) (userID, role string, err error) {
+	claims, err := a.parseToken(token, time.Now())
+	if err != nil {
+		return "", "", &serviceErrors.ServiceInvalidToken{Msg: err.Error()}
+	}
+	return claims.Subject, claims.Role, nil
+}
+
+// HasRole reports whether an account registered by userID currently holds role, so that roles revoked after an access
+// token was issued can be told apart from the role claim it carries.
+func (a *Authenticator) HasRole(ctx context.Context, userID, role string) (ok bool, err error) {
+	users, err := a.URLStorage.RetrieveUsersByUserID(ctx, userID)
+	if err != nil {
+		return false, err
+	}
+	for _, user := range users {
+		if user.Role == role {
+			return true, nil
+		}
+	}
+	return false, nil
+}
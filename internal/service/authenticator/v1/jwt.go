@@ -0,0 +1,75 @@
+package authenticator
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+)
+
+// tokenHeader is the base64url-encoded JOSE header of all issued tokens, only HS256 is supported.
+var tokenHeader = base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
+
+// claims defines registered JWT claims carried by access tokens along with the private role claim, which is empty for
+// regular users.
+type claims struct {
+	Subject   string `json:"sub"`
+	IssuedAt  int64  `json:"iat"`
+	ExpiresAt int64  `json:"exp"`
+	Role      string `json:"role,omitempty"`
+}
+
+// issueToken returns a signed JWT for userID with role valid for tokenTTL since now.
+func (a *Authenticator) issueToken(userID, role string, now time.Time) (string, error) {
+	payload, err := json.Marshal(claims{Subject: userID, IssuedAt: now.Unix(), ExpiresAt: now.Add(a.tokenTTL).Unix(), Role: role})
+	if err != nil {
+		return "", err
+	}
+	unsigned := tokenHeader + "." + base64.RawURLEncoding.EncodeToString(payload)
+	return unsigned + "." + a.sign(unsigned), nil
+}
+
+// parseToken verifies a JWT issued by issueToken and returns its claims.
+func (a *Authenticator) parseToken(token string, now time.Time) (claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return claims{}, errors.New("malformed token")
+	}
+	if parts[0] != tokenHeader {
+		return claims{}, errors.New("unsupported token header")
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return claims{}, errors.New("malformed token signature")
+	}
+	expected, _ := base64.RawURLEncoding.DecodeString(a.sign(parts[0] + "." + parts[1]))
+	if !hmac.Equal(signature, expected) {
+		return claims{}, errors.New("invalid token signature")
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return claims{}, errors.New("malformed token payload")
+	}
+	var c claims
+	err = json.Unmarshal(payload, &c)
+	if err != nil {
+		return claims{}, errors.New("malformed token payload")
+	}
+	if c.Subject == "" {
+		return claims{}, errors.New("token has no subject")
+	}
+	if now.Unix() >= c.ExpiresAt {
+		return claims{}, errors.New("token has expired")
+	}
+	return c, nil
+}
+
+// sign returns the base64url-encoded HMAC-SHA256 signature of data.
+func (a *Authenticator) sign(data string) string {
+	mac := hmac.New(sha256.New, a.key)
+	mac.Write([]byte(data))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
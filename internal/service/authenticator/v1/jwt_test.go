@@ -0,0 +1,61 @@
+package authenticator
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/danilovkiri/dk_go_url_shortener/internal/config"
+	serviceErrors "github.com/danilovkiri/dk_go_url_shortener/internal/service/errors"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/storage/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestToken(t *testing.T) {
+	a := &Authenticator{key: []byte("secret"), tokenTTL: time.Hour}
+	now := time.Now()
+	token, err := a.issueToken("user-1", "", now)
+	require.NoError(t, err)
+
+	c, err := a.parseToken(token, now.Add(time.Minute))
+	require.NoError(t, err)
+	assert.Equal(t, "user-1", c.Subject)
+	assert.Empty(t, c.Role)
+
+	admin, err := a.issueToken("user-1", "admin", now)
+	require.NoError(t, err)
+	c, err = a.parseToken(admin, now)
+	require.NoError(t, err)
+	assert.Equal(t, "admin", c.Role)
+
+	_, err = a.parseToken(token, now.Add(time.Hour))
+	assert.EqualError(t, err, "token has expired")
+
+	other := &Authenticator{key: []byte("other"), tokenTTL: time.Hour}
+	_, err = other.parseToken(token, now)
+	assert.EqualError(t, err, "invalid token signature")
+
+	parts := strings.Split(token, ".")
+	forged, err := other.issueToken("user-2", "admin", now)
+	require.NoError(t, err)
+	_, err = a.parseToken(parts[0]+"."+strings.Split(forged, ".")[1]+"."+parts[2], now)
+	assert.EqualError(t, err, "invalid token signature")
+
+	_, err = a.parseToken(`eyJhbGciOiJub25lIn0.`+parts[1]+".", now)
+	assert.EqualError(t, err, "unsupported token header")
+
+	_, err = a.parseToken("garbage", now)
+	assert.EqualError(t, err, "malformed token")
+}
+
+func TestInitAuthenticatorRequiresKey(t *testing.T) {
+	st := struct{ storage.URLStorage }{}
+	_, err := InitAuthenticator(st, &config.SecretConfig{TokenTTL: time.Hour})
+	var missingKeyError *serviceErrors.ServiceMissingSigningKey
+	assert.ErrorAs(t, err, &missingKeyError)
+
+	a, err := InitAuthenticator(st, &config.SecretConfig{JWTKey: "secret", TokenTTL: time.Hour})
+	require.NoError(t, err)
+	assert.Equal(t, []byte("secret"), a.key)
+}
@@ -1,6 +1,17 @@
 // Package errors provides custom errors for types implementing Processor interface.
 package errors
 
+import (
+	"fmt"
+	"time"
+)
+
+// Quotas reported by QuotaExceededError.
+const (
+	QuotaActiveLinks   = "active links"
+	QuotaDailyShortens = "daily shorten requests"
+)
+
 type (
 	ServiceInitHashError struct {
 		Msg string
@@ -14,9 +25,103 @@ type (
 	ServiceFoundNilSecretary struct {
 		Msg string
 	}
+	// ServiceMissingSigningKey reports that no key to sign access tokens is configured.
+	ServiceMissingSigningKey struct {
+		Msg string
+	}
 	ServiceIncorrectInputURL struct {
 		Msg string
 	}
+	ServiceIncorrectInputAlias struct {
+		Msg string
+	}
+	ServiceUnsafeURL struct {
+		Msg string
+	}
+	ServiceIncorrectInputExpiration struct {
+		Msg string
+	}
+	ServiceIncorrectInputRedirectType struct {
+		Msg string
+	}
+	ServiceIncorrectInputPassword struct {
+		Msg string
+	}
+	ServiceIncorrectInputMaxClicks struct {
+		Msg string
+	}
+	ServiceIncorrectInputDestinations struct {
+		Msg string
+	}
+	ServiceIncorrectInputGeoTargets struct {
+		Msg string
+	}
+	ServiceIncorrectInputDeviceTargets struct {
+		Msg string
+	}
+	ServiceIncorrectInputDomain struct {
+		Msg string
+	}
+	// ServiceDomainNotVerified reports a custom domain whose verification DNS TXT record is missing or wrong.
+	ServiceDomainNotVerified struct {
+		Msg string
+	}
+	// ServicePasswordRequired reports a password protected link requested without a password.
+	ServicePasswordRequired struct {
+		Msg string
+	}
+	// ServiceInvalidPassword reports a password protected link requested with a wrong password.
+	ServiceInvalidPassword struct {
+		Msg string
+	}
+	ServiceIncorrectInputCredentials struct {
+		Msg string
+	}
+	ServiceInvalidCredentials struct {
+		Msg string
+	}
+	ServiceInvalidToken struct {
+		Msg string
+	}
+	ServiceIncorrectInputAPIKeyName struct {
+		Msg string
+	}
+	ServiceIncorrectInputOrg struct {
+		Msg string
+	}
+	ServiceIncorrectInputTags struct {
+		Msg string
+	}
+	// ServiceIncorrectInputUTM reports an unknown UTM parameter or a wrong value of one.
+	ServiceIncorrectInputUTM struct {
+		Msg string
+	}
+	ServiceIncorrectInputQuery struct {
+		Msg string
+	}
+	// ServiceIncorrectInputTimeSeries reports an unknown granularity or a wrong range of a click time series.
+	ServiceIncorrectInputTimeSeries struct {
+		Msg string
+	}
+	// ServiceRedirectLoop reports a link whose destination points back at this or another URL shortener.
+	ServiceRedirectLoop struct {
+		Msg string
+	}
+	// ServiceURLForbidden reports a user who neither created a link nor is a member of the organization it belongs to.
+	ServiceURLForbidden struct {
+		Msg string
+	}
+	// ServiceOrgForbidden reports a user who is not a member of an organization or lacks the admin role managing it.
+	ServiceOrgForbidden struct {
+		Msg string
+	}
+	// QuotaExceededError reports a per-user quota which does not allow the request, RetryAfter is set for quotas
+	// which are replenished over time.
+	QuotaExceededError struct {
+		Quota      string
+		Limit      int
+		RetryAfter time.Duration
+	}
 )
 
 func (e *ServiceInitHashError) Error() string {
@@ -35,6 +140,114 @@ func (e *ServiceFoundNilSecretary) Error() string {
 	return e.Msg
 }
 
+func (e *ServiceMissingSigningKey) Error() string {
+	return e.Msg
+}
+
 func (e *ServiceIncorrectInputURL) Error() string {
 	return e.Msg
 }
+
+func (e *ServiceUnsafeURL) Error() string {
+	return e.Msg
+}
+
+func (e *ServiceIncorrectInputAlias) Error() string {
+	return e.Msg
+}
+
+func (e *ServiceIncorrectInputExpiration) Error() string {
+	return e.Msg
+}
+
+func (e *ServiceIncorrectInputRedirectType) Error() string {
+	return e.Msg
+}
+
+func (e *ServiceIncorrectInputPassword) Error() string {
+	return e.Msg
+}
+
+func (e *ServiceIncorrectInputMaxClicks) Error() string {
+	return e.Msg
+}
+
+func (e *ServiceIncorrectInputDestinations) Error() string {
+	return e.Msg
+}
+
+func (e *ServiceIncorrectInputGeoTargets) Error() string {
+	return e.Msg
+}
+
+func (e *ServiceIncorrectInputDeviceTargets) Error() string {
+	return e.Msg
+}
+
+func (e *ServiceIncorrectInputDomain) Error() string {
+	return e.Msg
+}
+
+func (e *ServiceDomainNotVerified) Error() string {
+	return e.Msg
+}
+
+func (e *ServicePasswordRequired) Error() string {
+	return e.Msg
+}
+
+func (e *ServiceInvalidPassword) Error() string {
+	return e.Msg
+}
+
+func (e *ServiceIncorrectInputCredentials) Error() string {
+	return e.Msg
+}
+
+func (e *ServiceInvalidCredentials) Error() string {
+	return e.Msg
+}
+
+func (e *ServiceInvalidToken) Error() string {
+	return e.Msg
+}
+
+func (e *ServiceIncorrectInputAPIKeyName) Error() string {
+	return e.Msg
+}
+
+func (e *ServiceIncorrectInputOrg) Error() string {
+	return e.Msg
+}
+
+func (e *ServiceIncorrectInputTags) Error() string {
+	return e.Msg
+}
+
+func (e *ServiceIncorrectInputUTM) Error() string {
+	return e.Msg
+}
+
+func (e *ServiceIncorrectInputQuery) Error() string {
+	return e.Msg
+}
+
+func (e *ServiceIncorrectInputTimeSeries) Error() string {
+	return e.Msg
+}
+
+func (e *ServiceRedirectLoop) Error() string {
+	return e.Msg
+}
+
+func (e *ServiceOrgForbidden) Error() string {
+	return e.Msg
+}
+
+func (e *ServiceURLForbidden) Error() string {
+	return e.Msg
+}
+
+func (e *QuotaExceededError) Error() string {
+	return fmt.Sprintf("quota of %d %s per user exceeded", e.Limit, e.Quota)
+}
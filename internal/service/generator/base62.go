@@ -0,0 +1,48 @@
+package generator
+
+import (
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// base62Alphabet lists digits of base62 codes in ascending order.
+const base62Alphabet = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+// Base62 generates codes by encoding a sequential counter in base62. The counter starts from the current time in
+// milliseconds so that codes keep growing past the ones issued before a restart.
+type Base62 struct {
+	// next is accessed atomically, keep it first for 64-bit alignment
+	next      uint64
+	minLength int
+}
+
+// NewBase62 initializes a Base62 generator padding codes with zeros up to minLength.
+func NewBase62(minLength int) *Base62 {
+	return &Base62{next: uint64(time.Now().UnixNano() / int64(time.Millisecond)), minLength: minLength}
+}
+
+// Generate returns the code of the next counter value.
+func (g *Base62) Generate() (string, error) {
+	n := atomic.AddUint64(&g.next, 1) - 1
+	return encodeBase62(n, g.minLength), nil
+}
+
+// encodeBase62 encodes n in base62 padded with zeros up to minLength.
+func encodeBase62(n uint64, minLength int) string {
+	var digits []byte
+	for n > 0 {
+		digits = append(digits, base62Alphabet[n%62])
+		n /= 62
+	}
+	if len(digits) == 0 {
+		digits = append(digits, base62Alphabet[0])
+	}
+	for i, j := 0, len(digits)-1; i < j; i, j = i+1, j-1 {
+		digits[i], digits[j] = digits[j], digits[i]
+	}
+	if len(digits) < minLength {
+		return strings.Repeat(base62Alphabet[:1], minLength-len(digits)) + string(digits)
+	}
+	return string(digits)
+}
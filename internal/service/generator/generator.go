@@ -0,0 +1,43 @@
+// Package generator provides strategies generating short unique codes used as sURLs.
+package generator
+
+import "fmt"
+
+// strategies selectable via configuration
+const (
+	StrategyHashids = "hashids"
+	StrategyBase62  = "base62"
+	StrategyNanoID  = "nanoid"
+)
+
+// Generator defines a set of methods for types implementing Generator. Consecutive calls of Generate return distinct
+// codes within one process, codes generated by other processes or before a restart may still collide.
+type Generator interface {
+	Generate() (code string, err error)
+}
+
+// IsValidStrategy reports whether strategy names one of the supported strategies.
+func IsValidStrategy(strategy string) bool {
+	switch strategy {
+	case StrategyHashids, StrategyBase62, StrategyNanoID:
+		return true
+	}
+	return false
+}
+
+// New initializes a Generator of strategy producing codes of length, it is the exact length for nanoid and the
+// minimal one for the other strategies. salt is only used by hashids.
+func New(strategy string, length int, salt string) (Generator, error) {
+	if length <= 0 {
+		return nil, fmt.Errorf("code length must be positive, got %d", length)
+	}
+	switch strategy {
+	case StrategyHashids:
+		return NewHashids(salt, length)
+	case StrategyBase62:
+		return NewBase62(length), nil
+	case StrategyNanoID:
+		return NewNanoID(length), nil
+	}
+	return nil, fmt.Errorf("unknown code generation strategy %q, expected one of %s, %s and %s", strategy, StrategyHashids, StrategyBase62, StrategyNanoID)
+}
@@ -0,0 +1,53 @@
+package generator
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGeneratorsProduceDistinctCodes(t *testing.T) {
+	for _, strategy := range []string{StrategyHashids, StrategyBase62, StrategyNanoID} {
+		t.Run(strategy, func(t *testing.T) {
+			gen, err := New(strategy, 8, "salt")
+			require.NoError(t, err)
+			seen := make(map[string]bool)
+			for i := 0; i < 1000; i++ {
+				code, err := gen.Generate()
+				require.NoError(t, err)
+				assert.Regexp(t, regexp.MustCompile(`^[A-Za-z0-9_-]{8,}$`), code)
+				assert.False(t, seen[code], "duplicate code %s", code)
+				seen[code] = true
+			}
+		})
+	}
+}
+
+func TestNanoIDLength(t *testing.T) {
+	code, err := NewNanoID(12).Generate()
+	require.NoError(t, err)
+	assert.Len(t, code, 12)
+}
+
+func TestEncodeBase62(t *testing.T) {
+	assert.Equal(t, "00000", encodeBase62(0, 5))
+	assert.Equal(t, "0000z", encodeBase62(61, 5))
+	assert.Equal(t, "00010", encodeBase62(62, 5))
+	assert.Equal(t, "10", encodeBase62(62, 1))
+	// codes of a sequential counter keep growing
+	g := &Base62{next: 61, minLength: 3}
+	first, _ := g.Generate()
+	second, _ := g.Generate()
+	assert.Equal(t, []string{"00z", "010"}, []string{first, second})
+}
+
+func TestNew(t *testing.T) {
+	_, err := New("uuid", 8, "")
+	assert.Error(t, err)
+	_, err = New(StrategyNanoID, 0, "")
+	assert.Error(t, err)
+	assert.True(t, IsValidStrategy(StrategyBase62))
+	assert.False(t, IsValidStrategy(""))
+}
@@ -0,0 +1,32 @@
+package generator
+
+import (
+	"github.com/speps/go-hashids/v2"
+	"sync/atomic"
+	"time"
+)
+
+// Hashids generates codes by encoding the current time along with a sequence number with hashids.
+type Hashids struct {
+	// seq is accessed atomically, keep it first for 64-bit alignment
+	seq    int64
+	hashID *hashids.HashID
+}
+
+// NewHashids initializes a Hashids generator with salt and a minimal code length.
+func NewHashids(salt string, minLength int) (*Hashids, error) {
+	hd := hashids.NewData()
+	hd.Salt = salt
+	hd.MinLength = minLength
+	hashID, err := hashids.NewWithData(hd)
+	if err != nil {
+		return nil, err
+	}
+	return &Hashids{hashID: hashID}, nil
+}
+
+// Generate returns a new code, the sequence number keeps codes generated within the same clock tick distinct.
+func (g *Hashids) Generate() (string, error) {
+	seq := atomic.AddInt64(&g.seq, 1)
+	return g.hashID.EncodeInt64([]int64{time.Now().UnixNano(), seq})
+}
@@ -0,0 +1,30 @@
+package generator
+
+import "crypto/rand"
+
+// nanoIDAlphabet lists URL-safe characters of nanoid codes, its size of 64 lets every random byte be masked into
+// an index without bias.
+const nanoIDAlphabet = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz_-"
+
+// NanoID generates random codes of a fixed length in the manner of nanoid.
+type NanoID struct {
+	length int
+}
+
+// NewNanoID initializes a NanoID generator producing codes of length.
+func NewNanoID(length int) *NanoID {
+	return &NanoID{length: length}
+}
+
+// Generate returns a new random code.
+func (g *NanoID) Generate() (string, error) {
+	code := make([]byte, g.length)
+	_, err := rand.Read(code)
+	if err != nil {
+		return "", err
+	}
+	for i, b := range code {
+		code[i] = nanoIDAlphabet[b&63]
+	}
+	return string(code), nil
+}
@@ -1,7 +1,412 @@
 // Package modelurl provides locally used types and their structure for URL handling between modules.
 package modelurl
 
+import (
+	"net"
+	"net/http"
+	"time"
+)
+
 type FullURL struct {
 	URL  string
 	SURL string
+	// Title and FaviconURL describe the destination page, they are empty until its metadata is fetched.
+	Title      string
+	FaviconURL string
+	// Disabled is set for URLs whose destination was found unsafe, they are not redirected to.
+	Disabled bool
+	// Domain is the custom domain the URL is served on, empty for the base URL host.
+	Domain string
+	// UserID is the user who created the URL.
+	UserID string
+	// Tags are attached to the URL by its creator, sorted by name.
+	Tags []string
+	// CreatedAt is zero for URLs stored before creation times were recorded, LastAccessedAt is the time of the latest
+	// redirect and nil for URLs never redirected since.
+	CreatedAt      time.Time
+	LastAccessedAt *time.Time
+	// ArchivedAt is set for URLs archived after being unused for a while, they are still redirected to.
+	ArchivedAt *time.Time
+}
+
+// Link defines a link created by shortening: URL is its destination as stored, RedirectType the status code it is
+// redirected with and Domain the custom domain it is served on, empty for the base URL host.
+type Link struct {
+	SURL         string
+	URL          string
+	Domain       string
+	ExpiresAt    *time.Time
+	ActiveFrom   *time.Time
+	RedirectType int
+	MaxClicks    int
+	Tags         []string
+}
+
+// ListOptions defines a page of user URLs sorted by creation time, zero Limit means no limit.
+type ListOptions struct {
+	Limit  int
+	Offset int
+	// Desc sorts newest URLs first.
+	Desc bool
+	// Tag lists only URLs tagged with it, empty means all URLs.
+	Tag string
+	// SortBy sorts URLs by SortLastAccessed instead of creation time when set, URLs never accessed sort as accessed
+	// at creation.
+	SortBy string
+	// IncludeArchived lists archived URLs along with other ones, they are left out otherwise.
+	IncludeArchived bool
+}
+
+// URL sort keys of ListOptions.
+const (
+	SortCreated      = "created_at"
+	SortLastAccessed = "last_accessed_at"
+)
+
+// ShortenOptions defines optional per-link settings requested on shortening.
+type ShortenOptions struct {
+	Alias string
+	// ExpiresAt, ActiveUntil and TTL are mutually exclusive ways to limit the link lifetime, the link never expires if
+	// all of them are unset.
+	ExpiresAt   *time.Time
+	ActiveUntil *time.Time
+	TTL         time.Duration
+	// ActiveFrom delays redirects of a link created in advance until the given time, it must precede the expiration.
+	ActiveFrom *time.Time
+	// RedirectType overrides the globally configured redirect status code, zero means no override.
+	RedirectType int
+	// Password protects the link, redirects are issued only to clients presenting it. Empty means no protection.
+	// PasswordHash is the hash of Password computed ahead of shortening by HashPassword, Password is hashed on
+	// shortening without it.
+	Password     string
+	PasswordHash string
+	// MaxClicks limits the number of redirects after which the link is gone, zero means no limit.
+	MaxClicks int
+	// Destinations splits redirects between several destinations by their weights, the shortened URL must be the first
+	// of them. Sticky serves every visitor identified by the user cookie the same destination.
+	Destinations []Destination
+	Sticky       bool
+	// GeoTargets maps ISO 3166-1 alpha-2 country codes of visitors to the URLs they are redirected to instead of the
+	// default destination.
+	GeoTargets map[string]string
+	// DeviceTargets maps devices of visitors (DeviceIOS, DeviceAndroid and DeviceDesktop) to the URLs they are
+	// redirected to, e.g. app store pages, taking precedence over geo targets.
+	DeviceTargets map[string]string
+	// Domain serves the link on a verified custom domain of the user instead of the base URL host.
+	Domain string
+	// Org creates the link in an organization of the user, its members share the link with the user.
+	Org string
+	// Tags label the link for filtering links of the user.
+	Tags []string
+	// UTM maps UTM parameter names (UTMParams) to the values appended to the query of destinations on redirect, links
+	// without them are given the UTM defaults of the user.
+	UTM map[string]string
+}
+
+// UTMParams lists UTM parameters links can be tagged with.
+var UTMParams = []string{"utm_source", "utm_medium", "utm_campaign", "utm_term", "utm_content", "utm_id"}
+
+// Trailing slash policies of URL normalization: paths other than "/" keep their trailing slashes as they are, are
+// stripped of them or are given one.
+const (
+	TrailingSlashKeep  = "keep"
+	TrailingSlashStrip = "strip"
+	TrailingSlashAdd   = "add"
+)
+
+// IsValidTrailingSlash reports whether policy is one of the trailing slash policies.
+func IsValidTrailingSlash(policy string) bool {
+	return policy == TrailingSlashKeep || policy == TrailingSlashStrip || policy == TrailingSlashAdd
+}
+
+// Policies of URL validation for internationalized domain names: they are accepted once they convert to valid
+// punycode or are rejected along with punycode hosts, e.g. to rule out homograph lookalikes of other domains.
+const (
+	IDNAllow  = "allow"
+	IDNReject = "reject"
+)
+
+// IsValidIDNPolicy reports whether policy is one of the internationalized domain name policies.
+func IsValidIDNPolicy(policy string) bool {
+	return policy == IDNAllow || policy == IDNReject
+}
+
+// Visitor devices links can target.
+const (
+	DeviceIOS     = "ios"
+	DeviceAndroid = "android"
+	DeviceDesktop = "desktop"
+)
+
+// Destination defines one arm of a split link, it is served to a Weight share of redirects out of the total weight of
+// the link destinations.
+type Destination struct {
+	URL    string `json:"url"`
+	Weight int    `json:"weight"`
+}
+
+// Visitor defines the client of a redirect: ID identifies it by the user cookie, IP locates it and Device is one of
+// the visitor devices links can target, any of them may be unset.
+type Visitor struct {
+	ID     string
+	IP     net.IP
+	Device string
+}
+
+// Redirect defines where a visitor of a link is sent: to URL with the Type status code. ModifiedAt is the time the
+// destination of the link was set at creation or by its latest edit, zero if it is unknown. Varying reports that the
+// redirect must not be cached or revalidated: other visitors may be sent elsewhere since the link is split, targets
+// devices or countries or is password protected, or every redirect counts towards the click limit of the link.
+type Redirect struct {
+	URL        string
+	Type       int
+	ModifiedAt time.Time
+	Varying    bool
+}
+
+// IsValidRedirectType reports whether code is a redirect status code links can be served with.
+func IsValidRedirectType(code int) bool {
+	switch code {
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusTemporaryRedirect:
+		return true
+	}
+	return false
+}
+
+// ImportRow defines one URL to be imported with an optional custom alias.
+type ImportRow struct {
+	URL   string
+	Alias string
+}
+
+// ImportResult defines the outcome of importing one ImportRow: SURL is set unless Error is, Existed reports that the
+// URL had already been shortened and SURL is the existing one.
+type ImportResult struct {
+	ImportRow
+	SURL    string
+	Existed bool
+	Error   string
+}
+
+// ServiceStats defines totals of the whole service: URLs counts stored links which are not deleted and Users counts
+// users who have shortened at least one URL.
+type ServiceStats struct {
+	URLs  int
+	Users int
+}
+
+// UserStats defines totals of one user: URLs counts links which are neither deleted nor expired, Disabled counts those
+// of them which are disabled and Clicks counts redirects of all of them but the ones of bots.
+type UserStats struct {
+	UserID   string
+	URLs     int
+	Disabled int
+	Clicks   int
+}
+
+// URLStats defines redirect statistics for one sURL, days are formatted as YYYY-MM-DD in UTC and sorted. Redirects are
+// also counted per served destination sorted by URL, redirects recorded before destinations were tracked are not.
+type URLStats struct {
+	SURL                 string
+	TotalClicks          int
+	ClicksPerDay         []DailyClicks
+	ClicksPerDestination []DestinationClicks
+	// UniqueVisitors approximates the number of distinct visitors redirected over all days.
+	UniqueVisitors int
+}
+
+// DailyClicks defines the number of redirects within Date and the approximate number of distinct visitors redirected.
+type DailyClicks struct {
+	Date     string
+	Clicks   int
+	Visitors int
+}
+
+type DestinationClicks struct {
+	URL    string
+	Clicks int
+}
+
+// ReferrerClicks defines the number of redirects referred from pages of Domain.
+type ReferrerClicks struct {
+	Domain string
+	Clicks int
+}
+
+// ReferrerStats defines top referrer domains of SURL by redirect counts, DirectClicks counts redirects without a
+// referrer.
+type ReferrerStats struct {
+	SURL         string
+	DirectClicks int
+	Referrers    []ReferrerClicks
+}
+
+// CountryClicks defines the number of redirects of visitors from Country, an ISO 3166-1 alpha-2 code.
+type CountryClicks struct {
+	Country string
+	Clicks  int
+}
+
+// CountryStats defines redirect counts of SURL per visitor country, UnknownClicks counts redirects of visitors whose
+// country was not resolved.
+type CountryStats struct {
+	SURL          string
+	UnknownClicks int
+	Countries     []CountryClicks
+}
+
+// Click time series granularities.
+const (
+	GranularityHour = "hour"
+	GranularityDay  = "day"
+)
+
+// ClickBucket defines the number of redirects within one hour or day of a click time series starting at Start in UTC.
+type ClickBucket struct {
+	Start  time.Time
+	Clicks int
+}
+
+// ClickTimeSeries defines redirect counts of SURL per bucket of Granularity within [From, To), every bucket of the
+// range is listed including empty ones.
+type ClickTimeSeries struct {
+	SURL        string
+	Granularity string
+	From        time.Time
+	To          time.Time
+	Buckets     []ClickBucket
+}
+
+// User defines a registered user account.
+type User struct {
+	Login  string
+	UserID string
+}
+
+// APIKey defines an API key of a user, the key itself is only known when it is created.
+type APIKey struct {
+	ID        string
+	Name      string
+	Prefix    string
+	CreatedAt time.Time
+	RevokedAt *time.Time
+}
+
+// Tag defines a tag of links of a user along with the number of live links tagged with it.
+type Tag struct {
+	Name  string
+	Count int
+}
+
+// Domain defines a custom domain of a user, it is verified once a DNS TXT record VerificationRecord holding
+// VerificationValue is published.
+type Domain struct {
+	Name               string
+	VerificationRecord string
+	VerificationValue  string
+	CreatedAt          time.Time
+	VerifiedAt         *time.Time
+}
+
+// Organization member roles: admins manage membership, members share links of the organization.
+const (
+	RoleAdmin  = "admin"
+	RoleMember = "member"
+)
+
+// Org defines an organization along with the role of the current user in it.
+type Org struct {
+	ID        string
+	Name      string
+	Role      string
+	CreatedAt time.Time
+}
+
+// Member defines a member of an organization, Login is empty for members who are not registered users.
+type Member struct {
+	UserID    string
+	Login     string
+	Role      string
+	CreatedAt time.Time
+}
+
+// UserData defines everything stored about a user: the logins they registered, their links along with redirect
+// statistics, API keys, custom domains, organizations they are a member of and UTM defaults. Password hashes and API key
+// hashes are never exported.
+type UserData struct {
+	UserID      string
+	Logins      []string
+	URLs        []UserURL
+	APIKeys     []APIKey
+	Domains     []Domain
+	Orgs        []Org
+	UTMDefaults map[string]string
+}
+
+// UserURL defines a link of a user along with its redirect statistics.
+type UserURL struct {
+	FullURL
+	Stats URLStats
+}
+
+// Link lifecycle event types.
+const (
+	EventURLCreated  = "url.created"
+	EventURLDeleted  = "url.deleted"
+	EventURLExpired  = "url.expired"
+	EventURLDisabled = "url.disabled"
+	EventURLArchived = "url.archived"
+	// EventURLArchivePending notifies the owner of a link that it is going to be archived unless it is redirected
+	// to in the meantime.
+	EventURLArchivePending = "url.archive_pending"
+)
+
+// Event defines a change in the lifecycle of one link.
+type Event struct {
+	Type       string
+	SURL       string
+	URL        string
+	UserID     string
+	OccurredAt time.Time
+}
+
+// Audited actions of mutating operations.
+const (
+	AuditCreate  = "create"
+	AuditUpdate  = "update"
+	AuditDelete  = "delete"
+	AuditRestore = "restore"
+)
+
+// Audited entities.
+const (
+	AuditEntityURL    = "url"
+	AuditEntityDomain = "domain"
+	AuditEntityOrg    = "org"
+	AuditEntityMember = "member"
+	AuditEntityUser   = "user"
+)
+
+// AuditRecord defines one mutating operation of Actor on the entity EntityID, Before and After hold JSON encoded
+// states of the entity and are empty when it did not exist before or after the operation.
+type AuditRecord struct {
+	ID        string
+	Actor     string
+	Action    string
+	Entity    string
+	EntityID  string
+	Before    []byte
+	After     []byte
+	CreatedAt time.Time
+}
+
+// AuditFilter defines audit records to list, empty fields match all records and Since and Until bound the time of
+// the operation inclusively and exclusively respectively.
+type AuditFilter struct {
+	Actor    string
+	Action   string
+	Entity   string
+	EntityID string
+	Since    *time.Time
+	Until    *time.Time
 }
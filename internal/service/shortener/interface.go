@@ -4,13 +4,53 @@ package shortener
 import (
 	"context"
 	"github.com/danilovkiri/dk_go_url_shortener/internal/service/modelurl"
+	"time"
 )
 
 // Processor defines a set of methods for types implementing Processor.
 type Processor interface {
-	Encode(ctx context.Context, URL, userID string) (sURL string, err error)
-	Decode(ctx context.Context, sURL string) (URL string, err error)
-	Delete(ctx context.Context, sURLs []string, userID string)
-	DecodeByUserID(ctx context.Context, userID string) (URLs []modelurl.FullURL, err error)
+	Encode(ctx context.Context, URL, userID string, opts modelurl.ShortenOptions) (sURL string, err error)
+	Shorten(ctx context.Context, URL, userID string, opts modelurl.ShortenOptions) (link modelurl.Link, err error)
+	HashPassword(password string) (hash string, err error)
+	EncodeBatch(ctx context.Context, URLs []string, userID string) (sURLs []string, err error)
+	Import(ctx context.Context, rows []modelurl.ImportRow, userID string) (results []modelurl.ImportResult, err error)
+	Decode(ctx context.Context, sURL, domain, password string) (URL string, redirectType int, err error)
+	Redirect(ctx context.Context, sURL, domain, password string, visitor modelurl.Visitor) (redirect modelurl.Redirect, err error)
+	PeekRedirect(ctx context.Context, sURL, domain, password string, visitor modelurl.Visitor) (redirect modelurl.Redirect, err error)
+	Delete(ctx context.Context, sURLs []string, userID string) error
+	Restore(ctx context.Context, sURLs []string, userID string) (restored []string, err error)
+	Edit(ctx context.Context, sURL, URL, userID string) error
+	SetTags(ctx context.Context, sURL, userID string, tags []string) error
+	ListTags(ctx context.Context, userID string) (tags []modelurl.Tag, err error)
+	RenameTag(ctx context.Context, userID, tag, name string) error
+	SetUTMDefaults(ctx context.Context, userID string, utm map[string]string) error
+	UTMDefaults(ctx context.Context, userID string) (utm map[string]string, err error)
+	DecodeByUserID(ctx context.Context, userID string, opts modelurl.ListOptions) (URLs []modelurl.FullURL, err error)
+	SearchUserURLs(ctx context.Context, userID, query string, opts modelurl.ListOptions) (URLs []modelurl.FullURL, err error)
+	Export(ctx context.Context, userID string, fn func(URL modelurl.FullURL) error) error
+	RecordClick(sURL, destination, referrer, userAgent string, visitor modelurl.Visitor)
+	Stats(ctx context.Context, sURL string, includeBots bool) (stats modelurl.URLStats, err error)
+	TimeSeries(ctx context.Context, sURL, granularity string, from, to time.Time, includeBots bool) (series modelurl.ClickTimeSeries, err error)
+	Referrers(ctx context.Context, sURL string, limit int, includeBots bool) (stats modelurl.ReferrerStats, err error)
+	Countries(ctx context.Context, sURL string, includeBots bool) (stats modelurl.CountryStats, err error)
+	AuthorizeURL(ctx context.Context, sURL, userID string) error
+	ServiceStats(ctx context.Context) (stats modelurl.ServiceStats, err error)
+	AddDomain(ctx context.Context, userID, name string) (domain modelurl.Domain, err error)
+	ListDomains(ctx context.Context, userID string) (domains []modelurl.Domain, err error)
+	VerifyDomain(ctx context.Context, userID, name string) (domain modelurl.Domain, err error)
+	ResolveDomain(ctx context.Context, host string) (domain string, err error)
+	CreateOrg(ctx context.Context, userID, name string) (org modelurl.Org, err error)
+	ListOrgs(ctx context.Context, userID string) (orgs []modelurl.Org, err error)
+	ListMembers(ctx context.Context, userID, orgID string) (members []modelurl.Member, err error)
+	SetMember(ctx context.Context, userID, orgID, login, role string) (member modelurl.Member, err error)
+	RemoveMember(ctx context.Context, userID, orgID, memberID string) error
+	DecodeByOrgID(ctx context.Context, userID, orgID string, opts modelurl.ListOptions) (URLs []modelurl.FullURL, err error)
+	SearchURLs(ctx context.Context, query string, opts modelurl.ListOptions) (URLs []modelurl.FullURL, err error)
+	DisableURLs(ctx context.Context, userID string, sURLs []string) (disabled []string, err error)
+	ListUsers(ctx context.Context, opts modelurl.ListOptions) (users []modelurl.User, err error)
+	UserStats(ctx context.Context, userID string) (stats modelurl.UserStats, err error)
+	ListAudit(ctx context.Context, filter modelurl.AuditFilter, opts modelurl.ListOptions) (records []modelurl.AuditRecord, err error)
+	ExportUserData(ctx context.Context, userID string) (data modelurl.UserData, err error)
+	EraseUser(ctx context.Context, userID string) error
 	PingDB() error
 }
@@ -0,0 +1,102 @@
+package shortener
+
+import (
+	"context"
+	"fmt"
+	serviceErrors "github.com/danilovkiri/dk_go_url_shortener/internal/service/errors"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/service/modelurl"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/storage/v2/modelstorage"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/tracing"
+)
+
+// ExportUserData returns everything stored about userID: registered logins, live links along with their redirect
+// statistics, API keys, custom domains, organizations the user is a member of and UTM defaults.
+func (short *Shortener) ExportUserData(ctx context.Context, userID string) (data modelurl.UserData, err error) {
+	ctx, span := tracing.Start(ctx, "shortener.ExportUserData", tracing.KindInternal)
+	defer func() { span.End(err) }()
+	data = modelurl.UserData{UserID: userID}
+	users, err := short.URLStorage.RetrieveUsersByUserID(ctx, userID)
+	if err != nil {
+		return modelurl.UserData{}, err
+	}
+	for _, user := range users {
+		data.Logins = append(data.Logins, user.Login)
+	}
+	URLs, err := short.URLStorage.RetrieveByUserID(ctx, userID, modelurl.ListOptions{})
+	if err != nil {
+		return modelurl.UserData{}, err
+	}
+	for _, URL := range URLs {
+		stats, err := short.URLStorage.RetrieveStats(ctx, URL.SURL, false)
+		if err != nil {
+			return modelurl.UserData{}, err
+		}
+		data.URLs = append(data.URLs, modelurl.UserURL{FullURL: URL, Stats: stats})
+	}
+	apiKeys, err := short.URLStorage.RetrieveAPIKeysByUserID(ctx, userID)
+	if err != nil {
+		return modelurl.UserData{}, err
+	}
+	for _, apiKey := range apiKeys {
+		data.APIKeys = append(data.APIKeys, toAPIKey(apiKey))
+	}
+	data.Domains, err = short.ListDomains(ctx, userID)
+	if err != nil {
+		return modelurl.UserData{}, err
+	}
+	data.Orgs, err = short.ListOrgs(ctx, userID)
+	if err != nil {
+		return modelurl.UserData{}, err
+	}
+	data.UTMDefaults, err = short.UTMDefaults(ctx, userID)
+	if err != nil {
+		return modelurl.UserData{}, err
+	}
+	return data, nil
+}
+
+// EraseUser permanently removes all data of userID: links whatever their state along with their redirect statistics,
+// registered logins, API keys, custom domains, settings and organization memberships. Deletions of the user still
+// queued become no-ops. The last admin of an organization with other members must hand it over first. Audit records are
+// kept without the states of the links and memberships of the user and of operations made by the user, the erasure
+// itself is audited.
+func (short *Shortener) EraseUser(ctx context.Context, userID string) (err error) {
+	ctx, span := tracing.Start(ctx, "shortener.EraseUser", tracing.KindInternal)
+	defer func() { span.End(err) }()
+	memberships, err := short.URLStorage.RetrieveMembershipsByUserID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	for _, membership := range memberships {
+		if membership.Role != modelurl.RoleAdmin {
+			continue
+		}
+		entries, err := short.URLStorage.RetrieveMembers(ctx, membership.OrgID)
+		if err != nil {
+			return err
+		}
+		if len(entries) > 1 && isLastAdmin(entries, userID) {
+			return &serviceErrors.ServiceIncorrectInputOrg{
+				Msg: fmt.Sprintf("organization %s must keep at least one admin, promote another member first", membership.OrgID),
+			}
+		}
+	}
+	err = short.URLStorage.EraseUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+	// custom domains of the user are gone
+	short.verified.invalidate()
+	return short.audit(ctx, userID, modelurl.AuditDelete, modelurl.AuditEntityUser, userID, nil, nil)
+}
+
+// toAPIKey converts a stored API key leaving its hash out.
+func toAPIKey(entry modelstorage.APIKeyEntry) modelurl.APIKey {
+	return modelurl.APIKey{
+		ID:        entry.ID,
+		Name:      entry.Name,
+		Prefix:    entry.Prefix,
+		CreatedAt: entry.CreatedAt,
+		RevokedAt: entry.RevokedAt,
+	}
+}
@@ -0,0 +1,60 @@
+package shortener
+
+import (
+	"context"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/service/modelurl"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/storage/v2/modelstorage"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/tracing"
+)
+
+// SearchURLs returns a page of URLs of all users whose URL or sURL contains query sorted by creation time, an empty
+// query lists all of them.
+func (short *Shortener) SearchURLs(ctx context.Context, query string, opts modelurl.ListOptions) (URLs []modelurl.FullURL, err error) {
+	ctx, span := tracing.Start(ctx, "shortener.SearchURLs", tracing.KindInternal)
+	defer func() { span.End(err) }()
+	URLs, err = short.URLStorage.SearchURLs(ctx, query, opts)
+	if err != nil {
+		return nil, err
+	}
+	return URLs, nil
+}
+
+// DisableURLs disables sURLs of any user on behalf of the admin userID so that they are no longer redirected to and
+// returns sURLs which were not disabled before.
+func (short *Shortener) DisableURLs(ctx context.Context, userID string, sURLs []string) (disabled []string, err error) {
+	ctx, span := tracing.Start(ctx, "shortener.DisableURLs", tracing.KindInternal)
+	defer func() { span.End(err) }()
+	disabled, err = short.URLStorage.DisableBatch(ctx, sURLs)
+	if err != nil {
+		return nil, err
+	}
+	err = short.auditURLs(ctx, userID, modelurl.AuditUpdate, disabled, func(i int) (before, after interface{}) {
+		return modelstorage.AuditedURL{SURL: disabled[i]}, modelstorage.AuditedURL{SURL: disabled[i], Disabled: true}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return disabled, nil
+}
+
+// ListUsers returns a page of registered users sorted by login.
+func (short *Shortener) ListUsers(ctx context.Context, opts modelurl.ListOptions) (users []modelurl.User, err error) {
+	ctx, span := tracing.Start(ctx, "shortener.ListUsers", tracing.KindInternal)
+	defer func() { span.End(err) }()
+	entries, err := short.URLStorage.RetrieveUsers(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	users = make([]modelurl.User, 0, len(entries))
+	for _, entry := range entries {
+		users = append(users, modelurl.User{Login: entry.Login, UserID: entry.UserID})
+	}
+	return users, nil
+}
+
+// UserStats returns totals of links of userID and their redirects, users who have not registered are counted as well.
+func (short *Shortener) UserStats(ctx context.Context, userID string) (stats modelurl.UserStats, err error) {
+	ctx, span := tracing.Start(ctx, "shortener.UserStats", tracing.KindInternal)
+	defer func() { span.End(err) }()
+	return short.URLStorage.RetrieveUserStats(ctx, userID)
+}
@@ -0,0 +1,72 @@
+package shortener
+
+import (
+	"context"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/service/modelurl"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/storage/v2/modelstorage"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/tracing"
+)
+
+// ListAudit returns a page of records of mutating operations matching filter sorted by the time they were performed.
+func (short *Shortener) ListAudit(ctx context.Context, filter modelurl.AuditFilter, opts modelurl.ListOptions) (records []modelurl.AuditRecord, err error) {
+	ctx, span := tracing.Start(ctx, "shortener.ListAudit", tracing.KindInternal)
+	defer func() { span.End(err) }()
+	entries, err := short.URLStorage.RetrieveAudit(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	records = make([]modelurl.AuditRecord, 0, len(entries))
+	for _, entry := range entries {
+		records = append(records, modelurl.AuditRecord{
+			ID:        entry.ID,
+			Actor:     entry.Actor,
+			Action:    entry.Action,
+			Entity:    entry.Entity,
+			EntityID:  entry.EntityID,
+			Before:    entry.Before,
+			After:     entry.After,
+			CreatedAt: entry.CreatedAt,
+		})
+	}
+	return records, nil
+}
+
+// audit stores a record of actor performing action on the entity entityID which changed its state from before to
+// after, nil states are omitted. Operations are reported failed when they cannot be audited even though they were
+// performed, so that no unaudited change is reported successful.
+func (short *Shortener) audit(ctx context.Context, actor, action, entity, entityID string, before, after interface{}) error {
+	entry, err := modelstorage.NewAuditEntry(actor, action, entity, entityID, before, after)
+	if err != nil {
+		return err
+	}
+	return short.URLStorage.DumpAudit(ctx, []modelstorage.AuditEntry{entry})
+}
+
+// auditCreated stores records of userID creating links of entries the same way audit does.
+func (short *Shortener) auditCreated(ctx context.Context, userID string, entries []modelstorage.URLStorageEntry) error {
+	sURLs := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		sURLs = append(sURLs, entry.SURL)
+	}
+	return short.auditURLs(ctx, userID, modelurl.AuditCreate, sURLs, func(i int) (before, after interface{}) {
+		return nil, modelstorage.AuditURL(entries[i])
+	})
+}
+
+// auditURLs stores records of actor performing action on links sURLs at once the same way audit does, states returns
+// the states of the i-th link before and after the action.
+func (short *Shortener) auditURLs(ctx context.Context, actor, action string, sURLs []string, states func(i int) (before, after interface{})) error {
+	if len(sURLs) == 0 {
+		return nil
+	}
+	entries := make([]modelstorage.AuditEntry, 0, len(sURLs))
+	for i, sURL := range sURLs {
+		before, after := states(i)
+		entry, err := modelstorage.NewAuditEntry(actor, action, modelurl.AuditEntityURL, sURL, before, after)
+		if err != nil {
+			return err
+		}
+		entries = append(entries, entry)
+	}
+	return short.URLStorage.DumpAudit(ctx, entries)
+}
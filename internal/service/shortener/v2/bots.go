@@ -0,0 +1,64 @@
+package shortener
+
+import (
+	"net"
+	"strings"
+)
+
+// botAgentMarkers lists lower-case substrings of User-Agents of crawlers, link preview fetchers, monitoring and
+// automation tools.
+var botAgentMarkers = []string{
+	"bot",
+	"crawl",
+	"spider",
+	"slurp",
+	"facebookexternalhit",
+	"embedly",
+	"preview",
+	"headless",
+	"lighthouse",
+	"pingdom",
+	"uptime",
+	"monitor",
+	"curl/",
+	"wget/",
+	"python-requests",
+	"python-urllib",
+	"go-http-client",
+	"java/",
+	"okhttp",
+	"libwww-perl",
+	"httpclient",
+}
+
+// parseBotIPRanges parses CIDRs redirects are classified as ones of bots from, unparsable ones are reported by
+// configuration validation and skipped here.
+func parseBotIPRanges(ipRanges []string) []*net.IPNet {
+	var nets []*net.IPNet
+	for _, ipRange := range ipRanges {
+		_, ipNet, err := net.ParseCIDR(strings.TrimSpace(ipRange))
+		if err == nil {
+			nets = append(nets, ipNet)
+		}
+	}
+	return nets
+}
+
+// isBot reports whether a redirect requested with userAgent from ip is one of a bot: its User-Agent names a known kind
+// of bot or ip is within one of the configured bot IP ranges.
+func (short *Shortener) isBot(userAgent string, ip net.IP) bool {
+	agent := strings.ToLower(userAgent)
+	for _, marker := range botAgentMarkers {
+		if strings.Contains(agent, marker) {
+			return true
+		}
+	}
+	if ip != nil {
+		for _, ipNet := range short.botIPRanges {
+			if ipNet.Contains(ip) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,42 @@
+package shortener
+
+import (
+	"context"
+	"fmt"
+	serviceErrors "github.com/danilovkiri/dk_go_url_shortener/internal/service/errors"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/service/modelurl"
+	"strings"
+)
+
+// targetDevices lists visitor devices links can target.
+var targetDevices = map[string]bool{
+	modelurl.DeviceIOS:     true,
+	modelurl.DeviceAndroid: true,
+	modelurl.DeviceDesktop: true,
+}
+
+// normalizeDeviceTargets checks the devices and URLs of targets and returns them keyed by lower-case devices. App
+// deep link schemes must be allowed the same way schemes of shortened URLs are.
+func (short *Shortener) normalizeDeviceTargets(ctx context.Context, targets map[string]string) (map[string]string, error) {
+	if len(targets) == 0 {
+		return nil, nil
+	}
+	normalized := make(map[string]string, len(targets))
+	for device, URL := range targets {
+		name := strings.ToLower(device)
+		if !targetDevices[name] {
+			return nil, &serviceErrors.ServiceIncorrectInputDeviceTargets{
+				Msg: fmt.Sprintf("device %q is not supported, expected one of ios, android and desktop", device),
+			}
+		}
+		if _, ok := normalized[name]; ok {
+			return nil, &serviceErrors.ServiceIncorrectInputDeviceTargets{Msg: fmt.Sprintf("device %s is targeted twice", name)}
+		}
+		err := short.validateURL(ctx, URL)
+		if err != nil {
+			return nil, err
+		}
+		normalized[name] = URL
+	}
+	return normalized, nil
+}
@@ -0,0 +1,207 @@
+package shortener
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	serviceErrors "github.com/danilovkiri/dk_go_url_shortener/internal/service/errors"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/service/modelurl"
+	storageErrors "github.com/danilovkiri/dk_go_url_shortener/internal/storage/v2/errors"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/storage/v2/modelstorage"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/tracing"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// custom domain verification parameters: users publish a TXT record named with domainRecordPrefix followed by the
+// domain holding domainValuePrefix followed by the domain token
+const (
+	domainRecordPrefix = "_shortener-verify."
+	domainValuePrefix  = "shortener-verify="
+	domainTokenBytes   = 16
+	maxDomainLength    = 253
+)
+
+// domainLabelPattern matches one label of a lower-case host name.
+var domainLabelPattern = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?$`)
+
+// SetTXTLookup sets the function resolving DNS TXT records for custom domain verification, net.DefaultResolver is
+// used otherwise.
+func (short *Shortener) SetTXTLookup(lookup func(ctx context.Context, name string) ([]string, error)) {
+	short.lookupTXT = lookup
+}
+
+// AddDomain registers a claim of the custom domain name by userID, it serves the links of the user once it is verified
+// by VerifyDomain. Several users may claim a domain until one of them verifies it, DomainAlreadyExistsError is
+// reported for domains verified by any user or claimed by the user already.
+func (short *Shortener) AddDomain(ctx context.Context, userID, name string) (domain modelurl.Domain, err error) {
+	ctx, span := tracing.Start(ctx, "shortener.AddDomain", tracing.KindInternal)
+	defer func() { span.End(err) }()
+	name, err = normalizeDomain(name)
+	if err != nil {
+		return modelurl.Domain{}, err
+	}
+	token := make([]byte, domainTokenBytes)
+	_, err = rand.Read(token)
+	if err != nil {
+		return modelurl.Domain{}, err
+	}
+	entry := modelstorage.DomainEntry{
+		Name:      name,
+		UserID:    userID,
+		Token:     hex.EncodeToString(token),
+		CreatedAt: time.Now().UTC(),
+	}
+	err = short.URLStorage.DumpDomain(ctx, entry)
+	if err != nil {
+		return modelurl.Domain{}, err
+	}
+	err = short.audit(ctx, userID, modelurl.AuditCreate, modelurl.AuditEntityDomain, entry.Name, nil, entry)
+	if err != nil {
+		return modelurl.Domain{}, err
+	}
+	return toDomain(entry), nil
+}
+
+// ListDomains returns custom domains of userID sorted by creation time.
+func (short *Shortener) ListDomains(ctx context.Context, userID string) (domains []modelurl.Domain, err error) {
+	ctx, span := tracing.Start(ctx, "shortener.ListDomains", tracing.KindInternal)
+	defer func() { span.End(err) }()
+	entries, err := short.URLStorage.RetrieveDomainsByUserID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	domains = make([]modelurl.Domain, 0, len(entries))
+	for _, entry := range entries {
+		domains = append(domains, toDomain(entry))
+	}
+	return domains, nil
+}
+
+// VerifyDomain looks the verification TXT record of the custom domain name claimed by userID up and marks the domain
+// verified once it holds the token of the claim, ServiceDomainNotVerified is reported otherwise. Claims of the domain
+// by other users are dropped then. Domains the user has not claimed or whose claim expired are reported with
+// DomainNotFoundError.
+func (short *Shortener) VerifyDomain(ctx context.Context, userID, name string) (domain modelurl.Domain, err error) {
+	ctx, span := tracing.Start(ctx, "shortener.VerifyDomain", tracing.KindInternal)
+	defer func() { span.End(err) }()
+	name, err = normalizeDomain(name)
+	if err != nil {
+		return modelurl.Domain{}, err
+	}
+	entry, err := short.URLStorage.RetrieveDomainClaim(ctx, name, userID)
+	if err != nil {
+		return modelurl.Domain{}, err
+	}
+	if entry.VerifiedAt != nil {
+		return toDomain(entry), nil
+	}
+	domain = toDomain(entry)
+	records, err := short.lookupTXT(ctx, domain.VerificationRecord)
+	if err != nil {
+		return modelurl.Domain{}, &serviceErrors.ServiceDomainNotVerified{
+			Msg: fmt.Sprintf("looking TXT record %s up: %s", domain.VerificationRecord, err),
+		}
+	}
+	verified := false
+	for _, record := range records {
+		if strings.TrimSpace(record) == domain.VerificationValue {
+			verified = true
+			break
+		}
+	}
+	if !verified {
+		return modelurl.Domain{}, &serviceErrors.ServiceDomainNotVerified{
+			Msg: fmt.Sprintf("TXT record %s does not hold %s", domain.VerificationRecord, domain.VerificationValue),
+		}
+	}
+	err = short.URLStorage.VerifyDomain(ctx, name, userID)
+	if err != nil {
+		return modelurl.Domain{}, err
+	}
+	short.verified.add(name)
+	verifiedAt := time.Now().UTC()
+	domain.VerifiedAt = &verifiedAt
+	verifiedEntry := entry
+	verifiedEntry.VerifiedAt = &verifiedAt
+	err = short.audit(ctx, userID, modelurl.AuditUpdate, modelurl.AuditEntityDomain, name, entry, verifiedEntry)
+	if err != nil {
+		return modelurl.Domain{}, err
+	}
+	return domain, nil
+}
+
+// ResolveDomain returns the verified custom domain serving requests sent to host, it is empty for hosts which are not
+// custom domains so that they serve links of the base URL.
+func (short *Shortener) ResolveDomain(ctx context.Context, host string) (domain string, err error) {
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	if host == "" {
+		return "", nil
+	}
+	entry, err := short.URLStorage.RetrieveDomain(ctx, host)
+	if err != nil {
+		var domainNotFoundError *storageErrors.DomainNotFoundError
+		if errors.As(err, &domainNotFoundError) {
+			return "", nil
+		}
+		return "", err
+	}
+	return entry.Name, nil
+}
+
+// userDomain checks that the custom domain name is registered and verified by userID and returns it normalized.
+func (short *Shortener) userDomain(ctx context.Context, userID, name string) (string, error) {
+	if name == "" {
+		return "", nil
+	}
+	name, err := normalizeDomain(name)
+	if err != nil {
+		return "", err
+	}
+	entry, err := short.URLStorage.RetrieveDomainClaim(ctx, name, userID)
+	if err != nil {
+		var domainNotFoundError *storageErrors.DomainNotFoundError
+		if !errors.As(err, &domainNotFoundError) {
+			return "", err
+		}
+		return "", &serviceErrors.ServiceIncorrectInputDomain{Msg: fmt.Sprintf("domain %s is not registered by the user", name)}
+	}
+	if entry.VerifiedAt == nil {
+		return "", &serviceErrors.ServiceIncorrectInputDomain{Msg: fmt.Sprintf("domain %s is not verified yet", name)}
+	}
+	return name, nil
+}
+
+// normalizeDomain checks that name is a fully qualified host name and returns it in lower case without a trailing
+// dot.
+func normalizeDomain(name string) (string, error) {
+	name = strings.TrimSuffix(strings.ToLower(strings.TrimSpace(name)), ".")
+	if name == "" || len(name) > maxDomainLength {
+		return "", &serviceErrors.ServiceIncorrectInputDomain{Msg: fmt.Sprintf("domain %q is not a valid host name", name)}
+	}
+	labels := strings.Split(name, ".")
+	// top-level domains are never numeric, which also rules IPv4 addresses out
+	if len(labels) < 2 || strings.Trim(labels[len(labels)-1], "0123456789") == "" {
+		return "", &serviceErrors.ServiceIncorrectInputDomain{Msg: fmt.Sprintf("domain %q is not a fully qualified host name", name)}
+	}
+	for _, label := range labels {
+		if !domainLabelPattern.MatchString(label) {
+			return "", &serviceErrors.ServiceIncorrectInputDomain{Msg: fmt.Sprintf("domain %q is not a valid host name", name)}
+		}
+	}
+	return name, nil
+}
+
+// toDomain converts a stored custom domain along with its verification record.
+func toDomain(entry modelstorage.DomainEntry) modelurl.Domain {
+	return modelurl.Domain{
+		Name:               entry.Name,
+		VerificationRecord: domainRecordPrefix + entry.Name,
+		VerificationValue:  domainValuePrefix + entry.Token,
+		CreatedAt:          entry.CreatedAt,
+		VerifiedAt:         entry.VerifiedAt,
+	}
+}
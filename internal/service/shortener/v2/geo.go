@@ -0,0 +1,85 @@
+package shortener
+
+import (
+	"context"
+	"fmt"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/geoip"
+	serviceErrors "github.com/danilovkiri/dk_go_url_shortener/internal/service/errors"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/service/modelurl"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/tracing"
+	"net"
+	"regexp"
+	"strings"
+)
+
+// maxGeoTargets limits the number of countries a link can target.
+const maxGeoTargets = 50
+
+// countryCodePattern matches ISO 3166-1 alpha-2 country codes.
+var countryCodePattern = regexp.MustCompile(`^[A-Z]{2}$`)
+
+// SetGeoIP sets reader resolving visitor countries for geo-targeted redirects and country breakdowns, links redirect to
+// their default URLs and visitor countries are left unknown when it is nil.
+func (short *Shortener) SetGeoIP(reader *geoip.Reader) {
+	short.geo = reader
+}
+
+// normalizeGeoTargets checks the country codes and URLs of targets and returns them keyed by upper-case codes.
+func (short *Shortener) normalizeGeoTargets(ctx context.Context, targets map[string]string) (map[string]string, error) {
+	if len(targets) == 0 {
+		return nil, nil
+	}
+	if len(targets) > maxGeoTargets {
+		return nil, &serviceErrors.ServiceIncorrectInputGeoTargets{
+			Msg: fmt.Sprintf("a link can target at most %d countries, got %d", maxGeoTargets, len(targets)),
+		}
+	}
+	normalized := make(map[string]string, len(targets))
+	for country, URL := range targets {
+		code := strings.ToUpper(country)
+		if !countryCodePattern.MatchString(code) {
+			return nil, &serviceErrors.ServiceIncorrectInputGeoTargets{
+				Msg: fmt.Sprintf("%q is not an ISO 3166-1 alpha-2 country code", country),
+			}
+		}
+		if _, ok := normalized[code]; ok {
+			return nil, &serviceErrors.ServiceIncorrectInputGeoTargets{Msg: fmt.Sprintf("country %s is targeted twice", code)}
+		}
+		err := short.validateURL(ctx, URL)
+		if err != nil {
+			return nil, err
+		}
+		normalized[code] = URL
+	}
+	return normalized, nil
+}
+
+// geoTarget returns the URL targets map the country of ip to, lookup failures fall back to the default URL.
+func (short *Shortener) geoTarget(targets map[string]string, ip net.IP) (string, bool) {
+	if len(targets) == 0 {
+		return "", false
+	}
+	country, err := short.geo.Country(ip)
+	if err != nil || country == "" {
+		return "", false
+	}
+	URL, ok := targets[country]
+	return URL, ok
+}
+
+// visitorCountry returns the country code of ip recorded with redirects, lookup failures leave it unknown.
+func (short *Shortener) visitorCountry(ip net.IP) string {
+	country, err := short.geo.Country(ip)
+	if err != nil {
+		return ""
+	}
+	return country
+}
+
+// Countries returns redirect counts of sURL per visitor country along with the number of redirects of visitors whose
+// country was not resolved. Redirects of bots are only counted with includeBots.
+func (short *Shortener) Countries(ctx context.Context, sURL string, includeBots bool) (stats modelurl.CountryStats, err error) {
+	ctx, span := tracing.Start(ctx, "shortener.Countries", tracing.KindInternal)
+	defer func() { span.End(err) }()
+	return short.URLStorage.RetrieveCountries(ctx, sURL, includeBots)
+}
@@ -0,0 +1,169 @@
+package shortener
+
+import (
+	"context"
+	"fmt"
+	serviceErrors "github.com/danilovkiri/dk_go_url_shortener/internal/service/errors"
+	"golang.org/x/net/idna"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// SetBaseURL sets the base URL short links are served at, URLs pointing back at it are not shortened and links
+// redirecting to it fail with ServiceRedirectLoop.
+func (short *Shortener) SetBaseURL(baseURL string) {
+	u, err := url.Parse(baseURL)
+	if err != nil || u.Host == "" {
+		return
+	}
+	short.validator.baseHost = hostPort(u)
+}
+
+// hostPort returns the lower-cased host of u along with its port unless it is the default one of the scheme.
+func hostPort(u *url.URL) string {
+	host := strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+	port := u.Port()
+	if port == "" || port == defaultPorts[strings.ToLower(u.Scheme)] {
+		return host
+	}
+	return host + ":" + port
+}
+
+// asciiHost returns the lower-cased punycode host of u, false if u has no host or it fails to convert.
+func asciiHost(u *url.URL) (string, bool) {
+	if u.Host == "" {
+		return "", false
+	}
+	host := strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+	if !isASCIIDomain(host) {
+		ascii, err := idna.Lookup.ToASCII(host)
+		if err != nil {
+			return "", false
+		}
+		host = ascii
+	}
+	return host, true
+}
+
+// pointsAtShortener reports whether u is a URL at the base URL, at custom domain (empty for the base URL) or at one of
+// the configured domains of other URL shorteners.
+func (v *urlValidator) pointsAtShortener(u *url.URL, domain string) bool {
+	if u.Host == "" {
+		return false
+	}
+	if v.baseHost != "" && hostPort(u) == v.baseHost {
+		return true
+	}
+	host, ok := asciiHost(u)
+	if !ok {
+		return false
+	}
+	return domain != "" && host == domain || matchDomain(host, v.shortenerDomains)
+}
+
+// verifiedDomainsTTL bounds the time verified custom domains are cached in memory for, domains verified or erased
+// through other instances of the service are learnt of once it passes.
+const verifiedDomainsTTL = time.Minute
+
+// verifiedDomains caches names of verified custom domains so that redirects check their destinations without a
+// storage round-trip. Domains verified through the instance are added at once and erasures drop the cache.
+type verifiedDomains struct {
+	load func(ctx context.Context) ([]string, error)
+	// reloading is set while a stale cache is being reloaded, the stale one is served meanwhile
+	reloading int32
+
+	mu sync.RWMutex
+	// names is replaced rather than modified, so that it is read without the lock once taken
+	names    map[string]bool
+	loadedAt time.Time
+}
+
+// contains reports whether name is a verified custom domain, the cache is loaded on first use and reloaded once stale.
+// Failing reloads keep the stale cache.
+func (d *verifiedDomains) contains(ctx context.Context, name string) (bool, error) {
+	d.mu.RLock()
+	names, stale := d.names, time.Since(d.loadedAt) >= verifiedDomainsTTL
+	d.mu.RUnlock()
+	if !stale {
+		return names[name], nil
+	}
+	if names != nil {
+		if !atomic.CompareAndSwapInt32(&d.reloading, 0, 1) {
+			return names[name], nil
+		}
+		defer atomic.StoreInt32(&d.reloading, 0)
+	}
+	loaded, err := d.load(ctx)
+	if err != nil {
+		if names != nil {
+			return names[name], nil
+		}
+		return false, err
+	}
+	names = make(map[string]bool, len(loaded))
+	for _, verified := range loaded {
+		names[verified] = true
+	}
+	d.mu.Lock()
+	d.names, d.loadedAt = names, time.Now()
+	d.mu.Unlock()
+	return names[name], nil
+}
+
+// add records name verified through the instance.
+func (d *verifiedDomains) add(name string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.names == nil {
+		return
+	}
+	names := make(map[string]bool, len(d.names)+1)
+	for verified := range d.names {
+		names[verified] = true
+	}
+	names[name] = true
+	d.names = names
+}
+
+// invalidate makes the next check reload the cache, e.g. once domains are erased.
+func (d *verifiedDomains) invalidate() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.loadedAt = time.Time{}
+}
+
+// pointsAtCustomDomain reports whether u is a URL at a verified custom domain of any user, since links of every
+// custom domain are served by this URL shortener.
+func (short *Shortener) pointsAtCustomDomain(ctx context.Context, u *url.URL) (bool, error) {
+	host, ok := asciiHost(u)
+	if !ok || hostIP(host) != nil {
+		return false, nil
+	}
+	return short.verified.contains(ctx, host)
+}
+
+// checkLoop reports ServiceRedirectLoop if link sURL served on domain redirects to URL pointing back at this or
+// another URL shortener, e.g. one shortened before the base URL or the shortener domains were changed or before its
+// custom domain was verified.
+func (short *Shortener) checkLoop(ctx context.Context, sURL, domain, URL string) error {
+	u, err := url.Parse(URL)
+	if err != nil {
+		return nil
+	}
+	loop := short.validator.pointsAtShortener(u, domain)
+	if !loop {
+		loop, err = short.pointsAtCustomDomain(ctx, u)
+		if err != nil {
+			return err
+		}
+	}
+	if !loop {
+		return nil
+	}
+	return &serviceErrors.ServiceRedirectLoop{
+		Msg: fmt.Sprintf("link %q redirects to %q of a URL shortener, redirect chains are not followed", sURL, URL),
+	}
+}
@@ -0,0 +1,156 @@
+package shortener
+
+import (
+	"github.com/danilovkiri/dk_go_url_shortener/internal/config"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/service/modelurl"
+	"net/url"
+	"strings"
+)
+
+// defaultPorts maps schemes normalized URLs may have to their default ports.
+var defaultPorts = map[string]string{"http": "80", "https": "443"}
+
+// urlNormalizer canonicalizes http(s) URLs before they are stored, so that URLs differing only in their form are
+// shortened once. A nil urlNormalizer leaves URLs as they are.
+type urlNormalizer struct {
+	trailingSlash string
+	// stripParams lists names of query parameters removed from URLs, names ending with '*' match by prefix
+	stripParams []string
+}
+
+// newURLNormalizer returns a urlNormalizer configured by cfg, nil if normalization is disabled.
+func newURLNormalizer(cfg *config.ShortenerConfig) *urlNormalizer {
+	if !cfg.NormalizeURLs {
+		return nil
+	}
+	normalizer := &urlNormalizer{trailingSlash: cfg.NormalizeTrailingSlash}
+	for _, param := range cfg.NormalizeStripParams {
+		param = strings.TrimSpace(param)
+		if param != "" {
+			normalizer.stripParams = append(normalizer.stripParams, param)
+		}
+	}
+	return normalizer
+}
+
+// normalize returns the canonical form of an http(s) URL: its scheme and host are lower-cased, the default port of the
+// scheme and configured query parameters are removed, an empty path becomes "/" and trailing slashes of other paths
+// follow the configured policy. The query keeps the order and encoding of remaining parameters. Other URLs and ones
+// failing to parse are returned unchanged to be validated as they are.
+func (n *urlNormalizer) normalize(URL string) string {
+	if n == nil {
+		return URL
+	}
+	u, err := url.Parse(URL)
+	if err != nil || u.Opaque != "" {
+		return URL
+	}
+	u.Scheme = strings.ToLower(u.Scheme)
+	port, ok := defaultPorts[u.Scheme]
+	if !ok || u.Host == "" {
+		return URL
+	}
+	u.Host = strings.ToLower(u.Host)
+	if u.Port() == port {
+		u.Host = u.Hostname()
+		// IPv6 hosts keep their brackets
+		if strings.Contains(u.Host, ":") {
+			u.Host = "[" + u.Host + "]"
+		}
+	}
+	switch {
+	case u.Path == "":
+		u.Path, u.RawPath = "/", ""
+	case u.Path == "/":
+	case n.trailingSlash == modelurl.TrailingSlashStrip:
+		u.Path = strings.TrimRight(u.Path, "/")
+		u.RawPath = strings.TrimRight(u.RawPath, "/")
+		if u.Path == "" {
+			u.Path, u.RawPath = "/", ""
+		}
+	case n.trailingSlash == modelurl.TrailingSlashAdd && !strings.HasSuffix(u.Path, "/"):
+		u.Path += "/"
+		if u.RawPath != "" {
+			u.RawPath += "/"
+		}
+	}
+	u.RawQuery = n.stripQuery(u.RawQuery)
+	u.ForceQuery = false
+	return u.String()
+}
+
+// stripQuery removes configured parameters from a raw query keeping the order and encoding of other ones.
+func (n *urlNormalizer) stripQuery(rawQuery string) string {
+	if rawQuery == "" || len(n.stripParams) == 0 {
+		return rawQuery
+	}
+	params := strings.Split(rawQuery, "&")
+	kept := params[:0]
+	for _, param := range params {
+		if param == "" {
+			continue
+		}
+		name := param
+		if i := strings.IndexByte(param, '='); i >= 0 {
+			name = param[:i]
+		}
+		if unescaped, err := url.QueryUnescape(name); err == nil {
+			name = unescaped
+		}
+		if !n.strips(name) {
+			kept = append(kept, param)
+		}
+	}
+	return strings.Join(kept, "&")
+}
+
+// strips reports whether the query parameter name is configured to be removed.
+func (n *urlNormalizer) strips(name string) bool {
+	for _, param := range n.stripParams {
+		if prefix := strings.TrimSuffix(param, "*"); prefix != param {
+			if strings.HasPrefix(name, prefix) {
+				return true
+			}
+		} else if name == param {
+			return true
+		}
+	}
+	return false
+}
+
+// normalizeDestinations returns destinations with their URLs normalized, destinations are not modified.
+func (n *urlNormalizer) normalizeDestinations(destinations []modelurl.Destination) []modelurl.Destination {
+	if n == nil || len(destinations) == 0 {
+		return destinations
+	}
+	normalized := make([]modelurl.Destination, len(destinations))
+	for i, destination := range destinations {
+		normalized[i] = modelurl.Destination{URL: n.normalize(destination.URL), Weight: destination.Weight}
+	}
+	return normalized
+}
+
+// normalizeAll returns URLs normalized, URLs are not modified.
+func (n *urlNormalizer) normalizeAll(URLs []string) []string {
+	if n == nil {
+		return URLs
+	}
+	normalized := make([]string, len(URLs))
+	for i, URL := range URLs {
+		normalized[i] = n.normalize(URL)
+	}
+	return normalized
+}
+
+// normalizeRows returns import rows with their URLs normalized, rows are not modified.
+func (n *urlNormalizer) normalizeRows(rows []modelurl.ImportRow) []modelurl.ImportRow {
+	if n == nil {
+		return rows
+	}
+	normalized := make([]modelurl.ImportRow, len(rows))
+	for i, row := range rows {
+		row.URL = n.normalize(row.URL)
+		normalized[i] = row
+	}
+	return normalized
+}
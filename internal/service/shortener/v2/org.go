@@ -0,0 +1,265 @@
+package shortener
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	serviceErrors "github.com/danilovkiri/dk_go_url_shortener/internal/service/errors"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/service/modelurl"
+	storageErrors "github.com/danilovkiri/dk_go_url_shortener/internal/storage/v2/errors"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/storage/v2/modelstorage"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/tracing"
+	"github.com/google/uuid"
+	"strings"
+	"time"
+)
+
+const maxOrgNameLength = 64
+
+// CreateOrg creates an organization named name with userID as its only admin.
+func (short *Shortener) CreateOrg(ctx context.Context, userID, name string) (org modelurl.Org, err error) {
+	ctx, span := tracing.Start(ctx, "shortener.CreateOrg", tracing.KindInternal)
+	defer func() { span.End(err) }()
+	name = strings.TrimSpace(name)
+	if name == "" || len(name) > maxOrgNameLength {
+		return modelurl.Org{}, &serviceErrors.ServiceIncorrectInputOrg{
+			Msg: fmt.Sprintf("organization name must be 1 to %d characters long", maxOrgNameLength),
+		}
+	}
+	now := time.Now().UTC()
+	entry := modelstorage.OrgEntry{ID: uuid.New().String(), Name: name, CreatedAt: now}
+	admin := modelstorage.MemberEntry{OrgID: entry.ID, UserID: userID, Role: modelurl.RoleAdmin, CreatedAt: now}
+	err = short.URLStorage.DumpOrg(ctx, entry, admin)
+	if err != nil {
+		return modelurl.Org{}, err
+	}
+	err = short.audit(ctx, userID, modelurl.AuditCreate, modelurl.AuditEntityOrg, entry.ID, nil, entry)
+	if err != nil {
+		return modelurl.Org{}, err
+	}
+	return toOrg(entry, admin.Role), nil
+}
+
+// ListOrgs returns organizations userID is a member of sorted by the time the user joined them.
+func (short *Shortener) ListOrgs(ctx context.Context, userID string) (orgs []modelurl.Org, err error) {
+	ctx, span := tracing.Start(ctx, "shortener.ListOrgs", tracing.KindInternal)
+	defer func() { span.End(err) }()
+	memberships, err := short.URLStorage.RetrieveMembershipsByUserID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	orgs = make([]modelurl.Org, 0, len(memberships))
+	for _, membership := range memberships {
+		entry, err := short.URLStorage.RetrieveOrg(ctx, membership.OrgID)
+		if err != nil {
+			return nil, err
+		}
+		orgs = append(orgs, toOrg(entry, membership.Role))
+	}
+	return orgs, nil
+}
+
+// ListMembers returns members of the organization orgID sorted by the time they joined it, only its members may list
+// them.
+func (short *Shortener) ListMembers(ctx context.Context, userID, orgID string) (members []modelurl.Member, err error) {
+	ctx, span := tracing.Start(ctx, "shortener.ListMembers", tracing.KindInternal)
+	defer func() { span.End(err) }()
+	entries, err := short.orgMembers(ctx, userID, orgID, false)
+	if err != nil {
+		return nil, err
+	}
+	members = make([]modelurl.Member, 0, len(entries))
+	for _, entry := range entries {
+		members = append(members, toMember(entry))
+	}
+	return members, nil
+}
+
+// SetMember adds the registered user login to the organization orgID with role, RoleMember by default, or changes the
+// role of an existing member. Only admins may manage membership and the last admin may not be demoted.
+func (short *Shortener) SetMember(ctx context.Context, userID, orgID, login, role string) (member modelurl.Member, err error) {
+	ctx, span := tracing.Start(ctx, "shortener.SetMember", tracing.KindInternal)
+	defer func() { span.End(err) }()
+	if role == "" {
+		role = modelurl.RoleMember
+	}
+	if role != modelurl.RoleAdmin && role != modelurl.RoleMember {
+		return modelurl.Member{}, &serviceErrors.ServiceIncorrectInputOrg{
+			Msg: fmt.Sprintf("role must be either %s or %s", modelurl.RoleAdmin, modelurl.RoleMember),
+		}
+	}
+	entries, err := short.orgMembers(ctx, userID, orgID, true)
+	if err != nil {
+		return modelurl.Member{}, err
+	}
+	user, err := short.URLStorage.RetrieveUser(ctx, login)
+	if err != nil {
+		var userNotFoundError *storageErrors.UserNotFoundError
+		if errors.As(err, &userNotFoundError) {
+			return modelurl.Member{}, &serviceErrors.ServiceIncorrectInputOrg{Msg: fmt.Sprintf("user %s is not registered", login)}
+		}
+		return modelurl.Member{}, err
+	}
+	if role != modelurl.RoleAdmin && isLastAdmin(entries, user.UserID) {
+		return modelurl.Member{}, &serviceErrors.ServiceIncorrectInputOrg{Msg: "organization must keep at least one admin"}
+	}
+	entry := modelstorage.MemberEntry{
+		OrgID:     orgID,
+		UserID:    user.UserID,
+		Login:     user.Login,
+		Role:      role,
+		CreatedAt: time.Now().UTC(),
+	}
+	// existing members keep the time they joined
+	action := modelurl.AuditCreate
+	var before interface{}
+	for _, existing := range entries {
+		if existing.UserID == entry.UserID {
+			entry.CreatedAt = existing.CreatedAt
+			action, before = modelurl.AuditUpdate, existing
+		}
+	}
+	err = short.URLStorage.DumpMember(ctx, entry)
+	if err != nil {
+		return modelurl.Member{}, err
+	}
+	err = short.audit(ctx, userID, action, modelurl.AuditEntityMember, memberAuditID(orgID, entry.UserID), before, entry)
+	if err != nil {
+		return modelurl.Member{}, err
+	}
+	return toMember(entry), nil
+}
+
+// RemoveMember removes memberID from the organization orgID, admins may remove any member and members may leave the
+// organization themselves. The last admin may not be removed.
+func (short *Shortener) RemoveMember(ctx context.Context, userID, orgID, memberID string) (err error) {
+	ctx, span := tracing.Start(ctx, "shortener.RemoveMember", tracing.KindInternal)
+	defer func() { span.End(err) }()
+	entries, err := short.orgMembers(ctx, userID, orgID, memberID != userID)
+	if err != nil {
+		return err
+	}
+	if isLastAdmin(entries, memberID) {
+		return &serviceErrors.ServiceIncorrectInputOrg{Msg: "organization must keep at least one admin"}
+	}
+	err = short.URLStorage.DeleteMember(ctx, orgID, memberID)
+	if err != nil {
+		return err
+	}
+	var before interface{}
+	for _, entry := range entries {
+		if entry.UserID == memberID {
+			before = entry
+		}
+	}
+	return short.audit(ctx, userID, modelurl.AuditDelete, modelurl.AuditEntityMember, memberAuditID(orgID, memberID), before, nil)
+}
+
+// DecodeByOrgID retrieves and returns a page of sURL:URL pairs of the organization orgID sorted by creation time, only
+// its members may list them.
+func (short *Shortener) DecodeByOrgID(ctx context.Context, userID, orgID string, opts modelurl.ListOptions) (URLs []modelurl.FullURL, err error) {
+	ctx, span := tracing.Start(ctx, "shortener.DecodeByOrgID", tracing.KindInternal)
+	defer func() { span.End(err) }()
+	_, err = short.orgMembers(ctx, userID, orgID, false)
+	if err != nil {
+		return nil, err
+	}
+	URLs, err = short.URLStorage.RetrieveByOrgID(ctx, orgID, opts)
+	if err != nil {
+		return nil, err
+	}
+	return URLs, nil
+}
+
+// AuthorizeURL reports ServiceURLForbidden unless userID created sURL or is a member of the organization it belongs
+// to, unknown sURLs are reported by NotFoundError.
+func (short *Shortener) AuthorizeURL(ctx context.Context, sURL, userID string) (err error) {
+	ctx, span := tracing.Start(ctx, "shortener.AuthorizeURL", tracing.KindInternal)
+	defer func() { span.End(err) }()
+	ownerID, orgID, err := short.URLStorage.RetrieveOwner(ctx, sURL)
+	if err != nil {
+		return err
+	}
+	if ownerID == userID {
+		return nil
+	}
+	if orgID != "" {
+		_, err = short.orgMembers(ctx, userID, orgID, false)
+		if err == nil {
+			return nil
+		}
+		// links of organizations which are gone are only accessible to their creators
+		if !errors.As(err, new(*serviceErrors.ServiceOrgForbidden)) && !errors.As(err, new(*storageErrors.OrgNotFoundError)) {
+			return err
+		}
+	}
+	return &serviceErrors.ServiceURLForbidden{Msg: fmt.Sprintf("user has no access to URL %s", sURL)}
+}
+
+// userOrg checks that userID is a member of the organization orgID and returns it.
+func (short *Shortener) userOrg(ctx context.Context, userID, orgID string) (string, error) {
+	if orgID == "" {
+		return "", nil
+	}
+	_, err := short.orgMembers(ctx, userID, orgID, false)
+	if err != nil {
+		var orgNotFoundError *storageErrors.OrgNotFoundError
+		if errors.As(err, &orgNotFoundError) {
+			return "", &serviceErrors.ServiceIncorrectInputOrg{Msg: fmt.Sprintf("organization %s does not exist", orgID)}
+		}
+		return "", err
+	}
+	return orgID, nil
+}
+
+// orgMembers returns members of the organization orgID once userID is found among them, with the admin role if admin
+// is set, and reports ServiceOrgForbidden otherwise.
+func (short *Shortener) orgMembers(ctx context.Context, userID, orgID string, admin bool) ([]modelstorage.MemberEntry, error) {
+	_, err := short.URLStorage.RetrieveOrg(ctx, orgID)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := short.URLStorage.RetrieveMembers(ctx, orgID)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		if entry.UserID != userID {
+			continue
+		}
+		if admin && entry.Role != modelurl.RoleAdmin {
+			return nil, &serviceErrors.ServiceOrgForbidden{Msg: fmt.Sprintf("only admins manage organization %s", orgID)}
+		}
+		return entries, nil
+	}
+	return nil, &serviceErrors.ServiceOrgForbidden{Msg: fmt.Sprintf("user is not a member of organization %s", orgID)}
+}
+
+// memberAuditID returns the ID of the membership of userID in the organization orgID in audit records.
+func memberAuditID(orgID, userID string) string {
+	return orgID + "/" + userID
+}
+
+// isLastAdmin reports whether userID is the only admin among entries.
+func isLastAdmin(entries []modelstorage.MemberEntry, userID string) bool {
+	admins := 0
+	found := false
+	for _, entry := range entries {
+		if entry.Role != modelurl.RoleAdmin {
+			continue
+		}
+		admins++
+		found = found || entry.UserID == userID
+	}
+	return found && admins == 1
+}
+
+// toOrg converts a stored organization along with role of the current user in it.
+func toOrg(entry modelstorage.OrgEntry, role string) modelurl.Org {
+	return modelurl.Org{ID: entry.ID, Name: entry.Name, Role: role, CreatedAt: entry.CreatedAt}
+}
+
+// toMember converts a stored organization member.
+func toMember(entry modelstorage.MemberEntry) modelurl.Member {
+	return modelurl.Member{UserID: entry.UserID, Login: entry.Login, Role: entry.Role, CreatedAt: entry.CreatedAt}
+}
@@ -0,0 +1,55 @@
+package shortener
+
+import (
+	serviceErrors "github.com/danilovkiri/dk_go_url_shortener/internal/service/errors"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// maxLinkPasswordLength limits link passwords since bcrypt ignores password bytes beyond 72.
+const maxLinkPasswordLength = 72
+
+// validatePassword checks that a link password is not too long to be hashed entirely.
+func validatePassword(password string) error {
+	if len(password) > maxLinkPasswordLength {
+		return &serviceErrors.ServiceIncorrectInputPassword{Msg: "password must be at most 72 bytes long"}
+	}
+	return nil
+}
+
+// HashPassword checks a link password and returns its hash to be passed to Shorten as modelurl.ShortenOptions
+// PasswordHash, so that handlers hash passwords before their timeout budget starts. An empty password has an empty
+// hash.
+func (short *Shortener) HashPassword(password string) (string, error) {
+	err := validatePassword(password)
+	if err != nil {
+		return "", err
+	}
+	return hashPassword(password)
+}
+
+// hashPassword returns a bcrypt hash of a link password, an empty password leaves the link unprotected and has an
+// empty hash.
+func hashPassword(password string) (string, error) {
+	if password == "" {
+		return "", nil
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+// checkPassword verifies password against the hash of a link password, links without a hash are not protected.
+func checkPassword(hash, password string) error {
+	if hash == "" {
+		return nil
+	}
+	if password == "" {
+		return &serviceErrors.ServicePasswordRequired{Msg: "the link is protected with a password"}
+	}
+	if bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) != nil {
+		return &serviceErrors.ServiceInvalidPassword{Msg: "invalid password"}
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+package shortener
+
+import (
+	"context"
+	"errors"
+	storageErrors "github.com/danilovkiri/dk_go_url_shortener/internal/storage/v2/errors"
+	"time"
+)
+
+// checkTimeout bounds checking one pooled sURL against the storage the same way handlers bound storage calls.
+const checkTimeout = 500 * time.Millisecond
+
+// codePool keeps sURLs generated ahead of time and checked against the storage, so that shortening under load takes
+// a sURL which does not collide with existing entries instead of regenerating colliding ones. A nil codePool is empty.
+type codePool struct {
+	codes     chan string
+	threshold int
+	refill    chan struct{}
+}
+
+// take returns a pooled sURL and requests a refill once the pool runs low, ok is false when the pool is empty.
+func (p *codePool) take() (code string, ok bool) {
+	if p == nil {
+		return "", false
+	}
+	select {
+	case code = <-p.codes:
+		ok = true
+	default:
+	}
+	if len(p.codes) <= p.threshold {
+		select {
+		case p.refill <- struct{}{}:
+		default:
+		}
+	}
+	return code, ok
+}
+
+// StartCodePool keeps up to size checked sURLs ready for shortening, the pool is refilled in the background once it
+// holds threshold sURLs or fewer until ctx is done. sURLs are generated the usual way while the pool is empty, and
+// a pooled sURL may still collide with one taken by another instance in the meantime.
+func (short *Shortener) StartCodePool(ctx context.Context, size, threshold int) {
+	p := &codePool{
+		codes:     make(chan string, size),
+		threshold: threshold,
+		refill:    make(chan struct{}, 1),
+	}
+	p.refill <- struct{}{}
+	short.codes = p
+	go short.refillCodes(ctx, p)
+}
+
+// refillCodes fills p on every refill request until ctx is done, a round stops at the first failing check so that
+// the storage is not hammered while it is unavailable.
+func (short *Shortener) refillCodes(ctx context.Context, p *codePool) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-p.refill:
+		}
+		for len(p.codes) < cap(p.codes) && ctx.Err() == nil {
+			code, err := short.generateCode()
+			if err != nil {
+				break
+			}
+			taken, err := short.isTaken(ctx, code)
+			if err != nil {
+				break
+			}
+			if !taken {
+				p.codes <- code
+			}
+		}
+	}
+}
+
+// isTaken reports whether an entry with sURL code exists in the storage whatever its state.
+func (short *Shortener) isTaken(ctx context.Context, code string) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, checkTimeout)
+	defer cancel()
+	_, err := short.URLStorage.Retrieve(ctx, code)
+	var notFoundError *storageErrors.NotFoundError
+	var contextTimeoutExceededError *storageErrors.ContextTimeoutExceededError
+	switch {
+	case errors.As(err, &notFoundError):
+		return false, nil
+	case errors.As(err, &contextTimeoutExceededError):
+		return false, err
+	case err == nil || isEntryStateError(err):
+		return true, nil
+	}
+	return false, err
+}
+
+// isEntryStateError reports whether err is returned by Retrieve for an entry which exists but cannot be redirected to.
+func isEntryStateError(err error) bool {
+	var deletedError *storageErrors.DeletedError
+	var expiredError *storageErrors.ExpiredError
+	var disabledError *storageErrors.DisabledError
+	var exhaustedError *storageErrors.ExhaustedError
+	var notActiveError *storageErrors.NotActiveError
+	return errors.As(err, &deletedError) || errors.As(err, &expiredError) || errors.As(err, &disabledError) ||
+		errors.As(err, &exhaustedError) || errors.As(err, &notActiveError)
+}
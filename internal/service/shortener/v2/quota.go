@@ -0,0 +1,71 @@
+package shortener
+
+import (
+	"context"
+	serviceErrors "github.com/danilovkiri/dk_go_url_shortener/internal/service/errors"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/service/modelurl"
+	"sync"
+	"time"
+)
+
+// dailyCounter counts shortening requests per user within the current UTC day. Counts are kept in memory, so every
+// instance of the service counts requests it serves on its own and counts are reset on restart.
+type dailyCounter struct {
+	limit int
+
+	mu sync.Mutex
+	// day is the UTC day counts belong to
+	day    time.Time
+	counts map[string]int
+}
+
+// take counts a request of userID at now, it reports QuotaExceededError without counting the request when the limit
+// is reached. Zero limit counts nothing.
+func (c *dailyCounter) take(userID string, now time.Time) error {
+	if c.limit == 0 {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now = now.UTC()
+	day := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	if !day.Equal(c.day) {
+		c.day = day
+		c.counts = make(map[string]int)
+	}
+	if c.counts[userID] >= c.limit {
+		return &serviceErrors.QuotaExceededError{
+			Quota:      serviceErrors.QuotaDailyShortens,
+			Limit:      c.limit,
+			RetryAfter: day.AddDate(0, 0, 1).Sub(now),
+		}
+	}
+	c.counts[userID]++
+	return nil
+}
+
+// remainingLinks returns the number of links userID may still create or -1 when it is not limited, only as many links
+// of the user as the limit allows are read.
+func (short *Shortener) remainingLinks(ctx context.Context, userID string) (int, error) {
+	if short.maxLinks == 0 {
+		return -1, nil
+	}
+	URLs, err := short.URLStorage.RetrieveByUserID(ctx, userID, modelurl.ListOptions{Limit: short.maxLinks})
+	if err != nil {
+		return 0, err
+	}
+	return short.maxLinks - len(URLs), nil
+}
+
+// checkQuotas reports QuotaExceededError unless userID may create n more links and make one more shortening request,
+// the request is counted only when both quotas allow it.
+func (short *Shortener) checkQuotas(ctx context.Context, userID string, n int) error {
+	remaining, err := short.remainingLinks(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if remaining >= 0 && n > remaining {
+		return &serviceErrors.QuotaExceededError{Quota: serviceErrors.QuotaActiveLinks, Limit: short.maxLinks}
+	}
+	return short.shortens.take(userID, time.Now())
+}
@@ -0,0 +1,27 @@
+package shortener
+
+import (
+	"context"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/service/modelurl"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/tracing"
+	"net/url"
+	"strings"
+)
+
+// referrerDomain normalizes referrer to its lower-cased host name stripped of the www. prefix, referrers which are not
+// absolute URLs are treated as direct redirects and return an empty domain.
+func referrerDomain(referrer string) string {
+	u, err := url.Parse(referrer)
+	if err != nil || u.Host == "" {
+		return ""
+	}
+	return strings.TrimPrefix(strings.TrimSuffix(strings.ToLower(u.Hostname()), "."), "www.")
+}
+
+// Referrers returns up to limit referrer domains of sURL with the most redirects along with the number of direct
+// redirects. Redirects of bots are only counted with includeBots.
+func (short *Shortener) Referrers(ctx context.Context, sURL string, limit int, includeBots bool) (stats modelurl.ReferrerStats, err error) {
+	ctx, span := tracing.Start(ctx, "shortener.Referrers", tracing.KindInternal)
+	defer func() { span.End(err) }()
+	return short.URLStorage.RetrieveReferrers(ctx, sURL, limit, includeBots)
+}
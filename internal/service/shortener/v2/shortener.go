@@ -3,98 +3,792 @@ package shortener
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/config"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/geoip"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/safety"
 	serviceErrors "github.com/danilovkiri/dk_go_url_shortener/internal/service/errors"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/service/generator"
 	"github.com/danilovkiri/dk_go_url_shortener/internal/service/modelurl"
 	"github.com/danilovkiri/dk_go_url_shortener/internal/storage/v2"
+	storageErrors "github.com/danilovkiri/dk_go_url_shortener/internal/storage/v2/errors"
 	"github.com/danilovkiri/dk_go_url_shortener/internal/storage/v2/modelstorage"
-	"github.com/speps/go-hashids/v2"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/tracing"
+	"net"
+	"net/http"
 	"net/url"
+	"regexp"
+	"strings"
 	"time"
 )
 
 const SaltKey = "Some Hashing Key"
 const MinLength = 5
 
+// maxSearchTerms limits the number of words of user link search queries.
+const maxSearchTerms = 10
+
+// aliasPattern defines characters and length allowed for custom aliases.
+var aliasPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{3,64}$`)
+
+// reservedAliases lists path segments used by server routes which cannot be taken as custom aliases.
+var reservedAliases = map[string]bool{
+	"api":     true,
+	"ping":    true,
+	"metrics": true,
+	"healthz": true,
+	"readyz":  true,
+}
+
 // Shortener struct defines data structure handling and provides support for adding new implementations.
 type Shortener struct {
-	SaltKey    string
-	MinLength  int
-	hashID     *hashids.HashID
-	URLStorage storage.URLStorage
+	SaltKey      string
+	MinLength    int
+	generator    generator.Generator
+	codes        *codePool
+	idRetries    int
+	validator    *urlValidator
+	redirectType int
+	maxLinks     int
+	shortens     *dailyCounter
+	checker      *safety.Checker
+	geo          *geoip.Reader
+	botIPRanges  []*net.IPNet
+	normalizer   *urlNormalizer
+	lookupTXT    func(ctx context.Context, name string) ([]string, error)
+	verified     *verifiedDomains
+	URLStorage   storage.URLStorage
 }
 
 // InitShortener initializes a Shortener object and sets its attributes.
-func InitShortener(s storage.URLStorage) (*Shortener, error) {
+func InitShortener(s storage.URLStorage, cfg *config.ShortenerConfig) (*Shortener, error) {
 	if s == nil {
 		return nil, &serviceErrors.ServiceFoundNilStorage{Msg: "nil storage was passed to service initializer"}
 	}
-	hd := hashids.NewData()
-	hd.Salt = SaltKey
-	hd.MinLength = MinLength
-	hashID, err := hashids.NewWithData(hd)
+	// fall back to the historical hashids of MinLength for configurations built without environment defaults
+	strategy, length := cfg.IDGenerator, cfg.IDLength
+	if strategy == "" {
+		strategy = generator.StrategyHashids
+	}
+	if length == 0 {
+		length = MinLength
+	}
+	gen, err := generator.New(strategy, length, SaltKey)
 	if err != nil {
 		return nil, &serviceErrors.ServiceInitHashError{Msg: err.Error()}
 	}
+	// fall back to the historical 307 for configurations built without environment defaults
+	redirectType := cfg.RedirectType
+	if redirectType == 0 {
+		redirectType = http.StatusTemporaryRedirect
+	}
 	shortener := &Shortener{
-		SaltKey:    SaltKey,
-		MinLength:  MinLength,
-		hashID:     hashID,
-		URLStorage: s,
+		SaltKey:      SaltKey,
+		MinLength:    length,
+		generator:    gen,
+		idRetries:    cfg.IDRetries,
+		validator:    newURLValidator(cfg),
+		redirectType: redirectType,
+		maxLinks:     cfg.MaxLinksPerUser,
+		shortens:     &dailyCounter{limit: cfg.MaxShortensPerDay},
+		botIPRanges:  parseBotIPRanges(cfg.BotIPRanges),
+		normalizer:   newURLNormalizer(cfg),
+		lookupTXT:    net.DefaultResolver.LookupTXT,
+		verified:     &verifiedDomains{load: s.RetrieveVerifiedDomains},
+		URLStorage:   s,
 	}
 	return shortener, nil
 }
 
-// Encode generates a sURL, stores URL and sURL in a storage, and returns sURL.
-func (short *Shortener) Encode(ctx context.Context, URL string, userID string) (sURL string, err error) {
-	_, err = url.ParseRequestURI(URL)
+// SetSafetyChecker sets checker screening destination URLs before they are shortened, URLs are not screened when it is
+// nil.
+func (short *Shortener) SetSafetyChecker(checker *safety.Checker) {
+	short.checker = checker
+}
+
+// Shorten generates a sURL (or uses a custom alias if requested), stores URL and sURL with an optional expiration
+// time, activation time, redirect type, password, click limit, split destinations, geo and device targets, custom
+// domain, organization, tags and UTM parameters in a storage, and returns the link created. Links created without UTM
+// parameters are given the UTM defaults of the user, so that redirects need no lookup of them. URL and split
+// destinations are normalized first when URL normalization is enabled. A generated sURL colliding with an existing one
+// is regenerated up to the configured number of retries. QuotaExceededError is reported when per-user quotas do not
+// allow the request, ServiceUnsafeURL when the destination is found unsafe and ServiceOrgForbidden when the user is
+// not a member of the organization.
+func (short *Shortener) Shorten(ctx context.Context, URL string, userID string, opts modelurl.ShortenOptions) (link modelurl.Link, err error) {
+	ctx, span := tracing.Start(ctx, "shortener.Shorten", tracing.KindInternal)
+	defer func() { span.End(err) }()
+	URL = short.normalizer.normalize(URL)
+	opts.Destinations = short.normalizer.normalizeDestinations(opts.Destinations)
+	err = short.validateURL(ctx, URL)
+	if err != nil {
+		return modelurl.Link{}, err
+	}
+	err = short.validateDestinations(ctx, URL, opts.Destinations)
+	if err != nil {
+		return modelurl.Link{}, err
+	}
+	geoTargets, err := short.normalizeGeoTargets(ctx, opts.GeoTargets)
+	if err != nil {
+		return modelurl.Link{}, err
+	}
+	deviceTargets, err := short.normalizeDeviceTargets(ctx, opts.DeviceTargets)
+	if err != nil {
+		return modelurl.Link{}, err
+	}
+	domain, err := short.userDomain(ctx, userID, opts.Domain)
+	if err != nil {
+		return modelurl.Link{}, err
+	}
+	orgID, err := short.userOrg(ctx, userID, opts.Org)
+	if err != nil {
+		return modelurl.Link{}, err
+	}
+	tags, err := normalizeTags(opts.Tags)
+	if err != nil {
+		return modelurl.Link{}, err
+	}
+	utm, err := short.linkUTM(ctx, userID, opts.UTM)
+	if err != nil {
+		return modelurl.Link{}, err
+	}
+	// the first destination of split links is URL itself
+	URLs := []string{URL}
+	for i := 1; i < len(opts.Destinations); i++ {
+		URLs = append(URLs, opts.Destinations[i].URL)
+	}
+	for _, targetURL := range geoTargets {
+		URLs = append(URLs, targetURL)
+	}
+	for _, targetURL := range deviceTargets {
+		URLs = append(URLs, targetURL)
+	}
+	err = short.screen(ctx, URLs)
+	if err != nil {
+		return modelurl.Link{}, err
+	}
+	if opts.Alias != "" {
+		err = validateAlias(opts.Alias)
+		if err != nil {
+			return modelurl.Link{}, err
+		}
+	}
+	expiresAt, err := resolveExpiration(opts)
+	if err != nil {
+		return modelurl.Link{}, err
+	}
+	if opts.ActiveFrom != nil && expiresAt != nil && !opts.ActiveFrom.Before(*expiresAt) {
+		return modelurl.Link{}, &serviceErrors.ServiceIncorrectInputExpiration{
+			Msg: fmt.Sprintf("activation time %s is not before expiration time %s", opts.ActiveFrom.Format(time.RFC3339), expiresAt.Format(time.RFC3339)),
+		}
+	}
+	if opts.RedirectType != 0 && !modelurl.IsValidRedirectType(opts.RedirectType) {
+		return modelurl.Link{}, &serviceErrors.ServiceIncorrectInputRedirectType{
+			Msg: fmt.Sprintf("redirect type %d is not supported, expected one of 301, 302 and 307", opts.RedirectType),
+		}
+	}
+	err = validatePassword(opts.Password)
+	if err != nil {
+		return modelurl.Link{}, err
+	}
+	if opts.MaxClicks < 0 {
+		return modelurl.Link{}, &serviceErrors.ServiceIncorrectInputMaxClicks{
+			Msg: fmt.Sprintf("click limit %d must be positive", opts.MaxClicks),
+		}
+	}
+	redirectType := opts.RedirectType
+	if redirectType == 0 {
+		redirectType = short.redirectType
+	}
+	err = short.checkQuotas(ctx, userID, 1)
+	if err != nil {
+		return modelurl.Link{}, err
+	}
+	// hash the password once quotas allow the request since hashing is deliberately slow
+	passwordHash := opts.PasswordHash
+	if passwordHash == "" {
+		passwordHash, err = hashPassword(opts.Password)
+		if err != nil {
+			return modelurl.Link{}, err
+		}
+	}
+	entry := modelstorage.URLStorageEntry{
+		SURL:          opts.Alias,
+		URL:           URL,
+		UserID:        userID,
+		ExpiresAt:     expiresAt,
+		RedirectType:  opts.RedirectType,
+		PasswordHash:  passwordHash,
+		MaxClicks:     opts.MaxClicks,
+		ActiveFrom:    opts.ActiveFrom,
+		Destinations:  opts.Destinations,
+		Sticky:        opts.Sticky && len(opts.Destinations) > 0,
+		GeoTargets:    geoTargets,
+		DeviceTargets: deviceTargets,
+		Domain:        domain,
+		OrgID:         orgID,
+		Tags:          tags,
+		UTM:           utm,
+	}
+	for attempt := 0; ; attempt++ {
+		if opts.Alias == "" {
+			entry.SURL, err = short.generateSlug()
+			if err != nil {
+				return modelurl.Link{}, &serviceErrors.ServiceEncodingHashError{Msg: err.Error()}
+			}
+		}
+		err = short.URLStorage.Dump(ctx, entry)
+		if opts.Alias == "" && attempt < short.idRetries && isSURLCollision(err) {
+			continue
+		}
+		if err != nil {
+			return modelurl.Link{}, err
+		}
+		err = short.audit(ctx, userID, modelurl.AuditCreate, modelurl.AuditEntityURL, entry.SURL, nil, modelstorage.AuditURL(entry))
+		if err != nil {
+			return modelurl.Link{}, err
+		}
+		return modelurl.Link{
+			SURL:         entry.SURL,
+			URL:          entry.URL,
+			Domain:       entry.Domain,
+			ExpiresAt:    entry.ExpiresAt,
+			ActiveFrom:   entry.ActiveFrom,
+			RedirectType: redirectType,
+			MaxClicks:    entry.MaxClicks,
+			Tags:         entry.Tags,
+		}, nil
+	}
+}
+
+// Encode shortens URL the same way Shorten does and returns the sURL of the link created.
+func (short *Shortener) Encode(ctx context.Context, URL string, userID string, opts modelurl.ShortenOptions) (sURL string, err error) {
+	link, err := short.Shorten(ctx, URL, userID, opts)
+	return link.SURL, err
+}
+
+// EncodeBatch generates sURLs for a batch of URLs, stores them in a storage within one transaction, and returns
+// sURLs in the order of URLs; for URLs which already exist in a storage, normalized the same way Encode does, their
+// existing sURLs are returned. The whole batch is regenerated when any of its sURLs collides with an existing one. The
+// active links quota must allow all URLs of the batch, including ones which already exist.
+func (short *Shortener) EncodeBatch(ctx context.Context, URLs []string, userID string) (sURLs []string, err error) {
+	ctx, span := tracing.Start(ctx, "shortener.EncodeBatch", tracing.KindInternal)
+	defer func() { span.End(err) }()
+	URLs = short.normalizer.normalizeAll(URLs)
+	for _, URL := range URLs {
+		err = short.validateURL(ctx, URL)
+		if err != nil {
+			return nil, err
+		}
+	}
+	err = short.screen(ctx, URLs)
+	if err != nil {
+		return nil, err
+	}
+	err = short.checkQuotas(ctx, userID, len(URLs))
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]modelstorage.URLStorageEntry, len(URLs))
+	for attempt := 0; ; attempt++ {
+		for i, URL := range URLs {
+			sURL, err := short.generateSlug()
+			if err != nil {
+				return nil, &serviceErrors.ServiceEncodingHashError{Msg: err.Error()}
+			}
+			entries[i] = modelstorage.URLStorageEntry{SURL: sURL, URL: URL, UserID: userID}
+		}
+		stored, err := short.URLStorage.DumpBatch(ctx, entries)
+		if attempt < short.idRetries && isSURLCollision(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		sURLs = make([]string, 0, len(stored))
+		// URLs which were already shortened keep their existing sURLs and are not audited
+		var created []modelstorage.URLStorageEntry
+		for i, entry := range stored {
+			sURLs = append(sURLs, entry.SURL)
+			if i < len(entries) && entry.SURL == entries[i].SURL {
+				created = append(created, entry)
+			}
+		}
+		err = short.auditCreated(ctx, userID, created)
+		if err != nil {
+			return nil, err
+		}
+		return sURLs, nil
+	}
+}
+
+// Import generates sURLs (or uses custom aliases) for a batch of rows and stores them in a storage at once, returning
+// a result for every row in the order of rows. Invalid rows and rows whose alias is taken are reported in results
+// and do not prevent other rows from being stored, rows whose generated sURL is taken are retried with a new one; for
+// URLs which already exist in a storage their existing sURLs are returned. URLs are normalized the same way Encode does
+// and reported normalized. Every call counts as one shortening request, rows beyond the active links quota are
+// reported as not imported.
+func (short *Shortener) Import(ctx context.Context, rows []modelurl.ImportRow, userID string) (results []modelurl.ImportResult, err error) {
+	ctx, span := tracing.Start(ctx, "shortener.Import", tracing.KindInternal)
+	defer func() { span.End(err) }()
+	rows = short.normalizer.normalizeRows(rows)
+	err = short.shortens.take(userID, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	remaining, err := short.remainingLinks(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	// screen valid URLs at once, invalid rows are reported below
+	URLs := make([]string, 0, len(rows))
+	for _, row := range rows {
+		if short.validateURL(ctx, row.URL) == nil {
+			URLs = append(URLs, row.URL)
+		}
+	}
+	unsafe := short.checker.Unsafe(ctx, URLs)
+	results = make([]modelurl.ImportResult, len(rows))
+	entries := make([]modelstorage.URLStorageEntry, 0, len(rows))
+	// positions maps entries to their rows
+	positions := make([]int, 0, len(rows))
+	var created []modelstorage.URLStorageEntry
+	for i, row := range rows {
+		results[i].ImportRow = row
+		err = short.validateURL(ctx, row.URL)
+		if reason, ok := unsafe[row.URL]; err == nil && ok {
+			err = unsafeURL(row.URL, reason)
+		}
+		if err == nil && row.Alias != "" {
+			err = validateAlias(row.Alias)
+		}
+		if err != nil {
+			results[i].Error = err.Error()
+			continue
+		}
+		if remaining >= 0 && len(entries) == remaining {
+			results[i].Error = (&serviceErrors.QuotaExceededError{Quota: serviceErrors.QuotaActiveLinks, Limit: short.maxLinks}).Error()
+			continue
+		}
+		sURL := row.Alias
+		if sURL == "" {
+			sURL, err = short.generateSlug()
+			if err != nil {
+				return nil, &serviceErrors.ServiceEncodingHashError{Msg: err.Error()}
+			}
+		}
+		entries = append(entries, modelstorage.URLStorageEntry{SURL: sURL, URL: row.URL, UserID: userID})
+		positions = append(positions, i)
+	}
+	for attempt := 0; len(entries) > 0; attempt++ {
+		imported, err := short.URLStorage.ImportBatch(ctx, entries)
+		if err != nil {
+			return nil, err
+		}
+		// generated sURLs colliding with existing ones are retried, taken aliases are reported
+		var retryEntries []modelstorage.URLStorageEntry
+		var retryPositions []int
+		for j, res := range imported {
+			result := &results[positions[j]]
+			switch res.Status {
+			case modelstorage.ImportCreated:
+				result.SURL = res.Entry.SURL
+				created = append(created, res.Entry)
+			case modelstorage.ImportURLExists:
+				result.SURL = res.Entry.SURL
+				result.Existed = true
+			case modelstorage.ImportSURLTaken:
+				if result.Alias == "" && attempt < short.idRetries {
+					entry := res.Entry
+					entry.SURL, err = short.generateSlug()
+					if err != nil {
+						return nil, &serviceErrors.ServiceEncodingHashError{Msg: err.Error()}
+					}
+					retryEntries = append(retryEntries, entry)
+					retryPositions = append(retryPositions, positions[j])
+					continue
+				}
+				result.Error = fmt.Sprintf("short URL %q is already taken", res.Entry.SURL)
+			}
+		}
+		entries, positions = retryEntries, retryPositions
+	}
+	err = short.auditCreated(ctx, userID, created)
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// Decode retrieves and returns URL based on the given sURL as a key along with the redirect status code, the
+// globally configured one is used unless the link overrides it. Links are only found on the custom domain serving
+// them, domain is the one resolved by ResolveDomain for the requested host and empty for the base URL host. Password protected links are decoded only with their
+// password, ServicePasswordRequired is reported when password is empty and ServiceInvalidPassword when it is wrong.
+// Decoding does not count towards the click limit of a link, see Redirect.
+func (short *Shortener) Decode(ctx context.Context, sURL, domain, password string) (URL string, redirectType int, err error) {
+	ctx, span := tracing.Start(ctx, "shortener.Decode", tracing.KindInternal)
+	defer func() { span.End(err) }()
+	entry, err := short.decode(ctx, sURL, domain, password)
+	if err != nil {
+		return "", 0, err
+	}
+	return entry.URL, entry.RedirectType, nil
+}
+
+// Redirect decodes sURL the same way Decode does and counts the redirect towards the click limit of the link, links
+// which have reached their limit are reported with ExhaustedError. Visitors on a device or from a country the link
+// targets are redirected to the URL of their device or, failing that, of their country. Otherwise split links redirect
+// to one of their destinations picked by weight, sticky ones pick the same destination for every redirect of a visitor
+// with an ID. UTM parameters of the link are appended to the query of whichever destination is served. Destinations
+// pointing back at this or another URL shortener are reported with ServiceRedirectLoop and are not counted.
+func (short *Shortener) Redirect(ctx context.Context, sURL, domain, password string, visitor modelurl.Visitor) (redirect modelurl.Redirect, err error) {
+	ctx, span := tracing.Start(ctx, "shortener.Redirect", tracing.KindInternal)
+	defer func() { span.End(err) }()
+	entry, redirect, err := short.resolve(ctx, sURL, domain, password, visitor)
+	if err != nil {
+		return modelurl.Redirect{}, err
+	}
+	// only limited links are counted, so that redirects of others cost no additional storage round-trip
+	if entry.MaxClicks > 0 {
+		err = short.URLStorage.TakeClick(ctx, sURL)
+		if err != nil {
+			return modelurl.Redirect{}, err
+		}
+	}
+	return redirect, nil
+}
+
+// PeekRedirect returns the redirect of sURL the same way Redirect does without counting it towards the click limit of
+// the link, e.g. for HEAD requests checking the link.
+func (short *Shortener) PeekRedirect(ctx context.Context, sURL, domain, password string, visitor modelurl.Visitor) (redirect modelurl.Redirect, err error) {
+	ctx, span := tracing.Start(ctx, "shortener.PeekRedirect", tracing.KindInternal)
+	defer func() { span.End(err) }()
+	_, redirect, err = short.resolve(ctx, sURL, domain, password, visitor)
+	return redirect, err
+}
+
+// resolve decodes sURL and returns its entry along with the redirect visitor is served.
+func (short *Shortener) resolve(ctx context.Context, sURL, domain, password string, visitor modelurl.Visitor) (modelstorage.URLMapEntry, modelurl.Redirect, error) {
+	entry, err := short.retrieve(ctx, sURL, domain)
 	if err != nil {
-		return "", &serviceErrors.ServiceIncorrectInputURL{Msg: err.Error()}
+		return modelstorage.URLMapEntry{}, modelurl.Redirect{}, err
 	}
-	sURL, err = short.generateSlug()
+	URL := short.destination(sURL, entry, visitor)
+	// the loop is looked up before the password is compared since comparing is deliberately slow, wrong passwords are
+	// still reported first so that loops of protected links are not revealed
+	errLoop := short.checkLoop(ctx, sURL, domain, URL)
+	err = checkPassword(entry.PasswordHash, password)
 	if err != nil {
-		return "", &serviceErrors.ServiceEncodingHashError{Msg: err.Error()}
+		return modelstorage.URLMapEntry{}, modelurl.Redirect{}, err
+	}
+	if errLoop != nil {
+		return modelstorage.URLMapEntry{}, modelurl.Redirect{}, errLoop
 	}
-	err = short.URLStorage.Dump(ctx, URL, sURL, userID)
+	redirect := modelurl.Redirect{
+		URL:        appendUTM(URL, entry.UTM),
+		Type:       entry.RedirectType,
+		ModifiedAt: entry.CreatedAt,
+		Varying: len(entry.DeviceTargets) > 0 || len(entry.GeoTargets) > 0 || len(entry.Destinations) > 0 ||
+			entry.PasswordHash != "" || entry.MaxClicks > 0,
+	}
+	if entry.EditedAt != nil {
+		redirect.ModifiedAt = *entry.EditedAt
+	}
+	return entry, redirect, nil
+}
+
+// destination returns the URL of entry visitor is redirected to by its device and geo targets or split destinations.
+func (short *Shortener) destination(sURL string, entry modelstorage.URLMapEntry, visitor modelurl.Visitor) string {
+	if targetURL, ok := entry.DeviceTargets[visitor.Device]; ok {
+		return targetURL
+	}
+	if targetURL, ok := short.geoTarget(entry.GeoTargets, visitor.IP); ok {
+		return targetURL
+	}
+	if len(entry.Destinations) > 0 {
+		visitorID := visitor.ID
+		if !entry.Sticky {
+			visitorID = ""
+		}
+		return pickDestination(entry.Destinations, sURL, visitorID)
+	}
+	return entry.URL
+}
+
+// decode retrieves the entry of sURL served on domain checking its password and resolves its redirect type.
+func (short *Shortener) decode(ctx context.Context, sURL, domain, password string) (modelstorage.URLMapEntry, error) {
+	entry, err := short.retrieve(ctx, sURL, domain)
+	if err != nil {
+		return modelstorage.URLMapEntry{}, err
+	}
+	err = checkPassword(entry.PasswordHash, password)
 	if err != nil {
-		return "", err
+		return modelstorage.URLMapEntry{}, err
 	}
-	return sURL, nil
+	return entry, nil
 }
 
-// Decode retrieves and returns URL based on the given sURL as a key.
-func (short *Shortener) Decode(ctx context.Context, sURL string) (URL string, err error) {
-	URL, err = short.URLStorage.Retrieve(ctx, sURL)
+// retrieve retrieves the entry of sURL served on domain without checking its password and resolves its redirect type.
+func (short *Shortener) retrieve(ctx context.Context, sURL, domain string) (modelstorage.URLMapEntry, error) {
+	entry, err := short.URLStorage.Retrieve(ctx, sURL)
 	if err != nil {
-		return "", err
+		return modelstorage.URLMapEntry{}, err
+	}
+	// links of other domains are not revealed
+	if entry.Domain != domain {
+		return modelstorage.URLMapEntry{}, &storageErrors.NotFoundError{Err: nil, SURL: sURL}
+	}
+	if entry.RedirectType == 0 {
+		entry.RedirectType = short.redirectType
 	}
-	return URL, nil
+	return entry, nil
 }
 
-// Delete performs soft removal of URL-sURL entries with task management and resource allocation.
-func (short *Shortener) Delete(ctx context.Context, sURLs []string, userID string) {
-	for i := 0; i < len(sURLs); i++ {
-		item := modelstorage.URLChannelEntry{UserID: userID, SURL: sURLs[i]}
-		short.URLStorage.SendToQueue(item)
+// Delete queues soft removal of URL-sURL entries, it returns once the storage has accepted them for deletion. Storages
+// audit the entries once they are actually deleted.
+func (short *Shortener) Delete(ctx context.Context, sURLs []string, userID string) error {
+	items := make([]modelstorage.URLChannelEntry, 0, len(sURLs))
+	for _, sURL := range sURLs {
+		items = append(items, modelstorage.URLChannelEntry{UserID: userID, SURL: sURL})
 	}
+	return short.URLStorage.SendToQueue(ctx, items)
 }
 
-// DecodeByUserID retrieves and returns all pairs of sURL:URL for a given user ID.
-func (short *Shortener) DecodeByUserID(ctx context.Context, userID string) (URLs []modelurl.FullURL, err error) {
-	URLs, err = short.URLStorage.RetrieveByUserID(ctx, userID)
+// Restore un-deletes sURLs owned by userID and returns the ones which were deleted before.
+func (short *Shortener) Restore(ctx context.Context, sURLs []string, userID string) (restored []string, err error) {
+	ctx, span := tracing.Start(ctx, "shortener.Restore", tracing.KindInternal)
+	defer func() { span.End(err) }()
+	restored, err = short.URLStorage.RestoreBatch(ctx, sURLs, userID)
+	if err != nil {
+		return nil, err
+	}
+	err = short.auditURLs(ctx, userID, modelurl.AuditRestore, restored, func(i int) (before, after interface{}) {
+		return modelstorage.AuditedURL{SURL: restored[i], Deleted: true}, modelstorage.AuditedURL{SURL: restored[i]}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return restored, nil
+}
+
+// Edit changes the destination of sURL owned by userID to URL, which is normalized, validated and screened the same way
+// Encode does. Links of other users are reported with NotFoundError, the storage keeps the history of edits.
+func (short *Shortener) Edit(ctx context.Context, sURL, URL, userID string) (err error) {
+	ctx, span := tracing.Start(ctx, "shortener.Edit", tracing.KindInternal)
+	defer func() { span.End(err) }()
+	URL = short.normalizer.normalize(URL)
+	err = short.validateURL(ctx, URL)
+	if err != nil {
+		return err
+	}
+	err = short.screen(ctx, []string{URL})
+	if err != nil {
+		return err
+	}
+	previous, err := short.URLStorage.UpdateURL(ctx, sURL, userID, URL)
+	if err != nil {
+		return err
+	}
+	return short.audit(ctx, userID, modelurl.AuditUpdate, modelurl.AuditEntityURL, sURL,
+		modelstorage.AuditedURL{SURL: sURL, URL: previous}, modelstorage.AuditedURL{SURL: sURL, URL: URL})
+}
+
+// DecodeByUserID retrieves and returns a page of sURL:URL pairs for a given user ID sorted by creation time, a tag
+// set in opts restricts the page to links tagged with it.
+func (short *Shortener) DecodeByUserID(ctx context.Context, userID string, opts modelurl.ListOptions) (URLs []modelurl.FullURL, err error) {
+	ctx, span := tracing.Start(ctx, "shortener.DecodeByUserID", tracing.KindInternal)
+	defer func() { span.End(err) }()
+	if opts.Tag != "" {
+		opts.Tag, err = normalizeTag(opts.Tag)
+		if err != nil {
+			return nil, err
+		}
+	}
+	URLs, err = short.URLStorage.RetrieveByUserID(ctx, userID, opts)
+	if err != nil {
+		return nil, err
+	}
+	return URLs, nil
+}
+
+// SearchUserURLs returns a page of sURL:URL pairs of a given user having a word starting with each word of query in
+// their title, tags or URL ranked by relevance.
+func (short *Shortener) SearchUserURLs(ctx context.Context, userID, query string, opts modelurl.ListOptions) (URLs []modelurl.FullURL, err error) {
+	ctx, span := tracing.Start(ctx, "shortener.SearchUserURLs", tracing.KindInternal)
+	defer func() { span.End(err) }()
+	terms := modelstorage.SearchTerms(query)
+	if len(terms) == 0 || len(terms) > maxSearchTerms {
+		return nil, &serviceErrors.ServiceIncorrectInputQuery{
+			Msg: fmt.Sprintf("search query must have from 1 to %d words of letters and digits", maxSearchTerms),
+		}
+	}
+	URLs, err = short.URLStorage.SearchByUserID(ctx, userID, terms, opts)
 	if err != nil {
 		return nil, err
 	}
 	return URLs, nil
 }
 
+// Export passes all pairs of sURL:URL for a given user ID to fn one by one without collecting them in memory.
+func (short *Shortener) Export(ctx context.Context, userID string, fn func(URL modelurl.FullURL) error) (err error) {
+	ctx, span := tracing.Start(ctx, "shortener.Export", tracing.KindInternal)
+	defer func() { span.End(err) }()
+	return short.URLStorage.ExportByUserID(ctx, userID, fn)
+}
+
+// RecordClick sends a record of a successful redirect of visitor to destination to a storage for click analytics, the
+// referrer is recorded along with its normalized domain and the visitor along with its country. Redirects of bots are marked as such and left out of redirect
+// counts unless stats are asked for with bots included.
+func (short *Shortener) RecordClick(sURL, destination, referrer, userAgent string, visitor modelurl.Visitor) {
+	item := modelstorage.ClickEntry{
+		SURL:           sURL,
+		ClickedAt:      time.Now().UTC(),
+		Referrer:       referrer,
+		UserAgent:      userAgent,
+		Destination:    destination,
+		ReferrerDomain: referrerDomain(referrer),
+		Country:        short.visitorCountry(visitor.IP),
+		Bot:            short.isBot(userAgent, visitor.IP),
+	}
+	// bots are never counted as unique visitors
+	if !item.Bot {
+		item.VisitorKey = visitorKey(visitor, userAgent)
+	}
+	short.URLStorage.SendClick(item)
+}
+
+// visitorKey identifies visitor in unique visitor counts by the user cookie, visitors without one are told apart by
+// their IP and User-Agent.
+func visitorKey(visitor modelurl.Visitor, userAgent string) string {
+	if visitor.ID != "" {
+		return "user:" + visitor.ID
+	}
+	return "client:" + visitor.IP.String() + "|" + userAgent
+}
+
+// Stats retrieves and returns total, per-day and per-destination redirect counts along with unique visitor counts for
+// a given sURL. Redirects of bots are only counted with includeBots and are never counted as unique visitors.
+func (short *Shortener) Stats(ctx context.Context, sURL string, includeBots bool) (stats modelurl.URLStats, err error) {
+	ctx, span := tracing.Start(ctx, "shortener.Stats", tracing.KindInternal)
+	defer func() { span.End(err) }()
+	stats, err = short.URLStorage.RetrieveStats(ctx, sURL, includeBots)
+	if err != nil {
+		return modelurl.URLStats{}, err
+	}
+	return stats, nil
+}
+
+// ServiceStats retrieves and returns totals of stored URLs and their users.
+func (short *Shortener) ServiceStats(ctx context.Context) (stats modelurl.ServiceStats, err error) {
+	ctx, span := tracing.Start(ctx, "shortener.ServiceStats", tracing.KindInternal)
+	defer func() { span.End(err) }()
+	return short.URLStorage.RetrieveServiceStats(ctx)
+}
+
 func (short *Shortener) PingDB() error {
 	err := short.URLStorage.PingDB()
 	return err
 }
 
-// generateSlug generates and returns a short unique identifier for a string.
+// validateURL checks URL against the configured validation rules and reports URLs at verified custom domains, which
+// are served by this URL shortener.
+func (short *Shortener) validateURL(ctx context.Context, URL string) error {
+	err := short.validator.validate(URL)
+	if err != nil {
+		return err
+	}
+	// URL has already been parsed by the validator
+	u, _ := url.Parse(URL)
+	custom, err := short.pointsAtCustomDomain(ctx, u)
+	if err != nil {
+		return err
+	}
+	if custom {
+		return &serviceErrors.ServiceIncorrectInputURL{
+			Msg: fmt.Sprintf("URL %q points at a URL shortener, short links cannot be shortened again", URL),
+		}
+	}
+	return nil
+}
+
+// screen reports ServiceUnsafeURL for the first of URLs which must not be shortened.
+func (short *Shortener) screen(ctx context.Context, URLs []string) error {
+	unsafe := short.checker.Unsafe(ctx, URLs)
+	for _, URL := range URLs {
+		if reason, ok := unsafe[URL]; ok {
+			return unsafeURL(URL, reason)
+		}
+	}
+	return nil
+}
+
+// unsafeURL returns ServiceUnsafeURL for URL found unsafe for reason.
+func unsafeURL(URL, reason string) error {
+	return &serviceErrors.ServiceUnsafeURL{Msg: fmt.Sprintf("URL %q is not allowed: %s", URL, reason)}
+}
+
+// validateAlias checks that a custom alias consists of allowed characters and is not reserved.
+func validateAlias(alias string) error {
+	if !aliasPattern.MatchString(alias) {
+		return &serviceErrors.ServiceIncorrectInputAlias{
+			Msg: fmt.Sprintf("alias %q must be 3 to 64 characters long and contain only latin letters, digits, '-' and '_'", alias),
+		}
+	}
+	if reservedAliases[strings.ToLower(alias)] {
+		return &serviceErrors.ServiceIncorrectInputAlias{Msg: fmt.Sprintf("alias %q is reserved", alias)}
+	}
+	return nil
+}
+
+// resolveExpiration converts requested expiration options into an absolute expiration time, nil means no expiration.
+// The end of the activation window is another name of the expiration time.
+func resolveExpiration(opts modelurl.ShortenOptions) (*time.Time, error) {
+	expiresAt := opts.ExpiresAt
+	if opts.ActiveUntil != nil {
+		if expiresAt != nil {
+			return nil, &serviceErrors.ServiceIncorrectInputExpiration{Msg: "only one of expiration time and activation window end can be set"}
+		}
+		expiresAt = opts.ActiveUntil
+	}
+	switch {
+	case expiresAt != nil && opts.TTL != 0:
+		return nil, &serviceErrors.ServiceIncorrectInputExpiration{Msg: "only one of expiration time and TTL can be set"}
+	case expiresAt != nil:
+		if !expiresAt.After(time.Now()) {
+			return nil, &serviceErrors.ServiceIncorrectInputExpiration{
+				Msg: fmt.Sprintf("expiration time %s is not in the future", expiresAt.Format(time.RFC3339)),
+			}
+		}
+		return expiresAt, nil
+	case opts.TTL < 0:
+		return nil, &serviceErrors.ServiceIncorrectInputExpiration{Msg: fmt.Sprintf("TTL %s must be positive", opts.TTL)}
+	case opts.TTL > 0:
+		expiresAt := time.Now().Add(opts.TTL)
+		return &expiresAt, nil
+	}
+	return nil, nil
+}
+
+// generateSlug returns a pooled sURL, or generates one when the pool is empty.
 func (short *Shortener) generateSlug() (slug string, err error) {
-	now := time.Now().UnixNano()
-	slug, err = short.hashID.Encode([]int{int(now)})
-	return slug, err
+	if slug, ok := short.codes.take(); ok {
+		return slug, nil
+	}
+	return short.generateCode()
+}
+
+// generateCode generates and returns a short unique identifier for a string skipping reserved path segments.
+func (short *Shortener) generateCode() (slug string, err error) {
+	for {
+		slug, err = short.generator.Generate()
+		if err != nil || !reservedAliases[strings.ToLower(slug)] {
+			return slug, err
+		}
+	}
+}
+
+// isSURLCollision reports whether err is caused by a sURL which already exists in a storage.
+func isSURLCollision(err error) bool {
+	var sURLAlreadyExistsError *storageErrors.SURLAlreadyExistsError
+	return errors.As(err, &sURLAlreadyExistsError)
 }
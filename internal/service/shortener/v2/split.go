@@ -0,0 +1,73 @@
+package shortener
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	serviceErrors "github.com/danilovkiri/dk_go_url_shortener/internal/service/errors"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/service/modelurl"
+	"hash/fnv"
+	"math/big"
+)
+
+// split link limits
+const (
+	maxDestinations      = 10
+	maxDestinationWeight = 10000
+)
+
+// validateDestinations checks the destinations of a split link shortening URL, no destinations leave the link unsplit.
+func (short *Shortener) validateDestinations(ctx context.Context, URL string, destinations []modelurl.Destination) error {
+	if len(destinations) == 0 {
+		return nil
+	}
+	if len(destinations) < 2 || len(destinations) > maxDestinations {
+		return &serviceErrors.ServiceIncorrectInputDestinations{
+			Msg: fmt.Sprintf("a split link must have from 2 to %d destinations, got %d", maxDestinations, len(destinations)),
+		}
+	}
+	if destinations[0].URL != URL {
+		return &serviceErrors.ServiceIncorrectInputDestinations{Msg: "the shortened URL must be the first destination"}
+	}
+	seen := make(map[string]bool, len(destinations))
+	for _, destination := range destinations {
+		err := short.validateURL(ctx, destination.URL)
+		if err != nil {
+			return err
+		}
+		if seen[destination.URL] {
+			return &serviceErrors.ServiceIncorrectInputDestinations{Msg: fmt.Sprintf("destination %q is listed twice", destination.URL)}
+		}
+		seen[destination.URL] = true
+		if destination.Weight <= 0 || destination.Weight > maxDestinationWeight {
+			return &serviceErrors.ServiceIncorrectInputDestinations{
+				Msg: fmt.Sprintf("weight %d of destination %q must be from 1 to %d", destination.Weight, destination.URL, maxDestinationWeight),
+			}
+		}
+	}
+	return nil
+}
+
+// pickDestination returns one of destinations with a probability proportional to its weight. A non-empty visitor
+// always gets the same destination of sURL as long as destinations do not change.
+func pickDestination(destinations []modelurl.Destination, sURL, visitor string) string {
+	total := 0
+	for _, destination := range destinations {
+		total += destination.Weight
+	}
+	var point int
+	if visitor != "" {
+		h := fnv.New32a()
+		_, _ = h.Write([]byte(sURL + "\x00" + visitor))
+		point = int(h.Sum32() % uint32(total))
+	} else if n, err := rand.Int(rand.Reader, big.NewInt(int64(total))); err == nil {
+		point = int(n.Int64())
+	}
+	for _, destination := range destinations {
+		if point < destination.Weight {
+			return destination.URL
+		}
+		point -= destination.Weight
+	}
+	return destinations[len(destinations)-1].URL
+}
@@ -0,0 +1,98 @@
+package shortener
+
+import (
+	"context"
+	"fmt"
+	serviceErrors "github.com/danilovkiri/dk_go_url_shortener/internal/service/errors"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/service/modelurl"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/tracing"
+	"sort"
+	"strings"
+)
+
+// tag limits
+const (
+	maxTags      = 20
+	maxTagLength = 64
+)
+
+// normalizeTag trims and lower-cases tag and checks it consists of letters, digits, '-', '_' and '.' only.
+func normalizeTag(tag string) (string, error) {
+	name := strings.ToLower(strings.TrimSpace(tag))
+	if name == "" || len(name) > maxTagLength {
+		return "", &serviceErrors.ServiceIncorrectInputTags{
+			Msg: fmt.Sprintf("tag %q must be from 1 to %d characters long", tag, maxTagLength),
+		}
+	}
+	for _, c := range name {
+		if !('a' <= c && c <= 'z' || '0' <= c && c <= '9' || c == '-' || c == '_' || c == '.') {
+			return "", &serviceErrors.ServiceIncorrectInputTags{
+				Msg: fmt.Sprintf("tag %q may only contain letters, digits, '-', '_' and '.'", tag),
+			}
+		}
+	}
+	return name, nil
+}
+
+// normalizeTags normalizes tags and returns them deduplicated and sorted by name, no tags return nil.
+func normalizeTags(tags []string) ([]string, error) {
+	if len(tags) == 0 {
+		return nil, nil
+	}
+	seen := make(map[string]bool, len(tags))
+	normalized := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		name, err := normalizeTag(tag)
+		if err != nil {
+			return nil, err
+		}
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+		normalized = append(normalized, name)
+	}
+	if len(normalized) > maxTags {
+		return nil, &serviceErrors.ServiceIncorrectInputTags{
+			Msg: fmt.Sprintf("a link may have up to %d tags, got %d", maxTags, len(normalized)),
+		}
+	}
+	sort.Strings(normalized)
+	return normalized, nil
+}
+
+// SetTags replaces tags of sURL owned by userID with tags, no tags untag the link. Links of other users are reported
+// with NotFoundError.
+func (short *Shortener) SetTags(ctx context.Context, sURL, userID string, tags []string) (err error) {
+	ctx, span := tracing.Start(ctx, "shortener.SetTags", tracing.KindInternal)
+	defer func() { span.End(err) }()
+	tags, err = normalizeTags(tags)
+	if err != nil {
+		return err
+	}
+	return short.URLStorage.SetTags(ctx, sURL, userID, tags)
+}
+
+// ListTags returns tags of live links of userID along with the number of links tagged with each of them sorted by
+// name.
+func (short *Shortener) ListTags(ctx context.Context, userID string) (tags []modelurl.Tag, err error) {
+	ctx, span := tracing.Start(ctx, "shortener.ListTags", tracing.KindInternal)
+	defer func() { span.End(err) }()
+	return short.URLStorage.RetrieveTags(ctx, userID)
+}
+
+// RenameTag renames tag of all links of userID to name, links already tagged with name keep one tag. TagNotFoundError
+// is reported if no link of the user is tagged with tag.
+func (short *Shortener) RenameTag(ctx context.Context, userID, tag, name string) (err error) {
+	ctx, span := tracing.Start(ctx, "shortener.RenameTag", tracing.KindInternal)
+	defer func() { span.End(err) }()
+	tag, err = normalizeTag(tag)
+	if err != nil {
+		return err
+	}
+	name, err = normalizeTag(name)
+	if err != nil {
+		return err
+	}
+	return short.URLStorage.RenameTag(ctx, userID, tag, name)
+}
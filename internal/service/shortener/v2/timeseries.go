@@ -0,0 +1,70 @@
+package shortener
+
+import (
+	"context"
+	"fmt"
+	serviceErrors "github.com/danilovkiri/dk_go_url_shortener/internal/service/errors"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/service/modelurl"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/tracing"
+	"time"
+)
+
+// time series limits: ranges default to the last defaultHourlyBuckets hours or defaultDailyBuckets days and span up
+// to maxTimeSeriesBuckets buckets
+const (
+	defaultHourlyBuckets = 48
+	defaultDailyBuckets  = 30
+	maxTimeSeriesBuckets = 1000
+)
+
+// TimeSeries returns redirect counts of sURL per UTC hour or day of granularity within [from, to) including empty
+// buckets. from is aligned down and to up to bucket boundaries, zero to stands for now and zero from for the default
+// number of buckets before to. Redirects of bots are only counted with includeBots.
+func (short *Shortener) TimeSeries(ctx context.Context, sURL, granularity string, from, to time.Time, includeBots bool) (series modelurl.ClickTimeSeries, err error) {
+	ctx, span := tracing.Start(ctx, "shortener.TimeSeries", tracing.KindInternal)
+	defer func() { span.End(err) }()
+	var step time.Duration
+	var defaultBuckets int
+	switch granularity {
+	case modelurl.GranularityHour:
+		step, defaultBuckets = time.Hour, defaultHourlyBuckets
+	case modelurl.GranularityDay:
+		step, defaultBuckets = 24*time.Hour, defaultDailyBuckets
+	default:
+		return modelurl.ClickTimeSeries{}, &serviceErrors.ServiceIncorrectInputTimeSeries{
+			Msg: fmt.Sprintf("granularity must be %q or %q, got %q", modelurl.GranularityHour, modelurl.GranularityDay, granularity),
+		}
+	}
+	if to.IsZero() {
+		to = time.Now()
+	}
+	end := to.UTC().Truncate(step)
+	if end.Before(to) {
+		end = end.Add(step)
+	}
+	start := end.Add(-time.Duration(defaultBuckets) * step)
+	if !from.IsZero() {
+		start = from.UTC().Truncate(step)
+	}
+	if !start.Before(end) {
+		return modelurl.ClickTimeSeries{}, &serviceErrors.ServiceIncorrectInputTimeSeries{Msg: "from must be before to"}
+	}
+	if end.Sub(start)/step > maxTimeSeriesBuckets {
+		return modelurl.ClickTimeSeries{}, &serviceErrors.ServiceIncorrectInputTimeSeries{
+			Msg: fmt.Sprintf("time series may span up to %d buckets, got %d", maxTimeSeriesBuckets, end.Sub(start)/step),
+		}
+	}
+	stored, err := short.URLStorage.RetrieveTimeSeries(ctx, sURL, granularity, start, end, includeBots)
+	if err != nil {
+		return modelurl.ClickTimeSeries{}, err
+	}
+	clicks := make(map[int64]int, len(stored))
+	for _, bucket := range stored {
+		clicks[bucket.Start.Unix()] = bucket.Clicks
+	}
+	series = modelurl.ClickTimeSeries{SURL: sURL, Granularity: granularity, From: start, To: end}
+	for bucketStart := start; bucketStart.Before(end); bucketStart = bucketStart.Add(step) {
+		series.Buckets = append(series.Buckets, modelurl.ClickBucket{Start: bucketStart, Clicks: clicks[bucketStart.Unix()]})
+	}
+	return series, nil
+}
@@ -0,0 +1,125 @@
+package shortener
+
+import (
+	"context"
+	"fmt"
+	serviceErrors "github.com/danilovkiri/dk_go_url_shortener/internal/service/errors"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/service/modelurl"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/storage/v2/modelstorage"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/tracing"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// maxUTMValueLength limits the length of UTM parameter values.
+const maxUTMValueLength = 256
+
+// normalizeUTM checks the names and values of UTM parameters and returns them keyed by lower-case names with trimmed
+// values, no parameters return nil.
+func normalizeUTM(utm map[string]string) (map[string]string, error) {
+	if len(utm) == 0 {
+		return nil, nil
+	}
+	normalized := make(map[string]string, len(utm))
+	for param, value := range utm {
+		name := strings.ToLower(strings.TrimSpace(param))
+		if !isUTMParam(name) {
+			return nil, &serviceErrors.ServiceIncorrectInputUTM{
+				Msg: fmt.Sprintf("UTM parameter %q is not supported, expected one of %s", param, strings.Join(modelurl.UTMParams, ", ")),
+			}
+		}
+		if _, ok := normalized[name]; ok {
+			return nil, &serviceErrors.ServiceIncorrectInputUTM{Msg: fmt.Sprintf("UTM parameter %s is set twice", name)}
+		}
+		value = strings.TrimSpace(value)
+		if value == "" || len(value) > maxUTMValueLength {
+			return nil, &serviceErrors.ServiceIncorrectInputUTM{
+				Msg: fmt.Sprintf("value of UTM parameter %s must be from 1 to %d characters long", name, maxUTMValueLength),
+			}
+		}
+		normalized[name] = value
+	}
+	return normalized, nil
+}
+
+// isUTMParam reports whether name is one of modelurl.UTMParams.
+func isUTMParam(name string) bool {
+	for _, param := range modelurl.UTMParams {
+		if name == param {
+			return true
+		}
+	}
+	return false
+}
+
+// appendUTM appends UTM parameters of utm missing in the query of an http(s) destination to it in the order of their
+// names, parameters the destination already sets are kept as they are. Other destinations, e.g. app deep links, are
+// returned unchanged.
+func appendUTM(destination string, utm map[string]string) string {
+	if len(utm) == 0 {
+		return destination
+	}
+	parsed, err := url.Parse(destination)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") {
+		return destination
+	}
+	query := parsed.Query()
+	names := make([]string, 0, len(utm))
+	for name := range utm {
+		if _, ok := query[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return destination
+	}
+	sort.Strings(names)
+	params := make([]string, 0, len(names))
+	for _, name := range names {
+		params = append(params, url.QueryEscape(name)+"="+url.QueryEscape(utm[name]))
+	}
+	// the existing query is kept verbatim since destinations may depend on its order and encoding
+	if parsed.RawQuery != "" {
+		parsed.RawQuery += "&"
+	}
+	parsed.RawQuery += strings.Join(params, "&")
+	return parsed.String()
+}
+
+// linkUTM returns UTM parameters of a link created by userID with utm: the normalized utm or, if there is none, the UTM
+// defaults of the user.
+func (short *Shortener) linkUTM(ctx context.Context, userID string, utm map[string]string) (map[string]string, error) {
+	utm, err := normalizeUTM(utm)
+	if err != nil || utm != nil {
+		return utm, err
+	}
+	settings, err := short.URLStorage.RetrieveUserSettings(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	return settings.UTM, nil
+}
+
+// SetUTMDefaults replaces UTM parameters links created by userID afterwards are given unless they are created with
+// their own, no parameters remove the defaults. Links created before keep their UTM parameters.
+func (short *Shortener) SetUTMDefaults(ctx context.Context, userID string, utm map[string]string) (err error) {
+	ctx, span := tracing.Start(ctx, "shortener.SetUTMDefaults", tracing.KindInternal)
+	defer func() { span.End(err) }()
+	utm, err = normalizeUTM(utm)
+	if err != nil {
+		return err
+	}
+	return short.URLStorage.DumpUserSettings(ctx, modelstorage.UserSettingsEntry{UserID: userID, UTM: utm})
+}
+
+// UTMDefaults returns UTM parameters links created by userID are given unless they are created with their own.
+func (short *Shortener) UTMDefaults(ctx context.Context, userID string) (utm map[string]string, err error) {
+	ctx, span := tracing.Start(ctx, "shortener.UTMDefaults", tracing.KindInternal)
+	defer func() { span.End(err) }()
+	settings, err := short.URLStorage.RetrieveUserSettings(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	return settings.UTM, nil
+}
@@ -0,0 +1,221 @@
+package shortener
+
+import (
+	"fmt"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/config"
+	serviceErrors "github.com/danilovkiri/dk_go_url_shortener/internal/service/errors"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/service/modelurl"
+	"golang.org/x/net/idna"
+	"net"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// sharedAddressSpace is the carrier-grade NAT range (RFC 6598) which net.IP does not report private.
+var sharedAddressSpace = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+// urlValidator checks destination URLs against the rules of the deployment before they are shortened.
+type urlValidator struct {
+	schemes      map[string]bool
+	minLength    int
+	maxLength    int
+	blockPrivate bool
+	rejectIDN    bool
+	// allowedDomains and deniedDomains hold lower-cased punycode domains matching themselves and their subdomains
+	allowedDomains []string
+	deniedDomains  []string
+	// shortenerDomains holds domains of other URL shorteners in the same form, baseHost the host of the base URL
+	shortenerDomains []string
+	baseHost         string
+}
+
+// newURLValidator returns a urlValidator configured by cfg.
+func newURLValidator(cfg *config.ShortenerConfig) *urlValidator {
+	validator := &urlValidator{
+		schemes:          make(map[string]bool),
+		minLength:        cfg.MinURLLength,
+		maxLength:        cfg.MaxURLLength,
+		blockPrivate:     cfg.BlockPrivateDestinations,
+		rejectIDN:        cfg.IDNPolicy == modelurl.IDNReject,
+		allowedDomains:   asciiDomains(cfg.AllowedDomains),
+		deniedDomains:    asciiDomains(cfg.DeniedDomains),
+		shortenerDomains: asciiDomains(cfg.ShortenerDomains),
+	}
+	for _, scheme := range cfg.AllowedSchemes {
+		scheme = strings.ToLower(strings.TrimSpace(scheme))
+		if scheme != "" {
+			validator.schemes[scheme] = true
+		}
+	}
+	return validator
+}
+
+// asciiDomains returns domains lower-cased and converted to punycode, domains failing to convert are validated by
+// the configuration and are skipped.
+func asciiDomains(domains []string) []string {
+	var ascii []string
+	for _, domain := range domains {
+		domain, err := idna.Lookup.ToASCII(strings.TrimSuffix(strings.TrimSpace(domain), "."))
+		if err == nil && domain != "" {
+			ascii = append(ascii, domain)
+		}
+	}
+	return ascii
+}
+
+// validate checks that URL is an absolute URL with a scheme from the configured allowlist, that its length is within
+// the configured limits (zero disables a limit) and that its host passes the IDN policy, private destination
+// blocking and domain lists and is not one of this or other URL shorteners.
+func (v *urlValidator) validate(URL string) error {
+	u, err := url.Parse(URL)
+	if err != nil {
+		return &serviceErrors.ServiceIncorrectInputURL{Msg: err.Error()}
+	}
+	if u.Scheme == "" || (u.Host == "" && u.Opaque == "") {
+		return &serviceErrors.ServiceIncorrectInputURL{Msg: fmt.Sprintf("%q is not an absolute URL", URL)}
+	}
+	if !v.schemes[u.Scheme] {
+		allowed := make([]string, 0, len(v.schemes))
+		for scheme := range v.schemes {
+			allowed = append(allowed, scheme)
+		}
+		sort.Strings(allowed)
+		return &serviceErrors.ServiceIncorrectInputURL{
+			Msg: fmt.Sprintf("URL scheme %q is not allowed, allowed schemes: %s", u.Scheme, strings.Join(allowed, ", ")),
+		}
+	}
+	if len(URL) < v.minLength {
+		return &serviceErrors.ServiceIncorrectInputURL{
+			Msg: fmt.Sprintf("URL is already short enough: %d characters, shortening requires at least %d", len(URL), v.minLength),
+		}
+	}
+	if v.maxLength > 0 && len(URL) > v.maxLength {
+		return &serviceErrors.ServiceIncorrectInputURL{
+			Msg: fmt.Sprintf("URL is too long: %d characters, up to %d are allowed", len(URL), v.maxLength),
+		}
+	}
+	// opaque URLs, e.g. mailto ones, have no host to check
+	if u.Host == "" {
+		return nil
+	}
+	err = v.validateHost(strings.TrimSuffix(strings.ToLower(u.Hostname()), "."))
+	if err != nil {
+		return err
+	}
+	if v.pointsAtShortener(u, "") {
+		return &serviceErrors.ServiceIncorrectInputURL{
+			Msg: fmt.Sprintf("URL %q points at a URL shortener, short links cannot be shortened again", URL),
+		}
+	}
+	return nil
+}
+
+// validateHost checks a lower-cased host of a destination URL.
+func (v *urlValidator) validateHost(host string) error {
+	if host == "" {
+		return &serviceErrors.ServiceIncorrectInputURL{Msg: "URL host is empty"}
+	}
+	ip := hostIP(host)
+	if ip == nil && !isASCIIDomain(host) {
+		if v.rejectIDN {
+			return &serviceErrors.ServiceIncorrectInputURL{
+				Msg: fmt.Sprintf("URL host %q is an internationalized domain name, which is not allowed", host),
+			}
+		}
+		ascii, err := idna.Lookup.ToASCII(host)
+		if err != nil {
+			return &serviceErrors.ServiceIncorrectInputURL{Msg: fmt.Sprintf("URL host %q is invalid: %s", host, err)}
+		}
+		host = ascii
+	}
+	if v.blockPrivate && (host == "localhost" || strings.HasSuffix(host, ".localhost") || ip != nil && isPrivateIP(ip)) {
+		return &serviceErrors.ServiceIncorrectInputURL{
+			Msg: fmt.Sprintf("URL host %q is a private destination, which is not allowed", host),
+		}
+	}
+	if matchDomain(host, v.deniedDomains) {
+		return &serviceErrors.ServiceIncorrectInputURL{Msg: fmt.Sprintf("URL domain %q is denied", host)}
+	}
+	if len(v.allowedDomains) > 0 && !matchDomain(host, v.allowedDomains) {
+		return &serviceErrors.ServiceIncorrectInputURL{Msg: fmt.Sprintf("URL domain %q is not allowed", host)}
+	}
+	return nil
+}
+
+// isASCIIDomain reports whether host consists of ASCII characters and has no punycode labels.
+func isASCIIDomain(host string) bool {
+	for i := 0; i < len(host); i++ {
+		if host[i] >= 0x80 {
+			return false
+		}
+	}
+	return !strings.HasPrefix(host, "xn--") && !strings.Contains(host, ".xn--")
+}
+
+// matchDomain reports whether host is one of domains or a subdomain of one of them.
+func matchDomain(host string, domains []string) bool {
+	for _, domain := range domains {
+		if host == domain || strings.HasSuffix(host, "."+domain) {
+			return true
+		}
+	}
+	return false
+}
+
+// isPrivateIP reports whether ip is an address destinations must not point at from the outside: a loopback, private,
+// shared, link-local or unspecified one.
+func isPrivateIP(ip net.IP) bool {
+	return ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsUnspecified() || sharedAddressSpace.Contains(ip)
+}
+
+// hostIP returns the IP address host stands for, nil if host is a domain name. Besides the dotted form browsers take
+// IPv4 addresses of one to four decimal, octal (leading 0) or hexadecimal (leading 0x) parts, the last part filling
+// the remaining bytes, e.g. 2130706433, 0x7f.1 and 127.1 are all 127.0.0.1.
+func hostIP(host string) net.IP {
+	ip := net.ParseIP(host)
+	if ip != nil {
+		return ip
+	}
+	parts := strings.Split(host, ".")
+	if len(parts) > 4 {
+		return nil
+	}
+	var address uint64
+	for i, part := range parts {
+		base := 10
+		switch {
+		case strings.HasPrefix(part, "0x") || strings.HasPrefix(part, "0X"):
+			part, base = part[2:], 16
+		case len(part) > 1 && part[0] == '0':
+			part, base = part[1:], 8
+		}
+		if part == "" && base != 16 {
+			return nil
+		}
+		n := uint64(0)
+		if part != "" {
+			var err error
+			n, err = strconv.ParseUint(part, base, 32)
+			if err != nil {
+				return nil
+			}
+		}
+		// every part but the last one is a single byte, the last one fills the remaining bytes
+		bits := uint(8 * (4 - i))
+		if i < len(parts)-1 {
+			if n > 0xff {
+				return nil
+			}
+			address |= n << (bits - 8)
+		} else {
+			if n >= 1<<bits {
+				return nil
+			}
+			address |= n
+		}
+	}
+	return net.IPv4(byte(address>>24), byte(address>>16), byte(address>>8), byte(address))
+}
@@ -0,0 +1,72 @@
+// Package shutdown provides an orchestrator running application shutdown stages in a fixed order.
+package shutdown
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/danilovkiri/dk_go_url_shortener/internal/logger"
+)
+
+// Stage releases one application component, it must return once the component is released or ctx is done.
+type Stage func(ctx context.Context) error
+
+type namedStage struct {
+	name string
+	fn   Stage
+}
+
+// Orchestrator runs registered stages sequentially in the order of registration.
+type Orchestrator struct {
+	log    *logger.Logger
+	stages []namedStage
+	once   sync.Once
+	err    error
+}
+
+// NewOrchestrator initializes an empty Orchestrator.
+func NewOrchestrator(log *logger.Logger) *Orchestrator {
+	return &Orchestrator{log: log}
+}
+
+// Add registers a stage run after all previously registered stages.
+func (o *Orchestrator) Add(name string, fn Stage) {
+	o.stages = append(o.stages, namedStage{name: name, fn: fn})
+}
+
+// Shutdown runs all stages once sharing ctx as a common deadline. A failed stage does not prevent subsequent stages
+// from running so that resources are released as far as possible, the first error encountered is returned.
+// Repeated calls return the result of the first call.
+func (o *Orchestrator) Shutdown(ctx context.Context) error {
+	o.once.Do(func() {
+		for _, stage := range o.stages {
+			o.log.Info("Shutting down", logger.String("stage", stage.name))
+			err := stage.fn(ctx)
+			if err != nil {
+				o.log.Error("Shutting down", logger.String("stage", stage.name), logger.Error(err))
+				if o.err == nil {
+					o.err = fmt.Errorf("shutting down %s: %w", stage.name, err)
+				}
+			}
+		}
+	})
+	return o.err
+}
+
+// WaitGroup returns a Stage waiting for wg to be done or ctx to be done, whichever happens first.
+func WaitGroup(wg *sync.WaitGroup) Stage {
+	return func(ctx context.Context) error {
+		done := make(chan struct{})
+		go func() {
+			wg.Wait()
+			close(done)
+		}()
+		select {
+		case <-done:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
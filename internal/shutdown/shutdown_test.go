@@ -0,0 +1,41 @@
+package shutdown
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOrchestratorRunsStagesInOrder(t *testing.T) {
+	o := NewOrchestrator(nil)
+	var calls []string
+	errFirst := errors.New("first failed")
+	o.Add("first", func(ctx context.Context) error {
+		calls = append(calls, "first")
+		return errFirst
+	})
+	o.Add("second", func(ctx context.Context) error {
+		calls = append(calls, "second")
+		return errors.New("second failed")
+	})
+	err := o.Shutdown(context.Background())
+	assert.ErrorIs(t, err, errFirst)
+	assert.Equal(t, []string{"first", "second"}, calls)
+	// stages are run only once
+	assert.ErrorIs(t, o.Shutdown(context.Background()), errFirst)
+	assert.Equal(t, []string{"first", "second"}, calls)
+}
+
+func TestWaitGroup(t *testing.T) {
+	wg := &sync.WaitGroup{}
+	wg.Add(1)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, WaitGroup(wg)(ctx), context.DeadlineExceeded)
+	wg.Done()
+	assert.NoError(t, WaitGroup(wg)(context.Background()))
+}
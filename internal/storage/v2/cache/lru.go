@@ -0,0 +1,138 @@
+// Package cache provides an in-memory LRU cache for storage entries keyed by sURL.
+package cache
+
+import (
+	"container/list"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/storage/v2/modelstorage"
+	"sync"
+	"sync/atomic"
+)
+
+// LRU struct defines a fixed-size cache evicting the least recently used entries, it is safe for concurrent use.
+// A nil *LRU is a valid disabled cache: it never holds entries and does not count hits or misses.
+type LRU struct {
+	// hits and misses are kept first for 64-bit alignment
+	hits     uint64
+	misses   uint64
+	mu       sync.Mutex
+	capacity int
+	ll       *list.List
+	items    map[string]*list.Element
+	// generation is incremented on every invalidation, see AddIfUnchanged
+	generation uint64
+}
+
+// lruItem is stored in LRU list elements.
+type lruItem struct {
+	sURL  string
+	entry modelstorage.URLMapEntry
+}
+
+// NewLRU initializes an LRU holding up to capacity entries.
+func NewLRU(capacity int) *LRU {
+	return &LRU{
+		capacity: capacity,
+		ll:       list.New(),
+		items:    make(map[string]*list.Element),
+	}
+}
+
+// Get returns a cached entry for sURL and marks it as recently used.
+func (c *LRU) Get(sURL string) (modelstorage.URLMapEntry, bool) {
+	if c == nil {
+		return modelstorage.URLMapEntry{}, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.items[sURL]
+	if !ok {
+		atomic.AddUint64(&c.misses, 1)
+		return modelstorage.URLMapEntry{}, false
+	}
+	atomic.AddUint64(&c.hits, 1)
+	c.ll.MoveToFront(el)
+	return el.Value.(*lruItem).entry, true
+}
+
+// Add stores an entry for sURL evicting the least recently used entry if the cache is full.
+func (c *LRU) Add(sURL string, entry modelstorage.URLMapEntry) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.add(sURL, entry)
+}
+
+// add stores an entry, the caller must hold c.mu.
+func (c *LRU) add(sURL string, entry modelstorage.URLMapEntry) {
+	if el, ok := c.items[sURL]; ok {
+		el.Value.(*lruItem).entry = entry
+		c.ll.MoveToFront(el)
+		return
+	}
+	c.items[sURL] = c.ll.PushFront(&lruItem{sURL: sURL, entry: entry})
+	if c.ll.Len() > c.capacity {
+		oldest := c.ll.Back()
+		c.ll.Remove(oldest)
+		delete(c.items, oldest.Value.(*lruItem).sURL)
+	}
+}
+
+// Generation returns the current invalidation generation to be passed to AddIfUnchanged.
+func (c *LRU) Generation() uint64 {
+	if c == nil {
+		return 0
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.generation
+}
+
+// AddIfUnchanged stores an entry only if no invalidation happened since generation was retrieved, so that an entry
+// read from DB before a concurrent deletion does not get cached after the deletion has invalidated it.
+func (c *LRU) AddIfUnchanged(generation uint64, sURL string, entry modelstorage.URLMapEntry) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.generation != generation {
+		return
+	}
+	c.add(sURL, entry)
+}
+
+// Remove invalidates entries for the given sURLs.
+func (c *LRU) Remove(sURLs ...string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.generation++
+	for _, sURL := range sURLs {
+		if el, ok := c.items[sURL]; ok {
+			c.ll.Remove(el)
+			delete(c.items, sURL)
+		}
+	}
+}
+
+// Len returns the number of cached entries.
+func (c *LRU) Len() int {
+	if c == nil {
+		return 0
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.ll.Len()
+}
+
+// Stats returns the number of cache hits and misses since initialization.
+func (c *LRU) Stats() (hits, misses uint64) {
+	if c == nil {
+		return 0, 0
+	}
+	return atomic.LoadUint64(&c.hits), atomic.LoadUint64(&c.misses)
+}
@@ -0,0 +1,59 @@
+package cache
+
+import (
+	"github.com/danilovkiri/dk_go_url_shortener/internal/storage/v2/modelstorage"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestLRU(t *testing.T) {
+	c := NewLRU(2)
+	c.Add("a", modelstorage.URLMapEntry{URL: "https://a.example.com"})
+	c.Add("b", modelstorage.URLMapEntry{URL: "https://b.example.com"})
+	// touch "a" so that "b" becomes the least recently used entry
+	entry, ok := c.Get("a")
+	assert.True(t, ok)
+	assert.Equal(t, "https://a.example.com", entry.URL)
+	c.Add("c", modelstorage.URLMapEntry{URL: "https://c.example.com"})
+	_, ok = c.Get("b")
+	assert.False(t, ok, "least recently used entry must be evicted")
+	_, ok = c.Get("c")
+	assert.True(t, ok)
+	assert.Equal(t, 2, c.Len())
+
+	c.Remove("a", "missing")
+	_, ok = c.Get("a")
+	assert.False(t, ok, "removed entry must be invalidated")
+	assert.Equal(t, 1, c.Len())
+
+	hits, misses := c.Stats()
+	assert.Equal(t, uint64(2), hits)
+	assert.Equal(t, uint64(2), misses)
+}
+
+func TestLRUAddIfUnchanged(t *testing.T) {
+	c := NewLRU(2)
+	generation := c.Generation()
+	// a concurrent deletion invalidates the entry between reading it from DB and caching it
+	c.Remove("a")
+	c.AddIfUnchanged(generation, "a", modelstorage.URLMapEntry{URL: "https://a.example.com"})
+	_, ok := c.Get("a")
+	assert.False(t, ok, "entry read before invalidation must not be cached")
+
+	c.AddIfUnchanged(c.Generation(), "a", modelstorage.URLMapEntry{URL: "https://a.example.com"})
+	_, ok = c.Get("a")
+	assert.True(t, ok)
+}
+
+func TestLRUNil(t *testing.T) {
+	var c *LRU
+	c.Add("a", modelstorage.URLMapEntry{URL: "https://a.example.com"})
+	c.AddIfUnchanged(c.Generation(), "a", modelstorage.URLMapEntry{URL: "https://a.example.com"})
+	_, ok := c.Get("a")
+	assert.False(t, ok)
+	c.Remove("a")
+	assert.Equal(t, 0, c.Len())
+	hits, misses := c.Stats()
+	assert.Zero(t, hits)
+	assert.Zero(t, misses)
+}
@@ -0,0 +1,50 @@
+// Package deduplicating provides a storage.URLStorage wrapper collapsing concurrent identical lookups into one storage
+// call.
+package deduplicating
+
+import (
+	"context"
+	"errors"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/storage/v2"
+	storageErrors "github.com/danilovkiri/dk_go_url_shortener/internal/storage/v2/errors"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/storage/v2/modelstorage"
+	"golang.org/x/sync/singleflight"
+)
+
+// Storage struct wraps a storage.URLStorage and lets only one Retrieve of a sURL at a time reach it, concurrent
+// callers asking for the same sURL share its result, so that a burst of redirects of a popular link costs one query.
+type Storage struct {
+	storage.URLStorage
+	group singleflight.Group
+}
+
+// InitStorage initializes a Storage object wrapping st.
+func InitStorage(st storage.URLStorage) *Storage {
+	return &Storage{URLStorage: st}
+}
+
+type retrieveResult struct {
+	entry modelstorage.URLMapEntry
+	err   error
+}
+
+// Retrieve returns the live entry corresponding to sURL. The shared call runs with the context of the caller which
+// started it, callers whose context is still alive when it times out retrieve the entry on their own.
+func (s *Storage) Retrieve(ctx context.Context, sURL string) (modelstorage.URLMapEntry, error) {
+	ch := s.group.DoChan(sURL, func() (interface{}, error) {
+		entry, err := s.URLStorage.Retrieve(ctx, sURL)
+		// errors are passed within the result so that they are not mistaken for failures of the group
+		return retrieveResult{entry: entry, err: err}, nil
+	})
+	select {
+	case <-ctx.Done():
+		return modelstorage.URLMapEntry{}, &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
+	case res := <-ch:
+		result := res.Val.(retrieveResult)
+		var contextTimeoutExceededError *storageErrors.ContextTimeoutExceededError
+		if res.Shared && errors.As(result.err, &contextTimeoutExceededError) && ctx.Err() == nil {
+			return s.URLStorage.Retrieve(ctx, sURL)
+		}
+		return result.entry, result.err
+	}
+}
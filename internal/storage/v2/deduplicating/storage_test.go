@@ -0,0 +1,57 @@
+package deduplicating
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/danilovkiri/dk_go_url_shortener/internal/storage/v2"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/storage/v2/modelstorage"
+	"github.com/stretchr/testify/assert"
+)
+
+// blockingStorage counts Retrieve calls and holds them until release is closed.
+type blockingStorage struct {
+	storage.URLStorage
+	calls   int32
+	release chan struct{}
+}
+
+func (s *blockingStorage) Retrieve(ctx context.Context, sURL string) (modelstorage.URLMapEntry, error) {
+	atomic.AddInt32(&s.calls, 1)
+	<-s.release
+	return modelstorage.URLMapEntry{URL: "https://example.com/" + sURL}, nil
+}
+
+func TestRetrieveCollapsesConcurrentLookups(t *testing.T) {
+	st := &blockingStorage{release: make(chan struct{})}
+	s := InitStorage(st)
+	var wg sync.WaitGroup
+	results := make(chan string, 10)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			entry, err := s.Retrieve(context.Background(), "abc")
+			assert.NoError(t, err)
+			results <- entry.URL
+		}()
+	}
+	assert.Eventually(t, func() bool { return atomic.LoadInt32(&st.calls) == 1 }, time.Second, time.Millisecond)
+	// give other lookups time to join the call in flight
+	time.Sleep(50 * time.Millisecond)
+	close(st.release)
+	wg.Wait()
+	close(results)
+	for URL := range results {
+		assert.Equal(t, "https://example.com/abc", URL)
+	}
+	assert.Equal(t, int32(1), atomic.LoadInt32(&st.calls))
+
+	// lookups which do not overlap reach the storage each
+	_, err := s.Retrieve(context.Background(), "abc")
+	assert.NoError(t, err)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&st.calls))
+}
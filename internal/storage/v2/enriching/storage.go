@@ -0,0 +1,136 @@
+// Package enriching provides a storage.URLStorage wrapper fetching destination page metadata of created entries in the
+// background.
+package enriching
+
+import (
+	"context"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/config"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/logger"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/preview"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/storage/v2"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/storage/v2/modelstorage"
+	"time"
+)
+
+// fetcher parameters
+const (
+	fetchWorkers = 4
+	// updateTimeout bounds storing fetched metadata the same way handlers bound storage calls
+	updateTimeout = 500 * time.Millisecond
+)
+
+// Storage struct wraps a storage.URLStorage and queues every stored or edited entry for fetching the title and the
+// favicon of its destination page, fetched metadata is stored with UpdateMetadata. Entries are not delayed by fetching
+// and are listed without metadata until it is stored.
+type Storage struct {
+	storage.URLStorage
+	fetcher *preview.Fetcher
+	log     *logger.Logger
+	queue   chan modelstorage.URLStorageEntry
+	done    <-chan struct{}
+}
+
+// InitStorage initializes a Storage object wrapping st and starts its workers which stop when ctx is done, entries
+// queued at that moment are abandoned.
+func InitStorage(ctx context.Context, st storage.URLStorage, cfg *config.MetadataConfig, log *logger.Logger) *Storage {
+	s := &Storage{
+		URLStorage: st,
+		fetcher:    preview.NewFetcher(cfg.Timeout),
+		log:        log,
+		queue:      make(chan modelstorage.URLStorageEntry, cfg.QueueSize),
+		done:       ctx.Done(),
+	}
+	for i := 0; i < fetchWorkers; i++ {
+		go func() {
+			for {
+				select {
+				case <-s.done:
+					return
+				case entry := <-s.queue:
+					s.enrich(ctx, entry)
+				}
+			}
+		}()
+	}
+	return s
+}
+
+// Dump stores a pair of sURL and URL.
+func (s *Storage) Dump(ctx context.Context, entry modelstorage.URLStorageEntry) error {
+	if err := s.URLStorage.Dump(ctx, entry); err != nil {
+		return err
+	}
+	s.enqueue(entry)
+	return nil
+}
+
+// DumpBatch stores a batch of sURL:URL pairs, entries whose URL was already shortened are not queued.
+func (s *Storage) DumpBatch(ctx context.Context, entries []modelstorage.URLStorageEntry) ([]modelstorage.URLStorageEntry, error) {
+	stored, err := s.URLStorage.DumpBatch(ctx, entries)
+	if err != nil {
+		return nil, err
+	}
+	for i := range stored {
+		if i < len(entries) && stored[i].SURL == entries[i].SURL {
+			s.enqueue(stored[i])
+		}
+	}
+	return stored, nil
+}
+
+// ImportBatch stores a batch of imported URL entries.
+func (s *Storage) ImportBatch(ctx context.Context, entries []modelstorage.URLStorageEntry) ([]modelstorage.ImportResult, error) {
+	results, err := s.URLStorage.ImportBatch(ctx, entries)
+	if err != nil {
+		return nil, err
+	}
+	for _, result := range results {
+		if result.Status == modelstorage.ImportCreated {
+			s.enqueue(result.Entry)
+		}
+	}
+	return results, nil
+}
+
+// UpdateURL changes the destination of sURL owned by userID to URL and queues the entry for fetching metadata of the
+// new destination page.
+func (s *Storage) UpdateURL(ctx context.Context, sURL, userID, URL string) (string, error) {
+	previous, err := s.URLStorage.UpdateURL(ctx, sURL, userID, URL)
+	if err != nil {
+		return "", err
+	}
+	s.enqueue(modelstorage.URLStorageEntry{SURL: sURL, URL: URL, UserID: userID})
+	return previous, nil
+}
+
+// enqueue queues entry without blocking unless the Storage is stopped, entry is skipped when the queue is full.
+func (s *Storage) enqueue(entry modelstorage.URLStorageEntry) {
+	select {
+	case <-s.done:
+		return
+	default:
+	}
+	select {
+	case s.queue <- entry:
+	default:
+		s.log.Warn("Fetching URL metadata: queue is full", logger.String("sURL", entry.SURL))
+	}
+}
+
+// enrich fetches metadata of the entry destination page and stores it, pages without metadata store nothing.
+func (s *Storage) enrich(ctx context.Context, entry modelstorage.URLStorageEntry) {
+	metadata, err := s.fetcher.Metadata(ctx, entry.URL)
+	if err != nil {
+		s.log.Debug("Fetching URL metadata", logger.Error(err), logger.String("sURL", entry.SURL))
+		return
+	}
+	if metadata == (preview.Metadata{}) {
+		return
+	}
+	ctxTO, cancel := context.WithTimeout(ctx, updateTimeout)
+	defer cancel()
+	err = s.URLStorage.UpdateMetadata(ctxTO, entry.SURL, metadata.Title, metadata.FaviconURL)
+	if err != nil {
+		s.log.Warn("Storing URL metadata", logger.Error(err), logger.String("sURL", entry.SURL))
+	}
+}
@@ -19,9 +19,65 @@ type (
 		SURL string
 		Err  error
 	}
+	SURLAlreadyExistsError struct {
+		SURL string
+		Err  error
+	}
+	ExpiredError struct {
+		SURL string
+		Err  error
+	}
+	DisabledError struct {
+		SURL string
+		Err  error
+	}
+	ExhaustedError struct {
+		SURL string
+		Err  error
+	}
+	NotActiveError struct {
+		SURL string
+		Err  error
+	}
+	UserNotFoundError struct {
+		Login string
+		Err   error
+	}
+	LoginAlreadyExistsError struct {
+		Login string
+		Err   error
+	}
+	APIKeyNotFoundError struct {
+		ID  string
+		Err error
+	}
+	DomainNotFoundError struct {
+		Name string
+		Err  error
+	}
+	DomainAlreadyExistsError struct {
+		Name string
+		Err  error
+	}
+	OrgNotFoundError struct {
+		ID  string
+		Err error
+	}
+	MemberNotFoundError struct {
+		OrgID  string
+		UserID string
+		Err    error
+	}
+	TagNotFoundError struct {
+		Tag string
+		Err error
+	}
 	ContextTimeoutExceededError struct {
 		Err error
 	}
+	QueueClosedError struct {
+		Err error
+	}
 	StatementPSQLError struct {
 		Err error
 	}
@@ -34,6 +90,9 @@ type (
 	FileWriteError struct {
 		Err error
 	}
+	ExecutionRedisError struct {
+		Err error
+	}
 )
 
 func (e *NotFoundError) Error() string {
@@ -48,10 +107,69 @@ func (e *DeletedError) Error() string {
 	return fmt.Sprintf("%s: was deleted", e.SURL)
 }
 
+func (e *ExpiredError) Error() string {
+	return fmt.Sprintf("%s: has expired", e.SURL)
+}
+
+func (e *DisabledError) Error() string {
+	return fmt.Sprintf("%s: was disabled as unsafe", e.SURL)
+}
+
+func (e *ExhaustedError) Error() string {
+	return fmt.Sprintf("%s: has reached its click limit", e.SURL)
+}
+
+func (e *NotActiveError) Error() string {
+	return fmt.Sprintf("%s: is not active yet", e.SURL)
+}
+
+func (e *SURLAlreadyExistsError) Error() string {
+	return fmt.Sprintf("%s: short URL is already taken", e.SURL)
+}
+
+func (e *UserNotFoundError) Error() string {
+	return fmt.Sprintf("%s: user not found in storage", e.Login)
+}
+
+func (e *LoginAlreadyExistsError) Error() string {
+	return fmt.Sprintf("%s: login is already taken", e.Login)
+}
+
+func (e *APIKeyNotFoundError) Error() string {
+	if e.ID == "" {
+		return "API key not found in storage"
+	}
+	return fmt.Sprintf("%s: API key not found in storage", e.ID)
+}
+
+func (e *DomainNotFoundError) Error() string {
+	return fmt.Sprintf("%s: domain not found in storage", e.Name)
+}
+
+func (e *DomainAlreadyExistsError) Error() string {
+	return fmt.Sprintf("%s: domain is already registered", e.Name)
+}
+
+func (e *OrgNotFoundError) Error() string {
+	return fmt.Sprintf("%s: organization not found in storage", e.ID)
+}
+
+func (e *MemberNotFoundError) Error() string {
+	return fmt.Sprintf("%s: user is not a member of organization %s", e.UserID, e.OrgID)
+}
+
+func (e *TagNotFoundError) Error() string {
+	return fmt.Sprintf("%s: tag not found in storage", e.Tag)
+}
+
 func (e *ContextTimeoutExceededError) Error() string {
 	return fmt.Sprintf("%s: context timeout exceeded", e.Err.Error())
 }
 
+func (e *QueueClosedError) Error() string {
+	return fmt.Sprintf("%s: deletion task queue is shutting down", e.Err.Error())
+}
+
 func (e *ScanningPSQLError) Error() string {
 	return fmt.Sprintf("%s: could not scan rows", e.Err.Error())
 }
@@ -68,6 +186,10 @@ func (e *FileWriteError) Error() string {
 	return fmt.Sprintf("%s: could not add to file", e.Err.Error())
 }
 
+func (e *ExecutionRedisError) Error() string {
+	return fmt.Sprintf("%s: could not execute redis command", e.Err.Error())
+}
+
 func (e *NotFoundError) Unwrap() error {
 	return e.Err
 }
@@ -76,10 +198,66 @@ func (e *AlreadyExistsError) Unwrap() error {
 	return e.Err
 }
 
+func (e *SURLAlreadyExistsError) Unwrap() error {
+	return e.Err
+}
+
+func (e *ExpiredError) Unwrap() error {
+	return e.Err
+}
+
+func (e *DisabledError) Unwrap() error {
+	return e.Err
+}
+
+func (e *ExhaustedError) Unwrap() error {
+	return e.Err
+}
+
+func (e *NotActiveError) Unwrap() error {
+	return e.Err
+}
+
+func (e *UserNotFoundError) Unwrap() error {
+	return e.Err
+}
+
+func (e *LoginAlreadyExistsError) Unwrap() error {
+	return e.Err
+}
+
+func (e *APIKeyNotFoundError) Unwrap() error {
+	return e.Err
+}
+
+func (e *DomainNotFoundError) Unwrap() error {
+	return e.Err
+}
+
+func (e *DomainAlreadyExistsError) Unwrap() error {
+	return e.Err
+}
+
+func (e *OrgNotFoundError) Unwrap() error {
+	return e.Err
+}
+
+func (e *MemberNotFoundError) Unwrap() error {
+	return e.Err
+}
+
+func (e *TagNotFoundError) Unwrap() error {
+	return e.Err
+}
+
 func (e *ContextTimeoutExceededError) Unwrap() error {
 	return e.Err
 }
 
+func (e *QueueClosedError) Unwrap() error {
+	return e.Err
+}
+
 func (e *ScanningPSQLError) Unwrap() error {
 	return e.Err
 }
@@ -95,3 +273,7 @@ func (e *ExecutionPSQLError) Unwrap() error {
 func (e *FileWriteError) Unwrap() error {
 	return e.Err
 }
+
+func (e *ExecutionRedisError) Unwrap() error {
+	return e.Err
+}
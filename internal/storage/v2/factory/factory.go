@@ -0,0 +1,112 @@
+// Package factory provides initialization of the storage backend selected by the scheme of the storage URI.
+package factory
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/config"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/logger"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/storage/v2"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/storage/v2/infile"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/storage/v2/inpsql"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/storage/v2/inredis"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// storage backends reported by Backend
+const (
+	BackendPSQL  = "inpsql"
+	BackendRedis = "inredis"
+	BackendFile  = "infile"
+)
+
+// Backend returns the storage backend InitStorage selects for cfg.
+func Backend(cfg *config.StorageConfig) (string, error) {
+	backend, _, err := resolve(cfg)
+	return backend, err
+}
+
+// InitStorage initializes the storage backend selected by the scheme of cfg.StorageURI: postgres or postgresql for
+// PSQL DB, redis, rediss or unix for Redis DB and file for file storage. Without a storage URI the backend is selected
+// by the first set parameter of DatabaseDSN, RedisDSN and FileStoragePath. The backend is given a copy of cfg with
+// the parameter it connects by set from the storage URI.
+func InitStorage(ctx context.Context, wg *sync.WaitGroup, cfg *config.StorageConfig, log *logger.Logger) (storage.URLStorage, error) {
+	backend, resolved, err := resolve(cfg)
+	if err != nil {
+		return nil, err
+	}
+	log.Info("Initializing storage", logger.String("backend", backend))
+	switch backend {
+	case BackendPSQL:
+		st, err := inpsql.InitStorage(ctx, wg, resolved, log)
+		if err != nil {
+			return nil, err
+		}
+		return st, nil
+	case BackendRedis:
+		st, err := inredis.InitStorage(ctx, wg, resolved, log)
+		if err != nil {
+			return nil, err
+		}
+		return st, nil
+	default:
+		st, err := infile.InitStorage(ctx, wg, resolved, log)
+		if err != nil {
+			return nil, err
+		}
+		return st, nil
+	}
+}
+
+// resolve returns the storage backend selected by cfg and a copy of cfg to initialize it with.
+func resolve(cfg *config.StorageConfig) (backend string, resolved *config.StorageConfig, err error) {
+	c := *cfg
+	if c.StorageURI == "" {
+		switch {
+		case c.DatabaseDSN != "":
+			return BackendPSQL, &c, nil
+		case c.RedisDSN != "":
+			return BackendRedis, &c, nil
+		default:
+			return BackendFile, &c, nil
+		}
+	}
+	u, err := url.Parse(c.StorageURI)
+	if err != nil {
+		// do not leak credentials of the URI quoted by url.Error
+		var urlError *url.Error
+		if errors.As(err, &urlError) {
+			err = urlError.Err
+		}
+		return "", nil, fmt.Errorf("parsing storage URI: %w", err)
+	}
+	switch strings.ToLower(u.Scheme) {
+	case "postgres", "postgresql":
+		c.DatabaseDSN = c.StorageURI
+		return BackendPSQL, &c, nil
+	case "redis", "rediss", "unix":
+		backend = BackendRedis
+		c.RedisDSN = c.StorageURI
+	case "file":
+		backend = BackendFile
+		// file:///abs/path, file://rel/path and file:rel/path are accepted
+		c.FileStoragePath = u.Host + u.Path
+		if u.Opaque != "" {
+			c.FileStoragePath = u.Opaque
+		}
+		if c.FileStoragePath == "" {
+			return "", nil, fmt.Errorf("storage URI %q has no file path", u.Redacted())
+		}
+	case "":
+		return "", nil, fmt.Errorf("storage URI %q has no scheme", u.Redacted())
+	default:
+		return "", nil, fmt.Errorf("storage URI scheme %q is not supported, use postgres, redis or file", u.Scheme)
+	}
+	if len(c.DatabaseReplicaDSNs) > 0 {
+		return "", nil, fmt.Errorf("DATABASE_REPLICA_DSNS requires a PSQL DB storage, got %s", backend)
+	}
+	return backend, &c, nil
+}
@@ -0,0 +1,55 @@
+package filtering
+
+import (
+	"hash/fnv"
+	"math"
+)
+
+// bloom is a Bloom filter of strings, it is not safe for concurrent use.
+type bloom struct {
+	bits []uint64
+	m    uint64
+	k    uint64
+}
+
+// newBloom initializes a bloom sized for n strings at the false positive rate p.
+func newBloom(n int, p float64) *bloom {
+	if n < 1 {
+		n = 1
+	}
+	m := uint64(math.Ceil(-float64(n) * math.Log(p) / (math.Ln2 * math.Ln2)))
+	k := uint64(math.Round(float64(m) / float64(n) * math.Ln2))
+	if k < 1 {
+		k = 1
+	}
+	return &bloom{bits: make([]uint64, (m+63)/64), m: m, k: k}
+}
+
+// locations derives bit locations of s by double hashing of its 64-bit FNV-1a hash.
+func (b *bloom) locations(s string, fn func(bit uint64) bool) bool {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(s))
+	sum := h.Sum64()
+	h1, h2 := sum&math.MaxUint32, sum>>32
+	for i := uint64(0); i < b.k; i++ {
+		if !fn((h1 + i*h2) % b.m) {
+			return false
+		}
+	}
+	return true
+}
+
+// add adds s to the filter.
+func (b *bloom) add(s string) {
+	b.locations(s, func(bit uint64) bool {
+		b.bits[bit/64] |= 1 << (bit % 64)
+		return true
+	})
+}
+
+// mayContain reports whether s may have been added, false means s has certainly not been added.
+func (b *bloom) mayContain(s string) bool {
+	return b.locations(s, func(bit uint64) bool {
+		return b.bits[bit/64]&(1<<(bit%64)) != 0
+	})
+}
@@ -0,0 +1,25 @@
+package filtering
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBloom(t *testing.T) {
+	b := newBloom(1000, falsePositiveRate)
+	for i := 0; i < 1000; i++ {
+		b.add("stored" + strconv.Itoa(i))
+	}
+	for i := 0; i < 1000; i++ {
+		assert.True(t, b.mayContain("stored"+strconv.Itoa(i)))
+	}
+	falsePositives := 0
+	for i := 0; i < 10000; i++ {
+		if b.mayContain("missing" + strconv.Itoa(i)) {
+			falsePositives++
+		}
+	}
+	assert.Less(t, falsePositives, 300)
+}
@@ -0,0 +1,170 @@
+// Package filtering provides a storage.URLStorage wrapper answering lookups of sURLs which were never stored without
+// querying the storage, so that scanning random short codes does not load it.
+package filtering
+
+import (
+	"context"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/logger"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/storage/v2"
+	storageErrors "github.com/danilovkiri/dk_go_url_shortener/internal/storage/v2/errors"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/storage/v2/modelstorage"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// filter sizing parameters, filters are sized with headroom for entries created until the next rebuild
+const (
+	falsePositiveRate = 0.01
+	minCapacity       = 1024
+)
+
+// Storage struct wraps a storage.URLStorage and keeps a Bloom filter of all stored sURLs. The filter is rebuilt from
+// scratch periodically and entries stored through Storage are added to it right away, lookups of sURLs missing from
+// it are answered with storageErrors.NotFoundError. Lookups pass through until the filter is built for the first time.
+type Storage struct {
+	// filtered counts lookups answered by the filter, keep it first for 64-bit alignment
+	filtered uint64
+	storage.URLStorage
+	scanner storage.SURLScanner
+	log     *logger.Logger
+	mu      sync.RWMutex
+	filter  *bloom
+	// added collects sURLs stored while the filter is being rebuilt, it is nil otherwise
+	added []string
+}
+
+// InitStorage initializes a Storage object wrapping st, scanner lists sURLs the filter is built of.
+func InitStorage(st storage.URLStorage, scanner storage.SURLScanner, log *logger.Logger) *Storage {
+	return &Storage{URLStorage: st, scanner: scanner, log: log}
+}
+
+// Run builds the filter and rebuilds it every interval until ctx is done, so that it drops purged entries and picks
+// up entries stored by other instances. A failed build keeps the previous filter.
+func (s *Storage) Run(ctx context.Context, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		err := s.Rebuild(ctx)
+		if err != nil {
+			s.log.Error("Rebuilding lookup filter", logger.Error(err))
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
+
+// Rebuild builds the filter of all sURLs listed by the scanner and replaces the current one.
+func (s *Storage) Rebuild(ctx context.Context) error {
+	s.mu.Lock()
+	s.added = make([]string, 0)
+	s.mu.Unlock()
+	var sURLs []string
+	err := s.scanner.ScanSURLs(ctx, func(sURL string) error {
+		sURLs = append(sURLs, sURL)
+		return nil
+	})
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err != nil {
+		s.added = nil
+		return err
+	}
+	filter := newBloom(len(sURLs)+len(sURLs)/2+minCapacity, falsePositiveRate)
+	for _, sURL := range sURLs {
+		filter.add(sURL)
+	}
+	for _, sURL := range s.added {
+		filter.add(sURL)
+	}
+	s.filter, s.added = filter, nil
+	s.log.Info("Rebuilding lookup filter", logger.Int("count", len(sURLs)))
+	return nil
+}
+
+// Filtered returns the number of lookups answered by the filter without querying the storage.
+func (s *Storage) Filtered() uint64 {
+	return atomic.LoadUint64(&s.filtered)
+}
+
+// add adds sURLs to the filter, sURLs added while the filter is being rebuilt are added to the new filter too.
+func (s *Storage) add(sURLs ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.filter != nil {
+		for _, sURL := range sURLs {
+			s.filter.add(sURL)
+		}
+	}
+	if s.added != nil {
+		s.added = append(s.added, sURLs...)
+	}
+}
+
+// Retrieve returns the live entry corresponding to sURL, sURLs which were never stored are not looked up.
+func (s *Storage) Retrieve(ctx context.Context, sURL string) (modelstorage.URLMapEntry, error) {
+	s.mu.RLock()
+	filtered := s.filter != nil && !s.filter.mayContain(sURL)
+	s.mu.RUnlock()
+	if filtered {
+		atomic.AddUint64(&s.filtered, 1)
+		logger.FromContext(ctx, s.log).Debug("Retrieving URL: filtered out", logger.String("sURL", sURL))
+		return modelstorage.URLMapEntry{}, &storageErrors.NotFoundError{Err: nil, SURL: sURL}
+	}
+	return s.URLStorage.Retrieve(ctx, sURL)
+}
+
+// Dump adds the sURL of entry to the filter and stores entry. The sURL is added both before and after storing so that
+// the entry is filtered out neither while being stored nor by a filter rebuilt meanwhile, even when storing it
+// reports an error such as a timeout.
+func (s *Storage) Dump(ctx context.Context, entry modelstorage.URLStorageEntry) error {
+	s.add(entry.SURL)
+	defer s.add(entry.SURL)
+	return s.URLStorage.Dump(ctx, entry)
+}
+
+// DumpBatch adds sURLs of entries to the filter and stores entries the same way as Dump, existing sURLs returned for
+// URLs stored before are added as well.
+func (s *Storage) DumpBatch(ctx context.Context, entries []modelstorage.URLStorageEntry) ([]modelstorage.URLStorageEntry, error) {
+	sURLs := sURLsOf(entries)
+	s.add(sURLs...)
+	defer s.add(sURLs...)
+	stored, err := s.URLStorage.DumpBatch(ctx, entries)
+	if err != nil {
+		return nil, err
+	}
+	s.add(sURLsOf(stored)...)
+	return stored, nil
+}
+
+// ImportBatch adds sURLs of entries to the filter and imports entries the same way as Dump, existing sURLs returned
+// for URLs stored before are added as well.
+func (s *Storage) ImportBatch(ctx context.Context, entries []modelstorage.URLStorageEntry) ([]modelstorage.ImportResult, error) {
+	sURLs := sURLsOf(entries)
+	s.add(sURLs...)
+	defer s.add(sURLs...)
+	results, err := s.URLStorage.ImportBatch(ctx, entries)
+	if err != nil {
+		return nil, err
+	}
+	existing := make([]string, 0, len(results))
+	for _, result := range results {
+		if result.Status == modelstorage.ImportURLExists {
+			existing = append(existing, result.Entry.SURL)
+		}
+	}
+	s.add(existing...)
+	return results, nil
+}
+
+// sURLsOf returns sURLs of entries.
+func sURLsOf(entries []modelstorage.URLStorageEntry) []string {
+	sURLs := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		sURLs = append(sURLs, entry.SURL)
+	}
+	return sURLs
+}
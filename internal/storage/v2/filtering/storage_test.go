@@ -0,0 +1,75 @@
+package filtering
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/danilovkiri/dk_go_url_shortener/internal/logger"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/storage/v2"
+	storageErrors "github.com/danilovkiri/dk_go_url_shortener/internal/storage/v2/errors"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/storage/v2/modelstorage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// mapStorage keeps entries in a map and counts lookups reaching it.
+type mapStorage struct {
+	storage.URLStorage
+	entries map[string]string
+	lookups int
+}
+
+func (s *mapStorage) Retrieve(ctx context.Context, sURL string) (modelstorage.URLMapEntry, error) {
+	s.lookups++
+	URL, ok := s.entries[sURL]
+	if !ok {
+		return modelstorage.URLMapEntry{}, &storageErrors.NotFoundError{SURL: sURL}
+	}
+	return modelstorage.URLMapEntry{URL: URL}, nil
+}
+
+func (s *mapStorage) Dump(ctx context.Context, entry modelstorage.URLStorageEntry) error {
+	s.entries[entry.SURL] = entry.URL
+	return nil
+}
+
+func (s *mapStorage) ScanSURLs(ctx context.Context, fn func(sURL string) error) error {
+	for sURL := range s.entries {
+		if err := fn(sURL); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func TestStorageFiltersMissingSURLs(t *testing.T) {
+	st := &mapStorage{entries: map[string]string{"abc": "https://example.com"}}
+	log, _ := logger.New(io.Discard, logger.LevelInfo, logger.FormatText)
+	s := InitStorage(st, st, log)
+	ctx := context.Background()
+
+	// lookups pass through until the filter is built
+	_, err := s.Retrieve(ctx, "missing")
+	var notFoundError *storageErrors.NotFoundError
+	assert.True(t, errors.As(err, &notFoundError))
+	assert.Equal(t, 1, st.lookups)
+
+	require.NoError(t, s.Rebuild(ctx))
+	_, err = s.Retrieve(ctx, "missing")
+	assert.True(t, errors.As(err, &notFoundError))
+	assert.Equal(t, 1, st.lookups)
+	assert.Equal(t, uint64(1), s.Filtered())
+
+	entry, err := s.Retrieve(ctx, "abc")
+	require.NoError(t, err)
+	assert.Equal(t, "https://example.com", entry.URL)
+	assert.Equal(t, 2, st.lookups)
+
+	// entries stored after the build are found right away
+	require.NoError(t, s.Dump(ctx, modelstorage.URLStorageEntry{SURL: "def", URL: "https://example.org"}))
+	entry, err = s.Retrieve(ctx, "def")
+	require.NoError(t, err)
+	assert.Equal(t, "https://example.org", entry.URL)
+}
@@ -0,0 +1,74 @@
+// Package hll provides HyperLogLog sketches estimating the number of distinct keys added to them, they are used to
+// count unique visitors by storages lacking native ones.
+package hll
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"math/bits"
+)
+
+// precision sets the number of index bits of key hashes, sketches of 2^precision one-byte registers estimate with a
+// standard error of about 1.6%.
+const (
+	precision = 12
+	registers = 1 << precision
+)
+
+// Sketch holds HyperLogLog registers, it is stored as is.
+type Sketch []byte
+
+// New returns an empty sketch.
+func New() Sketch {
+	return make(Sketch, registers)
+}
+
+// Parse checks b holds a stored sketch and returns it without copying.
+func Parse(b []byte) (Sketch, error) {
+	if len(b) != registers {
+		return nil, fmt.Errorf("hll: sketch of %d bytes, expected %d", len(b), registers)
+	}
+	return b, nil
+}
+
+// Add adds key to the sketch.
+func (s Sketch) Add(key string) {
+	sum := sha256.Sum256([]byte(key))
+	h := binary.BigEndian.Uint64(sum[:8])
+	i := h >> (64 - precision)
+	// the guard bit bounds the rank of hashes whose remaining bits are all zeros
+	rank := uint8(bits.LeadingZeros64(h<<precision|1<<(precision-1))) + 1
+	if rank > s[i] {
+		s[i] = rank
+	}
+}
+
+// Merge adds all keys added to other to the sketch.
+func (s Sketch) Merge(other Sketch) {
+	for i, rank := range other {
+		if rank > s[i] {
+			s[i] = rank
+		}
+	}
+}
+
+// Count returns the estimated number of distinct keys added to the sketch, small numbers are estimated by linear
+// counting.
+func (s Sketch) Count() int {
+	const m = float64(registers)
+	sum := 0.0
+	zeros := 0
+	for _, rank := range s {
+		sum += math.Ldexp(1, -int(rank))
+		if rank == 0 {
+			zeros++
+		}
+	}
+	estimate := 0.7213 / (1 + 1.079/m) * m * m / sum
+	if estimate <= 2.5*m && zeros > 0 {
+		estimate = m * math.Log(m/float64(zeros))
+	}
+	return int(math.Round(estimate))
+}
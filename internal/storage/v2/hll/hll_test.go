@@ -0,0 +1,46 @@
+package hll
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSketch(t *testing.T) {
+	s := New()
+	assert.Equal(t, 0, s.Count())
+	// repeated keys are counted once
+	for i := 0; i < 3; i++ {
+		s.Add("visitor-1")
+		s.Add("visitor-2")
+	}
+	assert.Equal(t, 2, s.Count())
+
+	for _, n := range []int{1000, 100000} {
+		s = New()
+		for i := 0; i < n; i++ {
+			s.Add(strconv.Itoa(i))
+		}
+		assert.InEpsilon(t, n, s.Count(), 0.05, "%d keys", n)
+	}
+}
+
+func TestSketchMerge(t *testing.T) {
+	a, b := New(), New()
+	for i := 0; i < 3000; i++ {
+		a.Add(strconv.Itoa(i))
+	}
+	for i := 2000; i < 5000; i++ {
+		b.Add(strconv.Itoa(i))
+	}
+	a.Merge(b)
+	assert.InEpsilon(t, 5000, a.Count(), 0.05)
+
+	parsed, err := Parse([]byte(a))
+	require.NoError(t, err)
+	assert.Equal(t, a.Count(), parsed.Count())
+	_, err = Parse([]byte{1, 2, 3})
+	assert.Error(t, err)
+}
@@ -5,12 +5,15 @@ import (
 	"context"
 	"encoding/json"
 	"github.com/danilovkiri/dk_go_url_shortener/internal/config"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/logger"
 	"github.com/danilovkiri/dk_go_url_shortener/internal/service/modelurl"
 	storageErrors "github.com/danilovkiri/dk_go_url_shortener/internal/storage/v2/errors"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/storage/v2/hll"
 	"github.com/danilovkiri/dk_go_url_shortener/internal/storage/v2/modelstorage"
-	"log"
 	"os"
+	"sort"
 	"sync"
+	"time"
 )
 
 // Storage struct defines data structure handling and provides support for adding new implementations.
@@ -19,44 +22,222 @@ type Storage struct {
 	Cfg     *config.StorageConfig
 	DB      map[string]modelstorage.URLMapEntry
 	Encoder *json.Encoder
+	// clicks, hourlyClicks, destinationClicks, referrerClicks and countryClicks hold redirect counts per sURL and day,
+	// hour, served destination, referrer domain or visitor country keyed by modelstorage.CountKey, they are kept in
+	// memory only
+	clicks            map[string]map[string]int
+	hourlyClicks      map[string]map[string]int
+	destinationClicks map[string]map[string]int
+	referrerClicks    map[string]map[string]int
+	countryClicks     map[string]map[string]int
+	// visitors holds sketches of visitors redirected per sURL and day, they are kept in memory only as well
+	visitors map[string]map[string]hll.Sketch
+	// users holds registered accounts by login, they are persisted in a separate file next to the URL one
+	users       map[string]modelstorage.UserEntry
+	userEncoder *json.Encoder
+	// apiKeys holds API keys by hash, every change is appended to a separate file and the last record of a key wins
+	apiKeys       map[string]modelstorage.APIKeyEntry
+	apiKeyEncoder *json.Encoder
+	// domains holds claims of custom domains by name and user ID, they are persisted the same way API keys are
+	domains       map[string]map[string]modelstorage.DomainEntry
+	domainEncoder *json.Encoder
+	// settings holds user settings by user ID, they are persisted the same way API keys are
+	settings        map[string]modelstorage.UserSettingsEntry
+	settingsEncoder *json.Encoder
+	// orgs holds organizations by ID and members holds their memberships by organization and user IDs, every change
+	// is appended to a separate file as an orgRecord
+	orgs       map[string]modelstorage.OrgEntry
+	members    map[string]map[string]modelstorage.MemberEntry
+	orgEncoder *json.Encoder
+	// audit holds records of mutating operations in the order they were appended to a separate file
+	audit        []modelstorage.AuditEntry
+	auditEncoder *json.Encoder
+	log          *logger.Logger
+	// Events reports purged and disabled entries, deletion is not supported by infile DB handling
+	modelstorage.Events
+}
+
+// suffixes appended to FileStoragePath to get the paths of files storing user accounts, API keys, custom domains,
+// user settings, organizations and audit records
+const (
+	usersFileSuffix    = ".users"
+	apiKeysFileSuffix  = ".keys"
+	domainsFileSuffix  = ".domains"
+	settingsFileSuffix = ".settings"
+	orgsFileSuffix     = ".orgs"
+	auditFileSuffix    = ".audit"
+)
+
+// orgRecord defines one change of organizations appended to the organizations file: a created organization, a stored
+// membership or a removed one.
+type orgRecord struct {
+	Org     *modelstorage.OrgEntry    `json:"org,omitempty"`
+	Member  *modelstorage.MemberEntry `json:"member,omitempty"`
+	Removed bool                      `json:"removed,omitempty"`
 }
 
 // InitStorage initializes a Storage object and sets its attributes.
-func InitStorage(ctx context.Context, wg *sync.WaitGroup, cfg *config.StorageConfig) (*Storage, error) {
+func InitStorage(ctx context.Context, wg *sync.WaitGroup, cfg *config.StorageConfig, log *logger.Logger) (*Storage, error) {
 	db := make(map[string]modelstorage.URLMapEntry)
 	st := Storage{
-		Cfg: cfg,
-		DB:  db,
+		Cfg:               cfg,
+		DB:                db,
+		clicks:            make(map[string]map[string]int),
+		hourlyClicks:      make(map[string]map[string]int),
+		destinationClicks: make(map[string]map[string]int),
+		referrerClicks:    make(map[string]map[string]int),
+		countryClicks:     make(map[string]map[string]int),
+		visitors:          make(map[string]map[string]hll.Sketch),
+		users:             make(map[string]modelstorage.UserEntry),
+		apiKeys:           make(map[string]modelstorage.APIKeyEntry),
+		domains:           make(map[string]map[string]modelstorage.DomainEntry),
+		settings:          make(map[string]modelstorage.UserSettingsEntry),
+		orgs:              make(map[string]modelstorage.OrgEntry),
+		members:           make(map[string]map[string]modelstorage.MemberEntry),
+		log:               log,
 	}
 	err := st.restore()
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
+	}
+	err = st.restoreUsers()
+	if err != nil {
+		return nil, err
+	}
+	err = st.restoreAPIKeys()
+	if err != nil {
+		return nil, err
+	}
+	err = st.restoreDomains()
+	if err != nil {
+		return nil, err
+	}
+	err = st.restoreSettings()
+	if err != nil {
+		return nil, err
+	}
+	err = st.restoreOrgs()
+	if err != nil {
+		return nil, err
+	}
+	err = st.restoreAudit()
+	if err != nil {
+		return nil, err
 	}
 	// open file outside of goroutine since this operation might not finish prior to encoding operations
 	file, err := os.OpenFile(st.Cfg.FileStoragePath, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0777)
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
 	// set an encoder
 	st.Encoder = json.NewEncoder(file)
-	// start a goroutine to listen for ctx cancellation followed by file storage closure,
-	// use sync.WaitGroup to prevent goroutine premature termination when main exits
+	// the other files hold password and API key hashes, they are only accessible by the owner
+	usersFile, err := os.OpenFile(st.Cfg.FileStoragePath+usersFileSuffix, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	st.userEncoder = json.NewEncoder(usersFile)
+	apiKeysFile, err := os.OpenFile(st.Cfg.FileStoragePath+apiKeysFileSuffix, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		file.Close()
+		usersFile.Close()
+		return nil, err
+	}
+	st.apiKeyEncoder = json.NewEncoder(apiKeysFile)
+	domainsFile, err := os.OpenFile(st.Cfg.FileStoragePath+domainsFileSuffix, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		file.Close()
+		usersFile.Close()
+		apiKeysFile.Close()
+		return nil, err
+	}
+	st.domainEncoder = json.NewEncoder(domainsFile)
+	settingsFile, err := os.OpenFile(st.Cfg.FileStoragePath+settingsFileSuffix, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		file.Close()
+		usersFile.Close()
+		apiKeysFile.Close()
+		domainsFile.Close()
+		return nil, err
+	}
+	st.settingsEncoder = json.NewEncoder(settingsFile)
+	orgsFile, err := os.OpenFile(st.Cfg.FileStoragePath+orgsFileSuffix, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		file.Close()
+		usersFile.Close()
+		apiKeysFile.Close()
+		domainsFile.Close()
+		settingsFile.Close()
+		return nil, err
+	}
+	st.orgEncoder = json.NewEncoder(orgsFile)
+	auditFile, err := os.OpenFile(st.Cfg.FileStoragePath+auditFileSuffix, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		file.Close()
+		usersFile.Close()
+		apiKeysFile.Close()
+		domainsFile.Close()
+		settingsFile.Close()
+		orgsFile.Close()
+		return nil, err
+	}
+	st.auditEncoder = json.NewEncoder(auditFile)
+	// start a goroutine purging expired entries periodically and listening for ctx cancellation followed by file
+	// storage closure, use sync.WaitGroup to prevent goroutine premature termination when main exits
 	go func() {
 		defer wg.Done()
-		<-ctx.Done()
-		err := file.Close()
-		if err != nil {
-			log.Fatal(err)
+		t := time.NewTicker(st.Cfg.ExpiredPurgeInterval)
+		defer t.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				// close all files even if the first closure fails
+				errURLs := file.Close()
+				if errURLs != nil {
+					st.log.Error("Closing file storage", logger.Error(errURLs))
+				}
+				errUsers := usersFile.Close()
+				if errUsers != nil {
+					st.log.Error("Closing file storage", logger.Error(errUsers))
+				}
+				errAPIKeys := apiKeysFile.Close()
+				if errAPIKeys != nil {
+					st.log.Error("Closing file storage", logger.Error(errAPIKeys))
+				}
+				errDomains := domainsFile.Close()
+				if errDomains != nil {
+					st.log.Error("Closing file storage", logger.Error(errDomains))
+				}
+				errSettings := settingsFile.Close()
+				if errSettings != nil {
+					st.log.Error("Closing file storage", logger.Error(errSettings))
+				}
+				errOrgs := orgsFile.Close()
+				if errOrgs != nil {
+					st.log.Error("Closing file storage", logger.Error(errOrgs))
+				}
+				errAudit := auditFile.Close()
+				if errAudit != nil {
+					st.log.Error("Closing file storage", logger.Error(errAudit))
+				}
+				if errURLs != nil || errUsers != nil || errAPIKeys != nil || errDomains != nil || errSettings != nil || errOrgs != nil || errAudit != nil {
+					return
+				}
+				st.log.Info("File storage closed successfully")
+				return
+			case <-t.C:
+				st.purgeExpired()
+			}
 		}
-		log.Println("File storage closed successfully")
 	}()
 	return &st, nil
 }
 
-// Retrieve returns a URL corresponding to sURL.
-func (s *Storage) Retrieve(ctx context.Context, sURL string) (URL string, err error) {
+// Retrieve returns the live entry corresponding to sURL.
+func (s *Storage) Retrieve(ctx context.Context, sURL string) (entry modelstorage.URLMapEntry, err error) {
 	// create channels for listening to the go routine result
-	retrieveDone := make(chan string)
+	retrieveDone := make(chan modelstorage.URLMapEntry)
 	retrieveError := make(chan error)
 	go func() {
 		s.mu.Lock()
@@ -66,69 +247,301 @@ func (s *Storage) Retrieve(ctx context.Context, sURL string) (URL string, err er
 			retrieveError <- &storageErrors.NotFoundError{Err: nil, SURL: sURL}
 			return
 		}
-		retrieveDone <- URLMapEntry.URL
+		if URLMapEntry.DisabledAt != nil {
+			retrieveError <- &storageErrors.DisabledError{Err: nil, SURL: sURL}
+			return
+		}
+		if modelstorage.IsExpired(URLMapEntry.ExpiresAt) {
+			retrieveError <- &storageErrors.ExpiredError{Err: nil, SURL: sURL}
+			return
+		}
+		if modelstorage.IsExhausted(URLMapEntry.MaxClicks, URLMapEntry.ClickCount) {
+			retrieveError <- &storageErrors.ExhaustedError{Err: nil, SURL: sURL}
+			return
+		}
+		if modelstorage.IsNotActive(URLMapEntry.ActiveFrom) {
+			retrieveError <- &storageErrors.NotActiveError{Err: nil, SURL: sURL}
+			return
+		}
+		retrieveDone <- URLMapEntry
 	}()
 
 	// wait for the first channel to retrieve a value
 	select {
 	case <-ctx.Done():
-		log.Println("Retrieving URL:", ctx.Err())
-		return "", &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
+		s.logger(ctx).Warn("Retrieving URL", logger.Error(ctx.Err()))
+		return modelstorage.URLMapEntry{}, &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
 	case rtrvError := <-retrieveError:
-		log.Println("Retrieving URL:", rtrvError.Error())
-		return "", rtrvError
-	case URL := <-retrieveDone:
-		log.Println("Retrieving URL:", sURL, "as", URL)
-		return URL, nil
+		s.logger(ctx).Warn("Retrieving URL", logger.Error(rtrvError))
+		return modelstorage.URLMapEntry{}, rtrvError
+	case entry := <-retrieveDone:
+		s.logger(ctx).Debug("Retrieving URL", logger.String("sURL", sURL), logger.String("url", entry.URL))
+		return entry, nil
 	}
 }
 
-// RetrieveByUserID returns a slice of URL:sURL pairs defined as modelurl.FullURL for one particular user ID.
-func (s *Storage) RetrieveByUserID(ctx context.Context, userID string) (URLs []modelurl.FullURL, err error) {
+// RetrieveOwner returns the user who created sURL and the organization it belongs to whatever the state of the link.
+func (s *Storage) RetrieveOwner(ctx context.Context, sURL string) (userID, orgID string, err error) {
 	// create channels for listening to the go routine result
-	retrieveDone := make(chan []modelurl.FullURL)
+	retrieveDone := make(chan [2]string, 1)
+	retrieveError := make(chan error, 1)
 	go func() {
 		s.mu.Lock()
 		defer s.mu.Unlock()
-		var URLs []modelurl.FullURL
-		for sURL, URL := range s.DB {
-			if URL.UserID == userID {
-				fullURL := modelurl.FullURL{
-					URL:  URL.URL,
-					SURL: sURL,
-				}
-				URLs = append(URLs, fullURL)
-			}
+		entry, ok := s.DB[sURL]
+		if !ok {
+			retrieveError <- &storageErrors.NotFoundError{Err: nil, SURL: sURL}
+			return
 		}
-		retrieveDone <- URLs
+		retrieveDone <- [2]string{entry.UserID, entry.OrgID}
+	}()
+
+	// wait for the first channel to retrieve a value
+	select {
+	case <-ctx.Done():
+		s.logger(ctx).Warn("Retrieving URL owner", logger.Error(ctx.Err()))
+		return "", "", &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
+	case rtrvError := <-retrieveError:
+		s.logger(ctx).Warn("Retrieving URL owner", logger.Error(rtrvError))
+		return "", "", rtrvError
+	case owner := <-retrieveDone:
+		s.logger(ctx).Debug("Retrieving URL owner", logger.String("sURL", sURL), logger.String("userID", owner[0]))
+		return owner[0], owner[1], nil
+	}
+}
+
+// RetrieveByUserID returns a page of URL:sURL pairs defined as modelurl.FullURL for one particular user ID sorted by
+// creation time.
+func (s *Storage) RetrieveByUserID(ctx context.Context, userID string, opts modelurl.ListOptions) (URLs []modelurl.FullURL, err error) {
+	// create channels for listening to the go routine result
+	retrieveDone := make(chan []modelurl.FullURL)
+	go func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		retrieveDone <- s.pageURLs(func(_ string, URL modelstorage.URLMapEntry) bool { return URL.UserID == userID }, opts)
+	}()
+
+	// wait for the first channel to retrieve a value
+	select {
+	case <-ctx.Done():
+		s.logger(ctx).Warn("Retrieving URLs by UserID", logger.Error(ctx.Err()))
+		return nil, &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
+	case URLs := <-retrieveDone:
+		s.logger(ctx).Debug("Retrieving URLs by UserID", logger.String("userID", userID), logger.Int("count", len(URLs)))
+		return URLs, nil
+	}
+}
+
+// SearchByUserID returns a page of URL:sURL pairs of one particular user having a word starting with each of terms in
+// their title, tags or URL ranked by relevance.
+func (s *Storage) SearchByUserID(ctx context.Context, userID string, terms []string, opts modelurl.ListOptions) (URLs []modelurl.FullURL, err error) {
+	// create channels for listening to the go routine result
+	retrieveDone := make(chan []modelurl.FullURL, 1)
+	go func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		listed := s.listURLs(func(_ string, URL modelstorage.URLMapEntry) bool { return URL.UserID == userID })
+		retrieveDone <- modelstorage.RankURLs(listed, terms, opts)
+	}()
+
+	// wait for the first channel to retrieve a value
+	select {
+	case <-ctx.Done():
+		s.logger(ctx).Warn("Searching URLs by UserID", logger.Error(ctx.Err()))
+		return nil, &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
+	case URLs := <-retrieveDone:
+		s.logger(ctx).Debug("Searching URLs by UserID", logger.String("userID", userID), logger.Int("count", len(URLs)))
+		return URLs, nil
+	}
+}
+
+// RetrieveByOrgID returns a page of URL:sURL pairs defined as modelurl.FullURL of one particular organization sorted
+// by creation time.
+func (s *Storage) RetrieveByOrgID(ctx context.Context, orgID string, opts modelurl.ListOptions) (URLs []modelurl.FullURL, err error) {
+	// create channels for listening to the go routine result
+	retrieveDone := make(chan []modelurl.FullURL, 1)
+	go func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		retrieveDone <- s.pageURLs(func(_ string, URL modelstorage.URLMapEntry) bool { return URL.OrgID == orgID }, opts)
+	}()
+
+	// wait for the first channel to retrieve a value
+	select {
+	case <-ctx.Done():
+		s.logger(ctx).Warn("Retrieving URLs by OrgID", logger.Error(ctx.Err()))
+		return nil, &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
+	case URLs := <-retrieveDone:
+		s.logger(ctx).Debug("Retrieving URLs by OrgID", logger.String("orgID", orgID), logger.Int("count", len(URLs)))
+		return URLs, nil
+	}
+}
+
+// SearchURLs returns a page of URL:sURL pairs of all users whose URL or sURL contains query sorted by creation time.
+func (s *Storage) SearchURLs(ctx context.Context, query string, opts modelurl.ListOptions) (URLs []modelurl.FullURL, err error) {
+	// create channels for listening to the go routine result
+	retrieveDone := make(chan []modelurl.FullURL, 1)
+	go func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		retrieveDone <- s.pageURLs(func(sURL string, URL modelstorage.URLMapEntry) bool {
+			return modelstorage.MatchesQuery(URL.URL, sURL, query)
+		}, opts)
 	}()
 
 	// wait for the first channel to retrieve a value
 	select {
 	case <-ctx.Done():
-		log.Println("Retrieving URLs by UserID:", ctx.Err())
+		s.logger(ctx).Warn("Searching URLs", logger.Error(ctx.Err()))
 		return nil, &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
 	case URLs := <-retrieveDone:
-		log.Println("Retrieving URL by UserID:", URLs)
+		s.logger(ctx).Debug("Searching URLs", logger.String("query", query), logger.Int("count", len(URLs)))
 		return URLs, nil
 	}
 }
 
+// pageURLs returns the page of live URL:sURL pairs matching match defined by opts, it must be called under the lock.
+func (s *Storage) pageURLs(match func(sURL string, URL modelstorage.URLMapEntry) bool, opts modelurl.ListOptions) []modelurl.FullURL {
+	return modelstorage.PageURLs(s.listURLs(match), opts)
+}
+
+// listURLs returns live URL:sURL pairs matching match, it must be called under the lock.
+func (s *Storage) listURLs(match func(sURL string, URL modelstorage.URLMapEntry) bool) []modelstorage.ListedURL {
+	var listed []modelstorage.ListedURL
+	for sURL, URL := range s.DB {
+		if match(sURL, URL) && !modelstorage.IsExpired(URL.ExpiresAt) {
+			fullURL := modelurl.FullURL{
+				URL:            URL.URL,
+				SURL:           sURL,
+				Title:          URL.Title,
+				FaviconURL:     URL.FaviconURL,
+				Disabled:       URL.DisabledAt != nil,
+				Domain:         URL.Domain,
+				UserID:         URL.UserID,
+				Tags:           URL.Tags,
+				LastAccessedAt: URL.LastAccessedAt,
+				ArchivedAt:     URL.ArchivedAt,
+			}
+			listed = append(listed, modelstorage.ListedURL{FullURL: fullURL, CreatedAt: URL.CreatedAt})
+		}
+	}
+	return listed
+}
+
+// ExportByUserID passes every URL:sURL pair of one particular user to fn, pairs are copied out of the map first so
+// that fn is not called under the lock. fn is called synchronously and the first error it returns stops the export.
+func (s *Storage) ExportByUserID(ctx context.Context, userID string, fn func(URL modelurl.FullURL) error) error {
+	s.mu.Lock()
+	var URLs []modelurl.FullURL
+	for sURL, URL := range s.DB {
+		if URL.UserID == userID && !modelstorage.IsExpired(URL.ExpiresAt) {
+			URLs = append(URLs, modelurl.FullURL{URL: URL.URL, SURL: sURL, Domain: URL.Domain})
+		}
+	}
+	s.mu.Unlock()
+	for _, URL := range URLs {
+		if ctx.Err() != nil {
+			s.logger(ctx).Warn("Exporting URLs by UserID", logger.Error(ctx.Err()))
+			return &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
+		}
+		if err := fn(URL); err != nil {
+			s.logger(ctx).Warn("Exporting URLs by UserID", logger.Error(err))
+			return err
+		}
+	}
+	s.logger(ctx).Debug("Exporting URLs by UserID", logger.String("userID", userID), logger.Int("count", len(URLs)))
+	return nil
+}
+
+// ScanURLs passes every URL:sURL pair which is neither expired nor disabled to fn, pairs are copied out of the map
+// first so that fn is not called under the lock. fn is called synchronously and the first error it returns stops the
+// scan.
+func (s *Storage) ScanURLs(ctx context.Context, fn func(URL modelurl.FullURL) error) error {
+	s.mu.Lock()
+	var URLs []modelurl.FullURL
+	for sURL, URL := range s.DB {
+		if URL.DisabledAt == nil && !modelstorage.IsExpired(URL.ExpiresAt) {
+			URLs = append(URLs, modelurl.FullURL{URL: URL.URL, SURL: sURL})
+		}
+	}
+	s.mu.Unlock()
+	for _, URL := range URLs {
+		if ctx.Err() != nil {
+			s.logger(ctx).Warn("Scanning URLs", logger.Error(ctx.Err()))
+			return &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
+		}
+		if err := fn(URL); err != nil {
+			s.logger(ctx).Warn("Scanning URLs", logger.Error(err))
+			return err
+		}
+	}
+	s.logger(ctx).Debug("Scanning URLs", logger.Int("count", len(URLs)))
+	return nil
+}
+
+// ScanSURLs passes sURLs of all entries to fn, sURLs are copied out of the map first so that fn is not called under the
+// lock. fn is called synchronously and the first error it returns stops the scan.
+func (s *Storage) ScanSURLs(ctx context.Context, fn func(sURL string) error) error {
+	s.mu.Lock()
+	sURLs := make([]string, 0, len(s.DB))
+	for sURL := range s.DB {
+		sURLs = append(sURLs, sURL)
+	}
+	s.mu.Unlock()
+	for _, sURL := range sURLs {
+		if ctx.Err() != nil {
+			s.logger(ctx).Warn("Scanning sURLs", logger.Error(ctx.Err()))
+			return &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
+		}
+		if err := fn(sURL); err != nil {
+			s.logger(ctx).Warn("Scanning sURLs", logger.Error(err))
+			return err
+		}
+	}
+	s.logger(ctx).Debug("Scanning sURLs", logger.Int("count", len(sURLs)))
+	return nil
+}
+
+// ScanEntries passes all entries to fn, deletion is not supported by infile DB handling so none of them is deleted.
+// Entries are copied out of the map first so that fn is not called under the lock. fn is called synchronously and the
+// first error it returns stops the scan.
+func (s *Storage) ScanEntries(ctx context.Context, fn func(entry modelstorage.URLStorageEntry, deleted bool) error) error {
+	s.mu.Lock()
+	entries := make([]modelstorage.URLStorageEntry, 0, len(s.DB))
+	for sURL, URL := range s.DB {
+		entries = append(entries, modelstorage.StorageEntry(sURL, URL))
+	}
+	s.mu.Unlock()
+	for _, entry := range entries {
+		if ctx.Err() != nil {
+			s.logger(ctx).Warn("Scanning entries", logger.Error(ctx.Err()))
+			return &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
+		}
+		if err := fn(entry, false); err != nil {
+			s.logger(ctx).Warn("Scanning entries", logger.Error(err))
+			return err
+		}
+	}
+	s.logger(ctx).Debug("Scanning entries", logger.Int("count", len(entries)))
+	return nil
+}
+
 // Dump stores a pair of sURL and URL as a key-value pair.
-func (s *Storage) Dump(ctx context.Context, URL string, sURL string, userID string) error {
+func (s *Storage) Dump(ctx context.Context, entry modelstorage.URLStorageEntry) error {
 	// create channels for listening to the go routine result
 	dumpDone := make(chan bool)
 	dumpError := make(chan error)
 	go func() {
 		s.mu.Lock()
 		defer s.mu.Unlock()
-		_, ok := s.DB[sURL]
+		_, ok := s.DB[entry.SURL]
 		if ok {
-			dumpError <- &storageErrors.AlreadyExistsError{Err: nil, URL: sURL, ValidSURL: ""}
+			dumpError <- &storageErrors.SURLAlreadyExistsError{Err: nil, SURL: entry.SURL}
 			return
 		}
-		s.DB[sURL] = modelstorage.URLMapEntry{URL: URL, UserID: userID}
-		err := s.addToFileDB(sURL, URL, userID)
+		entry = stamp(entry)
+		s.DB[entry.SURL] = mapEntry(entry)
+		err := s.addToFileDB(entry)
 		if err != nil {
 			dumpError <- &storageErrors.FileWriteError{Err: err}
 			return
@@ -139,65 +552,1891 @@ func (s *Storage) Dump(ctx context.Context, URL string, sURL string, userID stri
 	// wait for the first channel to retrieve a value
 	select {
 	case <-ctx.Done():
-		log.Println("Dumping URL:", ctx.Err())
+		s.logger(ctx).Warn("Dumping URL", logger.Error(ctx.Err()))
 		return &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
 	case dmpError := <-dumpError:
-		log.Println("Dumping URL:", dmpError.Error())
+		s.logger(ctx).Warn("Dumping URL", logger.Error(dmpError))
 		return dmpError
 	case <-dumpDone:
-		log.Println("Dumping URL:", sURL, "as", URL)
+		s.logger(ctx).Debug("Dumping URL", logger.String("sURL", entry.SURL), logger.String("url", entry.URL))
 		return nil
 	}
 }
 
-// DeleteBatch is a mock for PSQL DB batch deleter for infile DB handling.
-func (s *Storage) DeleteBatch(ctx context.Context, sURLs []string, userID string) error {
-	return nil
-}
+// UpdateMetadata sets the destination page title and favicon URL of sURL, the whole entry is appended to the file DB
+// again so that its last record carries the metadata on restore.
+func (s *Storage) UpdateMetadata(ctx context.Context, sURL, title, faviconURL string) error {
+	// create channels for listening to the go routine result
+	updateDone := make(chan bool, 1)
+	updateError := make(chan error, 1)
+	go func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		mapped, ok := s.DB[sURL]
+		if !ok {
+			updateError <- &storageErrors.NotFoundError{Err: nil, SURL: sURL}
+			return
+		}
+		mapped.Title = title
+		mapped.FaviconURL = faviconURL
+		err := s.addToFileDB(modelstorage.StorageEntry(sURL, mapped))
+		if err != nil {
+			updateError <- &storageErrors.FileWriteError{Err: err}
+			return
+		}
+		s.DB[sURL] = mapped
+		updateDone <- true
+	}()
 
-// SendToQueue is a mock for PSQL DB batch concurrent deleter for infile DB handling.
-func (s *Storage) SendToQueue(item modelstorage.URLChannelEntry) {
+	// wait for the first channel to retrieve a value
+	select {
+	case <-ctx.Done():
+		s.logger(ctx).Warn("Updating URL metadata", logger.Error(ctx.Err()))
+		return &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
+	case updError := <-updateError:
+		s.logger(ctx).Warn("Updating URL metadata", logger.Error(updError))
+		return updError
+	case <-updateDone:
+		s.logger(ctx).Debug("Updating URL metadata", logger.String("sURL", sURL))
+		return nil
+	}
 }
 
-// restore fills the tmpfs DB with URL-sURL entries from file storage.
-func (s *Storage) restore() error {
-	var storageEntries []modelstorage.URLStorageEntry
-	file, err := os.OpenFile(s.Cfg.FileStoragePath, os.O_RDONLY|os.O_CREATE, 0777)
-	if err != nil {
-		return err
-	}
-	defer file.Close()
-	reader := bufio.NewScanner(file)
-	for reader.Scan() {
-		var storageEntry modelstorage.URLStorageEntry
-		err := json.Unmarshal(reader.Bytes(), &storageEntry)
+// UpdateURL changes the destination of a live entry of sURL owned by userID to URL and returns the former destination,
+// entries of other users are reported missing. The whole entry is appended to the file DB again, so that its earlier
+// records keep the edit history.
+func (s *Storage) UpdateURL(ctx context.Context, sURL, userID, URL string) (previous string, err error) {
+	// create channels for listening to the go routine result
+	updateDone := make(chan string, 1)
+	updateError := make(chan error, 1)
+	go func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		mapped, ok := s.DB[sURL]
+		if !ok || mapped.UserID != userID || modelstorage.IsExpired(mapped.ExpiresAt) {
+			updateError <- &storageErrors.NotFoundError{Err: nil, SURL: sURL}
+			return
+		}
+		previous := mapped.URL
+		editedAt := time.Now()
+		mapped.URL = URL
+		mapped.EditedAt = &editedAt
+		// metadata of the former destination page is dropped, the first destination of split links is the URL itself
+		mapped.Title = ""
+		mapped.FaviconURL = ""
+		if len(mapped.Destinations) > 0 {
+			mapped.Destinations = append([]modelurl.Destination(nil), mapped.Destinations...)
+			mapped.Destinations[0].URL = URL
+		}
+		err := s.addToFileDB(modelstorage.StorageEntry(sURL, mapped))
 		if err != nil {
-			return err
+			updateError <- &storageErrors.FileWriteError{Err: err}
+			return
 		}
-		storageEntries = append(storageEntries, storageEntry)
+		s.DB[sURL] = mapped
+		updateDone <- previous
+	}()
+
+	// wait for the first channel to retrieve a value
+	select {
+	case <-ctx.Done():
+		s.logger(ctx).Warn("Updating URL", logger.Error(ctx.Err()))
+		return "", &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
+	case updError := <-updateError:
+		s.logger(ctx).Warn("Updating URL", logger.Error(updError))
+		return "", updError
+	case previous := <-updateDone:
+		s.logger(ctx).Debug("Updating URL", logger.String("sURL", sURL), logger.String("url", URL))
+		return previous, nil
 	}
-	log.Print("DB was restored")
-	for _, entry := range storageEntries {
-		s.DB[entry.SURL] = modelstorage.URLMapEntry{URL: entry.URL, UserID: entry.UserID}
+}
+
+// SetTags replaces tags of a live entry of sURL owned by userID with tags, entries of other users are reported
+// missing. The whole entry is appended to the file DB again.
+func (s *Storage) SetTags(ctx context.Context, sURL, userID string, tags []string) error {
+	// create channels for listening to the go routine result
+	setDone := make(chan bool, 1)
+	setError := make(chan error, 1)
+	go func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		mapped, ok := s.DB[sURL]
+		if !ok || mapped.UserID != userID || modelstorage.IsExpired(mapped.ExpiresAt) {
+			setError <- &storageErrors.NotFoundError{Err: nil, SURL: sURL}
+			return
+		}
+		mapped.Tags = tags
+		err := s.addToFileDB(modelstorage.StorageEntry(sURL, mapped))
+		if err != nil {
+			setError <- &storageErrors.FileWriteError{Err: err}
+			return
+		}
+		s.DB[sURL] = mapped
+		setDone <- true
+	}()
+
+	// wait for the first channel to retrieve a value
+	select {
+	case <-ctx.Done():
+		s.logger(ctx).Warn("Setting URL tags", logger.Error(ctx.Err()))
+		return &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
+	case stError := <-setError:
+		s.logger(ctx).Warn("Setting URL tags", logger.Error(stError))
+		return stError
+	case <-setDone:
+		s.logger(ctx).Debug("Setting URL tags", logger.String("sURL", sURL), logger.Any("tags", tags))
+		return nil
 	}
-	return nil
 }
 
-// addToFileDB adds one sURL:URL key-value pair to a file DB.
-func (s *Storage) addToFileDB(sURL, URL, userID string) error {
-	rowToEncode := modelstorage.URLStorageEntry{
-		SURL:   sURL,
-		URL:    URL,
-		UserID: userID,
+// RenameTag renames tag of all entries of userID to name, entries already tagged with name keep one tag. Renamed
+// entries are appended to the file DB again, TagNotFoundError is reported if no entry is tagged with tag.
+func (s *Storage) RenameTag(ctx context.Context, userID, tag, name string) error {
+	// create channels for listening to the go routine result
+	renameDone := make(chan bool, 1)
+	renameError := make(chan error, 1)
+	go func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		renamed := 0
+		for sURL, mapped := range s.DB {
+			if mapped.UserID != userID {
+				continue
+			}
+			tags, ok := modelstorage.RenameTag(mapped.Tags, tag, name)
+			if !ok {
+				continue
+			}
+			mapped.Tags = tags
+			err := s.addToFileDB(modelstorage.StorageEntry(sURL, mapped))
+			if err != nil {
+				renameError <- &storageErrors.FileWriteError{Err: err}
+				return
+			}
+			s.DB[sURL] = mapped
+			renamed++
+		}
+		if renamed == 0 {
+			renameError <- &storageErrors.TagNotFoundError{Err: nil, Tag: tag}
+			return
+		}
+		renameDone <- true
+	}()
+
+	// wait for the first channel to retrieve a value
+	select {
+	case <-ctx.Done():
+		s.logger(ctx).Warn("Renaming tag", logger.Error(ctx.Err()))
+		return &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
+	case rnmError := <-renameError:
+		s.logger(ctx).Warn("Renaming tag", logger.Error(rnmError))
+		return rnmError
+	case <-renameDone:
+		s.logger(ctx).Debug("Renaming tag", logger.String("userID", userID), logger.String("tag", tag), logger.String("name", name))
+		return nil
 	}
-	err := s.Encoder.Encode(rowToEncode)
-	if err != nil {
-		return err
+}
+
+// RetrieveTags returns tags of live entries of userID along with the number of entries tagged with each of them
+// sorted by name.
+func (s *Storage) RetrieveTags(ctx context.Context, userID string) (tags []modelurl.Tag, err error) {
+	// create channels for listening to the go routine result
+	retrieveDone := make(chan []modelurl.Tag, 1)
+	go func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		URLs := s.pageURLs(func(_ string, URL modelstorage.URLMapEntry) bool { return URL.UserID == userID }, modelurl.ListOptions{})
+		retrieveDone <- modelstorage.CountTags(URLs)
+	}()
+
+	// wait for the first channel to retrieve a value
+	select {
+	case <-ctx.Done():
+		s.logger(ctx).Warn("Retrieving tags", logger.Error(ctx.Err()))
+		return nil, &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
+	case tags := <-retrieveDone:
+		s.logger(ctx).Debug("Retrieving tags", logger.String("userID", userID), logger.Int("count", len(tags)))
+		return tags, nil
+	}
+}
+
+// TakeClick counts a redirect of sURL limited to a number of clicks and reports ExhaustedError once the limit is
+// reached, counted entries are appended to the file DB again so that their last records carry the count on restore.
+// Redirects of links without a limit are not counted.
+func (s *Storage) TakeClick(ctx context.Context, sURL string) error {
+	// create channels for listening to the go routine result
+	takeDone := make(chan bool, 1)
+	takeError := make(chan error, 1)
+	go func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		mapped, ok := s.DB[sURL]
+		if !ok {
+			takeError <- &storageErrors.NotFoundError{Err: nil, SURL: sURL}
+			return
+		}
+		if mapped.MaxClicks == 0 {
+			takeDone <- true
+			return
+		}
+		if modelstorage.IsExhausted(mapped.MaxClicks, mapped.ClickCount) {
+			takeError <- &storageErrors.ExhaustedError{Err: nil, SURL: sURL}
+			return
+		}
+		mapped.ClickCount++
+		err := s.addToFileDB(modelstorage.StorageEntry(sURL, mapped))
+		if err != nil {
+			takeError <- &storageErrors.FileWriteError{Err: err}
+			return
+		}
+		s.DB[sURL] = mapped
+		takeDone <- true
+	}()
+
+	// wait for the first channel to retrieve a value
+	select {
+	case <-ctx.Done():
+		s.logger(ctx).Warn("Taking URL click", logger.Error(ctx.Err()))
+		return &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
+	case tkError := <-takeError:
+		s.logger(ctx).Warn("Taking URL click", logger.Error(tkError))
+		return tkError
+	case <-takeDone:
+		s.logger(ctx).Debug("Taking URL click", logger.String("sURL", sURL))
+		return nil
+	}
+}
+
+// DisableBatch marks entries of sURLs disabled and returns sURLs which were not disabled before, disabled entries are
+// appended to the file DB again so that their last records carry the mark on restore.
+func (s *Storage) DisableBatch(ctx context.Context, sURLs []string) (disabled []string, err error) {
+	// create channels for listening to the go routine result
+	disableDone := make(chan []string, 1)
+	disableError := make(chan error, 1)
+	go func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		var disabled []string
+		for _, sURL := range sURLs {
+			mapped, ok := s.DB[sURL]
+			if !ok || mapped.DisabledAt != nil {
+				continue
+			}
+			disabledAt := time.Now().UTC()
+			mapped.DisabledAt = &disabledAt
+			entry := modelstorage.StorageEntry(sURL, mapped)
+			err := s.addToFileDB(entry)
+			if err != nil {
+				disableError <- &storageErrors.FileWriteError{Err: err}
+				return
+			}
+			s.DB[sURL] = mapped
+			s.Emit(modelurl.EventURLDisabled, entry)
+			disabled = append(disabled, sURL)
+		}
+		disableDone <- disabled
+	}()
+
+	// wait for the first channel to retrieve a value
+	select {
+	case <-ctx.Done():
+		s.logger(ctx).Warn("Disabling URL", logger.Error(ctx.Err()))
+		return nil, &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
+	case dsblError := <-disableError:
+		s.logger(ctx).Warn("Disabling URL", logger.Error(dsblError))
+		return nil, dsblError
+	case disabled := <-disableDone:
+		s.logger(ctx).Debug("Disabling URL", logger.Any("sURLs", disabled))
+		return disabled, nil
+	}
+}
+
+// DumpBatch stores a batch of sURL:URL key-value pairs, nothing is stored if any sURL already exists.
+func (s *Storage) DumpBatch(ctx context.Context, entries []modelstorage.URLStorageEntry) ([]modelstorage.URLStorageEntry, error) {
+	// create channels for listening to the go routine result
+	dumpDone := make(chan []modelstorage.URLStorageEntry, 1)
+	dumpError := make(chan error, 1)
+	go func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		for _, entry := range entries {
+			if _, ok := s.DB[entry.SURL]; ok {
+				dumpError <- &storageErrors.SURLAlreadyExistsError{Err: nil, SURL: entry.SURL}
+				return
+			}
+		}
+		for _, entry := range entries {
+			entry = stamp(entry)
+			s.DB[entry.SURL] = mapEntry(entry)
+			err := s.addToFileDB(entry)
+			if err != nil {
+				dumpError <- &storageErrors.FileWriteError{Err: err}
+				return
+			}
+		}
+		dumpDone <- entries
+	}()
+
+	// wait for the first channel to retrieve a value
+	select {
+	case <-ctx.Done():
+		s.logger(ctx).Warn("Dumping URL batch", logger.Error(ctx.Err()))
+		return nil, &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
+	case dmpError := <-dumpError:
+		s.logger(ctx).Warn("Dumping URL batch", logger.Error(dmpError))
+		return nil, dmpError
+	case stored := <-dumpDone:
+		s.logger(ctx).Debug("Dumping URL batch", logger.Int("count", len(stored)))
+		return stored, nil
+	}
+}
+
+// ImportBatch stores a batch of imported URL entries, entries whose sURL already exists are skipped and reported.
+func (s *Storage) ImportBatch(ctx context.Context, entries []modelstorage.URLStorageEntry) ([]modelstorage.ImportResult, error) {
+	// create channels for listening to the go routine result
+	importDone := make(chan []modelstorage.ImportResult, 1)
+	importError := make(chan error, 1)
+	go func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		results := make([]modelstorage.ImportResult, 0, len(entries))
+		for _, entry := range entries {
+			if _, ok := s.DB[entry.SURL]; ok {
+				results = append(results, modelstorage.ImportResult{Entry: entry, Status: modelstorage.ImportSURLTaken})
+				continue
+			}
+			entry = stamp(entry)
+			s.DB[entry.SURL] = mapEntry(entry)
+			err := s.addToFileDB(entry)
+			if err != nil {
+				importError <- &storageErrors.FileWriteError{Err: err}
+				return
+			}
+			results = append(results, modelstorage.ImportResult{Entry: entry, Status: modelstorage.ImportCreated})
+		}
+		importDone <- results
+	}()
+
+	// wait for the first channel to retrieve a value
+	select {
+	case <-ctx.Done():
+		s.logger(ctx).Warn("Importing URL batch", logger.Error(ctx.Err()))
+		return nil, &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
+	case imprtError := <-importError:
+		s.logger(ctx).Warn("Importing URL batch", logger.Error(imprtError))
+		return nil, imprtError
+	case results := <-importDone:
+		s.logger(ctx).Debug("Importing URL batch", logger.Int("count", len(results)))
+		return results, nil
+	}
+}
+
+// DeleteBatch is a mock for PSQL DB batch deleter for infile DB handling.
+func (s *Storage) DeleteBatch(ctx context.Context, sURLs []string, userID string) error {
+	return nil
+}
+
+// RestoreBatch is a mock for PSQL DB batch restorer for infile DB handling, nothing is ever deleted to restore.
+func (s *Storage) RestoreBatch(ctx context.Context, sURLs []string, userID string) (restored []string, err error) {
+	return nil, nil
+}
+
+// SendToQueue is a mock for PSQL DB batch concurrent deleter for infile DB handling.
+func (s *Storage) SendToQueue(ctx context.Context, items []modelstorage.URLChannelEntry) error {
+	return nil
+}
+
+// QueueDepth is a mock for PSQL DB deletion task queue depth for infile DB handling.
+func (s *Storage) QueueDepth() int {
+	return 0
+}
+
+// SendClick counts a redirect record per day, hour, referrer domain, visitor country and served destination apart for
+// bots and adds its visitor to the day's unique visitors, other record fields are not kept for infile DB handling.
+func (s *Storage) SendClick(item modelstorage.ClickEntry) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.clicks[item.SURL]; !ok {
+		s.clicks[item.SURL] = make(map[string]int)
+	}
+	s.clicks[item.SURL][modelstorage.CountKey(item.ClickedAt.UTC().Format("2006-01-02"), item.Bot)]++
+	if _, ok := s.hourlyClicks[item.SURL]; !ok {
+		s.hourlyClicks[item.SURL] = make(map[string]int)
+	}
+	s.hourlyClicks[item.SURL][modelstorage.CountKey(item.ClickedAt.UTC().Format(modelstorage.HourLayout), item.Bot)]++
+	if _, ok := s.referrerClicks[item.SURL]; !ok {
+		s.referrerClicks[item.SURL] = make(map[string]int)
+	}
+	s.referrerClicks[item.SURL][modelstorage.CountKey(item.ReferrerDomain, item.Bot)]++
+	if _, ok := s.countryClicks[item.SURL]; !ok {
+		s.countryClicks[item.SURL] = make(map[string]int)
+	}
+	s.countryClicks[item.SURL][modelstorage.CountKey(item.Country, item.Bot)]++
+	if item.VisitorKey != "" {
+		day := item.ClickedAt.UTC().Format("2006-01-02")
+		if _, ok := s.visitors[item.SURL]; !ok {
+			s.visitors[item.SURL] = make(map[string]hll.Sketch)
+		}
+		if _, ok := s.visitors[item.SURL][day]; !ok {
+			s.visitors[item.SURL][day] = hll.New()
+		}
+		s.visitors[item.SURL][day].Add(item.VisitorKey)
+	}
+	// last access times are kept in memory along with the clicks, redirected entries are unarchived
+	if mapped, ok := s.DB[item.SURL]; ok && (mapped.LastAccessedAt == nil || item.ClickedAt.After(*mapped.LastAccessedAt)) {
+		clickedAt := item.ClickedAt
+		mapped.LastAccessedAt = &clickedAt
+		mapped.ArchivedAt = nil
+		s.DB[item.SURL] = mapped
+	}
+	if item.Destination == "" {
+		return
+	}
+	if _, ok := s.destinationClicks[item.SURL]; !ok {
+		s.destinationClicks[item.SURL] = make(map[string]int)
+	}
+	s.destinationClicks[item.SURL][modelstorage.CountKey(item.Destination, item.Bot)]++
+}
+
+// RetrieveStats returns total, per-day and per-destination redirect counts for sURL, redirects of bots are only
+// counted with includeBots.
+func (s *Storage) RetrieveStats(ctx context.Context, sURL string, includeBots bool) (stats modelurl.URLStats, err error) {
+	// create channels for listening to the go routine result
+	retrieveDone := make(chan modelurl.URLStats, 1)
+	retrieveError := make(chan error, 1)
+	go func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if _, ok := s.DB[sURL]; !ok {
+			retrieveError <- &storageErrors.NotFoundError{Err: nil, SURL: sURL}
+			return
+		}
+		stats := modelurl.URLStats{SURL: sURL}
+		days := make(map[string]int)
+		for countKey, clicks := range s.clicks[sURL] {
+			if day, ok := modelstorage.CountedKey(countKey, includeBots); ok {
+				days[day] += clicks
+			}
+		}
+		for day, clicks := range days {
+			stats.TotalClicks += clicks
+			stats.ClicksPerDay = append(stats.ClicksPerDay, modelurl.DailyClicks{Date: day, Clicks: clicks})
+		}
+		sort.Slice(stats.ClicksPerDay, func(i, j int) bool {
+			return stats.ClicksPerDay[i].Date < stats.ClicksPerDay[j].Date
+		})
+		if daily := s.visitors[sURL]; len(daily) > 0 {
+			total := hll.New()
+			for i := range stats.ClicksPerDay {
+				if sketch, ok := daily[stats.ClicksPerDay[i].Date]; ok {
+					stats.ClicksPerDay[i].Visitors = sketch.Count()
+					total.Merge(sketch)
+				}
+			}
+			stats.UniqueVisitors = total.Count()
+		}
+		destinations := make(map[string]int)
+		for countKey, clicks := range s.destinationClicks[sURL] {
+			if URL, ok := modelstorage.CountedKey(countKey, includeBots); ok {
+				destinations[URL] += clicks
+			}
+		}
+		for URL, clicks := range destinations {
+			stats.ClicksPerDestination = append(stats.ClicksPerDestination, modelurl.DestinationClicks{URL: URL, Clicks: clicks})
+		}
+		sort.Slice(stats.ClicksPerDestination, func(i, j int) bool {
+			return stats.ClicksPerDestination[i].URL < stats.ClicksPerDestination[j].URL
+		})
+		retrieveDone <- stats
+	}()
+
+	// wait for the first channel to retrieve a value
+	select {
+	case <-ctx.Done():
+		s.logger(ctx).Warn("Retrieving URL stats", logger.Error(ctx.Err()))
+		return modelurl.URLStats{}, &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
+	case rtrvError := <-retrieveError:
+		s.logger(ctx).Warn("Retrieving URL stats", logger.Error(rtrvError))
+		return modelurl.URLStats{}, rtrvError
+	case stats := <-retrieveDone:
+		s.logger(ctx).Debug("Retrieving URL stats", logger.String("sURL", sURL), logger.Int("totalClicks", stats.TotalClicks))
+		return stats, nil
+	}
+}
+
+// RetrieveTimeSeries returns non-empty hourly or daily buckets of redirects of sURL within [from, to) summed up from
+// its hourly counts.
+func (s *Storage) RetrieveTimeSeries(ctx context.Context, sURL, granularity string, from, to time.Time, includeBots bool) (buckets []modelurl.ClickBucket, err error) {
+	// create channels for listening to the go routine result
+	retrieveDone := make(chan []modelurl.ClickBucket, 1)
+	retrieveError := make(chan error, 1)
+	go func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if _, ok := s.DB[sURL]; !ok {
+			retrieveError <- &storageErrors.NotFoundError{Err: nil, SURL: sURL}
+			return
+		}
+		retrieveDone <- modelstorage.BucketClicks(s.hourlyClicks[sURL], granularity, from, to, includeBots)
+	}()
+
+	// wait for the first channel to retrieve a value
+	select {
+	case <-ctx.Done():
+		s.logger(ctx).Warn("Retrieving URL time series", logger.Error(ctx.Err()))
+		return nil, &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
+	case rtrvError := <-retrieveError:
+		s.logger(ctx).Warn("Retrieving URL time series", logger.Error(rtrvError))
+		return nil, rtrvError
+	case buckets := <-retrieveDone:
+		s.logger(ctx).Debug("Retrieving URL time series", logger.String("sURL", sURL), logger.Int("buckets", len(buckets)))
+		return buckets, nil
+	}
+}
+
+// RetrieveReferrers returns up to limit referrer domains of sURL with the most redirects along with the number of
+// direct redirects.
+func (s *Storage) RetrieveReferrers(ctx context.Context, sURL string, limit int, includeBots bool) (stats modelurl.ReferrerStats, err error) {
+	// create channels for listening to the go routine result
+	retrieveDone := make(chan modelurl.ReferrerStats, 1)
+	retrieveError := make(chan error, 1)
+	go func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if _, ok := s.DB[sURL]; !ok {
+			retrieveError <- &storageErrors.NotFoundError{Err: nil, SURL: sURL}
+			return
+		}
+		retrieveDone <- modelstorage.TopReferrers(sURL, s.referrerClicks[sURL], limit, includeBots)
+	}()
+
+	// wait for the first channel to retrieve a value
+	select {
+	case <-ctx.Done():
+		s.logger(ctx).Warn("Retrieving URL referrers", logger.Error(ctx.Err()))
+		return modelurl.ReferrerStats{}, &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
+	case rtrvError := <-retrieveError:
+		s.logger(ctx).Warn("Retrieving URL referrers", logger.Error(rtrvError))
+		return modelurl.ReferrerStats{}, rtrvError
+	case stats := <-retrieveDone:
+		s.logger(ctx).Debug("Retrieving URL referrers", logger.String("sURL", sURL), logger.Int("referrers", len(stats.Referrers)))
+		return stats, nil
+	}
+}
+
+// RetrieveCountries returns redirect counts of sURL per visitor country along with the number of redirects of visitors
+// whose country was not resolved.
+func (s *Storage) RetrieveCountries(ctx context.Context, sURL string, includeBots bool) (stats modelurl.CountryStats, err error) {
+	// create channels for listening to the go routine result
+	retrieveDone := make(chan modelurl.CountryStats, 1)
+	retrieveError := make(chan error, 1)
+	go func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if _, ok := s.DB[sURL]; !ok {
+			retrieveError <- &storageErrors.NotFoundError{Err: nil, SURL: sURL}
+			return
+		}
+		retrieveDone <- modelstorage.CountryBreakdown(sURL, s.countryClicks[sURL], includeBots)
+	}()
+
+	// wait for the first channel to retrieve a value
+	select {
+	case <-ctx.Done():
+		s.logger(ctx).Warn("Retrieving URL countries", logger.Error(ctx.Err()))
+		return modelurl.CountryStats{}, &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
+	case rtrvError := <-retrieveError:
+		s.logger(ctx).Warn("Retrieving URL countries", logger.Error(rtrvError))
+		return modelurl.CountryStats{}, rtrvError
+	case stats := <-retrieveDone:
+		s.logger(ctx).Debug("Retrieving URL countries", logger.String("sURL", sURL), logger.Int("countries", len(stats.Countries)))
+		return stats, nil
+	}
+}
+
+// RetrieveServiceStats returns totals of stored URLs and their users.
+func (s *Storage) RetrieveServiceStats(ctx context.Context) (stats modelurl.ServiceStats, err error) {
+	// create channels for listening to the go routine result
+	retrieveDone := make(chan modelurl.ServiceStats, 1)
+	go func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		users := make(map[string]bool)
+		for _, URL := range s.DB {
+			users[URL.UserID] = true
+		}
+		retrieveDone <- modelurl.ServiceStats{URLs: len(s.DB), Users: len(users)}
+	}()
+
+	// wait for the first channel to retrieve a value
+	select {
+	case <-ctx.Done():
+		s.logger(ctx).Warn("Retrieving service stats", logger.Error(ctx.Err()))
+		return modelurl.ServiceStats{}, &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
+	case stats := <-retrieveDone:
+		s.logger(ctx).Debug("Retrieving service stats", logger.Int("urls", stats.URLs), logger.Int("users", stats.Users))
+		return stats, nil
+	}
+}
+
+// restore fills the tmpfs DB with URL-sURL entries from file storage, later records of an entry replace earlier ones.
+func (s *Storage) restore() error {
+	var storageEntries []modelstorage.URLStorageEntry
+	file, err := os.OpenFile(s.Cfg.FileStoragePath, os.O_RDONLY|os.O_CREATE, 0777)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	reader := bufio.NewScanner(file)
+	for reader.Scan() {
+		var storageEntry modelstorage.URLStorageEntry
+		err := json.Unmarshal(reader.Bytes(), &storageEntry)
+		if err != nil {
+			return err
+		}
+		storageEntries = append(storageEntries, storageEntry)
+	}
+	s.log.Info("DB was restored", logger.Int("count", len(storageEntries)))
+	for _, entry := range storageEntries {
+		// skip entries which have expired while the service was down
+		if modelstorage.IsExpired(entry.ExpiresAt) {
+			continue
+		}
+		s.DB[entry.SURL] = mapEntry(entry)
+	}
+	return nil
+}
+
+// restoreUsers loads user accounts from the users file, later records of a login replace earlier ones.
+func (s *Storage) restoreUsers() error {
+	file, err := os.OpenFile(s.Cfg.FileStoragePath+usersFileSuffix, os.O_RDONLY|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	reader := bufio.NewScanner(file)
+	for reader.Scan() {
+		var user modelstorage.UserEntry
+		err := json.Unmarshal(reader.Bytes(), &user)
+		if err != nil {
+			return err
+		}
+		s.users[user.Login] = user
+	}
+	return reader.Err()
+}
+
+// restoreAPIKeys loads API keys from the API keys file, later records of a key replace earlier ones.
+func (s *Storage) restoreAPIKeys() error {
+	file, err := os.OpenFile(s.Cfg.FileStoragePath+apiKeysFileSuffix, os.O_RDONLY|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	reader := bufio.NewScanner(file)
+	for reader.Scan() {
+		var entry modelstorage.APIKeyEntry
+		err := json.Unmarshal(reader.Bytes(), &entry)
+		if err != nil {
+			return err
+		}
+		s.apiKeys[entry.Hash] = entry
+	}
+	return reader.Err()
+}
+
+// restoreDomains loads claims of custom domains from the domains file, later records of a claim replace earlier ones.
+// Expired claims and claims of domains verified by other users are dropped.
+func (s *Storage) restoreDomains() error {
+	file, err := os.OpenFile(s.Cfg.FileStoragePath+domainsFileSuffix, os.O_RDONLY|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	reader := bufio.NewScanner(file)
+	for reader.Scan() {
+		var entry modelstorage.DomainEntry
+		err := json.Unmarshal(reader.Bytes(), &entry)
+		if err != nil {
+			return err
+		}
+		if s.domains[entry.Name] == nil {
+			s.domains[entry.Name] = make(map[string]modelstorage.DomainEntry)
+		}
+		s.domains[entry.Name][entry.UserID] = entry
+	}
+	err = reader.Err()
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	for name, claims := range s.domains {
+		verified, ok := verifiedClaim(claims)
+		for userID, entry := range claims {
+			if ok && userID != verified.UserID || entry.Expired(now, s.Cfg.DomainClaimTTL) {
+				delete(claims, userID)
+			}
+		}
+		if len(claims) == 0 {
+			delete(s.domains, name)
+		}
+	}
+	return nil
+}
+
+// restoreSettings loads user settings from the settings file, later records of a user replace earlier ones.
+func (s *Storage) restoreSettings() error {
+	file, err := os.OpenFile(s.Cfg.FileStoragePath+settingsFileSuffix, os.O_RDONLY|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	reader := bufio.NewScanner(file)
+	for reader.Scan() {
+		var entry modelstorage.UserSettingsEntry
+		err := json.Unmarshal(reader.Bytes(), &entry)
+		if err != nil {
+			return err
+		}
+		s.settings[entry.UserID] = entry
+	}
+	return reader.Err()
+}
+
+// restoreOrgs loads organizations and their members from the organizations file replaying its records in order.
+func (s *Storage) restoreOrgs() error {
+	file, err := os.OpenFile(s.Cfg.FileStoragePath+orgsFileSuffix, os.O_RDONLY|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	reader := bufio.NewScanner(file)
+	for reader.Scan() {
+		var record orgRecord
+		err := json.Unmarshal(reader.Bytes(), &record)
+		if err != nil {
+			return err
+		}
+		s.applyOrgRecord(record)
+	}
+	return reader.Err()
+}
+
+// restoreAudit loads audit records from the audit file.
+func (s *Storage) restoreAudit() error {
+	file, err := os.OpenFile(s.Cfg.FileStoragePath+auditFileSuffix, os.O_RDONLY|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	reader := bufio.NewScanner(file)
+	for reader.Scan() {
+		var entry modelstorage.AuditEntry
+		err := json.Unmarshal(reader.Bytes(), &entry)
+		if err != nil {
+			return err
+		}
+		s.audit = append(s.audit, entry)
+	}
+	return reader.Err()
+}
+
+// applyOrgRecord applies one change of organizations to the in-memory DB, it must be called under the lock.
+func (s *Storage) applyOrgRecord(record orgRecord) {
+	if record.Org != nil {
+		s.orgs[record.Org.ID] = *record.Org
+	}
+	if record.Member == nil {
+		return
+	}
+	member := *record.Member
+	if record.Removed {
+		delete(s.members[member.OrgID], member.UserID)
+		return
+	}
+	if s.members[member.OrgID] == nil {
+		s.members[member.OrgID] = make(map[string]modelstorage.MemberEntry)
+	}
+	s.members[member.OrgID][member.UserID] = member
+}
+
+// purgeExpired removes expired entries from the tmpfs DB, they are skipped by restore on the next start.
+func (s *Storage) purgeExpired() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var purged []string
+	for sURL, entry := range s.DB {
+		if modelstorage.IsExpired(entry.ExpiresAt) {
+			delete(s.DB, sURL)
+			delete(s.clicks, sURL)
+			delete(s.hourlyClicks, sURL)
+			delete(s.referrerClicks, sURL)
+			delete(s.countryClicks, sURL)
+			delete(s.visitors, sURL)
+			delete(s.destinationClicks, sURL)
+			purged = append(purged, sURL)
+			s.Emit(modelurl.EventURLExpired, modelstorage.URLStorageEntry{SURL: sURL, URL: entry.URL, UserID: entry.UserID})
+		}
+	}
+	if len(purged) > 0 {
+		s.log.Info("Purging expired URLs", logger.Any("sURLs", purged))
+	}
+}
+
+// stamp sets the creation time of entry to now.
+func stamp(entry modelstorage.URLStorageEntry) modelstorage.URLStorageEntry {
+	createdAt := time.Now().UTC()
+	entry.CreatedAt = &createdAt
+	return entry
+}
+
+// mapEntry converts entry into its in-memory representation.
+func mapEntry(entry modelstorage.URLStorageEntry) modelstorage.URLMapEntry {
+	mapped := modelstorage.URLMapEntry{
+		URL:            entry.URL,
+		UserID:         entry.UserID,
+		ExpiresAt:      entry.ExpiresAt,
+		RedirectType:   entry.RedirectType,
+		Title:          entry.Title,
+		FaviconURL:     entry.FaviconURL,
+		DisabledAt:     entry.DisabledAt,
+		PasswordHash:   entry.PasswordHash,
+		MaxClicks:      entry.MaxClicks,
+		ClickCount:     entry.ClickCount,
+		ActiveFrom:     entry.ActiveFrom,
+		Destinations:   entry.Destinations,
+		Sticky:         entry.Sticky,
+		GeoTargets:     entry.GeoTargets,
+		DeviceTargets:  entry.DeviceTargets,
+		Domain:         entry.Domain,
+		OrgID:          entry.OrgID,
+		Tags:           entry.Tags,
+		UTM:            entry.UTM,
+		LastAccessedAt: entry.LastAccessedAt,
+		ArchivedAt:     entry.ArchivedAt,
+		EditedAt:       entry.EditedAt,
+	}
+	if entry.CreatedAt != nil {
+		mapped.CreatedAt = *entry.CreatedAt
+	}
+	return mapped
+}
+
+// addToFileDB adds one sURL:URL key-value pair to a file DB.
+func (s *Storage) addToFileDB(entry modelstorage.URLStorageEntry) error {
+	err := s.Encoder.Encode(entry)
+	if err != nil {
+		return err
+	}
+	s.log.Debug("POST query was saved to DB", logger.String("sURL", entry.SURL))
+	return nil
+}
+
+// DumpUser stores a new user account, logins are unique.
+func (s *Storage) DumpUser(ctx context.Context, entry modelstorage.UserEntry) error {
+	// create channels for listening to the go routine result
+	dumpDone := make(chan bool, 1)
+	dumpError := make(chan error, 1)
+	go func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if _, ok := s.users[entry.Login]; ok {
+			dumpError <- &storageErrors.LoginAlreadyExistsError{Err: nil, Login: entry.Login}
+			return
+		}
+		err := s.userEncoder.Encode(entry)
+		if err != nil {
+			dumpError <- &storageErrors.FileWriteError{Err: err}
+			return
+		}
+		s.users[entry.Login] = entry
+		dumpDone <- true
+	}()
+
+	// wait for the first channel to retrieve a value
+	select {
+	case <-ctx.Done():
+		s.logger(ctx).Warn("Dumping user", logger.Error(ctx.Err()))
+		return &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
+	case dmpError := <-dumpError:
+		s.logger(ctx).Warn("Dumping user", logger.Error(dmpError))
+		return dmpError
+	case <-dumpDone:
+		s.logger(ctx).Debug("Dumping user", logger.String("login", entry.Login))
+		return nil
+	}
+}
+
+// SetUserRole sets the role of the account registered with login, the account is appended to the users file again and
+// replaces the former record when restored.
+func (s *Storage) SetUserRole(ctx context.Context, login, role string) error {
+	// create channels for listening to the go routine result
+	updateDone := make(chan bool, 1)
+	updateError := make(chan error, 1)
+	go func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		user, ok := s.users[login]
+		if !ok {
+			updateError <- &storageErrors.UserNotFoundError{Err: nil, Login: login}
+			return
+		}
+		user.Role = role
+		err := s.userEncoder.Encode(user)
+		if err != nil {
+			updateError <- &storageErrors.FileWriteError{Err: err}
+			return
+		}
+		s.users[login] = user
+		updateDone <- true
+	}()
+
+	// wait for the first channel to retrieve a value
+	select {
+	case <-ctx.Done():
+		s.logger(ctx).Warn("Setting user role", logger.Error(ctx.Err()))
+		return &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
+	case updError := <-updateError:
+		s.logger(ctx).Warn("Setting user role", logger.Error(updError))
+		return updError
+	case <-updateDone:
+		s.logger(ctx).Debug("Setting user role", logger.String("login", login), logger.String("role", role))
+		return nil
+	}
+}
+
+// RetrieveUser returns a user account corresponding to login.
+func (s *Storage) RetrieveUser(ctx context.Context, login string) (entry modelstorage.UserEntry, err error) {
+	// create channels for listening to the go routine result
+	retrieveDone := make(chan modelstorage.UserEntry, 1)
+	retrieveError := make(chan error, 1)
+	go func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		user, ok := s.users[login]
+		if !ok {
+			retrieveError <- &storageErrors.UserNotFoundError{Err: nil, Login: login}
+			return
+		}
+		retrieveDone <- user
+	}()
+
+	// wait for the first channel to retrieve a value
+	select {
+	case <-ctx.Done():
+		s.logger(ctx).Warn("Retrieving user", logger.Error(ctx.Err()))
+		return modelstorage.UserEntry{}, &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
+	case rtrvError := <-retrieveError:
+		s.logger(ctx).Warn("Retrieving user", logger.Error(rtrvError))
+		return modelstorage.UserEntry{}, rtrvError
+	case user := <-retrieveDone:
+		s.logger(ctx).Debug("Retrieving user", logger.String("login", user.Login))
+		return user, nil
+	}
+}
+
+// RetrieveUsers returns a page of user accounts sorted by login.
+func (s *Storage) RetrieveUsers(ctx context.Context, opts modelurl.ListOptions) (entries []modelstorage.UserEntry, err error) {
+	// create channels for listening to the go routine result
+	retrieveDone := make(chan []modelstorage.UserEntry, 1)
+	go func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		users := make([]modelstorage.UserEntry, 0, len(s.users))
+		for _, user := range s.users {
+			users = append(users, user)
+		}
+		retrieveDone <- modelstorage.PageUsers(users, opts)
+	}()
+
+	// wait for the first channel to retrieve a value
+	select {
+	case <-ctx.Done():
+		s.logger(ctx).Warn("Retrieving users", logger.Error(ctx.Err()))
+		return nil, &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
+	case users := <-retrieveDone:
+		s.logger(ctx).Debug("Retrieving users", logger.Int("count", len(users)))
+		return users, nil
+	}
+}
+
+// RetrieveUsersByUserID returns user accounts registered by userID sorted by login.
+func (s *Storage) RetrieveUsersByUserID(ctx context.Context, userID string) (entries []modelstorage.UserEntry, err error) {
+	// create channels for listening to the go routine result
+	retrieveDone := make(chan []modelstorage.UserEntry, 1)
+	go func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		var users []modelstorage.UserEntry
+		for _, user := range s.users {
+			if user.UserID == userID {
+				users = append(users, user)
+			}
+		}
+		retrieveDone <- modelstorage.PageUsers(users, modelurl.ListOptions{})
+	}()
+
+	// wait for the first channel to retrieve a value
+	select {
+	case <-ctx.Done():
+		s.logger(ctx).Warn("Retrieving users by user ID", logger.Error(ctx.Err()))
+		return nil, &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
+	case users := <-retrieveDone:
+		s.logger(ctx).Debug("Retrieving users by user ID", logger.Int("count", len(users)))
+		return users, nil
+	}
+}
+
+// RetrieveUserStats returns totals of links of userID and their redirects.
+func (s *Storage) RetrieveUserStats(ctx context.Context, userID string) (stats modelurl.UserStats, err error) {
+	// create channels for listening to the go routine result
+	retrieveDone := make(chan modelurl.UserStats, 1)
+	go func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		stats := modelurl.UserStats{UserID: userID}
+		for sURL, URL := range s.DB {
+			if URL.UserID != userID || modelstorage.IsExpired(URL.ExpiresAt) {
+				continue
+			}
+			stats.URLs++
+			if URL.DisabledAt != nil {
+				stats.Disabled++
+			}
+			for countKey, clicks := range s.clicks[sURL] {
+				if _, ok := modelstorage.CountedKey(countKey, false); ok {
+					stats.Clicks += clicks
+				}
+			}
+		}
+		retrieveDone <- stats
+	}()
+
+	// wait for the first channel to retrieve a value
+	select {
+	case <-ctx.Done():
+		s.logger(ctx).Warn("Retrieving user stats", logger.Error(ctx.Err()))
+		return modelurl.UserStats{}, &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
+	case stats := <-retrieveDone:
+		s.logger(ctx).Debug("Retrieving user stats", logger.String("userID", userID), logger.Int("urls", stats.URLs))
+		return stats, nil
+	}
+}
+
+// DumpAPIKey stores a new API key.
+func (s *Storage) DumpAPIKey(ctx context.Context, entry modelstorage.APIKeyEntry) error {
+	// create channels for listening to the go routine result
+	dumpDone := make(chan bool, 1)
+	dumpError := make(chan error, 1)
+	go func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		err := s.apiKeyEncoder.Encode(entry)
+		if err != nil {
+			dumpError <- &storageErrors.FileWriteError{Err: err}
+			return
+		}
+		s.apiKeys[entry.Hash] = entry
+		dumpDone <- true
+	}()
+
+	// wait for the first channel to retrieve a value
+	select {
+	case <-ctx.Done():
+		s.logger(ctx).Warn("Dumping API key", logger.Error(ctx.Err()))
+		return &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
+	case dmpError := <-dumpError:
+		s.logger(ctx).Warn("Dumping API key", logger.Error(dmpError))
+		return dmpError
+	case <-dumpDone:
+		s.logger(ctx).Debug("Dumping API key", logger.String("id", entry.ID))
+		return nil
+	}
+}
+
+// RevokeAPIKey marks the API key with id owned by userID revoked, revoking a revoked key is a no-op.
+func (s *Storage) RevokeAPIKey(ctx context.Context, id, userID string) error {
+	// create channels for listening to the go routine result
+	revokeDone := make(chan bool, 1)
+	revokeError := make(chan error, 1)
+	go func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		for hash, entry := range s.apiKeys {
+			if entry.ID != id || entry.UserID != userID {
+				continue
+			}
+			if entry.RevokedAt == nil {
+				revokedAt := time.Now().UTC()
+				entry.RevokedAt = &revokedAt
+				err := s.apiKeyEncoder.Encode(entry)
+				if err != nil {
+					revokeError <- &storageErrors.FileWriteError{Err: err}
+					return
+				}
+				s.apiKeys[hash] = entry
+			}
+			revokeDone <- true
+			return
+		}
+		revokeError <- &storageErrors.APIKeyNotFoundError{Err: nil, ID: id}
+	}()
+
+	// wait for the first channel to retrieve a value
+	select {
+	case <-ctx.Done():
+		s.logger(ctx).Warn("Revoking API key", logger.Error(ctx.Err()))
+		return &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
+	case rvkError := <-revokeError:
+		s.logger(ctx).Warn("Revoking API key", logger.Error(rvkError))
+		return rvkError
+	case <-revokeDone:
+		s.logger(ctx).Debug("Revoking API key", logger.String("id", id))
+		return nil
+	}
+}
+
+// RetrieveAPIKey returns the API key with the given hash.
+func (s *Storage) RetrieveAPIKey(ctx context.Context, hash string) (entry modelstorage.APIKeyEntry, err error) {
+	// create channels for listening to the go routine result
+	retrieveDone := make(chan modelstorage.APIKeyEntry, 1)
+	retrieveError := make(chan error, 1)
+	go func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		apiKey, ok := s.apiKeys[hash]
+		if !ok {
+			retrieveError <- &storageErrors.APIKeyNotFoundError{Err: nil}
+			return
+		}
+		retrieveDone <- apiKey
+	}()
+
+	// wait for the first channel to retrieve a value
+	select {
+	case <-ctx.Done():
+		s.logger(ctx).Warn("Retrieving API key", logger.Error(ctx.Err()))
+		return modelstorage.APIKeyEntry{}, &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
+	case rtrvError := <-retrieveError:
+		s.logger(ctx).Warn("Retrieving API key", logger.Error(rtrvError))
+		return modelstorage.APIKeyEntry{}, rtrvError
+	case apiKey := <-retrieveDone:
+		s.logger(ctx).Debug("Retrieving API key", logger.String("id", apiKey.ID))
+		return apiKey, nil
+	}
+}
+
+// RetrieveAPIKeysByUserID returns API keys of userID including revoked ones sorted by creation time.
+func (s *Storage) RetrieveAPIKeysByUserID(ctx context.Context, userID string) (entries []modelstorage.APIKeyEntry, err error) {
+	// create channels for listening to the go routine result
+	retrieveDone := make(chan []modelstorage.APIKeyEntry, 1)
+	go func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		var apiKeys []modelstorage.APIKeyEntry
+		for _, entry := range s.apiKeys {
+			if entry.UserID == userID {
+				apiKeys = append(apiKeys, entry)
+			}
+		}
+		modelstorage.SortAPIKeys(apiKeys)
+		retrieveDone <- apiKeys
+	}()
+
+	// wait for the first channel to retrieve a value
+	select {
+	case <-ctx.Done():
+		s.logger(ctx).Warn("Retrieving API keys by user ID", logger.Error(ctx.Err()))
+		return nil, &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
+	case apiKeys := <-retrieveDone:
+		s.logger(ctx).Debug("Retrieving API keys by user ID", logger.Int("count", len(apiKeys)))
+		return apiKeys, nil
+	}
+}
+
+// DumpDomain stores a new claim of a custom domain replacing an expired claim of the user, domains verified by any user
+// or claimed by the user already are reported with DomainAlreadyExistsError.
+func (s *Storage) DumpDomain(ctx context.Context, entry modelstorage.DomainEntry) error {
+	// create channels for listening to the go routine result
+	dumpDone := make(chan bool, 1)
+	dumpError := make(chan error, 1)
+	go func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		claims := s.domains[entry.Name]
+		_, verified := verifiedClaim(claims)
+		claim, claimed := claims[entry.UserID]
+		if verified || claimed && !claim.Expired(time.Now(), s.Cfg.DomainClaimTTL) {
+			dumpError <- &storageErrors.DomainAlreadyExistsError{Err: nil, Name: entry.Name}
+			return
+		}
+		err := s.domainEncoder.Encode(entry)
+		if err != nil {
+			dumpError <- &storageErrors.FileWriteError{Err: err}
+			return
+		}
+		if claims == nil {
+			claims = make(map[string]modelstorage.DomainEntry)
+			s.domains[entry.Name] = claims
+		}
+		claims[entry.UserID] = entry
+		dumpDone <- true
+	}()
+
+	// wait for the first channel to retrieve a value
+	select {
+	case <-ctx.Done():
+		s.logger(ctx).Warn("Dumping domain", logger.Error(ctx.Err()))
+		return &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
+	case dmpError := <-dumpError:
+		s.logger(ctx).Warn("Dumping domain", logger.Error(dmpError))
+		return dmpError
+	case <-dumpDone:
+		s.logger(ctx).Debug("Dumping domain", logger.String("domain", entry.Name))
+		return nil
+	}
+}
+
+// VerifyDomain marks the custom domain name claimed by userID verified and drops claims of the domain by other users,
+// verifying a verified domain is a no-op. Expired claims are reported with DomainNotFoundError and domains verified by
+// other users meanwhile with DomainAlreadyExistsError.
+func (s *Storage) VerifyDomain(ctx context.Context, name, userID string) error {
+	// create channels for listening to the go routine result
+	verifyDone := make(chan bool, 1)
+	verifyError := make(chan error, 1)
+	go func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		claims := s.domains[name]
+		entry, ok := claims[userID]
+		if !ok || entry.Expired(time.Now(), s.Cfg.DomainClaimTTL) {
+			verifyError <- &storageErrors.DomainNotFoundError{Err: nil, Name: name}
+			return
+		}
+		if verified, ok := verifiedClaim(claims); ok && verified.UserID != userID {
+			verifyError <- &storageErrors.DomainAlreadyExistsError{Err: nil, Name: name}
+			return
+		}
+		if entry.VerifiedAt == nil {
+			verifiedAt := time.Now().UTC()
+			entry.VerifiedAt = &verifiedAt
+			err := s.domainEncoder.Encode(entry)
+			if err != nil {
+				verifyError <- &storageErrors.FileWriteError{Err: err}
+				return
+			}
+			// claims of other users are dropped from the file once it is restored
+			s.domains[name] = map[string]modelstorage.DomainEntry{userID: entry}
+		}
+		verifyDone <- true
+	}()
+
+	// wait for the first channel to retrieve a value
+	select {
+	case <-ctx.Done():
+		s.logger(ctx).Warn("Verifying domain", logger.Error(ctx.Err()))
+		return &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
+	case vrfError := <-verifyError:
+		s.logger(ctx).Warn("Verifying domain", logger.Error(vrfError))
+		return vrfError
+	case <-verifyDone:
+		s.logger(ctx).Debug("Verifying domain", logger.String("domain", name))
+		return nil
+	}
+}
+
+// RetrieveDomain returns the verified custom domain name, domains pending verification are reported with
+// DomainNotFoundError.
+func (s *Storage) RetrieveDomain(ctx context.Context, name string) (entry modelstorage.DomainEntry, err error) {
+	// create channels for listening to the go routine result
+	retrieveDone := make(chan modelstorage.DomainEntry, 1)
+	retrieveError := make(chan error, 1)
+	go func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		domain, ok := verifiedClaim(s.domains[name])
+		if !ok {
+			retrieveError <- &storageErrors.DomainNotFoundError{Err: nil, Name: name}
+			return
+		}
+		retrieveDone <- domain
+	}()
+
+	// wait for the first channel to retrieve a value
+	select {
+	case <-ctx.Done():
+		s.logger(ctx).Warn("Retrieving domain", logger.Error(ctx.Err()))
+		return modelstorage.DomainEntry{}, &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
+	case rtrvError := <-retrieveError:
+		s.logger(ctx).Debug("Retrieving domain", logger.Error(rtrvError))
+		return modelstorage.DomainEntry{}, rtrvError
+	case domain := <-retrieveDone:
+		s.logger(ctx).Debug("Retrieving domain", logger.String("domain", domain.Name))
+		return domain, nil
+	}
+}
+
+// RetrieveDomainClaim returns the claim of the custom domain name by userID whether it is verified or not, expired
+// claims are reported with DomainNotFoundError.
+func (s *Storage) RetrieveDomainClaim(ctx context.Context, name, userID string) (entry modelstorage.DomainEntry, err error) {
+	// create channels for listening to the go routine result
+	retrieveDone := make(chan modelstorage.DomainEntry, 1)
+	retrieveError := make(chan error, 1)
+	go func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		domain, ok := s.domains[name][userID]
+		if !ok || domain.Expired(time.Now(), s.Cfg.DomainClaimTTL) {
+			retrieveError <- &storageErrors.DomainNotFoundError{Err: nil, Name: name}
+			return
+		}
+		retrieveDone <- domain
+	}()
+
+	// wait for the first channel to retrieve a value
+	select {
+	case <-ctx.Done():
+		s.logger(ctx).Warn("Retrieving domain claim", logger.Error(ctx.Err()))
+		return modelstorage.DomainEntry{}, &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
+	case rtrvError := <-retrieveError:
+		s.logger(ctx).Debug("Retrieving domain claim", logger.Error(rtrvError))
+		return modelstorage.DomainEntry{}, rtrvError
+	case domain := <-retrieveDone:
+		s.logger(ctx).Debug("Retrieving domain claim", logger.String("domain", domain.Name))
+		return domain, nil
+	}
+}
+
+// RetrieveDomainsByUserID returns custom domains of userID sorted by creation time leaving expired claims out.
+func (s *Storage) RetrieveDomainsByUserID(ctx context.Context, userID string) (entries []modelstorage.DomainEntry, err error) {
+	// create channels for listening to the go routine result
+	retrieveDone := make(chan []modelstorage.DomainEntry, 1)
+	go func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		now := time.Now()
+		var domains []modelstorage.DomainEntry
+		for _, claims := range s.domains {
+			entry, ok := claims[userID]
+			if ok && !entry.Expired(now, s.Cfg.DomainClaimTTL) {
+				domains = append(domains, entry)
+			}
+		}
+		modelstorage.SortDomains(domains)
+		retrieveDone <- domains
+	}()
+
+	// wait for the first channel to retrieve a value
+	select {
+	case <-ctx.Done():
+		s.logger(ctx).Warn("Retrieving domains by user ID", logger.Error(ctx.Err()))
+		return nil, &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
+	case domains := <-retrieveDone:
+		s.logger(ctx).Debug("Retrieving domains by user ID", logger.Int("count", len(domains)))
+		return domains, nil
+	}
+}
+
+// RetrieveVerifiedDomains returns names of all verified custom domains sorted by name.
+func (s *Storage) RetrieveVerifiedDomains(ctx context.Context) (names []string, err error) {
+	// create channels for listening to the go routine result
+	retrieveDone := make(chan []string, 1)
+	go func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		var names []string
+		for name, claims := range s.domains {
+			if _, ok := verifiedClaim(claims); ok {
+				names = append(names, name)
+			}
+		}
+		sort.Strings(names)
+		retrieveDone <- names
+	}()
+
+	// wait for the first channel to retrieve a value
+	select {
+	case <-ctx.Done():
+		s.logger(ctx).Warn("Retrieving verified domains", logger.Error(ctx.Err()))
+		return nil, &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
+	case names := <-retrieveDone:
+		s.logger(ctx).Debug("Retrieving verified domains", logger.Int("count", len(names)))
+		return names, nil
+	}
+}
+
+// verifiedClaim returns the verified one of claims of a custom domain.
+func verifiedClaim(claims map[string]modelstorage.DomainEntry) (modelstorage.DomainEntry, bool) {
+	for _, entry := range claims {
+		if entry.VerifiedAt != nil {
+			return entry, true
+		}
+	}
+	return modelstorage.DomainEntry{}, false
+}
+
+// DumpUserSettings stores settings of a user replacing the previous ones.
+func (s *Storage) DumpUserSettings(ctx context.Context, entry modelstorage.UserSettingsEntry) error {
+	// create channels for listening to the go routine result
+	dumpDone := make(chan bool, 1)
+	dumpError := make(chan error, 1)
+	go func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		err := s.settingsEncoder.Encode(entry)
+		if err != nil {
+			dumpError <- &storageErrors.FileWriteError{Err: err}
+			return
+		}
+		s.settings[entry.UserID] = entry
+		dumpDone <- true
+	}()
+
+	// wait for the first channel to retrieve a value
+	select {
+	case <-ctx.Done():
+		s.logger(ctx).Warn("Dumping user settings", logger.Error(ctx.Err()))
+		return &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
+	case dmpError := <-dumpError:
+		s.logger(ctx).Warn("Dumping user settings", logger.Error(dmpError))
+		return dmpError
+	case <-dumpDone:
+		s.logger(ctx).Debug("Dumping user settings", logger.String("userID", entry.UserID))
+		return nil
+	}
+}
+
+// RetrieveUserSettings returns settings of userID, users who never changed them get an entry without settings.
+func (s *Storage) RetrieveUserSettings(ctx context.Context, userID string) (entry modelstorage.UserSettingsEntry, err error) {
+	// create channels for listening to the go routine result
+	retrieveDone := make(chan modelstorage.UserSettingsEntry, 1)
+	go func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		settings, ok := s.settings[userID]
+		if !ok {
+			settings = modelstorage.UserSettingsEntry{UserID: userID}
+		}
+		retrieveDone <- settings
+	}()
+
+	// wait for the first channel to retrieve a value
+	select {
+	case <-ctx.Done():
+		s.logger(ctx).Warn("Retrieving user settings", logger.Error(ctx.Err()))
+		return modelstorage.UserSettingsEntry{}, &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
+	case settings := <-retrieveDone:
+		s.logger(ctx).Debug("Retrieving user settings", logger.String("userID", userID))
+		return settings, nil
+	}
+}
+
+// DumpOrg stores a new organization along with its first admin.
+func (s *Storage) DumpOrg(ctx context.Context, entry modelstorage.OrgEntry, admin modelstorage.MemberEntry) error {
+	// create channels for listening to the go routine result
+	dumpDone := make(chan bool, 1)
+	dumpError := make(chan error, 1)
+	go func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		record := orgRecord{Org: &entry, Member: &admin}
+		err := s.orgEncoder.Encode(record)
+		if err != nil {
+			dumpError <- &storageErrors.FileWriteError{Err: err}
+			return
+		}
+		s.applyOrgRecord(record)
+		dumpDone <- true
+	}()
+
+	// wait for the first channel to retrieve a value
+	select {
+	case <-ctx.Done():
+		s.logger(ctx).Warn("Dumping organization", logger.Error(ctx.Err()))
+		return &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
+	case dmpError := <-dumpError:
+		s.logger(ctx).Warn("Dumping organization", logger.Error(dmpError))
+		return dmpError
+	case <-dumpDone:
+		s.logger(ctx).Debug("Dumping organization", logger.String("orgID", entry.ID))
+		return nil
+	}
+}
+
+// DumpMember stores a membership of a user in an existing organization, the role of a member is replaced keeping
+// their membership time.
+func (s *Storage) DumpMember(ctx context.Context, entry modelstorage.MemberEntry) error {
+	// create channels for listening to the go routine result
+	dumpDone := make(chan bool, 1)
+	dumpError := make(chan error, 1)
+	go func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if _, ok := s.orgs[entry.OrgID]; !ok {
+			dumpError <- &storageErrors.OrgNotFoundError{Err: nil, ID: entry.OrgID}
+			return
+		}
+		if member, ok := s.members[entry.OrgID][entry.UserID]; ok {
+			entry.CreatedAt = member.CreatedAt
+		}
+		record := orgRecord{Member: &entry}
+		err := s.orgEncoder.Encode(record)
+		if err != nil {
+			dumpError <- &storageErrors.FileWriteError{Err: err}
+			return
+		}
+		s.applyOrgRecord(record)
+		dumpDone <- true
+	}()
+
+	// wait for the first channel to retrieve a value
+	select {
+	case <-ctx.Done():
+		s.logger(ctx).Warn("Dumping member", logger.Error(ctx.Err()))
+		return &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
+	case dmpError := <-dumpError:
+		s.logger(ctx).Warn("Dumping member", logger.Error(dmpError))
+		return dmpError
+	case <-dumpDone:
+		s.logger(ctx).Debug("Dumping member", logger.String("orgID", entry.OrgID), logger.String("userID", entry.UserID))
+		return nil
+	}
+}
+
+// DeleteMember removes userID from the organization orgID.
+func (s *Storage) DeleteMember(ctx context.Context, orgID, userID string) error {
+	// create channels for listening to the go routine result
+	deleteDone := make(chan bool, 1)
+	deleteError := make(chan error, 1)
+	go func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		member, ok := s.members[orgID][userID]
+		if !ok {
+			deleteError <- &storageErrors.MemberNotFoundError{Err: nil, OrgID: orgID, UserID: userID}
+			return
+		}
+		record := orgRecord{Member: &member, Removed: true}
+		err := s.orgEncoder.Encode(record)
+		if err != nil {
+			deleteError <- &storageErrors.FileWriteError{Err: err}
+			return
+		}
+		s.applyOrgRecord(record)
+		deleteDone <- true
+	}()
+
+	// wait for the first channel to retrieve a value
+	select {
+	case <-ctx.Done():
+		s.logger(ctx).Warn("Deleting member", logger.Error(ctx.Err()))
+		return &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
+	case dltError := <-deleteError:
+		s.logger(ctx).Warn("Deleting member", logger.Error(dltError))
+		return dltError
+	case <-deleteDone:
+		s.logger(ctx).Debug("Deleting member", logger.String("orgID", orgID), logger.String("userID", userID))
+		return nil
+	}
+}
+
+// RetrieveOrg returns the organization id.
+func (s *Storage) RetrieveOrg(ctx context.Context, id string) (entry modelstorage.OrgEntry, err error) {
+	// create channels for listening to the go routine result
+	retrieveDone := make(chan modelstorage.OrgEntry, 1)
+	retrieveError := make(chan error, 1)
+	go func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		org, ok := s.orgs[id]
+		if !ok {
+			retrieveError <- &storageErrors.OrgNotFoundError{Err: nil, ID: id}
+			return
+		}
+		retrieveDone <- org
+	}()
+
+	// wait for the first channel to retrieve a value
+	select {
+	case <-ctx.Done():
+		s.logger(ctx).Warn("Retrieving organization", logger.Error(ctx.Err()))
+		return modelstorage.OrgEntry{}, &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
+	case rtrvError := <-retrieveError:
+		s.logger(ctx).Warn("Retrieving organization", logger.Error(rtrvError))
+		return modelstorage.OrgEntry{}, rtrvError
+	case org := <-retrieveDone:
+		s.logger(ctx).Debug("Retrieving organization", logger.String("orgID", org.ID))
+		return org, nil
+	}
+}
+
+// RetrieveMembers returns members of the organization orgID sorted by membership time.
+func (s *Storage) RetrieveMembers(ctx context.Context, orgID string) (entries []modelstorage.MemberEntry, err error) {
+	// create channels for listening to the go routine result
+	retrieveDone := make(chan []modelstorage.MemberEntry, 1)
+	go func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		var members []modelstorage.MemberEntry
+		for _, entry := range s.members[orgID] {
+			members = append(members, entry)
+		}
+		modelstorage.SortMembers(members)
+		retrieveDone <- members
+	}()
+
+	// wait for the first channel to retrieve a value
+	select {
+	case <-ctx.Done():
+		s.logger(ctx).Warn("Retrieving members", logger.Error(ctx.Err()))
+		return nil, &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
+	case members := <-retrieveDone:
+		s.logger(ctx).Debug("Retrieving members", logger.String("orgID", orgID), logger.Int("count", len(members)))
+		return members, nil
+	}
+}
+
+// RetrieveMembershipsByUserID returns memberships of userID in organizations sorted by membership time.
+func (s *Storage) RetrieveMembershipsByUserID(ctx context.Context, userID string) (entries []modelstorage.MemberEntry, err error) {
+	// create channels for listening to the go routine result
+	retrieveDone := make(chan []modelstorage.MemberEntry, 1)
+	go func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		var memberships []modelstorage.MemberEntry
+		for _, members := range s.members {
+			if entry, ok := members[userID]; ok {
+				memberships = append(memberships, entry)
+			}
+		}
+		modelstorage.SortMembers(memberships)
+		retrieveDone <- memberships
+	}()
+
+	// wait for the first channel to retrieve a value
+	select {
+	case <-ctx.Done():
+		s.logger(ctx).Warn("Retrieving memberships by user ID", logger.Error(ctx.Err()))
+		return nil, &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
+	case memberships := <-retrieveDone:
+		s.logger(ctx).Debug("Retrieving memberships by user ID", logger.Int("count", len(memberships)))
+		return memberships, nil
+	}
+}
+
+// DumpAudit appends records of mutating operations to the audit file.
+func (s *Storage) DumpAudit(ctx context.Context, entries []modelstorage.AuditEntry) error {
+	// create channels for listening to the go routine result
+	dumpDone := make(chan bool, 1)
+	dumpError := make(chan error, 1)
+	go func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		for _, entry := range entries {
+			err := s.auditEncoder.Encode(entry)
+			if err != nil {
+				dumpError <- &storageErrors.FileWriteError{Err: err}
+				return
+			}
+			s.audit = append(s.audit, entry)
+		}
+		dumpDone <- true
+	}()
+
+	// wait for the first channel to retrieve a value
+	select {
+	case <-ctx.Done():
+		s.logger(ctx).Warn("Dumping audit records", logger.Error(ctx.Err()))
+		return &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
+	case dmpError := <-dumpError:
+		s.logger(ctx).Warn("Dumping audit records", logger.Error(dmpError))
+		return dmpError
+	case <-dumpDone:
+		s.logger(ctx).Debug("Dumping audit records", logger.Int("count", len(entries)))
+		return nil
+	}
+}
+
+// RetrieveAudit returns a page of audit records matching filter sorted by creation time.
+func (s *Storage) RetrieveAudit(ctx context.Context, filter modelurl.AuditFilter, opts modelurl.ListOptions) (entries []modelstorage.AuditEntry, err error) {
+	// create channels for listening to the go routine result
+	retrieveDone := make(chan []modelstorage.AuditEntry, 1)
+	go func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		retrieveDone <- modelstorage.PageAudit(s.audit, filter, opts)
+	}()
+
+	// wait for the first channel to retrieve a value
+	select {
+	case <-ctx.Done():
+		s.logger(ctx).Warn("Retrieving audit records", logger.Error(ctx.Err()))
+		return nil, &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
+	case entries := <-retrieveDone:
+		s.logger(ctx).Debug("Retrieving audit records", logger.Int("count", len(entries)))
+		return entries, nil
+	}
+}
+
+// EraseUser permanently removes all data of userID: links of the user along with their redirect counts, accounts, API
+// keys, custom domains, settings and organization memberships. Since files are append-only, they are rewritten from the
+// in-memory DB so that no record of the user is left, audit records are kept without the states of the links and
+// memberships of the user and of operations made by the user.
+func (s *Storage) EraseUser(ctx context.Context, userID string) error {
+	// create channels for listening to the go routine result
+	eraseDone := make(chan int, 1)
+	eraseError := make(chan error, 1)
+	go func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		erased := make(map[string]bool)
+		for sURL, URL := range s.DB {
+			if URL.UserID == userID {
+				erased[sURL] = true
+				delete(s.DB, sURL)
+				delete(s.clicks, sURL)
+				delete(s.hourlyClicks, sURL)
+				delete(s.referrerClicks, sURL)
+				delete(s.countryClicks, sURL)
+				delete(s.visitors, sURL)
+				delete(s.destinationClicks, sURL)
+			}
+		}
+		for login, user := range s.users {
+			if user.UserID == userID {
+				delete(s.users, login)
+			}
+		}
+		for hash, apiKey := range s.apiKeys {
+			if apiKey.UserID == userID {
+				delete(s.apiKeys, hash)
+			}
+		}
+		for name, claims := range s.domains {
+			delete(claims, userID)
+			if len(claims) == 0 {
+				delete(s.domains, name)
+			}
+		}
+		delete(s.settings, userID)
+		for _, members := range s.members {
+			delete(members, userID)
+		}
+		err := s.rewriteFiles()
+		if err != nil {
+			eraseError <- &storageErrors.FileWriteError{Err: err}
+			return
+		}
+		err = s.anonymizeAudit(userID, erased)
+		if err != nil {
+			eraseError <- &storageErrors.FileWriteError{Err: err}
+			return
+		}
+		eraseDone <- len(erased)
+	}()
+
+	// wait for the first channel to retrieve a value
+	select {
+	case <-ctx.Done():
+		s.logger(ctx).Warn("Erasing user", logger.Error(ctx.Err()))
+		return &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
+	case ersError := <-eraseError:
+		s.logger(ctx).Warn("Erasing user", logger.Error(ersError))
+		return ersError
+	case erased := <-eraseDone:
+		s.logger(ctx).Debug("Erasing user", logger.String("userID", userID), logger.Int("urls", erased))
+		return nil
+	}
+}
+
+// rewriteFiles truncates the URL, users, API keys, domains, settings and organizations files and stores the current
+// state of the in-memory DB in them, encoders keep appending to the truncated files. It must be called under the lock.
+func (s *Storage) rewriteFiles() error {
+	for _, suffix := range []string{"", usersFileSuffix, apiKeysFileSuffix, domainsFileSuffix, settingsFileSuffix, orgsFileSuffix} {
+		err := os.Truncate(s.Cfg.FileStoragePath+suffix, 0)
+		if err != nil {
+			return err
+		}
+	}
+	for sURL, URL := range s.DB {
+		err := s.Encoder.Encode(modelstorage.StorageEntry(sURL, URL))
+		if err != nil {
+			return err
+		}
+	}
+	for _, user := range s.users {
+		err := s.userEncoder.Encode(user)
+		if err != nil {
+			return err
+		}
+	}
+	for _, apiKey := range s.apiKeys {
+		err := s.apiKeyEncoder.Encode(apiKey)
+		if err != nil {
+			return err
+		}
+	}
+	for _, claims := range s.domains {
+		for _, domain := range claims {
+			err := s.domainEncoder.Encode(domain)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	for _, settings := range s.settings {
+		err := s.settingsEncoder.Encode(settings)
+		if err != nil {
+			return err
+		}
+	}
+	for _, org := range s.orgs {
+		org := org
+		err := s.orgEncoder.Encode(orgRecord{Org: &org})
+		if err != nil {
+			return err
+		}
+		for _, member := range s.members[org.ID] {
+			member := member
+			err = s.orgEncoder.Encode(orgRecord{Member: &member})
+			if err != nil {
+				return err
+			}
+		}
 	}
-	log.Print("POST query was saved to DB")
 	return nil
 }
 
+// anonymizeAudit drops the states recorded by audit records made by userID or describing one of the links sURLs or a
+// membership of userID, the audit file is rewritten only when a record changed. It must be called under the lock.
+func (s *Storage) anonymizeAudit(userID string, sURLs map[string]bool) error {
+	changed := false
+	for i := range s.audit {
+		if s.audit[i].Anonymize(userID, sURLs) {
+			changed = true
+		}
+	}
+	if !changed {
+		return nil
+	}
+	err := os.Truncate(s.Cfg.FileStoragePath+auditFileSuffix, 0)
+	if err != nil {
+		return err
+	}
+	for _, entry := range s.audit {
+		err = s.auditEncoder.Encode(entry)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// logger returns a request-scoped logger carried by ctx or the storage one.
+func (s *Storage) logger(ctx context.Context) *logger.Logger {
+	return logger.FromContext(ctx, s.log)
+}
+
 // PingDB is a mock for PSQL DB pinger.
 func (s *Storage) PingDB() error {
 	return nil
@@ -0,0 +1,141 @@
+package inpsql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/logger"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strconv"
+)
+
+// migrationLockID identifies the session advisory lock serializing migrations of concurrently starting instances.
+const migrationLockID = 4417201873
+
+// queries run by migrate, schema_migrations has the layout of golang-migrate so that its CLI can take over
+const (
+	createMigrationsTableQuery  = "CREATE TABLE IF NOT EXISTS schema_migrations (version bigint not null primary key, dirty boolean not null)"
+	selectMigrationVersionQuery = "SELECT version, dirty FROM schema_migrations LIMIT 1"
+	deleteMigrationVersionQuery = "DELETE FROM schema_migrations"
+	insertMigrationVersionQuery = "INSERT INTO schema_migrations (version, dirty) VALUES ($1, false)"
+)
+
+// migrationName matches names of migration files.
+var migrationName = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+// migration defines one up migration.
+type migration struct {
+	version int64
+	name    string
+	query   string
+}
+
+// parseMigrations reads up migrations from fsys sorted by version.
+func parseMigrations(fsys fs.FS) ([]migration, error) {
+	files, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+	var migrations []migration
+	versions := make(map[int64]string)
+	for _, file := range files {
+		if file.IsDir() {
+			continue
+		}
+		match := migrationName.FindStringSubmatch(file.Name())
+		if match == nil {
+			return nil, fmt.Errorf("migration file %q is not named <version>_<title>.(up|down).sql", file.Name())
+		}
+		if match[3] != "up" {
+			continue
+		}
+		version, err := strconv.ParseInt(match[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("migration file %q: %w", file.Name(), err)
+		}
+		if other, ok := versions[version]; ok {
+			return nil, fmt.Errorf("migration files %q and %q share version %d", other, file.Name(), version)
+		}
+		versions[version] = file.Name()
+		query, err := fs.ReadFile(fsys, file.Name())
+		if err != nil {
+			return nil, err
+		}
+		migrations = append(migrations, migration{version: version, name: match[2], query: string(query)})
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].version < migrations[j].version
+	})
+	return migrations, nil
+}
+
+// migrate applies migrations of fsys newer than the current schema version, each within its own transaction along
+// with the version update, and logs the schema version it leaves the DB at.
+func (s *Storage) migrate(ctx context.Context, fsys fs.FS) error {
+	migrations, err := parseMigrations(fsys)
+	if err != nil {
+		return err
+	}
+	// advisory locks belong to a session, so keep to one connection until the lock is released
+	conn, err := s.DB.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	_, err = conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", migrationLockID)
+	if err != nil {
+		return err
+	}
+	defer conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1)", migrationLockID)
+	_, err = conn.ExecContext(ctx, createMigrationsTableQuery)
+	if err != nil {
+		return err
+	}
+	var version int64
+	var dirty bool
+	err = conn.QueryRowContext(ctx, selectMigrationVersionQuery).Scan(&version, &dirty)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+	if dirty {
+		return fmt.Errorf("PSQL DB schema is dirty at version %d, fix it and force the version manually", version)
+	}
+	for _, m := range migrations {
+		if m.version <= version {
+			continue
+		}
+		err = applyMigration(ctx, conn, m)
+		if err != nil {
+			return fmt.Errorf("applying migration %d_%s: %w", m.version, m.name, err)
+		}
+		s.log.Info("Applied PSQL DB migration", logger.Int("version", int(m.version)), logger.String("name", m.name))
+		version = m.version
+	}
+	s.log.Info("PSQL DB schema version", logger.Int("version", int(version)))
+	return nil
+}
+
+// applyMigration runs m and records its version within one transaction.
+func applyMigration(ctx context.Context, conn *sql.Conn, m migration) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	_, err = tx.ExecContext(ctx, m.query)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, deleteMigrationVersionQuery)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, insertMigrationVersionQuery, m.version)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,78 @@
+package inpsql
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"testing"
+	"testing/fstest"
+
+	"github.com/danilovkiri/dk_go_url_shortener/internal/logger"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/storage/v2/inpsql/migrations"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseMigrations(t *testing.T) {
+	fsys := fstest.MapFS{
+		"000010_add_index.up.sql":    {Data: []byte("CREATE INDEX b")},
+		"000010_add_index.down.sql":  {Data: []byte("DROP INDEX b")},
+		"000002_add_column.up.sql":   {Data: []byte("ALTER TABLE a")},
+		"000002_add_column.down.sql": {Data: []byte("ALTER TABLE a")},
+	}
+	parsed, err := parseMigrations(fsys)
+	require.NoError(t, err)
+	assert.Equal(t, []migration{
+		{version: 2, name: "add_column", query: "ALTER TABLE a"},
+		{version: 10, name: "add_index", query: "CREATE INDEX b"},
+	}, parsed)
+
+	fsys["2_duplicate.up.sql"] = &fstest.MapFile{Data: []byte("SELECT 1")}
+	_, err = parseMigrations(fsys)
+	assert.Error(t, err)
+
+	_, err = parseMigrations(fstest.MapFS{"add_column.sql": {Data: []byte("ALTER TABLE a")}})
+	assert.Error(t, err)
+}
+
+// TestEmbeddedMigrations makes sure that shipped migrations are numbered consecutively and have down migrations.
+func TestEmbeddedMigrations(t *testing.T) {
+	parsed, err := parseMigrations(migrations.FS)
+	require.NoError(t, err)
+	require.NotEmpty(t, parsed)
+	for i, m := range parsed {
+		assert.Equal(t, int64(i+1), m.version)
+		_, err = migrations.FS.Open(migrationFile(m, "down"))
+		assert.NoError(t, err, "missing down migration of %d_%s", m.version, m.name)
+	}
+}
+
+// migrationFile returns the name of the file holding m in direction.
+func migrationFile(m migration, direction string) string {
+	return fmt.Sprintf("%06d_%s.%s.sql", m.version, m.name, direction)
+}
+
+// TestMigrateLogsVersion makes sure that the schema version is logged by every migrate run, including runs applying
+// nothing, it is skipped unless DATABASE_DSN points to a PSQL DB.
+func TestMigrateLogsVersion(t *testing.T) {
+	dsn := os.Getenv("DATABASE_DSN")
+	if dsn == "" {
+		t.Skip("DATABASE_DSN is not set")
+	}
+	db, err := sql.Open("pgx", dsn)
+	require.NoError(t, err)
+	defer db.Close()
+	parsed, err := parseMigrations(migrations.FS)
+	require.NoError(t, err)
+	latest := parsed[len(parsed)-1].version
+	for i := 0; i < 2; i++ {
+		var out bytes.Buffer
+		log, err := logger.New(&out, logger.LevelInfo, logger.FormatJSON)
+		require.NoError(t, err)
+		st := &Storage{DB: db, log: log}
+		require.NoError(t, st.migrate(context.Background(), migrations.FS))
+		assert.Contains(t, out.String(), fmt.Sprintf(`"msg":"PSQL DB schema version","version":%d`, latest))
+	}
+}
@@ -0,0 +1,8 @@
+-- store user_id as text since we store encoded tokens
+CREATE TABLE IF NOT EXISTS urls (
+    id bigserial not null,
+    user_id text not null,
+    url text not null unique,
+    short_url text not null,
+    is_deleted boolean not null DEFAULT false
+);
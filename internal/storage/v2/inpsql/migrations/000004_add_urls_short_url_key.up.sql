@@ -0,0 +1,2 @@
+-- keep sURLs unique since they may be requested by users as custom aliases
+CREATE UNIQUE INDEX IF NOT EXISTS urls_short_url_key ON urls (short_url);
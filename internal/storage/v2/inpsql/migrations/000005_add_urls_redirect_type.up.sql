@@ -0,0 +1,2 @@
+-- zero means no override of the globally configured redirect status code
+ALTER TABLE urls ADD COLUMN IF NOT EXISTS redirect_type smallint not null DEFAULT 0;
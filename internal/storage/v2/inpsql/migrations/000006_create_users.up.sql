@@ -0,0 +1,6 @@
+-- store registered accounts, user_id matches urls.user_id of the account links
+CREATE TABLE IF NOT EXISTS users (
+    login text primary key,
+    password_hash text not null,
+    user_id text not null unique
+);
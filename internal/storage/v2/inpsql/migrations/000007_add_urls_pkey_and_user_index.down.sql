@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS urls_user_id_is_deleted_idx;
+ALTER TABLE urls DROP CONSTRAINT IF EXISTS urls_pkey;
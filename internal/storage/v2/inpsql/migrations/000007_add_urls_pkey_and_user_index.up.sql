@@ -0,0 +1,3 @@
+ALTER TABLE urls ADD CONSTRAINT urls_pkey PRIMARY KEY (id);
+-- serve listing, exporting and deleting links of a user, the unique index on short_url is added by 000004
+CREATE INDEX IF NOT EXISTS urls_user_id_is_deleted_idx ON urls (user_id, is_deleted);
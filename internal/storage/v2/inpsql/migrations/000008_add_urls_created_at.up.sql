@@ -0,0 +1,3 @@
+-- links created before the column existed share the migration time and are ordered by id
+ALTER TABLE urls ADD COLUMN IF NOT EXISTS created_at timestamptz not null DEFAULT now();
+CREATE INDEX IF NOT EXISTS urls_user_id_created_at_idx ON urls (user_id, created_at);
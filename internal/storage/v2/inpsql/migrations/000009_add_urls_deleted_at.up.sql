@@ -0,0 +1,4 @@
+-- links deleted before the column existed are retained for the full period starting now
+ALTER TABLE urls ADD COLUMN IF NOT EXISTS deleted_at timestamptz;
+UPDATE urls SET deleted_at = now() WHERE is_deleted AND deleted_at IS NULL;
+CREATE INDEX IF NOT EXISTS urls_deleted_at_idx ON urls (deleted_at) WHERE is_deleted;
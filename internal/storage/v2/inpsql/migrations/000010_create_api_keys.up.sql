@@ -0,0 +1,11 @@
+-- store API keys of users, only sha256 hashes of keys are kept
+CREATE TABLE IF NOT EXISTS api_keys (
+    id text primary key,
+    user_id text not null,
+    name text not null,
+    prefix text not null,
+    hash text not null unique,
+    created_at timestamptz not null default now(),
+    revoked_at timestamptz
+);
+CREATE INDEX IF NOT EXISTS api_keys_user_id_idx ON api_keys (user_id);
@@ -0,0 +1,3 @@
+-- describe destination pages of links, filled in the background after links are created
+ALTER TABLE urls ADD COLUMN IF NOT EXISTS title text;
+ALTER TABLE urls ADD COLUMN IF NOT EXISTS favicon_url text;
@@ -0,0 +1,2 @@
+-- links found unsafe are disabled rather than deleted, so that their owners cannot restore them
+ALTER TABLE urls ADD COLUMN IF NOT EXISTS disabled_at timestamptz;
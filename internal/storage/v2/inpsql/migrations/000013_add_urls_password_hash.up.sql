@@ -0,0 +1,2 @@
+-- bcrypt hash of the password protecting the link, links without one are not protected
+ALTER TABLE urls ADD COLUMN IF NOT EXISTS password_hash text;
@@ -0,0 +1,3 @@
+-- links limited to a number of redirects count them in click_count, zero max_clicks means no limit
+ALTER TABLE urls ADD COLUMN IF NOT EXISTS max_clicks integer NOT NULL DEFAULT 0;
+ALTER TABLE urls ADD COLUMN IF NOT EXISTS click_count integer NOT NULL DEFAULT 0;
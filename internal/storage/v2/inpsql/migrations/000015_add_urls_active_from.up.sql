@@ -0,0 +1,2 @@
+-- links created in advance are not redirected until active_from, they are active since creation when it is NULL
+ALTER TABLE urls ADD COLUMN IF NOT EXISTS active_from timestamptz;
@@ -0,0 +1,3 @@
+ALTER TABLE clicks DROP COLUMN IF EXISTS destination;
+ALTER TABLE urls DROP COLUMN IF EXISTS sticky;
+ALTER TABLE urls DROP COLUMN IF EXISTS destinations;
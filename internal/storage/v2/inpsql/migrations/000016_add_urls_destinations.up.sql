@@ -0,0 +1,5 @@
+-- split links redirect to one of JSON-encoded weighted destinations, sticky ones serve every visitor the same one
+ALTER TABLE urls ADD COLUMN IF NOT EXISTS destinations jsonb;
+ALTER TABLE urls ADD COLUMN IF NOT EXISTS sticky boolean NOT NULL DEFAULT false;
+-- the URL a redirect was served to, clicks recorded before the column existed have none
+ALTER TABLE clicks ADD COLUMN IF NOT EXISTS destination text NOT NULL DEFAULT '';
@@ -0,0 +1,2 @@
+-- JSON-encoded map of visitor country codes to the URLs they are redirected to instead of the default one
+ALTER TABLE urls ADD COLUMN IF NOT EXISTS geo_targets jsonb;
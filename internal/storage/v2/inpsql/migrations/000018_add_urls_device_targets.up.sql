@@ -0,0 +1,3 @@
+-- JSON-encoded map of visitor devices (ios, android, desktop) to the URLs they are redirected to instead of the
+-- default one
+ALTER TABLE urls ADD COLUMN IF NOT EXISTS device_targets jsonb;
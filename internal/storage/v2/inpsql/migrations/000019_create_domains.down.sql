@@ -0,0 +1,2 @@
+ALTER TABLE urls DROP COLUMN IF EXISTS domain;
+DROP TABLE IF EXISTS domains;
@@ -0,0 +1,11 @@
+-- store custom domains of users, a domain serves links of its user once verified with a DNS TXT record holding token
+CREATE TABLE IF NOT EXISTS domains (
+    name text primary key,
+    user_id text not null,
+    token text not null,
+    created_at timestamptz not null default now(),
+    verified_at timestamptz
+);
+CREATE INDEX IF NOT EXISTS domains_user_id_idx ON domains (user_id);
+-- custom domain links are served on, NULL serves a link on the base URL host
+ALTER TABLE urls ADD COLUMN IF NOT EXISTS domain text;
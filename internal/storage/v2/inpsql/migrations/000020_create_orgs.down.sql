@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS urls_org_id_idx;
+ALTER TABLE urls DROP COLUMN IF EXISTS org_id;
+DROP TABLE IF EXISTS org_members;
+DROP TABLE IF EXISTS orgs;
@@ -0,0 +1,19 @@
+-- store organizations sharing links between their members, members are either admins managing membership or members
+CREATE TABLE IF NOT EXISTS orgs (
+    id text primary key,
+    name text not null,
+    created_at timestamptz not null default now()
+);
+CREATE TABLE IF NOT EXISTS org_members (
+    org_id text not null,
+    user_id text not null,
+    login text,
+    role text not null,
+    created_at timestamptz not null default now(),
+    PRIMARY KEY (org_id, user_id),
+    CONSTRAINT org_members_org_id_fkey FOREIGN KEY (org_id) REFERENCES orgs (id) ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS org_members_user_id_idx ON org_members (user_id);
+-- organization a link belongs to, NULL keeps a link private to its user
+ALTER TABLE urls ADD COLUMN IF NOT EXISTS org_id text;
+CREATE INDEX IF NOT EXISTS urls_org_id_idx ON urls (org_id);
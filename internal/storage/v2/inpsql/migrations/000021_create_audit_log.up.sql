@@ -0,0 +1,15 @@
+-- store records of mutating operations for compliance, states of entities before and after an operation are NULL
+-- when an entity did not exist
+CREATE TABLE IF NOT EXISTS audit_log (
+    id text primary key,
+    actor text not null,
+    action text not null,
+    entity text not null,
+    entity_id text not null,
+    before jsonb,
+    after jsonb,
+    created_at timestamptz not null default now()
+);
+CREATE INDEX IF NOT EXISTS audit_log_created_at_idx ON audit_log (created_at);
+CREATE INDEX IF NOT EXISTS audit_log_actor_idx ON audit_log (actor);
+CREATE INDEX IF NOT EXISTS audit_log_entity_id_idx ON audit_log (entity, entity_id);
@@ -0,0 +1,11 @@
+-- keep deletions which kept failing for inspection instead of dropping them, they can be replayed once the cause is
+-- fixed
+CREATE TABLE IF NOT EXISTS deletion_dead_letters (
+    id bigserial primary key,
+    user_id text not null,
+    short_url text not null,
+    error text not null,
+    attempts integer not null,
+    created_at timestamptz not null default now()
+);
+CREATE INDEX IF NOT EXISTS deletion_dead_letters_created_at_idx ON deletion_dead_letters (created_at);
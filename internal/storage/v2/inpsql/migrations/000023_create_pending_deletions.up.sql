@@ -0,0 +1,7 @@
+-- persist deletions accepted from users until they are performed so that they survive restarts and crashes
+CREATE TABLE IF NOT EXISTS pending_deletions (
+    user_id text not null,
+    short_url text not null,
+    created_at timestamptz not null default now(),
+    primary key (user_id, short_url)
+);
@@ -0,0 +1,10 @@
+-- keep the history of destination changes of links made by their owners
+CREATE TABLE IF NOT EXISTS url_edits (
+    id bigserial primary key,
+    short_url text not null,
+    user_id text not null,
+    previous_url text not null,
+    url text not null,
+    edited_at timestamptz not null default now()
+);
+CREATE INDEX IF NOT EXISTS url_edits_short_url_edited_at_idx ON url_edits (short_url, edited_at);
@@ -0,0 +1,8 @@
+-- tags users attach to their links, user_id is the link creator listing links by tag
+CREATE TABLE IF NOT EXISTS url_tags (
+    short_url text not null,
+    user_id text not null,
+    tag text not null,
+    primary key (short_url, tag)
+);
+CREATE INDEX IF NOT EXISTS url_tags_user_id_tag_idx ON url_tags (user_id, tag);
@@ -0,0 +1,7 @@
+DROP TRIGGER IF EXISTS url_tags_search_vector_update ON url_tags;
+DROP FUNCTION IF EXISTS url_tags_search_vector_update();
+DROP TRIGGER IF EXISTS urls_search_vector_update ON urls;
+DROP FUNCTION IF EXISTS urls_search_vector_update();
+DROP INDEX IF EXISTS urls_search_vector_idx;
+ALTER TABLE urls DROP COLUMN IF EXISTS search_vector;
+DROP FUNCTION IF EXISTS url_search_vector(text, text, text);
@@ -0,0 +1,33 @@
+-- full-text search over links of a user: titles and tags weigh more than words of URLs, punctuation separates words
+-- so that URLs split into host and path words
+CREATE OR REPLACE FUNCTION url_search_vector(link text, url text, title text) RETURNS tsvector AS $$
+    SELECT setweight(to_tsvector('simple', regexp_replace(coalesce(title, ''), '[^[:alnum:]]+', ' ', 'g')), 'A')
+        || setweight(to_tsvector('simple', regexp_replace(coalesce((SELECT string_agg(tag, ' ') FROM url_tags WHERE short_url = link), ''), '[^[:alnum:]]+', ' ', 'g')), 'A')
+        || setweight(to_tsvector('simple', regexp_replace(url, '[^[:alnum:]]+', ' ', 'g')), 'B')
+$$ LANGUAGE sql STABLE;
+
+ALTER TABLE urls ADD COLUMN IF NOT EXISTS search_vector tsvector;
+UPDATE urls SET search_vector = url_search_vector(short_url, url, title);
+CREATE INDEX IF NOT EXISTS urls_search_vector_idx ON urls USING gin (search_vector);
+
+-- keep search vectors up to date as destinations, titles and tags change
+CREATE OR REPLACE FUNCTION urls_search_vector_update() RETURNS trigger AS $$
+BEGIN
+    NEW.search_vector := url_search_vector(NEW.short_url, NEW.url, NEW.title);
+    RETURN NEW;
+END
+$$ LANGUAGE plpgsql;
+DROP TRIGGER IF EXISTS urls_search_vector_update ON urls;
+CREATE TRIGGER urls_search_vector_update BEFORE INSERT OR UPDATE OF url, title ON urls
+    FOR EACH ROW EXECUTE FUNCTION urls_search_vector_update();
+
+CREATE OR REPLACE FUNCTION url_tags_search_vector_update() RETURNS trigger AS $$
+BEGIN
+    UPDATE urls SET search_vector = url_search_vector(short_url, url, title)
+        WHERE short_url IN (OLD.short_url, NEW.short_url);
+    RETURN NULL;
+END
+$$ LANGUAGE plpgsql;
+DROP TRIGGER IF EXISTS url_tags_search_vector_update ON url_tags;
+CREATE TRIGGER url_tags_search_vector_update AFTER INSERT OR UPDATE OR DELETE ON url_tags
+    FOR EACH ROW EXECUTE FUNCTION url_tags_search_vector_update();
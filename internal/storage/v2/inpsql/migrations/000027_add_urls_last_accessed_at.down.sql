@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS urls_stale_idx;
+DROP INDEX IF EXISTS urls_user_id_last_accessed_at_idx;
+ALTER TABLE urls DROP COLUMN IF EXISTS last_accessed_at;
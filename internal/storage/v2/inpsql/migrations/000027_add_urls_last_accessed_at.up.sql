@@ -0,0 +1,4 @@
+-- last_accessed_at is set when clicks are flushed, links never redirected since keep it null and sort as accessed at creation
+ALTER TABLE urls ADD COLUMN IF NOT EXISTS last_accessed_at timestamptz;
+CREATE INDEX IF NOT EXISTS urls_user_id_last_accessed_at_idx ON urls (user_id, coalesce(last_accessed_at, created_at));
+CREATE INDEX IF NOT EXISTS urls_stale_idx ON urls (coalesce(last_accessed_at, created_at)) WHERE is_deleted = false;
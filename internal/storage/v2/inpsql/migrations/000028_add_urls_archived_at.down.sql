@@ -0,0 +1,2 @@
+ALTER TABLE urls DROP COLUMN IF EXISTS archive_noticed_at;
+ALTER TABLE urls DROP COLUMN IF EXISTS archived_at;
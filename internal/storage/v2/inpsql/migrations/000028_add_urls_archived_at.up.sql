@@ -0,0 +1,4 @@
+-- archived links are left out of listings by default, archive_noticed_at records when their owner was noticed ahead
+-- of archiving; both are cleared once a link is redirected to
+ALTER TABLE urls ADD COLUMN IF NOT EXISTS archived_at timestamptz;
+ALTER TABLE urls ADD COLUMN IF NOT EXISTS archive_noticed_at timestamptz;
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS clicks_clicked_at_idx;
+DROP TABLE IF EXISTS click_rollups;
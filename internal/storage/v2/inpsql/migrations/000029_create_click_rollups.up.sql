@@ -0,0 +1,12 @@
+-- hourly redirect counts served as time series, rolled up from clicks in the background; the clicked_at index keeps
+-- scanning clicks since the last rolled up hour cheap
+CREATE TABLE IF NOT EXISTS click_rollups (
+    short_url text not null,
+    hour timestamptz not null,
+    clicks bigint not null,
+    PRIMARY KEY (short_url, hour)
+);
+CREATE INDEX IF NOT EXISTS clicks_clicked_at_idx ON clicks (clicked_at);
+INSERT INTO click_rollups (short_url, hour, clicks)
+SELECT short_url, date_trunc('hour', clicked_at AT TIME ZONE 'UTC') AT TIME ZONE 'UTC', count(*) FROM clicks GROUP BY 1, 2
+ON CONFLICT (short_url, hour) DO UPDATE SET clicks = EXCLUDED.clicks;
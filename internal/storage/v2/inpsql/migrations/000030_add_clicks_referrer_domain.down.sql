@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS clicks_short_url_referrer_domain_idx;
+ALTER TABLE clicks DROP COLUMN IF EXISTS referrer_domain;
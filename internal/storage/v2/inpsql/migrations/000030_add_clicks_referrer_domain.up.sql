@@ -0,0 +1,7 @@
+-- normalized host names of referrers counted by referrer breakdowns, direct redirects have none; the host names of
+-- clicks recorded before are extracted from their referrers as lower-cased and stripped of the www. prefix
+ALTER TABLE clicks ADD COLUMN IF NOT EXISTS referrer_domain text NOT NULL DEFAULT '';
+UPDATE clicks SET referrer_domain = coalesce(regexp_replace(rtrim(lower(
+    substring(referrer from '^[A-Za-z][A-Za-z0-9+.-]*://(?:[^@/?#]*@)?([^/?#:]+)')), '.'), '^www\.', ''), '')
+WHERE referrer <> '';
+CREATE INDEX IF NOT EXISTS clicks_short_url_referrer_domain_idx ON clicks (short_url, referrer_domain);
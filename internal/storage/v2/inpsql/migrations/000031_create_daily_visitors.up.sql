@@ -0,0 +1,8 @@
+-- HyperLogLog sketches of visitors redirected per link and UTC day, merged with the visitors of every flushed batch of
+-- clicks; visitors of clicks recorded before are not counted
+CREATE TABLE IF NOT EXISTS daily_visitors (
+    short_url text not null,
+    day date not null,
+    sketch bytea not null,
+    PRIMARY KEY (short_url, day)
+);
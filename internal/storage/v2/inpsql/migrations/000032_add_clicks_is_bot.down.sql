@@ -0,0 +1,3 @@
+UPDATE click_rollups SET clicks = clicks + bot_clicks WHERE bot_clicks > 0;
+ALTER TABLE click_rollups DROP COLUMN IF EXISTS bot_clicks;
+ALTER TABLE clicks DROP COLUMN IF EXISTS is_bot;
@@ -0,0 +1,12 @@
+-- redirects of bots are left out of redirect counts unless asked for, they are classified by the service when recorded;
+-- clicks recorded before are classified by the User-Agent markers known to the service, bot IP ranges are not applied
+ALTER TABLE clicks ADD COLUMN IF NOT EXISTS is_bot boolean NOT NULL DEFAULT false;
+UPDATE clicks SET is_bot = true
+WHERE user_agent ~* 'bot|crawl|spider|slurp|facebookexternalhit|embedly|preview|headless|lighthouse|pingdom|uptime|monitor|curl/|wget/|python-requests|python-urllib|go-http-client|java/|okhttp|libwww-perl|httpclient';
+-- rollups count redirects of bots apart
+ALTER TABLE click_rollups ADD COLUMN IF NOT EXISTS bot_clicks bigint NOT NULL DEFAULT 0;
+INSERT INTO click_rollups (short_url, hour, clicks, bot_clicks)
+SELECT short_url, date_trunc('hour', clicked_at AT TIME ZONE 'UTC') AT TIME ZONE 'UTC',
+    count(*) FILTER (WHERE NOT is_bot), count(*) FILTER (WHERE is_bot)
+FROM clicks GROUP BY 1, 2
+ON CONFLICT (short_url, hour) DO UPDATE SET clicks = EXCLUDED.clicks, bot_clicks = EXCLUDED.bot_clicks;
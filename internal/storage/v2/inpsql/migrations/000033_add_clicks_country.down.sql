@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS clicks_short_url_country_idx;
+ALTER TABLE clicks DROP COLUMN IF EXISTS country;
@@ -0,0 +1,4 @@
+-- ISO 3166-1 alpha-2 codes of visitor countries counted by country breakdowns, empty when the country of the visitor
+-- was not resolved; visitor IP addresses are not stored, so clicks recorded before are left unresolved
+ALTER TABLE clicks ADD COLUMN IF NOT EXISTS country text NOT NULL DEFAULT '';
+CREATE INDEX IF NOT EXISTS clicks_short_url_country_idx ON clicks (short_url, country);
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS user_settings;
+ALTER TABLE urls DROP COLUMN IF EXISTS utm;
@@ -0,0 +1,7 @@
+-- JSON-encoded UTM parameters appended to the query of destinations on redirect
+ALTER TABLE urls ADD COLUMN IF NOT EXISTS utm jsonb;
+-- settings of users applied to links they create, e.g. UTM parameters links are tagged with unless given their own
+CREATE TABLE IF NOT EXISTS user_settings (
+    user_id text PRIMARY KEY,
+    utm jsonb
+);
@@ -0,0 +1,6 @@
+-- time the destination of the link was last changed, served as Last-Modified of redirects along with created_at;
+-- links edited before are given the time of their latest recorded edit
+ALTER TABLE urls ADD COLUMN IF NOT EXISTS edited_at timestamptz;
+UPDATE urls SET edited_at = edits.edited_at
+FROM (SELECT short_url, max(edited_at) AS edited_at FROM url_edits GROUP BY short_url) edits
+WHERE urls.short_url = edits.short_url;
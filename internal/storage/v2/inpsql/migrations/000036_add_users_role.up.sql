@@ -0,0 +1,2 @@
+-- role claim of access tokens issued for the account, granted out of band with the role command of the server binary
+ALTER TABLE users ADD COLUMN IF NOT EXISTS role text NOT NULL DEFAULT '';
@@ -0,0 +1,5 @@
+-- claims of domains claimed by other users are dropped to restore one claim per domain
+DELETE FROM domains d WHERE verified_at IS NULL AND EXISTS (SELECT 1 FROM domains o WHERE o.name = d.name AND o.user_id <> d.user_id);
+DROP INDEX IF EXISTS domains_verified_name_idx;
+ALTER TABLE domains DROP CONSTRAINT IF EXISTS domains_pkey;
+ALTER TABLE domains ADD CONSTRAINT domains_pkey PRIMARY KEY (name);
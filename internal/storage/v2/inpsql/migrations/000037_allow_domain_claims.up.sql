@@ -0,0 +1,4 @@
+-- let several users claim a domain until one of them verifies it, verified domains stay unique
+ALTER TABLE domains DROP CONSTRAINT IF EXISTS domains_pkey;
+ALTER TABLE domains ADD CONSTRAINT domains_pkey PRIMARY KEY (name, user_id);
+CREATE UNIQUE INDEX IF NOT EXISTS domains_verified_name_idx ON domains (name) WHERE verified_at IS NOT NULL;
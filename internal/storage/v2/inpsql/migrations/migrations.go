@@ -0,0 +1,14 @@
+// Package migrations embeds versioned PSQL DB schema migrations applied at storage initialization.
+//
+// Files are named <version>_<title>.up.sql and <version>_<title>.down.sql as expected by golang-migrate, so that
+// down migrations can be applied by its CLI. Migrations up to 000006 replace the former ad-hoc schema creation and
+// are idempotent to be safely applied to databases created by it; new migrations must take the next version and must
+// never be edited once released.
+package migrations
+
+import "embed"
+
+// FS holds migration files.
+//
+//go:embed *.sql
+var FS embed.FS
@@ -0,0 +1,113 @@
+package inpsql
+
+import (
+	"context"
+	"database/sql"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/logger"
+	"sync/atomic"
+	"time"
+)
+
+// replica health check parameters
+const (
+	replicaCheckInterval = 5 * time.Second
+	replicaCheckTimeout  = time.Second
+)
+
+// replica is a read-only PSQL DB serving URL reads, its queries are not prepared explicitly since a replica may be
+// unreachable at start, pgx caches statements per connection anyway.
+type replica struct {
+	// healthy is 1 while the replica answers health checks
+	healthy int32
+	index   int
+	db      *sql.DB
+}
+
+// replicaSet spreads reads over healthy replicas round-robin. A nil replicaSet has no replicas so that reads go to
+// the primary.
+type replicaSet struct {
+	next     uint32
+	replicas []*replica
+	log      *logger.Logger
+}
+
+// openReplicas opens replicas by their DSNs, replicas which are unreachable at start are taken into rotation once
+// they pass a health check. It returns nil when there are no DSNs.
+func openReplicas(ctx context.Context, dsns []string, log *logger.Logger) (*replicaSet, error) {
+	if len(dsns) == 0 {
+		return nil, nil
+	}
+	rs := &replicaSet{log: log}
+	for i, dsn := range dsns {
+		db, err := sql.Open("pgx", dsn)
+		if err != nil {
+			rs.close()
+			return nil, err
+		}
+		rs.replicas = append(rs.replicas, &replica{index: i, db: db})
+	}
+	rs.check(ctx)
+	return rs, nil
+}
+
+// pick returns the next healthy replica, nil if there is none.
+func (rs *replicaSet) pick() *replica {
+	if rs == nil {
+		return nil
+	}
+	start := atomic.AddUint32(&rs.next, 1)
+	for i := range rs.replicas {
+		r := rs.replicas[(int(start)+i)%len(rs.replicas)]
+		if atomic.LoadInt32(&r.healthy) == 1 {
+			return r
+		}
+	}
+	return nil
+}
+
+// check pings all replicas and takes them in or out of rotation, changes of their health are logged.
+func (rs *replicaSet) check(ctx context.Context) {
+	for _, r := range rs.replicas {
+		pingCtx, cancel := context.WithTimeout(ctx, replicaCheckTimeout)
+		err := r.db.PingContext(pingCtx)
+		cancel()
+		switch {
+		case err != nil && atomic.SwapInt32(&r.healthy, 0) == 1:
+			rs.log.Warn("Checking PSQL replica: taken out of rotation", logger.Int("replica", r.index), logger.Error(err))
+		case err != nil:
+			rs.log.Debug("Checking PSQL replica", logger.Int("replica", r.index), logger.Error(err))
+		case atomic.SwapInt32(&r.healthy, 1) == 0:
+			rs.log.Info("Checking PSQL replica: taken into rotation", logger.Int("replica", r.index))
+		}
+	}
+}
+
+// run checks replicas every replicaCheckInterval until ctx is done.
+func (rs *replicaSet) run(ctx context.Context) {
+	if rs == nil {
+		return
+	}
+	t := time.NewTicker(replicaCheckInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			rs.check(ctx)
+		}
+	}
+}
+
+// close closes connections to all replicas.
+func (rs *replicaSet) close() {
+	if rs == nil {
+		return
+	}
+	for _, r := range rs.replicas {
+		err := r.db.Close()
+		if err != nil {
+			rs.log.Error("Closing PSQL replica connection", logger.Int("replica", r.index), logger.Error(err))
+		}
+	}
+}
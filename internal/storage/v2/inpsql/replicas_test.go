@@ -0,0 +1,49 @@
+package inpsql
+
+import (
+	"context"
+	"io"
+	"testing"
+
+	"github.com/danilovkiri/dk_go_url_shortener/internal/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReplicaSetPick(t *testing.T) {
+	var none *replicaSet
+	assert.Nil(t, none.pick())
+
+	a, b, c := &replica{index: 0, healthy: 1}, &replica{index: 1, healthy: 1}, &replica{index: 2, healthy: 1}
+	rs := &replicaSet{replicas: []*replica{a, b, c}}
+	picked := map[*replica]int{}
+	for i := 0; i < 6; i++ {
+		picked[rs.pick()]++
+	}
+	assert.Equal(t, map[*replica]int{a: 2, b: 2, c: 2}, picked)
+
+	// unhealthy replicas are skipped
+	b.healthy = 0
+	picked = map[*replica]int{}
+	for i := 0; i < 6; i++ {
+		picked[rs.pick()]++
+	}
+	assert.Zero(t, picked[b])
+	assert.Equal(t, 6, picked[a]+picked[c])
+
+	a.healthy, c.healthy = 0, 0
+	assert.Nil(t, rs.pick())
+}
+
+func TestOpenReplicasUnreachable(t *testing.T) {
+	log, _ := logger.New(io.Discard, logger.LevelInfo, logger.FormatText)
+	rs, err := openReplicas(context.Background(), []string{"postgres://user@127.0.0.1:1/db?connect_timeout=1"}, log)
+	require.NoError(t, err)
+	defer rs.close()
+	// a replica unreachable at start is not taken into rotation until it passes a health check
+	assert.Nil(t, rs.pick())
+
+	rs, err = openReplicas(context.Background(), nil, log)
+	require.NoError(t, err)
+	assert.Nil(t, rs)
+}
@@ -3,30 +3,388 @@ package inpsql
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"errors"
 	"github.com/danilovkiri/dk_go_url_shortener/internal/config"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/logger"
 	"github.com/danilovkiri/dk_go_url_shortener/internal/service/modelurl"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/storage/v2/cache"
 	storageErrors "github.com/danilovkiri/dk_go_url_shortener/internal/storage/v2/errors"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/storage/v2/hll"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/storage/v2/inpsql/migrations"
 	"github.com/danilovkiri/dk_go_url_shortener/internal/storage/v2/modelstorage"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/storage/v2/workers"
 	"github.com/jackc/pgconn"
 	"github.com/jackc/pgerrcode"
-	_ "github.com/jackc/pgx/v4/stdlib"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/stdlib"
 	"github.com/lib/pq"
-	"log"
+	"sort"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
+// shortURLConstraint is the name of the unique index on the short_url column.
+const shortURLConstraint = "urls_short_url_key"
+
+// usersLoginConstraint is the name of the primary key on the users login column.
+const usersLoginConstraint = "users_pkey"
+
+// domain constraints: a user claims a domain once and a domain is verified by one user
+const (
+	domainsClaimConstraint    = "domains_pkey"
+	domainsVerifiedConstraint = "domains_verified_name_idx"
+)
+
+// orgMembersOrgConstraint is the name of the foreign key of memberships on the organizations table.
+const orgMembersOrgConstraint = "org_members_org_id_fkey"
+
+// urlColumns lists columns selected into modelstorage.URLPostgresEntry.
+const urlColumns = "id, user_id, url, short_url, is_deleted, expires_at, redirect_type, disabled_at"
+
+// tagsColumn selects tags of a URL sorted by name.
+const tagsColumn = "ARRAY(SELECT tag FROM url_tags WHERE url_tags.short_url = urls.short_url ORDER BY tag)"
+
+// listedColumns lists columns selected by URL listing queries into modelstorage.URLPostgresEntry.
+const listedColumns = urlColumns + ", title, favicon_url, domain, " + tagsColumn + ", created_at, last_accessed_at, archived_at"
+
+// sortColumn sorts URL listing queries by last access when $5 is modelurl.SortLastAccessed and by creation time
+// otherwise, URLs never accessed sort as accessed at creation.
+const sortColumn = "CASE WHEN $5 = 'last_accessed_at' THEN coalesce(last_accessed_at, created_at) ELSE created_at END"
+
+// tagFilter restricts URL listing queries to URLs tagged with $4, an empty tag matches all URLs.
+const tagFilter = " AND ($4 = '' OR EXISTS (SELECT 1 FROM url_tags WHERE url_tags.short_url = urls.short_url AND url_tags.tag = $4))"
+
+// archivedFilter restricts URL listing queries to unarchived URLs unless $6 is true.
+const archivedFilter = " AND (archived_at IS NULL OR $6)"
+
+// searchByUserIDQuery selects a page of live URLs of the user matching the text search query $4 ranked by relevance,
+// equally relevant ones newest first. Search vectors are maintained by triggers, see migration 000026.
+const searchByUserIDQuery = "SELECT " + listedColumns + ` FROM urls, to_tsquery('simple', $4) query
+	WHERE user_id = $1 AND is_deleted = false AND (expires_at IS NULL OR expires_at > now()) AND search_vector @@ query AND (archived_at IS NULL OR $5)
+	ORDER BY ts_rank(search_vector, query) DESC, created_at DESC, id DESC LIMIT $2 OFFSET $3`
+
+// apiKeyColumns lists columns selected into modelstorage.APIKeyEntry.
+const apiKeyColumns = "id, user_id, name, prefix, hash, created_at, revoked_at"
+
+// domainColumns lists columns selected into modelstorage.DomainEntry.
+const domainColumns = "name, user_id, token, created_at, verified_at"
+
+// memberColumns lists columns selected into modelstorage.MemberEntry.
+const memberColumns = "org_id, user_id, login, role, created_at"
+
+// queries run via statements prepared once at InitStorage
+const (
+	selectOwnerQuery    = "SELECT user_id, org_id FROM urls WHERE short_url = $1"
+	selectBySURLQuery   = "SELECT " + urlColumns + ", password_hash, max_clicks, click_count, active_from, destinations, sticky, geo_targets, device_targets, domain, org_id, utm, created_at, edited_at FROM urls WHERE short_url = $1"
+	selectByUserIDQuery = "SELECT " + listedColumns + " FROM urls WHERE user_id = $1 AND is_deleted = false AND (expires_at IS NULL OR expires_at > now())" + tagFilter + archivedFilter
+	// a NULL limit selects all rows
+	selectByUserIDAscQuery  = selectByUserIDQuery + " ORDER BY " + sortColumn + ", id LIMIT $2 OFFSET $3"
+	selectByUserIDDescQuery = selectByUserIDQuery + " ORDER BY " + sortColumn + " DESC, id DESC LIMIT $2 OFFSET $3"
+	selectByOrgIDQuery      = "SELECT " + listedColumns + " FROM urls WHERE org_id = $1 AND is_deleted = false AND (expires_at IS NULL OR expires_at > now())" + tagFilter + archivedFilter
+	selectByOrgIDAscQuery   = selectByOrgIDQuery + " ORDER BY " + sortColumn + ", id LIMIT $2 OFFSET $3"
+	selectByOrgIDDescQuery  = selectByOrgIDQuery + " ORDER BY " + sortColumn + " DESC, id DESC LIMIT $2 OFFSET $3"
+	searchURLsQuery         = "SELECT " + listedColumns + " FROM urls WHERE (url ILIKE $1 OR short_url ILIKE $1) AND is_deleted = false AND (expires_at IS NULL OR expires_at > now())" + tagFilter + archivedFilter
+	searchURLsAscQuery      = searchURLsQuery + " ORDER BY " + sortColumn + ", id LIMIT $2 OFFSET $3"
+	searchURLsDescQuery     = searchURLsQuery + " ORDER BY " + sortColumn + " DESC, id DESC LIMIT $2 OFFSET $3"
+	selectSURLByURLQuery    = "SELECT short_url FROM urls WHERE url = $1"
+	insertURLQuery          = "WITH inserted AS (INSERT INTO urls (user_id, url, short_url, expires_at, redirect_type, password_hash, max_clicks, active_from, destinations, sticky, geo_targets, device_targets, domain, org_id, utm) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15) RETURNING short_url, user_id) INSERT INTO url_tags (short_url, user_id, tag) SELECT short_url, user_id, unnest($16::text[]) FROM inserted"
+	insertURLBatchQuery     = "INSERT INTO urls (user_id, url, short_url) VALUES ($1, $2, $3) ON CONFLICT (url) DO NOTHING"
+	updateMetadataQuery     = "UPDATE urls SET title = $2, favicon_url = $3 WHERE short_url = $1"
+	takeClickQuery          = "UPDATE urls SET click_count = click_count + CASE WHEN max_clicks > 0 THEN 1 ELSE 0 END WHERE short_url = $1 AND (max_clicks = 0 OR click_count < max_clicks)"
+	deleteBatchQuery        = "UPDATE urls SET is_deleted = true, deleted_at = now() WHERE user_id = $1 AND short_url = ANY($2) AND NOT is_deleted RETURNING short_url, url"
+	restoreBatchQuery       = "UPDATE urls SET is_deleted = false, deleted_at = NULL WHERE user_id = $1 AND short_url = ANY($2) AND is_deleted RETURNING short_url"
+	disableBatchQuery       = "UPDATE urls SET disabled_at = now() WHERE short_url = ANY($1) AND disabled_at IS NULL RETURNING short_url, url, user_id"
+	insertClickQuery        = "INSERT INTO clicks (short_url, clicked_at, referrer, user_agent, destination, referrer_domain, is_bot, country) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)"
+	existsSURLQuery         = "SELECT EXISTS (SELECT 1 FROM urls WHERE short_url = $1)"
+	selectDailyClicksQuery  = `SELECT to_char(clicked_at AT TIME ZONE 'UTC', 'YYYY-MM-DD') AS day, count(*)
+		FROM clicks WHERE short_url = $1 AND (NOT is_bot OR $2) GROUP BY day ORDER BY day`
+	selectServedClicksQuery = `SELECT destination, count(*)
+		FROM clicks WHERE short_url = $1 AND destination <> '' AND (NOT is_bot OR $2) GROUP BY destination ORDER BY destination`
+	selectReferrersQuery = `SELECT referrer_domain, count(*) AS clicks
+		FROM clicks WHERE short_url = $1 AND referrer_domain <> '' AND (NOT is_bot OR $3) GROUP BY referrer_domain ORDER BY clicks DESC, referrer_domain LIMIT $2`
+	selectDirectClicksQuery = "SELECT count(*) FROM clicks WHERE short_url = $1 AND referrer_domain = '' AND (NOT is_bot OR $2)"
+	selectCountriesQuery    = "SELECT country, count(*) FROM clicks WHERE short_url = $1 AND (NOT is_bot OR $2) GROUP BY country"
+	selectVisitorsQuery     = "SELECT to_char(day, 'YYYY-MM-DD'), sketch FROM daily_visitors WHERE short_url = $1"
+	selectServiceStatsQuery = "SELECT count(*) FILTER (WHERE NOT is_deleted), count(DISTINCT user_id) FROM urls"
+	insertUserQuery         = "INSERT INTO users (login, password_hash, user_id) VALUES ($1, $2, $3)"
+	updateUserRoleQuery     = "UPDATE users SET role = $2 WHERE login = $1"
+	selectUserQuery         = "SELECT login, password_hash, user_id, role FROM users WHERE login = $1"
+	selectUsersAscQuery     = "SELECT login, password_hash, user_id, role FROM users ORDER BY login LIMIT $1 OFFSET $2"
+	selectUsersDescQuery    = "SELECT login, password_hash, user_id, role FROM users ORDER BY login DESC LIMIT $1 OFFSET $2"
+	selectUsersByIDQuery    = "SELECT login, password_hash, user_id, role FROM users WHERE user_id = $1 ORDER BY login"
+	insertAPIKeyQuery       = "INSERT INTO api_keys (id, user_id, name, prefix, hash, created_at) VALUES ($1, $2, $3, $4, $5, $6)"
+	selectAPIKeyQuery       = "SELECT " + apiKeyColumns + " FROM api_keys WHERE hash = $1"
+	selectAPIKeysQuery      = "SELECT " + apiKeyColumns + " FROM api_keys WHERE user_id = $1 ORDER BY created_at, id"
+	revokeAPIKeyQuery       = "UPDATE api_keys SET revoked_at = coalesce(revoked_at, now()) WHERE id = $1 AND user_id = $2"
+	insertDomainQuery       = "INSERT INTO domains (name, user_id, token, created_at) SELECT $1, $2, $3, $4 WHERE NOT EXISTS (SELECT 1 FROM domains WHERE name = $1 AND verified_at IS NOT NULL)"
+	purgeDomainClaimsQuery  = "DELETE FROM domains WHERE name = $1 AND verified_at IS NULL AND created_at <= $2"
+	verifyDomainQuery       = "UPDATE domains SET verified_at = coalesce(verified_at, now()) WHERE name = $1 AND user_id = $2 AND (verified_at IS NOT NULL OR created_at > $3)"
+	dropDomainClaimsQuery   = "DELETE FROM domains WHERE name = $1 AND user_id <> $2"
+	selectDomainQuery       = "SELECT " + domainColumns + " FROM domains WHERE name = $1 AND verified_at IS NOT NULL"
+	selectDomainClaimQuery  = "SELECT " + domainColumns + " FROM domains WHERE name = $1 AND user_id = $2 AND (verified_at IS NOT NULL OR created_at > $3)"
+	selectDomainsQuery      = "SELECT " + domainColumns + " FROM domains WHERE user_id = $1 AND (verified_at IS NOT NULL OR created_at > $2) ORDER BY created_at, name"
+	selectVerifiedQuery     = "SELECT name FROM domains WHERE verified_at IS NOT NULL ORDER BY name"
+	upsertSettingsQuery     = "INSERT INTO user_settings (user_id, utm) VALUES ($1, $2) ON CONFLICT (user_id) DO UPDATE SET utm = excluded.utm"
+	selectSettingsQuery     = "SELECT utm FROM user_settings WHERE user_id = $1"
+	insertOrgQuery          = "INSERT INTO orgs (id, name, created_at) VALUES ($1, $2, $3)"
+	selectOrgQuery          = "SELECT id, name, created_at FROM orgs WHERE id = $1"
+	// the role of a member is replaced keeping their membership time
+	upsertMemberQuery = `INSERT INTO org_members (org_id, user_id, login, role, created_at) VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (org_id, user_id) DO UPDATE SET login = excluded.login, role = excluded.role`
+	deleteMemberQuery      = "DELETE FROM org_members WHERE org_id = $1 AND user_id = $2"
+	selectMembersQuery     = "SELECT " + memberColumns + " FROM org_members WHERE org_id = $1 ORDER BY created_at, user_id"
+	selectMembershipsQuery = "SELECT " + memberColumns + " FROM org_members WHERE user_id = $1 ORDER BY created_at, org_id"
+	// redirects are counted for links which are neither deleted nor expired, redirects of bots are not counted
+	selectUserStatsQuery = `SELECT count(*), count(disabled_at), coalesce(sum((SELECT count(*) FROM clicks WHERE clicks.short_url = urls.short_url AND NOT clicks.is_bot)), 0)
+		FROM urls WHERE user_id = $1 AND is_deleted = false AND (expires_at IS NULL OR expires_at > now())`
+	// tags of deleted and expired links are not counted
+	selectTagsQuery = `SELECT tag, count(*) FROM url_tags JOIN urls ON urls.short_url = url_tags.short_url
+		WHERE url_tags.user_id = $1 AND urls.is_deleted = false AND (urls.expires_at IS NULL OR urls.expires_at > now())
+		GROUP BY tag ORDER BY tag`
+	insertAuditQuery = "INSERT INTO audit_log (id, actor, action, entity, entity_id, before, after, created_at) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)"
+	// empty filters and NULL time bounds match all records
+	selectAuditQuery = `SELECT id, actor, action, entity, entity_id, before, after, created_at FROM audit_log
+		WHERE ($1 = '' OR actor = $1) AND ($2 = '' OR action = $2) AND ($3 = '' OR entity = $3) AND ($4 = '' OR entity_id = $4)
+		AND ($5::timestamptz IS NULL OR created_at >= $5) AND ($6::timestamptz IS NULL OR created_at < $6)`
+	selectAuditAscQuery  = selectAuditQuery + " ORDER BY created_at, id LIMIT $7 OFFSET $8"
+	selectAuditDescQuery = selectAuditQuery + " ORDER BY created_at DESC, id DESC LIMIT $7 OFFSET $8"
+)
+
+// queries persisting the deletion task queue, pending deletions are removed once performed or dead-lettered
+const (
+	insertPendingQuery = `INSERT INTO pending_deletions (user_id, short_url) SELECT * FROM unnest($1::text[], $2::text[])
+		ON CONFLICT DO NOTHING`
+	deletePendingQuery = "DELETE FROM pending_deletions WHERE user_id = $1 AND short_url = ANY($2)"
+	selectPendingQuery = "SELECT user_id, short_url FROM pending_deletions ORDER BY created_at"
+)
+
+// queries run by SetTags and RenameTag within one transaction, tags of an edited entry are locked along with its row
+// and tags renamed to a tag the entry already has are merged into it
+const (
+	lockOwnedURLQuery = `SELECT 1 FROM urls WHERE short_url = $1 AND user_id = $2 AND is_deleted = false
+		AND (expires_at IS NULL OR expires_at > now()) FOR UPDATE`
+	deleteTagsQuery = "DELETE FROM url_tags WHERE short_url = $1"
+	insertTagsQuery = "INSERT INTO url_tags (short_url, user_id, tag) SELECT $1, $2, unnest($3::text[])"
+	mergeTagQuery   = `DELETE FROM url_tags merged WHERE user_id = $1 AND tag = $2 AND $2 <> $3
+		AND EXISTS (SELECT 1 FROM url_tags kept WHERE kept.short_url = merged.short_url AND kept.tag = $3)`
+	renameTagQuery = "UPDATE url_tags SET tag = $3 WHERE user_id = $1 AND tag = $2"
+)
+
+// touchURLsQuery moves last access times of sURLs $1 forward to the matching times $2 of their latest flushed clicks,
+// flushes of concurrent instances never move them back. Redirected entries are unarchived.
+const touchURLsQuery = `UPDATE urls SET last_accessed_at = GREATEST(urls.last_accessed_at, accessed.clicked_at),
+		archived_at = NULL, archive_noticed_at = NULL
+	FROM unnest($1::text[], $2::timestamptz[]) accessed (short_url, clicked_at) WHERE urls.short_url = accessed.short_url`
+
+// queries merging visitor sketches of flushed clicks into stored ones: a sketch is inserted unless one of the day is
+// stored, which is then locked, merged with and updated
+const (
+	insertVisitorsQuery = "INSERT INTO daily_visitors (short_url, day, sketch) VALUES ($1, $2, $3) ON CONFLICT (short_url, day) DO NOTHING"
+	lockVisitorsQuery   = "SELECT sketch FROM daily_visitors WHERE short_url = $1 AND day = $2 FOR UPDATE"
+	updateVisitorsQuery = "UPDATE daily_visitors SET sketch = $3 WHERE short_url = $1 AND day = $2"
+)
+
+// click rollup queries: rollupClicksQuery recounts redirects per UTC hour since the hour before the last rolled up one
+// so that clicks flushed late are counted as well, redirects of bots are counted apart. Time series of sURL $1 are
+// selected from rollups within [$2, $3), with redirects of bots if $4 is true.
+const (
+	rollupClicksQuery = `INSERT INTO click_rollups (short_url, hour, clicks, bot_clicks)
+		SELECT short_url, date_trunc('hour', clicked_at AT TIME ZONE 'UTC') AT TIME ZONE 'UTC',
+			count(*) FILTER (WHERE NOT is_bot), count(*) FILTER (WHERE is_bot) FROM clicks
+		WHERE clicked_at >= (SELECT coalesce(max(hour), '-infinity') FROM click_rollups) - interval '1 hour' GROUP BY 1, 2
+		ON CONFLICT (short_url, hour) DO UPDATE SET clicks = EXCLUDED.clicks, bot_clicks = EXCLUDED.bot_clicks`
+	selectHourlyRollupsQuery = `SELECT hour, clicks + CASE WHEN $4 THEN bot_clicks ELSE 0 END AS clicks
+		FROM click_rollups WHERE short_url = $1 AND hour >= $2 AND hour < $3 ORDER BY hour`
+	selectDailyRollupsQuery = `SELECT date_trunc('day', hour AT TIME ZONE 'UTC') AT TIME ZONE 'UTC' AS day,
+		sum(clicks + CASE WHEN $4 THEN bot_clicks ELSE 0 END)::bigint
+		FROM click_rollups WHERE short_url = $1 AND hour >= $2 AND hour < $3 GROUP BY day ORDER BY day`
+)
+
+// updateURLQuery changes the destination of a live entry of its owner and records the edit, the edited row is locked
+// until the edit is recorded. The first destination of split links is the URL itself and metadata of the former
+// destination page is dropped.
+const updateURLQuery = `WITH previous AS (SELECT id, url FROM urls WHERE short_url = $1 AND user_id = $2 AND is_deleted = false
+		AND (expires_at IS NULL OR expires_at > now()) FOR UPDATE),
+	updated AS (UPDATE urls SET url = $3, title = NULL, favicon_url = NULL, edited_at = now(),
+		destinations = CASE WHEN urls.destinations IS NULL THEN NULL ELSE jsonb_set(urls.destinations, '{0,url}', to_jsonb($3::text)) END
+		FROM previous WHERE urls.id = previous.id RETURNING previous.url)
+	INSERT INTO url_edits (short_url, user_id, previous_url, url) SELECT $1, $2, url, $3 FROM updated RETURNING previous_url`
+
+// queries run by ImportBatch on a dedicated connection
+const (
+	createImportTableQuery = `CREATE TEMP TABLE urls_import (
+		position integer not null,
+		user_id text not null,
+		url text not null,
+		short_url text not null,
+		expires_at timestamptz,
+		redirect_type smallint not null
+	) ON COMMIT DROP`
+	insertImportedQuery = `INSERT INTO urls (user_id, url, short_url, expires_at, redirect_type)
+		SELECT user_id, url, short_url, expires_at, redirect_type FROM urls_import ORDER BY position
+		ON CONFLICT DO NOTHING RETURNING url, short_url`
+	selectSURLsByURLsQuery = "SELECT url, short_url FROM urls WHERE url = ANY($1)"
+)
+
+// queries run by EraseUser within one transaction, links are removed along with their redirect and edit records,
+// tags and queued or failed deletions, audit records of the user, of the links and of memberships of the user are kept
+// without the states they recorded
+const (
+	eraseClicksQuery      = "DELETE FROM clicks WHERE short_url IN (SELECT short_url FROM urls WHERE user_id = $1)"
+	eraseRollupsQuery     = "DELETE FROM click_rollups WHERE short_url IN (SELECT short_url FROM urls WHERE user_id = $1)"
+	eraseVisitorsQuery    = "DELETE FROM daily_visitors WHERE short_url IN (SELECT short_url FROM urls WHERE user_id = $1)"
+	eraseEditsQuery       = "DELETE FROM url_edits WHERE short_url IN (SELECT short_url FROM urls WHERE user_id = $1)"
+	eraseTagsQuery        = "DELETE FROM url_tags WHERE user_id = $1"
+	eraseURLsQuery        = "DELETE FROM urls WHERE user_id = $1 RETURNING short_url"
+	erasePendingQuery     = "DELETE FROM pending_deletions WHERE user_id = $1"
+	eraseDeadLettersQuery = "DELETE FROM deletion_dead_letters WHERE user_id = $1"
+	eraseAPIKeysQuery     = "DELETE FROM api_keys WHERE user_id = $1"
+	eraseDomainsQuery     = "DELETE FROM domains WHERE user_id = $1"
+	eraseSettingsQuery    = "DELETE FROM user_settings WHERE user_id = $1"
+	eraseMembersQuery     = "DELETE FROM org_members WHERE user_id = $1"
+	eraseUsersQuery       = "DELETE FROM users WHERE user_id = $1"
+	eraseAuditQuery       = `UPDATE audit_log SET before = NULL, after = NULL WHERE (before IS NOT NULL OR after IS NOT NULL)
+		AND (actor = $1 OR entity = 'url' AND entity_id IN (SELECT short_url FROM urls WHERE user_id = $1)
+		OR entity = 'member' AND split_part(entity_id, '/', 2) = $1)`
+)
+
+// queries run by ExportByUserID and ScanURLs within a read-only transaction
+const (
+	declareExportCursorQuery = `DECLARE export_urls NO SCROLL CURSOR FOR SELECT url, short_url, coalesce(domain, '') FROM urls
+		WHERE user_id = $1 AND is_deleted = false AND (expires_at IS NULL OR expires_at > now()) ORDER BY created_at, id`
+	declareScanCursorQuery = `DECLARE export_urls NO SCROLL CURSOR FOR SELECT url, short_url, coalesce(domain, '') FROM urls
+		WHERE is_deleted = false AND disabled_at IS NULL AND (expires_at IS NULL OR expires_at > now()) ORDER BY id`
+	// fetchExportCursorQuery limits the number of rows held in memory at once
+	fetchExportCursorQuery = "FETCH 500 FROM export_urls"
+)
+
+// likeEscaper escapes LIKE wildcards so that search queries match literally.
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+// importColumns lists urls_import columns filled by COPY.
+var importColumns = []string{"position", "user_id", "url", "short_url", "expires_at", "redirect_type"}
+
+// statements holds prepared statements reused by all storage calls instead of preparing them on every call.
+type statements struct {
+	selectBySURL       *sql.Stmt
+	selectOwner        *sql.Stmt
+	selectByUserIDAsc  *sql.Stmt
+	selectByUserIDDesc *sql.Stmt
+	selectByOrgIDAsc   *sql.Stmt
+	selectByOrgIDDesc  *sql.Stmt
+	searchURLsAsc      *sql.Stmt
+	searchURLsDesc     *sql.Stmt
+	searchByUserID     *sql.Stmt
+	selectSURLByURL    *sql.Stmt
+	insertURL          *sql.Stmt
+	insertURLBatch     *sql.Stmt
+	updateMetadata     *sql.Stmt
+	updateURL          *sql.Stmt
+	selectTags         *sql.Stmt
+	takeClick          *sql.Stmt
+	deleteBatch        *sql.Stmt
+	insertPending      *sql.Stmt
+	deletePending      *sql.Stmt
+	restoreBatch       *sql.Stmt
+	disableBatch       *sql.Stmt
+	insertClick        *sql.Stmt
+	touchURLs          *sql.Stmt
+	rollupClicks       *sql.Stmt
+	existsSURL         *sql.Stmt
+	selectDailyClicks  *sql.Stmt
+	selectServedClicks *sql.Stmt
+	selectReferrers    *sql.Stmt
+	selectDirectClicks *sql.Stmt
+	selectCountries    *sql.Stmt
+	selectVisitors     *sql.Stmt
+	insertVisitors     *sql.Stmt
+	lockVisitors       *sql.Stmt
+	updateVisitors     *sql.Stmt
+	selectHourlyRollup *sql.Stmt
+	selectDailyRollup  *sql.Stmt
+	selectServiceStats *sql.Stmt
+	insertUser         *sql.Stmt
+	updateUserRole     *sql.Stmt
+	selectUser         *sql.Stmt
+	selectUsersAsc     *sql.Stmt
+	selectUsersDesc    *sql.Stmt
+	selectUsersByID    *sql.Stmt
+	selectUserStats    *sql.Stmt
+	insertAPIKey       *sql.Stmt
+	selectAPIKey       *sql.Stmt
+	selectAPIKeys      *sql.Stmt
+	revokeAPIKey       *sql.Stmt
+	insertDomain       *sql.Stmt
+	purgeDomainClaims  *sql.Stmt
+	verifyDomain       *sql.Stmt
+	dropDomainClaims   *sql.Stmt
+	selectDomain       *sql.Stmt
+	selectDomainClaim  *sql.Stmt
+	selectDomains      *sql.Stmt
+	selectVerified     *sql.Stmt
+	upsertSettings     *sql.Stmt
+	selectSettings     *sql.Stmt
+	insertOrg          *sql.Stmt
+	selectOrg          *sql.Stmt
+	upsertMember       *sql.Stmt
+	deleteMember       *sql.Stmt
+	selectMembers      *sql.Stmt
+	selectMemberships  *sql.Stmt
+	insertAudit        *sql.Stmt
+	selectAuditAsc     *sql.Stmt
+	selectAuditDesc    *sql.Stmt
+}
+
+// click writer parameters
+const (
+	clickQueueSize     = 1000
+	clickFlushInterval = time.Second * 5
+	clickFlushAmount   = 100
+)
+
+// maxDeleteRetryBackoff caps the exponential delay between attempts to delete a batch.
+const maxDeleteRetryBackoff = 10 * time.Second
+
+// selectSURLsQuery lists sURLs of all entries for ScanSURLs, it is rarely run and therefore not prepared.
+const selectSURLsQuery = "SELECT short_url FROM urls"
+
+// selectEntriesQuery lists all entries for ScanEntries in the order they were stored, it is rarely run and therefore
+// not prepared.
+const selectEntriesQuery = "SELECT user_id, url, short_url, is_deleted, created_at, expires_at, redirect_type, disabled_at, title, favicon_url, password_hash, max_clicks, click_count, active_from, destinations, sticky, geo_targets, device_targets, domain, org_id, utm, " + tagsColumn + ", last_accessed_at, archived_at FROM urls ORDER BY id"
+
+// queries run by archiveStale, they are rarely run and therefore not prepared. Owners of live unarchived entries
+// neither created nor redirected to since $1 are noticed once, such entries are archived once noticed before $2
+// unless it is NULL.
+const (
+	noticeStaleQuery = `UPDATE urls SET archive_noticed_at = now()
+		WHERE is_deleted = false AND archived_at IS NULL AND archive_noticed_at IS NULL AND (expires_at IS NULL OR expires_at > now())
+		AND coalesce(last_accessed_at, created_at) <= $1 RETURNING short_url, url, user_id`
+	archiveStaleQuery = `UPDATE urls SET archived_at = now()
+		WHERE is_deleted = false AND archived_at IS NULL AND (expires_at IS NULL OR expires_at > now())
+		AND coalesce(last_accessed_at, created_at) <= $1 AND ($2::timestamptz IS NULL OR archive_noticed_at <= $2)
+		RETURNING short_url, url, user_id`
+)
+
+// insertDeadLetterQuery records a deletion which kept failing in place of its pending one, it is rarely run and
+// therefore not prepared.
+const insertDeadLetterQuery = `WITH pending AS (DELETE FROM pending_deletions WHERE user_id = $1 AND short_url = $2)
+	INSERT INTO deletion_dead_letters (user_id, short_url, error, attempts) VALUES ($1, $2, $3, $4)`
+
 type BatchBuffer struct {
 	RecordCh           chan modelstorage.URLChannelEntry
 	FlushPartsInterval time.Duration
 	FlushPartsAmount   int
+	MaxAttempts        int
+	RetryBackoff       time.Duration
 	Ctx                context.Context
 	CtxCancelFunc      context.CancelFunc
 	St                 *Storage
 }
 
-// GetFlushPartsAmount is a getter for the BatchBuffer capacity.
+// GetFlushPartsAmount is a getter for the number of sURLs a per-user batch is performed at.
 func (bb *BatchBuffer) GetFlushPartsAmount() int {
 	return bb.FlushPartsAmount
 }
@@ -36,104 +394,250 @@ func (bb *BatchBuffer) GetFlushTickerDuration() time.Duration {
 	return bb.FlushPartsInterval
 }
 
-// Flush flushes URL entries from BatchBuffer and sends them for deletion.
-func (bb *BatchBuffer) Flush(batch []modelstorage.URLChannelEntry) error {
-	uniqueMap := make(map[string][]string)
-	for _, b := range batch {
-		if _, exist := uniqueMap[b.UserID]; !exist {
-			uniqueMap[b.UserID] = []string{b.SURL}
-		} else {
-			uniqueMap[b.UserID] = append(uniqueMap[b.UserID], b.SURL)
+// deleteWithRetry deletes sURLs of userID retrying up to MaxAttempts times with exponential backoff starting at
+// RetryBackoff. Once attempts are exhausted sURLs are deleted one by one so that a poison entry does not take down the
+// whole group, and entries still failing are recorded in the dead-letter table.
+func (bb *BatchBuffer) deleteWithRetry(userID string, sURLs []string) error {
+	backoff := bb.RetryBackoff
+	var err error
+	for attempt := 1; ; attempt++ {
+		err = bb.St.DeleteBatch(bb.Ctx, sURLs, userID)
+		if err == nil {
+			return nil
+		}
+		if attempt >= bb.MaxAttempts {
+			break
+		}
+		bb.St.log.Warn("Deleting URLs: retrying", logger.Error(err), logger.Int("attempt", attempt), logger.Duration("backoff", backoff))
+		time.Sleep(backoff)
+		backoff *= 2
+		if backoff > maxDeleteRetryBackoff {
+			backoff = maxDeleteRetryBackoff
 		}
 	}
-	for userID, sURLs := range uniqueMap {
-		err := bb.St.DeleteBatch(bb.Ctx, sURLs, userID)
-		if err != nil {
-			return err
+	if len(sURLs) == 1 {
+		return bb.St.deadLetter(bb.Ctx, userID, sURLs[0], err, bb.MaxAttempts)
+	}
+	var firstErr error
+	for _, sURL := range sURLs {
+		err = bb.St.DeleteBatch(bb.Ctx, []string{sURL}, userID)
+		if err == nil {
+			continue
+		}
+		err = bb.St.deadLetter(bb.Ctx, userID, sURL, err, bb.MaxAttempts+1)
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// run performs batches coalesced from the deletion task queue until batches is closed or ctx is done. A failing batch
+// does not stop the worker, see deleteWithRetry.
+func (bb *BatchBuffer) run(ctx context.Context, batches <-chan workers.Batch) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case batch, ok := <-batches:
+			if !ok {
+				return
+			}
+			bb.St.log.Info("Deleting URLs", logger.String("userID", batch.UserID), logger.Int("count", len(batch.SURLs)))
+			err := bb.deleteWithRetry(batch.UserID, batch.SURLs)
+			if err != nil {
+				bb.St.log.Error("Deleting URLs", logger.Error(err))
+			}
+			atomic.AddInt64(&bb.St.pending, -int64(len(batch.SURLs)))
 		}
 	}
-	return nil
 }
 
 // Storage struct defines data structure handling and provides support for adding new implementations.
+// Storage is safe for concurrent use: calls run concurrently over the database/sql connection pool and rely on
+// DB constraints and transactions for consistency.
 type Storage struct {
-	mu  sync.Mutex
-	Cfg *config.StorageConfig
-	DB  *sql.DB
-	ch  chan modelstorage.URLChannelEntry
+	// pending counts items sent to the deletion task queue and not yet flushed, keep it first for 64-bit alignment
+	pending int64
+	Cfg     *config.StorageConfig
+	DB      *sql.DB
+	ch      chan modelstorage.URLChannelEntry
+	// queueCtx is done once the deletion task queue stops accepting items on shutdown
+	queueCtx context.Context
+	clickCh  chan modelstorage.ClickEntry
+	stmts    statements
+	// deleteWorkers perform batches coalesced from ch, their number can be changed while running
+	deleteWorkers *workers.Pool
+	// cache keeps hot live entries in front of DB, it is nil when caching is disabled
+	cache *cache.LRU
+	// replicas serve URL reads in place of DB, it is nil when no replicas are configured
+	replicas *replicaSet
+	log      *logger.Logger
+	// Events reports entries deleted by users, purged on expiration and disabled
+	modelstorage.Events
 }
 
 // InitStorage initializes a Storage object and sets its attributes.
-func InitStorage(ctx context.Context, wg *sync.WaitGroup, cfg *config.StorageConfig) (*Storage, error) {
+func InitStorage(ctx context.Context, wg *sync.WaitGroup, cfg *config.StorageConfig, log *logger.Logger) (*Storage, error) {
 	db, err := sql.Open("pgx", cfg.DatabaseDSN)
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
 	// make a channel for tunneling batches for deletion from processor to DB
-	recordCh := make(chan modelstorage.URLChannelEntry)
+	recordCh := make(chan modelstorage.URLChannelEntry, cfg.DeleteQueueSize)
 	// initialize a Storage
 	st := Storage{
-		Cfg: cfg,
-		DB:  db,
-		ch:  recordCh,
+		Cfg:      cfg,
+		DB:       db,
+		ch:       recordCh,
+		queueCtx: ctx,
+		clickCh:  make(chan modelstorage.ClickEntry, clickQueueSize),
+		log:      log,
+	}
+	if cfg.CacheSize > 0 {
+		st.cache = cache.NewLRU(cfg.CacheSize)
 	}
 	// initialize a Buffer (used only here)
 	ctxBuffer, cancelBuffer := context.WithCancel(context.Background())
 	buf := BatchBuffer{
 		RecordCh:           recordCh,
-		FlushPartsInterval: time.Second * 15,
-		FlushPartsAmount:   10,
+		FlushPartsInterval: cfg.DeleteFlushInterval,
+		FlushPartsAmount:   cfg.DeleteBatchSize,
+		MaxAttempts:        cfg.DeleteMaxAttempts,
+		RetryBackoff:       cfg.DeleteRetryBackoff,
 		Ctx:                ctxBuffer,
 		CtxCancelFunc:      cancelBuffer,
 		St:                 &st,
 	}
-	err = st.createTable(ctx)
+	// make sure the schema is up to date before the storage is handed over to the server
+	err = st.migrate(ctx, migrations.FS)
 	if err != nil {
-		log.Fatal(err)
+		db.Close()
+		return nil, err
+	}
+	err = st.prepareStatements(ctx)
+	if err != nil {
+		st.closeStatements()
+		db.Close()
+		return nil, err
+	}
+	err = db.PingContext(ctx)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	st.log.Info("PSQL DB schema is ready")
+	pending, err := st.retrievePending(ctx)
+	if err != nil {
+		st.closeStatements()
+		db.Close()
+		return nil, err
+	}
+	st.replicas, err = openReplicas(ctx, cfg.DatabaseReplicaDSNs, log)
+	if err != nil {
+		st.closeStatements()
+		db.Close()
+		return nil, err
+	}
+	go st.replicas.run(ctx)
+	// coalesce the deletion task queue into per-user batches performed by delete workers, workers outlive ctx until
+	// the last batches are performed and only return earlier when the pool shrinks
+	batches := make(chan workers.Batch, cfg.DeleteWorkers)
+	go workers.Coalesce(ctx, recordCh, batches, buf.GetFlushPartsAmount(), buf.GetFlushTickerDuration())
+	st.deleteWorkers = workers.NewPool(buf.Ctx, cfg.DeleteWorkers, func(ctx context.Context) {
+		buf.run(ctx, batches)
+	})
+	// requeue deletions left pending by the previous run, they may exceed the queue capacity
+	if len(pending) > 0 {
+		st.log.Info("Requeueing pending deletions", logger.Int("count", len(pending)))
+		atomic.AddInt64(&st.pending, int64(len(pending)))
+		go func() {
+			for i, item := range pending {
+				select {
+				case <-ctx.Done():
+					// the rest stays pending until the next start
+					atomic.AddInt64(&st.pending, -int64(len(pending)-i))
+					return
+				case st.ch <- item:
+				}
+			}
+		}()
 	}
 	go func() {
 		defer wg.Done()
-		t := time.NewTicker(buf.GetFlushTickerDuration())
-		parts := make([]modelstorage.URLChannelEntry, 0, buf.GetFlushPartsAmount())
+		purgeTicker := time.NewTicker(cfg.ExpiredPurgeInterval)
+		defer purgeTicker.Stop()
+		deletedPurgeTicker := time.NewTicker(cfg.DeletedPurgeInterval)
+		defer deletedPurgeTicker.Stop()
+		clickTicker := time.NewTicker(clickFlushInterval)
+		defer clickTicker.Stop()
+		rollupTicker := time.NewTicker(cfg.ClickRollupInterval)
+		defer rollupTicker.Stop()
+		// stale links are archived only when enabled
+		var staleTicker <-chan time.Time
+		if cfg.StaleAfter > 0 {
+			t := time.NewTicker(cfg.StaleArchiveInterval)
+			defer t.Stop()
+			staleTicker = t.C
+		}
+		clicks := make([]modelstorage.ClickEntry, 0, clickFlushAmount)
 		for {
 			select {
 			case <-ctx.Done():
-				if len(parts) > 0 {
-					log.Println("Deleting URLs due to context cancellation", parts)
-					err := buf.Flush(parts)
+				if len(clicks) > 0 {
+					err := st.flushClicks(buf.Ctx, clicks)
 					if err != nil {
-						log.Fatal(err)
+						st.log.Error("Recording clicks", logger.Error(err))
 					}
 				}
-				close(buf.RecordCh)
+				// let delete workers perform the last batches before closing DB
+				st.deleteWorkers.Wait()
 				buf.CtxCancelFunc()
+				st.closeStatements()
+				st.replicas.close()
 				err := st.DB.Close()
 				if err != nil {
-					log.Fatal(err)
+					st.log.Error("Closing PSQL DB connection", logger.Error(err))
+					return
 				}
-				log.Println("PSQL DB connection closed successfully")
+				st.log.Info("PSQL DB connection closed successfully")
 				return
-			case <-t.C:
-				if len(parts) > 0 {
-					log.Println("Deleting URLs due to timeout", parts)
-					err := buf.Flush(parts)
+			case <-clickTicker.C:
+				if len(clicks) > 0 {
+					err := st.flushClicks(buf.Ctx, clicks)
 					if err != nil {
-						log.Fatal(err)
+						st.log.Error("Recording clicks", logger.Error(err))
 					}
-					parts = make([]modelstorage.URLChannelEntry, 0, buf.GetFlushPartsAmount())
-				}
-			case part, ok := <-buf.RecordCh:
-				if !ok {
-					return
+					clicks = make([]modelstorage.ClickEntry, 0, clickFlushAmount)
 				}
-				parts = append(parts, part)
-				if len(parts) >= buf.GetFlushPartsAmount() {
-					log.Println("Deleted URLs due to exceeding capacity", parts)
-					err := buf.Flush(parts)
+			case click := <-st.clickCh:
+				clicks = append(clicks, click)
+				if len(clicks) >= clickFlushAmount {
+					err := st.flushClicks(buf.Ctx, clicks)
 					if err != nil {
-						log.Fatal(err)
+						st.log.Error("Recording clicks", logger.Error(err))
 					}
-					parts = make([]modelstorage.URLChannelEntry, 0, buf.GetFlushPartsAmount())
+					clicks = make([]modelstorage.ClickEntry, 0, clickFlushAmount)
+				}
+			case <-rollupTicker.C:
+				err := st.rollupClicks(buf.Ctx)
+				if err != nil {
+					st.log.Error("Rolling up clicks", logger.Error(err))
+				}
+			case <-purgeTicker.C:
+				err := st.purgeExpired(buf.Ctx)
+				if err != nil {
+					st.log.Error("Purging expired URLs", logger.Error(err))
+				}
+			case <-deletedPurgeTicker.C:
+				err := st.purgeDeleted(buf.Ctx, cfg.DeletedRetention)
+				if err != nil {
+					st.log.Error("Purging deleted URLs", logger.Error(err))
+				}
+			case <-staleTicker:
+				err := st.archiveStale(buf.Ctx, modelstorage.ArchivePolicy{StaleAfter: cfg.StaleAfter, NoticeBefore: cfg.StaleNoticeBefore})
+				if err != nil {
+					st.log.Error("Archiving stale URLs", logger.Error(err))
 				}
 			}
 		}
@@ -141,28 +645,118 @@ func InitStorage(ctx context.Context, wg *sync.WaitGroup, cfg *config.StorageCon
 	return &st, nil
 }
 
-// SendToQueue sends a modelstorage.URLChannelEntry batch of sURLs from one userID to the deletion task queue.
-func (s *Storage) SendToQueue(item modelstorage.URLChannelEntry) {
-	s.ch <- item
+// SetDeleteWorkers starts or stops delete workers so that n of them perform coalesced deletion batches, stopped
+// workers finish the batch they perform first.
+func (s *Storage) SetDeleteWorkers(n int) {
+	s.deleteWorkers.Resize(n)
 }
 
-// Retrieve returns a URL corresponding to sURL.
-func (s *Storage) Retrieve(ctx context.Context, sURL string) (URL string, err error) {
-	// prepare query statement
-	selectStmt, err := s.DB.PrepareContext(ctx, "SELECT * FROM urls WHERE short_url = $1")
-	if err != nil {
-		return "", &storageErrors.StatementPSQLError{Err: err}
+// SendToQueue persists items in the pending_deletions table and sends them to the deletion task queue, items which are
+// not deleted by the time the process stops are sent again at the next start. It returns storageErrors.QueueClosedError
+// once the queue stops accepting items on shutdown.
+func (s *Storage) SendToQueue(ctx context.Context, items []modelstorage.URLChannelEntry) error {
+	if len(items) == 0 {
+		return nil
+	}
+	if err := s.queueCtx.Err(); err != nil {
+		s.logger(ctx).Warn("Queueing deletion", logger.Error(err))
+		return &storageErrors.QueueClosedError{Err: err}
+	}
+	userIDs := make([]string, 0, len(items))
+	sURLs := make([]string, 0, len(items))
+	for _, item := range items {
+		userIDs = append(userIDs, item.UserID)
+		sURLs = append(sURLs, item.SURL)
+	}
+	// create channels for listening to the go routine result
+	insertDone := make(chan bool, 1)
+	insertError := make(chan error, 1)
+	go func() {
+		_, err := s.stmts.insertPending.ExecContext(ctx, pq.Array(userIDs), pq.Array(sURLs))
+		if err != nil {
+			insertError <- &storageErrors.ExecutionPSQLError{Err: err}
+			return
+		}
+		insertDone <- true
+	}()
+
+	// wait for the first channel to retrieve a value
+	select {
+	case <-ctx.Done():
+		s.logger(ctx).Warn("Queueing deletion", logger.Error(ctx.Err()))
+		return &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
+	case insErr := <-insertError:
+		s.logger(ctx).Warn("Queueing deletion", logger.Error(insErr))
+		return insErr
+	case <-insertDone:
+		s.logger(ctx).Debug("Queueing deletion", logger.Int("count", len(items)))
+	}
+	// items which could not be sent stay persisted and are sent at the next start
+	for i, item := range items {
+		atomic.AddInt64(&s.pending, 1)
+		select {
+		case <-s.queueCtx.Done():
+			atomic.AddInt64(&s.pending, -1)
+			s.logger(ctx).Warn("Queueing deletion", logger.Error(s.queueCtx.Err()), logger.Int("unsent", len(items)-i))
+			return &storageErrors.QueueClosedError{Err: s.queueCtx.Err()}
+		case <-ctx.Done():
+			atomic.AddInt64(&s.pending, -1)
+			s.logger(ctx).Warn("Queueing deletion", logger.Error(ctx.Err()), logger.Int("unsent", len(items)-i))
+			return &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
+		case s.ch <- item:
+		}
+	}
+	return nil
+}
+
+// QueueDepth returns the number of items sent to the deletion task queue and not yet flushed, including items
+// blocked waiting for the queue.
+func (s *Storage) QueueDepth() int {
+	return int(atomic.LoadInt64(&s.pending))
+}
+
+// SendClick sends a redirect record to the click writer queue, the record is dropped if the queue is full so that
+// redirects are never slowed down by analytics.
+func (s *Storage) SendClick(item modelstorage.ClickEntry) {
+	select {
+	case s.clickCh <- item:
+	default:
+		s.log.Warn("Recording click: queue is full, dropping click", logger.String("sURL", item.SURL))
+	}
+}
+
+// Retrieve returns the live entry corresponding to sURL.
+func (s *Storage) Retrieve(ctx context.Context, sURL string) (entry modelstorage.URLMapEntry, err error) {
+	// serve hot entries from cache without hitting DB
+	generation := s.cache.Generation()
+	if entry, ok := s.cache.Get(sURL); ok {
+		if modelstorage.IsExpired(entry.ExpiresAt) {
+			s.logger(ctx).Debug("Retrieving URL from cache: has expired", logger.String("sURL", sURL))
+			return modelstorage.URLMapEntry{}, &storageErrors.ExpiredError{Err: nil, SURL: sURL}
+		}
+		s.logger(ctx).Debug("Retrieving URL from cache", logger.String("sURL", sURL), logger.String("url", entry.URL))
+		return entry, nil
 	}
-	defer selectStmt.Close()
 
 	// create channels for listening to the go routine result
-	retrieveDone := make(chan string)
-	retrieveError := make(chan error)
+	retrieveDone := make(chan modelstorage.URLMapEntry, 1)
+	retrieveError := make(chan error, 1)
 	go func() {
-		s.mu.Lock()
-		defer s.mu.Unlock()
 		var queryOutput modelstorage.URLPostgresEntry
-		err := selectStmt.QueryRowContext(ctx, sURL).Scan(&queryOutput.ID, &queryOutput.UserID, &queryOutput.URL, &queryOutput.SURL, &queryOutput.IsDeleted)
+		scan := func(row *sql.Row) error {
+			return row.Scan(&queryOutput.ID, &queryOutput.UserID, &queryOutput.URL, &queryOutput.SURL, &queryOutput.IsDeleted, &queryOutput.ExpiresAt, &queryOutput.RedirectType, &queryOutput.DisabledAt, &queryOutput.PasswordHash, &queryOutput.MaxClicks, &queryOutput.ClickCount, &queryOutput.ActiveFrom, &queryOutput.Destinations, &queryOutput.Sticky, &queryOutput.GeoTargets, &queryOutput.DeviceTargets, &queryOutput.Domain, &queryOutput.OrgID, &queryOutput.UTM, &queryOutput.CreatedAt, &queryOutput.EditedAt)
+		}
+		// entries read from a replica are not cached since the replica may lag behind deletions
+		replica := s.replicas.pick()
+		var err error
+		if replica != nil {
+			err = scan(replica.db.QueryRowContext(ctx, selectBySURLQuery, sURL))
+		}
+		if replica == nil || err != nil {
+			// fall back to DB for entries not replicated yet and for failing replicas
+			replica = nil
+			err = scan(s.stmts.selectBySURL.QueryRowContext(ctx, sURL))
+		}
 		if err != nil {
 			switch {
 			case errors.Is(err, sql.ErrNoRows):
@@ -173,207 +767,3343 @@ func (s *Storage) Retrieve(ctx context.Context, sURL string) (URL string, err er
 				return
 			}
 		}
+		if queryOutput.DisabledAt.Valid {
+			retrieveError <- &storageErrors.DisabledError{Err: nil, SURL: sURL}
+			return
+		}
 		if queryOutput.IsDeleted {
 			retrieveError <- &storageErrors.DeletedError{Err: err, SURL: sURL}
 			return
 		}
-		retrieveDone <- queryOutput.URL
+		if queryOutput.ExpiresAt.Valid && modelstorage.IsExpired(&queryOutput.ExpiresAt.Time) {
+			retrieveError <- &storageErrors.ExpiredError{Err: nil, SURL: sURL}
+			return
+		}
+		if modelstorage.IsExhausted(queryOutput.MaxClicks, queryOutput.ClickCount) {
+			retrieveError <- &storageErrors.ExhaustedError{Err: nil, SURL: sURL}
+			return
+		}
+		// entries which are not active yet are not cached, so that cached entries never need the check
+		if queryOutput.ActiveFrom.Valid && modelstorage.IsNotActive(&queryOutput.ActiveFrom.Time) {
+			retrieveError <- &storageErrors.NotActiveError{Err: nil, SURL: sURL}
+			return
+		}
+		entry := modelstorage.URLMapEntry{
+			URL:          queryOutput.URL,
+			UserID:       queryOutput.UserID,
+			RedirectType: queryOutput.RedirectType,
+			PasswordHash: queryOutput.PasswordHash.String,
+			Domain:       queryOutput.Domain.String,
+			OrgID:        queryOutput.OrgID.String,
+			MaxClicks:    queryOutput.MaxClicks,
+			ClickCount:   queryOutput.ClickCount,
+			Sticky:       queryOutput.Sticky,
+		}
+		if queryOutput.ExpiresAt.Valid {
+			entry.ExpiresAt = &queryOutput.ExpiresAt.Time
+		}
+		if queryOutput.CreatedAt.Valid {
+			entry.CreatedAt = queryOutput.CreatedAt.Time
+		}
+		if queryOutput.EditedAt.Valid {
+			entry.EditedAt = &queryOutput.EditedAt.Time
+		}
+		if queryOutput.Destinations.Valid {
+			err = json.Unmarshal([]byte(queryOutput.Destinations.String), &entry.Destinations)
+			if err != nil {
+				retrieveError <- &storageErrors.ScanningPSQLError{Err: err}
+				return
+			}
+		}
+		if queryOutput.GeoTargets.Valid {
+			err = json.Unmarshal([]byte(queryOutput.GeoTargets.String), &entry.GeoTargets)
+			if err != nil {
+				retrieveError <- &storageErrors.ScanningPSQLError{Err: err}
+				return
+			}
+		}
+		if queryOutput.DeviceTargets.Valid {
+			err = json.Unmarshal([]byte(queryOutput.DeviceTargets.String), &entry.DeviceTargets)
+			if err != nil {
+				retrieveError <- &storageErrors.ScanningPSQLError{Err: err}
+				return
+			}
+		}
+		if queryOutput.UTM.Valid {
+			err = json.Unmarshal([]byte(queryOutput.UTM.String), &entry.UTM)
+			if err != nil {
+				retrieveError <- &storageErrors.ScanningPSQLError{Err: err}
+				return
+			}
+		}
+		// cache live entries only, skipping ones invalidated by a deletion while being read and ones limited to a
+		// number of clicks since their counts change with every redirect
+		if entry.MaxClicks == 0 && replica == nil {
+			s.cache.AddIfUnchanged(generation, sURL, entry)
+		}
+		retrieveDone <- entry
 	}()
 
 	// wait for the first channel to retrieve a value
 	select {
 	case <-ctx.Done():
-		log.Println("Retrieving URL:", ctx.Err())
-		return "", &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
+		s.logger(ctx).Warn("Retrieving URL", logger.Error(ctx.Err()))
+		return modelstorage.URLMapEntry{}, &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
 	case rtrvError := <-retrieveError:
-		log.Println("Retrieving URL:", rtrvError.Error())
-		return "", rtrvError
-	case URL := <-retrieveDone:
-		log.Println("Retrieving URL:", sURL, "as", URL)
-		return URL, nil
+		s.logger(ctx).Warn("Retrieving URL", logger.Error(rtrvError))
+		return modelstorage.URLMapEntry{}, rtrvError
+	case entry := <-retrieveDone:
+		s.logger(ctx).Debug("Retrieving URL", logger.String("sURL", sURL), logger.String("url", entry.URL))
+		return entry, nil
 	}
 }
 
-// RetrieveByUserID returns a slice of URL:sURL pairs defined as modelurl.FullURL for one particular user ID.
-func (s *Storage) RetrieveByUserID(ctx context.Context, userID string) (URLs []modelurl.FullURL, err error) {
-	// prepare query statement
-	selectStmt, err := s.DB.PrepareContext(ctx, "SELECT * FROM urls WHERE user_id = $1 AND is_deleted = false")
-	if err != nil {
-		return nil, &storageErrors.StatementPSQLError{Err: err}
-	}
-	defer selectStmt.Close()
-
+// RetrieveOwner returns the user who created sURL and the organization it belongs to whatever the state of the link.
+func (s *Storage) RetrieveOwner(ctx context.Context, sURL string) (userID, orgID string, err error) {
 	// create channels for listening to the go routine result
-	retrieveDone := make(chan []modelurl.FullURL)
-	retrieveError := make(chan error)
+	retrieveDone := make(chan [2]string, 1)
+	retrieveError := make(chan error, 1)
 	go func() {
-		s.mu.Lock()
-		defer s.mu.Unlock()
-		rows, err := selectStmt.QueryContext(ctx, userID)
+		var userID string
+		var orgID sql.NullString
+		err := s.stmts.selectOwner.QueryRowContext(ctx, sURL).Scan(&userID, &orgID)
 		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				retrieveError <- &storageErrors.NotFoundError{Err: err, SURL: sURL}
+				return
+			}
 			retrieveError <- &storageErrors.ExecutionPSQLError{Err: err}
 			return
 		}
-		defer rows.Close()
+		retrieveDone <- [2]string{userID, orgID.String}
+	}()
 
-		// extract DB row data into corresponding go structure
-		var queryOutput []modelstorage.URLPostgresEntry
-		for rows.Next() {
-			var queryOutputRow modelstorage.URLPostgresEntry
-			err = rows.Scan(&queryOutputRow.ID, &queryOutputRow.UserID, &queryOutputRow.URL, &queryOutputRow.SURL, &queryOutputRow.IsDeleted)
-			if err != nil {
-				retrieveError <- &storageErrors.ScanningPSQLError{Err: err}
+	// wait for the first channel to retrieve a value
+	select {
+	case <-ctx.Done():
+		s.logger(ctx).Warn("Retrieving URL owner", logger.Error(ctx.Err()))
+		return "", "", &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
+	case rtrvError := <-retrieveError:
+		s.logger(ctx).Warn("Retrieving URL owner", logger.Error(rtrvError))
+		return "", "", rtrvError
+	case owner := <-retrieveDone:
+		s.logger(ctx).Debug("Retrieving URL owner", logger.String("sURL", sURL), logger.String("userID", owner[0]))
+		return owner[0], owner[1], nil
+	}
+}
+
+// RetrieveByUserID returns a page of URL:sURL pairs defined as modelurl.FullURL for one particular user ID sorted by
+// creation or last access time.
+func (s *Storage) RetrieveByUserID(ctx context.Context, userID string, opts modelurl.ListOptions) (URLs []modelurl.FullURL, err error) {
+	// create channels for listening to the go routine result
+	retrieveDone := make(chan []modelurl.FullURL, 1)
+	retrieveError := make(chan error, 1)
+	go func() {
+		if replica := s.replicas.pick(); replica != nil {
+			query := selectByUserIDAscQuery
+			if opts.Desc {
+				query = selectByUserIDDescQuery
+			}
+			URLs, err := scanURLs(replica.db.QueryContext(ctx, query, listArgs(userID, opts)...))
+			if err == nil {
+				retrieveDone <- URLs
 				return
 			}
-			queryOutput = append(queryOutput, queryOutputRow)
+			s.logger(ctx).Warn("Retrieving URLs by user ID from replica", logger.Int("replica", replica.index), logger.Error(err))
 		}
-		err = rows.Err()
+		stmt := s.stmts.selectByUserIDAsc
+		if opts.Desc {
+			stmt = s.stmts.selectByUserIDDesc
+		}
+		URLs, err := queryURLs(ctx, stmt, userID, opts)
 		if err != nil {
-			retrieveError <- &storageErrors.ScanningPSQLError{Err: err}
+			retrieveError <- err
+			return
 		}
-		// extract go structure data into necessary output structure
-		var URLs []modelurl.FullURL
-		for _, entry := range queryOutput {
-			fullURL := modelurl.FullURL{
-				URL:  entry.URL,
-				SURL: entry.SURL,
+		retrieveDone <- URLs
+	}()
+	// wait for the first channel to retrieve a value
+	select {
+	case <-ctx.Done():
+		s.logger(ctx).Warn("Retrieving URLs by user ID", logger.Error(ctx.Err()))
+		return nil, &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
+	case rtrvError := <-retrieveError:
+		s.logger(ctx).Warn("Retrieving URLs by user ID", logger.Error(rtrvError))
+		return nil, rtrvError
+	case URLs := <-retrieveDone:
+		s.logger(ctx).Debug("Retrieving URLs by user ID", logger.String("userID", userID), logger.Int("count", len(URLs)))
+		return URLs, nil
+	}
+}
+
+// SearchByUserID returns a page of URL:sURL pairs of one particular user having a word starting with each of terms in
+// their title, tags or URL ranked by relevance, the search runs on a replica when there is one.
+func (s *Storage) SearchByUserID(ctx context.Context, userID string, terms []string, opts modelurl.ListOptions) (URLs []modelurl.FullURL, err error) {
+	// create channels for listening to the go routine result
+	retrieveDone := make(chan []modelurl.FullURL, 1)
+	retrieveError := make(chan error, 1)
+	go func() {
+		args := []interface{}{userID, sql.NullInt64{Int64: int64(opts.Limit), Valid: opts.Limit > 0}, opts.Offset, textSearchQuery(terms), opts.IncludeArchived}
+		if replica := s.replicas.pick(); replica != nil {
+			URLs, err := scanURLs(replica.db.QueryContext(ctx, searchByUserIDQuery, args...))
+			if err == nil {
+				retrieveDone <- URLs
+				return
 			}
-			URLs = append(URLs, fullURL)
+			s.logger(ctx).Warn("Searching URLs by user ID from replica", logger.Int("replica", replica.index), logger.Error(err))
+		}
+		URLs, err := scanURLs(s.stmts.searchByUserID.QueryContext(ctx, args...))
+		if err != nil {
+			retrieveError <- err
+			return
 		}
 		retrieveDone <- URLs
 	}()
 	// wait for the first channel to retrieve a value
 	select {
 	case <-ctx.Done():
-		log.Println("Retrieving URLs by user ID:", ctx.Err())
+		s.logger(ctx).Warn("Searching URLs by user ID", logger.Error(ctx.Err()))
 		return nil, &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
 	case rtrvError := <-retrieveError:
-		log.Println("Retrieving URLs by user ID:", rtrvError.Error())
+		s.logger(ctx).Warn("Searching URLs by user ID", logger.Error(rtrvError))
 		return nil, rtrvError
 	case URLs := <-retrieveDone:
-		log.Println("Retrieving URLs by user ID:", URLs)
+		s.logger(ctx).Debug("Searching URLs by user ID", logger.String("userID", userID), logger.Int("count", len(URLs)))
 		return URLs, nil
 	}
 }
 
-// Dump stores a pair of sURL and URL as a key-value pair in DB.
-func (s *Storage) Dump(ctx context.Context, URL string, sURL string, userID string) error {
-	// prepare INSERT statement
-	dumpStmt, err := s.DB.PrepareContext(ctx, "INSERT INTO urls (user_id, url, short_url) VALUES ($1, $2, $3)")
-	if err != nil {
-		return &storageErrors.StatementPSQLError{Err: err}
+// textSearchQuery converts search terms of letters and digits into a text search query matching words starting with
+// each of them.
+func textSearchQuery(terms []string) string {
+	prefixes := make([]string, 0, len(terms))
+	for _, term := range terms {
+		prefixes = append(prefixes, term+":*")
 	}
-	defer dumpStmt.Close()
-	// prepare SELECT statement
-	selectStmt, err := s.DB.PrepareContext(ctx, "SELECT short_url FROM urls WHERE url = $1")
-	if err != nil {
-		return &storageErrors.StatementPSQLError{Err: err}
-	}
-	defer selectStmt.Close()
+	return strings.Join(prefixes, " & ")
+}
 
+// RetrieveByOrgID returns a page of URL:sURL pairs defined as modelurl.FullURL of one particular organization sorted
+// by creation or last access time.
+func (s *Storage) RetrieveByOrgID(ctx context.Context, orgID string, opts modelurl.ListOptions) (URLs []modelurl.FullURL, err error) {
 	// create channels for listening to the go routine result
-	dumpDone := make(chan bool)
-	dumpError := make(chan error)
+	retrieveDone := make(chan []modelurl.FullURL, 1)
+	retrieveError := make(chan error, 1)
 	go func() {
-		s.mu.Lock()
-		defer s.mu.Unlock()
-		_, err := dumpStmt.ExecContext(ctx, userID, URL, sURL)
+		stmt := s.stmts.selectByOrgIDAsc
+		if opts.Desc {
+			stmt = s.stmts.selectByOrgIDDesc
+		}
+		URLs, err := queryURLs(ctx, stmt, orgID, opts)
 		if err != nil {
-			if err, ok := err.(*pgconn.PgError); ok && err.Code == pgerrcode.UniqueViolation {
-				// retrieve already existing sURL for violating unique constraint URL
-				var validsURL string
-				err := selectStmt.QueryRowContext(ctx, URL).Scan(&validsURL)
-				if err != nil {
-					dumpError <- &storageErrors.ExecutionPSQLError{Err: err}
-					return
-				}
-				dumpError <- &storageErrors.AlreadyExistsError{Err: err, URL: URL, ValidSURL: validsURL}
-				return
-			}
-			dumpError <- &storageErrors.ExecutionPSQLError{Err: err}
+			retrieveError <- err
 			return
 		}
-		dumpDone <- true
+		retrieveDone <- URLs
 	}()
-
 	// wait for the first channel to retrieve a value
 	select {
 	case <-ctx.Done():
-		log.Println("Dumping URL:", ctx.Err())
-		return &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
-	case dmpError := <-dumpError:
-		log.Println("Dumping URL:", dmpError.Error())
-		return dmpError
-	case <-dumpDone:
-		log.Println("Dumping URL:", sURL, "as", URL)
-		return nil
+		s.logger(ctx).Warn("Retrieving URLs by organization ID", logger.Error(ctx.Err()))
+		return nil, &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
+	case rtrvError := <-retrieveError:
+		s.logger(ctx).Warn("Retrieving URLs by organization ID", logger.Error(rtrvError))
+		return nil, rtrvError
+	case URLs := <-retrieveDone:
+		s.logger(ctx).Debug("Retrieving URLs by organization ID", logger.String("orgID", orgID), logger.Int("count", len(URLs)))
+		return URLs, nil
 	}
 }
 
-// DeleteBatch assigns a deletion flag for DB entries, does not use task management.
-func (s *Storage) DeleteBatch(ctx context.Context, sURLs []string, userID string) error {
-	// prepare DELETE statement
-	deleteStmt, err := s.DB.PrepareContext(ctx, "UPDATE urls SET is_deleted = true WHERE user_id = $1 AND short_url = ANY($2)")
-	if err != nil {
-		return &storageErrors.StatementPSQLError{Err: err}
-	}
-	defer deleteStmt.Close()
-	//begin transaction
-	tx, err := s.DB.BeginTx(ctx, nil)
-	if err != nil {
-		return &storageErrors.ExecutionPSQLError{Err: err}
-	}
-	defer tx.Rollback()
-	txDeleteStmt := tx.StmtContext(ctx, deleteStmt)
+// SearchURLs returns a page of URL:sURL pairs of all users whose URL or sURL contains query sorted by creation or last
+// access time.
+func (s *Storage) SearchURLs(ctx context.Context, query string, opts modelurl.ListOptions) (URLs []modelurl.FullURL, err error) {
 	// create channels for listening to the go routine result
-	deleteDone := make(chan bool)
-	deleteError := make(chan error)
+	retrieveDone := make(chan []modelurl.FullURL, 1)
+	retrieveError := make(chan error, 1)
 	go func() {
-		_, err = txDeleteStmt.ExecContext(
-			ctx,
-			userID,
-			pq.Array(sURLs),
-		)
+		stmt := s.stmts.searchURLsAsc
+		if opts.Desc {
+			stmt = s.stmts.searchURLsDesc
+		}
+		URLs, err := queryURLs(ctx, stmt, "%"+likeEscaper.Replace(query)+"%", opts)
 		if err != nil {
-			deleteError <- &storageErrors.ExecutionPSQLError{Err: err}
+			retrieveError <- err
+			return
 		}
-		deleteDone <- true
+		retrieveDone <- URLs
 	}()
-
 	// wait for the first channel to retrieve a value
 	select {
 	case <-ctx.Done():
-		log.Println("Deleting URL:", ctx.Err())
-		return &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
-	case dltError := <-deleteError:
-		log.Println("Deleting URL:", dltError.Error())
-		return dltError
-	case <-deleteDone:
-		log.Println("Deleting URL:", sURLs)
-		return tx.Commit()
+		s.logger(ctx).Warn("Searching URLs", logger.Error(ctx.Err()))
+		return nil, &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
+	case rtrvError := <-retrieveError:
+		s.logger(ctx).Warn("Searching URLs", logger.Error(rtrvError))
+		return nil, rtrvError
+	case URLs := <-retrieveDone:
+		s.logger(ctx).Debug("Searching URLs", logger.String("query", query), logger.Int("count", len(URLs)))
+		return URLs, nil
 	}
 }
 
-// PingDB performs DB ping.
+// queryURLs runs stmt selecting a page of URLs of the user, the organization or the search pattern id defined by opts.
+func queryURLs(ctx context.Context, stmt *sql.Stmt, id string, opts modelurl.ListOptions) ([]modelurl.FullURL, error) {
+	return scanURLs(stmt.QueryContext(ctx, listArgs(id, opts)...))
+}
+
+// listArgs returns arguments of a query selecting a page of URLs by id.
+func listArgs(id string, opts modelurl.ListOptions) []interface{} {
+	limit := sql.NullInt64{Int64: int64(opts.Limit), Valid: opts.Limit > 0}
+	return []interface{}{id, limit, opts.Offset, opts.Tag, opts.SortBy, opts.IncludeArchived}
+}
+
+// scanURLs reads URLs selected by a query, err is the error of the query.
+func scanURLs(rows *sql.Rows, err error) ([]modelurl.FullURL, error) {
+	if err != nil {
+		return nil, &storageErrors.ExecutionPSQLError{Err: err}
+	}
+	defer rows.Close()
+
+	// extract DB row data into corresponding go structure
+	var queryOutput []modelstorage.URLPostgresEntry
+	for rows.Next() {
+		var queryOutputRow modelstorage.URLPostgresEntry
+		err = rows.Scan(&queryOutputRow.ID, &queryOutputRow.UserID, &queryOutputRow.URL, &queryOutputRow.SURL, &queryOutputRow.IsDeleted, &queryOutputRow.ExpiresAt, &queryOutputRow.RedirectType, &queryOutputRow.DisabledAt, &queryOutputRow.Title, &queryOutputRow.FaviconURL, &queryOutputRow.Domain, pq.Array(&queryOutputRow.Tags), &queryOutputRow.CreatedAt, &queryOutputRow.LastAccessedAt, &queryOutputRow.ArchivedAt)
+		if err != nil {
+			return nil, &storageErrors.ScanningPSQLError{Err: err}
+		}
+		queryOutput = append(queryOutput, queryOutputRow)
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, &storageErrors.ScanningPSQLError{Err: err}
+	}
+	// extract go structure data into necessary output structure
+	var URLs []modelurl.FullURL
+	for _, entry := range queryOutput {
+		fullURL := modelurl.FullURL{
+			URL:        entry.URL,
+			SURL:       entry.SURL,
+			Title:      entry.Title.String,
+			FaviconURL: entry.FaviconURL.String,
+			Disabled:   entry.DisabledAt.Valid,
+			Domain:     entry.Domain.String,
+			UserID:     entry.UserID,
+			Tags:       entry.Tags,
+			CreatedAt:  entry.CreatedAt.Time,
+		}
+		if entry.LastAccessedAt.Valid {
+			lastAccessedAt := entry.LastAccessedAt.Time
+			fullURL.LastAccessedAt = &lastAccessedAt
+		}
+		if entry.ArchivedAt.Valid {
+			archivedAt := entry.ArchivedAt.Time
+			fullURL.ArchivedAt = &archivedAt
+		}
+		URLs = append(URLs, fullURL)
+	}
+	return URLs, nil
+}
+
+// ExportByUserID passes every URL:sURL pair of one particular user to fn reading them through a cursor page by page,
+// fn is called synchronously and the first error it returns stops the export.
+func (s *Storage) ExportByUserID(ctx context.Context, userID string, fn func(URL modelurl.FullURL) error) error {
+	count, err := s.exportByUserID(ctx, userID, fn)
+	if err != nil {
+		if ctx.Err() != nil {
+			s.logger(ctx).Warn("Exporting URLs by user ID", logger.Error(ctx.Err()))
+			return &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
+		}
+		s.logger(ctx).Warn("Exporting URLs by user ID", logger.Error(err))
+		return err
+	}
+	s.logger(ctx).Debug("Exporting URLs by user ID", logger.String("userID", userID), logger.Int("count", count))
+	return nil
+}
+
+// ScanURLs passes every URL:sURL pair which is neither deleted, expired nor disabled to fn, pairs are read page by page
+// through a cursor. fn is called synchronously and the first error it returns stops the scan.
+func (s *Storage) ScanURLs(ctx context.Context, fn func(URL modelurl.FullURL) error) error {
+	count, err := s.exportCursor(ctx, declareScanCursorQuery, fn)
+	if err != nil {
+		if ctx.Err() != nil {
+			s.logger(ctx).Warn("Scanning URLs", logger.Error(ctx.Err()))
+			return &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
+		}
+		s.logger(ctx).Warn("Scanning URLs", logger.Error(err))
+		return err
+	}
+	s.logger(ctx).Debug("Scanning URLs", logger.Int("count", count))
+	return nil
+}
+
+// ScanSURLs passes sURLs of all entries whatever their state to fn, rows are streamed rather than read at once. fn is
+// called synchronously and the first error it returns stops the scan.
+func (s *Storage) ScanSURLs(ctx context.Context, fn func(sURL string) error) error {
+	count, err := s.scanSURLs(ctx, fn)
+	if err != nil {
+		if ctx.Err() != nil {
+			s.logger(ctx).Warn("Scanning sURLs", logger.Error(ctx.Err()))
+			return &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
+		}
+		s.logger(ctx).Warn("Scanning sURLs", logger.Error(err))
+		return err
+	}
+	s.logger(ctx).Debug("Scanning sURLs", logger.Int("count", count))
+	return nil
+}
+
+// scanSURLs implements ScanSURLs and returns the number of passed sURLs.
+func (s *Storage) scanSURLs(ctx context.Context, fn func(sURL string) error) (count int, err error) {
+	rows, err := s.DB.QueryContext(ctx, selectSURLsQuery)
+	if err != nil {
+		return 0, &storageErrors.ExecutionPSQLError{Err: err}
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var sURL string
+		err = rows.Scan(&sURL)
+		if err != nil {
+			return count, &storageErrors.ScanningPSQLError{Err: err}
+		}
+		if err = fn(sURL); err != nil {
+			return count, err
+		}
+		count++
+	}
+	err = rows.Err()
+	if err != nil {
+		return count, &storageErrors.ScanningPSQLError{Err: err}
+	}
+	return count, nil
+}
+
+// ScanEntries passes all entries whatever their state to fn along with their deletion flag, rows are streamed rather
+// than read at once by a single query and therefore form a consistent snapshot however long the scan takes. fn is
+// called synchronously and the first error it returns stops the scan.
+func (s *Storage) ScanEntries(ctx context.Context, fn func(entry modelstorage.URLStorageEntry, deleted bool) error) error {
+	count, err := s.scanEntries(ctx, fn)
+	if err != nil {
+		if ctx.Err() != nil {
+			s.logger(ctx).Warn("Scanning entries", logger.Error(ctx.Err()))
+			return &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
+		}
+		s.logger(ctx).Warn("Scanning entries", logger.Error(err))
+		return err
+	}
+	s.logger(ctx).Debug("Scanning entries", logger.Int("count", count))
+	return nil
+}
+
+// scanEntries implements ScanEntries and returns the number of passed entries.
+func (s *Storage) scanEntries(ctx context.Context, fn func(entry modelstorage.URLStorageEntry, deleted bool) error) (count int, err error) {
+	rows, err := s.DB.QueryContext(ctx, selectEntriesQuery)
+	if err != nil {
+		return 0, &storageErrors.ExecutionPSQLError{Err: err}
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var row modelstorage.URLPostgresEntry
+		var createdAt time.Time
+		err = rows.Scan(&row.UserID, &row.URL, &row.SURL, &row.IsDeleted, &createdAt, &row.ExpiresAt, &row.RedirectType, &row.DisabledAt, &row.Title, &row.FaviconURL, &row.PasswordHash, &row.MaxClicks, &row.ClickCount, &row.ActiveFrom, &row.Destinations, &row.Sticky, &row.GeoTargets, &row.DeviceTargets, &row.Domain, &row.OrgID, &row.UTM, pq.Array(&row.Tags), &row.LastAccessedAt, &row.ArchivedAt)
+		if err != nil {
+			return count, &storageErrors.ScanningPSQLError{Err: err}
+		}
+		entry := modelstorage.URLStorageEntry{
+			SURL:         row.SURL,
+			URL:          row.URL,
+			UserID:       row.UserID,
+			RedirectType: row.RedirectType,
+			CreatedAt:    &createdAt,
+			Title:        row.Title.String,
+			FaviconURL:   row.FaviconURL.String,
+			PasswordHash: row.PasswordHash.String,
+			MaxClicks:    row.MaxClicks,
+			ClickCount:   row.ClickCount,
+			Sticky:       row.Sticky,
+			Domain:       row.Domain.String,
+			OrgID:        row.OrgID.String,
+			Tags:         row.Tags,
+		}
+		if row.ExpiresAt.Valid {
+			entry.ExpiresAt = &row.ExpiresAt.Time
+		}
+		if row.DisabledAt.Valid {
+			entry.DisabledAt = &row.DisabledAt.Time
+		}
+		if row.ActiveFrom.Valid {
+			entry.ActiveFrom = &row.ActiveFrom.Time
+		}
+		if row.LastAccessedAt.Valid {
+			entry.LastAccessedAt = &row.LastAccessedAt.Time
+		}
+		if row.ArchivedAt.Valid {
+			entry.ArchivedAt = &row.ArchivedAt.Time
+		}
+		for _, field := range []struct {
+			column sql.NullString
+			value  interface{}
+		}{
+			{row.Destinations, &entry.Destinations},
+			{row.GeoTargets, &entry.GeoTargets},
+			{row.DeviceTargets, &entry.DeviceTargets},
+			{row.UTM, &entry.UTM},
+		} {
+			if field.column.Valid {
+				err = json.Unmarshal([]byte(field.column.String), field.value)
+				if err != nil {
+					return count, &storageErrors.ScanningPSQLError{Err: err}
+				}
+			}
+		}
+		if err = fn(entry, row.IsDeleted); err != nil {
+			return count, err
+		}
+		count++
+	}
+	err = rows.Err()
+	if err != nil {
+		return count, &storageErrors.ScanningPSQLError{Err: err}
+	}
+	return count, nil
+}
+
+// exportByUserID implements ExportByUserID and returns the number of exported URLs.
+func (s *Storage) exportByUserID(ctx context.Context, userID string, fn func(URL modelurl.FullURL) error) (count int, err error) {
+	return s.exportCursor(ctx, declareExportCursorQuery, fn, userID)
+}
+
+// exportCursor declares the export cursor with declareQuery and args, passes every URL it selects to fn and returns
+// the number of passed URLs.
+func (s *Storage) exportCursor(ctx context.Context, declareQuery string, fn func(URL modelurl.FullURL) error, args ...interface{}) (count int, err error) {
+	// a cursor lives until the end of its transaction
+	tx, err := s.DB.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return 0, &storageErrors.ExecutionPSQLError{Err: err}
+	}
+	defer tx.Rollback()
+	_, err = tx.ExecContext(ctx, declareQuery, args...)
+	if err != nil {
+		return 0, &storageErrors.ExecutionPSQLError{Err: err}
+	}
+	for {
+		page, err := fetchExportPage(ctx, tx)
+		if err != nil {
+			return count, err
+		}
+		if len(page) == 0 {
+			break
+		}
+		for _, URL := range page {
+			if err = fn(URL); err != nil {
+				return count, err
+			}
+			count++
+		}
+	}
+	err = tx.Commit()
+	if err != nil {
+		return count, &storageErrors.ExecutionPSQLError{Err: err}
+	}
+	return count, nil
+}
+
+// fetchExportPage reads the next page of the export cursor, it is empty once the cursor is exhausted.
+func fetchExportPage(ctx context.Context, tx *sql.Tx) ([]modelurl.FullURL, error) {
+	rows, err := tx.QueryContext(ctx, fetchExportCursorQuery)
+	if err != nil {
+		return nil, &storageErrors.ExecutionPSQLError{Err: err}
+	}
+	defer rows.Close()
+	var page []modelurl.FullURL
+	for rows.Next() {
+		var URL modelurl.FullURL
+		err = rows.Scan(&URL.URL, &URL.SURL, &URL.Domain)
+		if err != nil {
+			return nil, &storageErrors.ScanningPSQLError{Err: err}
+		}
+		page = append(page, URL)
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, &storageErrors.ScanningPSQLError{Err: err}
+	}
+	return page, nil
+}
+
+// Dump stores a pair of sURL and URL as a key-value pair in DB.
+func (s *Storage) Dump(ctx context.Context, entry modelstorage.URLStorageEntry) error {
+	// create channels for listening to the go routine result
+	dumpDone := make(chan bool, 1)
+	dumpError := make(chan error, 1)
+	go func() {
+		var expiresAt sql.NullTime
+		if entry.ExpiresAt != nil {
+			expiresAt = sql.NullTime{Time: *entry.ExpiresAt, Valid: true}
+		}
+		var activeFrom sql.NullTime
+		if entry.ActiveFrom != nil {
+			activeFrom = sql.NullTime{Time: *entry.ActiveFrom, Valid: true}
+		}
+		passwordHash := sql.NullString{String: entry.PasswordHash, Valid: entry.PasswordHash != ""}
+		var destinations sql.NullString
+		if len(entry.Destinations) > 0 {
+			encoded, err := json.Marshal(entry.Destinations)
+			if err != nil {
+				dumpError <- err
+				return
+			}
+			destinations = sql.NullString{String: string(encoded), Valid: true}
+		}
+		var geoTargets sql.NullString
+		if len(entry.GeoTargets) > 0 {
+			encoded, err := json.Marshal(entry.GeoTargets)
+			if err != nil {
+				dumpError <- err
+				return
+			}
+			geoTargets = sql.NullString{String: string(encoded), Valid: true}
+		}
+		var deviceTargets sql.NullString
+		if len(entry.DeviceTargets) > 0 {
+			encoded, err := json.Marshal(entry.DeviceTargets)
+			if err != nil {
+				dumpError <- err
+				return
+			}
+			deviceTargets = sql.NullString{String: string(encoded), Valid: true}
+		}
+		var utm sql.NullString
+		if len(entry.UTM) > 0 {
+			encoded, err := json.Marshal(entry.UTM)
+			if err != nil {
+				dumpError <- err
+				return
+			}
+			utm = sql.NullString{String: string(encoded), Valid: true}
+		}
+		domain := sql.NullString{String: entry.Domain, Valid: entry.Domain != ""}
+		orgID := sql.NullString{String: entry.OrgID, Valid: entry.OrgID != ""}
+		_, err := s.stmts.insertURL.ExecContext(ctx, entry.UserID, entry.URL, entry.SURL, expiresAt, entry.RedirectType, passwordHash, entry.MaxClicks, activeFrom, destinations, entry.Sticky, geoTargets, deviceTargets, domain, orgID, utm, pq.Array(entry.Tags))
+		if err != nil {
+			if err, ok := err.(*pgconn.PgError); ok && err.Code == pgerrcode.UniqueViolation && err.ConstraintName == shortURLConstraint {
+				dumpError <- &storageErrors.SURLAlreadyExistsError{Err: err, SURL: entry.SURL}
+				return
+			}
+			if err, ok := err.(*pgconn.PgError); ok && err.Code == pgerrcode.UniqueViolation {
+				// retrieve already existing sURL for violating unique constraint URL
+				var validsURL string
+				err := s.stmts.selectSURLByURL.QueryRowContext(ctx, entry.URL).Scan(&validsURL)
+				if err != nil {
+					dumpError <- &storageErrors.ExecutionPSQLError{Err: err}
+					return
+				}
+				dumpError <- &storageErrors.AlreadyExistsError{Err: err, URL: entry.URL, ValidSURL: validsURL}
+				return
+			}
+			dumpError <- &storageErrors.ExecutionPSQLError{Err: err}
+			return
+		}
+		dumpDone <- true
+	}()
+
+	// wait for the first channel to retrieve a value
+	select {
+	case <-ctx.Done():
+		s.logger(ctx).Warn("Dumping URL", logger.Error(ctx.Err()))
+		return &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
+	case dmpError := <-dumpError:
+		s.logger(ctx).Warn("Dumping URL", logger.Error(dmpError))
+		return dmpError
+	case <-dumpDone:
+		s.logger(ctx).Debug("Dumping URL", logger.String("sURL", entry.SURL), logger.String("url", entry.URL))
+		return nil
+	}
+}
+
+// UpdateMetadata sets the destination page title and favicon URL of sURL.
+func (s *Storage) UpdateMetadata(ctx context.Context, sURL, title, faviconURL string) error {
+	// create channels for listening to the go routine result
+	updateDone := make(chan bool, 1)
+	updateError := make(chan error, 1)
+	go func() {
+		res, err := s.stmts.updateMetadata.ExecContext(ctx, sURL, title, faviconURL)
+		if err != nil {
+			updateError <- &storageErrors.ExecutionPSQLError{Err: err}
+			return
+		}
+		affected, err := res.RowsAffected()
+		if err != nil {
+			updateError <- &storageErrors.ExecutionPSQLError{Err: err}
+			return
+		}
+		if affected == 0 {
+			updateError <- &storageErrors.NotFoundError{Err: nil, SURL: sURL}
+			return
+		}
+		updateDone <- true
+	}()
+
+	// wait for the first channel to retrieve a value
+	select {
+	case <-ctx.Done():
+		s.logger(ctx).Warn("Updating URL metadata", logger.Error(ctx.Err()))
+		return &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
+	case updError := <-updateError:
+		s.logger(ctx).Warn("Updating URL metadata", logger.Error(updError))
+		return updError
+	case <-updateDone:
+		s.logger(ctx).Debug("Updating URL metadata", logger.String("sURL", sURL))
+		return nil
+	}
+}
+
+// UpdateURL changes the destination of a live DB entry of sURL owned by userID to URL, records the edit and returns
+// the former destination. Entries of other users are reported missing, the edited entry is removed from the cache.
+func (s *Storage) UpdateURL(ctx context.Context, sURL, userID, URL string) (previous string, err error) {
+	// create channels for listening to the go routine result
+	updateDone := make(chan string, 1)
+	updateError := make(chan error, 1)
+	go func() {
+		var previous string
+		err := s.stmts.updateURL.QueryRowContext(ctx, sURL, userID, URL).Scan(&previous)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				updateError <- &storageErrors.NotFoundError{Err: nil, SURL: sURL}
+				return
+			}
+			if err, ok := err.(*pgconn.PgError); ok && err.Code == pgerrcode.UniqueViolation {
+				// retrieve already existing sURL for violating unique constraint URL
+				var validsURL string
+				err := s.stmts.selectSURLByURL.QueryRowContext(ctx, URL).Scan(&validsURL)
+				if err != nil {
+					updateError <- &storageErrors.ExecutionPSQLError{Err: err}
+					return
+				}
+				updateError <- &storageErrors.AlreadyExistsError{Err: err, URL: URL, ValidSURL: validsURL}
+				return
+			}
+			updateError <- &storageErrors.ExecutionPSQLError{Err: err}
+			return
+		}
+		s.cache.Remove(sURL)
+		updateDone <- previous
+	}()
+
+	// wait for the first channel to retrieve a value
+	select {
+	case <-ctx.Done():
+		s.logger(ctx).Warn("Updating URL", logger.Error(ctx.Err()))
+		return "", &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
+	case updError := <-updateError:
+		s.logger(ctx).Warn("Updating URL", logger.Error(updError))
+		return "", updError
+	case previous := <-updateDone:
+		s.logger(ctx).Debug("Updating URL", logger.String("sURL", sURL), logger.String("url", URL))
+		return previous, nil
+	}
+}
+
+// SetTags replaces tags of a live DB entry of sURL owned by userID with tags within one transaction, entries of other
+// users are reported missing.
+func (s *Storage) SetTags(ctx context.Context, sURL, userID string, tags []string) error {
+	// create channels for listening to the go routine result
+	setDone := make(chan bool, 1)
+	setError := make(chan error, 1)
+	go func() {
+		tx, err := s.DB.BeginTx(ctx, nil)
+		if err != nil {
+			setError <- &storageErrors.ExecutionPSQLError{Err: err}
+			return
+		}
+		defer tx.Rollback()
+		var owned int
+		err = tx.QueryRowContext(ctx, lockOwnedURLQuery, sURL, userID).Scan(&owned)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				setError <- &storageErrors.NotFoundError{Err: nil, SURL: sURL}
+				return
+			}
+			setError <- &storageErrors.ExecutionPSQLError{Err: err}
+			return
+		}
+		_, err = tx.ExecContext(ctx, deleteTagsQuery, sURL)
+		if err != nil {
+			setError <- &storageErrors.ExecutionPSQLError{Err: err}
+			return
+		}
+		_, err = tx.ExecContext(ctx, insertTagsQuery, sURL, userID, pq.Array(tags))
+		if err != nil {
+			setError <- &storageErrors.ExecutionPSQLError{Err: err}
+			return
+		}
+		err = tx.Commit()
+		if err != nil {
+			setError <- &storageErrors.ExecutionPSQLError{Err: err}
+			return
+		}
+		setDone <- true
+	}()
+
+	// wait for the first channel to retrieve a value
+	select {
+	case <-ctx.Done():
+		s.logger(ctx).Warn("Setting URL tags", logger.Error(ctx.Err()))
+		return &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
+	case stError := <-setError:
+		s.logger(ctx).Warn("Setting URL tags", logger.Error(stError))
+		return stError
+	case <-setDone:
+		s.logger(ctx).Debug("Setting URL tags", logger.String("sURL", sURL), logger.Any("tags", tags))
+		return nil
+	}
+}
+
+// RenameTag renames tag of all links of userID to name within one transaction, links already tagged with name keep
+// one tag. TagNotFoundError is reported if no link is tagged with tag.
+func (s *Storage) RenameTag(ctx context.Context, userID, tag, name string) error {
+	// create channels for listening to the go routine result
+	renameDone := make(chan bool, 1)
+	renameError := make(chan error, 1)
+	go func() {
+		tx, err := s.DB.BeginTx(ctx, nil)
+		if err != nil {
+			renameError <- &storageErrors.ExecutionPSQLError{Err: err}
+			return
+		}
+		defer tx.Rollback()
+		merged, err := tx.ExecContext(ctx, mergeTagQuery, userID, tag, name)
+		if err != nil {
+			renameError <- &storageErrors.ExecutionPSQLError{Err: err}
+			return
+		}
+		renamed, err := tx.ExecContext(ctx, renameTagQuery, userID, tag, name)
+		if err != nil {
+			renameError <- &storageErrors.ExecutionPSQLError{Err: err}
+			return
+		}
+		mergedCount, err := merged.RowsAffected()
+		if err != nil {
+			renameError <- &storageErrors.ExecutionPSQLError{Err: err}
+			return
+		}
+		renamedCount, err := renamed.RowsAffected()
+		if err != nil {
+			renameError <- &storageErrors.ExecutionPSQLError{Err: err}
+			return
+		}
+		if mergedCount+renamedCount == 0 {
+			renameError <- &storageErrors.TagNotFoundError{Err: nil, Tag: tag}
+			return
+		}
+		err = tx.Commit()
+		if err != nil {
+			renameError <- &storageErrors.ExecutionPSQLError{Err: err}
+			return
+		}
+		renameDone <- true
+	}()
+
+	// wait for the first channel to retrieve a value
+	select {
+	case <-ctx.Done():
+		s.logger(ctx).Warn("Renaming tag", logger.Error(ctx.Err()))
+		return &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
+	case rnmError := <-renameError:
+		s.logger(ctx).Warn("Renaming tag", logger.Error(rnmError))
+		return rnmError
+	case <-renameDone:
+		s.logger(ctx).Debug("Renaming tag", logger.String("userID", userID), logger.String("tag", tag), logger.String("name", name))
+		return nil
+	}
+}
+
+// RetrieveTags returns tags of live DB entries of userID along with the number of entries tagged with each of them
+// sorted by name.
+func (s *Storage) RetrieveTags(ctx context.Context, userID string) (tags []modelurl.Tag, err error) {
+	// create channels for listening to the go routine result
+	retrieveDone := make(chan []modelurl.Tag, 1)
+	retrieveError := make(chan error, 1)
+	go func() {
+		rows, err := s.stmts.selectTags.QueryContext(ctx, userID)
+		if err != nil {
+			retrieveError <- &storageErrors.ExecutionPSQLError{Err: err}
+			return
+		}
+		defer rows.Close()
+		var tags []modelurl.Tag
+		for rows.Next() {
+			var tag modelurl.Tag
+			if err = rows.Scan(&tag.Name, &tag.Count); err != nil {
+				retrieveError <- &storageErrors.ScanningPSQLError{Err: err}
+				return
+			}
+			tags = append(tags, tag)
+		}
+		if err = rows.Err(); err != nil {
+			retrieveError <- &storageErrors.ScanningPSQLError{Err: err}
+			return
+		}
+		retrieveDone <- tags
+	}()
+
+	// wait for the first channel to retrieve a value
+	select {
+	case <-ctx.Done():
+		s.logger(ctx).Warn("Retrieving tags", logger.Error(ctx.Err()))
+		return nil, &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
+	case rtrvError := <-retrieveError:
+		s.logger(ctx).Warn("Retrieving tags", logger.Error(rtrvError))
+		return nil, rtrvError
+	case tags := <-retrieveDone:
+		s.logger(ctx).Debug("Retrieving tags", logger.String("userID", userID), logger.Int("count", len(tags)))
+		return tags, nil
+	}
+}
+
+// TakeClick counts a redirect of sURL limited to a number of clicks and reports ExhaustedError once the limit is
+// reached, entries missing by now are reported exhausted as well. Redirects of links without a limit are not counted.
+// The updated row is locked, so that concurrent redirects are counted one after another and never exceed the limit.
+func (s *Storage) TakeClick(ctx context.Context, sURL string) error {
+	// create channels for listening to the go routine result
+	takeDone := make(chan bool, 1)
+	takeError := make(chan error, 1)
+	go func() {
+		res, err := s.stmts.takeClick.ExecContext(ctx, sURL)
+		if err != nil {
+			takeError <- &storageErrors.ExecutionPSQLError{Err: err}
+			return
+		}
+		affected, err := res.RowsAffected()
+		if err != nil {
+			takeError <- &storageErrors.ExecutionPSQLError{Err: err}
+			return
+		}
+		if affected == 0 {
+			takeError <- &storageErrors.ExhaustedError{Err: nil, SURL: sURL}
+			return
+		}
+		takeDone <- true
+	}()
+
+	// wait for the first channel to retrieve a value
+	select {
+	case <-ctx.Done():
+		s.logger(ctx).Warn("Taking URL click", logger.Error(ctx.Err()))
+		return &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
+	case tkError := <-takeError:
+		s.logger(ctx).Warn("Taking URL click", logger.Error(tkError))
+		return tkError
+	case <-takeDone:
+		s.logger(ctx).Debug("Taking URL click", logger.String("sURL", sURL))
+		return nil
+	}
+}
+
+// DumpBatch stores a batch of sURL:URL pairs in DB within one transaction, entries whose URL already exists in DB
+// are returned with the existing sURL. Batches of more than Cfg.CopyThreshold entries are streamed with COPY.
+func (s *Storage) DumpBatch(ctx context.Context, entries []modelstorage.URLStorageEntry) ([]modelstorage.URLStorageEntry, error) {
+	// create channels for listening to the go routine result
+	dumpDone := make(chan []modelstorage.URLStorageEntry, 1)
+	dumpError := make(chan error, 1)
+	go func() {
+		if len(entries) > s.Cfg.CopyThreshold {
+			stored, err := s.copyDumpBatch(ctx, entries)
+			if err != nil {
+				dumpError <- err
+				return
+			}
+			dumpDone <- stored
+			return
+		}
+		// begin transaction
+		tx, err := s.DB.BeginTx(ctx, nil)
+		if err != nil {
+			dumpError <- &storageErrors.ExecutionPSQLError{Err: err}
+			return
+		}
+		defer tx.Rollback()
+		// bind prepared statements to the transaction, INSERT skips URLs violating unique constraint
+		dumpStmt := tx.StmtContext(ctx, s.stmts.insertURLBatch)
+		defer dumpStmt.Close()
+		selectStmt := tx.StmtContext(ctx, s.stmts.selectSURLByURL)
+		defer selectStmt.Close()
+		stored := make([]modelstorage.URLStorageEntry, 0, len(entries))
+		for _, entry := range entries {
+			res, err := dumpStmt.ExecContext(ctx, entry.UserID, entry.URL, entry.SURL)
+			if err != nil {
+				if err, ok := err.(*pgconn.PgError); ok && err.Code == pgerrcode.UniqueViolation && err.ConstraintName == shortURLConstraint {
+					dumpError <- &storageErrors.SURLAlreadyExistsError{Err: err, SURL: entry.SURL}
+					return
+				}
+				dumpError <- &storageErrors.ExecutionPSQLError{Err: err}
+				return
+			}
+			affected, err := res.RowsAffected()
+			if err != nil {
+				dumpError <- &storageErrors.ExecutionPSQLError{Err: err}
+				return
+			}
+			if affected == 0 {
+				// retrieve already existing sURL for violating unique constraint URL
+				err = selectStmt.QueryRowContext(ctx, entry.URL).Scan(&entry.SURL)
+				if err != nil {
+					dumpError <- &storageErrors.ExecutionPSQLError{Err: err}
+					return
+				}
+			}
+			stored = append(stored, entry)
+		}
+		err = tx.Commit()
+		if err != nil {
+			dumpError <- &storageErrors.ExecutionPSQLError{Err: err}
+			return
+		}
+		dumpDone <- stored
+	}()
+
+	// wait for the first channel to retrieve a value
+	select {
+	case <-ctx.Done():
+		s.logger(ctx).Warn("Dumping URL batch", logger.Error(ctx.Err()))
+		return nil, &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
+	case dmpError := <-dumpError:
+		s.logger(ctx).Warn("Dumping URL batch", logger.Error(dmpError))
+		return nil, dmpError
+	case stored := <-dumpDone:
+		s.logger(ctx).Debug("Dumping URL batch", logger.Int("count", len(stored)))
+		return stored, nil
+	}
+}
+
+// ImportBatch stores a batch of imported URL entries within one transaction: entries are streamed with COPY into a
+// temporary table and moved into urls by a single INSERT skipping conflicting rows. Entries whose URL already exists
+// in DB are returned with the existing sURL, entries whose sURL is taken are skipped and reported.
+func (s *Storage) ImportBatch(ctx context.Context, entries []modelstorage.URLStorageEntry) ([]modelstorage.ImportResult, error) {
+	// create channels for listening to the go routine result
+	importDone := make(chan []modelstorage.ImportResult, 1)
+	importError := make(chan error, 1)
+	go func() {
+		results, err := s.copyBatch(ctx, entries, false)
+		if err != nil {
+			importError <- &storageErrors.ExecutionPSQLError{Err: err}
+			return
+		}
+		importDone <- results
+	}()
+
+	// wait for the first channel to retrieve a value
+	select {
+	case <-ctx.Done():
+		s.logger(ctx).Warn("Importing URL batch", logger.Error(ctx.Err()))
+		return nil, &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
+	case imprtError := <-importError:
+		s.logger(ctx).Warn("Importing URL batch", logger.Error(imprtError))
+		return nil, imprtError
+	case results := <-importDone:
+		s.logger(ctx).Debug("Importing URL batch", logger.Int("count", len(results)))
+		return results, nil
+	}
+}
+
+// copyDumpBatch runs DumpBatch for large batches with COPY, nothing is stored when any sURL of the batch is taken.
+func (s *Storage) copyDumpBatch(ctx context.Context, entries []modelstorage.URLStorageEntry) ([]modelstorage.URLStorageEntry, error) {
+	results, err := s.copyBatch(ctx, entries, true)
+	if err != nil {
+		return nil, &storageErrors.ExecutionPSQLError{Err: err}
+	}
+	stored := make([]modelstorage.URLStorageEntry, 0, len(results))
+	var taken []string
+	for _, result := range results {
+		if result.Status == modelstorage.ImportSURLTaken {
+			taken = append(taken, result.Entry.SURL)
+			continue
+		}
+		stored = append(stored, result.Entry)
+	}
+	if len(taken) > 0 {
+		s.logger(ctx).Debug("Dumping URL batch: short URLs are taken", logger.Any("sURLs", taken))
+		return nil, &storageErrors.SURLAlreadyExistsError{Err: nil, SURL: taken[0]}
+	}
+	return stored, nil
+}
+
+// copyBatch stores entries within one transaction on a dedicated connection since COPY is not supported by
+// database/sql, and reports the outcome of every entry. With allOrNothing set the transaction is rolled back when any
+// sURL is taken.
+func (s *Storage) copyBatch(ctx context.Context, entries []modelstorage.URLStorageEntry, allOrNothing bool) ([]modelstorage.ImportResult, error) {
+	conn, err := s.DB.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	var results []modelstorage.ImportResult
+	err = conn.Raw(func(driverConn interface{}) error {
+		tx, err := driverConn.(*stdlib.Conn).Conn().Begin(ctx)
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback(ctx)
+		_, err = tx.Exec(ctx, createImportTableQuery)
+		if err != nil {
+			return err
+		}
+		rows := make([][]interface{}, 0, len(entries))
+		for i, entry := range entries {
+			rows = append(rows, []interface{}{i, entry.UserID, entry.URL, entry.SURL, entry.ExpiresAt, entry.RedirectType})
+		}
+		_, err = tx.CopyFrom(ctx, pgx.Identifier{"urls_import"}, importColumns, pgx.CopyFromRows(rows))
+		if err != nil {
+			return err
+		}
+		// collect inserted URL:sURL pairs, the first of duplicate rows wins since rows are inserted in order
+		inserted := make(map[[2]string]bool, len(entries))
+		insertedRows, err := tx.Query(ctx, insertImportedQuery)
+		if err != nil {
+			return err
+		}
+		for insertedRows.Next() {
+			var URL, sURL string
+			err = insertedRows.Scan(&URL, &sURL)
+			if err != nil {
+				insertedRows.Close()
+				return err
+			}
+			inserted[[2]string{URL, sURL}] = true
+		}
+		insertedRows.Close()
+		if insertedRows.Err() != nil {
+			return insertedRows.Err()
+		}
+		// retrieve sURLs of all imported URLs to tell existing URLs from taken sURLs among skipped rows
+		URLs := make([]string, 0, len(entries))
+		for _, entry := range entries {
+			URLs = append(URLs, entry.URL)
+		}
+		existing := make(map[string]string, len(entries))
+		existingRows, err := tx.Query(ctx, selectSURLsByURLsQuery, URLs)
+		if err != nil {
+			return err
+		}
+		for existingRows.Next() {
+			var URL, sURL string
+			err = existingRows.Scan(&URL, &sURL)
+			if err != nil {
+				existingRows.Close()
+				return err
+			}
+			existing[URL] = sURL
+		}
+		existingRows.Close()
+		if existingRows.Err() != nil {
+			return existingRows.Err()
+		}
+		results = make([]modelstorage.ImportResult, 0, len(entries))
+		rollback := false
+		for _, entry := range entries {
+			key := [2]string{entry.URL, entry.SURL}
+			switch sURL, ok := existing[entry.URL]; {
+			case inserted[key]:
+				delete(inserted, key)
+				results = append(results, modelstorage.ImportResult{Entry: entry, Status: modelstorage.ImportCreated})
+			case ok:
+				entry.SURL = sURL
+				results = append(results, modelstorage.ImportResult{Entry: entry, Status: modelstorage.ImportURLExists})
+			default:
+				results = append(results, modelstorage.ImportResult{Entry: entry, Status: modelstorage.ImportSURLTaken})
+				rollback = allOrNothing
+			}
+		}
+		if rollback {
+			return nil
+		}
+		return tx.Commit(ctx)
+	})
+	return results, err
+}
+
+// DeleteBatch assigns a deletion flag for DB entries and records audit records of them, does not use task management.
+func (s *Storage) DeleteBatch(ctx context.Context, sURLs []string, userID string) error {
+	//begin transaction
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return &storageErrors.ExecutionPSQLError{Err: err}
+	}
+	defer tx.Rollback()
+	txDeleteStmt := tx.StmtContext(ctx, s.stmts.deleteBatch)
+	// create channels for listening to the go routine result
+	deleteDone := make(chan []modelstorage.URLStorageEntry, 1)
+	deleteError := make(chan error, 1)
+	go func() {
+		rows, err := txDeleteStmt.QueryContext(
+			ctx,
+			userID,
+			pq.Array(sURLs),
+		)
+		if err != nil {
+			deleteError <- &storageErrors.ExecutionPSQLError{Err: err}
+			return
+		}
+		defer rows.Close()
+		// collect entries which were actually deleted for lifecycle events
+		var deleted []modelstorage.URLStorageEntry
+		for rows.Next() {
+			entry := modelstorage.URLStorageEntry{UserID: userID}
+			if err = rows.Scan(&entry.SURL, &entry.URL); err != nil {
+				deleteError <- &storageErrors.ScanningPSQLError{Err: err}
+				return
+			}
+			deleted = append(deleted, entry)
+		}
+		if err = rows.Err(); err != nil {
+			deleteError <- &storageErrors.ScanningPSQLError{Err: err}
+			return
+		}
+		rows.Close()
+		// deletions are no longer pending once committed, whether the entries were live or not
+		_, err = tx.StmtContext(ctx, s.stmts.deletePending).ExecContext(ctx, userID, pq.Array(sURLs))
+		if err != nil {
+			deleteError <- &storageErrors.ExecutionPSQLError{Err: err}
+			return
+		}
+		// deletions are audited within the same transaction since they are not known to the service
+		txAuditStmt := tx.StmtContext(ctx, s.stmts.insertAudit)
+		for _, entry := range deleted {
+			after := modelstorage.AuditURL(entry)
+			after.Deleted = true
+			audit, err := modelstorage.NewAuditEntry(userID, modelurl.AuditDelete, modelurl.AuditEntityURL, entry.SURL, modelstorage.AuditURL(entry), after)
+			if err != nil {
+				deleteError <- &storageErrors.ExecutionPSQLError{Err: err}
+				return
+			}
+			_, err = txAuditStmt.ExecContext(ctx, audit.ID, audit.Actor, audit.Action, audit.Entity, audit.EntityID, string(audit.Before), string(audit.After), audit.CreatedAt)
+			if err != nil {
+				deleteError <- &storageErrors.ExecutionPSQLError{Err: err}
+				return
+			}
+		}
+		deleteDone <- deleted
+	}()
+
+	// wait for the first channel to retrieve a value
+	select {
+	case <-ctx.Done():
+		s.logger(ctx).Warn("Deleting URL", logger.Error(ctx.Err()))
+		return &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
+	case dltError := <-deleteError:
+		s.logger(ctx).Warn("Deleting URL", logger.Error(dltError))
+		return dltError
+	case deleted := <-deleteDone:
+		s.logger(ctx).Debug("Deleting URL", logger.String("userID", userID), logger.Any("sURLs", sURLs))
+		err = tx.Commit()
+		if err != nil {
+			return err
+		}
+		s.cache.Remove(sURLs...)
+		for _, entry := range deleted {
+			s.Emit(modelurl.EventURLDeleted, entry)
+		}
+		return nil
+	}
+}
+
+// RestoreBatch removes the deletion flag from DB entries of sURLs owned by userID and returns sURLs which were
+// actually restored; only live entries are cached, so the cache needs no invalidation.
+func (s *Storage) RestoreBatch(ctx context.Context, sURLs []string, userID string) (restored []string, err error) {
+	// create channels for listening to the go routine result
+	restoreDone := make(chan []string, 1)
+	restoreError := make(chan error, 1)
+	go func() {
+		rows, err := s.stmts.restoreBatch.QueryContext(ctx, userID, pq.Array(sURLs))
+		if err != nil {
+			restoreError <- &storageErrors.ExecutionPSQLError{Err: err}
+			return
+		}
+		defer rows.Close()
+		var restored []string
+		for rows.Next() {
+			var sURL string
+			if err = rows.Scan(&sURL); err != nil {
+				restoreError <- &storageErrors.ScanningPSQLError{Err: err}
+				return
+			}
+			restored = append(restored, sURL)
+		}
+		if err = rows.Err(); err != nil {
+			restoreError <- &storageErrors.ScanningPSQLError{Err: err}
+			return
+		}
+		restoreDone <- restored
+	}()
+
+	// wait for the first channel to retrieve a value
+	select {
+	case <-ctx.Done():
+		s.logger(ctx).Warn("Restoring URL", logger.Error(ctx.Err()))
+		return nil, &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
+	case rstrError := <-restoreError:
+		s.logger(ctx).Warn("Restoring URL", logger.Error(rstrError))
+		return nil, rstrError
+	case restored := <-restoreDone:
+		s.logger(ctx).Debug("Restoring URL", logger.String("userID", userID), logger.Any("sURLs", restored))
+		return restored, nil
+	}
+}
+
+// DisableBatch marks DB entries of sURLs disabled and returns sURLs which were not disabled before, disabled entries
+// are removed from the cache.
+func (s *Storage) DisableBatch(ctx context.Context, sURLs []string) (disabled []string, err error) {
+	// create channels for listening to the go routine result
+	disableDone := make(chan []modelstorage.URLStorageEntry, 1)
+	disableError := make(chan error, 1)
+	go func() {
+		rows, err := s.stmts.disableBatch.QueryContext(ctx, pq.Array(sURLs))
+		if err != nil {
+			disableError <- &storageErrors.ExecutionPSQLError{Err: err}
+			return
+		}
+		defer rows.Close()
+		var entries []modelstorage.URLStorageEntry
+		for rows.Next() {
+			var entry modelstorage.URLStorageEntry
+			if err = rows.Scan(&entry.SURL, &entry.URL, &entry.UserID); err != nil {
+				disableError <- &storageErrors.ScanningPSQLError{Err: err}
+				return
+			}
+			entries = append(entries, entry)
+		}
+		if err = rows.Err(); err != nil {
+			disableError <- &storageErrors.ScanningPSQLError{Err: err}
+			return
+		}
+		for _, entry := range entries {
+			s.cache.Remove(entry.SURL)
+		}
+		disableDone <- entries
+	}()
+
+	// wait for the first channel to retrieve a value
+	select {
+	case <-ctx.Done():
+		s.logger(ctx).Warn("Disabling URL", logger.Error(ctx.Err()))
+		return nil, &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
+	case dsblError := <-disableError:
+		s.logger(ctx).Warn("Disabling URL", logger.Error(dsblError))
+		return nil, dsblError
+	case entries := <-disableDone:
+		for _, entry := range entries {
+			disabled = append(disabled, entry.SURL)
+		}
+		for _, entry := range entries {
+			s.Emit(modelurl.EventURLDisabled, entry)
+		}
+		s.logger(ctx).Debug("Disabling URL", logger.Any("sURLs", disabled))
+		return disabled, nil
+	}
+}
+
+// RetrieveStats returns total, per-day and per-destination redirect counts for sURL, redirects of bots are only
+// counted with includeBots.
+func (s *Storage) RetrieveStats(ctx context.Context, sURL string, includeBots bool) (stats modelurl.URLStats, err error) {
+	// create channels for listening to the go routine result
+	retrieveDone := make(chan modelurl.URLStats, 1)
+	retrieveError := make(chan error, 1)
+	go func() {
+		var exists bool
+		err := s.stmts.existsSURL.QueryRowContext(ctx, sURL).Scan(&exists)
+		if err != nil {
+			retrieveError <- &storageErrors.ExecutionPSQLError{Err: err}
+			return
+		}
+		if !exists {
+			retrieveError <- &storageErrors.NotFoundError{Err: nil, SURL: sURL}
+			return
+		}
+		rows, err := s.stmts.selectDailyClicks.QueryContext(ctx, sURL, includeBots)
+		if err != nil {
+			retrieveError <- &storageErrors.ExecutionPSQLError{Err: err}
+			return
+		}
+		defer rows.Close()
+		stats := modelurl.URLStats{SURL: sURL}
+		for rows.Next() {
+			var daily modelurl.DailyClicks
+			err = rows.Scan(&daily.Date, &daily.Clicks)
+			if err != nil {
+				retrieveError <- &storageErrors.ScanningPSQLError{Err: err}
+				return
+			}
+			stats.TotalClicks += daily.Clicks
+			stats.ClicksPerDay = append(stats.ClicksPerDay, daily)
+		}
+		err = rows.Err()
+		if err != nil {
+			retrieveError <- &storageErrors.ScanningPSQLError{Err: err}
+			return
+		}
+		rows, err = s.stmts.selectServedClicks.QueryContext(ctx, sURL, includeBots)
+		if err != nil {
+			retrieveError <- &storageErrors.ExecutionPSQLError{Err: err}
+			return
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var served modelurl.DestinationClicks
+			err = rows.Scan(&served.URL, &served.Clicks)
+			if err != nil {
+				retrieveError <- &storageErrors.ScanningPSQLError{Err: err}
+				return
+			}
+			stats.ClicksPerDestination = append(stats.ClicksPerDestination, served)
+		}
+		err = rows.Err()
+		if err != nil {
+			retrieveError <- &storageErrors.ScanningPSQLError{Err: err}
+			return
+		}
+		rows, err = s.stmts.selectVisitors.QueryContext(ctx, sURL)
+		if err != nil {
+			retrieveError <- &storageErrors.ExecutionPSQLError{Err: err}
+			return
+		}
+		defer rows.Close()
+		visitors := make(map[string]int)
+		total := hll.New()
+		for rows.Next() {
+			var day string
+			var stored []byte
+			err = rows.Scan(&day, &stored)
+			if err != nil {
+				retrieveError <- &storageErrors.ScanningPSQLError{Err: err}
+				return
+			}
+			sketch, err := hll.Parse(stored)
+			if err != nil {
+				retrieveError <- &storageErrors.ScanningPSQLError{Err: err}
+				return
+			}
+			visitors[day] = sketch.Count()
+			total.Merge(sketch)
+		}
+		err = rows.Err()
+		if err != nil {
+			retrieveError <- &storageErrors.ScanningPSQLError{Err: err}
+			return
+		}
+		for i := range stats.ClicksPerDay {
+			stats.ClicksPerDay[i].Visitors = visitors[stats.ClicksPerDay[i].Date]
+		}
+		stats.UniqueVisitors = total.Count()
+		retrieveDone <- stats
+	}()
+
+	// wait for the first channel to retrieve a value
+	select {
+	case <-ctx.Done():
+		s.logger(ctx).Warn("Retrieving URL stats", logger.Error(ctx.Err()))
+		return modelurl.URLStats{}, &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
+	case rtrvError := <-retrieveError:
+		s.logger(ctx).Warn("Retrieving URL stats", logger.Error(rtrvError))
+		return modelurl.URLStats{}, rtrvError
+	case stats := <-retrieveDone:
+		s.logger(ctx).Debug("Retrieving URL stats", logger.String("sURL", sURL), logger.Int("totalClicks", stats.TotalClicks))
+		return stats, nil
+	}
+}
+
+// RetrieveServiceStats returns totals of stored URLs and their users.
+func (s *Storage) RetrieveServiceStats(ctx context.Context) (stats modelurl.ServiceStats, err error) {
+	// create channels for listening to the go routine result
+	retrieveDone := make(chan modelurl.ServiceStats, 1)
+	retrieveError := make(chan error, 1)
+	go func() {
+		var stats modelurl.ServiceStats
+		err := s.stmts.selectServiceStats.QueryRowContext(ctx).Scan(&stats.URLs, &stats.Users)
+		if err != nil {
+			retrieveError <- &storageErrors.ExecutionPSQLError{Err: err}
+			return
+		}
+		retrieveDone <- stats
+	}()
+
+	// wait for the first channel to retrieve a value
+	select {
+	case <-ctx.Done():
+		s.logger(ctx).Warn("Retrieving service stats", logger.Error(ctx.Err()))
+		return modelurl.ServiceStats{}, &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
+	case rtrvError := <-retrieveError:
+		s.logger(ctx).Warn("Retrieving service stats", logger.Error(rtrvError))
+		return modelurl.ServiceStats{}, rtrvError
+	case stats := <-retrieveDone:
+		s.logger(ctx).Debug("Retrieving service stats", logger.Int("urls", stats.URLs), logger.Int("users", stats.Users))
+		return stats, nil
+	}
+}
+
+// RetrieveTimeSeries returns non-empty hourly or daily buckets of redirects of sURL within [from, to) from click
+// rollups, redirects show up in them once rolled up in the background.
+func (s *Storage) RetrieveTimeSeries(ctx context.Context, sURL, granularity string, from, to time.Time, includeBots bool) (buckets []modelurl.ClickBucket, err error) {
+	// create channels for listening to the go routine result
+	retrieveDone := make(chan []modelurl.ClickBucket, 1)
+	retrieveError := make(chan error, 1)
+	go func() {
+		var exists bool
+		err := s.stmts.existsSURL.QueryRowContext(ctx, sURL).Scan(&exists)
+		if err != nil {
+			retrieveError <- &storageErrors.ExecutionPSQLError{Err: err}
+			return
+		}
+		if !exists {
+			retrieveError <- &storageErrors.NotFoundError{Err: nil, SURL: sURL}
+			return
+		}
+		stmt := s.stmts.selectHourlyRollup
+		if granularity == modelurl.GranularityDay {
+			stmt = s.stmts.selectDailyRollup
+		}
+		rows, err := stmt.QueryContext(ctx, sURL, from, to, includeBots)
+		if err != nil {
+			retrieveError <- &storageErrors.ExecutionPSQLError{Err: err}
+			return
+		}
+		defer rows.Close()
+		var buckets []modelurl.ClickBucket
+		for rows.Next() {
+			var bucket modelurl.ClickBucket
+			err = rows.Scan(&bucket.Start, &bucket.Clicks)
+			if err != nil {
+				retrieveError <- &storageErrors.ScanningPSQLError{Err: err}
+				return
+			}
+			bucket.Start = bucket.Start.UTC()
+			buckets = append(buckets, bucket)
+		}
+		err = rows.Err()
+		if err != nil {
+			retrieveError <- &storageErrors.ScanningPSQLError{Err: err}
+			return
+		}
+		retrieveDone <- buckets
+	}()
+
+	// wait for the first channel to retrieve a value
+	select {
+	case <-ctx.Done():
+		s.logger(ctx).Warn("Retrieving URL time series", logger.Error(ctx.Err()))
+		return nil, &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
+	case rtrvError := <-retrieveError:
+		s.logger(ctx).Warn("Retrieving URL time series", logger.Error(rtrvError))
+		return nil, rtrvError
+	case buckets := <-retrieveDone:
+		s.logger(ctx).Debug("Retrieving URL time series", logger.String("sURL", sURL), logger.Int("buckets", len(buckets)))
+		return buckets, nil
+	}
+}
+
+// RetrieveReferrers returns up to limit referrer domains of sURL with the most redirects along with the number of
+// direct redirects.
+func (s *Storage) RetrieveReferrers(ctx context.Context, sURL string, limit int, includeBots bool) (stats modelurl.ReferrerStats, err error) {
+	// create channels for listening to the go routine result
+	retrieveDone := make(chan modelurl.ReferrerStats, 1)
+	retrieveError := make(chan error, 1)
+	go func() {
+		var exists bool
+		err := s.stmts.existsSURL.QueryRowContext(ctx, sURL).Scan(&exists)
+		if err != nil {
+			retrieveError <- &storageErrors.ExecutionPSQLError{Err: err}
+			return
+		}
+		if !exists {
+			retrieveError <- &storageErrors.NotFoundError{Err: nil, SURL: sURL}
+			return
+		}
+		stats := modelurl.ReferrerStats{SURL: sURL}
+		err = s.stmts.selectDirectClicks.QueryRowContext(ctx, sURL, includeBots).Scan(&stats.DirectClicks)
+		if err != nil {
+			retrieveError <- &storageErrors.ExecutionPSQLError{Err: err}
+			return
+		}
+		rows, err := s.stmts.selectReferrers.QueryContext(ctx, sURL, limit, includeBots)
+		if err != nil {
+			retrieveError <- &storageErrors.ExecutionPSQLError{Err: err}
+			return
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var referrer modelurl.ReferrerClicks
+			err = rows.Scan(&referrer.Domain, &referrer.Clicks)
+			if err != nil {
+				retrieveError <- &storageErrors.ScanningPSQLError{Err: err}
+				return
+			}
+			stats.Referrers = append(stats.Referrers, referrer)
+		}
+		err = rows.Err()
+		if err != nil {
+			retrieveError <- &storageErrors.ScanningPSQLError{Err: err}
+			return
+		}
+		retrieveDone <- stats
+	}()
+
+	// wait for the first channel to retrieve a value
+	select {
+	case <-ctx.Done():
+		s.logger(ctx).Warn("Retrieving URL referrers", logger.Error(ctx.Err()))
+		return modelurl.ReferrerStats{}, &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
+	case rtrvError := <-retrieveError:
+		s.logger(ctx).Warn("Retrieving URL referrers", logger.Error(rtrvError))
+		return modelurl.ReferrerStats{}, rtrvError
+	case stats := <-retrieveDone:
+		s.logger(ctx).Debug("Retrieving URL referrers", logger.String("sURL", sURL), logger.Int("referrers", len(stats.Referrers)))
+		return stats, nil
+	}
+}
+
+// RetrieveCountries returns redirect counts of sURL per visitor country along with the number of redirects of visitors
+// whose country was not resolved.
+func (s *Storage) RetrieveCountries(ctx context.Context, sURL string, includeBots bool) (stats modelurl.CountryStats, err error) {
+	// create channels for listening to the go routine result
+	retrieveDone := make(chan modelurl.CountryStats, 1)
+	retrieveError := make(chan error, 1)
+	go func() {
+		var exists bool
+		err := s.stmts.existsSURL.QueryRowContext(ctx, sURL).Scan(&exists)
+		if err != nil {
+			retrieveError <- &storageErrors.ExecutionPSQLError{Err: err}
+			return
+		}
+		if !exists {
+			retrieveError <- &storageErrors.NotFoundError{Err: nil, SURL: sURL}
+			return
+		}
+		rows, err := s.stmts.selectCountries.QueryContext(ctx, sURL, includeBots)
+		if err != nil {
+			retrieveError <- &storageErrors.ExecutionPSQLError{Err: err}
+			return
+		}
+		defer rows.Close()
+		counts := make(map[string]int)
+		for rows.Next() {
+			var country string
+			var clicks int
+			err = rows.Scan(&country, &clicks)
+			if err != nil {
+				retrieveError <- &storageErrors.ScanningPSQLError{Err: err}
+				return
+			}
+			counts[country] = clicks
+		}
+		err = rows.Err()
+		if err != nil {
+			retrieveError <- &storageErrors.ScanningPSQLError{Err: err}
+			return
+		}
+		// redirects of bots are filtered out by the query already
+		retrieveDone <- modelstorage.CountryBreakdown(sURL, counts, includeBots)
+	}()
+
+	// wait for the first channel to retrieve a value
+	select {
+	case <-ctx.Done():
+		s.logger(ctx).Warn("Retrieving URL countries", logger.Error(ctx.Err()))
+		return modelurl.CountryStats{}, &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
+	case rtrvError := <-retrieveError:
+		s.logger(ctx).Warn("Retrieving URL countries", logger.Error(rtrvError))
+		return modelurl.CountryStats{}, rtrvError
+	case stats := <-retrieveDone:
+		s.logger(ctx).Debug("Retrieving URL countries", logger.String("sURL", sURL), logger.Int("countries", len(stats.Countries)))
+		return stats, nil
+	}
+}
+
+// flushClicks stores a batch of redirect records in DB, updates last access times of the redirected entries and merges
+// their visitors into unique visitor sketches within one transaction.
+func (s *Storage) flushClicks(ctx context.Context, clicks []modelstorage.ClickEntry) error {
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return &storageErrors.ExecutionPSQLError{Err: err}
+	}
+	defer tx.Rollback()
+	insertStmt := tx.StmtContext(ctx, s.stmts.insertClick)
+	defer insertStmt.Close()
+	accessed := make(map[string]time.Time)
+	for _, click := range clicks {
+		_, err = insertStmt.ExecContext(ctx, click.SURL, click.ClickedAt, click.Referrer, click.UserAgent, click.Destination, click.ReferrerDomain, click.Bot, click.Country)
+		if err != nil {
+			return &storageErrors.ExecutionPSQLError{Err: err}
+		}
+		if click.ClickedAt.After(accessed[click.SURL]) {
+			accessed[click.SURL] = click.ClickedAt
+		}
+	}
+	sURLs := make([]string, 0, len(accessed))
+	accessedAt := make([]string, 0, len(accessed))
+	for sURL, clickedAt := range accessed {
+		sURLs = append(sURLs, sURL)
+		accessedAt = append(accessedAt, clickedAt.Format(time.RFC3339Nano))
+	}
+	touchStmt := tx.StmtContext(ctx, s.stmts.touchURLs)
+	defer touchStmt.Close()
+	_, err = touchStmt.ExecContext(ctx, pq.Array(sURLs), pq.Array(accessedAt))
+	if err != nil {
+		return &storageErrors.ExecutionPSQLError{Err: err}
+	}
+	err = s.mergeVisitors(ctx, tx, clicks)
+	if err != nil {
+		return err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return &storageErrors.ExecutionPSQLError{Err: err}
+	}
+	s.log.Debug("Recording clicks", logger.Int("count", len(clicks)))
+	return nil
+}
+
+// rollupClicks counts redirects recorded since the last rollup per hour into click rollups serving time series.
+func (s *Storage) rollupClicks(ctx context.Context) error {
+	res, err := s.stmts.rollupClicks.ExecContext(ctx)
+	if err != nil {
+		return &storageErrors.ExecutionPSQLError{Err: err}
+	}
+	rolledUp, err := res.RowsAffected()
+	if err != nil {
+		return &storageErrors.ExecutionPSQLError{Err: err}
+	}
+	s.log.Debug("Rolling up clicks", logger.Int("hours", int(rolledUp)))
+	return nil
+}
+
+// visitorDay keys visitor sketches of flushed clicks.
+type visitorDay struct {
+	sURL string
+	day  string
+}
+
+// mergeVisitors adds visitors of clicks to sketches per sURL and day and merges them into stored ones within tx.
+// Stored sketches are locked in the same order by every flush so that concurrent instances do not deadlock.
+func (s *Storage) mergeVisitors(ctx context.Context, tx *sql.Tx, clicks []modelstorage.ClickEntry) error {
+	sketches := make(map[visitorDay]hll.Sketch)
+	for _, click := range clicks {
+		if click.VisitorKey == "" {
+			continue
+		}
+		key := visitorDay{sURL: click.SURL, day: click.ClickedAt.UTC().Format("2006-01-02")}
+		if sketches[key] == nil {
+			sketches[key] = hll.New()
+		}
+		sketches[key].Add(click.VisitorKey)
+	}
+	keys := make([]visitorDay, 0, len(sketches))
+	for key := range sketches {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].sURL != keys[j].sURL {
+			return keys[i].sURL < keys[j].sURL
+		}
+		return keys[i].day < keys[j].day
+	})
+	insertStmt := tx.StmtContext(ctx, s.stmts.insertVisitors)
+	defer insertStmt.Close()
+	lockStmt := tx.StmtContext(ctx, s.stmts.lockVisitors)
+	defer lockStmt.Close()
+	updateStmt := tx.StmtContext(ctx, s.stmts.updateVisitors)
+	defer updateStmt.Close()
+	for _, key := range keys {
+		sketch := sketches[key]
+		res, err := insertStmt.ExecContext(ctx, key.sURL, key.day, []byte(sketch))
+		if err != nil {
+			return &storageErrors.ExecutionPSQLError{Err: err}
+		}
+		inserted, err := res.RowsAffected()
+		if err != nil {
+			return &storageErrors.ExecutionPSQLError{Err: err}
+		}
+		if inserted > 0 {
+			continue
+		}
+		var stored []byte
+		err = lockStmt.QueryRowContext(ctx, key.sURL, key.day).Scan(&stored)
+		if err != nil {
+			return &storageErrors.ExecutionPSQLError{Err: err}
+		}
+		storedSketch, err := hll.Parse(stored)
+		if err != nil {
+			return &storageErrors.ScanningPSQLError{Err: err}
+		}
+		sketch.Merge(storedSketch)
+		_, err = updateStmt.ExecContext(ctx, key.sURL, key.day, []byte(sketch))
+		if err != nil {
+			return &storageErrors.ExecutionPSQLError{Err: err}
+		}
+	}
+	return nil
+}
+
+// retrievePending returns deletions persisted by SendToQueue and not performed yet in the order they were sent.
+func (s *Storage) retrievePending(ctx context.Context) ([]modelstorage.URLChannelEntry, error) {
+	rows, err := s.DB.QueryContext(ctx, selectPendingQuery)
+	if err != nil {
+		return nil, &storageErrors.ExecutionPSQLError{Err: err}
+	}
+	defer rows.Close()
+	var pending []modelstorage.URLChannelEntry
+	for rows.Next() {
+		var item modelstorage.URLChannelEntry
+		err = rows.Scan(&item.UserID, &item.SURL)
+		if err != nil {
+			return nil, &storageErrors.ScanningPSQLError{Err: err}
+		}
+		pending = append(pending, item)
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, &storageErrors.ScanningPSQLError{Err: err}
+	}
+	return pending, nil
+}
+
+// deadLetter records the deletion of sURL owned by userID which failed attempts times with cause, the entry stays
+// live until the deletion is replayed.
+func (s *Storage) deadLetter(ctx context.Context, userID, sURL string, cause error, attempts int) error {
+	_, err := s.DB.ExecContext(ctx, insertDeadLetterQuery, userID, sURL, cause.Error(), attempts)
+	if err != nil {
+		s.log.Error("Deleting URL: recording dead letter", logger.String("userID", userID), logger.String("sURL", sURL), logger.Error(err))
+		return &storageErrors.ExecutionPSQLError{Err: err}
+	}
+	s.log.Error("Deleting URL: dead-lettered", logger.String("userID", userID), logger.String("sURL", sURL), logger.Int("attempts", attempts), logger.Error(cause))
+	return nil
+}
+
+// purgeExpired permanently removes expired DB entries along with their redirect and edit records and tags.
+func (s *Storage) purgeExpired(ctx context.Context) error {
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return &storageErrors.ExecutionPSQLError{Err: err}
+	}
+	defer tx.Rollback()
+	_, err = tx.ExecContext(ctx, "DELETE FROM clicks WHERE short_url IN (SELECT short_url FROM urls WHERE expires_at <= now())")
+	if err != nil {
+		return &storageErrors.ExecutionPSQLError{Err: err}
+	}
+	_, err = tx.ExecContext(ctx, "DELETE FROM click_rollups WHERE short_url IN (SELECT short_url FROM urls WHERE expires_at <= now())")
+	if err != nil {
+		return &storageErrors.ExecutionPSQLError{Err: err}
+	}
+	_, err = tx.ExecContext(ctx, "DELETE FROM daily_visitors WHERE short_url IN (SELECT short_url FROM urls WHERE expires_at <= now())")
+	if err != nil {
+		return &storageErrors.ExecutionPSQLError{Err: err}
+	}
+	_, err = tx.ExecContext(ctx, "DELETE FROM url_edits WHERE short_url IN (SELECT short_url FROM urls WHERE expires_at <= now())")
+	if err != nil {
+		return &storageErrors.ExecutionPSQLError{Err: err}
+	}
+	_, err = tx.ExecContext(ctx, "DELETE FROM url_tags WHERE short_url IN (SELECT short_url FROM urls WHERE expires_at <= now())")
+	if err != nil {
+		return &storageErrors.ExecutionPSQLError{Err: err}
+	}
+	rows, err := tx.QueryContext(ctx, "DELETE FROM urls WHERE expires_at <= now() RETURNING short_url, url, user_id")
+	if err != nil {
+		return &storageErrors.ExecutionPSQLError{Err: err}
+	}
+	var purged []string
+	var entries []modelstorage.URLStorageEntry
+	for rows.Next() {
+		var entry modelstorage.URLStorageEntry
+		err = rows.Scan(&entry.SURL, &entry.URL, &entry.UserID)
+		if err != nil {
+			rows.Close()
+			return &storageErrors.ScanningPSQLError{Err: err}
+		}
+		purged = append(purged, entry.SURL)
+		entries = append(entries, entry)
+	}
+	rows.Close()
+	err = rows.Err()
+	if err != nil {
+		return &storageErrors.ScanningPSQLError{Err: err}
+	}
+	err = tx.Commit()
+	if err != nil {
+		return &storageErrors.ExecutionPSQLError{Err: err}
+	}
+	s.cache.Remove(purged...)
+	for _, entry := range entries {
+		s.Emit(modelurl.EventURLExpired, entry)
+	}
+	if len(purged) > 0 {
+		s.log.Info("Purging expired URLs", logger.Any("sURLs", purged))
+	}
+	return nil
+}
+
+// purgeDeleted permanently removes DB entries deleted more than retention ago along with their redirect and edit
+// records and tags, deleted entries are never cached.
+func (s *Storage) purgeDeleted(ctx context.Context, retention time.Duration) error {
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return &storageErrors.ExecutionPSQLError{Err: err}
+	}
+	defer tx.Rollback()
+	deletedBefore := time.Now().Add(-retention)
+	_, err = tx.ExecContext(ctx, "DELETE FROM clicks WHERE short_url IN (SELECT short_url FROM urls WHERE is_deleted AND deleted_at <= $1)", deletedBefore)
+	if err != nil {
+		return &storageErrors.ExecutionPSQLError{Err: err}
+	}
+	_, err = tx.ExecContext(ctx, "DELETE FROM click_rollups WHERE short_url IN (SELECT short_url FROM urls WHERE is_deleted AND deleted_at <= $1)", deletedBefore)
+	if err != nil {
+		return &storageErrors.ExecutionPSQLError{Err: err}
+	}
+	_, err = tx.ExecContext(ctx, "DELETE FROM daily_visitors WHERE short_url IN (SELECT short_url FROM urls WHERE is_deleted AND deleted_at <= $1)", deletedBefore)
+	if err != nil {
+		return &storageErrors.ExecutionPSQLError{Err: err}
+	}
+	_, err = tx.ExecContext(ctx, "DELETE FROM url_edits WHERE short_url IN (SELECT short_url FROM urls WHERE is_deleted AND deleted_at <= $1)", deletedBefore)
+	if err != nil {
+		return &storageErrors.ExecutionPSQLError{Err: err}
+	}
+	_, err = tx.ExecContext(ctx, "DELETE FROM url_tags WHERE short_url IN (SELECT short_url FROM urls WHERE is_deleted AND deleted_at <= $1)", deletedBefore)
+	if err != nil {
+		return &storageErrors.ExecutionPSQLError{Err: err}
+	}
+	res, err := tx.ExecContext(ctx, "DELETE FROM urls WHERE is_deleted AND deleted_at <= $1", deletedBefore)
+	if err != nil {
+		return &storageErrors.ExecutionPSQLError{Err: err}
+	}
+	purged, err := res.RowsAffected()
+	if err != nil {
+		return &storageErrors.ExecutionPSQLError{Err: err}
+	}
+	err = tx.Commit()
+	if err != nil {
+		return &storageErrors.ExecutionPSQLError{Err: err}
+	}
+	if purged > 0 {
+		s.log.Info("Purging deleted URLs", logger.Int("count", int(purged)))
+	}
+	return nil
+}
+
+// archiveStale notices owners of DB entries about to be archived and archives entries stale according to policy,
+// archived entries keep redirecting.
+func (s *Storage) archiveStale(ctx context.Context, policy modelstorage.ArchivePolicy) error {
+	now := time.Now()
+	staleBefore := now.Add(-policy.StaleAfter)
+	noticedBefore := sql.NullTime{Time: now.Add(-policy.NoticeBefore), Valid: policy.NoticeBefore > 0}
+	if noticedBefore.Valid {
+		noticed, err := updateStale(ctx, s.DB, noticeStaleQuery, staleBefore.Add(policy.NoticeBefore))
+		if err != nil {
+			return err
+		}
+		for _, entry := range noticed {
+			s.Emit(modelurl.EventURLArchivePending, entry)
+		}
+		if len(noticed) > 0 {
+			s.log.Info("Noticing stale URLs", logger.Int("count", len(noticed)))
+		}
+	}
+	archived, err := updateStale(ctx, s.DB, archiveStaleQuery, staleBefore, noticedBefore)
+	if err != nil {
+		return err
+	}
+	for _, entry := range archived {
+		s.Emit(modelurl.EventURLArchived, entry)
+	}
+	if len(archived) > 0 {
+		s.log.Info("Archiving stale URLs", logger.Int("count", len(archived)))
+	}
+	return nil
+}
+
+// updateStale runs query updating stale entries with args and returns the updated ones.
+func updateStale(ctx context.Context, db *sql.DB, query string, args ...interface{}) ([]modelstorage.URLStorageEntry, error) {
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, &storageErrors.ExecutionPSQLError{Err: err}
+	}
+	defer rows.Close()
+	var entries []modelstorage.URLStorageEntry
+	for rows.Next() {
+		var entry modelstorage.URLStorageEntry
+		err = rows.Scan(&entry.SURL, &entry.URL, &entry.UserID)
+		if err != nil {
+			return nil, &storageErrors.ScanningPSQLError{Err: err}
+		}
+		entries = append(entries, entry)
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, &storageErrors.ScanningPSQLError{Err: err}
+	}
+	return entries, nil
+}
+
+// CacheStats returns the number of cache hits and misses in Retrieve.
+func (s *Storage) CacheStats() (hits, misses uint64) {
+	return s.cache.Stats()
+}
+
+// DBStats returns the connection pool stats of the primary DB.
+func (s *Storage) DBStats() sql.DBStats {
+	return s.DB.Stats()
+}
+
+// DumpUser stores a new user account in DB, logins are unique.
+func (s *Storage) DumpUser(ctx context.Context, entry modelstorage.UserEntry) error {
+	// create channels for listening to the go routine result
+	dumpDone := make(chan bool, 1)
+	dumpError := make(chan error, 1)
+	go func() {
+		_, err := s.stmts.insertUser.ExecContext(ctx, entry.Login, entry.PasswordHash, entry.UserID)
+		if err != nil {
+			if err, ok := err.(*pgconn.PgError); ok && err.Code == pgerrcode.UniqueViolation && err.ConstraintName == usersLoginConstraint {
+				dumpError <- &storageErrors.LoginAlreadyExistsError{Err: err, Login: entry.Login}
+				return
+			}
+			dumpError <- &storageErrors.ExecutionPSQLError{Err: err}
+			return
+		}
+		dumpDone <- true
+	}()
+
+	// wait for the first channel to retrieve a value
+	select {
+	case <-ctx.Done():
+		s.logger(ctx).Warn("Dumping user", logger.Error(ctx.Err()))
+		return &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
+	case dmpError := <-dumpError:
+		s.logger(ctx).Warn("Dumping user", logger.Error(dmpError))
+		return dmpError
+	case <-dumpDone:
+		s.logger(ctx).Debug("Dumping user", logger.String("login", entry.Login))
+		return nil
+	}
+}
+
+// SetUserRole sets the role of the account registered with login.
+func (s *Storage) SetUserRole(ctx context.Context, login, role string) error {
+	// create channels for listening to the go routine result
+	updateDone := make(chan bool, 1)
+	updateError := make(chan error, 1)
+	go func() {
+		res, err := s.stmts.updateUserRole.ExecContext(ctx, login, role)
+		if err != nil {
+			updateError <- &storageErrors.ExecutionPSQLError{Err: err}
+			return
+		}
+		affected, err := res.RowsAffected()
+		if err != nil {
+			updateError <- &storageErrors.ExecutionPSQLError{Err: err}
+			return
+		}
+		if affected == 0 {
+			updateError <- &storageErrors.UserNotFoundError{Err: nil, Login: login}
+			return
+		}
+		updateDone <- true
+	}()
+
+	// wait for the first channel to retrieve a value
+	select {
+	case <-ctx.Done():
+		s.logger(ctx).Warn("Setting user role", logger.Error(ctx.Err()))
+		return &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
+	case updError := <-updateError:
+		s.logger(ctx).Warn("Setting user role", logger.Error(updError))
+		return updError
+	case <-updateDone:
+		s.logger(ctx).Debug("Setting user role", logger.String("login", login), logger.String("role", role))
+		return nil
+	}
+}
+
+// RetrieveUser returns a user account corresponding to login.
+func (s *Storage) RetrieveUser(ctx context.Context, login string) (entry modelstorage.UserEntry, err error) {
+	// create channels for listening to the go routine result
+	retrieveDone := make(chan modelstorage.UserEntry, 1)
+	retrieveError := make(chan error, 1)
+	go func() {
+		var user modelstorage.UserEntry
+		err := s.stmts.selectUser.QueryRowContext(ctx, login).Scan(&user.Login, &user.PasswordHash, &user.UserID, &user.Role)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				retrieveError <- &storageErrors.UserNotFoundError{Err: err, Login: login}
+				return
+			}
+			retrieveError <- &storageErrors.ExecutionPSQLError{Err: err}
+			return
+		}
+		retrieveDone <- user
+	}()
+
+	// wait for the first channel to retrieve a value
+	select {
+	case <-ctx.Done():
+		s.logger(ctx).Warn("Retrieving user", logger.Error(ctx.Err()))
+		return modelstorage.UserEntry{}, &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
+	case rtrvError := <-retrieveError:
+		s.logger(ctx).Warn("Retrieving user", logger.Error(rtrvError))
+		return modelstorage.UserEntry{}, rtrvError
+	case user := <-retrieveDone:
+		s.logger(ctx).Debug("Retrieving user", logger.String("login", user.Login))
+		return user, nil
+	}
+}
+
+// RetrieveUsers returns a page of user accounts sorted by login.
+func (s *Storage) RetrieveUsers(ctx context.Context, opts modelurl.ListOptions) (entries []modelstorage.UserEntry, err error) {
+	// create channels for listening to the go routine result
+	retrieveDone := make(chan []modelstorage.UserEntry, 1)
+	retrieveError := make(chan error, 1)
+	go func() {
+		stmt := s.stmts.selectUsersAsc
+		if opts.Desc {
+			stmt = s.stmts.selectUsersDesc
+		}
+		limit := sql.NullInt64{Int64: int64(opts.Limit), Valid: opts.Limit > 0}
+		rows, err := stmt.QueryContext(ctx, limit, opts.Offset)
+		if err != nil {
+			retrieveError <- &storageErrors.ExecutionPSQLError{Err: err}
+			return
+		}
+		defer rows.Close()
+		var users []modelstorage.UserEntry
+		for rows.Next() {
+			var user modelstorage.UserEntry
+			err = rows.Scan(&user.Login, &user.PasswordHash, &user.UserID, &user.Role)
+			if err != nil {
+				retrieveError <- &storageErrors.ScanningPSQLError{Err: err}
+				return
+			}
+			users = append(users, user)
+		}
+		err = rows.Err()
+		if err != nil {
+			retrieveError <- &storageErrors.ScanningPSQLError{Err: err}
+			return
+		}
+		retrieveDone <- users
+	}()
+
+	// wait for the first channel to retrieve a value
+	select {
+	case <-ctx.Done():
+		s.logger(ctx).Warn("Retrieving users", logger.Error(ctx.Err()))
+		return nil, &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
+	case rtrvError := <-retrieveError:
+		s.logger(ctx).Warn("Retrieving users", logger.Error(rtrvError))
+		return nil, rtrvError
+	case users := <-retrieveDone:
+		s.logger(ctx).Debug("Retrieving users", logger.Int("count", len(users)))
+		return users, nil
+	}
+}
+
+// RetrieveUsersByUserID returns user accounts registered by userID sorted by login.
+func (s *Storage) RetrieveUsersByUserID(ctx context.Context, userID string) (entries []modelstorage.UserEntry, err error) {
+	// create channels for listening to the go routine result
+	retrieveDone := make(chan []modelstorage.UserEntry, 1)
+	retrieveError := make(chan error, 1)
+	go func() {
+		rows, err := s.stmts.selectUsersByID.QueryContext(ctx, userID)
+		if err != nil {
+			retrieveError <- &storageErrors.ExecutionPSQLError{Err: err}
+			return
+		}
+		defer rows.Close()
+		var users []modelstorage.UserEntry
+		for rows.Next() {
+			var user modelstorage.UserEntry
+			err = rows.Scan(&user.Login, &user.PasswordHash, &user.UserID, &user.Role)
+			if err != nil {
+				retrieveError <- &storageErrors.ScanningPSQLError{Err: err}
+				return
+			}
+			users = append(users, user)
+		}
+		err = rows.Err()
+		if err != nil {
+			retrieveError <- &storageErrors.ScanningPSQLError{Err: err}
+			return
+		}
+		retrieveDone <- users
+	}()
+
+	// wait for the first channel to retrieve a value
+	select {
+	case <-ctx.Done():
+		s.logger(ctx).Warn("Retrieving users by user ID", logger.Error(ctx.Err()))
+		return nil, &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
+	case rtrvError := <-retrieveError:
+		s.logger(ctx).Warn("Retrieving users by user ID", logger.Error(rtrvError))
+		return nil, rtrvError
+	case users := <-retrieveDone:
+		s.logger(ctx).Debug("Retrieving users by user ID", logger.Int("count", len(users)))
+		return users, nil
+	}
+}
+
+// EraseUser permanently removes all data of userID within one transaction: links of the user whatever their state
+// along with their redirect and edit records and tags, queued and failed deletions, accounts, API keys, custom domains,
+// settings and organization memberships. Audit records are kept without the states of the links and memberships of
+// the user and of operations made by the user, deletions of the user still queued in memory find nothing to delete.
+func (s *Storage) EraseUser(ctx context.Context, userID string) error {
+	// create channels for listening to the go routine result
+	eraseDone := make(chan []string, 1)
+	eraseError := make(chan error, 1)
+	go func() {
+		tx, err := s.DB.BeginTx(ctx, nil)
+		if err != nil {
+			eraseError <- &storageErrors.ExecutionPSQLError{Err: err}
+			return
+		}
+		defer tx.Rollback()
+		// audit records of links are told apart while the links are still there
+		_, err = tx.ExecContext(ctx, eraseAuditQuery, userID)
+		if err != nil {
+			eraseError <- &storageErrors.ExecutionPSQLError{Err: err}
+			return
+		}
+		_, err = tx.ExecContext(ctx, eraseClicksQuery, userID)
+		if err != nil {
+			eraseError <- &storageErrors.ExecutionPSQLError{Err: err}
+			return
+		}
+		_, err = tx.ExecContext(ctx, eraseRollupsQuery, userID)
+		if err != nil {
+			eraseError <- &storageErrors.ExecutionPSQLError{Err: err}
+			return
+		}
+		_, err = tx.ExecContext(ctx, eraseVisitorsQuery, userID)
+		if err != nil {
+			eraseError <- &storageErrors.ExecutionPSQLError{Err: err}
+			return
+		}
+		_, err = tx.ExecContext(ctx, eraseEditsQuery, userID)
+		if err != nil {
+			eraseError <- &storageErrors.ExecutionPSQLError{Err: err}
+			return
+		}
+		_, err = tx.ExecContext(ctx, eraseTagsQuery, userID)
+		if err != nil {
+			eraseError <- &storageErrors.ExecutionPSQLError{Err: err}
+			return
+		}
+		rows, err := tx.QueryContext(ctx, eraseURLsQuery, userID)
+		if err != nil {
+			eraseError <- &storageErrors.ExecutionPSQLError{Err: err}
+			return
+		}
+		var erased []string
+		for rows.Next() {
+			var sURL string
+			err = rows.Scan(&sURL)
+			if err != nil {
+				rows.Close()
+				eraseError <- &storageErrors.ScanningPSQLError{Err: err}
+				return
+			}
+			erased = append(erased, sURL)
+		}
+		rows.Close()
+		err = rows.Err()
+		if err != nil {
+			eraseError <- &storageErrors.ScanningPSQLError{Err: err}
+			return
+		}
+		for _, query := range []string{erasePendingQuery, eraseDeadLettersQuery, eraseAPIKeysQuery, eraseDomainsQuery, eraseSettingsQuery, eraseMembersQuery, eraseUsersQuery} {
+			_, err = tx.ExecContext(ctx, query, userID)
+			if err != nil {
+				eraseError <- &storageErrors.ExecutionPSQLError{Err: err}
+				return
+			}
+		}
+		err = tx.Commit()
+		if err != nil {
+			eraseError <- &storageErrors.ExecutionPSQLError{Err: err}
+			return
+		}
+		s.cache.Remove(erased...)
+		eraseDone <- erased
+	}()
+
+	// wait for the first channel to retrieve a value
+	select {
+	case <-ctx.Done():
+		s.logger(ctx).Warn("Erasing user", logger.Error(ctx.Err()))
+		return &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
+	case ersError := <-eraseError:
+		s.logger(ctx).Warn("Erasing user", logger.Error(ersError))
+		return ersError
+	case erased := <-eraseDone:
+		s.logger(ctx).Debug("Erasing user", logger.String("userID", userID), logger.Int("urls", len(erased)))
+		return nil
+	}
+}
+
+// RetrieveUserStats returns totals of links of userID and their redirects.
+func (s *Storage) RetrieveUserStats(ctx context.Context, userID string) (stats modelurl.UserStats, err error) {
+	// create channels for listening to the go routine result
+	retrieveDone := make(chan modelurl.UserStats, 1)
+	retrieveError := make(chan error, 1)
+	go func() {
+		stats := modelurl.UserStats{UserID: userID}
+		err := s.stmts.selectUserStats.QueryRowContext(ctx, userID).Scan(&stats.URLs, &stats.Disabled, &stats.Clicks)
+		if err != nil {
+			retrieveError <- &storageErrors.ExecutionPSQLError{Err: err}
+			return
+		}
+		retrieveDone <- stats
+	}()
+
+	// wait for the first channel to retrieve a value
+	select {
+	case <-ctx.Done():
+		s.logger(ctx).Warn("Retrieving user stats", logger.Error(ctx.Err()))
+		return modelurl.UserStats{}, &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
+	case rtrvError := <-retrieveError:
+		s.logger(ctx).Warn("Retrieving user stats", logger.Error(rtrvError))
+		return modelurl.UserStats{}, rtrvError
+	case stats := <-retrieveDone:
+		s.logger(ctx).Debug("Retrieving user stats", logger.String("userID", userID), logger.Int("urls", stats.URLs))
+		return stats, nil
+	}
+}
+
+// DumpAPIKey stores a new API key in DB.
+func (s *Storage) DumpAPIKey(ctx context.Context, entry modelstorage.APIKeyEntry) error {
+	// create channels for listening to the go routine result
+	dumpDone := make(chan bool, 1)
+	dumpError := make(chan error, 1)
+	go func() {
+		_, err := s.stmts.insertAPIKey.ExecContext(ctx, entry.ID, entry.UserID, entry.Name, entry.Prefix, entry.Hash, entry.CreatedAt)
+		if err != nil {
+			dumpError <- &storageErrors.ExecutionPSQLError{Err: err}
+			return
+		}
+		dumpDone <- true
+	}()
+
+	// wait for the first channel to retrieve a value
+	select {
+	case <-ctx.Done():
+		s.logger(ctx).Warn("Dumping API key", logger.Error(ctx.Err()))
+		return &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
+	case dmpError := <-dumpError:
+		s.logger(ctx).Warn("Dumping API key", logger.Error(dmpError))
+		return dmpError
+	case <-dumpDone:
+		s.logger(ctx).Debug("Dumping API key", logger.String("id", entry.ID))
+		return nil
+	}
+}
+
+// RevokeAPIKey marks the API key with id owned by userID revoked in DB, revoking a revoked key is a no-op.
+func (s *Storage) RevokeAPIKey(ctx context.Context, id, userID string) error {
+	// create channels for listening to the go routine result
+	revokeDone := make(chan bool, 1)
+	revokeError := make(chan error, 1)
+	go func() {
+		res, err := s.stmts.revokeAPIKey.ExecContext(ctx, id, userID)
+		if err != nil {
+			revokeError <- &storageErrors.ExecutionPSQLError{Err: err}
+			return
+		}
+		affected, err := res.RowsAffected()
+		if err != nil {
+			revokeError <- &storageErrors.ExecutionPSQLError{Err: err}
+			return
+		}
+		if affected == 0 {
+			revokeError <- &storageErrors.APIKeyNotFoundError{Err: nil, ID: id}
+			return
+		}
+		revokeDone <- true
+	}()
+
+	// wait for the first channel to retrieve a value
+	select {
+	case <-ctx.Done():
+		s.logger(ctx).Warn("Revoking API key", logger.Error(ctx.Err()))
+		return &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
+	case rvkError := <-revokeError:
+		s.logger(ctx).Warn("Revoking API key", logger.Error(rvkError))
+		return rvkError
+	case <-revokeDone:
+		s.logger(ctx).Debug("Revoking API key", logger.String("id", id))
+		return nil
+	}
+}
+
+// RetrieveAPIKey returns the API key with the given hash.
+func (s *Storage) RetrieveAPIKey(ctx context.Context, hash string) (entry modelstorage.APIKeyEntry, err error) {
+	// create channels for listening to the go routine result
+	retrieveDone := make(chan modelstorage.APIKeyEntry, 1)
+	retrieveError := make(chan error, 1)
+	go func() {
+		apiKey, err := scanAPIKey(s.stmts.selectAPIKey.QueryRowContext(ctx, hash))
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				retrieveError <- &storageErrors.APIKeyNotFoundError{Err: err}
+				return
+			}
+			retrieveError <- &storageErrors.ExecutionPSQLError{Err: err}
+			return
+		}
+		retrieveDone <- apiKey
+	}()
+
+	// wait for the first channel to retrieve a value
+	select {
+	case <-ctx.Done():
+		s.logger(ctx).Warn("Retrieving API key", logger.Error(ctx.Err()))
+		return modelstorage.APIKeyEntry{}, &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
+	case rtrvError := <-retrieveError:
+		s.logger(ctx).Warn("Retrieving API key", logger.Error(rtrvError))
+		return modelstorage.APIKeyEntry{}, rtrvError
+	case apiKey := <-retrieveDone:
+		s.logger(ctx).Debug("Retrieving API key", logger.String("id", apiKey.ID))
+		return apiKey, nil
+	}
+}
+
+// RetrieveAPIKeysByUserID returns API keys of userID including revoked ones sorted by creation time.
+func (s *Storage) RetrieveAPIKeysByUserID(ctx context.Context, userID string) (entries []modelstorage.APIKeyEntry, err error) {
+	// create channels for listening to the go routine result
+	retrieveDone := make(chan []modelstorage.APIKeyEntry, 1)
+	retrieveError := make(chan error, 1)
+	go func() {
+		rows, err := s.stmts.selectAPIKeys.QueryContext(ctx, userID)
+		if err != nil {
+			retrieveError <- &storageErrors.ExecutionPSQLError{Err: err}
+			return
+		}
+		defer rows.Close()
+		var apiKeys []modelstorage.APIKeyEntry
+		for rows.Next() {
+			apiKey, err := scanAPIKey(rows)
+			if err != nil {
+				retrieveError <- &storageErrors.ScanningPSQLError{Err: err}
+				return
+			}
+			apiKeys = append(apiKeys, apiKey)
+		}
+		if err := rows.Err(); err != nil {
+			retrieveError <- &storageErrors.ExecutionPSQLError{Err: err}
+			return
+		}
+		retrieveDone <- apiKeys
+	}()
+
+	// wait for the first channel to retrieve a value
+	select {
+	case <-ctx.Done():
+		s.logger(ctx).Warn("Retrieving API keys by user ID", logger.Error(ctx.Err()))
+		return nil, &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
+	case rtrvError := <-retrieveError:
+		s.logger(ctx).Warn("Retrieving API keys by user ID", logger.Error(rtrvError))
+		return nil, rtrvError
+	case apiKeys := <-retrieveDone:
+		s.logger(ctx).Debug("Retrieving API keys by user ID", logger.Int("count", len(apiKeys)))
+		return apiKeys, nil
+	}
+}
+
+// DumpDomain stores a new claim of a custom domain in DB replacing expired claims of the domain, domains verified by
+// any user or claimed by the user already are reported with DomainAlreadyExistsError.
+func (s *Storage) DumpDomain(ctx context.Context, entry modelstorage.DomainEntry) error {
+	// create channels for listening to the go routine result
+	dumpDone := make(chan bool, 1)
+	dumpError := make(chan error, 1)
+	go func() {
+		tx, err := s.DB.BeginTx(ctx, nil)
+		if err != nil {
+			dumpError <- &storageErrors.ExecutionPSQLError{Err: err}
+			return
+		}
+		defer tx.Rollback()
+		_, err = tx.StmtContext(ctx, s.stmts.purgeDomainClaims).ExecContext(ctx, entry.Name, s.claimedSince())
+		if err != nil {
+			dumpError <- &storageErrors.ExecutionPSQLError{Err: err}
+			return
+		}
+		res, err := tx.StmtContext(ctx, s.stmts.insertDomain).ExecContext(ctx, entry.Name, entry.UserID, entry.Token, entry.CreatedAt)
+		if err != nil {
+			if err, ok := err.(*pgconn.PgError); ok && err.Code == pgerrcode.UniqueViolation && err.ConstraintName == domainsClaimConstraint {
+				dumpError <- &storageErrors.DomainAlreadyExistsError{Err: err, Name: entry.Name}
+				return
+			}
+			dumpError <- &storageErrors.ExecutionPSQLError{Err: err}
+			return
+		}
+		affected, err := res.RowsAffected()
+		if err != nil {
+			dumpError <- &storageErrors.ExecutionPSQLError{Err: err}
+			return
+		}
+		// nothing is inserted when the domain is verified
+		if affected == 0 {
+			dumpError <- &storageErrors.DomainAlreadyExistsError{Err: nil, Name: entry.Name}
+			return
+		}
+		err = tx.Commit()
+		if err != nil {
+			dumpError <- &storageErrors.ExecutionPSQLError{Err: err}
+			return
+		}
+		dumpDone <- true
+	}()
+
+	// wait for the first channel to retrieve a value
+	select {
+	case <-ctx.Done():
+		s.logger(ctx).Warn("Dumping domain", logger.Error(ctx.Err()))
+		return &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
+	case dmpError := <-dumpError:
+		s.logger(ctx).Warn("Dumping domain", logger.Error(dmpError))
+		return dmpError
+	case <-dumpDone:
+		s.logger(ctx).Debug("Dumping domain", logger.String("domain", entry.Name))
+		return nil
+	}
+}
+
+// VerifyDomain marks the custom domain name claimed by userID verified in DB and drops claims of the domain by other
+// users within one transaction, verifying a verified domain is a no-op. Expired claims are reported with
+// DomainNotFoundError and domains verified by other users meanwhile with DomainAlreadyExistsError.
+func (s *Storage) VerifyDomain(ctx context.Context, name, userID string) error {
+	// create channels for listening to the go routine result
+	verifyDone := make(chan bool, 1)
+	verifyError := make(chan error, 1)
+	go func() {
+		tx, err := s.DB.BeginTx(ctx, nil)
+		if err != nil {
+			verifyError <- &storageErrors.ExecutionPSQLError{Err: err}
+			return
+		}
+		defer tx.Rollback()
+		res, err := tx.StmtContext(ctx, s.stmts.verifyDomain).ExecContext(ctx, name, userID, s.claimedSince())
+		if err != nil {
+			if err, ok := err.(*pgconn.PgError); ok && err.Code == pgerrcode.UniqueViolation && err.ConstraintName == domainsVerifiedConstraint {
+				verifyError <- &storageErrors.DomainAlreadyExistsError{Err: err, Name: name}
+				return
+			}
+			verifyError <- &storageErrors.ExecutionPSQLError{Err: err}
+			return
+		}
+		affected, err := res.RowsAffected()
+		if err != nil {
+			verifyError <- &storageErrors.ExecutionPSQLError{Err: err}
+			return
+		}
+		if affected == 0 {
+			verifyError <- &storageErrors.DomainNotFoundError{Err: nil, Name: name}
+			return
+		}
+		_, err = tx.StmtContext(ctx, s.stmts.dropDomainClaims).ExecContext(ctx, name, userID)
+		if err != nil {
+			verifyError <- &storageErrors.ExecutionPSQLError{Err: err}
+			return
+		}
+		err = tx.Commit()
+		if err != nil {
+			verifyError <- &storageErrors.ExecutionPSQLError{Err: err}
+			return
+		}
+		verifyDone <- true
+	}()
+
+	// wait for the first channel to retrieve a value
+	select {
+	case <-ctx.Done():
+		s.logger(ctx).Warn("Verifying domain", logger.Error(ctx.Err()))
+		return &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
+	case vrfError := <-verifyError:
+		s.logger(ctx).Warn("Verifying domain", logger.Error(vrfError))
+		return vrfError
+	case <-verifyDone:
+		s.logger(ctx).Debug("Verifying domain", logger.String("domain", name))
+		return nil
+	}
+}
+
+// RetrieveDomain returns the verified custom domain name, domains pending verification are reported with
+// DomainNotFoundError.
+func (s *Storage) RetrieveDomain(ctx context.Context, name string) (entry modelstorage.DomainEntry, err error) {
+	// create channels for listening to the go routine result
+	retrieveDone := make(chan modelstorage.DomainEntry, 1)
+	retrieveError := make(chan error, 1)
+	go func() {
+		domain, err := scanDomain(s.stmts.selectDomain.QueryRowContext(ctx, name))
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				retrieveError <- &storageErrors.DomainNotFoundError{Err: err, Name: name}
+				return
+			}
+			retrieveError <- &storageErrors.ExecutionPSQLError{Err: err}
+			return
+		}
+		retrieveDone <- domain
+	}()
+
+	// wait for the first channel to retrieve a value
+	select {
+	case <-ctx.Done():
+		s.logger(ctx).Warn("Retrieving domain", logger.Error(ctx.Err()))
+		return modelstorage.DomainEntry{}, &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
+	case rtrvError := <-retrieveError:
+		s.logger(ctx).Debug("Retrieving domain", logger.Error(rtrvError))
+		return modelstorage.DomainEntry{}, rtrvError
+	case domain := <-retrieveDone:
+		s.logger(ctx).Debug("Retrieving domain", logger.String("domain", domain.Name))
+		return domain, nil
+	}
+}
+
+// RetrieveDomainClaim returns the claim of the custom domain name by userID whether it is verified or not, expired
+// claims are reported with DomainNotFoundError.
+func (s *Storage) RetrieveDomainClaim(ctx context.Context, name, userID string) (entry modelstorage.DomainEntry, err error) {
+	// create channels for listening to the go routine result
+	retrieveDone := make(chan modelstorage.DomainEntry, 1)
+	retrieveError := make(chan error, 1)
+	go func() {
+		domain, err := scanDomain(s.stmts.selectDomainClaim.QueryRowContext(ctx, name, userID, s.claimedSince()))
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				retrieveError <- &storageErrors.DomainNotFoundError{Err: err, Name: name}
+				return
+			}
+			retrieveError <- &storageErrors.ExecutionPSQLError{Err: err}
+			return
+		}
+		retrieveDone <- domain
+	}()
+
+	// wait for the first channel to retrieve a value
+	select {
+	case <-ctx.Done():
+		s.logger(ctx).Warn("Retrieving domain claim", logger.Error(ctx.Err()))
+		return modelstorage.DomainEntry{}, &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
+	case rtrvError := <-retrieveError:
+		s.logger(ctx).Debug("Retrieving domain claim", logger.Error(rtrvError))
+		return modelstorage.DomainEntry{}, rtrvError
+	case domain := <-retrieveDone:
+		s.logger(ctx).Debug("Retrieving domain claim", logger.String("domain", domain.Name))
+		return domain, nil
+	}
+}
+
+// RetrieveDomainsByUserID returns custom domains of userID sorted by creation time leaving expired claims out.
+func (s *Storage) RetrieveDomainsByUserID(ctx context.Context, userID string) (entries []modelstorage.DomainEntry, err error) {
+	// create channels for listening to the go routine result
+	retrieveDone := make(chan []modelstorage.DomainEntry, 1)
+	retrieveError := make(chan error, 1)
+	go func() {
+		rows, err := s.stmts.selectDomains.QueryContext(ctx, userID, s.claimedSince())
+		if err != nil {
+			retrieveError <- &storageErrors.ExecutionPSQLError{Err: err}
+			return
+		}
+		defer rows.Close()
+		var domains []modelstorage.DomainEntry
+		for rows.Next() {
+			domain, err := scanDomain(rows)
+			if err != nil {
+				retrieveError <- &storageErrors.ScanningPSQLError{Err: err}
+				return
+			}
+			domains = append(domains, domain)
+		}
+		err = rows.Err()
+		if err != nil {
+			retrieveError <- &storageErrors.ScanningPSQLError{Err: err}
+			return
+		}
+		retrieveDone <- domains
+	}()
+
+	// wait for the first channel to retrieve a value
+	select {
+	case <-ctx.Done():
+		s.logger(ctx).Warn("Retrieving domains by user ID", logger.Error(ctx.Err()))
+		return nil, &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
+	case rtrvError := <-retrieveError:
+		s.logger(ctx).Warn("Retrieving domains by user ID", logger.Error(rtrvError))
+		return nil, rtrvError
+	case domains := <-retrieveDone:
+		s.logger(ctx).Debug("Retrieving domains by user ID", logger.Int("count", len(domains)))
+		return domains, nil
+	}
+}
+
+// RetrieveVerifiedDomains returns names of all verified custom domains sorted by name.
+func (s *Storage) RetrieveVerifiedDomains(ctx context.Context) (names []string, err error) {
+	// create channels for listening to the go routine result
+	retrieveDone := make(chan []string, 1)
+	retrieveError := make(chan error, 1)
+	go func() {
+		rows, err := s.stmts.selectVerified.QueryContext(ctx)
+		if err != nil {
+			retrieveError <- &storageErrors.ExecutionPSQLError{Err: err}
+			return
+		}
+		defer rows.Close()
+		var names []string
+		for rows.Next() {
+			var name string
+			err = rows.Scan(&name)
+			if err != nil {
+				retrieveError <- &storageErrors.ScanningPSQLError{Err: err}
+				return
+			}
+			names = append(names, name)
+		}
+		err = rows.Err()
+		if err != nil {
+			retrieveError <- &storageErrors.ScanningPSQLError{Err: err}
+			return
+		}
+		retrieveDone <- names
+	}()
+
+	// wait for the first channel to retrieve a value
+	select {
+	case <-ctx.Done():
+		s.logger(ctx).Warn("Retrieving verified domains", logger.Error(ctx.Err()))
+		return nil, &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
+	case rtrvError := <-retrieveError:
+		s.logger(ctx).Warn("Retrieving verified domains", logger.Error(rtrvError))
+		return nil, rtrvError
+	case names := <-retrieveDone:
+		s.logger(ctx).Debug("Retrieving verified domains", logger.Int("count", len(names)))
+		return names, nil
+	}
+}
+
+// DumpUserSettings stores settings of a user in DB replacing the previous ones.
+func (s *Storage) DumpUserSettings(ctx context.Context, entry modelstorage.UserSettingsEntry) error {
+	// create channels for listening to the go routine result
+	dumpDone := make(chan bool, 1)
+	dumpError := make(chan error, 1)
+	go func() {
+		var utm sql.NullString
+		if len(entry.UTM) > 0 {
+			encoded, err := json.Marshal(entry.UTM)
+			if err != nil {
+				dumpError <- err
+				return
+			}
+			utm = sql.NullString{String: string(encoded), Valid: true}
+		}
+		_, err := s.stmts.upsertSettings.ExecContext(ctx, entry.UserID, utm)
+		if err != nil {
+			dumpError <- &storageErrors.ExecutionPSQLError{Err: err}
+			return
+		}
+		dumpDone <- true
+	}()
+
+	// wait for the first channel to retrieve a value
+	select {
+	case <-ctx.Done():
+		s.logger(ctx).Warn("Dumping user settings", logger.Error(ctx.Err()))
+		return &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
+	case dmpError := <-dumpError:
+		s.logger(ctx).Warn("Dumping user settings", logger.Error(dmpError))
+		return dmpError
+	case <-dumpDone:
+		s.logger(ctx).Debug("Dumping user settings", logger.String("userID", entry.UserID))
+		return nil
+	}
+}
+
+// RetrieveUserSettings returns settings of userID, users who never changed them get an entry without settings.
+func (s *Storage) RetrieveUserSettings(ctx context.Context, userID string) (entry modelstorage.UserSettingsEntry, err error) {
+	// create channels for listening to the go routine result
+	retrieveDone := make(chan modelstorage.UserSettingsEntry, 1)
+	retrieveError := make(chan error, 1)
+	go func() {
+		settings := modelstorage.UserSettingsEntry{UserID: userID}
+		var utm sql.NullString
+		err := s.stmts.selectSettings.QueryRowContext(ctx, userID).Scan(&utm)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			retrieveError <- &storageErrors.ExecutionPSQLError{Err: err}
+			return
+		}
+		if utm.Valid {
+			err = json.Unmarshal([]byte(utm.String), &settings.UTM)
+			if err != nil {
+				retrieveError <- &storageErrors.ScanningPSQLError{Err: err}
+				return
+			}
+		}
+		retrieveDone <- settings
+	}()
+
+	// wait for the first channel to retrieve a value
+	select {
+	case <-ctx.Done():
+		s.logger(ctx).Warn("Retrieving user settings", logger.Error(ctx.Err()))
+		return modelstorage.UserSettingsEntry{}, &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
+	case rtrvError := <-retrieveError:
+		s.logger(ctx).Warn("Retrieving user settings", logger.Error(rtrvError))
+		return modelstorage.UserSettingsEntry{}, rtrvError
+	case settings := <-retrieveDone:
+		s.logger(ctx).Debug("Retrieving user settings", logger.String("userID", userID))
+		return settings, nil
+	}
+}
+
+// DumpOrg stores a new organization along with its first admin in one transaction.
+func (s *Storage) DumpOrg(ctx context.Context, entry modelstorage.OrgEntry, admin modelstorage.MemberEntry) error {
+	// create channels for listening to the go routine result
+	dumpDone := make(chan bool, 1)
+	dumpError := make(chan error, 1)
+	go func() {
+		tx, err := s.DB.BeginTx(ctx, nil)
+		if err != nil {
+			dumpError <- &storageErrors.ExecutionPSQLError{Err: err}
+			return
+		}
+		defer tx.Rollback()
+		_, err = tx.StmtContext(ctx, s.stmts.insertOrg).ExecContext(ctx, entry.ID, entry.Name, entry.CreatedAt)
+		if err != nil {
+			dumpError <- &storageErrors.ExecutionPSQLError{Err: err}
+			return
+		}
+		login := sql.NullString{String: admin.Login, Valid: admin.Login != ""}
+		_, err = tx.StmtContext(ctx, s.stmts.upsertMember).ExecContext(ctx, admin.OrgID, admin.UserID, login, admin.Role, admin.CreatedAt)
+		if err != nil {
+			dumpError <- &storageErrors.ExecutionPSQLError{Err: err}
+			return
+		}
+		err = tx.Commit()
+		if err != nil {
+			dumpError <- &storageErrors.ExecutionPSQLError{Err: err}
+			return
+		}
+		dumpDone <- true
+	}()
+
+	// wait for the first channel to retrieve a value
+	select {
+	case <-ctx.Done():
+		s.logger(ctx).Warn("Dumping organization", logger.Error(ctx.Err()))
+		return &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
+	case dmpError := <-dumpError:
+		s.logger(ctx).Warn("Dumping organization", logger.Error(dmpError))
+		return dmpError
+	case <-dumpDone:
+		s.logger(ctx).Debug("Dumping organization", logger.String("orgID", entry.ID))
+		return nil
+	}
+}
+
+// DumpMember stores a membership of a user in an existing organization, the role of a member is replaced keeping
+// their membership time.
+func (s *Storage) DumpMember(ctx context.Context, entry modelstorage.MemberEntry) error {
+	// create channels for listening to the go routine result
+	dumpDone := make(chan bool, 1)
+	dumpError := make(chan error, 1)
+	go func() {
+		login := sql.NullString{String: entry.Login, Valid: entry.Login != ""}
+		_, err := s.stmts.upsertMember.ExecContext(ctx, entry.OrgID, entry.UserID, login, entry.Role, entry.CreatedAt)
+		if err != nil {
+			if err, ok := err.(*pgconn.PgError); ok && err.Code == pgerrcode.ForeignKeyViolation && err.ConstraintName == orgMembersOrgConstraint {
+				dumpError <- &storageErrors.OrgNotFoundError{Err: err, ID: entry.OrgID}
+				return
+			}
+			dumpError <- &storageErrors.ExecutionPSQLError{Err: err}
+			return
+		}
+		dumpDone <- true
+	}()
+
+	// wait for the first channel to retrieve a value
+	select {
+	case <-ctx.Done():
+		s.logger(ctx).Warn("Dumping member", logger.Error(ctx.Err()))
+		return &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
+	case dmpError := <-dumpError:
+		s.logger(ctx).Warn("Dumping member", logger.Error(dmpError))
+		return dmpError
+	case <-dumpDone:
+		s.logger(ctx).Debug("Dumping member", logger.String("orgID", entry.OrgID), logger.String("userID", entry.UserID))
+		return nil
+	}
+}
+
+// DeleteMember removes userID from the organization orgID.
+func (s *Storage) DeleteMember(ctx context.Context, orgID, userID string) error {
+	// create channels for listening to the go routine result
+	deleteDone := make(chan bool, 1)
+	deleteError := make(chan error, 1)
+	go func() {
+		res, err := s.stmts.deleteMember.ExecContext(ctx, orgID, userID)
+		if err != nil {
+			deleteError <- &storageErrors.ExecutionPSQLError{Err: err}
+			return
+		}
+		affected, err := res.RowsAffected()
+		if err != nil {
+			deleteError <- &storageErrors.ExecutionPSQLError{Err: err}
+			return
+		}
+		if affected == 0 {
+			deleteError <- &storageErrors.MemberNotFoundError{Err: nil, OrgID: orgID, UserID: userID}
+			return
+		}
+		deleteDone <- true
+	}()
+
+	// wait for the first channel to retrieve a value
+	select {
+	case <-ctx.Done():
+		s.logger(ctx).Warn("Deleting member", logger.Error(ctx.Err()))
+		return &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
+	case dltError := <-deleteError:
+		s.logger(ctx).Warn("Deleting member", logger.Error(dltError))
+		return dltError
+	case <-deleteDone:
+		s.logger(ctx).Debug("Deleting member", logger.String("orgID", orgID), logger.String("userID", userID))
+		return nil
+	}
+}
+
+// RetrieveOrg returns the organization id.
+func (s *Storage) RetrieveOrg(ctx context.Context, id string) (entry modelstorage.OrgEntry, err error) {
+	// create channels for listening to the go routine result
+	retrieveDone := make(chan modelstorage.OrgEntry, 1)
+	retrieveError := make(chan error, 1)
+	go func() {
+		var org modelstorage.OrgEntry
+		err := s.stmts.selectOrg.QueryRowContext(ctx, id).Scan(&org.ID, &org.Name, &org.CreatedAt)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				retrieveError <- &storageErrors.OrgNotFoundError{Err: err, ID: id}
+				return
+			}
+			retrieveError <- &storageErrors.ExecutionPSQLError{Err: err}
+			return
+		}
+		retrieveDone <- org
+	}()
+
+	// wait for the first channel to retrieve a value
+	select {
+	case <-ctx.Done():
+		s.logger(ctx).Warn("Retrieving organization", logger.Error(ctx.Err()))
+		return modelstorage.OrgEntry{}, &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
+	case rtrvError := <-retrieveError:
+		s.logger(ctx).Warn("Retrieving organization", logger.Error(rtrvError))
+		return modelstorage.OrgEntry{}, rtrvError
+	case org := <-retrieveDone:
+		s.logger(ctx).Debug("Retrieving organization", logger.String("orgID", org.ID))
+		return org, nil
+	}
+}
+
+// RetrieveMembers returns members of the organization orgID sorted by membership time.
+func (s *Storage) RetrieveMembers(ctx context.Context, orgID string) (entries []modelstorage.MemberEntry, err error) {
+	// create channels for listening to the go routine result
+	retrieveDone := make(chan []modelstorage.MemberEntry, 1)
+	retrieveError := make(chan error, 1)
+	go func() {
+		members, err := queryMembers(ctx, s.stmts.selectMembers, orgID)
+		if err != nil {
+			retrieveError <- err
+			return
+		}
+		retrieveDone <- members
+	}()
+
+	// wait for the first channel to retrieve a value
+	select {
+	case <-ctx.Done():
+		s.logger(ctx).Warn("Retrieving members", logger.Error(ctx.Err()))
+		return nil, &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
+	case rtrvError := <-retrieveError:
+		s.logger(ctx).Warn("Retrieving members", logger.Error(rtrvError))
+		return nil, rtrvError
+	case members := <-retrieveDone:
+		s.logger(ctx).Debug("Retrieving members", logger.String("orgID", orgID), logger.Int("count", len(members)))
+		return members, nil
+	}
+}
+
+// RetrieveMembershipsByUserID returns memberships of userID in organizations sorted by membership time.
+func (s *Storage) RetrieveMembershipsByUserID(ctx context.Context, userID string) (entries []modelstorage.MemberEntry, err error) {
+	// create channels for listening to the go routine result
+	retrieveDone := make(chan []modelstorage.MemberEntry, 1)
+	retrieveError := make(chan error, 1)
+	go func() {
+		memberships, err := queryMembers(ctx, s.stmts.selectMemberships, userID)
+		if err != nil {
+			retrieveError <- err
+			return
+		}
+		retrieveDone <- memberships
+	}()
+
+	// wait for the first channel to retrieve a value
+	select {
+	case <-ctx.Done():
+		s.logger(ctx).Warn("Retrieving memberships by user ID", logger.Error(ctx.Err()))
+		return nil, &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
+	case rtrvError := <-retrieveError:
+		s.logger(ctx).Warn("Retrieving memberships by user ID", logger.Error(rtrvError))
+		return nil, rtrvError
+	case memberships := <-retrieveDone:
+		s.logger(ctx).Debug("Retrieving memberships by user ID", logger.Int("count", len(memberships)))
+		return memberships, nil
+	}
+}
+
+// DumpAudit stores records of mutating operations within one transaction.
+func (s *Storage) DumpAudit(ctx context.Context, entries []modelstorage.AuditEntry) error {
+	// create channels for listening to the go routine result
+	dumpDone := make(chan bool, 1)
+	dumpError := make(chan error, 1)
+	go func() {
+		tx, err := s.DB.BeginTx(ctx, nil)
+		if err != nil {
+			dumpError <- &storageErrors.ExecutionPSQLError{Err: err}
+			return
+		}
+		defer tx.Rollback()
+		stmt := tx.StmtContext(ctx, s.stmts.insertAudit)
+		for _, entry := range entries {
+			before := sql.NullString{String: string(entry.Before), Valid: len(entry.Before) > 0}
+			after := sql.NullString{String: string(entry.After), Valid: len(entry.After) > 0}
+			_, err = stmt.ExecContext(ctx, entry.ID, entry.Actor, entry.Action, entry.Entity, entry.EntityID, before, after, entry.CreatedAt)
+			if err != nil {
+				dumpError <- &storageErrors.ExecutionPSQLError{Err: err}
+				return
+			}
+		}
+		err = tx.Commit()
+		if err != nil {
+			dumpError <- &storageErrors.ExecutionPSQLError{Err: err}
+			return
+		}
+		dumpDone <- true
+	}()
+
+	// wait for the first channel to retrieve a value
+	select {
+	case <-ctx.Done():
+		s.logger(ctx).Warn("Dumping audit records", logger.Error(ctx.Err()))
+		return &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
+	case dmpError := <-dumpError:
+		s.logger(ctx).Warn("Dumping audit records", logger.Error(dmpError))
+		return dmpError
+	case <-dumpDone:
+		s.logger(ctx).Debug("Dumping audit records", logger.Int("count", len(entries)))
+		return nil
+	}
+}
+
+// RetrieveAudit returns a page of audit records matching filter sorted by creation time.
+func (s *Storage) RetrieveAudit(ctx context.Context, filter modelurl.AuditFilter, opts modelurl.ListOptions) (entries []modelstorage.AuditEntry, err error) {
+	// create channels for listening to the go routine result
+	retrieveDone := make(chan []modelstorage.AuditEntry, 1)
+	retrieveError := make(chan error, 1)
+	go func() {
+		stmt := s.stmts.selectAuditAsc
+		if opts.Desc {
+			stmt = s.stmts.selectAuditDesc
+		}
+		var since, until sql.NullTime
+		if filter.Since != nil {
+			since = sql.NullTime{Time: *filter.Since, Valid: true}
+		}
+		if filter.Until != nil {
+			until = sql.NullTime{Time: *filter.Until, Valid: true}
+		}
+		limit := sql.NullInt64{Int64: int64(opts.Limit), Valid: opts.Limit > 0}
+		rows, err := stmt.QueryContext(ctx, filter.Actor, filter.Action, filter.Entity, filter.EntityID, since, until, limit, opts.Offset)
+		if err != nil {
+			retrieveError <- &storageErrors.ExecutionPSQLError{Err: err}
+			return
+		}
+		defer rows.Close()
+		var entries []modelstorage.AuditEntry
+		for rows.Next() {
+			var entry modelstorage.AuditEntry
+			var before, after sql.NullString
+			err = rows.Scan(&entry.ID, &entry.Actor, &entry.Action, &entry.Entity, &entry.EntityID, &before, &after, &entry.CreatedAt)
+			if err != nil {
+				retrieveError <- &storageErrors.ScanningPSQLError{Err: err}
+				return
+			}
+			if before.Valid {
+				entry.Before = json.RawMessage(before.String)
+			}
+			if after.Valid {
+				entry.After = json.RawMessage(after.String)
+			}
+			entries = append(entries, entry)
+		}
+		err = rows.Err()
+		if err != nil {
+			retrieveError <- &storageErrors.ScanningPSQLError{Err: err}
+			return
+		}
+		retrieveDone <- entries
+	}()
+
+	// wait for the first channel to retrieve a value
+	select {
+	case <-ctx.Done():
+		s.logger(ctx).Warn("Retrieving audit records", logger.Error(ctx.Err()))
+		return nil, &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
+	case rtrvError := <-retrieveError:
+		s.logger(ctx).Warn("Retrieving audit records", logger.Error(rtrvError))
+		return nil, rtrvError
+	case entries := <-retrieveDone:
+		s.logger(ctx).Debug("Retrieving audit records", logger.Int("count", len(entries)))
+		return entries, nil
+	}
+}
+
+// queryMembers runs stmt selecting memberColumns of the organization or the user id.
+func queryMembers(ctx context.Context, stmt *sql.Stmt, id string) ([]modelstorage.MemberEntry, error) {
+	rows, err := stmt.QueryContext(ctx, id)
+	if err != nil {
+		return nil, &storageErrors.ExecutionPSQLError{Err: err}
+	}
+	defer rows.Close()
+	var members []modelstorage.MemberEntry
+	for rows.Next() {
+		var member modelstorage.MemberEntry
+		var login sql.NullString
+		err = rows.Scan(&member.OrgID, &member.UserID, &login, &member.Role, &member.CreatedAt)
+		if err != nil {
+			return nil, &storageErrors.ScanningPSQLError{Err: err}
+		}
+		member.Login = login.String
+		members = append(members, member)
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, &storageErrors.ScanningPSQLError{Err: err}
+	}
+	return members, nil
+}
+
+// scanner is implemented by *sql.Row and *sql.Rows.
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanAPIKey scans a row selected with apiKeyColumns.
+func scanAPIKey(row scanner) (entry modelstorage.APIKeyEntry, err error) {
+	var revokedAt sql.NullTime
+	err = row.Scan(&entry.ID, &entry.UserID, &entry.Name, &entry.Prefix, &entry.Hash, &entry.CreatedAt, &revokedAt)
+	if err != nil {
+		return modelstorage.APIKeyEntry{}, err
+	}
+	if revokedAt.Valid {
+		entry.RevokedAt = &revokedAt.Time
+	}
+	return entry, nil
+}
+
+// claimedSince returns the time domain claims pending verification expire if made before.
+func (s *Storage) claimedSince() time.Time {
+	return time.Now().Add(-s.Cfg.DomainClaimTTL)
+}
+
+// scanDomain scans a row selected with domainColumns.
+func scanDomain(row scanner) (entry modelstorage.DomainEntry, err error) {
+	var verifiedAt sql.NullTime
+	err = row.Scan(&entry.Name, &entry.UserID, &entry.Token, &entry.CreatedAt, &verifiedAt)
+	if err != nil {
+		return modelstorage.DomainEntry{}, err
+	}
+	if verifiedAt.Valid {
+		entry.VerifiedAt = &verifiedAt.Time
+	}
+	return entry, nil
+}
+
+// logger returns a request-scoped logger carried by ctx or the storage one.
+func (s *Storage) logger(ctx context.Context) *logger.Logger {
+	return logger.FromContext(ctx, s.log)
+}
+
+// PingDB performs DB ping.
 func (s *Storage) PingDB() error {
 	return s.DB.Ping()
 }
 
 // CloseDB performs DB closure.
 func (s *Storage) CloseDB() error {
+	s.closeStatements()
 	return s.DB.Close()
 }
 
-// createTable creates a table for PSQL DB storage if not exist.
-func (s *Storage) createTable(ctx context.Context) error {
-	// store user_id as text since we store encoded tokens
-	query := `CREATE TABLE IF NOT EXISTS urls (
-		id bigserial not null,
-		user_id text not null,
-		url text not null unique,
-		short_url text not null,
-		is_deleted boolean not null DEFAULT false 
-	);`
-	_, err := s.DB.ExecContext(ctx, query)
-	return err
+// prepareStatements prepares all statements used by the storage once, so that calls do not pay for an extra
+// round-trip to prepare their queries.
+func (s *Storage) prepareStatements(ctx context.Context) error {
+	queries := []struct {
+		stmt  **sql.Stmt
+		query string
+	}{
+		{&s.stmts.selectBySURL, selectBySURLQuery},
+		{&s.stmts.selectOwner, selectOwnerQuery},
+		{&s.stmts.selectByUserIDAsc, selectByUserIDAscQuery},
+		{&s.stmts.selectByUserIDDesc, selectByUserIDDescQuery},
+		{&s.stmts.selectByOrgIDAsc, selectByOrgIDAscQuery},
+		{&s.stmts.selectByOrgIDDesc, selectByOrgIDDescQuery},
+		{&s.stmts.searchURLsAsc, searchURLsAscQuery},
+		{&s.stmts.searchURLsDesc, searchURLsDescQuery},
+		{&s.stmts.searchByUserID, searchByUserIDQuery},
+		{&s.stmts.selectSURLByURL, selectSURLByURLQuery},
+		{&s.stmts.insertURL, insertURLQuery},
+		{&s.stmts.insertURLBatch, insertURLBatchQuery},
+		{&s.stmts.updateMetadata, updateMetadataQuery},
+		{&s.stmts.updateURL, updateURLQuery},
+		{&s.stmts.selectTags, selectTagsQuery},
+		{&s.stmts.takeClick, takeClickQuery},
+		{&s.stmts.deleteBatch, deleteBatchQuery},
+		{&s.stmts.insertPending, insertPendingQuery},
+		{&s.stmts.deletePending, deletePendingQuery},
+		{&s.stmts.restoreBatch, restoreBatchQuery},
+		{&s.stmts.disableBatch, disableBatchQuery},
+		{&s.stmts.insertClick, insertClickQuery},
+		{&s.stmts.touchURLs, touchURLsQuery},
+		{&s.stmts.rollupClicks, rollupClicksQuery},
+		{&s.stmts.existsSURL, existsSURLQuery},
+		{&s.stmts.selectDailyClicks, selectDailyClicksQuery},
+		{&s.stmts.selectServedClicks, selectServedClicksQuery},
+		{&s.stmts.selectReferrers, selectReferrersQuery},
+		{&s.stmts.selectDirectClicks, selectDirectClicksQuery},
+		{&s.stmts.selectCountries, selectCountriesQuery},
+		{&s.stmts.selectVisitors, selectVisitorsQuery},
+		{&s.stmts.insertVisitors, insertVisitorsQuery},
+		{&s.stmts.lockVisitors, lockVisitorsQuery},
+		{&s.stmts.updateVisitors, updateVisitorsQuery},
+		{&s.stmts.selectHourlyRollup, selectHourlyRollupsQuery},
+		{&s.stmts.selectDailyRollup, selectDailyRollupsQuery},
+		{&s.stmts.selectServiceStats, selectServiceStatsQuery},
+		{&s.stmts.insertUser, insertUserQuery},
+		{&s.stmts.updateUserRole, updateUserRoleQuery},
+		{&s.stmts.selectUser, selectUserQuery},
+		{&s.stmts.selectUsersAsc, selectUsersAscQuery},
+		{&s.stmts.selectUsersDesc, selectUsersDescQuery},
+		{&s.stmts.selectUsersByID, selectUsersByIDQuery},
+		{&s.stmts.selectUserStats, selectUserStatsQuery},
+		{&s.stmts.insertAPIKey, insertAPIKeyQuery},
+		{&s.stmts.selectAPIKey, selectAPIKeyQuery},
+		{&s.stmts.selectAPIKeys, selectAPIKeysQuery},
+		{&s.stmts.revokeAPIKey, revokeAPIKeyQuery},
+		{&s.stmts.insertDomain, insertDomainQuery},
+		{&s.stmts.purgeDomainClaims, purgeDomainClaimsQuery},
+		{&s.stmts.verifyDomain, verifyDomainQuery},
+		{&s.stmts.dropDomainClaims, dropDomainClaimsQuery},
+		{&s.stmts.selectDomain, selectDomainQuery},
+		{&s.stmts.selectDomainClaim, selectDomainClaimQuery},
+		{&s.stmts.selectDomains, selectDomainsQuery},
+		{&s.stmts.selectVerified, selectVerifiedQuery},
+		{&s.stmts.upsertSettings, upsertSettingsQuery},
+		{&s.stmts.selectSettings, selectSettingsQuery},
+		{&s.stmts.insertOrg, insertOrgQuery},
+		{&s.stmts.selectOrg, selectOrgQuery},
+		{&s.stmts.upsertMember, upsertMemberQuery},
+		{&s.stmts.deleteMember, deleteMemberQuery},
+		{&s.stmts.selectMembers, selectMembersQuery},
+		{&s.stmts.selectMemberships, selectMembershipsQuery},
+		{&s.stmts.insertAudit, insertAuditQuery},
+		{&s.stmts.selectAuditAsc, selectAuditAscQuery},
+		{&s.stmts.selectAuditDesc, selectAuditDescQuery},
+	}
+	for _, q := range queries {
+		stmt, err := s.DB.PrepareContext(ctx, q.query)
+		if err != nil {
+			return &storageErrors.StatementPSQLError{Err: err}
+		}
+		*q.stmt = stmt
+	}
+	return nil
+}
+
+// closeStatements closes all prepared statements, statements which were not prepared are skipped.
+func (s *Storage) closeStatements() {
+	for _, stmt := range []*sql.Stmt{
+		s.stmts.selectBySURL,
+		s.stmts.selectOwner,
+		s.stmts.selectByUserIDAsc,
+		s.stmts.selectByUserIDDesc,
+		s.stmts.selectByOrgIDAsc,
+		s.stmts.selectByOrgIDDesc,
+		s.stmts.searchURLsAsc,
+		s.stmts.searchURLsDesc,
+		s.stmts.searchByUserID,
+		s.stmts.selectSURLByURL,
+		s.stmts.insertURL,
+		s.stmts.insertURLBatch,
+		s.stmts.updateMetadata,
+		s.stmts.updateURL,
+		s.stmts.selectTags,
+		s.stmts.takeClick,
+		s.stmts.deleteBatch,
+		s.stmts.insertPending,
+		s.stmts.deletePending,
+		s.stmts.restoreBatch,
+		s.stmts.disableBatch,
+		s.stmts.insertClick,
+		s.stmts.touchURLs,
+		s.stmts.rollupClicks,
+		s.stmts.existsSURL,
+		s.stmts.selectDailyClicks,
+		s.stmts.selectServedClicks,
+		s.stmts.selectReferrers,
+		s.stmts.selectDirectClicks,
+		s.stmts.selectCountries,
+		s.stmts.selectVisitors,
+		s.stmts.insertVisitors,
+		s.stmts.lockVisitors,
+		s.stmts.updateVisitors,
+		s.stmts.selectHourlyRollup,
+		s.stmts.selectDailyRollup,
+		s.stmts.selectServiceStats,
+		s.stmts.insertUser,
+		s.stmts.updateUserRole,
+		s.stmts.selectUser,
+		s.stmts.selectUsersAsc,
+		s.stmts.selectUsersDesc,
+		s.stmts.selectUsersByID,
+		s.stmts.selectUserStats,
+		s.stmts.insertAPIKey,
+		s.stmts.selectAPIKey,
+		s.stmts.selectAPIKeys,
+		s.stmts.revokeAPIKey,
+		s.stmts.insertDomain,
+		s.stmts.purgeDomainClaims,
+		s.stmts.verifyDomain,
+		s.stmts.dropDomainClaims,
+		s.stmts.selectDomain,
+		s.stmts.selectDomainClaim,
+		s.stmts.selectDomains,
+		s.stmts.selectVerified,
+		s.stmts.upsertSettings,
+		s.stmts.selectSettings,
+		s.stmts.insertOrg,
+		s.stmts.selectOrg,
+		s.stmts.upsertMember,
+		s.stmts.deleteMember,
+		s.stmts.selectMembers,
+		s.stmts.selectMemberships,
+		s.stmts.insertAudit,
+		s.stmts.selectAuditAsc,
+		s.stmts.selectAuditDesc,
+	} {
+		if stmt != nil {
+			stmt.Close()
+		}
+	}
 }
@@ -0,0 +1,131 @@
+package inpsql
+
+import (
+	"context"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/config"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/service/modelurl"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/storage/v2/modelstorage"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"sync"
+	"testing"
+)
+
+// initTestStorage initializes a Storage with one stored entry, tests and benchmarks are skipped unless DATABASE_DSN
+// points to a PSQL DB.
+func initTestStorage(b testing.TB) (st *Storage, sURL string, cleanup func()) {
+	dsn := os.Getenv("DATABASE_DSN")
+	if dsn == "" {
+		b.Skip("DATABASE_DSN is not set")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	wg := &sync.WaitGroup{}
+	wg.Add(1)
+	cfg, err := config.NewStorageConfig()
+	if err != nil {
+		b.Fatal(err)
+	}
+	cfg.DatabaseDSN = dsn
+	st, err = InitStorage(ctx, wg, cfg, nil)
+	if err != nil {
+		b.Fatal(err)
+	}
+	sURL = "bench-" + uuid.New().String()[:8]
+	entry := modelstorage.URLStorageEntry{SURL: sURL, URL: "https://www.example.com/" + sURL, UserID: "benchmark"}
+	err = st.Dump(ctx, entry)
+	if err != nil {
+		b.Fatal(err)
+	}
+	return st, sURL, func() {
+		cancel()
+		wg.Wait()
+	}
+}
+
+// BenchmarkRetrievePrepareOnEveryCall measures the previous retrieve path: prepare, query and close the statement
+// on every call.
+func BenchmarkRetrievePrepareOnEveryCall(b *testing.B) {
+	st, sURL, cleanup := initTestStorage(b)
+	defer cleanup()
+	ctx := context.Background()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		stmt, err := st.DB.PrepareContext(ctx, selectBySURLQuery)
+		if err != nil {
+			b.Fatal(err)
+		}
+		var entry modelstorage.URLPostgresEntry
+		err = stmt.QueryRowContext(ctx, sURL).Scan(&entry.ID, &entry.UserID, &entry.URL, &entry.SURL, &entry.IsDeleted, &entry.ExpiresAt)
+		stmt.Close()
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkRetrieveCachedStatement measures the current retrieve path reusing a statement prepared at InitStorage.
+func BenchmarkRetrieveCachedStatement(b *testing.B) {
+	st, sURL, cleanup := initTestStorage(b)
+	defer cleanup()
+	ctx := context.Background()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var entry modelstorage.URLPostgresEntry
+		err := st.stmts.selectBySURL.QueryRowContext(ctx, sURL).Scan(&entry.ID, &entry.UserID, &entry.URL, &entry.SURL, &entry.IsDeleted, &entry.ExpiresAt)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkRetrieve measures Storage.Retrieve end to end.
+func BenchmarkRetrieve(b *testing.B) {
+	st, sURL, cleanup := initTestStorage(b)
+	defer cleanup()
+	ctx := context.Background()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, err := st.Retrieve(ctx, sURL)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// TestEraseUser checks that erasing a user leaves no queued or failed deletions of the user and no audit states of
+// the links of the user.
+func TestEraseUser(t *testing.T) {
+	st, sURL, cleanup := initTestStorage(t)
+	defer cleanup()
+	ctx := context.Background()
+	userID := "benchmark"
+	_, err := st.DB.ExecContext(ctx, "INSERT INTO pending_deletions (user_id, short_url) VALUES ($1, $2)", userID, sURL)
+	require.NoError(t, err)
+	_, err = st.DB.ExecContext(ctx, "INSERT INTO deletion_dead_letters (user_id, short_url, error, attempts) VALUES ($1, $2, 'failed', 1)", userID, sURL)
+	require.NoError(t, err)
+	state := modelstorage.AuditedURL{URL: "https://www.example.com/" + sURL}
+	byOther, err := modelstorage.NewAuditEntry("other", modelurl.AuditUpdate, modelurl.AuditEntityURL, sURL, state, state)
+	require.NoError(t, err)
+	unrelated, err := modelstorage.NewAuditEntry("other", modelurl.AuditUpdate, modelurl.AuditEntityURL, "other-"+sURL, state, state)
+	require.NoError(t, err)
+	require.NoError(t, st.DumpAudit(ctx, []modelstorage.AuditEntry{byOther, unrelated}))
+
+	require.NoError(t, st.EraseUser(ctx, userID))
+	for _, table := range []string{"pending_deletions", "deletion_dead_letters"} {
+		var count int
+		err = st.DB.QueryRowContext(ctx, "SELECT count(*) FROM "+table+" WHERE user_id = $1", userID).Scan(&count)
+		require.NoError(t, err)
+		assert.Zero(t, count, table)
+	}
+	var before, after []byte
+	err = st.DB.QueryRowContext(ctx, "SELECT before, after FROM audit_log WHERE id = $1", byOther.ID).Scan(&before, &after)
+	require.NoError(t, err)
+	assert.Nil(t, before)
+	assert.Nil(t, after)
+	err = st.DB.QueryRowContext(ctx, "SELECT before, after FROM audit_log WHERE id = $1", unrelated.ID).Scan(&before, &after)
+	require.NoError(t, err)
+	assert.NotNil(t, before)
+	assert.NotNil(t, after)
+}
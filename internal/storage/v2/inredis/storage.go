@@ -0,0 +1,3711 @@
+// Package inredis provides functionality for dumping/retrieving pairs of URL and sURL to/from Redis.
+package inredis
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/config"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/logger"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/service/modelurl"
+	storageErrors "github.com/danilovkiri/dk_go_url_shortener/internal/storage/v2/errors"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/storage/v2/modelstorage"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/storage/v2/workers"
+	"github.com/go-redis/redis/v8"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Redis key layout:
+//
+//	url:<sURL>       hash with url, user_id, is_deleted, created_at (unix nanoseconds) and optional expires_at (unix seconds),
+//	                 disabled_at and active_from (unix seconds), redirect_type, password_hash, max_clicks,
+//	                 click_count, destinations, geo_targets, device_targets and utm (JSON-encoded), sticky, domain,
+//	                 org_id, title, favicon_url, tags (JSON-encoded, sorted), last_accessed_at (unix nanoseconds),
+//	                 archived_at and archive_noticed_at (unix seconds) and edited_at (unix nanoseconds) fields
+//	user:<userID>    set of sURLs created by the user
+//	orgurls:<orgID>  set of sURLs of the organization
+//	original:<URL>   sURL the original URL was shortened to, guards URL uniqueness
+//	expiring         sorted set of expiring sURLs scored by their expiration time (unix seconds)
+//	deleted          sorted set of deleted sURLs scored by their deletion time (unix seconds)
+//	deleting         set of JSON-encoded deletions accepted from users and not performed yet
+//	clicks:<sURL>    stream of redirect records with clicked_at, referrer, user_agent, destination, country and bot
+//	                 fields, trimmed to about ClicksStreamMaxLen latest records
+//	daily:<sURL>     hash of redirect counts per day (YYYY-MM-DD in UTC), redirects of bots are counted apart by
+//	                 fields prefixed with bot: in this and the hourly, served, referrers and countries hashes
+//	hourly:<sURL>    hash of redirect counts per hour (YYYY-MM-DDTHH in UTC)
+//	visitors:<sURL>:<day>
+//	                 HyperLogLog of visitors redirected within the day (YYYY-MM-DD in UTC), days are listed by daily:<sURL>
+//	served:<sURL>    hash of redirect counts per served destination URL
+//	referrers:<sURL> hash of redirect counts per referrer domain, the empty one counting direct redirects
+//	countries:<sURL> hash of redirect counts per visitor country code, the empty one counting unresolved countries
+//	edits:<sURL>     list of JSON-encoded destination changes in the order they were made
+//	account:<login>  JSON-encoded user account
+//	apikey:<hash>    JSON-encoded API key
+//	apikeys:<userID> hash of API key hashes by API key IDs of the user
+//	domain:<name>    JSON-encoded verified custom domain
+//	claim:<name>:<userID>
+//	                 JSON-encoded claim of a custom domain by the user pending verification, it expires after
+//	                 DomainClaimTTL
+//	domains:<userID> set of custom domain names verified or claimed by the user
+//	settings:<userID>
+//	                 JSON-encoded user settings
+//	org:<orgID>      JSON-encoded organization
+//	members:<orgID>  hash of JSON-encoded memberships of the organization by user IDs
+//	orgs:<userID>    set of IDs of organizations the user is a member of
+//	audit            list of JSON-encoded audit records in the order they were recorded
+const (
+	urlKeyPrefix       = "url:"
+	userKeyPrefix      = "user:"
+	originalKeyPrefix  = "original:"
+	expiringKey        = "expiring"
+	deletedKey         = "deleted"
+	deletingKey        = "deleting"
+	clicksKeyPrefix    = "clicks:"
+	dailyKeyPrefix     = "daily:"
+	hourlyKeyPrefix    = "hourly:"
+	visitorsKeyPrefix  = "visitors:"
+	servedKeyPrefix    = "served:"
+	referrersKeyPrefix = "referrers:"
+	countriesKeyPrefix = "countries:"
+	editsKeyPrefix     = "edits:"
+	accountKeyPrefix   = "account:"
+	apiKeyKeyPrefix    = "apikey:"
+	apiKeysKeyPrefix   = "apikeys:"
+	domainKeyPrefix    = "domain:"
+	claimKeyPrefix     = "claim:"
+	domainsKeyPrefix   = "domains:"
+	settingsKeyPrefix  = "settings:"
+	orgKeyPrefix       = "org:"
+	orgURLsKeyPrefix   = "orgurls:"
+	membersKeyPrefix   = "members:"
+	orgsKeyPrefix      = "orgs:"
+	auditKey           = "audit"
+)
+
+// click writer parameters
+const (
+	clickQueueSize     = 1000
+	clickFlushInterval = time.Second * 5
+	clickFlushAmount   = 100
+)
+
+// scanCount hints the number of elements returned by one SCAN or SSCAN call.
+const scanCount = 500
+
+// takeClickScript counts a redirect of a link limited to a number of clicks atomically. It returns 1 when the redirect
+// is allowed, 0 when the entry does not exist and -1 when its limit is reached, links without a limit are not counted.
+var takeClickScript = redis.NewScript(`
+local fields = redis.call('HMGET', KEYS[1], 'url', 'max_clicks', 'click_count')
+if not fields[1] then
+	return 0
+end
+local limit = tonumber(fields[2] or '0')
+if limit == 0 then
+	return 1
+end
+if tonumber(fields[3] or '0') >= limit then
+	return -1
+end
+redis.call('HINCRBY', KEYS[1], 'click_count', 1)
+return 1
+`)
+
+// touchScript moves the last access time of a link forward to ARGV[1] (unix nanoseconds) and unarchives it, flushes
+// of concurrent instances never move it back and entries removed meanwhile are not recreated.
+var touchScript = redis.NewScript(`
+if redis.call('EXISTS', KEYS[1]) == 0 then
+	return 0
+end
+redis.call('HDEL', KEYS[1], 'archived_at', 'archive_noticed_at')
+local last = tonumber(redis.call('HGET', KEYS[1], 'last_accessed_at') or '0')
+if tonumber(ARGV[1]) <= last then
+	return 0
+end
+redis.call('HSET', KEYS[1], 'last_accessed_at', ARGV[1])
+return 1
+`)
+
+// Storage struct defines data structure handling and provides support for adding new implementations.
+type Storage struct {
+	// pending counts items sent to the deletion task queue and not yet flushed, keep it first for 64-bit alignment
+	pending int64
+	Cfg     *config.StorageConfig
+	DB      *redis.Client
+	ch      chan modelstorage.URLChannelEntry
+	// queueCtx is done once the deletion task queue stops accepting items on shutdown
+	queueCtx context.Context
+	clickCh  chan modelstorage.ClickEntry
+	log      *logger.Logger
+	// deleteWorkers perform batches coalesced from ch, their number can be changed while running
+	deleteWorkers *workers.Pool
+	// Events reports entries deleted by users, purged on expiration and disabled
+	modelstorage.Events
+}
+
+// InitStorage initializes a Storage object and sets its attributes.
+func InitStorage(ctx context.Context, wg *sync.WaitGroup, cfg *config.StorageConfig, log *logger.Logger) (*Storage, error) {
+	opts, err := redis.ParseURL(cfg.RedisDSN)
+	if err != nil {
+		return nil, err
+	}
+	db := redis.NewClient(opts)
+	err = db.Ping(ctx).Err()
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	// make a channel for tunneling batches for deletion from processor to DB
+	recordCh := make(chan modelstorage.URLChannelEntry, cfg.DeleteQueueSize)
+	st := Storage{
+		Cfg:      cfg,
+		DB:       db,
+		ch:       recordCh,
+		queueCtx: ctx,
+		clickCh:  make(chan modelstorage.ClickEntry, clickQueueSize),
+		log:      log,
+	}
+	pending, err := st.retrievePending(ctx)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	// use a separate context for flushing since ctx is already cancelled at the final flush
+	ctxFlush, cancelFlush := context.WithCancel(context.Background())
+	// coalesce the deletion task queue into per-user batches performed by delete workers, workers outlive ctx until
+	// the last batches are performed and only return earlier when the pool shrinks
+	batches := make(chan workers.Batch, cfg.DeleteWorkers)
+	go workers.Coalesce(ctx, recordCh, batches, cfg.DeleteBatchSize, cfg.DeleteFlushInterval)
+	st.deleteWorkers = workers.NewPool(ctxFlush, cfg.DeleteWorkers, func(ctx context.Context) {
+		st.runDeleteWorker(ctx, ctxFlush, batches)
+	})
+	// requeue deletions left pending by the previous run, they may exceed the queue capacity
+	if len(pending) > 0 {
+		st.log.Info("Requeueing pending deletions", logger.Int("count", len(pending)))
+		atomic.AddInt64(&st.pending, int64(len(pending)))
+		go func() {
+			for i, item := range pending {
+				select {
+				case <-ctx.Done():
+					// the rest stays pending until the next start
+					atomic.AddInt64(&st.pending, -int64(len(pending)-i))
+					return
+				case st.ch <- item:
+				}
+			}
+		}()
+	}
+	// start a goroutine buffering redirect records, purging expired entries and listening for ctx cancellation
+	// followed by DB closure, use sync.WaitGroup to prevent premature termination when main exits
+	go func() {
+		defer wg.Done()
+		defer cancelFlush()
+		purgeTicker := time.NewTicker(cfg.ExpiredPurgeInterval)
+		defer purgeTicker.Stop()
+		deletedPurgeTicker := time.NewTicker(cfg.DeletedPurgeInterval)
+		defer deletedPurgeTicker.Stop()
+		clickTicker := time.NewTicker(clickFlushInterval)
+		defer clickTicker.Stop()
+		// stale links are archived only when enabled
+		var staleTicker <-chan time.Time
+		if cfg.StaleAfter > 0 {
+			t := time.NewTicker(cfg.StaleArchiveInterval)
+			defer t.Stop()
+			staleTicker = t.C
+		}
+		clicks := make([]modelstorage.ClickEntry, 0, clickFlushAmount)
+		for {
+			select {
+			case <-ctx.Done():
+				if len(clicks) > 0 {
+					err := st.flushClicks(ctxFlush, clicks)
+					if err != nil {
+						st.log.Error("Recording clicks", logger.Error(err))
+					}
+				}
+				// let delete workers perform the last batches before closing DB
+				st.deleteWorkers.Wait()
+				err := st.DB.Close()
+				if err != nil {
+					st.log.Error("Closing Redis DB connection", logger.Error(err))
+					return
+				}
+				st.log.Info("Redis DB connection closed successfully")
+				return
+			case <-clickTicker.C:
+				if len(clicks) > 0 {
+					err := st.flushClicks(ctxFlush, clicks)
+					if err != nil {
+						st.log.Error("Recording clicks", logger.Error(err))
+					}
+					clicks = make([]modelstorage.ClickEntry, 0, clickFlushAmount)
+				}
+			case click := <-st.clickCh:
+				clicks = append(clicks, click)
+				if len(clicks) >= clickFlushAmount {
+					err := st.flushClicks(ctxFlush, clicks)
+					if err != nil {
+						st.log.Error("Recording clicks", logger.Error(err))
+					}
+					clicks = make([]modelstorage.ClickEntry, 0, clickFlushAmount)
+				}
+			case <-purgeTicker.C:
+				err := st.purgeExpired(ctxFlush)
+				if err != nil {
+					st.log.Error("Purging expired URLs", logger.Error(err))
+				}
+			case <-deletedPurgeTicker.C:
+				err := st.purgeDeleted(ctxFlush, cfg.DeletedRetention)
+				if err != nil {
+					st.log.Error("Purging deleted URLs", logger.Error(err))
+				}
+			case <-staleTicker:
+				err := st.archiveStale(ctxFlush, modelstorage.ArchivePolicy{StaleAfter: cfg.StaleAfter, NoticeBefore: cfg.StaleNoticeBefore})
+				if err != nil {
+					st.log.Error("Archiving stale URLs", logger.Error(err))
+				}
+			}
+		}
+	}()
+	return &st, nil
+}
+
+// runDeleteWorker performs batches coalesced from the deletion task queue until batches is closed or ctx is done,
+// deleting uses ctxFlush which outlives ctx.
+func (s *Storage) runDeleteWorker(ctx, ctxFlush context.Context, batches <-chan workers.Batch) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case batch, ok := <-batches:
+			if !ok {
+				return
+			}
+			s.log.Info("Deleting URLs", logger.String("userID", batch.UserID), logger.Int("count", len(batch.SURLs)))
+			err := s.DeleteBatch(ctxFlush, batch.SURLs, batch.UserID)
+			if err != nil {
+				s.log.Error("Deleting URLs", logger.Error(err))
+			}
+			atomic.AddInt64(&s.pending, -int64(len(batch.SURLs)))
+		}
+	}
+}
+
+// SetDeleteWorkers starts or stops delete workers so that n of them perform coalesced deletion batches, stopped
+// workers finish the batch they perform first.
+func (s *Storage) SetDeleteWorkers(n int) {
+	s.deleteWorkers.Resize(n)
+}
+
+// SendToQueue persists items in the deleting set and sends them to the deletion task queue, items which are not deleted
+// by the time the process stops are sent again at the next start. It returns storageErrors.QueueClosedError once the
+// queue stops accepting items on shutdown.
+func (s *Storage) SendToQueue(ctx context.Context, items []modelstorage.URLChannelEntry) error {
+	if len(items) == 0 {
+		return nil
+	}
+	if err := s.queueCtx.Err(); err != nil {
+		s.logger(ctx).Warn("Queueing deletion", logger.Error(err))
+		return &storageErrors.QueueClosedError{Err: err}
+	}
+	members := make([]interface{}, 0, len(items))
+	for _, item := range items {
+		members = append(members, deletingMember(item.UserID, item.SURL))
+	}
+	// create channels for listening to the go routine result
+	addDone := make(chan bool, 1)
+	addError := make(chan error, 1)
+	go func() {
+		err := s.DB.SAdd(ctx, deletingKey, members...).Err()
+		if err != nil {
+			addError <- &storageErrors.ExecutionRedisError{Err: err}
+			return
+		}
+		addDone <- true
+	}()
+
+	// wait for the first channel to retrieve a value
+	select {
+	case <-ctx.Done():
+		s.logger(ctx).Warn("Queueing deletion", logger.Error(ctx.Err()))
+		return &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
+	case err := <-addError:
+		s.logger(ctx).Warn("Queueing deletion", logger.Error(err))
+		return err
+	case <-addDone:
+		s.logger(ctx).Debug("Queueing deletion", logger.Int("count", len(items)))
+	}
+	// items which could not be sent stay persisted and are sent at the next start
+	for i, item := range items {
+		atomic.AddInt64(&s.pending, 1)
+		select {
+		case <-s.queueCtx.Done():
+			atomic.AddInt64(&s.pending, -1)
+			s.logger(ctx).Warn("Queueing deletion", logger.Error(s.queueCtx.Err()), logger.Int("unsent", len(items)-i))
+			return &storageErrors.QueueClosedError{Err: s.queueCtx.Err()}
+		case <-ctx.Done():
+			atomic.AddInt64(&s.pending, -1)
+			s.logger(ctx).Warn("Queueing deletion", logger.Error(ctx.Err()), logger.Int("unsent", len(items)-i))
+			return &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
+		case s.ch <- item:
+		}
+	}
+	return nil
+}
+
+// deletingMember encodes the deletion of sURL owned by userID as a member of the deleting set.
+func deletingMember(userID, sURL string) string {
+	member, _ := json.Marshal(modelstorage.URLChannelEntry{UserID: userID, SURL: sURL})
+	return string(member)
+}
+
+// retrievePending returns deletions persisted by SendToQueue and not performed yet.
+func (s *Storage) retrievePending(ctx context.Context) ([]modelstorage.URLChannelEntry, error) {
+	members, err := s.DB.SMembers(ctx, deletingKey).Result()
+	if err != nil {
+		return nil, &storageErrors.ExecutionRedisError{Err: err}
+	}
+	pending := make([]modelstorage.URLChannelEntry, 0, len(members))
+	for _, member := range members {
+		var item modelstorage.URLChannelEntry
+		err = json.Unmarshal([]byte(member), &item)
+		if err != nil {
+			s.log.Warn("Requeueing pending deletions: skipping malformed entry", logger.String("entry", member), logger.Error(err))
+			continue
+		}
+		pending = append(pending, item)
+	}
+	return pending, nil
+}
+
+// QueueDepth returns the number of items sent to the deletion task queue and not yet flushed, including items
+// blocked waiting for the queue.
+func (s *Storage) QueueDepth() int {
+	return int(atomic.LoadInt64(&s.pending))
+}
+
+// SendClick sends a redirect record to the click writer queue, the record is dropped if the queue is full so that
+// redirects are never slowed down by analytics.
+func (s *Storage) SendClick(item modelstorage.ClickEntry) {
+	select {
+	case s.clickCh <- item:
+	default:
+		s.log.Warn("Recording click: queue is full, dropping click", logger.String("sURL", item.SURL))
+	}
+}
+
+// Retrieve returns the live entry corresponding to sURL.
+func (s *Storage) Retrieve(ctx context.Context, sURL string) (entry modelstorage.URLMapEntry, err error) {
+	// create channels for listening to the go routine result
+	retrieveDone := make(chan modelstorage.URLMapEntry, 1)
+	retrieveError := make(chan error, 1)
+	go func() {
+		entry, err := s.DB.HGetAll(ctx, urlKeyPrefix+sURL).Result()
+		if err != nil {
+			retrieveError <- &storageErrors.ExecutionRedisError{Err: err}
+			return
+		}
+		if len(entry) == 0 {
+			retrieveError <- &storageErrors.NotFoundError{Err: nil, SURL: sURL}
+			return
+		}
+		if entry["disabled_at"] != "" {
+			retrieveError <- &storageErrors.DisabledError{Err: nil, SURL: sURL}
+			return
+		}
+		if entry["is_deleted"] == "1" {
+			retrieveError <- &storageErrors.DeletedError{Err: nil, SURL: sURL}
+			return
+		}
+		if isExpired(entry) {
+			retrieveError <- &storageErrors.ExpiredError{Err: nil, SURL: sURL}
+			return
+		}
+		mapped := mapEntry(entry)
+		if modelstorage.IsExhausted(mapped.MaxClicks, mapped.ClickCount) {
+			retrieveError <- &storageErrors.ExhaustedError{Err: nil, SURL: sURL}
+			return
+		}
+		if modelstorage.IsNotActive(mapped.ActiveFrom) {
+			retrieveError <- &storageErrors.NotActiveError{Err: nil, SURL: sURL}
+			return
+		}
+		retrieveDone <- mapped
+	}()
+
+	// wait for the first channel to retrieve a value
+	select {
+	case <-ctx.Done():
+		s.logger(ctx).Warn("Retrieving URL", logger.Error(ctx.Err()))
+		return modelstorage.URLMapEntry{}, &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
+	case rtrvError := <-retrieveError:
+		s.logger(ctx).Warn("Retrieving URL", logger.Error(rtrvError))
+		return modelstorage.URLMapEntry{}, rtrvError
+	case entry := <-retrieveDone:
+		s.logger(ctx).Debug("Retrieving URL", logger.String("sURL", sURL), logger.String("url", entry.URL))
+		return entry, nil
+	}
+}
+
+// RetrieveOwner returns the user who created sURL and the organization it belongs to whatever the state of the link.
+func (s *Storage) RetrieveOwner(ctx context.Context, sURL string) (userID, orgID string, err error) {
+	// create channels for listening to the go routine result
+	retrieveDone := make(chan [2]string, 1)
+	retrieveError := make(chan error, 1)
+	go func() {
+		owner, err := s.DB.HMGet(ctx, urlKeyPrefix+sURL, "user_id", "org_id").Result()
+		if err != nil {
+			retrieveError <- &storageErrors.ExecutionRedisError{Err: err}
+			return
+		}
+		userID, ok := owner[0].(string)
+		if !ok {
+			retrieveError <- &storageErrors.NotFoundError{Err: nil, SURL: sURL}
+			return
+		}
+		orgID, _ := owner[1].(string)
+		retrieveDone <- [2]string{userID, orgID}
+	}()
+
+	// wait for the first channel to retrieve a value
+	select {
+	case <-ctx.Done():
+		s.logger(ctx).Warn("Retrieving URL owner", logger.Error(ctx.Err()))
+		return "", "", &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
+	case rtrvError := <-retrieveError:
+		s.logger(ctx).Warn("Retrieving URL owner", logger.Error(rtrvError))
+		return "", "", rtrvError
+	case owner := <-retrieveDone:
+		s.logger(ctx).Debug("Retrieving URL owner", logger.String("sURL", sURL), logger.String("userID", owner[0]))
+		return owner[0], owner[1], nil
+	}
+}
+
+// RetrieveByUserID returns a page of URL:sURL pairs defined as modelurl.FullURL for one particular user ID sorted by
+// creation time, sorting is done in memory since a user set has no order.
+func (s *Storage) RetrieveByUserID(ctx context.Context, userID string, opts modelurl.ListOptions) (URLs []modelurl.FullURL, err error) {
+	// create channels for listening to the go routine result
+	retrieveDone := make(chan []modelurl.FullURL, 1)
+	retrieveError := make(chan error, 1)
+	go func() {
+		URLs, err := s.pageURLs(ctx, userKeyPrefix+userID, opts)
+		if err != nil {
+			retrieveError <- err
+			return
+		}
+		retrieveDone <- URLs
+	}()
+
+	// wait for the first channel to retrieve a value
+	select {
+	case <-ctx.Done():
+		s.logger(ctx).Warn("Retrieving URLs by user ID", logger.Error(ctx.Err()))
+		return nil, &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
+	case rtrvError := <-retrieveError:
+		s.logger(ctx).Warn("Retrieving URLs by user ID", logger.Error(rtrvError))
+		return nil, rtrvError
+	case URLs := <-retrieveDone:
+		s.logger(ctx).Debug("Retrieving URLs by user ID", logger.String("userID", userID), logger.Int("count", len(URLs)))
+		return URLs, nil
+	}
+}
+
+// SearchByUserID returns a page of URL:sURL pairs of one particular user having a word starting with each of terms in
+// their title, tags or URL ranked by relevance, ranking is done in memory.
+func (s *Storage) SearchByUserID(ctx context.Context, userID string, terms []string, opts modelurl.ListOptions) (URLs []modelurl.FullURL, err error) {
+	// create channels for listening to the go routine result
+	retrieveDone := make(chan []modelurl.FullURL, 1)
+	retrieveError := make(chan error, 1)
+	go func() {
+		listed, err := s.listURLs(ctx, userKeyPrefix+userID)
+		if err != nil {
+			retrieveError <- err
+			return
+		}
+		retrieveDone <- modelstorage.RankURLs(listed, terms, opts)
+	}()
+
+	// wait for the first channel to retrieve a value
+	select {
+	case <-ctx.Done():
+		s.logger(ctx).Warn("Searching URLs by user ID", logger.Error(ctx.Err()))
+		return nil, &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
+	case rtrvError := <-retrieveError:
+		s.logger(ctx).Warn("Searching URLs by user ID", logger.Error(rtrvError))
+		return nil, rtrvError
+	case URLs := <-retrieveDone:
+		s.logger(ctx).Debug("Searching URLs by user ID", logger.String("userID", userID), logger.Int("count", len(URLs)))
+		return URLs, nil
+	}
+}
+
+// RetrieveByOrgID returns a page of URL:sURL pairs defined as modelurl.FullURL of one particular organization sorted
+// by creation time, sorting is done in memory since an organization set has no order.
+func (s *Storage) RetrieveByOrgID(ctx context.Context, orgID string, opts modelurl.ListOptions) (URLs []modelurl.FullURL, err error) {
+	// create channels for listening to the go routine result
+	retrieveDone := make(chan []modelurl.FullURL, 1)
+	retrieveError := make(chan error, 1)
+	go func() {
+		URLs, err := s.pageURLs(ctx, orgURLsKeyPrefix+orgID, opts)
+		if err != nil {
+			retrieveError <- err
+			return
+		}
+		retrieveDone <- URLs
+	}()
+
+	// wait for the first channel to retrieve a value
+	select {
+	case <-ctx.Done():
+		s.logger(ctx).Warn("Retrieving URLs by organization ID", logger.Error(ctx.Err()))
+		return nil, &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
+	case rtrvError := <-retrieveError:
+		s.logger(ctx).Warn("Retrieving URLs by organization ID", logger.Error(rtrvError))
+		return nil, rtrvError
+	case URLs := <-retrieveDone:
+		s.logger(ctx).Debug("Retrieving URLs by organization ID", logger.String("orgID", orgID), logger.Int("count", len(URLs)))
+		return URLs, nil
+	}
+}
+
+// pageURLs returns the page of live URL:sURL pairs of the set of sURLs at key defined by opts.
+func (s *Storage) pageURLs(ctx context.Context, key string, opts modelurl.ListOptions) ([]modelurl.FullURL, error) {
+	listed, err := s.listURLs(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	return modelstorage.PageURLs(listed, opts), nil
+}
+
+// listURLs returns live URL:sURL pairs of the set of sURLs at key.
+func (s *Storage) listURLs(ctx context.Context, key string) ([]modelstorage.ListedURL, error) {
+	sURLs, err := s.DB.SMembers(ctx, key).Result()
+	if err != nil {
+		return nil, &storageErrors.ExecutionRedisError{Err: err}
+	}
+	// fetch all entries of the set in one round-trip
+	cmds := make([]*redis.StringStringMapCmd, 0, len(sURLs))
+	_, err = s.DB.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, sURL := range sURLs {
+			cmds = append(cmds, pipe.HGetAll(ctx, urlKeyPrefix+sURL))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, &storageErrors.ExecutionRedisError{Err: err}
+	}
+	var listed []modelstorage.ListedURL
+	for i, cmd := range cmds {
+		entry := cmd.Val()
+		if len(entry) == 0 || entry["is_deleted"] == "1" || isExpired(entry) {
+			continue
+		}
+		listed = append(listed, listedURL(sURLs[i], entry))
+	}
+	return listed, nil
+}
+
+// SearchURLs returns a page of URL:sURL pairs of all users whose URL or sURL contains query sorted by creation time
+// scanning the keyspace page by page.
+func (s *Storage) SearchURLs(ctx context.Context, query string, opts modelurl.ListOptions) (URLs []modelurl.FullURL, err error) {
+	// create channels for listening to the go routine result
+	retrieveDone := make(chan []modelurl.FullURL, 1)
+	retrieveError := make(chan error, 1)
+	go func() {
+		var listed []modelstorage.ListedURL
+		err := s.scanKeys(ctx, urlKeyPrefix+"*", func(keys []string) error {
+			// fetch entries of the page in one round-trip
+			cmds := make([]*redis.StringStringMapCmd, 0, len(keys))
+			_, err := s.DB.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+				for _, key := range keys {
+					cmds = append(cmds, pipe.HGetAll(ctx, key))
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			for i, cmd := range cmds {
+				entry := cmd.Val()
+				sURL := strings.TrimPrefix(keys[i], urlKeyPrefix)
+				if len(entry) == 0 || entry["is_deleted"] == "1" || isExpired(entry) || !modelstorage.MatchesQuery(entry["url"], sURL, query) {
+					continue
+				}
+				listed = append(listed, listedURL(sURL, entry))
+			}
+			return nil
+		})
+		if err != nil {
+			retrieveError <- &storageErrors.ExecutionRedisError{Err: err}
+			return
+		}
+		retrieveDone <- modelstorage.PageURLs(listed, opts)
+	}()
+
+	// wait for the first channel to retrieve a value
+	select {
+	case <-ctx.Done():
+		s.logger(ctx).Warn("Searching URLs", logger.Error(ctx.Err()))
+		return nil, &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
+	case rtrvError := <-retrieveError:
+		s.logger(ctx).Warn("Searching URLs", logger.Error(rtrvError))
+		return nil, rtrvError
+	case URLs := <-retrieveDone:
+		s.logger(ctx).Debug("Searching URLs", logger.String("query", query), logger.Int("count", len(URLs)))
+		return URLs, nil
+	}
+}
+
+// listedURL converts a url hash of sURL into a listed URL.
+func listedURL(sURL string, entry map[string]string) modelstorage.ListedURL {
+	// entries stored before created_at was introduced sort first
+	createdAt, _ := strconv.ParseInt(entry["created_at"], 10, 64)
+	return modelstorage.ListedURL{
+		FullURL: modelurl.FullURL{
+			URL:            entry["url"],
+			SURL:           sURL,
+			Title:          entry["title"],
+			FaviconURL:     entry["favicon_url"],
+			Disabled:       entry["disabled_at"] != "",
+			Domain:         entry["domain"],
+			UserID:         entry["user_id"],
+			Tags:           entryTags(entry),
+			LastAccessedAt: lastAccessedAt(entry),
+			ArchivedAt:     archivedAt(entry),
+		},
+		CreatedAt: time.Unix(0, createdAt),
+	}
+}
+
+// ExportByUserID passes every URL:sURL pair of one particular user to fn scanning the user set page by page, fn is
+// called synchronously and the first error it returns stops the export.
+func (s *Storage) ExportByUserID(ctx context.Context, userID string, fn func(URL modelurl.FullURL) error) error {
+	count, err := s.exportByUserID(ctx, userID, fn)
+	if err != nil {
+		if ctx.Err() != nil {
+			s.logger(ctx).Warn("Exporting URLs by user ID", logger.Error(ctx.Err()))
+			return &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
+		}
+		s.logger(ctx).Warn("Exporting URLs by user ID", logger.Error(err))
+		return err
+	}
+	s.logger(ctx).Debug("Exporting URLs by user ID", logger.String("userID", userID), logger.Int("count", count))
+	return nil
+}
+
+// exportByUserID implements ExportByUserID and returns the number of exported URLs.
+func (s *Storage) exportByUserID(ctx context.Context, userID string, fn func(URL modelurl.FullURL) error) (count int, err error) {
+	var cursor uint64
+	for {
+		var sURLs []string
+		sURLs, cursor, err = s.DB.SScan(ctx, userKeyPrefix+userID, cursor, "", scanCount).Result()
+		if err != nil {
+			return count, &storageErrors.ExecutionRedisError{Err: err}
+		}
+		// fetch entries of the page in one round-trip
+		cmds := make([]*redis.StringStringMapCmd, 0, len(sURLs))
+		_, err = s.DB.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+			for _, sURL := range sURLs {
+				cmds = append(cmds, pipe.HGetAll(ctx, urlKeyPrefix+sURL))
+			}
+			return nil
+		})
+		if err != nil {
+			return count, &storageErrors.ExecutionRedisError{Err: err}
+		}
+		for i, cmd := range cmds {
+			entry := cmd.Val()
+			if len(entry) == 0 || entry["is_deleted"] == "1" || isExpired(entry) {
+				continue
+			}
+			if err = fn(modelurl.FullURL{URL: entry["url"], SURL: sURLs[i], Domain: entry["domain"]}); err != nil {
+				return count, err
+			}
+			count++
+		}
+		if cursor == 0 {
+			return count, nil
+		}
+	}
+}
+
+// ScanURLs passes every URL:sURL pair which is neither deleted, expired nor disabled to fn scanning the keyspace page by
+// page, fn is called synchronously and the first error it returns stops the scan.
+func (s *Storage) ScanURLs(ctx context.Context, fn func(URL modelurl.FullURL) error) error {
+	count := 0
+	err := s.scanKeys(ctx, urlKeyPrefix+"*", func(keys []string) error {
+		// fetch entries of the page in one round-trip
+		cmds := make([]*redis.StringStringMapCmd, 0, len(keys))
+		_, err := s.DB.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+			for _, key := range keys {
+				cmds = append(cmds, pipe.HGetAll(ctx, key))
+			}
+			return nil
+		})
+		if err != nil {
+			return &storageErrors.ExecutionRedisError{Err: err}
+		}
+		for i, cmd := range cmds {
+			entry := cmd.Val()
+			if len(entry) == 0 || entry["is_deleted"] == "1" || entry["disabled_at"] != "" || isExpired(entry) {
+				continue
+			}
+			if err = fn(modelurl.FullURL{URL: entry["url"], SURL: strings.TrimPrefix(keys[i], urlKeyPrefix)}); err != nil {
+				return err
+			}
+			count++
+		}
+		return nil
+	})
+	if err != nil {
+		if ctx.Err() != nil {
+			s.logger(ctx).Warn("Scanning URLs", logger.Error(ctx.Err()))
+			return &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
+		}
+		s.logger(ctx).Warn("Scanning URLs", logger.Error(err))
+		return err
+	}
+	s.logger(ctx).Debug("Scanning URLs", logger.Int("count", count))
+	return nil
+}
+
+// ScanSURLs passes sURLs of all entries whatever their state to fn scanning the keyspace page by page, fn is called
+// synchronously and the first error it returns stops the scan.
+func (s *Storage) ScanSURLs(ctx context.Context, fn func(sURL string) error) error {
+	count := 0
+	err := s.scanKeys(ctx, urlKeyPrefix+"*", func(keys []string) error {
+		for _, key := range keys {
+			if err := fn(strings.TrimPrefix(key, urlKeyPrefix)); err != nil {
+				return err
+			}
+			count++
+		}
+		return nil
+	})
+	if err != nil {
+		if ctx.Err() != nil {
+			s.logger(ctx).Warn("Scanning sURLs", logger.Error(ctx.Err()))
+			return &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
+		}
+		s.logger(ctx).Warn("Scanning sURLs", logger.Error(err))
+		return err
+	}
+	s.logger(ctx).Debug("Scanning sURLs", logger.Int("count", count))
+	return nil
+}
+
+// ScanEntries passes all entries whatever their state to fn along with their deletion flag scanning the keyspace page
+// by page, fn is called synchronously and the first error it returns stops the scan.
+func (s *Storage) ScanEntries(ctx context.Context, fn func(entry modelstorage.URLStorageEntry, deleted bool) error) error {
+	count := 0
+	err := s.scanKeys(ctx, urlKeyPrefix+"*", func(keys []string) error {
+		// fetch entries of the page in one round-trip
+		cmds := make([]*redis.StringStringMapCmd, 0, len(keys))
+		_, err := s.DB.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+			for _, key := range keys {
+				cmds = append(cmds, pipe.HGetAll(ctx, key))
+			}
+			return nil
+		})
+		if err != nil {
+			return &storageErrors.ExecutionRedisError{Err: err}
+		}
+		for i, cmd := range cmds {
+			entry := cmd.Val()
+			if len(entry) == 0 {
+				continue
+			}
+			sURL := strings.TrimPrefix(keys[i], urlKeyPrefix)
+			if err = fn(modelstorage.StorageEntry(sURL, mapEntry(entry)), entry["is_deleted"] == "1"); err != nil {
+				return err
+			}
+			count++
+		}
+		return nil
+	})
+	if err != nil {
+		if ctx.Err() != nil {
+			s.logger(ctx).Warn("Scanning entries", logger.Error(ctx.Err()))
+			return &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
+		}
+		s.logger(ctx).Warn("Scanning entries", logger.Error(err))
+		return err
+	}
+	s.logger(ctx).Debug("Scanning entries", logger.Int("count", count))
+	return nil
+}
+
+// Dump stores a pair of sURL and URL as a key-value pair in DB.
+func (s *Storage) Dump(ctx context.Context, entry modelstorage.URLStorageEntry) error {
+	URL, sURL, userID := entry.URL, entry.SURL, entry.UserID
+	// create channels for listening to the go routine result
+	dumpDone := make(chan bool, 1)
+	dumpError := make(chan error, 1)
+	go func() {
+		var destinations, geoTargets, deviceTargets, utm, tags []byte
+		if len(entry.Destinations) > 0 {
+			var err error
+			destinations, err = json.Marshal(entry.Destinations)
+			if err != nil {
+				dumpError <- err
+				return
+			}
+		}
+		if len(entry.GeoTargets) > 0 {
+			var err error
+			geoTargets, err = json.Marshal(entry.GeoTargets)
+			if err != nil {
+				dumpError <- err
+				return
+			}
+		}
+		if len(entry.DeviceTargets) > 0 {
+			var err error
+			deviceTargets, err = json.Marshal(entry.DeviceTargets)
+			if err != nil {
+				dumpError <- err
+				return
+			}
+		}
+		if len(entry.UTM) > 0 {
+			var err error
+			utm, err = json.Marshal(entry.UTM)
+			if err != nil {
+				dumpError <- err
+				return
+			}
+		}
+		if len(entry.Tags) > 0 {
+			var err error
+			tags, err = json.Marshal(entry.Tags)
+			if err != nil {
+				dumpError <- err
+				return
+			}
+		}
+		// claim the original URL first to keep it unique across all users
+		claimed, err := s.DB.SetNX(ctx, originalKeyPrefix+URL, sURL, 0).Result()
+		if err != nil {
+			dumpError <- &storageErrors.ExecutionRedisError{Err: err}
+			return
+		}
+		if !claimed {
+			// retrieve already existing sURL for violating unique constraint URL
+			validSURL, err := s.DB.Get(ctx, originalKeyPrefix+URL).Result()
+			if err != nil {
+				dumpError <- &storageErrors.ExecutionRedisError{Err: err}
+				return
+			}
+			dumpError <- &storageErrors.AlreadyExistsError{Err: nil, URL: URL, ValidSURL: validSURL}
+			return
+		}
+		// claim sURL since it may be requested by users as a custom alias
+		claimed, err = s.DB.HSetNX(ctx, urlKeyPrefix+sURL, "url", URL).Result()
+		if err != nil || !claimed {
+			s.DB.Del(context.Background(), originalKeyPrefix+URL)
+			if err != nil {
+				dumpError <- &storageErrors.ExecutionRedisError{Err: err}
+				return
+			}
+			dumpError <- &storageErrors.SURLAlreadyExistsError{Err: nil, SURL: sURL}
+			return
+		}
+		_, err = s.DB.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.HSet(ctx, urlKeyPrefix+sURL, "user_id", userID, "is_deleted", "0", "created_at", time.Now().UnixNano())
+			pipe.SAdd(ctx, userKeyPrefix+userID, sURL)
+			if entry.ExpiresAt != nil {
+				expiresAt := entry.ExpiresAt.Unix()
+				pipe.HSet(ctx, urlKeyPrefix+sURL, "expires_at", expiresAt)
+				pipe.ZAdd(ctx, expiringKey, &redis.Z{Score: float64(expiresAt), Member: sURL})
+			}
+			if entry.RedirectType != 0 {
+				pipe.HSet(ctx, urlKeyPrefix+sURL, "redirect_type", entry.RedirectType)
+			}
+			if entry.PasswordHash != "" {
+				pipe.HSet(ctx, urlKeyPrefix+sURL, "password_hash", entry.PasswordHash)
+			}
+			if entry.MaxClicks != 0 {
+				pipe.HSet(ctx, urlKeyPrefix+sURL, "max_clicks", entry.MaxClicks)
+			}
+			if entry.ActiveFrom != nil {
+				pipe.HSet(ctx, urlKeyPrefix+sURL, "active_from", entry.ActiveFrom.Unix())
+			}
+			if destinations != nil {
+				pipe.HSet(ctx, urlKeyPrefix+sURL, "destinations", destinations)
+			}
+			if entry.Sticky {
+				pipe.HSet(ctx, urlKeyPrefix+sURL, "sticky", "1")
+			}
+			if geoTargets != nil {
+				pipe.HSet(ctx, urlKeyPrefix+sURL, "geo_targets", geoTargets)
+			}
+			if deviceTargets != nil {
+				pipe.HSet(ctx, urlKeyPrefix+sURL, "device_targets", deviceTargets)
+			}
+			if utm != nil {
+				pipe.HSet(ctx, urlKeyPrefix+sURL, "utm", utm)
+			}
+			if entry.Domain != "" {
+				pipe.HSet(ctx, urlKeyPrefix+sURL, "domain", entry.Domain)
+			}
+			if entry.OrgID != "" {
+				pipe.HSet(ctx, urlKeyPrefix+sURL, "org_id", entry.OrgID)
+				pipe.SAdd(ctx, orgURLsKeyPrefix+entry.OrgID, sURL)
+			}
+			if tags != nil {
+				pipe.HSet(ctx, urlKeyPrefix+sURL, "tags", tags)
+			}
+			return nil
+		})
+		if err != nil {
+			// release the claims so that the URL and sURL can be used again
+			s.DB.Del(context.Background(), originalKeyPrefix+URL, urlKeyPrefix+sURL)
+			dumpError <- &storageErrors.ExecutionRedisError{Err: err}
+			return
+		}
+		dumpDone <- true
+	}()
+
+	// wait for the first channel to retrieve a value
+	select {
+	case <-ctx.Done():
+		s.logger(ctx).Warn("Dumping URL", logger.Error(ctx.Err()))
+		return &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
+	case dmpError := <-dumpError:
+		s.logger(ctx).Warn("Dumping URL", logger.Error(dmpError))
+		return dmpError
+	case <-dumpDone:
+		s.logger(ctx).Debug("Dumping URL", logger.String("sURL", sURL), logger.String("url", URL))
+		return nil
+	}
+}
+
+// UpdateMetadata sets the destination page title and favicon URL of sURL.
+func (s *Storage) UpdateMetadata(ctx context.Context, sURL, title, faviconURL string) error {
+	// create channels for listening to the go routine result
+	updateDone := make(chan bool, 1)
+	updateError := make(chan error, 1)
+	go func() {
+		key := urlKeyPrefix + sURL
+		// the transaction fails rather than recreates an entry purged concurrently
+		err := s.DB.Watch(ctx, func(tx *redis.Tx) error {
+			exists, err := tx.Exists(ctx, key).Result()
+			if err != nil {
+				return err
+			}
+			if exists == 0 {
+				return redis.Nil
+			}
+			_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+				pipe.HSet(ctx, key, "title", title, "favicon_url", faviconURL)
+				return nil
+			})
+			return err
+		}, key)
+		if err != nil {
+			if errors.Is(err, redis.Nil) {
+				updateError <- &storageErrors.NotFoundError{Err: nil, SURL: sURL}
+				return
+			}
+			updateError <- &storageErrors.ExecutionRedisError{Err: err}
+			return
+		}
+		updateDone <- true
+	}()
+
+	// wait for the first channel to retrieve a value
+	select {
+	case <-ctx.Done():
+		s.logger(ctx).Warn("Updating URL metadata", logger.Error(ctx.Err()))
+		return &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
+	case updError := <-updateError:
+		s.logger(ctx).Warn("Updating URL metadata", logger.Error(updError))
+		return updError
+	case <-updateDone:
+		s.logger(ctx).Debug("Updating URL metadata", logger.String("sURL", sURL))
+		return nil
+	}
+}
+
+// UpdateURL changes the destination of a live entry of sURL owned by userID to URL, moves the URL uniqueness guard to
+// URL, records the edit and returns the former destination. Entries of other users are reported missing.
+func (s *Storage) UpdateURL(ctx context.Context, sURL, userID, URL string) (previous string, err error) {
+	// create channels for listening to the go routine result
+	updateDone := make(chan string, 1)
+	updateError := make(chan error, 1)
+	go func() {
+		key := urlKeyPrefix + sURL
+		var previous string
+		// the transaction fails rather than edits an entry changed concurrently or claims URL shortened concurrently
+		err := s.DB.Watch(ctx, func(tx *redis.Tx) error {
+			entry, err := tx.HGetAll(ctx, key).Result()
+			if err != nil {
+				return err
+			}
+			if len(entry) == 0 || entry["user_id"] != userID || entry["is_deleted"] == "1" {
+				return redis.Nil
+			}
+			mapped := mapEntry(entry)
+			if modelstorage.IsExpired(mapped.ExpiresAt) {
+				return redis.Nil
+			}
+			validSURL, err := tx.Get(ctx, originalKeyPrefix+URL).Result()
+			if err != nil && !errors.Is(err, redis.Nil) {
+				return err
+			}
+			if err == nil && validSURL != sURL {
+				return &storageErrors.AlreadyExistsError{Err: nil, URL: URL, ValidSURL: validSURL}
+			}
+			// the first destination of split links is the URL itself
+			var destinations []byte
+			if len(mapped.Destinations) > 0 {
+				mapped.Destinations[0].URL = URL
+				destinations, err = json.Marshal(mapped.Destinations)
+				if err != nil {
+					return err
+				}
+			}
+			previous = mapped.URL
+			editedAt := time.Now()
+			edit, err := json.Marshal(modelstorage.URLEditEntry{SURL: sURL, UserID: userID, PreviousURL: previous, URL: URL, EditedAt: editedAt})
+			if err != nil {
+				return err
+			}
+			_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+				if previous != URL {
+					pipe.Del(ctx, originalKeyPrefix+previous)
+					pipe.Set(ctx, originalKeyPrefix+URL, sURL, 0)
+				}
+				pipe.HSet(ctx, key, "url", URL, "edited_at", editedAt.UnixNano())
+				// metadata of the former destination page is dropped
+				pipe.HDel(ctx, key, "title", "favicon_url")
+				if destinations != nil {
+					pipe.HSet(ctx, key, "destinations", destinations)
+				}
+				pipe.RPush(ctx, editsKeyPrefix+sURL, edit)
+				return nil
+			})
+			return err
+		}, key, originalKeyPrefix+URL)
+		if err != nil {
+			var alreadyExistsError *storageErrors.AlreadyExistsError
+			switch {
+			case errors.Is(err, redis.Nil):
+				updateError <- &storageErrors.NotFoundError{Err: nil, SURL: sURL}
+			case errors.As(err, &alreadyExistsError):
+				updateError <- err
+			default:
+				updateError <- &storageErrors.ExecutionRedisError{Err: err}
+			}
+			return
+		}
+		updateDone <- previous
+	}()
+
+	// wait for the first channel to retrieve a value
+	select {
+	case <-ctx.Done():
+		s.logger(ctx).Warn("Updating URL", logger.Error(ctx.Err()))
+		return "", &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
+	case updError := <-updateError:
+		s.logger(ctx).Warn("Updating URL", logger.Error(updError))
+		return "", updError
+	case previous := <-updateDone:
+		s.logger(ctx).Debug("Updating URL", logger.String("sURL", sURL), logger.String("url", URL))
+		return previous, nil
+	}
+}
+
+// SetTags replaces tags of a live entry of sURL owned by userID with tags, entries of other users are reported
+// missing.
+func (s *Storage) SetTags(ctx context.Context, sURL, userID string, tags []string) error {
+	// create channels for listening to the go routine result
+	setDone := make(chan bool, 1)
+	setError := make(chan error, 1)
+	go func() {
+		key := urlKeyPrefix + sURL
+		var encoded []byte
+		if len(tags) > 0 {
+			var err error
+			encoded, err = json.Marshal(tags)
+			if err != nil {
+				setError <- err
+				return
+			}
+		}
+		// the transaction fails rather than tags an entry deleted or purged concurrently
+		err := s.DB.Watch(ctx, func(tx *redis.Tx) error {
+			entry, err := tx.HGetAll(ctx, key).Result()
+			if err != nil {
+				return err
+			}
+			if len(entry) == 0 || entry["user_id"] != userID || entry["is_deleted"] == "1" || isExpired(entry) {
+				return redis.Nil
+			}
+			_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+				if encoded != nil {
+					pipe.HSet(ctx, key, "tags", encoded)
+				} else {
+					pipe.HDel(ctx, key, "tags")
+				}
+				return nil
+			})
+			return err
+		}, key)
+		if err != nil {
+			if errors.Is(err, redis.Nil) {
+				setError <- &storageErrors.NotFoundError{Err: nil, SURL: sURL}
+				return
+			}
+			setError <- &storageErrors.ExecutionRedisError{Err: err}
+			return
+		}
+		setDone <- true
+	}()
+
+	// wait for the first channel to retrieve a value
+	select {
+	case <-ctx.Done():
+		s.logger(ctx).Warn("Setting URL tags", logger.Error(ctx.Err()))
+		return &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
+	case stError := <-setError:
+		s.logger(ctx).Warn("Setting URL tags", logger.Error(stError))
+		return stError
+	case <-setDone:
+		s.logger(ctx).Debug("Setting URL tags", logger.String("sURL", sURL), logger.Any("tags", tags))
+		return nil
+	}
+}
+
+// RenameTag renames tag of all entries of userID to name, entries already tagged with name keep one tag.
+// TagNotFoundError is reported if no entry is tagged with tag.
+func (s *Storage) RenameTag(ctx context.Context, userID, tag, name string) error {
+	// create channels for listening to the go routine result
+	renameDone := make(chan bool, 1)
+	renameError := make(chan error, 1)
+	go func() {
+		sURLs, err := s.DB.SMembers(ctx, userKeyPrefix+userID).Result()
+		if err != nil {
+			renameError <- &storageErrors.ExecutionRedisError{Err: err}
+			return
+		}
+		keys := make([]string, 0, len(sURLs))
+		for _, sURL := range sURLs {
+			keys = append(keys, urlKeyPrefix+sURL)
+		}
+		// the transaction fails rather than overwrites tags changed concurrently
+		err = s.DB.Watch(ctx, func(tx *redis.Tx) error {
+			cmds := make([]*redis.StringCmd, 0, len(keys))
+			_, err := tx.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+				for _, key := range keys {
+					cmds = append(cmds, pipe.HGet(ctx, key, "tags"))
+				}
+				return nil
+			})
+			if err != nil && !errors.Is(err, redis.Nil) {
+				return err
+			}
+			renamed := make(map[string][]byte)
+			for i, cmd := range cmds {
+				var tags []string
+				if encoded := cmd.Val(); encoded != "" {
+					_ = json.Unmarshal([]byte(encoded), &tags)
+				}
+				tags, ok := modelstorage.RenameTag(tags, tag, name)
+				if !ok {
+					continue
+				}
+				encoded, err := json.Marshal(tags)
+				if err != nil {
+					return err
+				}
+				renamed[keys[i]] = encoded
+			}
+			if len(renamed) == 0 {
+				return redis.Nil
+			}
+			_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+				for key, encoded := range renamed {
+					pipe.HSet(ctx, key, "tags", encoded)
+				}
+				return nil
+			})
+			return err
+		}, keys...)
+		if err != nil {
+			if errors.Is(err, redis.Nil) {
+				renameError <- &storageErrors.TagNotFoundError{Err: nil, Tag: tag}
+				return
+			}
+			renameError <- &storageErrors.ExecutionRedisError{Err: err}
+			return
+		}
+		renameDone <- true
+	}()
+
+	// wait for the first channel to retrieve a value
+	select {
+	case <-ctx.Done():
+		s.logger(ctx).Warn("Renaming tag", logger.Error(ctx.Err()))
+		return &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
+	case rnmError := <-renameError:
+		s.logger(ctx).Warn("Renaming tag", logger.Error(rnmError))
+		return rnmError
+	case <-renameDone:
+		s.logger(ctx).Debug("Renaming tag", logger.String("userID", userID), logger.String("tag", tag), logger.String("name", name))
+		return nil
+	}
+}
+
+// RetrieveTags returns tags of live entries of userID along with the number of entries tagged with each of them
+// sorted by name, tags are counted in memory since they are stored within entries.
+func (s *Storage) RetrieveTags(ctx context.Context, userID string) (tags []modelurl.Tag, err error) {
+	// create channels for listening to the go routine result
+	retrieveDone := make(chan []modelurl.Tag, 1)
+	retrieveError := make(chan error, 1)
+	go func() {
+		URLs, err := s.pageURLs(ctx, userKeyPrefix+userID, modelurl.ListOptions{})
+		if err != nil {
+			retrieveError <- err
+			return
+		}
+		retrieveDone <- modelstorage.CountTags(URLs)
+	}()
+
+	// wait for the first channel to retrieve a value
+	select {
+	case <-ctx.Done():
+		s.logger(ctx).Warn("Retrieving tags", logger.Error(ctx.Err()))
+		return nil, &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
+	case rtrvError := <-retrieveError:
+		s.logger(ctx).Warn("Retrieving tags", logger.Error(rtrvError))
+		return nil, rtrvError
+	case tags := <-retrieveDone:
+		s.logger(ctx).Debug("Retrieving tags", logger.String("userID", userID), logger.Int("count", len(tags)))
+		return tags, nil
+	}
+}
+
+// TakeClick counts a redirect of sURL limited to a number of clicks and reports ExhaustedError once the limit is
+// reached, the check and the count are done by one script so that concurrent redirects never exceed the limit.
+// Redirects of links without a limit are not counted.
+func (s *Storage) TakeClick(ctx context.Context, sURL string) error {
+	// create channels for listening to the go routine result
+	takeDone := make(chan bool, 1)
+	takeError := make(chan error, 1)
+	go func() {
+		res, err := takeClickScript.Run(ctx, s.DB, []string{urlKeyPrefix + sURL}).Int()
+		if err != nil {
+			takeError <- &storageErrors.ExecutionRedisError{Err: err}
+			return
+		}
+		switch res {
+		case 0:
+			takeError <- &storageErrors.NotFoundError{Err: nil, SURL: sURL}
+			return
+		case -1:
+			takeError <- &storageErrors.ExhaustedError{Err: nil, SURL: sURL}
+			return
+		}
+		takeDone <- true
+	}()
+
+	// wait for the first channel to retrieve a value
+	select {
+	case <-ctx.Done():
+		s.logger(ctx).Warn("Taking URL click", logger.Error(ctx.Err()))
+		return &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
+	case tkError := <-takeError:
+		s.logger(ctx).Warn("Taking URL click", logger.Error(tkError))
+		return tkError
+	case <-takeDone:
+		s.logger(ctx).Debug("Taking URL click", logger.String("sURL", sURL))
+		return nil
+	}
+}
+
+// DumpBatch stores a batch of sURL:URL pairs in DB within one MULTI/EXEC transaction, entries whose URL already
+// exists in DB are returned with the existing sURL.
+func (s *Storage) DumpBatch(ctx context.Context, entries []modelstorage.URLStorageEntry) ([]modelstorage.URLStorageEntry, error) {
+	// create channels for listening to the go routine result
+	dumpDone := make(chan []modelstorage.URLStorageEntry, 1)
+	dumpError := make(chan error, 1)
+	go func() {
+		stored := make([]modelstorage.URLStorageEntry, 0, len(entries))
+		var claimed []modelstorage.URLStorageEntry
+		// release the claims so that the URLs can be shortened again
+		release := func() {
+			for _, entry := range claimed {
+				s.DB.Del(context.Background(), originalKeyPrefix+entry.URL)
+			}
+		}
+		for _, entry := range entries {
+			ok, err := s.DB.SetNX(ctx, originalKeyPrefix+entry.URL, entry.SURL, 0).Result()
+			if err != nil {
+				release()
+				dumpError <- &storageErrors.ExecutionRedisError{Err: err}
+				return
+			}
+			if ok {
+				claimed = append(claimed, entry)
+			} else {
+				// retrieve already existing sURL for violating unique constraint URL
+				entry.SURL, err = s.DB.Get(ctx, originalKeyPrefix+entry.URL).Result()
+				if err != nil {
+					release()
+					dumpError <- &storageErrors.ExecutionRedisError{Err: err}
+					return
+				}
+			}
+			stored = append(stored, entry)
+		}
+		// write all newly claimed entries at once
+		_, err := s.DB.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			for _, entry := range claimed {
+				pipe.HSet(ctx, urlKeyPrefix+entry.SURL, "url", entry.URL, "user_id", entry.UserID, "is_deleted", "0", "created_at", time.Now().UnixNano())
+				pipe.SAdd(ctx, userKeyPrefix+entry.UserID, entry.SURL)
+			}
+			return nil
+		})
+		if err != nil {
+			release()
+			dumpError <- &storageErrors.ExecutionRedisError{Err: err}
+			return
+		}
+		dumpDone <- stored
+	}()
+
+	// wait for the first channel to retrieve a value
+	select {
+	case <-ctx.Done():
+		s.logger(ctx).Warn("Dumping URL batch", logger.Error(ctx.Err()))
+		return nil, &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
+	case dmpError := <-dumpError:
+		s.logger(ctx).Warn("Dumping URL batch", logger.Error(dmpError))
+		return nil, dmpError
+	case stored := <-dumpDone:
+		s.logger(ctx).Debug("Dumping URL batch", logger.Int("count", len(stored)))
+		return stored, nil
+	}
+}
+
+// ImportBatch stores a batch of imported URL entries within one MULTI/EXEC transaction, entries whose URL already
+// exists in DB are returned with the existing sURL, entries whose sURL is taken are skipped and reported.
+func (s *Storage) ImportBatch(ctx context.Context, entries []modelstorage.URLStorageEntry) ([]modelstorage.ImportResult, error) {
+	// create channels for listening to the go routine result
+	importDone := make(chan []modelstorage.ImportResult, 1)
+	importError := make(chan error, 1)
+	go func() {
+		results := make([]modelstorage.ImportResult, 0, len(entries))
+		var claimed []modelstorage.URLStorageEntry
+		// release the claims so that the URLs and sURLs can be used again
+		release := func() {
+			for _, entry := range claimed {
+				s.DB.Del(context.Background(), originalKeyPrefix+entry.URL, urlKeyPrefix+entry.SURL)
+			}
+		}
+		for _, entry := range entries {
+			ok, err := s.DB.SetNX(ctx, originalKeyPrefix+entry.URL, entry.SURL, 0).Result()
+			if err != nil {
+				release()
+				importError <- &storageErrors.ExecutionRedisError{Err: err}
+				return
+			}
+			if !ok {
+				// retrieve already existing sURL for violating unique constraint URL
+				entry.SURL, err = s.DB.Get(ctx, originalKeyPrefix+entry.URL).Result()
+				if err != nil {
+					release()
+					importError <- &storageErrors.ExecutionRedisError{Err: err}
+					return
+				}
+				results = append(results, modelstorage.ImportResult{Entry: entry, Status: modelstorage.ImportURLExists})
+				continue
+			}
+			ok, err = s.DB.HSetNX(ctx, urlKeyPrefix+entry.SURL, "url", entry.URL).Result()
+			if err != nil || !ok {
+				s.DB.Del(context.Background(), originalKeyPrefix+entry.URL)
+				if err != nil {
+					release()
+					importError <- &storageErrors.ExecutionRedisError{Err: err}
+					return
+				}
+				results = append(results, modelstorage.ImportResult{Entry: entry, Status: modelstorage.ImportSURLTaken})
+				continue
+			}
+			claimed = append(claimed, entry)
+			results = append(results, modelstorage.ImportResult{Entry: entry, Status: modelstorage.ImportCreated})
+		}
+		// write all newly claimed entries at once
+		_, err := s.DB.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			for _, entry := range claimed {
+				pipe.HSet(ctx, urlKeyPrefix+entry.SURL, "user_id", entry.UserID, "is_deleted", "0", "created_at", time.Now().UnixNano())
+				pipe.SAdd(ctx, userKeyPrefix+entry.UserID, entry.SURL)
+			}
+			return nil
+		})
+		if err != nil {
+			release()
+			importError <- &storageErrors.ExecutionRedisError{Err: err}
+			return
+		}
+		importDone <- results
+	}()
+
+	// wait for the first channel to retrieve a value
+	select {
+	case <-ctx.Done():
+		s.logger(ctx).Warn("Importing URL batch", logger.Error(ctx.Err()))
+		return nil, &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
+	case imprtError := <-importError:
+		s.logger(ctx).Warn("Importing URL batch", logger.Error(imprtError))
+		return nil, imprtError
+	case results := <-importDone:
+		s.logger(ctx).Debug("Importing URL batch", logger.Int("count", len(results)))
+		return results, nil
+	}
+}
+
+// DeleteBatch assigns a deletion flag for DB entries owned by userID and records audit records of them, does not use
+// task management.
+func (s *Storage) DeleteBatch(ctx context.Context, sURLs []string, userID string) error {
+	// create channels for listening to the go routine result
+	deleteDone := make(chan []modelstorage.URLStorageEntry, 1)
+	deleteError := make(chan error, 1)
+	go func() {
+		// check ownership and deletion flag of every entry in one round-trip
+		cmds := make([]*redis.SliceCmd, 0, len(sURLs))
+		_, err := s.DB.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+			for _, sURL := range sURLs {
+				cmds = append(cmds, pipe.HMGet(ctx, urlKeyPrefix+sURL, "user_id", "is_deleted", "url"))
+			}
+			return nil
+		})
+		if err != nil {
+			deleteError <- &storageErrors.ExecutionRedisError{Err: err}
+			return
+		}
+		var deleted []modelstorage.URLStorageEntry
+		for i, cmd := range cmds {
+			fields := cmd.Val()
+			if len(fields) == 3 && fields[0] == userID && fields[1] != "1" {
+				URL, _ := fields[2].(string)
+				deleted = append(deleted, modelstorage.URLStorageEntry{SURL: sURLs[i], URL: URL, UserID: userID})
+			}
+		}
+		// deletions are audited within the same transaction since they are not known to the service
+		audit := make([]interface{}, 0, len(deleted))
+		for _, entry := range deleted {
+			after := modelstorage.AuditURL(entry)
+			after.Deleted = true
+			auditEntry, err := modelstorage.NewAuditEntry(userID, modelurl.AuditDelete, modelurl.AuditEntityURL, entry.SURL, modelstorage.AuditURL(entry), after)
+			if err != nil {
+				deleteError <- &storageErrors.ExecutionRedisError{Err: err}
+				return
+			}
+			value, err := json.Marshal(auditEntry)
+			if err != nil {
+				deleteError <- &storageErrors.ExecutionRedisError{Err: err}
+				return
+			}
+			audit = append(audit, value)
+		}
+		deletedAt := float64(time.Now().Unix())
+		_, err = s.DB.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			for _, entry := range deleted {
+				pipe.HSet(ctx, urlKeyPrefix+entry.SURL, "is_deleted", "1")
+				pipe.ZAdd(ctx, deletedKey, &redis.Z{Score: deletedAt, Member: entry.SURL})
+			}
+			// deletions are no longer pending once performed, whether the entries were live or not
+			performed := make([]interface{}, 0, len(sURLs))
+			for _, sURL := range sURLs {
+				performed = append(performed, deletingMember(userID, sURL))
+			}
+			pipe.SRem(ctx, deletingKey, performed...)
+			if len(audit) > 0 {
+				pipe.RPush(ctx, auditKey, audit...)
+			}
+			return nil
+		})
+		if err != nil {
+			deleteError <- &storageErrors.ExecutionRedisError{Err: err}
+			return
+		}
+		deleteDone <- deleted
+	}()
+
+	// wait for the first channel to retrieve a value
+	select {
+	case <-ctx.Done():
+		s.logger(ctx).Warn("Deleting URL", logger.Error(ctx.Err()))
+		return &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
+	case dltError := <-deleteError:
+		s.logger(ctx).Warn("Deleting URL", logger.Error(dltError))
+		return dltError
+	case deleted := <-deleteDone:
+		s.logger(ctx).Debug("Deleting URL", logger.String("userID", userID), logger.Any("sURLs", sURLs))
+		for _, entry := range deleted {
+			s.Emit(modelurl.EventURLDeleted, entry)
+		}
+		return nil
+	}
+}
+
+// RestoreBatch removes the deletion flag from entries of sURLs owned by userID and returns sURLs which were actually
+// restored.
+func (s *Storage) RestoreBatch(ctx context.Context, sURLs []string, userID string) (restored []string, err error) {
+	// create channels for listening to the go routine result
+	restoreDone := make(chan []string, 1)
+	restoreError := make(chan error, 1)
+	go func() {
+		// check ownership and deletion flag of every entry in one round-trip
+		cmds := make([]*redis.SliceCmd, 0, len(sURLs))
+		_, err := s.DB.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+			for _, sURL := range sURLs {
+				cmds = append(cmds, pipe.HMGet(ctx, urlKeyPrefix+sURL, "user_id", "is_deleted"))
+			}
+			return nil
+		})
+		if err != nil {
+			restoreError <- &storageErrors.ExecutionRedisError{Err: err}
+			return
+		}
+		var restored []string
+		for i, cmd := range cmds {
+			fields := cmd.Val()
+			if len(fields) == 2 && fields[0] == userID && fields[1] == "1" {
+				restored = append(restored, sURLs[i])
+			}
+		}
+		_, err = s.DB.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			for _, sURL := range restored {
+				pipe.HSet(ctx, urlKeyPrefix+sURL, "is_deleted", "0")
+				pipe.ZRem(ctx, deletedKey, sURL)
+			}
+			return nil
+		})
+		if err != nil {
+			restoreError <- &storageErrors.ExecutionRedisError{Err: err}
+			return
+		}
+		restoreDone <- restored
+	}()
+
+	// wait for the first channel to retrieve a value
+	select {
+	case <-ctx.Done():
+		s.logger(ctx).Warn("Restoring URL", logger.Error(ctx.Err()))
+		return nil, &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
+	case rstrError := <-restoreError:
+		s.logger(ctx).Warn("Restoring URL", logger.Error(rstrError))
+		return nil, rstrError
+	case restored := <-restoreDone:
+		s.logger(ctx).Debug("Restoring URL", logger.String("userID", userID), logger.Any("sURLs", restored))
+		return restored, nil
+	}
+}
+
+// DisableBatch marks entries of sURLs disabled and returns sURLs which were not disabled before.
+func (s *Storage) DisableBatch(ctx context.Context, sURLs []string) (disabled []string, err error) {
+	// create channels for listening to the go routine result
+	disableDone := make(chan []modelstorage.URLStorageEntry, 1)
+	disableError := make(chan error, 1)
+	go func() {
+		// check existence and the disabled mark of every entry in one round-trip
+		cmds := make([]*redis.SliceCmd, 0, len(sURLs))
+		_, err := s.DB.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+			for _, sURL := range sURLs {
+				cmds = append(cmds, pipe.HMGet(ctx, urlKeyPrefix+sURL, "url", "user_id", "disabled_at"))
+			}
+			return nil
+		})
+		if err != nil {
+			disableError <- &storageErrors.ExecutionRedisError{Err: err}
+			return
+		}
+		var entries []modelstorage.URLStorageEntry
+		for i, cmd := range cmds {
+			fields := cmd.Val()
+			if len(fields) != 3 || fields[0] == nil || fields[2] != nil {
+				continue
+			}
+			URL, _ := fields[0].(string)
+			userID, _ := fields[1].(string)
+			entries = append(entries, modelstorage.URLStorageEntry{SURL: sURLs[i], URL: URL, UserID: userID})
+		}
+		disabledAt := time.Now().Unix()
+		_, err = s.DB.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			for _, entry := range entries {
+				pipe.HSet(ctx, urlKeyPrefix+entry.SURL, "disabled_at", disabledAt)
+			}
+			return nil
+		})
+		if err != nil {
+			disableError <- &storageErrors.ExecutionRedisError{Err: err}
+			return
+		}
+		disableDone <- entries
+	}()
+
+	// wait for the first channel to retrieve a value
+	select {
+	case <-ctx.Done():
+		s.logger(ctx).Warn("Disabling URL", logger.Error(ctx.Err()))
+		return nil, &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
+	case dsblError := <-disableError:
+		s.logger(ctx).Warn("Disabling URL", logger.Error(dsblError))
+		return nil, dsblError
+	case entries := <-disableDone:
+		for _, entry := range entries {
+			disabled = append(disabled, entry.SURL)
+			s.Emit(modelurl.EventURLDisabled, entry)
+		}
+		s.logger(ctx).Debug("Disabling URL", logger.Any("sURLs", disabled))
+		return disabled, nil
+	}
+}
+
+// RetrieveStats returns total, per-day and per-destination redirect counts for sURL, redirects of bots are only
+// counted with includeBots.
+func (s *Storage) RetrieveStats(ctx context.Context, sURL string, includeBots bool) (stats modelurl.URLStats, err error) {
+	// create channels for listening to the go routine result
+	retrieveDone := make(chan modelurl.URLStats, 1)
+	retrieveError := make(chan error, 1)
+	go func() {
+		var exists *redis.IntCmd
+		var daily, served *redis.StringStringMapCmd
+		_, err := s.DB.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+			exists = pipe.Exists(ctx, urlKeyPrefix+sURL)
+			daily = pipe.HGetAll(ctx, dailyKeyPrefix+sURL)
+			served = pipe.HGetAll(ctx, servedKeyPrefix+sURL)
+			return nil
+		})
+		if err != nil {
+			retrieveError <- &storageErrors.ExecutionRedisError{Err: err}
+			return
+		}
+		if exists.Val() == 0 {
+			retrieveError <- &storageErrors.NotFoundError{Err: nil, SURL: sURL}
+			return
+		}
+		days, err := countedClicks(daily.Val(), includeBots)
+		if err != nil {
+			retrieveError <- err
+			return
+		}
+		destinations, err := countedClicks(served.Val(), includeBots)
+		if err != nil {
+			retrieveError <- err
+			return
+		}
+		stats := modelurl.URLStats{SURL: sURL}
+		for day, clicks := range days {
+			stats.TotalClicks += clicks
+			stats.ClicksPerDay = append(stats.ClicksPerDay, modelurl.DailyClicks{Date: day, Clicks: clicks})
+		}
+		sort.Slice(stats.ClicksPerDay, func(i, j int) bool {
+			return stats.ClicksPerDay[i].Date < stats.ClicksPerDay[j].Date
+		})
+		for URL, clicks := range destinations {
+			stats.ClicksPerDestination = append(stats.ClicksPerDestination, modelurl.DestinationClicks{URL: URL, Clicks: clicks})
+		}
+		sort.Slice(stats.ClicksPerDestination, func(i, j int) bool {
+			return stats.ClicksPerDestination[i].URL < stats.ClicksPerDestination[j].URL
+		})
+		// unique visitors are counted per day with clicks and over all of them
+		if len(stats.ClicksPerDay) > 0 {
+			keys := make([]string, 0, len(stats.ClicksPerDay))
+			visitors := make([]*redis.IntCmd, 0, len(stats.ClicksPerDay))
+			var total *redis.IntCmd
+			_, err = s.DB.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+				for _, daily := range stats.ClicksPerDay {
+					keys = append(keys, visitorsKey(sURL, daily.Date))
+					visitors = append(visitors, pipe.PFCount(ctx, keys[len(keys)-1]))
+				}
+				total = pipe.PFCount(ctx, keys...)
+				return nil
+			})
+			if err != nil {
+				retrieveError <- &storageErrors.ExecutionRedisError{Err: err}
+				return
+			}
+			for i := range stats.ClicksPerDay {
+				stats.ClicksPerDay[i].Visitors = int(visitors[i].Val())
+			}
+			stats.UniqueVisitors = int(total.Val())
+		}
+		retrieveDone <- stats
+	}()
+
+	// wait for the first channel to retrieve a value
+	select {
+	case <-ctx.Done():
+		s.logger(ctx).Warn("Retrieving URL stats", logger.Error(ctx.Err()))
+		return modelurl.URLStats{}, &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
+	case rtrvError := <-retrieveError:
+		s.logger(ctx).Warn("Retrieving URL stats", logger.Error(rtrvError))
+		return modelurl.URLStats{}, rtrvError
+	case stats := <-retrieveDone:
+		s.logger(ctx).Debug("Retrieving URL stats", logger.String("sURL", sURL), logger.Int("totalClicks", stats.TotalClicks))
+		return stats, nil
+	}
+}
+
+// RetrieveTimeSeries returns non-empty hourly or daily buckets of redirects of sURL within [from, to) summed up from
+// its hourly counts.
+func (s *Storage) RetrieveTimeSeries(ctx context.Context, sURL, granularity string, from, to time.Time, includeBots bool) (buckets []modelurl.ClickBucket, err error) {
+	// create channels for listening to the go routine result
+	retrieveDone := make(chan []modelurl.ClickBucket, 1)
+	retrieveError := make(chan error, 1)
+	go func() {
+		var exists *redis.IntCmd
+		var hourly *redis.StringStringMapCmd
+		_, err := s.DB.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+			exists = pipe.Exists(ctx, urlKeyPrefix+sURL)
+			hourly = pipe.HGetAll(ctx, hourlyKeyPrefix+sURL)
+			return nil
+		})
+		if err != nil {
+			retrieveError <- &storageErrors.ExecutionRedisError{Err: err}
+			return
+		}
+		if exists.Val() == 0 {
+			retrieveError <- &storageErrors.NotFoundError{Err: nil, SURL: sURL}
+			return
+		}
+		counts, err := parseClicks(hourly.Val())
+		if err != nil {
+			retrieveError <- err
+			return
+		}
+		retrieveDone <- modelstorage.BucketClicks(counts, granularity, from, to, includeBots)
+	}()
+
+	// wait for the first channel to retrieve a value
+	select {
+	case <-ctx.Done():
+		s.logger(ctx).Warn("Retrieving URL time series", logger.Error(ctx.Err()))
+		return nil, &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
+	case rtrvError := <-retrieveError:
+		s.logger(ctx).Warn("Retrieving URL time series", logger.Error(rtrvError))
+		return nil, rtrvError
+	case buckets := <-retrieveDone:
+		s.logger(ctx).Debug("Retrieving URL time series", logger.String("sURL", sURL), logger.Int("buckets", len(buckets)))
+		return buckets, nil
+	}
+}
+
+// RetrieveReferrers returns up to limit referrer domains of sURL with the most redirects along with the number of
+// direct redirects.
+func (s *Storage) RetrieveReferrers(ctx context.Context, sURL string, limit int, includeBots bool) (stats modelurl.ReferrerStats, err error) {
+	// create channels for listening to the go routine result
+	retrieveDone := make(chan modelurl.ReferrerStats, 1)
+	retrieveError := make(chan error, 1)
+	go func() {
+		var exists *redis.IntCmd
+		var referrers *redis.StringStringMapCmd
+		_, err := s.DB.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+			exists = pipe.Exists(ctx, urlKeyPrefix+sURL)
+			referrers = pipe.HGetAll(ctx, referrersKeyPrefix+sURL)
+			return nil
+		})
+		if err != nil {
+			retrieveError <- &storageErrors.ExecutionRedisError{Err: err}
+			return
+		}
+		if exists.Val() == 0 {
+			retrieveError <- &storageErrors.NotFoundError{Err: nil, SURL: sURL}
+			return
+		}
+		counts, err := parseClicks(referrers.Val())
+		if err != nil {
+			retrieveError <- err
+			return
+		}
+		retrieveDone <- modelstorage.TopReferrers(sURL, counts, limit, includeBots)
+	}()
+
+	// wait for the first channel to retrieve a value
+	select {
+	case <-ctx.Done():
+		s.logger(ctx).Warn("Retrieving URL referrers", logger.Error(ctx.Err()))
+		return modelurl.ReferrerStats{}, &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
+	case rtrvError := <-retrieveError:
+		s.logger(ctx).Warn("Retrieving URL referrers", logger.Error(rtrvError))
+		return modelurl.ReferrerStats{}, rtrvError
+	case stats := <-retrieveDone:
+		s.logger(ctx).Debug("Retrieving URL referrers", logger.String("sURL", sURL), logger.Int("referrers", len(stats.Referrers)))
+		return stats, nil
+	}
+}
+
+// RetrieveCountries returns redirect counts of sURL per visitor country along with the number of redirects of visitors
+// whose country was not resolved.
+func (s *Storage) RetrieveCountries(ctx context.Context, sURL string, includeBots bool) (stats modelurl.CountryStats, err error) {
+	// create channels for listening to the go routine result
+	retrieveDone := make(chan modelurl.CountryStats, 1)
+	retrieveError := make(chan error, 1)
+	go func() {
+		var exists *redis.IntCmd
+		var countries *redis.StringStringMapCmd
+		_, err := s.DB.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+			exists = pipe.Exists(ctx, urlKeyPrefix+sURL)
+			countries = pipe.HGetAll(ctx, countriesKeyPrefix+sURL)
+			return nil
+		})
+		if err != nil {
+			retrieveError <- &storageErrors.ExecutionRedisError{Err: err}
+			return
+		}
+		if exists.Val() == 0 {
+			retrieveError <- &storageErrors.NotFoundError{Err: nil, SURL: sURL}
+			return
+		}
+		counts, err := parseClicks(countries.Val())
+		if err != nil {
+			retrieveError <- err
+			return
+		}
+		retrieveDone <- modelstorage.CountryBreakdown(sURL, counts, includeBots)
+	}()
+
+	// wait for the first channel to retrieve a value
+	select {
+	case <-ctx.Done():
+		s.logger(ctx).Warn("Retrieving URL countries", logger.Error(ctx.Err()))
+		return modelurl.CountryStats{}, &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
+	case rtrvError := <-retrieveError:
+		s.logger(ctx).Warn("Retrieving URL countries", logger.Error(rtrvError))
+		return modelurl.CountryStats{}, rtrvError
+	case stats := <-retrieveDone:
+		s.logger(ctx).Debug("Retrieving URL countries", logger.String("sURL", sURL), logger.Int("countries", len(stats.Countries)))
+		return stats, nil
+	}
+}
+
+// RetrieveServiceStats returns totals of stored URLs and their users scanning url and user keys page by page.
+func (s *Storage) RetrieveServiceStats(ctx context.Context) (stats modelurl.ServiceStats, err error) {
+	// create channels for listening to the go routine result
+	retrieveDone := make(chan modelurl.ServiceStats, 1)
+	retrieveError := make(chan error, 1)
+	go func() {
+		var stats modelurl.ServiceStats
+		err := s.scanKeys(ctx, urlKeyPrefix+"*", func(keys []string) error {
+			// deleted entries are kept with the is_deleted flag
+			cmds := make([]*redis.StringCmd, 0, len(keys))
+			_, err := s.DB.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+				for _, key := range keys {
+					cmds = append(cmds, pipe.HGet(ctx, key, "is_deleted"))
+				}
+				return nil
+			})
+			if err != nil && !errors.Is(err, redis.Nil) {
+				return err
+			}
+			for _, cmd := range cmds {
+				if cmd.Val() != "1" {
+					stats.URLs++
+				}
+			}
+			return nil
+		})
+		if err == nil {
+			err = s.scanKeys(ctx, userKeyPrefix+"*", func(keys []string) error {
+				stats.Users += len(keys)
+				return nil
+			})
+		}
+		if err != nil {
+			retrieveError <- &storageErrors.ExecutionRedisError{Err: err}
+			return
+		}
+		retrieveDone <- stats
+	}()
+
+	// wait for the first channel to retrieve a value
+	select {
+	case <-ctx.Done():
+		s.logger(ctx).Warn("Retrieving service stats", logger.Error(ctx.Err()))
+		return modelurl.ServiceStats{}, &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
+	case rtrvError := <-retrieveError:
+		s.logger(ctx).Warn("Retrieving service stats", logger.Error(rtrvError))
+		return modelurl.ServiceStats{}, rtrvError
+	case stats := <-retrieveDone:
+		s.logger(ctx).Debug("Retrieving service stats", logger.Int("urls", stats.URLs), logger.Int("users", stats.Users))
+		return stats, nil
+	}
+}
+
+// scanKeys passes keys matching pattern to fn page by page.
+func (s *Storage) scanKeys(ctx context.Context, pattern string, fn func(keys []string) error) error {
+	var cursor uint64
+	for {
+		keys, next, err := s.DB.Scan(ctx, cursor, pattern, scanCount).Result()
+		if err != nil {
+			return err
+		}
+		if len(keys) > 0 {
+			if err = fn(keys); err != nil {
+				return err
+			}
+		}
+		if next == 0 {
+			return nil
+		}
+		cursor = next
+	}
+}
+
+// flushClicks stores a batch of redirect records and updates per-day counters and last access times in one
+// round-trip.
+func (s *Storage) flushClicks(ctx context.Context, clicks []modelstorage.ClickEntry) error {
+	accessed := make(map[string]time.Time)
+	for _, click := range clicks {
+		if click.ClickedAt.After(accessed[click.SURL]) {
+			accessed[click.SURL] = click.ClickedAt
+		}
+	}
+	// the script is loaded first since pipelined commands cannot fall back to sending its source
+	err := touchScript.Load(ctx, s.DB).Err()
+	if err != nil {
+		return &storageErrors.ExecutionRedisError{Err: err}
+	}
+	_, err = s.DB.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for sURL, clickedAt := range accessed {
+			touchScript.EvalSha(ctx, pipe, []string{urlKeyPrefix + sURL}, clickedAt.UnixNano())
+		}
+		for _, click := range clicks {
+			pipe.XAdd(ctx, &redis.XAddArgs{
+				Stream: clicksKeyPrefix + click.SURL,
+				MaxLen: s.Cfg.ClicksStreamMaxLen,
+				Approx: true,
+				Values: []string{
+					"clicked_at", click.ClickedAt.UTC().Format(time.RFC3339Nano),
+					"referrer", click.Referrer,
+					"user_agent", click.UserAgent,
+					"destination", click.Destination,
+					"country", click.Country,
+					"bot", strconv.FormatBool(click.Bot),
+				},
+			})
+			pipe.HIncrBy(ctx, dailyKeyPrefix+click.SURL, modelstorage.CountKey(click.ClickedAt.UTC().Format("2006-01-02"), click.Bot), 1)
+			pipe.HIncrBy(ctx, hourlyKeyPrefix+click.SURL, modelstorage.CountKey(click.ClickedAt.UTC().Format(modelstorage.HourLayout), click.Bot), 1)
+			pipe.HIncrBy(ctx, referrersKeyPrefix+click.SURL, modelstorage.CountKey(click.ReferrerDomain, click.Bot), 1)
+			pipe.HIncrBy(ctx, countriesKeyPrefix+click.SURL, modelstorage.CountKey(click.Country, click.Bot), 1)
+			if click.VisitorKey != "" {
+				pipe.PFAdd(ctx, visitorsKey(click.SURL, click.ClickedAt.UTC().Format("2006-01-02")), click.VisitorKey)
+			}
+			if click.Destination != "" {
+				pipe.HIncrBy(ctx, servedKeyPrefix+click.SURL, modelstorage.CountKey(click.Destination, click.Bot), 1)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return &storageErrors.ExecutionRedisError{Err: err}
+	}
+	s.log.Debug("Recording clicks", logger.Int("count", len(clicks)))
+	return nil
+}
+
+// purgeExpired permanently removes expired DB entries along with their URL uniqueness guards and user memberships.
+func (s *Storage) purgeExpired(ctx context.Context) error {
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+	sURLs, err := s.DB.ZRangeByScore(ctx, expiringKey, &redis.ZRangeBy{Min: "-inf", Max: now}).Result()
+	if err != nil {
+		return &storageErrors.ExecutionRedisError{Err: err}
+	}
+	if len(sURLs) == 0 {
+		return nil
+	}
+	removed, err := s.removeEntries(ctx, sURLs, func(entry map[string]string) bool {
+		return true
+	})
+	if err != nil {
+		return err
+	}
+	for _, entry := range removed {
+		s.Emit(modelurl.EventURLExpired, entry)
+	}
+	s.log.Info("Purging expired URLs", logger.Any("sURLs", sURLs))
+	return nil
+}
+
+// purgeDeleted permanently removes DB entries deleted more than retention ago along with their URL uniqueness guards
+// and user memberships.
+func (s *Storage) purgeDeleted(ctx context.Context, retention time.Duration) error {
+	deletedBefore := strconv.FormatInt(time.Now().Add(-retention).Unix(), 10)
+	sURLs, err := s.DB.ZRangeByScore(ctx, deletedKey, &redis.ZRangeBy{Min: "-inf", Max: deletedBefore}).Result()
+	if err != nil {
+		return &storageErrors.ExecutionRedisError{Err: err}
+	}
+	if len(sURLs) == 0 {
+		return nil
+	}
+	// entries restored after being listed are left intact
+	removed, err := s.removeEntries(ctx, sURLs, func(entry map[string]string) bool {
+		return entry["is_deleted"] == "1"
+	})
+	if err != nil {
+		return err
+	}
+	s.log.Info("Purging deleted URLs", logger.Int("count", len(removed)))
+	return nil
+}
+
+// archiveStale notices owners of DB entries about to be archived and archives entries stale according to policy
+// scanning the keyspace page by page, archived entries keep redirecting. Entries stored before creation times were
+// recorded are never archived.
+func (s *Storage) archiveStale(ctx context.Context, policy modelstorage.ArchivePolicy) error {
+	var noticed, archived []modelstorage.URLStorageEntry
+	err := s.scanKeys(ctx, urlKeyPrefix+"*", func(keys []string) error {
+		// fetch entries of the page in one round-trip
+		cmds := make([]*redis.StringStringMapCmd, 0, len(keys))
+		_, err := s.DB.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+			for _, key := range keys {
+				cmds = append(cmds, pipe.HGetAll(ctx, key))
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		now := time.Now()
+		var pageNoticed, pageArchived []modelstorage.URLStorageEntry
+		for i, cmd := range cmds {
+			entry := cmd.Val()
+			if len(entry) == 0 || entry["is_deleted"] == "1" || entry["archived_at"] != "" || isExpired(entry) || entry["created_at"] == "" {
+				continue
+			}
+			mapped := mapEntry(entry)
+			accessedAt := mapped.CreatedAt
+			if mapped.LastAccessedAt != nil {
+				accessedAt = *mapped.LastAccessedAt
+			}
+			var noticedAt *time.Time
+			if unix, err := strconv.ParseInt(entry["archive_noticed_at"], 10, 64); err == nil {
+				t := time.Unix(unix, 0)
+				noticedAt = &t
+			}
+			notice, archive := policy.Review(now, accessedAt, noticedAt)
+			stale := modelstorage.URLStorageEntry{SURL: strings.TrimPrefix(keys[i], urlKeyPrefix), URL: mapped.URL, UserID: mapped.UserID}
+			switch {
+			case notice:
+				pageNoticed = append(pageNoticed, stale)
+			case archive:
+				pageArchived = append(pageArchived, stale)
+			}
+		}
+		if len(pageNoticed) == 0 && len(pageArchived) == 0 {
+			return nil
+		}
+		_, err = s.DB.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			for _, entry := range pageNoticed {
+				pipe.HSet(ctx, urlKeyPrefix+entry.SURL, "archive_noticed_at", now.Unix())
+			}
+			for _, entry := range pageArchived {
+				pipe.HSet(ctx, urlKeyPrefix+entry.SURL, "archived_at", now.Unix())
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		noticed = append(noticed, pageNoticed...)
+		archived = append(archived, pageArchived...)
+		return nil
+	})
+	for _, entry := range noticed {
+		s.Emit(modelurl.EventURLArchivePending, entry)
+	}
+	for _, entry := range archived {
+		s.Emit(modelurl.EventURLArchived, entry)
+	}
+	if len(noticed) > 0 {
+		s.log.Info("Noticing stale URLs", logger.Int("count", len(noticed)))
+	}
+	if len(archived) > 0 {
+		s.log.Info("Archiving stale URLs", logger.Int("count", len(archived)))
+	}
+	if err != nil {
+		return &storageErrors.ExecutionRedisError{Err: err}
+	}
+	return nil
+}
+
+// removeEntries permanently removes DB entries of sURLs for which purge reports true, along with their URL uniqueness
+// guards, user memberships, redirect and edit records, and returns the removed entries. All sURLs are unlisted from
+// expiring and deleted sets.
+func (s *Storage) removeEntries(ctx context.Context, sURLs []string, purge func(entry map[string]string) bool) (removed []modelstorage.URLStorageEntry, err error) {
+	// fetch all entries along with days of their visitor keys in one round-trip
+	cmds := make([]*redis.StringStringMapCmd, 0, len(sURLs))
+	days := make([]*redis.StringSliceCmd, 0, len(sURLs))
+	_, err = s.DB.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, sURL := range sURLs {
+			cmds = append(cmds, pipe.HGetAll(ctx, urlKeyPrefix+sURL))
+			days = append(days, pipe.HKeys(ctx, dailyKeyPrefix+sURL))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, &storageErrors.ExecutionRedisError{Err: err}
+	}
+	_, err = s.DB.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, cmd := range cmds {
+			entry := cmd.Val()
+			if len(entry) > 0 {
+				if !purge(entry) {
+					continue
+				}
+				pipe.Del(ctx, urlKeyPrefix+sURLs[i], originalKeyPrefix+entry["url"], clicksKeyPrefix+sURLs[i], dailyKeyPrefix+sURLs[i], hourlyKeyPrefix+sURLs[i], servedKeyPrefix+sURLs[i], referrersKeyPrefix+sURLs[i], countriesKeyPrefix+sURLs[i], editsKeyPrefix+sURLs[i])
+				for _, day := range days[i].Val() {
+					// bots are not counted as visitors
+					if _, ok := modelstorage.CountedKey(day, false); ok {
+						pipe.Del(ctx, visitorsKey(sURLs[i], day))
+					}
+				}
+				pipe.SRem(ctx, userKeyPrefix+entry["user_id"], sURLs[i])
+				if orgID := entry["org_id"]; orgID != "" {
+					pipe.SRem(ctx, orgURLsKeyPrefix+orgID, sURLs[i])
+				}
+				removed = append(removed, modelstorage.URLStorageEntry{SURL: sURLs[i], URL: entry["url"], UserID: entry["user_id"]})
+			}
+			pipe.ZRem(ctx, expiringKey, sURLs[i])
+			pipe.ZRem(ctx, deletedKey, sURLs[i])
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, &storageErrors.ExecutionRedisError{Err: err}
+	}
+	return removed, nil
+}
+
+// visitorsKey returns the key of the HyperLogLog of visitors redirected by sURL within day.
+func visitorsKey(sURL, day string) string {
+	return visitorsKeyPrefix + sURL + ":" + day
+}
+
+// parseClicks parses redirect counts of a hash by their fields.
+func parseClicks(values map[string]string) (map[string]int, error) {
+	counts := make(map[string]int, len(values))
+	for field, value := range values {
+		clicks, err := strconv.Atoi(value)
+		if err != nil {
+			return nil, &storageErrors.ExecutionRedisError{Err: err}
+		}
+		counts[field] = clicks
+	}
+	return counts, nil
+}
+
+// countedClicks parses redirect counts of a hash counting redirects apart for bots by modelstorage.CountKey and sums
+// them up by the keys they are reported by, counts of bots are only reported with includeBots.
+func countedClicks(values map[string]string, includeBots bool) (map[string]int, error) {
+	counts, err := parseClicks(values)
+	if err != nil {
+		return nil, err
+	}
+	counted := make(map[string]int, len(counts))
+	for countKey, clicks := range counts {
+		if key, ok := modelstorage.CountedKey(countKey, includeBots); ok {
+			counted[key] += clicks
+		}
+	}
+	return counted, nil
+}
+
+// mapEntry converts a DB entry into its in-memory representation, fields missing in entries stored before they were
+// added are left zero.
+func mapEntry(entry map[string]string) modelstorage.URLMapEntry {
+	mapped := modelstorage.URLMapEntry{
+		URL:          entry["url"],
+		UserID:       entry["user_id"],
+		PasswordHash: entry["password_hash"],
+		Title:        entry["title"],
+		FaviconURL:   entry["favicon_url"],
+		Domain:       entry["domain"],
+		OrgID:        entry["org_id"],
+	}
+	mapped.RedirectType, _ = strconv.Atoi(entry["redirect_type"])
+	mapped.MaxClicks, _ = strconv.Atoi(entry["max_clicks"])
+	mapped.ClickCount, _ = strconv.Atoi(entry["click_count"])
+	mapped.Sticky = entry["sticky"] == "1"
+	if destinations := entry["destinations"]; destinations != "" {
+		_ = json.Unmarshal([]byte(destinations), &mapped.Destinations)
+	}
+	if geoTargets := entry["geo_targets"]; geoTargets != "" {
+		_ = json.Unmarshal([]byte(geoTargets), &mapped.GeoTargets)
+	}
+	if deviceTargets := entry["device_targets"]; deviceTargets != "" {
+		_ = json.Unmarshal([]byte(deviceTargets), &mapped.DeviceTargets)
+	}
+	if utm := entry["utm"]; utm != "" {
+		_ = json.Unmarshal([]byte(utm), &mapped.UTM)
+	}
+	mapped.Tags = entryTags(entry)
+	if createdAt, err := strconv.ParseInt(entry["created_at"], 10, 64); err == nil {
+		mapped.CreatedAt = time.Unix(0, createdAt)
+	}
+	if expiresAt, err := strconv.ParseInt(entry["expires_at"], 10, 64); err == nil {
+		t := time.Unix(expiresAt, 0)
+		mapped.ExpiresAt = &t
+	}
+	if disabledAt, err := strconv.ParseInt(entry["disabled_at"], 10, 64); err == nil {
+		t := time.Unix(disabledAt, 0)
+		mapped.DisabledAt = &t
+	}
+	if activeFrom, err := strconv.ParseInt(entry["active_from"], 10, 64); err == nil {
+		t := time.Unix(activeFrom, 0)
+		mapped.ActiveFrom = &t
+	}
+	mapped.LastAccessedAt = lastAccessedAt(entry)
+	mapped.ArchivedAt = archivedAt(entry)
+	if editedAt, err := strconv.ParseInt(entry["edited_at"], 10, 64); err == nil {
+		t := time.Unix(0, editedAt)
+		mapped.EditedAt = &t
+	}
+	return mapped
+}
+
+// archivedAt returns the archival time of a DB entry, nil if it is not archived.
+func archivedAt(entry map[string]string) *time.Time {
+	archivedAt, err := strconv.ParseInt(entry["archived_at"], 10, 64)
+	if err != nil {
+		return nil
+	}
+	t := time.Unix(archivedAt, 0)
+	return &t
+}
+
+// lastAccessedAt returns the last access time of a DB entry, nil if it was never redirected to since it is tracked.
+func lastAccessedAt(entry map[string]string) *time.Time {
+	accessedAt, err := strconv.ParseInt(entry["last_accessed_at"], 10, 64)
+	if err != nil {
+		return nil
+	}
+	t := time.Unix(0, accessedAt)
+	return &t
+}
+
+// entryTags returns tags of a DB entry, nil if it has none.
+func entryTags(entry map[string]string) []string {
+	var tags []string
+	if encoded := entry["tags"]; encoded != "" {
+		_ = json.Unmarshal([]byte(encoded), &tags)
+	}
+	return tags
+}
+
+// isExpired reports whether a DB entry has an expiration time which has already passed.
+func isExpired(entry map[string]string) bool {
+	expiresAt, err := strconv.ParseInt(entry["expires_at"], 10, 64)
+	if err != nil {
+		return false
+	}
+	return time.Now().Unix() >= expiresAt
+}
+
+// DumpUser stores a new user account, logins are unique.
+func (s *Storage) DumpUser(ctx context.Context, entry modelstorage.UserEntry) error {
+	// create channels for listening to the go routine result
+	dumpDone := make(chan bool, 1)
+	dumpError := make(chan error, 1)
+	go func() {
+		value, err := json.Marshal(entry)
+		if err != nil {
+			dumpError <- err
+			return
+		}
+		// claim the login and store the account in one command
+		claimed, err := s.DB.SetNX(ctx, accountKeyPrefix+entry.Login, value, 0).Result()
+		if err != nil {
+			dumpError <- &storageErrors.ExecutionRedisError{Err: err}
+			return
+		}
+		if !claimed {
+			dumpError <- &storageErrors.LoginAlreadyExistsError{Err: nil, Login: entry.Login}
+			return
+		}
+		dumpDone <- true
+	}()
+
+	// wait for the first channel to retrieve a value
+	select {
+	case <-ctx.Done():
+		s.logger(ctx).Warn("Dumping user", logger.Error(ctx.Err()))
+		return &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
+	case dmpError := <-dumpError:
+		s.logger(ctx).Warn("Dumping user", logger.Error(dmpError))
+		return dmpError
+	case <-dumpDone:
+		s.logger(ctx).Debug("Dumping user", logger.String("login", entry.Login))
+		return nil
+	}
+}
+
+// SetUserRole sets the role of the account registered with login.
+func (s *Storage) SetUserRole(ctx context.Context, login, role string) error {
+	// create channels for listening to the go routine result
+	updateDone := make(chan bool, 1)
+	updateError := make(chan error, 1)
+	go func() {
+		key := accountKeyPrefix + login
+		// retry when the account is changed between reading and writing it
+		err := s.DB.Watch(ctx, func(tx *redis.Tx) error {
+			value, err := tx.Get(ctx, key).Bytes()
+			if err != nil {
+				return err
+			}
+			var user modelstorage.UserEntry
+			err = json.Unmarshal(value, &user)
+			if err != nil {
+				return err
+			}
+			user.Role = role
+			value, err = json.Marshal(user)
+			if err != nil {
+				return err
+			}
+			_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+				pipe.Set(ctx, key, value, 0)
+				return nil
+			})
+			return err
+		}, key)
+		if err != nil {
+			if errors.Is(err, redis.Nil) {
+				updateError <- &storageErrors.UserNotFoundError{Err: nil, Login: login}
+				return
+			}
+			updateError <- &storageErrors.ExecutionRedisError{Err: err}
+			return
+		}
+		updateDone <- true
+	}()
+
+	// wait for the first channel to retrieve a value
+	select {
+	case <-ctx.Done():
+		s.logger(ctx).Warn("Setting user role", logger.Error(ctx.Err()))
+		return &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
+	case updError := <-updateError:
+		s.logger(ctx).Warn("Setting user role", logger.Error(updError))
+		return updError
+	case <-updateDone:
+		s.logger(ctx).Debug("Setting user role", logger.String("login", login), logger.String("role", role))
+		return nil
+	}
+}
+
+// RetrieveUser returns a user account corresponding to login.
+func (s *Storage) RetrieveUser(ctx context.Context, login string) (entry modelstorage.UserEntry, err error) {
+	// create channels for listening to the go routine result
+	retrieveDone := make(chan modelstorage.UserEntry, 1)
+	retrieveError := make(chan error, 1)
+	go func() {
+		value, err := s.DB.Get(ctx, accountKeyPrefix+login).Bytes()
+		if err != nil {
+			if errors.Is(err, redis.Nil) {
+				retrieveError <- &storageErrors.UserNotFoundError{Err: nil, Login: login}
+				return
+			}
+			retrieveError <- &storageErrors.ExecutionRedisError{Err: err}
+			return
+		}
+		var user modelstorage.UserEntry
+		err = json.Unmarshal(value, &user)
+		if err != nil {
+			retrieveError <- err
+			return
+		}
+		retrieveDone <- user
+	}()
+
+	// wait for the first channel to retrieve a value
+	select {
+	case <-ctx.Done():
+		s.logger(ctx).Warn("Retrieving user", logger.Error(ctx.Err()))
+		return modelstorage.UserEntry{}, &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
+	case rtrvError := <-retrieveError:
+		s.logger(ctx).Warn("Retrieving user", logger.Error(rtrvError))
+		return modelstorage.UserEntry{}, rtrvError
+	case user := <-retrieveDone:
+		s.logger(ctx).Debug("Retrieving user", logger.String("login", user.Login))
+		return user, nil
+	}
+}
+
+// RetrieveUsers returns a page of user accounts sorted by login scanning account keys page by page.
+func (s *Storage) RetrieveUsers(ctx context.Context, opts modelurl.ListOptions) (entries []modelstorage.UserEntry, err error) {
+	// create channels for listening to the go routine result
+	retrieveDone := make(chan []modelstorage.UserEntry, 1)
+	retrieveError := make(chan error, 1)
+	go func() {
+		users, err := s.scanUsers(ctx, func(user modelstorage.UserEntry) bool { return true })
+		if err != nil {
+			retrieveError <- &storageErrors.ExecutionRedisError{Err: err}
+			return
+		}
+		retrieveDone <- modelstorage.PageUsers(users, opts)
+	}()
+
+	// wait for the first channel to retrieve a value
+	select {
+	case <-ctx.Done():
+		s.logger(ctx).Warn("Retrieving users", logger.Error(ctx.Err()))
+		return nil, &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
+	case rtrvError := <-retrieveError:
+		s.logger(ctx).Warn("Retrieving users", logger.Error(rtrvError))
+		return nil, rtrvError
+	case users := <-retrieveDone:
+		s.logger(ctx).Debug("Retrieving users", logger.Int("count", len(users)))
+		return users, nil
+	}
+}
+
+// RetrieveUsersByUserID returns user accounts registered by userID sorted by login scanning account keys page by page.
+func (s *Storage) RetrieveUsersByUserID(ctx context.Context, userID string) (entries []modelstorage.UserEntry, err error) {
+	// create channels for listening to the go routine result
+	retrieveDone := make(chan []modelstorage.UserEntry, 1)
+	retrieveError := make(chan error, 1)
+	go func() {
+		users, err := s.scanUsers(ctx, func(user modelstorage.UserEntry) bool { return user.UserID == userID })
+		if err != nil {
+			retrieveError <- &storageErrors.ExecutionRedisError{Err: err}
+			return
+		}
+		retrieveDone <- modelstorage.PageUsers(users, modelurl.ListOptions{})
+	}()
+
+	// wait for the first channel to retrieve a value
+	select {
+	case <-ctx.Done():
+		s.logger(ctx).Warn("Retrieving users by user ID", logger.Error(ctx.Err()))
+		return nil, &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
+	case rtrvError := <-retrieveError:
+		s.logger(ctx).Warn("Retrieving users by user ID", logger.Error(rtrvError))
+		return nil, rtrvError
+	case users := <-retrieveDone:
+		s.logger(ctx).Debug("Retrieving users by user ID", logger.Int("count", len(users)))
+		return users, nil
+	}
+}
+
+// scanUsers returns user accounts for which match reports true scanning account keys page by page.
+func (s *Storage) scanUsers(ctx context.Context, match func(user modelstorage.UserEntry) bool) ([]modelstorage.UserEntry, error) {
+	var users []modelstorage.UserEntry
+	err := s.scanKeys(ctx, accountKeyPrefix+"*", func(keys []string) error {
+		values, err := s.DB.MGet(ctx, keys...).Result()
+		if err != nil {
+			return err
+		}
+		for _, value := range values {
+			// skip keys of erased accounts which are gone since they were scanned
+			raw, ok := value.(string)
+			if !ok {
+				continue
+			}
+			var user modelstorage.UserEntry
+			err = json.Unmarshal([]byte(raw), &user)
+			if err != nil {
+				return err
+			}
+			if match(user) {
+				users = append(users, user)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+// EraseUser permanently removes all data of userID: links of the user whatever their state along with their URL
+// uniqueness guards and redirect records, persisted deletions, accounts, API keys, custom domains, settings and
+// organization memberships. Audit records are kept without the states of the links and memberships of the user and of
+// operations made by the user, deletions of the user still queued in memory find nothing to delete.
+func (s *Storage) EraseUser(ctx context.Context, userID string) error {
+	// create channels for listening to the go routine result
+	eraseDone := make(chan []modelstorage.URLStorageEntry, 1)
+	eraseError := make(chan error, 1)
+	go func() {
+		sURLs, err := s.DB.SMembers(ctx, userKeyPrefix+userID).Result()
+		if err != nil {
+			eraseError <- &storageErrors.ExecutionRedisError{Err: err}
+			return
+		}
+		var erased []modelstorage.URLStorageEntry
+		if len(sURLs) > 0 {
+			erased, err = s.removeEntries(ctx, sURLs, func(entry map[string]string) bool {
+				return entry["user_id"] == userID
+			})
+			if err != nil {
+				eraseError <- err
+				return
+			}
+		}
+		users, err := s.scanUsers(ctx, func(user modelstorage.UserEntry) bool { return user.UserID == userID })
+		if err != nil {
+			eraseError <- &storageErrors.ExecutionRedisError{Err: err}
+			return
+		}
+		hashes, err := s.DB.HVals(ctx, apiKeysKeyPrefix+userID).Result()
+		if err != nil {
+			eraseError <- &storageErrors.ExecutionRedisError{Err: err}
+			return
+		}
+		domains, err := s.DB.SMembers(ctx, domainsKeyPrefix+userID).Result()
+		if err != nil {
+			eraseError <- &storageErrors.ExecutionRedisError{Err: err}
+			return
+		}
+		orgIDs, err := s.DB.SMembers(ctx, orgsKeyPrefix+userID).Result()
+		if err != nil {
+			eraseError <- &storageErrors.ExecutionRedisError{Err: err}
+			return
+		}
+		keys := []string{userKeyPrefix + userID, apiKeysKeyPrefix + userID, domainsKeyPrefix + userID, settingsKeyPrefix + userID, orgsKeyPrefix + userID}
+		for _, user := range users {
+			keys = append(keys, accountKeyPrefix+user.Login)
+		}
+		for _, hash := range hashes {
+			keys = append(keys, apiKeyKeyPrefix+hash)
+		}
+		for _, name := range domains {
+			keys = append(keys, domainClaimKey(name, userID))
+			// the domain may be verified by another user after the user claimed it
+			domain, err := getDomain(ctx, s.DB, domainKeyPrefix+name)
+			if err != nil && !errors.Is(err, redis.Nil) {
+				eraseError <- &storageErrors.ExecutionRedisError{Err: err}
+				return
+			}
+			if err == nil && domain.UserID == userID {
+				keys = append(keys, domainKeyPrefix+name)
+			}
+		}
+		pending, err := s.retrievePending(ctx)
+		if err != nil {
+			eraseError <- err
+			return
+		}
+		var deleting []interface{}
+		for _, item := range pending {
+			if item.UserID == userID {
+				deleting = append(deleting, deletingMember(item.UserID, item.SURL))
+			}
+		}
+		audit, err := s.anonymizedAudit(ctx, userID, sURLs)
+		if err != nil {
+			eraseError <- err
+			return
+		}
+		_, err = s.DB.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Del(ctx, keys...)
+			for _, orgID := range orgIDs {
+				pipe.HDel(ctx, membersKeyPrefix+orgID, userID)
+			}
+			if len(deleting) > 0 {
+				pipe.SRem(ctx, deletingKey, deleting...)
+			}
+			// the audit list is only appended to, so indexes of records do not change
+			for i, value := range audit {
+				pipe.LSet(ctx, auditKey, i, value)
+			}
+			return nil
+		})
+		if err != nil {
+			eraseError <- &storageErrors.ExecutionRedisError{Err: err}
+			return
+		}
+		eraseDone <- erased
+	}()
+
+	// wait for the first channel to retrieve a value
+	select {
+	case <-ctx.Done():
+		s.logger(ctx).Warn("Erasing user", logger.Error(ctx.Err()))
+		return &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
+	case ersError := <-eraseError:
+		s.logger(ctx).Warn("Erasing user", logger.Error(ersError))
+		return ersError
+	case erased := <-eraseDone:
+		s.logger(ctx).Debug("Erasing user", logger.String("userID", userID), logger.Int("urls", len(erased)))
+		return nil
+	}
+}
+
+// anonymizedAudit returns audit records made by userID or describing one of the links sURLs or a membership of userID
+// by their indexes in the audit list, encoded without the states they recorded.
+func (s *Storage) anonymizedAudit(ctx context.Context, userID string, sURLs []string) (map[int64]string, error) {
+	values, err := s.DB.LRange(ctx, auditKey, 0, -1).Result()
+	if err != nil {
+		return nil, &storageErrors.ExecutionRedisError{Err: err}
+	}
+	links := make(map[string]bool, len(sURLs))
+	for _, sURL := range sURLs {
+		links[sURL] = true
+	}
+	anonymized := make(map[int64]string)
+	for i, value := range values {
+		var entry modelstorage.AuditEntry
+		err = json.Unmarshal([]byte(value), &entry)
+		if err != nil {
+			return nil, &storageErrors.ExecutionRedisError{Err: err}
+		}
+		if !entry.Anonymize(userID, links) {
+			continue
+		}
+		encoded, err := json.Marshal(entry)
+		if err != nil {
+			return nil, &storageErrors.ExecutionRedisError{Err: err}
+		}
+		anonymized[int64(i)] = string(encoded)
+	}
+	return anonymized, nil
+}
+
+// RetrieveUserStats returns totals of links of userID and their redirects summing per-day redirect counts.
+func (s *Storage) RetrieveUserStats(ctx context.Context, userID string) (stats modelurl.UserStats, err error) {
+	// create channels for listening to the go routine result
+	retrieveDone := make(chan modelurl.UserStats, 1)
+	retrieveError := make(chan error, 1)
+	go func() {
+		sURLs, err := s.DB.SMembers(ctx, userKeyPrefix+userID).Result()
+		if err != nil {
+			retrieveError <- &storageErrors.ExecutionRedisError{Err: err}
+			return
+		}
+		// fetch entries and their redirect counts in one round-trip
+		entries := make([]*redis.StringStringMapCmd, 0, len(sURLs))
+		daily := make([]*redis.StringStringMapCmd, 0, len(sURLs))
+		_, err = s.DB.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+			for _, sURL := range sURLs {
+				entries = append(entries, pipe.HGetAll(ctx, urlKeyPrefix+sURL))
+				daily = append(daily, pipe.HGetAll(ctx, dailyKeyPrefix+sURL))
+			}
+			return nil
+		})
+		if err != nil {
+			retrieveError <- &storageErrors.ExecutionRedisError{Err: err}
+			return
+		}
+		stats := modelurl.UserStats{UserID: userID}
+		for i, cmd := range entries {
+			entry := cmd.Val()
+			if len(entry) == 0 || entry["is_deleted"] == "1" || isExpired(entry) {
+				continue
+			}
+			stats.URLs++
+			if entry["disabled_at"] != "" {
+				stats.Disabled++
+			}
+			days, err := countedClicks(daily[i].Val(), false)
+			if err != nil {
+				retrieveError <- err
+				return
+			}
+			for _, clicks := range days {
+				stats.Clicks += clicks
+			}
+		}
+		retrieveDone <- stats
+	}()
+
+	// wait for the first channel to retrieve a value
+	select {
+	case <-ctx.Done():
+		s.logger(ctx).Warn("Retrieving user stats", logger.Error(ctx.Err()))
+		return modelurl.UserStats{}, &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
+	case rtrvError := <-retrieveError:
+		s.logger(ctx).Warn("Retrieving user stats", logger.Error(rtrvError))
+		return modelurl.UserStats{}, rtrvError
+	case stats := <-retrieveDone:
+		s.logger(ctx).Debug("Retrieving user stats", logger.String("userID", userID), logger.Int("urls", stats.URLs))
+		return stats, nil
+	}
+}
+
+// DumpAPIKey stores a new API key and lists it among the API keys of its user in one MULTI/EXEC transaction.
+func (s *Storage) DumpAPIKey(ctx context.Context, entry modelstorage.APIKeyEntry) error {
+	// create channels for listening to the go routine result
+	dumpDone := make(chan bool, 1)
+	dumpError := make(chan error, 1)
+	go func() {
+		value, err := json.Marshal(entry)
+		if err != nil {
+			dumpError <- err
+			return
+		}
+		_, err = s.DB.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Set(ctx, apiKeyKeyPrefix+entry.Hash, value, 0)
+			pipe.HSet(ctx, apiKeysKeyPrefix+entry.UserID, entry.ID, entry.Hash)
+			return nil
+		})
+		if err != nil {
+			dumpError <- &storageErrors.ExecutionRedisError{Err: err}
+			return
+		}
+		dumpDone <- true
+	}()
+
+	// wait for the first channel to retrieve a value
+	select {
+	case <-ctx.Done():
+		s.logger(ctx).Warn("Dumping API key", logger.Error(ctx.Err()))
+		return &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
+	case dmpError := <-dumpError:
+		s.logger(ctx).Warn("Dumping API key", logger.Error(dmpError))
+		return dmpError
+	case <-dumpDone:
+		s.logger(ctx).Debug("Dumping API key", logger.String("id", entry.ID))
+		return nil
+	}
+}
+
+// RevokeAPIKey marks the API key with id owned by userID revoked, revoking a revoked key is a no-op.
+func (s *Storage) RevokeAPIKey(ctx context.Context, id, userID string) error {
+	// create channels for listening to the go routine result
+	revokeDone := make(chan bool, 1)
+	revokeError := make(chan error, 1)
+	go func() {
+		hash, err := s.DB.HGet(ctx, apiKeysKeyPrefix+userID, id).Result()
+		if err != nil {
+			if errors.Is(err, redis.Nil) {
+				revokeError <- &storageErrors.APIKeyNotFoundError{Err: nil, ID: id}
+				return
+			}
+			revokeError <- &storageErrors.ExecutionRedisError{Err: err}
+			return
+		}
+		key := apiKeyKeyPrefix + hash
+		// the transaction fails rather than overwrites a concurrent update of the key
+		err = s.DB.Watch(ctx, func(tx *redis.Tx) error {
+			value, err := tx.Get(ctx, key).Bytes()
+			if err != nil {
+				return err
+			}
+			var entry modelstorage.APIKeyEntry
+			err = json.Unmarshal(value, &entry)
+			if err != nil {
+				return err
+			}
+			if entry.RevokedAt != nil {
+				return nil
+			}
+			revokedAt := time.Now().UTC()
+			entry.RevokedAt = &revokedAt
+			value, err = json.Marshal(entry)
+			if err != nil {
+				return err
+			}
+			_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+				pipe.Set(ctx, key, value, 0)
+				return nil
+			})
+			return err
+		}, key)
+		if err != nil {
+			if errors.Is(err, redis.Nil) {
+				revokeError <- &storageErrors.APIKeyNotFoundError{Err: nil, ID: id}
+				return
+			}
+			revokeError <- &storageErrors.ExecutionRedisError{Err: err}
+			return
+		}
+		revokeDone <- true
+	}()
+
+	// wait for the first channel to retrieve a value
+	select {
+	case <-ctx.Done():
+		s.logger(ctx).Warn("Revoking API key", logger.Error(ctx.Err()))
+		return &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
+	case rvkError := <-revokeError:
+		s.logger(ctx).Warn("Revoking API key", logger.Error(rvkError))
+		return rvkError
+	case <-revokeDone:
+		s.logger(ctx).Debug("Revoking API key", logger.String("id", id))
+		return nil
+	}
+}
+
+// RetrieveAPIKey returns the API key with the given hash.
+func (s *Storage) RetrieveAPIKey(ctx context.Context, hash string) (entry modelstorage.APIKeyEntry, err error) {
+	// create channels for listening to the go routine result
+	retrieveDone := make(chan modelstorage.APIKeyEntry, 1)
+	retrieveError := make(chan error, 1)
+	go func() {
+		value, err := s.DB.Get(ctx, apiKeyKeyPrefix+hash).Bytes()
+		if err != nil {
+			if errors.Is(err, redis.Nil) {
+				retrieveError <- &storageErrors.APIKeyNotFoundError{Err: nil}
+				return
+			}
+			retrieveError <- &storageErrors.ExecutionRedisError{Err: err}
+			return
+		}
+		var apiKey modelstorage.APIKeyEntry
+		err = json.Unmarshal(value, &apiKey)
+		if err != nil {
+			retrieveError <- err
+			return
+		}
+		retrieveDone <- apiKey
+	}()
+
+	// wait for the first channel to retrieve a value
+	select {
+	case <-ctx.Done():
+		s.logger(ctx).Warn("Retrieving API key", logger.Error(ctx.Err()))
+		return modelstorage.APIKeyEntry{}, &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
+	case rtrvError := <-retrieveError:
+		s.logger(ctx).Warn("Retrieving API key", logger.Error(rtrvError))
+		return modelstorage.APIKeyEntry{}, rtrvError
+	case apiKey := <-retrieveDone:
+		s.logger(ctx).Debug("Retrieving API key", logger.String("id", apiKey.ID))
+		return apiKey, nil
+	}
+}
+
+// RetrieveAPIKeysByUserID returns API keys of userID including revoked ones sorted by creation time.
+func (s *Storage) RetrieveAPIKeysByUserID(ctx context.Context, userID string) (entries []modelstorage.APIKeyEntry, err error) {
+	// create channels for listening to the go routine result
+	retrieveDone := make(chan []modelstorage.APIKeyEntry, 1)
+	retrieveError := make(chan error, 1)
+	go func() {
+		hashes, err := s.DB.HVals(ctx, apiKeysKeyPrefix+userID).Result()
+		if err != nil {
+			retrieveError <- &storageErrors.ExecutionRedisError{Err: err}
+			return
+		}
+		if len(hashes) == 0 {
+			retrieveDone <- nil
+			return
+		}
+		keys := make([]string, 0, len(hashes))
+		for _, hash := range hashes {
+			keys = append(keys, apiKeyKeyPrefix+hash)
+		}
+		values, err := s.DB.MGet(ctx, keys...).Result()
+		if err != nil {
+			retrieveError <- &storageErrors.ExecutionRedisError{Err: err}
+			return
+		}
+		apiKeys := make([]modelstorage.APIKeyEntry, 0, len(values))
+		for _, value := range values {
+			str, ok := value.(string)
+			if !ok {
+				continue
+			}
+			var apiKey modelstorage.APIKeyEntry
+			err = json.Unmarshal([]byte(str), &apiKey)
+			if err != nil {
+				retrieveError <- err
+				return
+			}
+			apiKeys = append(apiKeys, apiKey)
+		}
+		modelstorage.SortAPIKeys(apiKeys)
+		retrieveDone <- apiKeys
+	}()
+
+	// wait for the first channel to retrieve a value
+	select {
+	case <-ctx.Done():
+		s.logger(ctx).Warn("Retrieving API keys by user ID", logger.Error(ctx.Err()))
+		return nil, &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
+	case rtrvError := <-retrieveError:
+		s.logger(ctx).Warn("Retrieving API keys by user ID", logger.Error(rtrvError))
+		return nil, rtrvError
+	case apiKeys := <-retrieveDone:
+		s.logger(ctx).Debug("Retrieving API keys by user ID", logger.Int("count", len(apiKeys)))
+		return apiKeys, nil
+	}
+}
+
+// DumpDomain stores a new claim of a custom domain expiring after DomainClaimTTL and lists it among the domains of its
+// user, domains verified by any user or claimed by the user already are reported with DomainAlreadyExistsError.
+func (s *Storage) DumpDomain(ctx context.Context, entry modelstorage.DomainEntry) error {
+	// create channels for listening to the go routine result
+	dumpDone := make(chan bool, 1)
+	dumpError := make(chan error, 1)
+	go func() {
+		value, err := json.Marshal(entry)
+		if err != nil {
+			dumpError <- err
+			return
+		}
+		key := domainKeyPrefix + entry.Name
+		claimKey := domainClaimKey(entry.Name, entry.UserID)
+		// the transaction fails rather than claims a domain verified concurrently
+		err = s.DB.Watch(ctx, func(tx *redis.Tx) error {
+			domain, err := getDomain(ctx, tx, key)
+			if err != nil && !errors.Is(err, redis.Nil) {
+				return err
+			}
+			if err == nil && (domain.VerifiedAt != nil || domain.UserID == entry.UserID && !domain.Expired(time.Now(), s.Cfg.DomainClaimTTL)) {
+				return &storageErrors.DomainAlreadyExistsError{Err: nil, Name: entry.Name}
+			}
+			claimed, err := tx.Exists(ctx, claimKey).Result()
+			if err != nil {
+				return err
+			}
+			if claimed > 0 {
+				return &storageErrors.DomainAlreadyExistsError{Err: nil, Name: entry.Name}
+			}
+			_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+				pipe.Set(ctx, claimKey, value, s.Cfg.DomainClaimTTL)
+				pipe.SAdd(ctx, domainsKeyPrefix+entry.UserID, entry.Name)
+				return nil
+			})
+			return err
+		}, key, claimKey)
+		if err != nil {
+			var domainAlreadyExistsError *storageErrors.DomainAlreadyExistsError
+			if errors.As(err, &domainAlreadyExistsError) {
+				dumpError <- err
+				return
+			}
+			dumpError <- &storageErrors.ExecutionRedisError{Err: err}
+			return
+		}
+		dumpDone <- true
+	}()
+
+	// wait for the first channel to retrieve a value
+	select {
+	case <-ctx.Done():
+		s.logger(ctx).Warn("Dumping domain", logger.Error(ctx.Err()))
+		return &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
+	case dmpError := <-dumpError:
+		s.logger(ctx).Warn("Dumping domain", logger.Error(dmpError))
+		return dmpError
+	case <-dumpDone:
+		s.logger(ctx).Debug("Dumping domain", logger.String("domain", entry.Name))
+		return nil
+	}
+}
+
+// VerifyDomain marks the custom domain name claimed by userID verified, verifying a verified domain is a no-op. Claims
+// of the domain by other users are left to expire since the verified domain takes precedence over them. Expired
+// claims are reported with DomainNotFoundError and domains verified by other users meanwhile with
+// DomainAlreadyExistsError.
+func (s *Storage) VerifyDomain(ctx context.Context, name, userID string) error {
+	// create channels for listening to the go routine result
+	verifyDone := make(chan bool, 1)
+	verifyError := make(chan error, 1)
+	go func() {
+		key := domainKeyPrefix + name
+		claimKey := domainClaimKey(name, userID)
+		// the transaction fails rather than overwrites a concurrent update of the domain
+		err := s.DB.Watch(ctx, func(tx *redis.Tx) error {
+			entry, err := s.retrieveDomainClaim(ctx, tx, name, userID)
+			if err != nil {
+				return err
+			}
+			if entry.VerifiedAt != nil {
+				return nil
+			}
+			verifiedAt := time.Now().UTC()
+			entry.VerifiedAt = &verifiedAt
+			value, err := json.Marshal(entry)
+			if err != nil {
+				return err
+			}
+			_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+				pipe.Set(ctx, key, value, 0)
+				pipe.Del(ctx, claimKey)
+				return nil
+			})
+			return err
+		}, key, claimKey)
+		if err != nil {
+			var domainNotFoundError *storageErrors.DomainNotFoundError
+			var domainAlreadyExistsError *storageErrors.DomainAlreadyExistsError
+			if errors.As(err, &domainNotFoundError) || errors.As(err, &domainAlreadyExistsError) {
+				verifyError <- err
+				return
+			}
+			verifyError <- &storageErrors.ExecutionRedisError{Err: err}
+			return
+		}
+		verifyDone <- true
+	}()
+
+	// wait for the first channel to retrieve a value
+	select {
+	case <-ctx.Done():
+		s.logger(ctx).Warn("Verifying domain", logger.Error(ctx.Err()))
+		return &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
+	case vrfError := <-verifyError:
+		s.logger(ctx).Warn("Verifying domain", logger.Error(vrfError))
+		return vrfError
+	case <-verifyDone:
+		s.logger(ctx).Debug("Verifying domain", logger.String("domain", name))
+		return nil
+	}
+}
+
+// RetrieveDomain returns the verified custom domain name, domains pending verification are reported with
+// DomainNotFoundError.
+func (s *Storage) RetrieveDomain(ctx context.Context, name string) (entry modelstorage.DomainEntry, err error) {
+	// create channels for listening to the go routine result
+	retrieveDone := make(chan modelstorage.DomainEntry, 1)
+	retrieveError := make(chan error, 1)
+	go func() {
+		domain, err := getDomain(ctx, s.DB, domainKeyPrefix+name)
+		if err != nil {
+			if errors.Is(err, redis.Nil) {
+				retrieveError <- &storageErrors.DomainNotFoundError{Err: nil, Name: name}
+				return
+			}
+			retrieveError <- &storageErrors.ExecutionRedisError{Err: err}
+			return
+		}
+		if domain.VerifiedAt == nil {
+			retrieveError <- &storageErrors.DomainNotFoundError{Err: nil, Name: name}
+			return
+		}
+		retrieveDone <- domain
+	}()
+
+	// wait for the first channel to retrieve a value
+	select {
+	case <-ctx.Done():
+		s.logger(ctx).Warn("Retrieving domain", logger.Error(ctx.Err()))
+		return modelstorage.DomainEntry{}, &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
+	case rtrvError := <-retrieveError:
+		s.logger(ctx).Debug("Retrieving domain", logger.Error(rtrvError))
+		return modelstorage.DomainEntry{}, rtrvError
+	case domain := <-retrieveDone:
+		s.logger(ctx).Debug("Retrieving domain", logger.String("domain", domain.Name))
+		return domain, nil
+	}
+}
+
+// RetrieveDomainClaim returns the claim of the custom domain name by userID whether it is verified or not, expired
+// claims are reported with DomainNotFoundError.
+func (s *Storage) RetrieveDomainClaim(ctx context.Context, name, userID string) (entry modelstorage.DomainEntry, err error) {
+	// create channels for listening to the go routine result
+	retrieveDone := make(chan modelstorage.DomainEntry, 1)
+	retrieveError := make(chan error, 1)
+	go func() {
+		domain, err := s.retrieveDomainClaim(ctx, s.DB, name, userID)
+		if err != nil {
+			var domainAlreadyExistsError *storageErrors.DomainAlreadyExistsError
+			if errors.As(err, &domainAlreadyExistsError) {
+				retrieveError <- &storageErrors.DomainNotFoundError{Err: nil, Name: name}
+				return
+			}
+			var domainNotFoundError *storageErrors.DomainNotFoundError
+			if errors.As(err, &domainNotFoundError) {
+				retrieveError <- err
+				return
+			}
+			retrieveError <- &storageErrors.ExecutionRedisError{Err: err}
+			return
+		}
+		retrieveDone <- domain
+	}()
+
+	// wait for the first channel to retrieve a value
+	select {
+	case <-ctx.Done():
+		s.logger(ctx).Warn("Retrieving domain claim", logger.Error(ctx.Err()))
+		return modelstorage.DomainEntry{}, &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
+	case rtrvError := <-retrieveError:
+		s.logger(ctx).Debug("Retrieving domain claim", logger.Error(rtrvError))
+		return modelstorage.DomainEntry{}, rtrvError
+	case domain := <-retrieveDone:
+		s.logger(ctx).Debug("Retrieving domain claim", logger.String("domain", domain.Name))
+		return domain, nil
+	}
+}
+
+// retrieveDomainClaim returns the claim of the custom domain name by userID, the domain verified by another user is
+// reported with DomainAlreadyExistsError. Domains stored at domain:<name> pending verification are claims made before
+// claims were kept apart.
+func (s *Storage) retrieveDomainClaim(ctx context.Context, cmd redis.Cmdable, name, userID string) (modelstorage.DomainEntry, error) {
+	domain, err := getDomain(ctx, cmd, domainKeyPrefix+name)
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return modelstorage.DomainEntry{}, err
+	}
+	if err == nil {
+		if domain.VerifiedAt != nil && domain.UserID != userID {
+			return modelstorage.DomainEntry{}, &storageErrors.DomainAlreadyExistsError{Err: nil, Name: name}
+		}
+		if domain.UserID == userID && !domain.Expired(time.Now(), s.Cfg.DomainClaimTTL) {
+			return domain, nil
+		}
+	}
+	domain, err = getDomain(ctx, cmd, domainClaimKey(name, userID))
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return modelstorage.DomainEntry{}, &storageErrors.DomainNotFoundError{Err: nil, Name: name}
+		}
+		return modelstorage.DomainEntry{}, err
+	}
+	return domain, nil
+}
+
+// RetrieveDomainsByUserID returns custom domains of userID sorted by creation time leaving expired claims and claims of
+// domains verified by other users out.
+func (s *Storage) RetrieveDomainsByUserID(ctx context.Context, userID string) (entries []modelstorage.DomainEntry, err error) {
+	// create channels for listening to the go routine result
+	retrieveDone := make(chan []modelstorage.DomainEntry, 1)
+	retrieveError := make(chan error, 1)
+	go func() {
+		names, err := s.DB.SMembers(ctx, domainsKeyPrefix+userID).Result()
+		if err != nil {
+			retrieveError <- &storageErrors.ExecutionRedisError{Err: err}
+			return
+		}
+		if len(names) == 0 {
+			retrieveDone <- nil
+			return
+		}
+		domains := make([]modelstorage.DomainEntry, 0, len(names))
+		for _, name := range names {
+			domain, err := s.retrieveDomainClaim(ctx, s.DB, name, userID)
+			if err != nil {
+				var domainNotFoundError *storageErrors.DomainNotFoundError
+				var domainAlreadyExistsError *storageErrors.DomainAlreadyExistsError
+				if errors.As(err, &domainNotFoundError) || errors.As(err, &domainAlreadyExistsError) {
+					continue
+				}
+				retrieveError <- &storageErrors.ExecutionRedisError{Err: err}
+				return
+			}
+			domains = append(domains, domain)
+		}
+		modelstorage.SortDomains(domains)
+		retrieveDone <- domains
+	}()
+
+	// wait for the first channel to retrieve a value
+	select {
+	case <-ctx.Done():
+		s.logger(ctx).Warn("Retrieving domains by user ID", logger.Error(ctx.Err()))
+		return nil, &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
+	case rtrvError := <-retrieveError:
+		s.logger(ctx).Warn("Retrieving domains by user ID", logger.Error(rtrvError))
+		return nil, rtrvError
+	case domains := <-retrieveDone:
+		s.logger(ctx).Debug("Retrieving domains by user ID", logger.Int("count", len(domains)))
+		return domains, nil
+	}
+}
+
+// RetrieveVerifiedDomains returns names of all verified custom domains sorted by name scanning verified and legacy
+// pending domains.
+func (s *Storage) RetrieveVerifiedDomains(ctx context.Context) (names []string, err error) {
+	// create channels for listening to the go routine result
+	retrieveDone := make(chan []string, 1)
+	retrieveError := make(chan error, 1)
+	go func() {
+		var names []string
+		err := s.scanKeys(ctx, domainKeyPrefix+"*", func(keys []string) error {
+			values, err := s.DB.MGet(ctx, keys...).Result()
+			if err != nil {
+				return err
+			}
+			for _, value := range values {
+				// skip keys of erased domains which are gone since they were scanned
+				raw, ok := value.(string)
+				if !ok {
+					continue
+				}
+				var domain modelstorage.DomainEntry
+				err = json.Unmarshal([]byte(raw), &domain)
+				if err != nil {
+					return err
+				}
+				if domain.VerifiedAt != nil {
+					names = append(names, domain.Name)
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			retrieveError <- &storageErrors.ExecutionRedisError{Err: err}
+			return
+		}
+		sort.Strings(names)
+		retrieveDone <- names
+	}()
+
+	// wait for the first channel to retrieve a value
+	select {
+	case <-ctx.Done():
+		s.logger(ctx).Warn("Retrieving verified domains", logger.Error(ctx.Err()))
+		return nil, &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
+	case rtrvError := <-retrieveError:
+		s.logger(ctx).Warn("Retrieving verified domains", logger.Error(rtrvError))
+		return nil, rtrvError
+	case names := <-retrieveDone:
+		s.logger(ctx).Debug("Retrieving verified domains", logger.Int("count", len(names)))
+		return names, nil
+	}
+}
+
+// getDomain reads the JSON-encoded custom domain stored at key.
+func getDomain(ctx context.Context, cmd redis.Cmdable, key string) (modelstorage.DomainEntry, error) {
+	var domain modelstorage.DomainEntry
+	value, err := cmd.Get(ctx, key).Bytes()
+	if err != nil {
+		return domain, err
+	}
+	err = json.Unmarshal(value, &domain)
+	return domain, err
+}
+
+// domainClaimKey returns the key of the claim of the custom domain name by userID.
+func domainClaimKey(name, userID string) string {
+	return claimKeyPrefix + name + ":" + userID
+}
+
+// DumpUserSettings stores settings of a user replacing the previous ones.
+func (s *Storage) DumpUserSettings(ctx context.Context, entry modelstorage.UserSettingsEntry) error {
+	// create channels for listening to the go routine result
+	dumpDone := make(chan bool, 1)
+	dumpError := make(chan error, 1)
+	go func() {
+		value, err := json.Marshal(entry)
+		if err != nil {
+			dumpError <- err
+			return
+		}
+		err = s.DB.Set(ctx, settingsKeyPrefix+entry.UserID, value, 0).Err()
+		if err != nil {
+			dumpError <- &storageErrors.ExecutionRedisError{Err: err}
+			return
+		}
+		dumpDone <- true
+	}()
+
+	// wait for the first channel to retrieve a value
+	select {
+	case <-ctx.Done():
+		s.logger(ctx).Warn("Dumping user settings", logger.Error(ctx.Err()))
+		return &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
+	case dmpError := <-dumpError:
+		s.logger(ctx).Warn("Dumping user settings", logger.Error(dmpError))
+		return dmpError
+	case <-dumpDone:
+		s.logger(ctx).Debug("Dumping user settings", logger.String("userID", entry.UserID))
+		return nil
+	}
+}
+
+// RetrieveUserSettings returns settings of userID, users who never changed them get an entry without settings.
+func (s *Storage) RetrieveUserSettings(ctx context.Context, userID string) (entry modelstorage.UserSettingsEntry, err error) {
+	// create channels for listening to the go routine result
+	retrieveDone := make(chan modelstorage.UserSettingsEntry, 1)
+	retrieveError := make(chan error, 1)
+	go func() {
+		settings := modelstorage.UserSettingsEntry{UserID: userID}
+		value, err := s.DB.Get(ctx, settingsKeyPrefix+userID).Bytes()
+		if err != nil {
+			if errors.Is(err, redis.Nil) {
+				retrieveDone <- settings
+				return
+			}
+			retrieveError <- &storageErrors.ExecutionRedisError{Err: err}
+			return
+		}
+		err = json.Unmarshal(value, &settings)
+		if err != nil {
+			retrieveError <- err
+			return
+		}
+		retrieveDone <- settings
+	}()
+
+	// wait for the first channel to retrieve a value
+	select {
+	case <-ctx.Done():
+		s.logger(ctx).Warn("Retrieving user settings", logger.Error(ctx.Err()))
+		return modelstorage.UserSettingsEntry{}, &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
+	case rtrvError := <-retrieveError:
+		s.logger(ctx).Warn("Retrieving user settings", logger.Error(rtrvError))
+		return modelstorage.UserSettingsEntry{}, rtrvError
+	case settings := <-retrieveDone:
+		s.logger(ctx).Debug("Retrieving user settings", logger.String("userID", userID))
+		return settings, nil
+	}
+}
+
+// DumpOrg stores a new organization along with its first admin.
+func (s *Storage) DumpOrg(ctx context.Context, entry modelstorage.OrgEntry, admin modelstorage.MemberEntry) error {
+	// create channels for listening to the go routine result
+	dumpDone := make(chan bool, 1)
+	dumpError := make(chan error, 1)
+	go func() {
+		value, err := json.Marshal(entry)
+		if err != nil {
+			dumpError <- err
+			return
+		}
+		member, err := json.Marshal(admin)
+		if err != nil {
+			dumpError <- err
+			return
+		}
+		_, err = s.DB.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Set(ctx, orgKeyPrefix+entry.ID, value, 0)
+			pipe.HSet(ctx, membersKeyPrefix+entry.ID, admin.UserID, member)
+			pipe.SAdd(ctx, orgsKeyPrefix+admin.UserID, entry.ID)
+			return nil
+		})
+		if err != nil {
+			dumpError <- &storageErrors.ExecutionRedisError{Err: err}
+			return
+		}
+		dumpDone <- true
+	}()
+
+	// wait for the first channel to retrieve a value
+	select {
+	case <-ctx.Done():
+		s.logger(ctx).Warn("Dumping organization", logger.Error(ctx.Err()))
+		return &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
+	case dmpError := <-dumpError:
+		s.logger(ctx).Warn("Dumping organization", logger.Error(dmpError))
+		return dmpError
+	case <-dumpDone:
+		s.logger(ctx).Debug("Dumping organization", logger.String("orgID", entry.ID))
+		return nil
+	}
+}
+
+// DumpMember stores a membership of a user in an existing organization, the role of a member is replaced keeping
+// their membership time.
+func (s *Storage) DumpMember(ctx context.Context, entry modelstorage.MemberEntry) error {
+	// create channels for listening to the go routine result
+	dumpDone := make(chan bool, 1)
+	dumpError := make(chan error, 1)
+	go func() {
+		key := membersKeyPrefix + entry.OrgID
+		// the transaction fails rather than overwrites a concurrent update of the membership
+		err := s.DB.Watch(ctx, func(tx *redis.Tx) error {
+			exists, err := tx.Exists(ctx, orgKeyPrefix+entry.OrgID).Result()
+			if err != nil {
+				return err
+			}
+			if exists == 0 {
+				return &storageErrors.OrgNotFoundError{Err: nil, ID: entry.OrgID}
+			}
+			value, err := tx.HGet(ctx, key, entry.UserID).Bytes()
+			if err != nil && !errors.Is(err, redis.Nil) {
+				return err
+			}
+			if err == nil {
+				var member modelstorage.MemberEntry
+				err = json.Unmarshal(value, &member)
+				if err != nil {
+					return err
+				}
+				entry.CreatedAt = member.CreatedAt
+			}
+			value, err = json.Marshal(entry)
+			if err != nil {
+				return err
+			}
+			_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+				pipe.HSet(ctx, key, entry.UserID, value)
+				pipe.SAdd(ctx, orgsKeyPrefix+entry.UserID, entry.OrgID)
+				return nil
+			})
+			return err
+		}, key)
+		if err != nil {
+			var orgNotFoundError *storageErrors.OrgNotFoundError
+			if errors.As(err, &orgNotFoundError) {
+				dumpError <- err
+				return
+			}
+			dumpError <- &storageErrors.ExecutionRedisError{Err: err}
+			return
+		}
+		dumpDone <- true
+	}()
+
+	// wait for the first channel to retrieve a value
+	select {
+	case <-ctx.Done():
+		s.logger(ctx).Warn("Dumping member", logger.Error(ctx.Err()))
+		return &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
+	case dmpError := <-dumpError:
+		s.logger(ctx).Warn("Dumping member", logger.Error(dmpError))
+		return dmpError
+	case <-dumpDone:
+		s.logger(ctx).Debug("Dumping member", logger.String("orgID", entry.OrgID), logger.String("userID", entry.UserID))
+		return nil
+	}
+}
+
+// DeleteMember removes userID from the organization orgID.
+func (s *Storage) DeleteMember(ctx context.Context, orgID, userID string) error {
+	// create channels for listening to the go routine result
+	deleteDone := make(chan bool, 1)
+	deleteError := make(chan error, 1)
+	go func() {
+		var removed *redis.IntCmd
+		_, err := s.DB.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			removed = pipe.HDel(ctx, membersKeyPrefix+orgID, userID)
+			pipe.SRem(ctx, orgsKeyPrefix+userID, orgID)
+			return nil
+		})
+		if err != nil {
+			deleteError <- &storageErrors.ExecutionRedisError{Err: err}
+			return
+		}
+		if removed.Val() == 0 {
+			deleteError <- &storageErrors.MemberNotFoundError{Err: nil, OrgID: orgID, UserID: userID}
+			return
+		}
+		deleteDone <- true
+	}()
+
+	// wait for the first channel to retrieve a value
+	select {
+	case <-ctx.Done():
+		s.logger(ctx).Warn("Deleting member", logger.Error(ctx.Err()))
+		return &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
+	case dltError := <-deleteError:
+		s.logger(ctx).Warn("Deleting member", logger.Error(dltError))
+		return dltError
+	case <-deleteDone:
+		s.logger(ctx).Debug("Deleting member", logger.String("orgID", orgID), logger.String("userID", userID))
+		return nil
+	}
+}
+
+// RetrieveOrg returns the organization id.
+func (s *Storage) RetrieveOrg(ctx context.Context, id string) (entry modelstorage.OrgEntry, err error) {
+	// create channels for listening to the go routine result
+	retrieveDone := make(chan modelstorage.OrgEntry, 1)
+	retrieveError := make(chan error, 1)
+	go func() {
+		value, err := s.DB.Get(ctx, orgKeyPrefix+id).Bytes()
+		if err != nil {
+			if errors.Is(err, redis.Nil) {
+				retrieveError <- &storageErrors.OrgNotFoundError{Err: nil, ID: id}
+				return
+			}
+			retrieveError <- &storageErrors.ExecutionRedisError{Err: err}
+			return
+		}
+		var org modelstorage.OrgEntry
+		err = json.Unmarshal(value, &org)
+		if err != nil {
+			retrieveError <- err
+			return
+		}
+		retrieveDone <- org
+	}()
+
+	// wait for the first channel to retrieve a value
+	select {
+	case <-ctx.Done():
+		s.logger(ctx).Warn("Retrieving organization", logger.Error(ctx.Err()))
+		return modelstorage.OrgEntry{}, &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
+	case rtrvError := <-retrieveError:
+		s.logger(ctx).Warn("Retrieving organization", logger.Error(rtrvError))
+		return modelstorage.OrgEntry{}, rtrvError
+	case org := <-retrieveDone:
+		s.logger(ctx).Debug("Retrieving organization", logger.String("orgID", org.ID))
+		return org, nil
+	}
+}
+
+// RetrieveMembers returns members of the organization orgID sorted by membership time.
+func (s *Storage) RetrieveMembers(ctx context.Context, orgID string) (entries []modelstorage.MemberEntry, err error) {
+	// create channels for listening to the go routine result
+	retrieveDone := make(chan []modelstorage.MemberEntry, 1)
+	retrieveError := make(chan error, 1)
+	go func() {
+		values, err := s.DB.HVals(ctx, membersKeyPrefix+orgID).Result()
+		if err != nil {
+			retrieveError <- &storageErrors.ExecutionRedisError{Err: err}
+			return
+		}
+		members := make([]modelstorage.MemberEntry, 0, len(values))
+		for _, value := range values {
+			var member modelstorage.MemberEntry
+			err = json.Unmarshal([]byte(value), &member)
+			if err != nil {
+				retrieveError <- err
+				return
+			}
+			members = append(members, member)
+		}
+		modelstorage.SortMembers(members)
+		retrieveDone <- members
+	}()
+
+	// wait for the first channel to retrieve a value
+	select {
+	case <-ctx.Done():
+		s.logger(ctx).Warn("Retrieving members", logger.Error(ctx.Err()))
+		return nil, &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
+	case rtrvError := <-retrieveError:
+		s.logger(ctx).Warn("Retrieving members", logger.Error(rtrvError))
+		return nil, rtrvError
+	case members := <-retrieveDone:
+		s.logger(ctx).Debug("Retrieving members", logger.String("orgID", orgID), logger.Int("count", len(members)))
+		return members, nil
+	}
+}
+
+// RetrieveMembershipsByUserID returns memberships of userID in organizations sorted by membership time.
+func (s *Storage) RetrieveMembershipsByUserID(ctx context.Context, userID string) (entries []modelstorage.MemberEntry, err error) {
+	// create channels for listening to the go routine result
+	retrieveDone := make(chan []modelstorage.MemberEntry, 1)
+	retrieveError := make(chan error, 1)
+	go func() {
+		orgIDs, err := s.DB.SMembers(ctx, orgsKeyPrefix+userID).Result()
+		if err != nil {
+			retrieveError <- &storageErrors.ExecutionRedisError{Err: err}
+			return
+		}
+		// fetch memberships in all organizations in one round-trip
+		cmds := make([]*redis.StringCmd, 0, len(orgIDs))
+		_, err = s.DB.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+			for _, orgID := range orgIDs {
+				cmds = append(cmds, pipe.HGet(ctx, membersKeyPrefix+orgID, userID))
+			}
+			return nil
+		})
+		if err != nil && !errors.Is(err, redis.Nil) {
+			retrieveError <- &storageErrors.ExecutionRedisError{Err: err}
+			return
+		}
+		memberships := make([]modelstorage.MemberEntry, 0, len(cmds))
+		for _, cmd := range cmds {
+			value, err := cmd.Bytes()
+			if err != nil {
+				continue
+			}
+			var member modelstorage.MemberEntry
+			err = json.Unmarshal(value, &member)
+			if err != nil {
+				retrieveError <- err
+				return
+			}
+			memberships = append(memberships, member)
+		}
+		modelstorage.SortMembers(memberships)
+		retrieveDone <- memberships
+	}()
+
+	// wait for the first channel to retrieve a value
+	select {
+	case <-ctx.Done():
+		s.logger(ctx).Warn("Retrieving memberships by user ID", logger.Error(ctx.Err()))
+		return nil, &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
+	case rtrvError := <-retrieveError:
+		s.logger(ctx).Warn("Retrieving memberships by user ID", logger.Error(rtrvError))
+		return nil, rtrvError
+	case memberships := <-retrieveDone:
+		s.logger(ctx).Debug("Retrieving memberships by user ID", logger.Int("count", len(memberships)))
+		return memberships, nil
+	}
+}
+
+// DumpAudit appends records of mutating operations to the audit list.
+func (s *Storage) DumpAudit(ctx context.Context, entries []modelstorage.AuditEntry) error {
+	// create channels for listening to the go routine result
+	dumpDone := make(chan bool, 1)
+	dumpError := make(chan error, 1)
+	go func() {
+		values := make([]interface{}, 0, len(entries))
+		for _, entry := range entries {
+			value, err := json.Marshal(entry)
+			if err != nil {
+				dumpError <- &storageErrors.ExecutionRedisError{Err: err}
+				return
+			}
+			values = append(values, value)
+		}
+		err := s.DB.RPush(ctx, auditKey, values...).Err()
+		if err != nil {
+			dumpError <- &storageErrors.ExecutionRedisError{Err: err}
+			return
+		}
+		dumpDone <- true
+	}()
+
+	// wait for the first channel to retrieve a value
+	select {
+	case <-ctx.Done():
+		s.logger(ctx).Warn("Dumping audit records", logger.Error(ctx.Err()))
+		return &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
+	case dmpError := <-dumpError:
+		s.logger(ctx).Warn("Dumping audit records", logger.Error(dmpError))
+		return dmpError
+	case <-dumpDone:
+		s.logger(ctx).Debug("Dumping audit records", logger.Int("count", len(entries)))
+		return nil
+	}
+}
+
+// RetrieveAudit returns a page of audit records matching filter sorted by creation time reading the whole audit list.
+func (s *Storage) RetrieveAudit(ctx context.Context, filter modelurl.AuditFilter, opts modelurl.ListOptions) (entries []modelstorage.AuditEntry, err error) {
+	// create channels for listening to the go routine result
+	retrieveDone := make(chan []modelstorage.AuditEntry, 1)
+	retrieveError := make(chan error, 1)
+	go func() {
+		values, err := s.DB.LRange(ctx, auditKey, 0, -1).Result()
+		if err != nil {
+			retrieveError <- &storageErrors.ExecutionRedisError{Err: err}
+			return
+		}
+		entries := make([]modelstorage.AuditEntry, 0, len(values))
+		for _, value := range values {
+			var entry modelstorage.AuditEntry
+			err = json.Unmarshal([]byte(value), &entry)
+			if err != nil {
+				retrieveError <- &storageErrors.ExecutionRedisError{Err: err}
+				return
+			}
+			entries = append(entries, entry)
+		}
+		retrieveDone <- modelstorage.PageAudit(entries, filter, opts)
+	}()
+
+	// wait for the first channel to retrieve a value
+	select {
+	case <-ctx.Done():
+		s.logger(ctx).Warn("Retrieving audit records", logger.Error(ctx.Err()))
+		return nil, &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
+	case rtrvError := <-retrieveError:
+		s.logger(ctx).Warn("Retrieving audit records", logger.Error(rtrvError))
+		return nil, rtrvError
+	case entries := <-retrieveDone:
+		s.logger(ctx).Debug("Retrieving audit records", logger.Int("count", len(entries)))
+		return entries, nil
+	}
+}
+
+// logger returns a request-scoped logger carried by ctx or the storage one.
+func (s *Storage) logger(ctx context.Context) *logger.Logger {
+	return logger.FromContext(ctx, s.log)
+}
+
+// PingDB performs DB ping.
+func (s *Storage) PingDB() error {
+	return s.DB.Ping(context.Background()).Err()
+}
+
+// CloseDB performs DB closure.
+func (s *Storage) CloseDB() error {
+	return s.DB.Close()
+}
@@ -0,0 +1,68 @@
+package inredis
+
+import (
+	"context"
+	"os"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/danilovkiri/dk_go_url_shortener/internal/config"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/storage/v2/modelstorage"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// initTestStorage initializes a Storage, tests are skipped unless REDIS_DSN points to a Redis DB.
+func initTestStorage(t *testing.T, cfg *config.StorageConfig) (st *Storage, cleanup func()) {
+	dsn := os.Getenv("REDIS_DSN")
+	if dsn == "" {
+		t.Skip("REDIS_DSN is not set")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	wg := &sync.WaitGroup{}
+	wg.Add(1)
+	cfg.RedisDSN = dsn
+	st, err := InitStorage(ctx, wg, cfg, nil)
+	require.NoError(t, err)
+	return st, func() {
+		cancel()
+		wg.Wait()
+	}
+}
+
+func TestFlushClicksBoundsStream(t *testing.T) {
+	cfg, err := config.NewStorageConfig()
+	require.NoError(t, err)
+	cfg.ClicksStreamMaxLen = 10
+	st, cleanup := initTestStorage(t, cfg)
+	defer cleanup()
+	ctx := context.Background()
+	sURL := "test-" + uuid.New().String()[:8]
+	defer st.DB.Del(ctx, clicksKeyPrefix+sURL, dailyKeyPrefix+sURL, hourlyKeyPrefix+sURL, referrersKeyPrefix+sURL, countriesKeyPrefix+sURL)
+
+	const batches, batchSize = 10, 100
+	for i := 0; i < batches; i++ {
+		clicks := make([]modelstorage.ClickEntry, batchSize)
+		for j := range clicks {
+			clicks[j] = modelstorage.ClickEntry{SURL: sURL, ClickedAt: time.Now()}
+		}
+		require.NoError(t, st.flushClicks(ctx, clicks))
+	}
+
+	// approximate trimming only removes whole stream nodes holding up to 100 records by default
+	length, err := st.DB.XLen(ctx, clicksKeyPrefix+sURL).Result()
+	require.NoError(t, err)
+	assert.LessOrEqual(t, length, cfg.ClicksStreamMaxLen+100)
+	daily, err := st.DB.HGetAll(ctx, dailyKeyPrefix+sURL).Result()
+	require.NoError(t, err)
+	var counted int
+	for _, count := range daily {
+		n, err := strconv.Atoi(count)
+		require.NoError(t, err)
+		counted += n
+	}
+	assert.Equal(t, batches*batchSize, counted)
+}
@@ -0,0 +1,413 @@
+// Package instrumented provides a storage.URLStorage wrapper measuring storage operations latency, tracing them and
+// reporting their failures.
+package instrumented
+
+import (
+	"context"
+	"errors"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/errreport"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/metrics"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/service/modelurl"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/storage/v2"
+	storageErrors "github.com/danilovkiri/dk_go_url_shortener/internal/storage/v2/errors"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/storage/v2/modelstorage"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/tracing"
+	"time"
+)
+
+// Storage struct wraps a storage.URLStorage, observes operations latency labelled by operation name, records a span
+// per operation and reports failures of the underlying DB or file.
+type Storage struct {
+	storage.URLStorage
+	latency  *metrics.HistogramVec
+	reporter *errreport.Reporter
+}
+
+// InitStorage initializes a Storage object wrapping st, failures are reported to reporter unless it is nil.
+func InitStorage(st storage.URLStorage, latency *metrics.HistogramVec, reporter *errreport.Reporter) *Storage {
+	return &Storage{URLStorage: st, latency: latency, reporter: reporter}
+}
+
+// Retrieve returns the live entry corresponding to sURL.
+func (s *Storage) Retrieve(ctx context.Context, sURL string) (entry modelstorage.URLMapEntry, err error) {
+	ctx, done := s.start(ctx, "retrieve")
+	defer func() { done(err) }()
+	return s.URLStorage.Retrieve(ctx, sURL)
+}
+
+// RetrieveOwner returns the user and the organization owning sURL.
+func (s *Storage) RetrieveOwner(ctx context.Context, sURL string) (userID, orgID string, err error) {
+	ctx, done := s.start(ctx, "retrieve_owner")
+	defer func() { done(err) }()
+	return s.URLStorage.RetrieveOwner(ctx, sURL)
+}
+
+// TakeClick counts a redirect of sURL limited to a number of clicks.
+func (s *Storage) TakeClick(ctx context.Context, sURL string) (err error) {
+	ctx, done := s.start(ctx, "take_click")
+	defer func() { done(err) }()
+	return s.URLStorage.TakeClick(ctx, sURL)
+}
+
+// RetrieveByUserID returns a page of URL:sURL pairs defined as modelurl.FullURL for one particular user ID.
+func (s *Storage) RetrieveByUserID(ctx context.Context, userID string, opts modelurl.ListOptions) (URLs []modelurl.FullURL, err error) {
+	ctx, done := s.start(ctx, "retrieve_by_user_id")
+	defer func() { done(err) }()
+	return s.URLStorage.RetrieveByUserID(ctx, userID, opts)
+}
+
+// SearchByUserID returns a page of URL:sURL pairs of one particular user matching search terms ranked by relevance.
+func (s *Storage) SearchByUserID(ctx context.Context, userID string, terms []string, opts modelurl.ListOptions) (URLs []modelurl.FullURL, err error) {
+	ctx, done := s.start(ctx, "search_by_user_id")
+	defer func() { done(err) }()
+	return s.URLStorage.SearchByUserID(ctx, userID, terms, opts)
+}
+
+// RetrieveByOrgID returns a page of URL:sURL pairs defined as modelurl.FullURL of one particular organization.
+func (s *Storage) RetrieveByOrgID(ctx context.Context, orgID string, opts modelurl.ListOptions) (URLs []modelurl.FullURL, err error) {
+	ctx, done := s.start(ctx, "retrieve_by_org_id")
+	defer func() { done(err) }()
+	return s.URLStorage.RetrieveByOrgID(ctx, orgID, opts)
+}
+
+// ExportByUserID passes every URL:sURL pair of one particular user to fn.
+func (s *Storage) ExportByUserID(ctx context.Context, userID string, fn func(URL modelurl.FullURL) error) (err error) {
+	ctx, done := s.start(ctx, "export_by_user_id")
+	defer func() { done(err) }()
+	return s.URLStorage.ExportByUserID(ctx, userID, fn)
+}
+
+// RetrieveServiceStats returns totals of stored URLs and their users.
+func (s *Storage) RetrieveServiceStats(ctx context.Context) (stats modelurl.ServiceStats, err error) {
+	ctx, done := s.start(ctx, "retrieve_service_stats")
+	defer func() { done(err) }()
+	return s.URLStorage.RetrieveServiceStats(ctx)
+}
+
+// RetrieveStats returns total and per-day redirect counts for sURL.
+func (s *Storage) RetrieveStats(ctx context.Context, sURL string, includeBots bool) (stats modelurl.URLStats, err error) {
+	ctx, done := s.start(ctx, "retrieve_stats")
+	defer func() { done(err) }()
+	return s.URLStorage.RetrieveStats(ctx, sURL, includeBots)
+}
+
+// RetrieveTimeSeries returns non-empty buckets of redirects of sURL within [from, to).
+func (s *Storage) RetrieveTimeSeries(ctx context.Context, sURL, granularity string, from, to time.Time, includeBots bool) (buckets []modelurl.ClickBucket, err error) {
+	ctx, done := s.start(ctx, "retrieve_time_series")
+	defer func() { done(err) }()
+	return s.URLStorage.RetrieveTimeSeries(ctx, sURL, granularity, from, to, includeBots)
+}
+
+// RetrieveReferrers returns top referrer domains of sURL and the number of its direct redirects.
+func (s *Storage) RetrieveReferrers(ctx context.Context, sURL string, limit int, includeBots bool) (stats modelurl.ReferrerStats, err error) {
+	ctx, done := s.start(ctx, "retrieve_referrers")
+	defer func() { done(err) }()
+	return s.URLStorage.RetrieveReferrers(ctx, sURL, limit, includeBots)
+}
+
+// RetrieveCountries returns redirect counts of sURL per visitor country.
+func (s *Storage) RetrieveCountries(ctx context.Context, sURL string, includeBots bool) (stats modelurl.CountryStats, err error) {
+	ctx, done := s.start(ctx, "retrieve_countries")
+	defer func() { done(err) }()
+	return s.URLStorage.RetrieveCountries(ctx, sURL, includeBots)
+}
+
+// RestoreBatch removes the deletion flag from entries of sURLs owned by userID.
+func (s *Storage) RestoreBatch(ctx context.Context, sURLs []string, userID string) (restored []string, err error) {
+	ctx, done := s.start(ctx, "restore_batch")
+	defer func() { done(err) }()
+	return s.URLStorage.RestoreBatch(ctx, sURLs, userID)
+}
+
+// DisableBatch marks entries of sURLs disabled.
+func (s *Storage) DisableBatch(ctx context.Context, sURLs []string) (disabled []string, err error) {
+	ctx, done := s.start(ctx, "disable_batch")
+	defer func() { done(err) }()
+	return s.URLStorage.DisableBatch(ctx, sURLs)
+}
+
+// ScanURLs passes every active URL:sURL pair to fn.
+func (s *Storage) ScanURLs(ctx context.Context, fn func(URL modelurl.FullURL) error) (err error) {
+	ctx, done := s.start(ctx, "scan_urls")
+	defer func() { done(err) }()
+	return s.URLStorage.ScanURLs(ctx, fn)
+}
+
+// Dump stores a pair of sURL and URL.
+func (s *Storage) Dump(ctx context.Context, entry modelstorage.URLStorageEntry) (err error) {
+	ctx, done := s.start(ctx, "dump")
+	defer func() { done(err) }()
+	return s.URLStorage.Dump(ctx, entry)
+}
+
+// DumpBatch stores a batch of sURL:URL pairs.
+func (s *Storage) DumpBatch(ctx context.Context, entries []modelstorage.URLStorageEntry) (stored []modelstorage.URLStorageEntry, err error) {
+	ctx, done := s.start(ctx, "dump_batch")
+	defer func() { done(err) }()
+	return s.URLStorage.DumpBatch(ctx, entries)
+}
+
+// UpdateMetadata sets the destination page title and favicon URL of sURL.
+func (s *Storage) UpdateMetadata(ctx context.Context, sURL, title, faviconURL string) (err error) {
+	ctx, done := s.start(ctx, "update_metadata")
+	defer func() { done(err) }()
+	return s.URLStorage.UpdateMetadata(ctx, sURL, title, faviconURL)
+}
+
+// UpdateURL changes the destination of sURL owned by userID to URL and returns the former destination.
+func (s *Storage) UpdateURL(ctx context.Context, sURL, userID, URL string) (previous string, err error) {
+	ctx, done := s.start(ctx, "update_url")
+	defer func() { done(err) }()
+	return s.URLStorage.UpdateURL(ctx, sURL, userID, URL)
+}
+
+// SetTags replaces tags of sURL owned by userID with tags.
+func (s *Storage) SetTags(ctx context.Context, sURL, userID string, tags []string) (err error) {
+	ctx, done := s.start(ctx, "set_tags")
+	defer func() { done(err) }()
+	return s.URLStorage.SetTags(ctx, sURL, userID, tags)
+}
+
+// RenameTag renames tag of links of userID to name.
+func (s *Storage) RenameTag(ctx context.Context, userID, tag, name string) (err error) {
+	ctx, done := s.start(ctx, "rename_tag")
+	defer func() { done(err) }()
+	return s.URLStorage.RenameTag(ctx, userID, tag, name)
+}
+
+// RetrieveTags returns tags of live links of userID along with the number of links tagged with each of them.
+func (s *Storage) RetrieveTags(ctx context.Context, userID string) (tags []modelurl.Tag, err error) {
+	ctx, done := s.start(ctx, "retrieve_tags")
+	defer func() { done(err) }()
+	return s.URLStorage.RetrieveTags(ctx, userID)
+}
+
+// ImportBatch stores a batch of imported URL entries.
+func (s *Storage) ImportBatch(ctx context.Context, entries []modelstorage.URLStorageEntry) (results []modelstorage.ImportResult, err error) {
+	ctx, done := s.start(ctx, "import_batch")
+	defer func() { done(err) }()
+	return s.URLStorage.ImportBatch(ctx, entries)
+}
+
+// DumpUser stores a new user account.
+func (s *Storage) DumpUser(ctx context.Context, entry modelstorage.UserEntry) (err error) {
+	ctx, done := s.start(ctx, "dump_user")
+	defer func() { done(err) }()
+	return s.URLStorage.DumpUser(ctx, entry)
+}
+
+// SetUserRole sets the role of the account registered with login.
+func (s *Storage) SetUserRole(ctx context.Context, login, role string) (err error) {
+	ctx, done := s.start(ctx, "set_user_role")
+	defer func() { done(err) }()
+	return s.URLStorage.SetUserRole(ctx, login, role)
+}
+
+// RetrieveUser returns the user account registered with login.
+func (s *Storage) RetrieveUser(ctx context.Context, login string) (entry modelstorage.UserEntry, err error) {
+	ctx, done := s.start(ctx, "retrieve_user")
+	defer func() { done(err) }()
+	return s.URLStorage.RetrieveUser(ctx, login)
+}
+
+// RetrieveUsersByUserID returns user accounts registered by userID.
+func (s *Storage) RetrieveUsersByUserID(ctx context.Context, userID string) (entries []modelstorage.UserEntry, err error) {
+	ctx, done := s.start(ctx, "retrieve_users_by_user_id")
+	defer func() { done(err) }()
+	return s.URLStorage.RetrieveUsersByUserID(ctx, userID)
+}
+
+// DumpUserSettings stores settings of a user replacing the previous ones.
+func (s *Storage) DumpUserSettings(ctx context.Context, entry modelstorage.UserSettingsEntry) (err error) {
+	ctx, done := s.start(ctx, "dump_user_settings")
+	defer func() { done(err) }()
+	return s.URLStorage.DumpUserSettings(ctx, entry)
+}
+
+// RetrieveUserSettings returns settings of userID.
+func (s *Storage) RetrieveUserSettings(ctx context.Context, userID string) (entry modelstorage.UserSettingsEntry, err error) {
+	ctx, done := s.start(ctx, "retrieve_user_settings")
+	defer func() { done(err) }()
+	return s.URLStorage.RetrieveUserSettings(ctx, userID)
+}
+
+// EraseUser permanently removes all data of userID.
+func (s *Storage) EraseUser(ctx context.Context, userID string) (err error) {
+	ctx, done := s.start(ctx, "erase_user")
+	defer func() { done(err) }()
+	return s.URLStorage.EraseUser(ctx, userID)
+}
+
+// SearchURLs returns a page of URLs of all users whose URL or sURL contains query.
+func (s *Storage) SearchURLs(ctx context.Context, query string, opts modelurl.ListOptions) (URLs []modelurl.FullURL, err error) {
+	ctx, done := s.start(ctx, "search_urls")
+	defer func() { done(err) }()
+	return s.URLStorage.SearchURLs(ctx, query, opts)
+}
+
+// RetrieveUsers returns a page of user accounts sorted by login.
+func (s *Storage) RetrieveUsers(ctx context.Context, opts modelurl.ListOptions) (entries []modelstorage.UserEntry, err error) {
+	ctx, done := s.start(ctx, "retrieve_users")
+	defer func() { done(err) }()
+	return s.URLStorage.RetrieveUsers(ctx, opts)
+}
+
+// RetrieveUserStats returns totals of links of userID and their redirects.
+func (s *Storage) RetrieveUserStats(ctx context.Context, userID string) (stats modelurl.UserStats, err error) {
+	ctx, done := s.start(ctx, "retrieve_user_stats")
+	defer func() { done(err) }()
+	return s.URLStorage.RetrieveUserStats(ctx, userID)
+}
+
+// DumpAudit stores records of mutating operations.
+func (s *Storage) DumpAudit(ctx context.Context, entries []modelstorage.AuditEntry) (err error) {
+	ctx, done := s.start(ctx, "dump_audit")
+	defer func() { done(err) }()
+	return s.URLStorage.DumpAudit(ctx, entries)
+}
+
+// RetrieveAudit returns a page of records of mutating operations matching filter sorted by creation time.
+func (s *Storage) RetrieveAudit(ctx context.Context, filter modelurl.AuditFilter, opts modelurl.ListOptions) (entries []modelstorage.AuditEntry, err error) {
+	ctx, done := s.start(ctx, "retrieve_audit")
+	defer func() { done(err) }()
+	return s.URLStorage.RetrieveAudit(ctx, filter, opts)
+}
+
+// DumpAPIKey stores a new API key.
+func (s *Storage) DumpAPIKey(ctx context.Context, entry modelstorage.APIKeyEntry) (err error) {
+	ctx, done := s.start(ctx, "dump_api_key")
+	defer func() { done(err) }()
+	return s.URLStorage.DumpAPIKey(ctx, entry)
+}
+
+// RevokeAPIKey marks the API key with id owned by userID revoked.
+func (s *Storage) RevokeAPIKey(ctx context.Context, id, userID string) (err error) {
+	ctx, done := s.start(ctx, "revoke_api_key")
+	defer func() { done(err) }()
+	return s.URLStorage.RevokeAPIKey(ctx, id, userID)
+}
+
+// RetrieveAPIKey returns the API key with the given hash.
+func (s *Storage) RetrieveAPIKey(ctx context.Context, hash string) (entry modelstorage.APIKeyEntry, err error) {
+	ctx, done := s.start(ctx, "retrieve_api_key")
+	defer func() { done(err) }()
+	return s.URLStorage.RetrieveAPIKey(ctx, hash)
+}
+
+// RetrieveAPIKeysByUserID returns API keys of userID.
+func (s *Storage) RetrieveAPIKeysByUserID(ctx context.Context, userID string) (entries []modelstorage.APIKeyEntry, err error) {
+	ctx, done := s.start(ctx, "retrieve_api_keys_by_user_id")
+	defer func() { done(err) }()
+	return s.URLStorage.RetrieveAPIKeysByUserID(ctx, userID)
+}
+
+// DumpDomain stores a new custom domain.
+func (s *Storage) DumpDomain(ctx context.Context, entry modelstorage.DomainEntry) (err error) {
+	ctx, done := s.start(ctx, "dump_domain")
+	defer func() { done(err) }()
+	return s.URLStorage.DumpDomain(ctx, entry)
+}
+
+// VerifyDomain marks the custom domain name claimed by userID verified.
+func (s *Storage) VerifyDomain(ctx context.Context, name, userID string) (err error) {
+	ctx, done := s.start(ctx, "verify_domain")
+	defer func() { done(err) }()
+	return s.URLStorage.VerifyDomain(ctx, name, userID)
+}
+
+// RetrieveDomain returns the verified custom domain name.
+func (s *Storage) RetrieveDomain(ctx context.Context, name string) (entry modelstorage.DomainEntry, err error) {
+	ctx, done := s.start(ctx, "retrieve_domain")
+	defer func() { done(err) }()
+	return s.URLStorage.RetrieveDomain(ctx, name)
+}
+
+// RetrieveDomainClaim returns the claim of the custom domain name by userID.
+func (s *Storage) RetrieveDomainClaim(ctx context.Context, name, userID string) (entry modelstorage.DomainEntry, err error) {
+	ctx, done := s.start(ctx, "retrieve_domain_claim")
+	defer func() { done(err) }()
+	return s.URLStorage.RetrieveDomainClaim(ctx, name, userID)
+}
+
+// RetrieveDomainsByUserID returns custom domains of userID.
+func (s *Storage) RetrieveDomainsByUserID(ctx context.Context, userID string) (entries []modelstorage.DomainEntry, err error) {
+	ctx, done := s.start(ctx, "retrieve_domains_by_user_id")
+	defer func() { done(err) }()
+	return s.URLStorage.RetrieveDomainsByUserID(ctx, userID)
+}
+
+// RetrieveVerifiedDomains returns names of all verified custom domains.
+func (s *Storage) RetrieveVerifiedDomains(ctx context.Context) (names []string, err error) {
+	ctx, done := s.start(ctx, "retrieve_verified_domains")
+	defer func() { done(err) }()
+	return s.URLStorage.RetrieveVerifiedDomains(ctx)
+}
+
+// DumpOrg stores a new organization along with its first admin.
+func (s *Storage) DumpOrg(ctx context.Context, entry modelstorage.OrgEntry, admin modelstorage.MemberEntry) (err error) {
+	ctx, done := s.start(ctx, "dump_org")
+	defer func() { done(err) }()
+	return s.URLStorage.DumpOrg(ctx, entry, admin)
+}
+
+// DumpMember stores a membership of a user in an organization.
+func (s *Storage) DumpMember(ctx context.Context, entry modelstorage.MemberEntry) (err error) {
+	ctx, done := s.start(ctx, "dump_member")
+	defer func() { done(err) }()
+	return s.URLStorage.DumpMember(ctx, entry)
+}
+
+// DeleteMember removes userID from the organization orgID.
+func (s *Storage) DeleteMember(ctx context.Context, orgID, userID string) (err error) {
+	ctx, done := s.start(ctx, "delete_member")
+	defer func() { done(err) }()
+	return s.URLStorage.DeleteMember(ctx, orgID, userID)
+}
+
+// RetrieveOrg returns the organization id.
+func (s *Storage) RetrieveOrg(ctx context.Context, id string) (entry modelstorage.OrgEntry, err error) {
+	ctx, done := s.start(ctx, "retrieve_org")
+	defer func() { done(err) }()
+	return s.URLStorage.RetrieveOrg(ctx, id)
+}
+
+// RetrieveMembers returns members of the organization orgID.
+func (s *Storage) RetrieveMembers(ctx context.Context, orgID string) (entries []modelstorage.MemberEntry, err error) {
+	ctx, done := s.start(ctx, "retrieve_members")
+	defer func() { done(err) }()
+	return s.URLStorage.RetrieveMembers(ctx, orgID)
+}
+
+// RetrieveMembershipsByUserID returns memberships of userID in organizations.
+func (s *Storage) RetrieveMembershipsByUserID(ctx context.Context, userID string) (entries []modelstorage.MemberEntry, err error) {
+	ctx, done := s.start(ctx, "retrieve_memberships_by_user_id")
+	defer func() { done(err) }()
+	return s.URLStorage.RetrieveMembershipsByUserID(ctx, userID)
+}
+
+// start starts a client span of the given operation and returns a function ending it, recording the operation
+// latency and reporting its failure.
+func (s *Storage) start(ctx context.Context, operation string) (context.Context, func(err error)) {
+	start := time.Now()
+	ctx, span := tracing.Start(ctx, "storage."+operation, tracing.KindClient, tracing.String("db.operation", operation))
+	return ctx, func(err error) {
+		span.End(err)
+		s.latency.Observe(operation, time.Since(start).Seconds())
+		if isFailure(err) {
+			s.reporter.Report(err, map[string]string{"operation": operation})
+		}
+	}
+}
+
+// isFailure reports whether err is a failure of the underlying DB or file rather than an outcome of the operation,
+// e.g. a link not found, or a timeout of the request.
+func isFailure(err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) {
+		return false
+	}
+	return errors.As(err, new(*storageErrors.ExecutionPSQLError)) ||
+		errors.As(err, new(*storageErrors.StatementPSQLError)) ||
+		errors.As(err, new(*storageErrors.ScanningPSQLError)) ||
+		errors.As(err, new(*storageErrors.ExecutionRedisError)) ||
+		errors.As(err, new(*storageErrors.FileWriteError))
+}
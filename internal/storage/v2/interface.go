@@ -3,29 +3,205 @@ package storage
 
 import (
 	"context"
+	"database/sql"
 	"github.com/danilovkiri/dk_go_url_shortener/internal/service/modelurl"
 	"github.com/danilovkiri/dk_go_url_shortener/internal/storage/v2/modelstorage"
+	"time"
 )
 
 // URLSetter defines a set of methods for types implementing URLSetter.
 type URLSetter interface {
-	Dump(ctx context.Context, URL string, sURL string, userID string) error
+	Dump(ctx context.Context, entry modelstorage.URLStorageEntry) error
+	DumpBatch(ctx context.Context, entries []modelstorage.URLStorageEntry) ([]modelstorage.URLStorageEntry, error)
+}
+
+// URLMetadataSetter defines a set of methods for types implementing URLMetadataSetter.
+type URLMetadataSetter interface {
+	UpdateMetadata(ctx context.Context, sURL, title, faviconURL string) error
+}
+
+// URLEditor defines a set of methods for types implementing URLEditor.
+type URLEditor interface {
+	UpdateURL(ctx context.Context, sURL, userID, URL string) (previous string, err error)
+}
+
+// TagSetter defines a set of methods for types implementing TagSetter.
+type TagSetter interface {
+	SetTags(ctx context.Context, sURL, userID string, tags []string) error
+	RenameTag(ctx context.Context, userID, tag, name string) error
+}
+
+// TagGetter defines a set of methods for types implementing TagGetter.
+type TagGetter interface {
+	RetrieveTags(ctx context.Context, userID string) (tags []modelurl.Tag, err error)
+}
+
+// URLImporter defines a set of methods for types implementing URLImporter.
+type URLImporter interface {
+	ImportBatch(ctx context.Context, entries []modelstorage.URLStorageEntry) ([]modelstorage.ImportResult, error)
 }
 
 // URLBatchDeleter defines a set of methods for types implementing URLBatchDeleter.
 type URLBatchDeleter interface {
 	DeleteBatch(ctx context.Context, sURLs []string, userID string) error
-	SendToQueue(item modelstorage.URLChannelEntry)
+	SendToQueue(ctx context.Context, items []modelstorage.URLChannelEntry) error
+	QueueDepth() int
+}
+
+// URLBatchRestorer defines a set of methods for types implementing URLBatchRestorer.
+type URLBatchRestorer interface {
+	RestoreBatch(ctx context.Context, sURLs []string, userID string) (restored []string, err error)
+}
+
+// URLBatchDisabler defines a set of methods for types implementing URLBatchDisabler.
+type URLBatchDisabler interface {
+	DisableBatch(ctx context.Context, sURLs []string) (disabled []string, err error)
+}
+
+// URLScanner defines a set of methods for types implementing URLScanner.
+type URLScanner interface {
+	ScanURLs(ctx context.Context, fn func(URL modelurl.FullURL) error) error
 }
 
 // URLGetter defines a set of methods for types implementing URLGetter.
 type URLGetter interface {
-	Retrieve(ctx context.Context, sURL string) (URL string, err error)
+	Retrieve(ctx context.Context, sURL string) (entry modelstorage.URLMapEntry, err error)
+	// RetrieveOwner returns the user who created sURL and the organization it belongs to whatever the state of the
+	// link, NotFoundError is reported for unknown sURLs only.
+	RetrieveOwner(ctx context.Context, sURL string) (userID, orgID string, err error)
+}
+
+// ClickLimiter defines a set of methods for types implementing ClickLimiter.
+type ClickLimiter interface {
+	TakeClick(ctx context.Context, sURL string) error
 }
 
 // URLGetterByUserID defines a set of methods for types implementing URLGetterByUserID.
 type URLGetterByUserID interface {
-	RetrieveByUserID(ctx context.Context, userID string) (URLs []modelurl.FullURL, err error)
+	RetrieveByUserID(ctx context.Context, userID string, opts modelurl.ListOptions) (URLs []modelurl.FullURL, err error)
+	SearchByUserID(ctx context.Context, userID string, terms []string, opts modelurl.ListOptions) (URLs []modelurl.FullURL, err error)
+}
+
+// URLGetterByOrgID defines a set of methods for types implementing URLGetterByOrgID.
+type URLGetterByOrgID interface {
+	RetrieveByOrgID(ctx context.Context, orgID string, opts modelurl.ListOptions) (URLs []modelurl.FullURL, err error)
+}
+
+// URLExporter defines a set of methods for types implementing URLExporter.
+type URLExporter interface {
+	ExportByUserID(ctx context.Context, userID string, fn func(URL modelurl.FullURL) error) error
+}
+
+// ClickRecorder defines a set of methods for types implementing ClickRecorder.
+type ClickRecorder interface {
+	SendClick(item modelstorage.ClickEntry)
+}
+
+// URLStatsGetter defines a set of methods for types implementing URLStatsGetter.
+type URLStatsGetter interface {
+	// RetrieveStats returns redirect counts of sURL, redirects of bots are only counted with includeBots and are never
+	// counted as unique visitors.
+	RetrieveStats(ctx context.Context, sURL string, includeBots bool) (stats modelurl.URLStats, err error)
+	// RetrieveTimeSeries returns non-empty buckets of redirects of sURL within [from, to) sorted by time, from and to
+	// are aligned to buckets of granularity.
+	RetrieveTimeSeries(ctx context.Context, sURL, granularity string, from, to time.Time, includeBots bool) (buckets []modelurl.ClickBucket, err error)
+	// RetrieveReferrers returns up to limit referrer domains of sURL with the most redirects along with the number of
+	// direct redirects.
+	RetrieveReferrers(ctx context.Context, sURL string, limit int, includeBots bool) (stats modelurl.ReferrerStats, err error)
+	// RetrieveCountries returns redirect counts of sURL per visitor country along with the number of redirects of
+	// visitors whose country was not resolved.
+	RetrieveCountries(ctx context.Context, sURL string, includeBots bool) (stats modelurl.CountryStats, err error)
+}
+
+// ServiceStatsGetter defines a set of methods for types implementing ServiceStatsGetter.
+type ServiceStatsGetter interface {
+	RetrieveServiceStats(ctx context.Context) (stats modelurl.ServiceStats, err error)
+}
+
+// UserSetter defines a set of methods for types implementing UserSetter.
+type UserSetter interface {
+	DumpUser(ctx context.Context, entry modelstorage.UserEntry) error
+	// SetUserRole sets the role of the account registered with login, empty role revokes the current one.
+	SetUserRole(ctx context.Context, login, role string) error
+}
+
+// UserGetter defines a set of methods for types implementing UserGetter.
+type UserGetter interface {
+	RetrieveUser(ctx context.Context, login string) (entry modelstorage.UserEntry, err error)
+	RetrieveUsersByUserID(ctx context.Context, userID string) (entries []modelstorage.UserEntry, err error)
+}
+
+// UserSettingsSetter defines a set of methods for types implementing UserSettingsSetter.
+type UserSettingsSetter interface {
+	DumpUserSettings(ctx context.Context, entry modelstorage.UserSettingsEntry) error
+}
+
+// UserSettingsGetter defines a set of methods for types implementing UserSettingsGetter.
+type UserSettingsGetter interface {
+	// RetrieveUserSettings returns settings of userID, users who never changed them get an entry without settings.
+	RetrieveUserSettings(ctx context.Context, userID string) (entry modelstorage.UserSettingsEntry, err error)
+}
+
+// UserEraser defines a set of methods for types implementing UserEraser.
+type UserEraser interface {
+	EraseUser(ctx context.Context, userID string) error
+}
+
+// APIKeySetter defines a set of methods for types implementing APIKeySetter.
+type APIKeySetter interface {
+	DumpAPIKey(ctx context.Context, entry modelstorage.APIKeyEntry) error
+	RevokeAPIKey(ctx context.Context, id, userID string) error
+}
+
+// APIKeyGetter defines a set of methods for types implementing APIKeyGetter.
+type APIKeyGetter interface {
+	RetrieveAPIKey(ctx context.Context, hash string) (entry modelstorage.APIKeyEntry, err error)
+	RetrieveAPIKeysByUserID(ctx context.Context, userID string) (entries []modelstorage.APIKeyEntry, err error)
+}
+
+// DomainSetter defines a set of methods for types implementing DomainSetter.
+type DomainSetter interface {
+	DumpDomain(ctx context.Context, entry modelstorage.DomainEntry) error
+	VerifyDomain(ctx context.Context, name, userID string) error
+}
+
+// DomainGetter defines a set of methods for types implementing DomainGetter.
+type DomainGetter interface {
+	RetrieveDomain(ctx context.Context, name string) (entry modelstorage.DomainEntry, err error)
+	RetrieveDomainClaim(ctx context.Context, name, userID string) (entry modelstorage.DomainEntry, err error)
+	RetrieveDomainsByUserID(ctx context.Context, userID string) (entries []modelstorage.DomainEntry, err error)
+	RetrieveVerifiedDomains(ctx context.Context) (names []string, err error)
+}
+
+// OrgSetter defines a set of methods for types implementing OrgSetter.
+type OrgSetter interface {
+	DumpOrg(ctx context.Context, entry modelstorage.OrgEntry, admin modelstorage.MemberEntry) error
+	DumpMember(ctx context.Context, entry modelstorage.MemberEntry) error
+	DeleteMember(ctx context.Context, orgID, userID string) error
+}
+
+// OrgGetter defines a set of methods for types implementing OrgGetter.
+type OrgGetter interface {
+	RetrieveOrg(ctx context.Context, id string) (entry modelstorage.OrgEntry, err error)
+	RetrieveMembers(ctx context.Context, orgID string) (entries []modelstorage.MemberEntry, err error)
+	RetrieveMembershipsByUserID(ctx context.Context, userID string) (entries []modelstorage.MemberEntry, err error)
+}
+
+// AdminGetter defines a set of methods for types implementing AdminGetter.
+type AdminGetter interface {
+	SearchURLs(ctx context.Context, query string, opts modelurl.ListOptions) (URLs []modelurl.FullURL, err error)
+	RetrieveUsers(ctx context.Context, opts modelurl.ListOptions) (entries []modelstorage.UserEntry, err error)
+	RetrieveUserStats(ctx context.Context, userID string) (stats modelurl.UserStats, err error)
+}
+
+// AuditSetter defines a set of methods for types implementing AuditSetter.
+type AuditSetter interface {
+	DumpAudit(ctx context.Context, entries []modelstorage.AuditEntry) error
+}
+
+// AuditGetter defines a set of methods for types implementing AuditGetter.
+type AuditGetter interface {
+	RetrieveAudit(ctx context.Context, filter modelurl.AuditFilter, opts modelurl.ListOptions) (entries []modelstorage.AuditEntry, err error)
 }
 
 // Pinger defines a set of methods for types implementing Pinger.
@@ -38,12 +214,74 @@ type Closer interface {
 	CloseDB() error
 }
 
+// CacheStatsGetter defines a set of methods for storages with a cache, it is not a part of URLStorage.
+type CacheStatsGetter interface {
+	CacheStats() (hits, misses uint64)
+}
+
+// DBStatsGetter defines a set of methods for storages backed by a SQL DB, it is not a part of URLStorage.
+type DBStatsGetter interface {
+	DBStats() sql.DBStats
+}
+
+// SURLScanner defines a set of methods for storages listing sURLs of all their entries whatever their state, it is
+// not a part of URLStorage.
+type SURLScanner interface {
+	ScanSURLs(ctx context.Context, fn func(sURL string) error) error
+}
+
+// EntryScanner defines a set of methods for storages listing all their entries whatever their state along with their
+// deletion flag, it is not a part of URLStorage.
+type EntryScanner interface {
+	ScanEntries(ctx context.Context, fn func(entry modelstorage.URLStorageEntry, deleted bool) error) error
+}
+
+// DeleteWorkersSetter defines a set of methods for storages whose number of delete workers can be changed while
+// running, it is not a part of URLStorage.
+type DeleteWorkersSetter interface {
+	SetDeleteWorkers(n int)
+}
+
+// EventNotifier defines a set of methods for storages reporting lifecycle events of entries they delete, disable or
+// purge in the background, it is not a part of URLStorage.
+type EventNotifier interface {
+	SetEventHandler(fn func(event modelurl.Event))
+}
+
 // URLStorage defines a set of embedded interfaces for types implementing URLStorage.
 type URLStorage interface {
 	URLSetter
+	URLMetadataSetter
+	URLEditor
+	TagSetter
+	TagGetter
+	URLImporter
 	URLBatchDeleter
+	URLBatchRestorer
+	URLBatchDisabler
 	URLGetter
 	URLGetterByUserID
+	URLGetterByOrgID
+	URLExporter
+	URLScanner
+	ClickRecorder
+	ClickLimiter
+	URLStatsGetter
+	ServiceStatsGetter
+	UserSetter
+	UserGetter
+	UserSettingsSetter
+	UserSettingsGetter
+	UserEraser
+	APIKeySetter
+	APIKeyGetter
+	DomainSetter
+	DomainGetter
+	OrgSetter
+	OrgGetter
+	AdminGetter
+	AuditSetter
+	AuditGetter
 	Pinger
 	Closer
 }
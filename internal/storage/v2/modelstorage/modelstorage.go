@@ -1,26 +1,760 @@
 // Package modelstorage provides locally used types and their structure for storage objects.
 package modelstorage
 
+import (
+	"database/sql"
+	"encoding/json"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/service/modelurl"
+	"github.com/google/uuid"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+	"unicode"
+)
+
 type URLStorageEntry struct {
-	SURL   string `json:"sURL"`
-	URL    string `json:"URL"`
-	UserID string `json:"userID"`
+	SURL      string     `json:"sURL"`
+	URL       string     `json:"URL"`
+	UserID    string     `json:"userID"`
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+	// RedirectType overrides the globally configured redirect status code, zero means no override.
+	RedirectType int `json:"redirectType,omitempty"`
+	// CreatedAt is set by storages when the entry is stored, it is missing in entries stored before it was added.
+	CreatedAt *time.Time `json:"createdAt,omitempty"`
+	// Title and FaviconURL describe the destination page once its metadata is fetched.
+	Title      string `json:"title,omitempty"`
+	FaviconURL string `json:"faviconURL,omitempty"`
+	// DisabledAt is set once the destination is found unsafe, disabled entries are not redirected to.
+	DisabledAt *time.Time `json:"disabledAt,omitempty"`
+	// PasswordHash holds a bcrypt hash of the password protecting the link, links without one are not protected.
+	PasswordHash string `json:"passwordHash,omitempty"`
+	// MaxClicks limits the number of redirects, zero means no limit. ClickCount counts redirects of limited links only.
+	MaxClicks  int `json:"maxClicks,omitempty"`
+	ClickCount int `json:"clickCount,omitempty"`
+	// ActiveFrom delays redirects until the given time, the link is active since creation if it is unset.
+	ActiveFrom *time.Time `json:"activeFrom,omitempty"`
+	// Destinations splits redirects of the link by weight, URL is the first of them. Sticky serves every visitor the
+	// same destination.
+	Destinations []modelurl.Destination `json:"destinations,omitempty"`
+	Sticky       bool                   `json:"sticky,omitempty"`
+	// GeoTargets maps country codes of visitors to the URLs they are redirected to instead of the default one.
+	GeoTargets map[string]string `json:"geoTargets,omitempty"`
+	// DeviceTargets maps visitor devices to the URLs they are redirected to instead of the default one.
+	DeviceTargets map[string]string `json:"deviceTargets,omitempty"`
+	// Domain is the custom domain the link is served on, links without one are served on the base URL host.
+	Domain string `json:"domain,omitempty"`
+	// OrgID is the organization the link belongs to, its members share the link with its creator.
+	OrgID string `json:"orgID,omitempty"`
+	// Tags label the link for filtering links of its creator, they are kept sorted by name.
+	Tags []string `json:"tags,omitempty"`
+	// UTM maps UTM parameter names to the values appended to the query of destinations on redirect.
+	UTM map[string]string `json:"utm,omitempty"`
+	// LastAccessedAt is set by storages to the time of the latest redirect of the link.
+	LastAccessedAt *time.Time `json:"lastAccessedAt,omitempty"`
+	// ArchivedAt is set by storages archiving the link after it was unused for a while, see ArchivePolicy.
+	ArchivedAt *time.Time `json:"archivedAt,omitempty"`
+	// EditedAt is set by storages to the time the destination of the link was last changed.
+	EditedAt *time.Time `json:"editedAt,omitempty"`
 }
 
 type URLMapEntry struct {
-	URL    string
-	UserID string
+	URL            string
+	UserID         string
+	ExpiresAt      *time.Time
+	RedirectType   int
+	CreatedAt      time.Time
+	Title          string
+	FaviconURL     string
+	DisabledAt     *time.Time
+	PasswordHash   string
+	MaxClicks      int
+	ClickCount     int
+	ActiveFrom     *time.Time
+	Destinations   []modelurl.Destination
+	Sticky         bool
+	GeoTargets     map[string]string
+	DeviceTargets  map[string]string
+	Domain         string
+	OrgID          string
+	Tags           []string
+	UTM            map[string]string
+	LastAccessedAt *time.Time
+	ArchivedAt     *time.Time
+	EditedAt       *time.Time
 }
 
 type URLPostgresEntry struct {
-	ID        uint   `db:"id"`
-	UserID    string `db:"user_id"` // store as a string since we store encoded tokens
-	URL       string `db:"url"`
-	SURL      string `db:"short_url"`
-	IsDeleted bool   `db:"is_deleted"`
+	ID             uint           `db:"id"`
+	UserID         string         `db:"user_id"` // store as a string since we store encoded tokens
+	URL            string         `db:"url"`
+	SURL           string         `db:"short_url"`
+	IsDeleted      bool           `db:"is_deleted"`
+	ExpiresAt      sql.NullTime   `db:"expires_at"`
+	RedirectType   int            `db:"redirect_type"`
+	DisabledAt     sql.NullTime   `db:"disabled_at"`
+	Title          sql.NullString `db:"title"`
+	FaviconURL     sql.NullString `db:"favicon_url"`
+	PasswordHash   sql.NullString `db:"password_hash"`
+	MaxClicks      int            `db:"max_clicks"`
+	ClickCount     int            `db:"click_count"`
+	ActiveFrom     sql.NullTime   `db:"active_from"`
+	Destinations   sql.NullString `db:"destinations"` // JSON-encoded destinations of split links
+	Sticky         bool           `db:"sticky"`
+	GeoTargets     sql.NullString `db:"geo_targets"`    // JSON-encoded country codes to URLs
+	DeviceTargets  sql.NullString `db:"device_targets"` // JSON-encoded devices to URLs
+	Domain         sql.NullString `db:"domain"`
+	OrgID          sql.NullString `db:"org_id"`
+	Tags           []string       `db:"tags"`
+	UTM            sql.NullString `db:"utm"` // JSON-encoded UTM parameter names to values
+	CreatedAt      sql.NullTime   `db:"created_at"`
+	LastAccessedAt sql.NullTime   `db:"last_accessed_at"`
+	ArchivedAt     sql.NullTime   `db:"archived_at"`
+	EditedAt       sql.NullTime   `db:"edited_at"`
+}
+
+// IsExpired reports whether a link with the given expiration time has expired by now.
+func IsExpired(expiresAt *time.Time) bool {
+	return expiresAt != nil && !expiresAt.After(time.Now())
+}
+
+// IsNotActive reports whether a link with the given activation time is not active yet.
+func IsNotActive(activeFrom *time.Time) bool {
+	return activeFrom != nil && activeFrom.After(time.Now())
+}
+
+// IsExhausted reports whether a link limited to maxClicks redirects has been redirected clickCount times to the limit.
+func IsExhausted(maxClicks, clickCount int) bool {
+	return maxClicks > 0 && clickCount >= maxClicks
+}
+
+// ArchivePolicy defines when links neither created nor redirected to for a while are archived. Owners of such links
+// are noticed NoticeBefore ahead of archiving unless it is zero, links are then archived no earlier than NoticeBefore
+// after the notice even if they have been unused for longer.
+type ArchivePolicy struct {
+	StaleAfter   time.Duration
+	NoticeBefore time.Duration
+}
+
+// Review reports whether the owner of a live unarchived link last accessed at accessedAt and noticed at noticedAt,
+// nil if not noticed yet, is to be noticed or the link is to be archived at now.
+func (p ArchivePolicy) Review(now, accessedAt time.Time, noticedAt *time.Time) (notice, archive bool) {
+	staleBefore := now.Add(-p.StaleAfter)
+	switch {
+	case p.NoticeBefore <= 0:
+		return false, !accessedAt.After(staleBefore)
+	case noticedAt == nil:
+		return !accessedAt.After(staleBefore.Add(p.NoticeBefore)), false
+	default:
+		return false, !accessedAt.After(staleBefore) && !noticedAt.After(now.Add(-p.NoticeBefore))
+	}
+}
+
+// StorageEntry converts the in-memory representation of sURL entry back into its stored record.
+func StorageEntry(sURL string, mapped URLMapEntry) URLStorageEntry {
+	entry := URLStorageEntry{
+		SURL:           sURL,
+		URL:            mapped.URL,
+		UserID:         mapped.UserID,
+		ExpiresAt:      mapped.ExpiresAt,
+		RedirectType:   mapped.RedirectType,
+		Title:          mapped.Title,
+		FaviconURL:     mapped.FaviconURL,
+		DisabledAt:     mapped.DisabledAt,
+		PasswordHash:   mapped.PasswordHash,
+		MaxClicks:      mapped.MaxClicks,
+		ClickCount:     mapped.ClickCount,
+		ActiveFrom:     mapped.ActiveFrom,
+		Destinations:   mapped.Destinations,
+		Sticky:         mapped.Sticky,
+		GeoTargets:     mapped.GeoTargets,
+		DeviceTargets:  mapped.DeviceTargets,
+		Domain:         mapped.Domain,
+		OrgID:          mapped.OrgID,
+		Tags:           mapped.Tags,
+		UTM:            mapped.UTM,
+		LastAccessedAt: mapped.LastAccessedAt,
+		ArchivedAt:     mapped.ArchivedAt,
+		EditedAt:       mapped.EditedAt,
+	}
+	if !mapped.CreatedAt.IsZero() {
+		createdAt := mapped.CreatedAt
+		entry.CreatedAt = &createdAt
+	}
+	return entry
+}
+
+// ListedURL defines a user URL along with its creation time for storages sorting URLs in memory.
+type ListedURL struct {
+	modelurl.FullURL
+	CreatedAt time.Time
+}
+
+// sortTime returns the time URL is sorted by with sortBy of modelurl.ListOptions, URLs never accessed sort as accessed
+// at creation.
+func (URL ListedURL) sortTime(sortBy string) time.Time {
+	if sortBy == modelurl.SortLastAccessed && URL.LastAccessedAt != nil {
+		return *URL.LastAccessedAt
+	}
+	return URL.CreatedAt
+}
+
+// fullURL returns URL along with its creation time.
+func (URL ListedURL) fullURL() modelurl.FullURL {
+	fullURL := URL.FullURL
+	fullURL.CreatedAt = URL.CreatedAt
+	return fullURL
+}
+
+// PageURLs sorts URLs tagged with the tag of opts by creation or last access time, breaking ties by sURL, and returns
+// the page of them defined by opts. Archived URLs are left out unless opts include them.
+func PageURLs(URLs []ListedURL, opts modelurl.ListOptions) []modelurl.FullURL {
+	if opts.Tag != "" || !opts.IncludeArchived {
+		listed := URLs[:0]
+		for _, URL := range URLs {
+			if (opts.Tag == "" || HasTag(URL.Tags, opts.Tag)) && (opts.IncludeArchived || URL.ArchivedAt == nil) {
+				listed = append(listed, URL)
+			}
+		}
+		URLs = listed
+	}
+	sort.Slice(URLs, func(i, j int) bool {
+		a, b := URLs[i], URLs[j]
+		if opts.Desc {
+			a, b = b, a
+		}
+		if at, bt := a.sortTime(opts.SortBy), b.sortTime(opts.SortBy); !at.Equal(bt) {
+			return at.Before(bt)
+		}
+		return a.SURL < b.SURL
+	})
+	if opts.Offset >= len(URLs) {
+		return nil
+	}
+	URLs = URLs[opts.Offset:]
+	if opts.Limit > 0 && opts.Limit < len(URLs) {
+		URLs = URLs[:opts.Limit]
+	}
+	page := make([]modelurl.FullURL, 0, len(URLs))
+	for _, URL := range URLs {
+		page = append(page, URL.fullURL())
+	}
+	return page
+}
+
+// HasTag reports whether sorted tags contain tag.
+func HasTag(tags []string, tag string) bool {
+	i := sort.SearchStrings(tags, tag)
+	return i < len(tags) && tags[i] == tag
+}
+
+// RenameTag returns sorted tags with tag renamed to name, tags already containing name lose tag. It reports false and
+// returns tags as is if they do not contain tag.
+func RenameTag(tags []string, tag, name string) ([]string, bool) {
+	if !HasTag(tags, tag) {
+		return tags, false
+	}
+	renamed := make([]string, 0, len(tags))
+	for _, t := range tags {
+		if t != tag && t != name {
+			renamed = append(renamed, t)
+		}
+	}
+	renamed = append(renamed, name)
+	sort.Strings(renamed)
+	return renamed, true
+}
+
+// CountTags returns tags of URLs along with the number of URLs tagged with each of them sorted by name.
+func CountTags(URLs []modelurl.FullURL) []modelurl.Tag {
+	counts := make(map[string]int)
+	for _, URL := range URLs {
+		for _, tag := range URL.Tags {
+			counts[tag]++
+		}
+	}
+	tags := make([]modelurl.Tag, 0, len(counts))
+	for name, count := range counts {
+		tags = append(tags, modelurl.Tag{Name: name, Count: count})
+	}
+	sort.Slice(tags, func(i, j int) bool { return tags[i].Name < tags[j].Name })
+	return tags
+}
+
+// UserEntry defines a registered user account, PasswordHash holds a bcrypt hash of the password. Role is the role
+// claim of access tokens issued for the account, it is granted out of band and is empty for self-registered accounts.
+type UserEntry struct {
+	Login        string `json:"login"`
+	PasswordHash string `json:"passwordHash"`
+	UserID       string `json:"userID"`
+	Role         string `json:"role,omitempty"`
+}
+
+// PageUsers sorts users by login and returns the page of them defined by opts, Desc sorts them in reverse order.
+func PageUsers(users []UserEntry, opts modelurl.ListOptions) []UserEntry {
+	sort.Slice(users, func(i, j int) bool {
+		if opts.Desc {
+			return users[i].Login > users[j].Login
+		}
+		return users[i].Login < users[j].Login
+	})
+	if opts.Offset >= len(users) {
+		return nil
+	}
+	users = users[opts.Offset:]
+	if opts.Limit > 0 && opts.Limit < len(users) {
+		users = users[:opts.Limit]
+	}
+	return users
+}
+
+// MatchesQuery reports whether URL or sURL contains query ignoring case, every URL matches an empty query.
+func MatchesQuery(URL, sURL, query string) bool {
+	query = strings.ToLower(query)
+	return strings.Contains(strings.ToLower(URL), query) || strings.Contains(strings.ToLower(sURL), query)
+}
+
+// search rank weights of words of titles and tags and of words of URLs, the default weights of Postgres ts_rank
+const (
+	titleWeight = 1.0
+	urlWeight   = 0.4
+)
+
+// SearchTerms splits query into lower-case words of letters and digits, any other character separates words.
+func SearchTerms(query string) []string {
+	return strings.FieldsFunc(strings.ToLower(query), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// RankURLs returns the page defined by opts of URLs having a word starting with each of terms in their title, tags or
+// URL. URLs are ranked by the number and weight of matching words the way Postgres ranks them, equally relevant ones
+// are sorted by creation time newest first. Archived URLs are left out unless opts include them.
+func RankURLs(URLs []ListedURL, terms []string, opts modelurl.ListOptions) []modelurl.FullURL {
+	type rankedURL struct {
+		ListedURL
+		rank float64
+	}
+	var ranked []rankedURL
+	for _, URL := range URLs {
+		if !opts.IncludeArchived && URL.ArchivedAt != nil {
+			continue
+		}
+		titleWords := SearchTerms(URL.Title + " " + strings.Join(URL.Tags, " "))
+		URLWords := SearchTerms(URL.URL)
+		rank := 0.0
+		for _, term := range terms {
+			termRank := titleWeight*float64(countPrefixed(titleWords, term)) + urlWeight*float64(countPrefixed(URLWords, term))
+			if termRank == 0 {
+				rank = 0
+				break
+			}
+			rank += termRank
+		}
+		if rank > 0 {
+			ranked = append(ranked, rankedURL{ListedURL: URL, rank: rank})
+		}
+	}
+	sort.Slice(ranked, func(i, j int) bool {
+		a, b := ranked[i], ranked[j]
+		if a.rank != b.rank {
+			return a.rank > b.rank
+		}
+		if !a.CreatedAt.Equal(b.CreatedAt) {
+			return a.CreatedAt.After(b.CreatedAt)
+		}
+		return a.SURL < b.SURL
+	})
+	if opts.Offset >= len(ranked) {
+		return nil
+	}
+	ranked = ranked[opts.Offset:]
+	if opts.Limit > 0 && opts.Limit < len(ranked) {
+		ranked = ranked[:opts.Limit]
+	}
+	page := make([]modelurl.FullURL, 0, len(ranked))
+	for _, URL := range ranked {
+		page = append(page, URL.fullURL())
+	}
+	return page
+}
+
+// countPrefixed returns the number of words starting with prefix.
+func countPrefixed(words []string, prefix string) int {
+	count := 0
+	for _, word := range words {
+		if strings.HasPrefix(word, prefix) {
+			count++
+		}
+	}
+	return count
+}
+
+// APIKeyEntry defines a long-lived API key of a user, Hash holds the hex-encoded SHA-256 of the key which itself is
+// never stored and Prefix holds its first characters to tell keys apart.
+type APIKeyEntry struct {
+	ID        string     `json:"id"`
+	UserID    string     `json:"userID"`
+	Name      string     `json:"name"`
+	Prefix    string     `json:"prefix"`
+	Hash      string     `json:"hash"`
+	CreatedAt time.Time  `json:"createdAt"`
+	RevokedAt *time.Time `json:"revokedAt,omitempty"`
+}
+
+// SortAPIKeys sorts entries by creation time, oldest first.
+func SortAPIKeys(entries []APIKeyEntry) {
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].CreatedAt.Equal(entries[j].CreatedAt) {
+			return entries[i].ID < entries[j].ID
+		}
+		return entries[i].CreatedAt.Before(entries[j].CreatedAt)
+	})
+}
+
+// DomainEntry defines a claim of a custom domain by a user, it serves the links of the user once it is verified by
+// publishing Token in a DNS TXT record. Several users may claim a domain, only one of them may verify it.
+type DomainEntry struct {
+	Name       string     `json:"name"`
+	UserID     string     `json:"userID"`
+	Token      string     `json:"token"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	VerifiedAt *time.Time `json:"verifiedAt,omitempty"`
+}
+
+// Expired reports whether the domain is still not verified ttl after it was claimed.
+func (entry DomainEntry) Expired(now time.Time, ttl time.Duration) bool {
+	return entry.VerifiedAt == nil && !now.Before(entry.CreatedAt.Add(ttl))
+}
+
+// SortDomains sorts entries by creation time, oldest first.
+func SortDomains(entries []DomainEntry) {
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].CreatedAt.Equal(entries[j].CreatedAt) {
+			return entries[i].Name < entries[j].Name
+		}
+		return entries[i].CreatedAt.Before(entries[j].CreatedAt)
+	})
+}
+
+// UserSettingsEntry defines settings of a user applied to links the user creates, UTM maps UTM parameter names to the
+// values links are tagged with unless they are given their own.
+type UserSettingsEntry struct {
+	UserID string            `json:"userID"`
+	UTM    map[string]string `json:"utm,omitempty"`
+}
+
+// OrgEntry defines an organization sharing links between its members.
+type OrgEntry struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// MemberEntry defines a membership of a user in an organization, Role is one of modelurl.RoleAdmin and
+// modelurl.RoleMember and Login is empty for members who have not registered.
+type MemberEntry struct {
+	OrgID     string    `json:"orgID"`
+	UserID    string    `json:"userID"`
+	Login     string    `json:"login,omitempty"`
+	Role      string    `json:"role"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// SortMembers sorts entries by creation time, oldest first.
+func SortMembers(entries []MemberEntry) {
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].CreatedAt.Equal(entries[j].CreatedAt) {
+			return entries[i].OrgID+entries[i].UserID < entries[j].OrgID+entries[j].UserID
+		}
+		return entries[i].CreatedAt.Before(entries[j].CreatedAt)
+	})
+}
+
+// URLEditEntry defines a change of the destination of a link made by its owner.
+type URLEditEntry struct {
+	SURL        string    `json:"sURL"`
+	UserID      string    `json:"userID"`
+	PreviousURL string    `json:"previousURL"`
+	URL         string    `json:"URL"`
+	EditedAt    time.Time `json:"editedAt"`
+}
+
+// AuditEntry defines a recorded mutating operation, Before and After hold JSON encoded states of the entity.
+type AuditEntry struct {
+	ID        string          `json:"id"`
+	Actor     string          `json:"actor"`
+	Action    string          `json:"action"`
+	Entity    string          `json:"entity"`
+	EntityID  string          `json:"entityID"`
+	Before    json.RawMessage `json:"before,omitempty"`
+	After     json.RawMessage `json:"after,omitempty"`
+	CreatedAt time.Time       `json:"createdAt"`
+}
+
+// NewAuditEntry returns a record of actor performing action on the entity entityID which changed its state from
+// before to after, nil states are omitted.
+func NewAuditEntry(actor, action, entity, entityID string, before, after interface{}) (AuditEntry, error) {
+	entry := AuditEntry{
+		ID:        uuid.New().String(),
+		Actor:     actor,
+		Action:    action,
+		Entity:    entity,
+		EntityID:  entityID,
+		CreatedAt: time.Now().UTC(),
+	}
+	var err error
+	if before != nil {
+		entry.Before, err = json.Marshal(before)
+		if err != nil {
+			return AuditEntry{}, err
+		}
+	}
+	if after != nil {
+		entry.After, err = json.Marshal(after)
+		if err != nil {
+			return AuditEntry{}, err
+		}
+	}
+	return entry, nil
+}
+
+// Anonymize drops the states recorded by entry when it was made by userID or describes one of the links sURLs or a
+// membership of userID, so that records kept after the user is erased hold no data of the user. It reports whether
+// entry changed.
+func (entry *AuditEntry) Anonymize(userID string, sURLs map[string]bool) bool {
+	if entry.Before == nil && entry.After == nil {
+		return false
+	}
+	if entry.Actor != userID &&
+		!(entry.Entity == modelurl.AuditEntityURL && sURLs[entry.EntityID]) &&
+		!(entry.Entity == modelurl.AuditEntityMember && strings.HasSuffix(entry.EntityID, "/"+userID)) {
+		return false
+	}
+	entry.Before, entry.After = nil, nil
+	return true
+}
+
+// AuditedURL defines the state of a link recorded by audit records, attributes an operation does not know are
+// omitted and the password of a link is never recorded.
+type AuditedURL struct {
+	SURL      string     `json:"sURL"`
+	URL       string     `json:"URL,omitempty"`
+	UserID    string     `json:"userID,omitempty"`
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+	Protected bool       `json:"protected,omitempty"`
+	Domain    string     `json:"domain,omitempty"`
+	OrgID     string     `json:"orgID,omitempty"`
+	Deleted   bool       `json:"deleted"`
+	Disabled  bool       `json:"disabled"`
+}
+
+// AuditURL returns the audited state of a stored entry.
+func AuditURL(entry URLStorageEntry) AuditedURL {
+	return AuditedURL{
+		SURL:      entry.SURL,
+		URL:       entry.URL,
+		UserID:    entry.UserID,
+		ExpiresAt: entry.ExpiresAt,
+		Protected: entry.PasswordHash != "",
+		Domain:    entry.Domain,
+		OrgID:     entry.OrgID,
+		Disabled:  entry.DisabledAt != nil,
+	}
+}
+
+// PageAudit sorts entries matching filter by creation time and returns the page of them defined by opts.
+func PageAudit(entries []AuditEntry, filter modelurl.AuditFilter, opts modelurl.ListOptions) []AuditEntry {
+	matched := make([]AuditEntry, 0, len(entries))
+	for _, entry := range entries {
+		switch {
+		case filter.Actor != "" && entry.Actor != filter.Actor,
+			filter.Action != "" && entry.Action != filter.Action,
+			filter.Entity != "" && entry.Entity != filter.Entity,
+			filter.EntityID != "" && entry.EntityID != filter.EntityID,
+			filter.Since != nil && entry.CreatedAt.Before(*filter.Since),
+			filter.Until != nil && !entry.CreatedAt.Before(*filter.Until):
+			continue
+		}
+		matched = append(matched, entry)
+	}
+	sort.Slice(matched, func(i, j int) bool {
+		if matched[i].CreatedAt.Equal(matched[j].CreatedAt) {
+			return (matched[i].ID < matched[j].ID) != opts.Desc
+		}
+		return matched[i].CreatedAt.Before(matched[j].CreatedAt) != opts.Desc
+	})
+	if opts.Offset >= len(matched) {
+		return nil
+	}
+	matched = matched[opts.Offset:]
+	if opts.Limit > 0 && opts.Limit < len(matched) {
+		matched = matched[:opts.Limit]
+	}
+	return matched
+}
+
+// ImportStatus defines the outcome of importing one URL entry.
+type ImportStatus int
+
+const (
+	// ImportCreated means that the entry was stored.
+	ImportCreated ImportStatus = iota
+	// ImportURLExists means that the URL was already shortened, the entry SURL is replaced with the existing one.
+	ImportURLExists
+	// ImportSURLTaken means that the entry SURL is already used for another URL.
+	ImportSURLTaken
+)
+
+// ImportResult defines the outcome of importing Entry.
+type ImportResult struct {
+	Entry  URLStorageEntry
+	Status ImportStatus
 }
 
 type URLChannelEntry struct {
 	UserID string
 	SURL   string
 }
+
+type ClickEntry struct {
+	SURL      string
+	ClickedAt time.Time
+	Referrer  string
+	UserAgent string
+	// Destination holds the URL the redirect was served to, it differs between redirects of split links.
+	Destination string
+	// ReferrerDomain holds the normalized host name of Referrer, it is empty for direct redirects.
+	ReferrerDomain string
+	// Country holds the ISO 3166-1 alpha-2 code of the visitor country, it is empty when it is not resolved. Visitor
+	// IP addresses are never stored.
+	Country string
+	// VisitorKey identifies the visitor in unique visitor sketches, it is not stored otherwise.
+	VisitorKey string
+	// Bot marks redirects of crawlers and other bots, they are left out of redirect counts unless asked for.
+	Bot bool
+}
+
+// BotKeyPrefix marks keys redirects of bots are counted by in storages counting redirects per day, hour, served
+// destination, referrer domain or visitor country, so that they are counted apart from the ones of human visitors.
+const BotKeyPrefix = "bot:"
+
+// CountKey returns the key redirects by key are counted by, it is prefixed with BotKeyPrefix for redirects of bots.
+func CountKey(key string, bot bool) string {
+	if bot {
+		return BotKeyPrefix + key
+	}
+	return key
+}
+
+// CountedKey returns the key a count of countKey is reported by and whether it is reported, counts of bots are only
+// reported with includeBots.
+func CountedKey(countKey string, includeBots bool) (string, bool) {
+	if !strings.HasPrefix(countKey, BotKeyPrefix) {
+		return countKey, true
+	}
+	return strings.TrimPrefix(countKey, BotKeyPrefix), includeBots
+}
+
+// TopReferrers returns redirects counted per CountKey of referrer domain, the empty one counting direct redirects, as
+// stats of sURL with up to limit domains sorted by redirect counts descending and then by domain. Redirects of bots
+// are only counted with includeBots.
+func TopReferrers(sURL string, counts map[string]int, limit int, includeBots bool) modelurl.ReferrerStats {
+	merged := make(map[string]int, len(counts))
+	for countKey, clicks := range counts {
+		if domain, ok := CountedKey(countKey, includeBots); ok {
+			merged[domain] += clicks
+		}
+	}
+	stats := modelurl.ReferrerStats{SURL: sURL, DirectClicks: merged[""]}
+	for domain, clicks := range merged {
+		if domain != "" && clicks > 0 {
+			stats.Referrers = append(stats.Referrers, modelurl.ReferrerClicks{Domain: domain, Clicks: clicks})
+		}
+	}
+	sort.Slice(stats.Referrers, func(i, j int) bool {
+		if stats.Referrers[i].Clicks != stats.Referrers[j].Clicks {
+			return stats.Referrers[i].Clicks > stats.Referrers[j].Clicks
+		}
+		return stats.Referrers[i].Domain < stats.Referrers[j].Domain
+	})
+	if len(stats.Referrers) > limit {
+		stats.Referrers = stats.Referrers[:limit]
+	}
+	return stats
+}
+
+// CountryBreakdown returns redirects counted per CountKey of visitor country, the empty one counting redirects of
+// visitors whose country was not resolved, as stats of sURL with countries sorted by redirect counts descending and
+// then by country. Redirects of bots are only counted with includeBots.
+func CountryBreakdown(sURL string, counts map[string]int, includeBots bool) modelurl.CountryStats {
+	merged := make(map[string]int, len(counts))
+	for countKey, clicks := range counts {
+		if country, ok := CountedKey(countKey, includeBots); ok {
+			merged[country] += clicks
+		}
+	}
+	stats := modelurl.CountryStats{SURL: sURL, UnknownClicks: merged[""]}
+	for country, clicks := range merged {
+		if country != "" && clicks > 0 {
+			stats.Countries = append(stats.Countries, modelurl.CountryClicks{Country: country, Clicks: clicks})
+		}
+	}
+	sort.Slice(stats.Countries, func(i, j int) bool {
+		if stats.Countries[i].Clicks != stats.Countries[j].Clicks {
+			return stats.Countries[i].Clicks > stats.Countries[j].Clicks
+		}
+		return stats.Countries[i].Country < stats.Countries[j].Country
+	})
+	return stats
+}
+
+// HourLayout formats hours redirects are counted by in storages lacking a rollup table.
+const HourLayout = "2006-01-02T15"
+
+// BucketClicks sums redirects counted per CountKey of hour formatted with HourLayout into buckets of granularity
+// starting within [from, to) and returns non-empty ones sorted by time. Redirects of bots are only counted with
+// includeBots.
+func BucketClicks(hourly map[string]int, granularity string, from, to time.Time, includeBots bool) []modelurl.ClickBucket {
+	counts := make(map[time.Time]int)
+	for countKey, clicks := range hourly {
+		hour, ok := CountedKey(countKey, includeBots)
+		if !ok {
+			continue
+		}
+		start, err := time.Parse(HourLayout, hour)
+		if err != nil || clicks == 0 || start.Before(from) || !start.Before(to) {
+			continue
+		}
+		if granularity == modelurl.GranularityDay {
+			start = start.Truncate(24 * time.Hour)
+		}
+		counts[start] += clicks
+	}
+	buckets := make([]modelurl.ClickBucket, 0, len(counts))
+	for start, clicks := range counts {
+		buckets = append(buckets, modelurl.ClickBucket{Start: start, Clicks: clicks})
+	}
+	sort.Slice(buckets, func(i, j int) bool { return buckets[i].Start.Before(buckets[j].Start) })
+	return buckets
+}
+
+// Events passes lifecycle events of stored entries to a handler which may be set at any time, events are dropped
+// until it is set. Storages embed it to implement storage.EventNotifier.
+type Events struct {
+	handler atomic.Value
+}
+
+// SetEventHandler sets fn as the handler of subsequent events, fn must not block.
+func (e *Events) SetEventHandler(fn func(event modelurl.Event)) {
+	e.handler.Store(fn)
+}
+
+// Emit passes an event of eventType for entry to the handler.
+func (e *Events) Emit(eventType string, entry URLStorageEntry) {
+	fn, _ := e.handler.Load().(func(event modelurl.Event))
+	if fn == nil {
+		return
+	}
+	fn(modelurl.Event{Type: eventType, SURL: entry.SURL, URL: entry.URL, UserID: entry.UserID, OccurredAt: time.Now().UTC()})
+}
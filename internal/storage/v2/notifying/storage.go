@@ -0,0 +1,67 @@
+// Package notifying provides a storage.URLStorage wrapper reporting created entries as lifecycle events.
+package notifying
+
+import (
+	"context"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/service/modelurl"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/storage/v2"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/storage/v2/modelstorage"
+)
+
+// Storage struct wraps a storage.URLStorage and emits modelurl.EventURLCreated for every stored entry. Together with
+// the events of the wrapped storage it covers the whole entry lifecycle.
+type Storage struct {
+	storage.URLStorage
+	events modelstorage.Events
+}
+
+// InitStorage initializes a Storage object wrapping st.
+func InitStorage(st storage.URLStorage) *Storage {
+	return &Storage{URLStorage: st}
+}
+
+// SetEventHandler sets fn as the handler of created entries events and of events emitted by the wrapped storage if it
+// is a storage.EventNotifier.
+func (s *Storage) SetEventHandler(fn func(event modelurl.Event)) {
+	s.events.SetEventHandler(fn)
+	if notifier, ok := s.URLStorage.(storage.EventNotifier); ok {
+		notifier.SetEventHandler(fn)
+	}
+}
+
+// Dump stores a pair of sURL and URL.
+func (s *Storage) Dump(ctx context.Context, entry modelstorage.URLStorageEntry) error {
+	if err := s.URLStorage.Dump(ctx, entry); err != nil {
+		return err
+	}
+	s.events.Emit(modelurl.EventURLCreated, entry)
+	return nil
+}
+
+// DumpBatch stores a batch of sURL:URL pairs, entries whose URL was already shortened are not reported.
+func (s *Storage) DumpBatch(ctx context.Context, entries []modelstorage.URLStorageEntry) ([]modelstorage.URLStorageEntry, error) {
+	stored, err := s.URLStorage.DumpBatch(ctx, entries)
+	if err != nil {
+		return nil, err
+	}
+	for i := range stored {
+		if i < len(entries) && stored[i].SURL == entries[i].SURL {
+			s.events.Emit(modelurl.EventURLCreated, stored[i])
+		}
+	}
+	return stored, nil
+}
+
+// ImportBatch stores a batch of imported URL entries.
+func (s *Storage) ImportBatch(ctx context.Context, entries []modelstorage.URLStorageEntry) ([]modelstorage.ImportResult, error) {
+	results, err := s.URLStorage.ImportBatch(ctx, entries)
+	if err != nil {
+		return nil, err
+	}
+	for _, result := range results {
+		if result.Status == modelstorage.ImportCreated {
+			s.events.Emit(modelurl.EventURLCreated, result.Entry)
+		}
+	}
+	return results, nil
+}
@@ -0,0 +1,24 @@
+// Package streaming provides a storage.URLStorage wrapper passing recorded clicks to a click stream.
+package streaming
+
+import (
+	"github.com/danilovkiri/dk_go_url_shortener/internal/storage/v2"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/storage/v2/modelstorage"
+)
+
+// Storage struct wraps a storage.URLStorage and passes every click it records to publish.
+type Storage struct {
+	storage.URLStorage
+	publish func(item modelstorage.ClickEntry)
+}
+
+// InitStorage initializes a Storage object wrapping st, publish must not block.
+func InitStorage(st storage.URLStorage, publish func(item modelstorage.ClickEntry)) *Storage {
+	return &Storage{URLStorage: st, publish: publish}
+}
+
+// SendClick publishes item and sends it to the wrapped storage.
+func (s *Storage) SendClick(item modelstorage.ClickEntry) {
+	s.publish(item)
+	s.URLStorage.SendClick(item)
+}
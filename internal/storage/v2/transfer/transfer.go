@@ -0,0 +1,148 @@
+// Package transfer provides copying of URL entries between storages of any kind, e.g. to migrate from file storage to
+// PSQL DB, and their backup to and restore from JSON lines.
+package transfer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/storage/v2"
+	storageErrors "github.com/danilovkiri/dk_go_url_shortener/internal/storage/v2/errors"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/storage/v2/modelstorage"
+	"io"
+)
+
+// Record defines one line of a backup: a stored entry along with its deletion flag.
+type Record struct {
+	modelstorage.URLStorageEntry
+	Deleted bool `json:"deleted,omitempty"`
+}
+
+// Stats counts entries processed by Copy and Restore.
+type Stats struct {
+	Scanned int
+	Copied  int
+	// Skipped counts entries whose sURL or URL is already taken in the target storage, e.g. by an earlier run.
+	Skipped int
+	// Dropped counts deleted entries which were not copied since the target storage does not keep deleted entries.
+	Dropped int
+}
+
+// Options defines how Copy and Restore handle entries and report their progress.
+type Options struct {
+	// KeepDeleted copies deleted entries and deletes them in the target storage, they are dropped otherwise.
+	KeepDeleted bool
+	// Progress is called with the stats so far after every ProgressEvery scanned entries and once all entries are
+	// scanned, it may be nil.
+	Progress      func(stats Stats)
+	ProgressEvery int
+}
+
+// Copy streams all entries of from into to preserving their sURLs, owners, settings, metadata, disabled and deleted
+// states. Creation times, click counts and redirect records are not copied. Entries already present in to are
+// skipped, so that an interrupted copy can be run again. The first failing write stops the copy.
+func Copy(ctx context.Context, from storage.EntryScanner, to storage.URLStorage, opts Options) (stats Stats, err error) {
+	err = from.ScanEntries(ctx, func(entry modelstorage.URLStorageEntry, deleted bool) error {
+		return stats.copy(ctx, to, entry, deleted, opts)
+	})
+	if opts.Progress != nil {
+		opts.Progress(stats)
+	}
+	return stats, err
+}
+
+// Backup writes all entries of from to w as JSON lines of Record and returns the number of written records.
+func Backup(ctx context.Context, from storage.EntryScanner, w io.Writer) (count int, err error) {
+	encoder := json.NewEncoder(w)
+	err = from.ScanEntries(ctx, func(entry modelstorage.URLStorageEntry, deleted bool) error {
+		err := encoder.Encode(Record{URLStorageEntry: entry, Deleted: deleted})
+		if err != nil {
+			return err
+		}
+		count++
+		return nil
+	})
+	return count, err
+}
+
+// Restore reads JSON lines of Record written by Backup from r and copies their entries into to the same way as Copy.
+func Restore(ctx context.Context, r io.Reader, to storage.URLStorage, opts Options) (stats Stats, err error) {
+	decoder := json.NewDecoder(r)
+	for {
+		var record Record
+		err = decoder.Decode(&record)
+		if errors.Is(err, io.EOF) {
+			err = nil
+			break
+		}
+		if err != nil {
+			err = fmt.Errorf("reading backup record %d: %w", stats.Scanned+1, err)
+			break
+		}
+		err = stats.copy(ctx, to, record.URLStorageEntry, record.Deleted, opts)
+		if err != nil {
+			break
+		}
+	}
+	if opts.Progress != nil {
+		opts.Progress(stats)
+	}
+	return stats, err
+}
+
+// copy copies one scanned entry into to and counts it.
+func (stats *Stats) copy(ctx context.Context, to storage.URLStorage, entry modelstorage.URLStorageEntry, deleted bool, opts Options) error {
+	stats.Scanned++
+	defer func() {
+		if opts.Progress != nil && opts.ProgressEvery > 0 && stats.Scanned%opts.ProgressEvery == 0 {
+			opts.Progress(*stats)
+		}
+	}()
+	if deleted && !opts.KeepDeleted {
+		stats.Dropped++
+		return nil
+	}
+	copied, err := copyEntry(ctx, to, entry, deleted)
+	if err != nil {
+		return err
+	}
+	if copied {
+		stats.Copied++
+	} else {
+		stats.Skipped++
+	}
+	return nil
+}
+
+// copyEntry stores entry in st and restores its state, copied is false when its sURL or URL is already taken.
+func copyEntry(ctx context.Context, st storage.URLStorage, entry modelstorage.URLStorageEntry, deleted bool) (copied bool, err error) {
+	err = st.Dump(ctx, entry)
+	var alreadyExistsError *storageErrors.AlreadyExistsError
+	var sURLAlreadyExistsError *storageErrors.SURLAlreadyExistsError
+	switch {
+	case errors.As(err, &alreadyExistsError) || errors.As(err, &sURLAlreadyExistsError):
+		return false, nil
+	case err != nil:
+		return false, err
+	}
+	if entry.Title != "" || entry.FaviconURL != "" {
+		err = st.UpdateMetadata(ctx, entry.SURL, entry.Title, entry.FaviconURL)
+		if err != nil {
+			return false, err
+		}
+	}
+	if entry.DisabledAt != nil {
+		_, err = st.DisableBatch(ctx, []string{entry.SURL})
+		if err != nil {
+			return false, err
+		}
+	}
+	if deleted {
+		err = st.DeleteBatch(ctx, []string{entry.SURL}, entry.UserID)
+		if err != nil {
+			return false, err
+		}
+	}
+	return true, nil
+}
@@ -0,0 +1,149 @@
+package transfer
+
+import (
+	"bytes"
+	"context"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/danilovkiri/dk_go_url_shortener/internal/config"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/storage/v2"
+	storageErrors "github.com/danilovkiri/dk_go_url_shortener/internal/storage/v2/errors"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/storage/v2/infile"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/storage/v2/modelstorage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// scannedEntry defines an entry listed by entryScanner.
+type scannedEntry struct {
+	entry   modelstorage.URLStorageEntry
+	deleted bool
+}
+
+// entryScanner lists its entries in order.
+type entryScanner []scannedEntry
+
+func (s entryScanner) ScanEntries(ctx context.Context, fn func(entry modelstorage.URLStorageEntry, deleted bool) error) error {
+	for _, e := range s {
+		if err := fn(e.entry, e.deleted); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deletingStorage records deletions which infile DB handling does not perform.
+type deletingStorage struct {
+	storage.URLStorage
+	deleted []string
+}
+
+func (s *deletingStorage) DeleteBatch(ctx context.Context, sURLs []string, userID string) error {
+	s.deleted = append(s.deleted, sURLs...)
+	return nil
+}
+
+func initFileStorage(t *testing.T) *infile.Storage {
+	cfg, err := config.NewDefaultConfiguration()
+	require.NoError(t, err)
+	cfg.StorageConfig.FileStoragePath = filepath.Join(t.TempDir(), "url_storage.json")
+	ctx, cancel := context.WithCancel(context.Background())
+	wg := &sync.WaitGroup{}
+	wg.Add(1)
+	t.Cleanup(func() {
+		cancel()
+		wg.Wait()
+	})
+	st, err := infile.InitStorage(ctx, wg, cfg.StorageConfig, nil)
+	require.NoError(t, err)
+	return st
+}
+
+func TestCopy(t *testing.T) {
+	disabledAt := time.Now().Add(-time.Hour)
+	from := entryScanner{
+		{entry: modelstorage.URLStorageEntry{SURL: "live", URL: "https://example.com/live", UserID: "alice", Title: "Live", MaxClicks: 5}},
+		{entry: modelstorage.URLStorageEntry{SURL: "disabled", URL: "https://example.com/disabled", UserID: "alice", DisabledAt: &disabledAt}},
+		{entry: modelstorage.URLStorageEntry{SURL: "deleted", URL: "https://example.com/deleted", UserID: "bob"}, deleted: true},
+		{entry: modelstorage.URLStorageEntry{SURL: "live", URL: "https://example.com/other", UserID: "bob"}},
+	}
+	ctx := context.Background()
+
+	t.Run("keep deleted", func(t *testing.T) {
+		to := &deletingStorage{URLStorage: initFileStorage(t)}
+		var reported []Stats
+		stats, err := Copy(ctx, from, to, Options{KeepDeleted: true, ProgressEvery: 2, Progress: func(stats Stats) {
+			reported = append(reported, stats)
+		}})
+		require.NoError(t, err)
+		assert.Equal(t, Stats{Scanned: 4, Copied: 3, Skipped: 1}, stats)
+		assert.Equal(t, []Stats{{Scanned: 2, Copied: 2}, {Scanned: 4, Copied: 3, Skipped: 1}, stats}, reported)
+		assert.Equal(t, []string{"deleted"}, to.deleted)
+
+		entry, err := to.Retrieve(ctx, "live")
+		require.NoError(t, err)
+		assert.Equal(t, "https://example.com/live", entry.URL)
+		assert.Equal(t, "alice", entry.UserID)
+		assert.Equal(t, "Live", entry.Title)
+		assert.Equal(t, 5, entry.MaxClicks)
+		_, err = to.Retrieve(ctx, "disabled")
+		assert.IsType(t, &storageErrors.DisabledError{}, err)
+
+		// copying again skips everything copied before
+		stats, err = Copy(ctx, from, to, Options{KeepDeleted: true})
+		require.NoError(t, err)
+		assert.Equal(t, Stats{Scanned: 4, Skipped: 4}, stats)
+	})
+
+	t.Run("drop deleted", func(t *testing.T) {
+		to := initFileStorage(t)
+		stats, err := Copy(ctx, from, to, Options{})
+		require.NoError(t, err)
+		assert.Equal(t, Stats{Scanned: 4, Copied: 2, Skipped: 1, Dropped: 1}, stats)
+		_, err = to.Retrieve(ctx, "deleted")
+		assert.IsType(t, &storageErrors.NotFoundError{}, err)
+	})
+}
+
+func TestCopyFromFileStorage(t *testing.T) {
+	ctx := context.Background()
+	from := initFileStorage(t)
+	require.NoError(t, from.Dump(ctx, modelstorage.URLStorageEntry{SURL: "abc", URL: "https://example.com", UserID: "alice"}))
+	to := initFileStorage(t)
+	stats, err := Copy(ctx, from, to, Options{})
+	require.NoError(t, err)
+	assert.Equal(t, Stats{Scanned: 1, Copied: 1}, stats)
+	entry, err := to.Retrieve(ctx, "abc")
+	require.NoError(t, err)
+	assert.Equal(t, "alice", entry.UserID)
+}
+
+func TestBackupRestore(t *testing.T) {
+	ctx := context.Background()
+	from := entryScanner{
+		{entry: modelstorage.URLStorageEntry{SURL: "live", URL: "https://example.com/live", UserID: "alice", Title: "Live"}},
+		{entry: modelstorage.URLStorageEntry{SURL: "deleted", URL: "https://example.com/deleted", UserID: "bob"}, deleted: true},
+	}
+	var buf bytes.Buffer
+	count, err := Backup(ctx, from, &buf)
+	require.NoError(t, err)
+	assert.Equal(t, 2, count)
+	assert.Equal(t, 2, strings.Count(buf.String(), "\n"))
+	assert.Contains(t, buf.String(), `"deleted":true`)
+
+	to := &deletingStorage{URLStorage: initFileStorage(t)}
+	stats, err := Restore(ctx, &buf, to, Options{KeepDeleted: true})
+	require.NoError(t, err)
+	assert.Equal(t, Stats{Scanned: 2, Copied: 2}, stats)
+	assert.Equal(t, []string{"deleted"}, to.deleted)
+	entry, err := to.Retrieve(ctx, "live")
+	require.NoError(t, err)
+	assert.Equal(t, "Live", entry.Title)
+
+	_, err = Restore(ctx, strings.NewReader("{\"sURL\":\"a\"}\nnot json\n"), initFileStorage(t), Options{})
+	assert.EqualError(t, err, "reading backup record 2: invalid character 'o' in literal null (expecting 'u')")
+}
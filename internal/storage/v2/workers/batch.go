@@ -0,0 +1,56 @@
+package workers
+
+import (
+	"context"
+	"time"
+
+	"github.com/danilovkiri/dk_go_url_shortener/internal/storage/v2/modelstorage"
+)
+
+// Batch holds sURLs of one user deleted at once.
+type Batch struct {
+	UserID string
+	SURLs  []string
+}
+
+// Coalesce groups deletions read from in by user into batches sent to out: a batch is sent once it holds size sURLs
+// and all batches are sent every interval, so that a client deleting links one at a time does not cost a transaction
+// per link. Once ctx is done deletions left in in are picked up, all batches are sent and out is closed.
+func Coalesce(ctx context.Context, in <-chan modelstorage.URLChannelEntry, out chan<- Batch, size int, interval time.Duration) {
+	defer close(out)
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	batches := make(map[string][]string)
+	add := func(item modelstorage.URLChannelEntry) {
+		batches[item.UserID] = append(batches[item.UserID], item.SURL)
+		if len(batches[item.UserID]) >= size {
+			out <- Batch{UserID: item.UserID, SURLs: batches[item.UserID]}
+			delete(batches, item.UserID)
+		}
+	}
+	sendAll := func() {
+		for userID, sURLs := range batches {
+			out <- Batch{UserID: userID, SURLs: sURLs}
+			delete(batches, userID)
+		}
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			// pick up entries left in the queue so that they are not lost on shutdown
+			for {
+				select {
+				case item := <-in:
+					add(item)
+				default:
+					sendAll()
+					return
+				}
+			}
+		case <-t.C:
+			sendAll()
+		case item := <-in:
+			add(item)
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package workers
+
+import (
+	"context"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/danilovkiri/dk_go_url_shortener/internal/storage/v2/modelstorage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCoalesce(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	in := make(chan modelstorage.URLChannelEntry, 10)
+	out := make(chan Batch, 10)
+	go Coalesce(ctx, in, out, 3, time.Hour)
+
+	// deletions sent one at a time are performed at once when a batch of the user fills up
+	for _, sURL := range []string{"a", "b", "c"} {
+		in <- modelstorage.URLChannelEntry{UserID: "user1", SURL: sURL}
+		in <- modelstorage.URLChannelEntry{UserID: "user2", SURL: sURL + "2"}
+	}
+	assert.Equal(t, Batch{UserID: "user1", SURLs: []string{"a", "b", "c"}}, <-out)
+	assert.Equal(t, Batch{UserID: "user2", SURLs: []string{"a2", "b2", "c2"}}, <-out)
+
+	// batches which are not full are sent on shutdown
+	in <- modelstorage.URLChannelEntry{UserID: "user1", SURL: "d"}
+	in <- modelstorage.URLChannelEntry{UserID: "user2", SURL: "e"}
+	cancel()
+	var batches []Batch
+	for batch := range out {
+		batches = append(batches, batch)
+	}
+	require.Len(t, batches, 2)
+	sort.Slice(batches, func(i, j int) bool { return batches[i].UserID < batches[j].UserID })
+	assert.Equal(t, []Batch{{UserID: "user1", SURLs: []string{"d"}}, {UserID: "user2", SURLs: []string{"e"}}}, batches)
+}
+
+func TestCoalesceInterval(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	in := make(chan modelstorage.URLChannelEntry, 1)
+	out := make(chan Batch, 1)
+	go Coalesce(ctx, in, out, 100, 10*time.Millisecond)
+	in <- modelstorage.URLChannelEntry{UserID: "user1", SURL: "a"}
+	select {
+	case batch := <-out:
+		assert.Equal(t, Batch{UserID: "user1", SURLs: []string{"a"}}, batch)
+	case <-time.After(time.Second):
+		t.Fatal("batch is not sent by interval")
+	}
+}
@@ -0,0 +1,70 @@
+// Package workers provides coalescing of queued deletions into per-user batches and a pool of goroutines performing
+// them which can be resized while running.
+package workers
+
+import (
+	"context"
+	"sync"
+)
+
+// Pool runs copies of a worker function sharing a queue. Each worker gets its own context which is done once the
+// parent context is done or once the pool shrinks below it, workers must finish their work and return then.
+type Pool struct {
+	ctx     context.Context
+	run     func(ctx context.Context)
+	mu      sync.Mutex
+	cancels []context.CancelFunc
+	wg      sync.WaitGroup
+	closed  bool
+}
+
+// NewPool starts n workers running run until ctx is done.
+func NewPool(ctx context.Context, n int, run func(ctx context.Context)) *Pool {
+	p := &Pool{ctx: ctx, run: run}
+	p.Resize(n)
+	return p
+}
+
+// Resize starts or stops workers so that n of them run, the most recently started workers are stopped first. Resize
+// does nothing once Wait has been called.
+func (p *Pool) Resize(n int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return
+	}
+	for len(p.cancels) < n {
+		ctx, cancel := context.WithCancel(p.ctx)
+		p.cancels = append(p.cancels, cancel)
+		p.wg.Add(1)
+		go func() {
+			defer p.wg.Done()
+			p.run(ctx)
+		}()
+	}
+	for len(p.cancels) > n {
+		last := len(p.cancels) - 1
+		p.cancels[last]()
+		p.cancels = p.cancels[:last]
+	}
+}
+
+// Size returns the number of running workers.
+func (p *Pool) Size() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.cancels)
+}
+
+// Wait blocks until all workers, stopped ones included, return. It must be called once workers are bound to return,
+// e.g. once the parent context is done, the pool cannot be resized afterwards.
+func (p *Pool) Wait() {
+	p.mu.Lock()
+	p.closed = true
+	p.mu.Unlock()
+	p.wg.Wait()
+	// release contexts of workers which returned on their own
+	for _, cancel := range p.cancels {
+		cancel()
+	}
+}
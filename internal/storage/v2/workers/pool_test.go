@@ -0,0 +1,36 @@
+package workers
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPoolResize(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	var running, stopped int32
+	p := NewPool(ctx, 2, func(ctx context.Context) {
+		atomic.AddInt32(&running, 1)
+		<-ctx.Done()
+		atomic.AddInt32(&running, -1)
+		atomic.AddInt32(&stopped, 1)
+	})
+	assert.Equal(t, 2, p.Size())
+	assert.Eventually(t, func() bool { return atomic.LoadInt32(&running) == 2 }, time.Second, time.Millisecond)
+	p.Resize(4)
+	assert.Equal(t, 4, p.Size())
+	assert.Eventually(t, func() bool { return atomic.LoadInt32(&running) == 4 }, time.Second, time.Millisecond)
+	p.Resize(1)
+	assert.Equal(t, 1, p.Size())
+	assert.Eventually(t, func() bool { return atomic.LoadInt32(&stopped) == 3 }, time.Second, time.Millisecond)
+	cancel()
+	p.Wait()
+	assert.Equal(t, int32(0), atomic.LoadInt32(&running))
+	assert.Equal(t, int32(4), atomic.LoadInt32(&stopped))
+	// the pool is not resized once it is waited for
+	p.Resize(3)
+	assert.Equal(t, int32(0), atomic.LoadInt32(&running))
+}
@@ -0,0 +1,236 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/config"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/logger"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// exporter parameters
+const (
+	exportQueueSize = 2048
+	exportBatchSize = 512
+	exportInterval  = 5 * time.Second
+	exportTimeout   = 10 * time.Second
+	// tracesPath is appended to the OTLP endpoint as required by the OTLP/HTTP specification
+	tracesPath = "/v1/traces"
+	// scopeName names the instrumentation producing the spans
+	scopeName = "github.com/danilovkiri/dk_go_url_shortener/internal/tracing"
+)
+
+// OTLP status codes.
+const (
+	statusCodeUnset = 0
+	statusCodeError = 2
+)
+
+// exporter batches ended spans and posts them to an OTLP/HTTP endpoint in the JSON encoding.
+type exporter struct {
+	url         string
+	serviceName string
+	client      *http.Client
+	log         *logger.Logger
+	queue       chan *Span
+	done        chan struct{}
+	stopped     chan struct{}
+}
+
+// newExporter initializes an exporter and starts its goroutine.
+func newExporter(cfg *config.TracingConfig, log *logger.Logger) *exporter {
+	e := &exporter{
+		url:         strings.TrimSuffix(cfg.Endpoint, "/") + tracesPath,
+		serviceName: cfg.ServiceName,
+		client:      &http.Client{Timeout: exportTimeout},
+		log:         log,
+		queue:       make(chan *Span, exportQueueSize),
+		done:        make(chan struct{}),
+		stopped:     make(chan struct{}),
+	}
+	go e.run()
+	return e
+}
+
+// enqueue queues span for export, spans are dropped rather than blocking callers when the queue is full or the
+// exporter is shut down.
+func (e *exporter) enqueue(span *Span) {
+	select {
+	case <-e.done:
+		return
+	default:
+	}
+	select {
+	case e.queue <- span:
+	default:
+		e.log.Debug("Exporting spans: queue is full, dropping span", logger.String("name", span.name))
+	}
+}
+
+// run collects queued spans into batches and exports them by size, by interval and on shutdown.
+func (e *exporter) run() {
+	defer close(e.stopped)
+	t := time.NewTicker(exportInterval)
+	defer t.Stop()
+	batch := make([]*Span, 0, exportBatchSize)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		err := e.export(batch)
+		if err != nil {
+			e.log.Warn("Exporting spans", logger.Error(err), logger.Int("count", len(batch)))
+		}
+		batch = make([]*Span, 0, exportBatchSize)
+	}
+	for {
+		select {
+		case span := <-e.queue:
+			batch = append(batch, span)
+			if len(batch) >= exportBatchSize {
+				flush()
+			}
+		case <-t.C:
+			flush()
+		case <-e.done:
+			for {
+				select {
+				case span := <-e.queue:
+					batch = append(batch, span)
+				default:
+					flush()
+					return
+				}
+			}
+		}
+	}
+}
+
+// shutdown stops accepting spans and waits until queued ones are exported or ctx is done.
+func (e *exporter) shutdown(ctx context.Context) error {
+	close(e.done)
+	select {
+	case <-e.stopped:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// export posts spans to the endpoint.
+func (e *exporter) export(spans []*Span) error {
+	body, err := json.Marshal(e.request(spans))
+	if err != nil {
+		return err
+	}
+	res, err := e.client.Post(e.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("OTLP endpoint responded with %s", res.Status)
+	}
+	return nil
+}
+
+// request converts spans into an OTLP ExportTraceServiceRequest.
+func (e *exporter) request(spans []*Span) otlpRequest {
+	converted := make([]otlpSpan, 0, len(spans))
+	for _, span := range spans {
+		s := otlpSpan{
+			TraceID:           span.sc.TraceID.String(),
+			SpanID:            span.sc.SpanID.String(),
+			Name:              span.name,
+			Kind:              int(span.kind),
+			StartTimeUnixNano: strconv.FormatInt(span.start.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(span.end.UnixNano(), 10),
+			Attributes:        otlpAttributes(span.attrs),
+			Status:            otlpStatus{Code: statusCodeUnset},
+		}
+		if span.parentID.IsValid() {
+			s.ParentSpanID = span.parentID.String()
+		}
+		if span.err != nil {
+			s.Status = otlpStatus{Code: statusCodeError, Message: span.err.Error()}
+		}
+		converted = append(converted, s)
+	}
+	return otlpRequest{ResourceSpans: []otlpResourceSpans{{
+		Resource:   otlpResource{Attributes: otlpAttributes([]Attribute{String("service.name", e.serviceName)})},
+		ScopeSpans: []otlpScopeSpans{{Scope: otlpScope{Name: scopeName}, Spans: converted}},
+	}}}
+}
+
+// otlpAttributes converts attrs into OTLP key-values, unsupported values are formatted as strings.
+func otlpAttributes(attrs []Attribute) []otlpKeyValue {
+	converted := make([]otlpKeyValue, 0, len(attrs))
+	for _, attr := range attrs {
+		var value otlpAnyValue
+		switch v := attr.Value.(type) {
+		case string:
+			value.StringValue = &v
+		case int:
+			// 64-bit integers are strings in the OTLP JSON encoding
+			s := strconv.Itoa(v)
+			value.IntValue = &s
+		case bool:
+			value.BoolValue = &v
+		default:
+			s := fmt.Sprint(v)
+			value.StringValue = &s
+		}
+		converted = append(converted, otlpKeyValue{Key: attr.Key, Value: value})
+	}
+	return converted
+}
+
+// OTLP JSON encoding of an ExportTraceServiceRequest, IDs are hex strings as required for OTLP/HTTP JSON.
+type (
+	otlpRequest struct {
+		ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+	}
+	otlpResourceSpans struct {
+		Resource   otlpResource     `json:"resource"`
+		ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+	}
+	otlpResource struct {
+		Attributes []otlpKeyValue `json:"attributes"`
+	}
+	otlpScopeSpans struct {
+		Scope otlpScope  `json:"scope"`
+		Spans []otlpSpan `json:"spans"`
+	}
+	otlpScope struct {
+		Name string `json:"name"`
+	}
+	otlpSpan struct {
+		TraceID           string         `json:"traceId"`
+		SpanID            string         `json:"spanId"`
+		ParentSpanID      string         `json:"parentSpanId,omitempty"`
+		Name              string         `json:"name"`
+		Kind              int            `json:"kind"`
+		StartTimeUnixNano string         `json:"startTimeUnixNano"`
+		EndTimeUnixNano   string         `json:"endTimeUnixNano"`
+		Attributes        []otlpKeyValue `json:"attributes,omitempty"`
+		Status            otlpStatus     `json:"status"`
+	}
+	otlpStatus struct {
+		Message string `json:"message,omitempty"`
+		Code    int    `json:"code"`
+	}
+	otlpKeyValue struct {
+		Key   string       `json:"key"`
+		Value otlpAnyValue `json:"value"`
+	}
+	otlpAnyValue struct {
+		StringValue *string `json:"stringValue,omitempty"`
+		IntValue    *string `json:"intValue,omitempty"`
+		BoolValue   *bool   `json:"boolValue,omitempty"`
+	}
+)
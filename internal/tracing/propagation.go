@@ -0,0 +1,49 @@
+package tracing
+
+import (
+	"encoding/hex"
+	"strings"
+)
+
+// TraceparentHeader is the W3C trace context header carrying the SpanContext of the caller.
+const TraceparentHeader = "traceparent"
+
+// traceparent format version and the sampled flag.
+const (
+	traceparentVersion = "00"
+	sampledFlag        = 0x01
+)
+
+// ParseTraceparent parses a traceparent header value, ok is false for malformed or invalid values which must be
+// ignored.
+func ParseTraceparent(value string) (sc SpanContext, ok bool) {
+	parts := strings.Split(strings.TrimSpace(value), "-")
+	// future versions may append fields, version ff is forbidden
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" || (parts[0] == traceparentVersion && len(parts) != 4) {
+		return SpanContext{}, false
+	}
+	if len(parts[1]) != 2*len(sc.TraceID) || len(parts[2]) != 2*len(sc.SpanID) || len(parts[3]) != 2 {
+		return SpanContext{}, false
+	}
+	if _, err := hex.Decode(sc.TraceID[:], []byte(parts[1])); err != nil {
+		return SpanContext{}, false
+	}
+	if _, err := hex.Decode(sc.SpanID[:], []byte(parts[2])); err != nil {
+		return SpanContext{}, false
+	}
+	var flags [1]byte
+	if _, err := hex.Decode(flags[:], []byte(parts[3])); err != nil {
+		return SpanContext{}, false
+	}
+	sc.Sampled = flags[0]&sampledFlag != 0
+	return sc, sc.IsValid()
+}
+
+// Traceparent formats sc as a traceparent header value.
+func (sc SpanContext) Traceparent() string {
+	flags := "00"
+	if sc.Sampled {
+		flags = "01"
+	}
+	return traceparentVersion + "-" + sc.TraceID.String() + "-" + sc.SpanID.String() + "-" + flags
+}
@@ -0,0 +1,240 @@
+// Package tracing provides spans exported to an OpenTelemetry collector via OTLP/HTTP and W3C trace context
+// propagation.
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/config"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/logger"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// TraceID identifies a trace.
+type TraceID [16]byte
+
+// String returns the lower-case hex representation of id.
+func (id TraceID) String() string {
+	return hex.EncodeToString(id[:])
+}
+
+// IsValid reports whether id is not all zeros.
+func (id TraceID) IsValid() bool {
+	return id != TraceID{}
+}
+
+// SpanID identifies a span within a trace.
+type SpanID [8]byte
+
+// String returns the lower-case hex representation of id.
+func (id SpanID) String() string {
+	return hex.EncodeToString(id[:])
+}
+
+// IsValid reports whether id is not all zeros.
+func (id SpanID) IsValid() bool {
+	return id != SpanID{}
+}
+
+// SpanKind defines the role of a span in a trace, values match OTLP.
+type SpanKind int
+
+// Span kinds used by the service.
+const (
+	KindInternal SpanKind = 1
+	KindServer   SpanKind = 2
+	KindClient   SpanKind = 3
+)
+
+// Attribute defines a key-value pair describing a span.
+type Attribute struct {
+	Key   string
+	Value interface{}
+}
+
+// String returns a string Attribute.
+func String(key, value string) Attribute {
+	return Attribute{Key: key, Value: value}
+}
+
+// Int returns an integer Attribute.
+func Int(key string, value int) Attribute {
+	return Attribute{Key: key, Value: value}
+}
+
+// Bool returns a boolean Attribute.
+func Bool(key string, value bool) Attribute {
+	return Attribute{Key: key, Value: value}
+}
+
+// SpanContext identifies a span and is propagated across process boundaries.
+type SpanContext struct {
+	TraceID TraceID
+	SpanID  SpanID
+	Sampled bool
+}
+
+// IsValid reports whether sc has both a trace and a span ID.
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID.IsValid() && sc.SpanID.IsValid()
+}
+
+// Span records one operation of a trace. A nil Span discards everything, so callers never check whether tracing is
+// enabled.
+type Span struct {
+	tracer   *Tracer
+	sc       SpanContext
+	parentID SpanID
+	kind     SpanKind
+	start    time.Time
+
+	mu    sync.Mutex
+	name  string
+	attrs []Attribute
+	end   time.Time
+	err   error
+	ended bool
+}
+
+// SpanContext returns the identity of s.
+func (s *Span) SpanContext() SpanContext {
+	if s == nil {
+		return SpanContext{}
+	}
+	return s.sc
+}
+
+// SetName renames s, names known only by the end of the operation are set this way.
+func (s *Span) SetName(name string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.ended {
+		s.name = name
+	}
+}
+
+// SetAttributes adds attrs to s.
+func (s *Span) SetAttributes(attrs ...Attribute) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.ended {
+		s.attrs = append(s.attrs, attrs...)
+	}
+}
+
+// End finishes s and queues it for export, a non-nil err marks the operation failed. Calls after the first one are
+// ignored.
+func (s *Span) End(err error) {
+	if s == nil || s.tracer == nil {
+		return
+	}
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.end = time.Now()
+	s.err = err
+	s.mu.Unlock()
+	if s.sc.Sampled {
+		s.tracer.exporter.enqueue(s)
+	}
+}
+
+// Tracer starts spans and exports ended ones. A nil Tracer starts no spans.
+type Tracer struct {
+	exporter *exporter
+}
+
+// NewTracer initializes a Tracer exporting spans to the OTLP/HTTP endpoint of cfg, it returns nil when no endpoint is
+// set. Tracer must be shut down to export spans still queued.
+func NewTracer(cfg *config.TracingConfig, log *logger.Logger) *Tracer {
+	if cfg.Endpoint == "" {
+		return nil
+	}
+	return &Tracer{exporter: newExporter(cfg, log)}
+}
+
+// Start starts a span named name as a child of the span carried by ctx or as a root of a new trace, and returns a copy
+// of ctx carrying the new span.
+func (t *Tracer) Start(ctx context.Context, name string, kind SpanKind, attrs ...Attribute) (context.Context, *Span) {
+	if t == nil {
+		return ctx, nil
+	}
+	span := &Span{tracer: t, name: name, kind: kind, start: time.Now(), attrs: attrs}
+	if parent := SpanFromContext(ctx); parent != nil {
+		span.sc = SpanContext{TraceID: parent.sc.TraceID, Sampled: parent.sc.Sampled}
+		span.parentID = parent.sc.SpanID
+	} else {
+		span.sc = SpanContext{TraceID: newTraceID(), Sampled: true}
+	}
+	span.sc.SpanID = newSpanID()
+	return ContextWithSpan(ctx, span), span
+}
+
+// Shutdown exports queued spans and stops the exporter, spans ended afterwards are dropped.
+func (t *Tracer) Shutdown(ctx context.Context) error {
+	if t == nil {
+		return nil
+	}
+	return t.exporter.shutdown(ctx)
+}
+
+// global holds the Tracer used by Start.
+var global atomic.Value
+
+// SetTracer sets the Tracer used by Start, t may be nil to disable tracing.
+func SetTracer(t *Tracer) {
+	global.Store(&t)
+}
+
+// Start starts a span with the Tracer set by SetTracer, see Tracer.Start.
+func Start(ctx context.Context, name string, kind SpanKind, attrs ...Attribute) (context.Context, *Span) {
+	t, _ := global.Load().(**Tracer)
+	if t == nil {
+		return ctx, nil
+	}
+	return (*t).Start(ctx, name, kind, attrs...)
+}
+
+// contextKey is the context key of the current span.
+type contextKey struct{}
+
+// ContextWithSpan returns a copy of ctx carrying span.
+func ContextWithSpan(ctx context.Context, span *Span) context.Context {
+	return context.WithValue(ctx, contextKey{}, span)
+}
+
+// ContextWithRemoteParent returns a copy of ctx carrying sc of a span started by another process, spans started from
+// it join its trace.
+func ContextWithRemoteParent(ctx context.Context, sc SpanContext) context.Context {
+	return ContextWithSpan(ctx, &Span{sc: sc})
+}
+
+// SpanFromContext returns the span carried by ctx or nil if there is none.
+func SpanFromContext(ctx context.Context) *Span {
+	span, _ := ctx.Value(contextKey{}).(*Span)
+	return span
+}
+
+// newTraceID returns a random TraceID.
+func newTraceID() (id TraceID) {
+	_, _ = rand.Read(id[:])
+	return id
+}
+
+// newSpanID returns a random SpanID.
+func newSpanID() (id SpanID) {
+	_, _ = rand.Read(id[:])
+	return id
+}
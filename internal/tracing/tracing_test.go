@@ -0,0 +1,90 @@
+package tracing
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestParseTraceparent(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		ok    bool
+	}{
+		{name: "Sampled", value: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", ok: true},
+		{name: "Not sampled", value: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00", ok: true},
+		{name: "Future version with extra fields", value: "01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra", ok: true},
+		{name: "Empty", value: "", ok: false},
+		{name: "Forbidden version", value: "ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", ok: false},
+		{name: "Zero trace ID", value: "00-00000000000000000000000000000000-00f067aa0ba902b7-01", ok: false},
+		{name: "Short span ID", value: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba9-01", ok: false},
+		{name: "Not hex", value: "00-4bf92f3577b34da6a3ce929d0e0e473z-00f067aa0ba902b7-01", ok: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sc, ok := ParseTraceparent(tt.value)
+			assert.Equal(t, tt.ok, ok)
+			if ok && tt.value[:2] == traceparentVersion {
+				assert.Equal(t, tt.value, sc.Traceparent())
+			}
+		})
+	}
+}
+
+func TestTracerExport(t *testing.T) {
+	requests := make(chan otlpRequest, 1)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, tracesPath, r.URL.Path)
+		body, _ := ioutil.ReadAll(r.Body)
+		var req otlpRequest
+		assert.NoError(t, json.Unmarshal(body, &req))
+		requests <- req
+	}))
+	defer ts.Close()
+	tracer := NewTracer(&config.TracingConfig{Endpoint: ts.URL, ServiceName: "test"}, nil)
+	require.NotNil(t, tracer)
+
+	parent, _ := ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	ctx := ContextWithRemoteParent(context.Background(), parent)
+	ctx, server := tracer.Start(ctx, "GET", KindServer)
+	_, client := tracer.Start(ctx, "storage.retrieve", KindClient, String("db.operation", "retrieve"), Int("rows", 1))
+	client.End(errors.New("not found"))
+	server.SetName("GET /{urlID}")
+	server.End(nil)
+	require.NoError(t, tracer.Shutdown(context.Background()))
+
+	req := <-requests
+	require.Len(t, req.ResourceSpans, 1)
+	assert.Equal(t, "test", *req.ResourceSpans[0].Resource.Attributes[0].Value.StringValue)
+	spans := req.ResourceSpans[0].ScopeSpans[0].Spans
+	require.Len(t, spans, 2)
+	assert.Equal(t, "storage.retrieve", spans[0].Name)
+	assert.Equal(t, "GET /{urlID}", spans[1].Name)
+	for _, span := range spans {
+		assert.Equal(t, parent.TraceID.String(), span.TraceID)
+	}
+	assert.Equal(t, parent.SpanID.String(), spans[1].ParentSpanID)
+	assert.Equal(t, spans[1].SpanID, spans[0].ParentSpanID)
+	assert.Equal(t, otlpStatus{Code: statusCodeError, Message: "not found"}, spans[0].Status)
+	assert.Equal(t, "1", *spans[0].Attributes[1].Value.IntValue)
+	assert.Equal(t, otlpStatus{Code: statusCodeUnset}, spans[1].Status)
+}
+
+func TestNilTracer(t *testing.T) {
+	tracer := NewTracer(&config.TracingConfig{}, nil)
+	assert.Nil(t, tracer)
+	ctx, span := tracer.Start(context.Background(), "noop", KindInternal)
+	assert.Nil(t, SpanFromContext(ctx))
+	span.SetAttributes(String("key", "value"))
+	span.End(nil)
+	assert.False(t, span.SpanContext().IsValid())
+	assert.NoError(t, tracer.Shutdown(context.Background()))
+}
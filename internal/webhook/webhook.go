@@ -0,0 +1,303 @@
+// Package webhook provides delivery of signed link lifecycle events to configured HTTP endpoints.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/config"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/logger"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/service/modelurl"
+	"github.com/google/uuid"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Headers sent along with every payload, SignatureHeader carries "sha256=" followed by the hex-encoded HMAC-SHA256
+// of TimestampHeader value, a dot and the body keyed by the configured secret (see Sign).
+const (
+	IDHeader        = "X-Webhook-Id"
+	EventHeader     = "X-Webhook-Event"
+	TimestampHeader = "X-Webhook-Timestamp"
+	SignatureHeader = "X-Webhook-Signature"
+)
+
+// Delivery statuses.
+const (
+	StatusPending   = "pending"
+	StatusDelivered = "delivered"
+	StatusFailed    = "failed"
+)
+
+// dispatcher parameters
+const (
+	deliveryWorkers = 4
+	// maxBackoff caps the exponential delay between delivery attempts
+	maxBackoff = time.Minute
+	// historySize limits the number of deliveries kept for the delivery status endpoint
+	historySize = 1000
+)
+
+// Payload defines the JSON body posted to webhook targets.
+type Payload struct {
+	ID         string      `json:"id"`
+	Type       string      `json:"type"`
+	OccurredAt time.Time   `json:"occurred_at"`
+	Data       PayloadData `json:"data"`
+}
+
+// PayloadData describes the link an event happened to.
+type PayloadData struct {
+	ShortID     string `json:"short_id"`
+	OriginalURL string `json:"original_url"`
+	UserID      string `json:"user_id"`
+}
+
+// Delivery defines the state of delivering one event to one target.
+type Delivery struct {
+	ID             string
+	EventID        string
+	EventType      string
+	Target         string
+	Status         string
+	Attempts       int
+	LastStatusCode int
+	LastError      string
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+	// NextAttemptAt is set for pending deliveries waiting for a retry
+	NextAttemptAt *time.Time
+}
+
+// job defines one delivery attempt.
+type job struct {
+	deliveryID string
+	eventID    string
+	eventType  string
+	target     string
+	body       []byte
+	attempt    int
+}
+
+// Dispatcher posts events to all configured targets in the background, retrying failed deliveries with exponential
+// backoff. A nil Dispatcher drops events.
+type Dispatcher struct {
+	cfg    *config.WebhookConfig
+	client *http.Client
+	log    *logger.Logger
+	queue  chan job
+	done   <-chan struct{}
+
+	mu         sync.Mutex
+	deliveries map[string]*Delivery
+	// history holds delivery IDs oldest first
+	history []string
+}
+
+// NewDispatcher initializes a Dispatcher and starts its workers which stop when ctx is done, it returns nil when no
+// targets are configured. Deliveries pending at that moment are abandoned.
+func NewDispatcher(ctx context.Context, cfg *config.WebhookConfig, log *logger.Logger) *Dispatcher {
+	if len(cfg.URLs) == 0 {
+		return nil
+	}
+	d := &Dispatcher{
+		cfg:        cfg,
+		client:     &http.Client{Timeout: cfg.Timeout},
+		log:        log,
+		queue:      make(chan job, cfg.QueueSize),
+		done:       ctx.Done(),
+		deliveries: make(map[string]*Delivery),
+	}
+	for i := 0; i < deliveryWorkers; i++ {
+		go func() {
+			for {
+				select {
+				case <-d.done:
+					return
+				case j := <-d.queue:
+					d.deliver(ctx, j)
+				}
+			}
+		}()
+	}
+	return d
+}
+
+// Publish queues event for delivery to every target without blocking.
+func (d *Dispatcher) Publish(event modelurl.Event) {
+	if d == nil {
+		return
+	}
+	payload := Payload{
+		ID:         uuid.New().String(),
+		Type:       event.Type,
+		OccurredAt: event.OccurredAt,
+		Data:       PayloadData{ShortID: event.SURL, OriginalURL: event.URL, UserID: event.UserID},
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		d.log.Error("Publishing webhook event", logger.Error(err))
+		return
+	}
+	now := time.Now().UTC()
+	for _, target := range d.cfg.URLs {
+		delivery := &Delivery{
+			ID:        uuid.New().String(),
+			EventID:   payload.ID,
+			EventType: payload.Type,
+			Target:    target,
+			Status:    StatusPending,
+			CreatedAt: now,
+			UpdatedAt: now,
+		}
+		d.record(delivery)
+		d.enqueue(job{deliveryID: delivery.ID, eventID: payload.ID, eventType: payload.Type, target: target, body: body, attempt: 1})
+	}
+}
+
+// Deliveries returns copies of recent deliveries, newest first.
+func (d *Dispatcher) Deliveries() []Delivery {
+	if d == nil {
+		return nil
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	deliveries := make([]Delivery, 0, len(d.history))
+	for i := len(d.history) - 1; i >= 0; i-- {
+		deliveries = append(deliveries, *d.deliveries[d.history[i]])
+	}
+	// keep deliveries created at once in a stable order
+	sort.SliceStable(deliveries, func(i, j int) bool {
+		return deliveries[i].CreatedAt.After(deliveries[j].CreatedAt)
+	})
+	return deliveries
+}
+
+// Sign returns the SignatureHeader value for body sent at timestamp.
+func Sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// enqueue queues j unless the Dispatcher is stopped, j fails when the queue is full.
+func (d *Dispatcher) enqueue(j job) {
+	select {
+	case <-d.done:
+		return
+	default:
+	}
+	select {
+	case d.queue <- j:
+	default:
+		d.log.Warn("Delivering webhook: queue is full", logger.String("event", j.eventType), logger.String("target", j.target))
+		d.update(j.deliveryID, func(delivery *Delivery) {
+			delivery.Status = StatusFailed
+			delivery.LastError = "delivery queue is full"
+			delivery.NextAttemptAt = nil
+		})
+	}
+}
+
+// deliver makes one delivery attempt and schedules a retry when it fails and attempts are left.
+func (d *Dispatcher) deliver(ctx context.Context, j job) {
+	code, err := d.post(ctx, j)
+	if err == nil && (code < 200 || code > 299) {
+		err = fmt.Errorf("target responded with %d %s", code, http.StatusText(code))
+	}
+	retry := err != nil && j.attempt < d.cfg.MaxAttempts
+	backoff := d.backoff(j.attempt)
+	d.update(j.deliveryID, func(delivery *Delivery) {
+		delivery.Attempts = j.attempt
+		delivery.LastStatusCode = code
+		delivery.LastError = ""
+		delivery.NextAttemptAt = nil
+		switch {
+		case err == nil:
+			delivery.Status = StatusDelivered
+		case retry:
+			delivery.LastError = err.Error()
+			next := time.Now().UTC().Add(backoff)
+			delivery.NextAttemptAt = &next
+		default:
+			delivery.Status = StatusFailed
+			delivery.LastError = err.Error()
+		}
+	})
+	if err == nil {
+		d.log.Debug("Delivering webhook", logger.String("event", j.eventType), logger.String("target", j.target))
+		return
+	}
+	d.log.Warn("Delivering webhook", logger.Error(err), logger.String("event", j.eventType), logger.String("target", j.target), logger.Int("attempt", j.attempt))
+	if retry {
+		j.attempt++
+		time.AfterFunc(backoff, func() {
+			d.enqueue(j)
+		})
+	}
+}
+
+// post sends j to its target and returns the response status code.
+func (d *Dispatcher) post(ctx context.Context, j job) (code int, err error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, j.target, bytes.NewReader(j.body))
+	if err != nil {
+		return 0, err
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(IDHeader, j.eventID)
+	req.Header.Set(EventHeader, j.eventType)
+	req.Header.Set(TimestampHeader, timestamp)
+	req.Header.Set(SignatureHeader, Sign(d.cfg.Secret, timestamp, j.body))
+	res, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+	return res.StatusCode, nil
+}
+
+// backoff returns the delay after the given attempt.
+func (d *Dispatcher) backoff(attempt int) time.Duration {
+	backoff := d.cfg.Backoff
+	for i := 1; i < attempt && backoff < maxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > maxBackoff {
+		backoff = maxBackoff
+	}
+	return backoff
+}
+
+// record adds delivery to the history evicting the oldest one when it is full.
+func (d *Dispatcher) record(delivery *Delivery) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if len(d.history) == historySize {
+		delete(d.deliveries, d.history[0])
+		d.history = d.history[1:]
+	}
+	d.deliveries[delivery.ID] = delivery
+	d.history = append(d.history, delivery.ID)
+}
+
+// update applies fn to the delivery with id unless it is already evicted from the history.
+func (d *Dispatcher) update(id string, fn func(delivery *Delivery)) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	delivery, ok := d.deliveries[id]
+	if !ok {
+		return
+	}
+	fn(delivery)
+	delivery.UpdatedAt = time.Now().UTC()
+}
@@ -0,0 +1,113 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/config"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/service/modelurl"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func testConfig(urls ...string) *config.WebhookConfig {
+	return &config.WebhookConfig{
+		URLs:        urls,
+		Secret:      "secret",
+		MaxAttempts: 3,
+		Backoff:     10 * time.Millisecond,
+		Timeout:     time.Second,
+		QueueSize:   10,
+	}
+}
+
+// waitDeliveries waits until no delivery is pending and returns them.
+func waitDeliveries(t *testing.T, d *Dispatcher) []Delivery {
+	var deliveries []Delivery
+	require.Eventually(t, func() bool {
+		deliveries = d.Deliveries()
+		for _, delivery := range deliveries {
+			if delivery.Status == StatusPending {
+				return false
+			}
+		}
+		return true
+	}, 5*time.Second, 10*time.Millisecond)
+	return deliveries
+}
+
+func TestDispatcherRetries(t *testing.T) {
+	var calls int32
+	payloads := make(chan Payload, 1)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		assert.Equal(t, Sign("secret", r.Header.Get(TimestampHeader), body), r.Header.Get(SignatureHeader))
+		assert.Equal(t, modelurl.EventURLCreated, r.Header.Get(EventHeader))
+		// fail the first attempt
+		if atomic.AddInt32(&calls, 1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		var payload Payload
+		assert.NoError(t, json.Unmarshal(body, &payload))
+		assert.Equal(t, payload.ID, r.Header.Get(IDHeader))
+		payloads <- payload
+	}))
+	defer ts.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	d := NewDispatcher(ctx, testConfig(ts.URL), nil)
+	require.NotNil(t, d)
+
+	d.Publish(modelurl.Event{Type: modelurl.EventURLCreated, SURL: "abc", URL: "https://example.com", UserID: "user", OccurredAt: time.Now().UTC()})
+	deliveries := waitDeliveries(t, d)
+	require.Len(t, deliveries, 1)
+	assert.Equal(t, StatusDelivered, deliveries[0].Status)
+	assert.Equal(t, 2, deliveries[0].Attempts)
+	assert.Equal(t, http.StatusOK, deliveries[0].LastStatusCode)
+	assert.Empty(t, deliveries[0].LastError)
+	payload := <-payloads
+	assert.Equal(t, deliveries[0].EventID, payload.ID)
+	assert.Equal(t, PayloadData{ShortID: "abc", OriginalURL: "https://example.com", UserID: "user"}, payload.Data)
+}
+
+func TestDispatcherGivesUp(t *testing.T) {
+	var calls int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer ts.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	d := NewDispatcher(ctx, testConfig(ts.URL), nil)
+
+	d.Publish(modelurl.Event{Type: modelurl.EventURLDeleted, SURL: "abc"})
+	deliveries := waitDeliveries(t, d)
+	require.Len(t, deliveries, 1)
+	assert.Equal(t, StatusFailed, deliveries[0].Status)
+	assert.Equal(t, 3, deliveries[0].Attempts)
+	assert.Equal(t, http.StatusInternalServerError, deliveries[0].LastStatusCode)
+	assert.NotEmpty(t, deliveries[0].LastError)
+	assert.Nil(t, deliveries[0].NextAttemptAt)
+	assert.Equal(t, int32(3), atomic.LoadInt32(&calls))
+}
+
+func TestBackoff(t *testing.T) {
+	d := &Dispatcher{cfg: &config.WebhookConfig{Backoff: time.Second}}
+	assert.Equal(t, time.Second, d.backoff(1))
+	assert.Equal(t, 4*time.Second, d.backoff(3))
+	assert.Equal(t, maxBackoff, d.backoff(10))
+}
+
+func TestNilDispatcher(t *testing.T) {
+	d := NewDispatcher(context.Background(), &config.WebhookConfig{}, nil)
+	assert.Nil(t, d)
+	d.Publish(modelurl.Event{Type: modelurl.EventURLCreated})
+	assert.Empty(t, d.Deliveries())
+}